@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	"github.com/spf13/cobra"
+	"org.xyzmaps.xyztiles/src/imagery"
+	"org.xyzmaps.xyztiles/src/resources"
+)
+
+// aspectTolerance is how far width/height may deviate from 2:1
+const aspectTolerance = 0.01
+
+var (
+	checkImagePath string
+	checkMaxPixels int64
+)
+
+var checkCmd = &cobra.Command{
+	Use:   "check",
+	Short: "Validate that a base map image loads and renders",
+	Long: `Decode the base map image, verify it has the 2:1 aspect ratio of an
+equirectangular world map, and render sample tiles. Reports the image
+dimensions, native maximum zoom and estimated memory use, and exits
+non-zero if any step fails.`,
+	SilenceUsage:  true,
+	SilenceErrors: true, // Execute reports the error
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runCheck(cmd.OutOrStdout(), checkImagePath, checkMaxPixels)
+	},
+}
+
+func init() {
+	checkCmd.Flags().StringVarP(&checkImagePath, "image", "i", "", "Path to the image to check (defaults to the embedded map)")
+	checkCmd.Flags().Int64Var(&checkMaxPixels, "max-image-pixels", 0, "Fail if the image is larger than this many pixels (width*height), 0 for no limit")
+	rootCmd.AddCommand(checkCmd)
+}
+
+// runCheck validates the image at path (or the embedded map if path is
+// empty), writing a report to w. It returns an error on the first failure.
+func runCheck(w io.Writer, path string, maxPixels int64) error {
+	opts := imagery.LoadOptions{MaxPixels: maxPixels}
+
+	var info imagery.ImageInfo
+	var basemap *imagery.BaseMap
+	var err error
+	if path == "" {
+		if !resources.HasEmbeddedMap() {
+			return errors.New("no embedded map available and --image not provided")
+		}
+		fmt.Fprintln(w, "Image:           embedded world map")
+		info, err = imagery.ReadImageInfoFromBytes(resources.DefaultWorldMap)
+		if err == nil {
+			basemap, err = imagery.LoadImageFromBytes(resources.DefaultWorldMap, opts)
+		}
+	} else {
+		fmt.Fprintf(w, "Image:           %s\n", path)
+		info, err = imagery.ReadImageInfo(path)
+		if err == nil {
+			basemap, err = imagery.LoadImage(path, opts)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("image does not load: %w", err)
+	}
+
+	fmt.Fprintf(w, "Format:          %s\n", info.Format)
+	fmt.Fprintf(w, "Dimensions:      %dx%d\n", basemap.Width(), basemap.Height())
+
+	aspect := float64(basemap.Width()) / float64(basemap.Height())
+	fmt.Fprintf(w, "Aspect ratio:    %.3f:1\n", aspect)
+	if math.Abs(aspect-2) > 2*aspectTolerance {
+		return fmt.Errorf("aspect ratio %.3f:1 is not 2:1; an equirectangular world map must be twice as wide as it is tall", aspect)
+	}
+
+	nativeMax := basemap.NativeMaxZoom()
+	fmt.Fprintf(w, "Native max zoom: %d\n", nativeMax)
+	fmt.Fprintf(w, "Memory (image):  %.1f MB\n", float64(basemap.MemoryBytes())/(1<<20))
+
+	// Render the world tile and a tile from the middle of the native range
+	midZoom := max(1, (nativeMax+1)/2)
+	mid := 1 << uint(midZoom) / 2
+	for _, tile := range [][3]int{{0, 0, 0}, {midZoom, mid, mid}} {
+		start := time.Now()
+		if _, err := basemap.ExtractTile(tile[0], tile[1], tile[2]); err != nil {
+			return fmt.Errorf("failed to render tile %d/%d/%d: %w", tile[0], tile[1], tile[2], err)
+		}
+		label := fmt.Sprintf("Tile %d/%d/%d:", tile[0], tile[1], tile[2])
+		fmt.Fprintf(w, "%-17sOK (%s)\n", label, time.Since(start).Round(time.Millisecond))
+	}
+
+	fmt.Fprintln(w, "Check passed")
+	return nil
+}
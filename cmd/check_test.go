@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeTestPNG writes a width x height PNG to a temp file and returns its path
+func writeTestPNG(t *testing.T, width, height int) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "world.png")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	defer f.Close()
+
+	if err := png.Encode(f, image.NewRGBA(image.Rect(0, 0, width, height))); err != nil {
+		t.Fatalf("Failed to encode PNG: %v", err)
+	}
+	return path
+}
+
+func TestRunCheck_ValidImage(t *testing.T) {
+	var buf bytes.Buffer
+	if err := runCheck(&buf, writeTestPNG(t, 1024, 512), 0); err != nil {
+		t.Fatalf("runCheck() failed: %v\n%s", err, buf.String())
+	}
+
+	out := buf.String()
+	for _, want := range []string{"Format:          png", "Dimensions:      1024x512", "Native max zoom: 1", "Tile 0/0/0:", "Check passed"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected output to contain %q, got:\n%s", want, out)
+		}
+	}
+}
+
+func TestRunCheck_Failures(t *testing.T) {
+	corrupt := filepath.Join(t.TempDir(), "corrupt.jpg")
+	if err := os.WriteFile(corrupt, []byte("\xff\xd8\xff not really a jpeg"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	tests := []struct {
+		path      string
+		maxPixels int64
+		name      string
+	}{
+		{corrupt, 0, "corrupt image"},
+		{filepath.Join(t.TempDir(), "missing.jpg"), 0, "missing file"},
+		{writeTestPNG(t, 512, 512), 0, "square image"},
+		{writeTestPNG(t, 1024, 512), 1000, "over pixel limit"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := runCheck(&buf, tt.path, tt.maxPixels); err == nil {
+				t.Errorf("Expected check to fail, got output:\n%s", buf.String())
+			}
+		})
+	}
+}
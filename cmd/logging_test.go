@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestNewLogger_Levels(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := newLogger(&buf, "warn", "text")
+	if err != nil {
+		t.Fatalf("newLogger() failed: %v", err)
+	}
+
+	logger.Info("hidden message")
+	logger.Warn("visible message")
+
+	out := buf.String()
+	if strings.Contains(out, "hidden message") {
+		t.Error("Info message should be filtered at warn level")
+	}
+	if !strings.Contains(out, "visible message") {
+		t.Error("Warn message should be logged at warn level")
+	}
+}
+
+func TestNewLogger_JSON(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := newLogger(&buf, "DEBUG", "json")
+	if err != nil {
+		t.Fatalf("newLogger() failed: %v", err)
+	}
+
+	logger.Debug("tile", "z", 3)
+
+	var entry map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("Expected JSON output, got %q: %v", buf.String(), err)
+	}
+	if entry["level"] != "DEBUG" || entry["msg"] != "tile" || entry["z"] != float64(3) {
+		t.Errorf("Unexpected log entry: %v", entry)
+	}
+}
+
+func TestNewLogger_Invalid(t *testing.T) {
+	if _, err := newLogger(&bytes.Buffer{}, "verbose", "text"); err == nil {
+		t.Error("Expected error for invalid level, got nil")
+	}
+	if _, err := newLogger(&bytes.Buffer{}, "info", "xml"); err == nil {
+		t.Error("Expected error for invalid format, got nil")
+	}
+}
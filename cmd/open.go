@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"errors"
+	"log/slog"
+	"net"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"org.xyzmaps.xyztiles/src/server"
+)
+
+// startCommand starts a command, reaping it in the background once it
+// exits; tests replace it
+var startCommand = func(name string, args ...string) error {
+	cmd := exec.Command(name, args...)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	go cmd.Wait()
+	return nil
+}
+
+// browserUnavailable reports why this process cannot show a browser, or ""
+// if it can; tests replace it
+var browserUnavailable = func() string {
+	return headless(runtime.GOOS, os.Getenv, isTerminal(os.Stdout))
+}
+
+// viewerPath returns the path of the built-in viewer under cfg's base path:
+// "/", or "/viewer" when --static-dir takes "/". It reports false when the
+// viewer is disabled.
+func viewerPath(cfg server.Config) (string, bool) {
+	if cfg.DisableViewer {
+		return "", false
+	}
+	path := strings.TrimSuffix(cfg.BasePath, "/") + "/"
+	if cfg.StaticDir != "" {
+		path += "viewer"
+	}
+	return path, true
+}
+
+// viewerURL returns the URL of path served on addr, over HTTPS if secure. A
+// wildcard host is reached through localhost. Unix sockets have no URL.
+func viewerURL(addr net.Addr, secure bool, path string) (string, error) {
+	if addr.Network() != "tcp" {
+		return "", errors.New("the server is not listening on TCP")
+	}
+	host, port, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return "", err
+	}
+	if ip := net.ParseIP(host); host == "" || ip != nil && ip.IsUnspecified() {
+		host = "localhost"
+	}
+	scheme := "http://"
+	if secure {
+		scheme = "https://"
+	}
+	return scheme + net.JoinHostPort(host, port) + path, nil
+}
+
+// browserCommand returns the command opening url in the default browser on
+// goos
+func browserCommand(goos, url string) (string, []string) {
+	switch goos {
+	case "darwin":
+		return "open", []string{url}
+	case "windows":
+		return "rundll32", []string{"url.dll,FileProtocolHandler", url}
+	default:
+		return "xdg-open", []string{url}
+	}
+}
+
+// headless reports why no browser can be shown on goos, or "" if one can:
+// in CI, without a terminal, or on Unix without a display
+func headless(goos string, getenv func(string) string, terminal bool) string {
+	switch {
+	case getenv("CI") != "":
+		return "running in CI"
+	case !terminal:
+		return "not running in a terminal"
+	case goos != "darwin" && goos != "windows" && getenv("DISPLAY") == "" && getenv("WAYLAND_DISPLAY") == "":
+		return "no display"
+	}
+	return ""
+}
+
+// isTerminal reports whether f is a terminal
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// openViewer opens the viewer cfg serves on addr, over HTTPS if secure, in
+// the default browser, logging instead when that is not possible
+func openViewer(logger *slog.Logger, addr net.Addr, secure bool, cfg server.Config) {
+	path, ok := viewerPath(cfg)
+	if !ok {
+		logger.Warn("Not opening a browser", "reason", "the viewer is disabled")
+		return
+	}
+	url, err := viewerURL(addr, secure, path)
+	if err != nil {
+		logger.Warn("Not opening a browser", "reason", err.Error())
+		return
+	}
+	if reason := browserUnavailable(); reason != "" {
+		logger.Info("Not opening a browser", "reason", reason, "url", url)
+		return
+	}
+	name, args := browserCommand(runtime.GOOS, url)
+	if err := startCommand(name, args...); err != nil {
+		logger.Warn("Failed to open a browser", "url", url, "err", err)
+		return
+	}
+	logger.Info("Opened the viewer in a browser", "url", url)
+}
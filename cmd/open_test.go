@@ -0,0 +1,166 @@
+package cmd
+
+import (
+	"bytes"
+	"log/slog"
+	"net"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+
+	"org.xyzmaps.xyztiles/src/server"
+)
+
+func TestViewerURL(t *testing.T) {
+	tests := []struct {
+		addr     net.Addr
+		secure   bool
+		path     string
+		expected string
+		name     string
+	}{
+		{&net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 8080}, false, "/", "http://127.0.0.1:8080/", "loopback"},
+		{&net.TCPAddr{IP: net.IPv4zero, Port: 8080}, false, "/", "http://localhost:8080/", "IPv4 wildcard"},
+		{&net.TCPAddr{IP: net.IPv6unspecified, Port: 9000}, false, "/", "http://localhost:9000/", "IPv6 wildcard"},
+		{&net.TCPAddr{Port: 9000}, false, "/", "http://localhost:9000/", "any address"},
+		{&net.TCPAddr{IP: net.IPv6loopback, Port: 8080}, false, "/", "http://[::1]:8080/", "IPv6 literal"},
+		{&net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 8080}, false, "/maps/viewer", "http://127.0.0.1:8080/maps/viewer", "path"},
+		{&net.TCPAddr{IP: net.IPv4zero, Port: 8443}, true, "/", "https://localhost:8443/", "https"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := viewerURL(tt.addr, tt.secure, tt.path)
+			if err != nil {
+				t.Fatalf("viewerURL() failed: %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, got)
+			}
+		})
+	}
+
+	if _, err := viewerURL(&net.UnixAddr{Name: "/run/xyztiles.sock", Net: "unix"}, false, "/"); err == nil {
+		t.Error("Expected error for a Unix socket")
+	}
+}
+
+func TestViewerPath(t *testing.T) {
+	tests := []struct {
+		cfg      server.Config
+		expected string
+		expectOK bool
+		name     string
+	}{
+		{server.Config{}, "/", true, "root"},
+		{server.Config{BasePath: "/maps"}, "/maps/", true, "base path"},
+		{server.Config{BasePath: "/maps/"}, "/maps/", true, "base path with slash"},
+		{server.Config{StaticDir: "site"}, "/viewer", true, "static dir"},
+		{server.Config{BasePath: "/maps", StaticDir: "site"}, "/maps/viewer", true, "static dir under base path"},
+		{server.Config{DisableViewer: true}, "", false, "disabled"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := viewerPath(tt.cfg)
+			if got != tt.expected || ok != tt.expectOK {
+				t.Errorf("Expected %q %v, got %q %v", tt.expected, tt.expectOK, got, ok)
+			}
+		})
+	}
+}
+
+func TestBrowserCommand(t *testing.T) {
+	const url = "http://localhost:8080/"
+	tests := []struct {
+		goos       string
+		expectName string
+		expectArgs []string
+		name       string
+	}{
+		{"linux", "xdg-open", []string{url}, "linux"},
+		{"freebsd", "xdg-open", []string{url}, "bsd"},
+		{"darwin", "open", []string{url}, "macos"},
+		{"windows", "rundll32", []string{"url.dll,FileProtocolHandler", url}, "windows"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name, args := browserCommand(tt.goos, url)
+			if name != tt.expectName || !slices.Equal(args, tt.expectArgs) {
+				t.Errorf("Expected %s %v, got %s %v", tt.expectName, tt.expectArgs, name, args)
+			}
+		})
+	}
+}
+
+func TestHeadless(t *testing.T) {
+	tests := []struct {
+		goos     string
+		env      map[string]string
+		terminal bool
+		expected string
+		name     string
+	}{
+		{"linux", map[string]string{"DISPLAY": ":0"}, true, "", "linux desktop"},
+		{"linux", map[string]string{"WAYLAND_DISPLAY": "wayland-0"}, true, "", "wayland"},
+		{"darwin", nil, true, "", "macos"},
+		{"windows", nil, true, "", "windows"},
+		{"linux", nil, true, "no display", "linux without display"},
+		{"linux", map[string]string{"DISPLAY": ":0"}, false, "not running in a terminal", "no terminal"},
+		{"darwin", map[string]string{"CI": "true"}, true, "running in CI", "ci"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			getenv := func(k string) string { return tt.env[k] }
+			if got := headless(tt.goos, getenv, tt.terminal); got != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestOpenViewer(t *testing.T) {
+	origStart, origUnavailable := startCommand, browserUnavailable
+	t.Cleanup(func() { startCommand, browserUnavailable = origStart, origUnavailable })
+
+	var gotName string
+	var gotArgs []string
+	startCommand = func(name string, args ...string) error {
+		gotName, gotArgs = name, args
+		return nil
+	}
+	unavailable := ""
+	browserUnavailable = func() string { return unavailable }
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+	openViewer(logger, &net.TCPAddr{IP: net.IPv4zero, Port: 8080}, false, server.Config{BasePath: "/maps"})
+
+	wantName, wantArgs := browserCommand(runtime.GOOS, "http://localhost:8080/maps/")
+	if gotName != wantName || !slices.Equal(gotArgs, wantArgs) {
+		t.Errorf("Expected %s %v, got %s %v", wantName, wantArgs, gotName, gotArgs)
+	}
+
+	gotName = ""
+	unavailable = "no display"
+	openViewer(logger, &net.TCPAddr{IP: net.IPv4zero, Port: 8080}, false, server.Config{})
+	if gotName != "" {
+		t.Errorf("Expected no browser without a display, started %s", gotName)
+	}
+	if !strings.Contains(buf.String(), "reason=\"no display\"") {
+		t.Errorf("Expected the reason logged, got %q", buf.String())
+	}
+
+	buf.Reset()
+	unavailable = ""
+	openViewer(logger, &net.TCPAddr{IP: net.IPv4zero, Port: 8080}, false, server.Config{DisableViewer: true})
+	if gotName != "" {
+		t.Errorf("Expected no browser with the viewer disabled, started %s", gotName)
+	}
+	if !strings.Contains(buf.String(), "level=WARN") || !strings.Contains(buf.String(), "viewer is disabled") {
+		t.Errorf("Expected a warning that the viewer is disabled, got %q", buf.String())
+	}
+}
@@ -0,0 +1,347 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"io"
+	"strings"
+
+	"org.xyzmaps.xyztiles/src/imagery"
+	"org.xyzmaps.xyztiles/src/server"
+	"org.xyzmaps.xyztiles/src/tilemath"
+)
+
+// effectiveConfig is the JSON view of the resolved configuration printed by
+// --print-config. Writers and embedded data are shown by their source
+// rather than their contents.
+type effectiveConfig struct {
+	Port            int      `json:"port"`
+	Host            string   `json:"host"`
+	Listen          []string `json:"listen"`
+	SocketMode      string   `json:"socket_mode"`
+	TLSCert         string   `json:"tls_cert"`
+	TLSKey          string   `json:"tls_key"`
+	Image           string   `json:"image"`
+	MBTiles         string   `json:"mbtiles"`
+	Layers          []string `json:"layers"`
+	DefaultLayer    string   `json:"default_layer"`
+	MaxImagePixels  int64    `json:"max_image_pixels"`
+	FlipVertical    bool     `json:"flip_vertical"`
+	FlipHorizontal  bool     `json:"flip_horizontal"`
+	SourceBounds    string   `json:"source_bounds"`
+	BasePath        string   `json:"base_path"`
+	DisableViewer   bool     `json:"disable_viewer"`
+	LeafletCDN      bool     `json:"cdn"`
+	StaticDir       string   `json:"static_dir"`
+	SPA             bool     `json:"spa"`
+	AccessLog       string   `json:"access_log"`
+	AccessLogFormat string   `json:"access_log_format"`
+	TrustProxy      bool     `json:"trust_proxy"`
+	RateLimit       float64  `json:"rate_limit"`
+	RateBurst       int      `json:"rate_burst"`
+
+	SlowRequestThreshold string `json:"slow_request_threshold"`
+
+	ViewerCenter string `json:"center"`
+	ViewerZoom   int    `json:"zoom"`
+	Attribution  string `json:"attribution"`
+	ViewerRetina bool   `json:"retina"`
+
+	ViewerScale     bool `json:"scale"`
+	ViewerGraticule bool `json:"graticule"`
+
+	GeoJSON        []string `json:"geojson"`
+	GeoJSONMaxSize int64    `json:"geojson_max_bytes"`
+
+	JPEGQuality     int    `json:"jpeg_quality"`
+	JPEGFullChroma  bool   `json:"jpeg_full_chroma"`
+	JPEGProgressive bool   `json:"jpeg_progressive"`
+	JPEGAdaptive    string `json:"jpeg_adaptive_quality"`
+
+	MaxConcurrentRenders int    `json:"max_concurrent_renders"`
+	RenderQueueTimeout   string `json:"render_queue_timeout"`
+	RenderTimeout        string `json:"render_timeout"`
+	OverviewSize         string `json:"overview_size"`
+	MaxConnections       int    `json:"max_connections"`
+	TileBuffer           int    `json:"tile_buffer"`
+	BackgroundColor      string `json:"background_color"`
+	InterpByZoom         string `json:"interp_by_zoom"`
+	CollapseUniform      bool   `json:"collapse_uniform"`
+	UniformTolerance     int    `json:"uniform_tolerance"`
+	BBox                 string `json:"bbox"`
+	BlankOnNotFound      bool   `json:"blank_on_404"`
+	DebugHeaders         bool   `json:"debug_headers"`
+	DebugTiles           bool   `json:"debug_tiles"`
+	DebugVars            bool   `json:"debug_vars"`
+	CacheMaxBytes        int64  `json:"cache_max_bytes"`
+	WarmupZoom           int    `json:"warmup_zoom"`
+	WarmupBlock          bool   `json:"warmup_block"`
+	Open                 bool   `json:"open"`
+	MinZoom              int    `json:"min_zoom"`
+	MaxZoom              int    `json:"max_zoom"`
+	OverzoomLimit        int    `json:"overzoom_limit"`
+	DisableOverzoom      bool   `json:"disable_overzoom"`
+
+	BasicAuth  []string `json:"basic_auth"`
+	SigningKey string   `json:"signing_key"`
+	Admin      bool     `json:"admin"`
+	AdminAddr  string   `json:"admin_addr"`
+
+	HideVersion bool `json:"hide_version"`
+
+	ExportDir string `json:"export_dir"`
+
+	ProxyURL         string `json:"proxy_url"`
+	ProxyTimeout     string `json:"proxy_timeout"`
+	ProxyTransparent bool   `json:"proxy_transparent"`
+
+	CacheS3Bucket   string `json:"cache_s3_bucket"`
+	CacheS3Endpoint string `json:"cache_s3_endpoint"`
+	CacheS3Prefix   string `json:"cache_s3_prefix"`
+	CacheS3Region   string `json:"cache_s3_region"`
+
+	CacheRedisAddr   string `json:"cache_redis_addr"`
+	CacheRedisDB     int    `json:"cache_redis_db"`
+	CacheRedisTLS    bool   `json:"cache_redis_tls"`
+	CacheRedisTTL    string `json:"cache_redis_ttl"`
+	CacheRedisPrefix string `json:"cache_redis_prefix"`
+
+	TilesetVersion string `json:"tileset_version"`
+	VersionedURLs  bool   `json:"versioned_urls"`
+	ImmutableTiles bool   `json:"immutable_tiles"`
+
+	LogLevel  string `json:"log_level"`
+	LogFormat string `json:"log_format"`
+}
+
+// printConfig writes cfg, together with the flags resolved outside of it,
+// to w as indented JSON
+func printConfig(w io.Writer, cfg server.Config) error {
+	image := imagePath
+	if image == "" && cfg.MBTilesPath == "" {
+		image = "embedded"
+	}
+
+	out := effectiveConfig{
+		Port:            cfg.Port,
+		Host:            cfg.Host,
+		Listen:          listenSpecs(cfg),
+		SocketMode:      fmt.Sprintf("%#o", cfg.SocketMode),
+		TLSCert:         redactSecret(cfg.TLSCertFile),
+		TLSKey:          redactSecret(cfg.TLSKeyFile),
+		Image:           image,
+		MBTiles:         cfg.MBTilesPath,
+		Layers:          formatLayers(cfg.Layers),
+		DefaultLayer:    cfg.DefaultLayer,
+		MaxImagePixels:  cfg.MaxImagePixels,
+		FlipVertical:    cfg.FlipVertical,
+		FlipHorizontal:  cfg.FlipHorizontal,
+		SourceBounds:    formatBounds(cfg.SourceBounds),
+		BasePath:        cfg.BasePath,
+		DisableViewer:   cfg.DisableViewer,
+		LeafletCDN:      cfg.LeafletCDN,
+		StaticDir:       cfg.StaticDir,
+		SPA:             cfg.SPA,
+		AccessLog:       accessLogPath,
+		AccessLogFormat: cfg.AccessLogFormat,
+		TrustProxy:      cfg.TrustProxy,
+		RateLimit:       cfg.RateLimit,
+		RateBurst:       cfg.RateBurst,
+
+		SlowRequestThreshold: cfg.SlowRequestThreshold.String(),
+
+		ViewerCenter: formatLonLat(cfg.ViewerCenter),
+		ViewerZoom:   cfg.ViewerZoom,
+		Attribution:  cfg.Attribution,
+		ViewerRetina: !cfg.ViewerNoRetina,
+
+		ViewerScale:     !cfg.ViewerNoScale,
+		ViewerGraticule: cfg.ViewerGraticule,
+
+		GeoJSON:        formatOverlays(cfg.Overlays),
+		GeoJSONMaxSize: cfg.MaxOverlayBytes,
+
+		JPEGQuality:     cfg.JPEGOptions.Quality,
+		JPEGFullChroma:  cfg.JPEGOptions.FullChroma,
+		JPEGProgressive: cfg.JPEGOptions.Progressive,
+		JPEGAdaptive:    formatAdaptiveQuality(cfg.AdaptiveQuality),
+
+		MaxConcurrentRenders: cfg.MaxConcurrentRenders,
+		RenderQueueTimeout:   cfg.RenderQueueTimeout.String(),
+		RenderTimeout:        cfg.RenderTimeout.String(),
+		OverviewSize:         formatImageSize(cfg.OverviewSize),
+		MaxConnections:       cfg.MaxConnections,
+		TileBuffer:           cfg.TileBuffer,
+		BackgroundColor:      cfg.BackgroundColor,
+		InterpByZoom:         cfg.InterpByZoom.String(),
+		CollapseUniform:      cfg.CollapseUniformTiles,
+		UniformTolerance:     cfg.UniformTolerance,
+		BBox:                 formatBounds(cfg.Bounds),
+		BlankOnNotFound:      cfg.BlankOnNotFound,
+		DebugHeaders:         cfg.DebugHeaders,
+		DebugTiles:           cfg.DebugTiles,
+		DebugVars:            cfg.DebugVars,
+		CacheMaxBytes:        cfg.CacheMaxBytes,
+		WarmupZoom:           warmupZoom,
+		WarmupBlock:          warmupBlock,
+		Open:                 openBrowser,
+		MinZoom:              cfg.MinZoom,
+		MaxZoom:              cfg.MaxZoom,
+		OverzoomLimit:        *cfg.OverzoomLimit,
+		DisableOverzoom:      cfg.DisableOverzoom,
+
+		BasicAuth:  redactCredentials(cfg.BasicAuth),
+		SigningKey: redactSecret(cfg.SigningKey),
+		Admin:      cfg.Admin,
+		AdminAddr:  cfg.AdminAddr,
+
+		HideVersion: cfg.HideVersion,
+
+		ExportDir: cfg.ExportDir,
+
+		ProxyURL:         redactURL(cfg.ProxyURLTemplate),
+		ProxyTimeout:     cfg.ProxyTimeout.String(),
+		ProxyTransparent: cfg.ProxyTransparent,
+
+		CacheS3Bucket:   cfg.CacheS3.Bucket,
+		CacheS3Endpoint: cfg.CacheS3.Endpoint,
+		CacheS3Prefix:   cfg.CacheS3.Prefix,
+		CacheS3Region:   cfg.CacheS3.Region,
+
+		CacheRedisAddr:   cfg.CacheRedis.Addr,
+		CacheRedisDB:     cfg.CacheRedis.DB,
+		CacheRedisTLS:    cfg.CacheRedis.TLS,
+		CacheRedisTTL:    cfg.CacheRedis.TTL.String(),
+		CacheRedisPrefix: cfg.CacheRedis.Prefix,
+
+		TilesetVersion: cfg.TilesetVersion,
+		VersionedURLs:  cfg.VersionedTileURLs,
+		ImmutableTiles: cfg.ImmutableTiles,
+
+		LogLevel:  logLevel,
+		LogFormat: logFormat,
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
+
+// redactedValue replaces secrets in printed configuration
+const redactedValue = "<redacted>"
+
+// redactCredentials keeps the user names of "user:secret" entries and hides
+// the secrets
+func redactCredentials(entries []string) []string {
+	out := make([]string, len(entries))
+	for i, entry := range entries {
+		user, _, _ := strings.Cut(entry, ":")
+		out[i] = user + ":" + redactedValue
+	}
+	return out
+}
+
+// listenSpecs lists cfg's listen addresses, empty when Host and Port are
+// used
+func listenSpecs(cfg server.Config) []string {
+	if cfg.Listen == "" && len(cfg.ExtraListen) == 0 {
+		return []string{}
+	}
+	return append([]string{cfg.Listen}, cfg.ExtraListen...)
+}
+
+// redactSecret hides a secret, keeping "" so an unset one shows as unset
+func redactSecret(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return redactedValue
+}
+
+// redactURL hides the userinfo and query values of a --proxy-url template,
+// where upstream servers take API keys, keeping the tile placeholders
+func redactURL(template string) string {
+	rest, fragment, hasFragment := strings.Cut(template, "#")
+	rest, query, hasQuery := strings.Cut(rest, "?")
+
+	if scheme, authority, ok := strings.Cut(rest, "://"); ok {
+		host, path, hasPath := strings.Cut(authority, "/")
+		if i := strings.LastIndex(host, "@"); i >= 0 {
+			host = redactedValue + host[i:]
+		}
+		rest = scheme + "://" + host
+		if hasPath {
+			rest += "/" + path
+		}
+	}
+
+	if hasQuery {
+		params := strings.Split(query, "&")
+		for i, param := range params {
+			key, value, ok := strings.Cut(param, "=")
+			if ok && value != "{z}" && value != "{x}" && value != "{y}" {
+				params[i] = key + "=" + redactedValue
+			}
+		}
+		rest += "?" + strings.Join(params, "&")
+	}
+	if hasFragment {
+		rest += "#" + fragment
+	}
+	return rest
+}
+
+// formatBounds renders b in the west,south,east,north form --bbox and
+// --source-bounds accept, or "" when it is not set
+func formatBounds(b *tilemath.Bounds) string {
+	if b == nil {
+		return ""
+	}
+	return fmt.Sprintf("%g,%g,%g,%g", b.West, b.South, b.East, b.North)
+}
+
+// formatImageSize renders p in the WIDTHxHEIGHT form --overview-size
+// accepts, or "" when it is not set
+func formatImageSize(p image.Point) string {
+	if p == (image.Point{}) {
+		return ""
+	}
+	return fmt.Sprintf("%dx%d", p.X, p.Y)
+}
+
+// formatLonLat renders p in the lon,lat form --center accepts, or "" when
+// no center is set
+func formatLonLat(p *tilemath.LonLat) string {
+	if p == nil {
+		return ""
+	}
+	return fmt.Sprintf("%g,%g", p.Lon, p.Lat)
+}
+
+// formatOverlays renders overlays in the name=path form --geojson accepts
+func formatOverlays(overlays []server.Overlay) []string {
+	out := make([]string, len(overlays))
+	for i, o := range overlays {
+		out[i] = o.Name + "=" + o.Path
+	}
+	return out
+}
+
+// formatLayers renders layers in the name=path form --layer accepts
+func formatLayers(layers []server.Layer) []string {
+	out := make([]string, len(layers))
+	for i, l := range layers {
+		out[i] = l.Name + "=" + l.ImagePath
+	}
+	return out
+}
+
+// formatAdaptiveQuality renders a quality range in the min-max form
+// --jpeg-adaptive-quality accepts, or "" if it is disabled
+func formatAdaptiveQuality(a imagery.AdaptiveQuality) string {
+	if !a.Enabled() {
+		return ""
+	}
+	return fmt.Sprintf("%d-%d", a.Min, a.Max)
+}
@@ -0,0 +1,245 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"path/filepath"
+	"strconv"
+
+	"github.com/spf13/cobra"
+	"org.xyzmaps.xyztiles/src/atomicfile"
+	"org.xyzmaps.xyztiles/src/imagery"
+	"org.xyzmaps.xyztiles/src/resources"
+	"org.xyzmaps.xyztiles/src/server"
+	"org.xyzmaps.xyztiles/src/tilemath"
+)
+
+// Tile schemes render can name files by
+const (
+	schemeXYZ = "xyz" // Rows counted from the north, as served
+	schemeTMS = "tms" // Rows counted from the south
+)
+
+// renderOptions configures runRender
+type renderOptions struct {
+	imagePath string // Source image; the embedded map if empty
+	outDir    string
+	minZoom   int
+	maxZoom   int
+	format    imagery.Format
+	scheme    string // schemeXYZ or schemeTMS
+
+	bbox *tilemath.Bounds // Optional: only render tiles intersecting this area
+}
+
+// renderWorld is the area render covers: the whole Web Mercator square
+var renderWorld = tilemath.Bounds{West: -180, South: -tilemath.MaxLatitude, East: 180, North: tilemath.MaxLatitude}
+
+var (
+	renderImagePath string
+	renderOutDir    string
+	renderMinZoom   int
+	renderMaxZoom   int
+	renderFormat    string
+	renderScheme    string
+	renderBBox      string
+)
+
+var renderCmd = &cobra.Command{
+	Use:   "render",
+	Short: "Render a zoom range of tiles to a directory",
+	Long: `Render every tile from --min-zoom to --max-zoom into --out as
+{z}/{x}/{y}.{ext}, alongside a tilejson.json describing them. With
+--scheme tms the row in each file name counts from the south, as TMS and
+MBTiles consumers expect. With --bbox only the tiles intersecting that
+area are rendered, and the TileJSON bounds describe it.`,
+	Args:          cobra.NoArgs,
+	SilenceUsage:  true,
+	SilenceErrors: true, // Execute reports the error
+	RunE: func(cmd *cobra.Command, args []string) error {
+		format, err := imagery.FormatFromExtension(renderFormat)
+		if err != nil {
+			return fmt.Errorf("invalid --format: %w", err)
+		}
+		opts := renderOptions{
+			imagePath: renderImagePath,
+			outDir:    renderOutDir,
+			minZoom:   renderMinZoom,
+			maxZoom:   renderMaxZoom,
+			format:    format,
+			scheme:    renderScheme,
+		}
+		if renderBBox != "" {
+			b, err := tilemath.ParseBounds(renderBBox)
+			if err != nil {
+				return fmt.Errorf("invalid --bbox: %w", err)
+			}
+			opts.bbox = &b
+		}
+		return runRender(cmd.OutOrStdout(), opts)
+	},
+}
+
+func init() {
+	renderCmd.Flags().StringVarP(&renderImagePath, "image", "i", "", "Path to the image to render (defaults to the embedded map)")
+	renderCmd.Flags().StringVarP(&renderOutDir, "out", "o", "", "Directory to write tiles into (required)")
+	renderCmd.Flags().IntVar(&renderMinZoom, "min-zoom", 0, "Lowest zoom level to render")
+	renderCmd.Flags().IntVar(&renderMaxZoom, "max-zoom", 2, "Highest zoom level to render")
+	renderCmd.Flags().StringVar(&renderFormat, "format", "png", "Tile format: png, jpeg or webp")
+	renderCmd.Flags().StringVar(&renderScheme, "scheme", schemeXYZ, "Row numbering of file names: xyz (from the north) or tms (from the south)")
+	renderCmd.Flags().StringVar(&renderBBox, "bbox", "", "Only render tiles intersecting this box, as west,south,east,north in degrees (west > east crosses the antimeridian)")
+	_ = renderCmd.MarkFlagRequired("out")
+	rootCmd.AddCommand(renderCmd)
+}
+
+// renderTileJSON is the TileJSON document written next to rendered tiles
+type renderTileJSON struct {
+	TileJSON string     `json:"tilejson"`
+	Name     string     `json:"name"`
+	Scheme   string     `json:"scheme"`
+	Tiles    []string   `json:"tiles"`
+	MinZoom  int        `json:"minzoom"`
+	MaxZoom  int        `json:"maxzoom"`
+	Bounds   [4]float64 `json:"bounds"`
+	TileSize int        `json:"tileSize"`
+}
+
+// runRender writes the tiles and TileJSON described by opts, reporting
+// progress to w
+func runRender(w io.Writer, opts renderOptions) error {
+	if opts.scheme != schemeXYZ && opts.scheme != schemeTMS {
+		return fmt.Errorf("invalid --scheme %q (expected %s or %s)", opts.scheme, schemeXYZ, schemeTMS)
+	}
+	if opts.minZoom < 0 || opts.maxZoom > tilemath.MaxZoom || opts.minZoom > opts.maxZoom {
+		return fmt.Errorf("invalid zoom range %d-%d (expected 0 <= --min-zoom <= --max-zoom <= %d)", opts.minZoom, opts.maxZoom, tilemath.MaxZoom)
+	}
+	area := renderWorld
+	if opts.bbox != nil {
+		clipped, ok := opts.bbox.Clip(renderWorld)
+		if !ok {
+			return fmt.Errorf("invalid --bbox %s: outside the Web Mercator world", opts.bbox)
+		}
+		area = clipped
+	}
+
+	var basemap *imagery.BaseMap
+	var err error
+	if opts.imagePath == "" {
+		if !resources.HasEmbeddedMap() {
+			return errors.New("no embedded map available and --image not provided")
+		}
+		basemap, err = imagery.LoadImageFromBytes(resources.DefaultWorldMap, imagery.LoadOptions{})
+	} else {
+		basemap, err = imagery.LoadImage(opts.imagePath, imagery.LoadOptions{})
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load image: %w", err)
+	}
+
+	total := tilemath.TileCount(opts.minZoom, opts.maxZoom)
+	if opts.bbox != nil {
+		total = 0
+		for z := opts.minZoom; z <= opts.maxZoom; z++ {
+			forEachTileIn(area, z, func(x, y int) error {
+				total++
+				return nil
+			})
+		}
+	}
+	fmt.Fprintf(w, "Rendering %d tiles (zoom %d-%d) to %s\n", total, opts.minZoom, opts.maxZoom, opts.outDir)
+
+	count := 0
+	for z := opts.minZoom; z <= opts.maxZoom; z++ {
+		err := forEachTileIn(area, z, func(x, y int) error {
+			tile, err := basemap.ExtractTile(z, x, y)
+			if err != nil {
+				return fmt.Errorf("failed to render tile %d/%d/%d: %w", z, x, y, err)
+			}
+			row := y
+			if opts.scheme == schemeTMS {
+				row = tilemath.FlipY(z, y)
+			}
+			path := filepath.Join(opts.outDir, strconv.Itoa(z), strconv.Itoa(x), strconv.Itoa(row)+opts.format.Extension())
+			if err := writeTileFile(path, tile, opts.format); err != nil {
+				return err
+			}
+			count++
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	doc := renderTileJSON{
+		TileJSON: server.TileJSONVersion,
+		Name:     "xyztiles",
+		Scheme:   opts.scheme,
+		Tiles:    []string{"{z}/{x}/{y}" + opts.format.Extension()},
+		MinZoom:  opts.minZoom,
+		MaxZoom:  opts.maxZoom,
+		Bounds:   [4]float64{area.West, area.South, area.East, area.North},
+		TileSize: imagery.TileSize,
+	}
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := atomicfile.WriteFile(filepath.Join(opts.outDir, "tilejson.json"), append(data, '\n')); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "Rendered %d tiles (zoom %d-%d, %s scheme) to %s\n", count, opts.minZoom, opts.maxZoom, opts.scheme, opts.outDir)
+	return nil
+}
+
+// forEachTileIn calls fn with the XYZ column and row of every tile at zoom z
+// intersecting area, which must lie within renderWorld, column by column. It
+// stops at the first error fn returns.
+func forEachTileIn(area tilemath.Bounds, z int, fn func(x, y int) error) error {
+	// The corners narrow the search to the tiles they fall in; tiles that
+	// only touch the area along an edge are then skipped
+	nw, err := tilemath.LonLatToTile(area.West, area.North, z)
+	if err != nil {
+		return err
+	}
+	se, err := tilemath.LonLatToTile(area.East, area.South, z)
+	if err != nil {
+		return err
+	}
+	columns := [][2]int{{nw.X, se.X}}
+	if area.CrossesAntimeridian() {
+		columns = [][2]int{{nw.X, 1<<uint(z) - 1}, {0, se.X}}
+		if nw.X <= se.X {
+			// Both ends fall in the same columns, so every column is searched once
+			columns = [][2]int{{0, 1<<uint(z) - 1}}
+		}
+	}
+	for _, span := range columns {
+		for x := span[0]; x <= span[1]; x++ {
+			for y := nw.Y; y <= se.Y; y++ {
+				if tb, err := tilemath.TileBounds(z, x, y); err != nil || !tb.Intersects(area) {
+					continue
+				}
+				if err := fn(x, y); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// writeTileFile encodes tile in format to path, renaming it into place so
+// an interrupted render never leaves a truncated tile behind
+func writeTileFile(path string, tile image.Image, format imagery.Format) error {
+	var buf bytes.Buffer
+	if err := imagery.Encode(&buf, tile, format); err != nil {
+		return fmt.Errorf("failed to encode %s: %w", path, err)
+	}
+	return atomicfile.WriteFile(path, buf.Bytes())
+}
@@ -0,0 +1,268 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"org.xyzmaps.xyztiles/src/atomicfile"
+	"org.xyzmaps.xyztiles/src/imagery"
+	"org.xyzmaps.xyztiles/src/tilemath"
+)
+
+// writeHalvesPNG writes a 1024x512 PNG, white in the north and black in the
+// south, so tiles at zoom 1 differ by row
+func writeHalvesPNG(t *testing.T) string {
+	t.Helper()
+
+	img := image.NewRGBA(image.Rect(0, 0, 1024, 512))
+	for y := range 256 {
+		for x := range 1024 {
+			img.SetRGBA(x, y, color.RGBA{255, 255, 255, 255})
+		}
+	}
+	path := filepath.Join(t.TempDir(), "world.png")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	defer f.Close()
+	if err := png.Encode(f, img); err != nil {
+		t.Fatalf("Failed to encode PNG: %v", err)
+	}
+	return path
+}
+
+func TestRunRender_TMSFlipsY(t *testing.T) {
+	src := writeHalvesPNG(t)
+	render := func(scheme string) string {
+		t.Helper()
+		dir := t.TempDir()
+		var buf bytes.Buffer
+		opts := renderOptions{imagePath: src, outDir: dir, maxZoom: 1, format: imagery.FormatPNG, scheme: scheme}
+		if err := runRender(&buf, opts); err != nil {
+			t.Fatalf("runRender(%s) failed: %v", scheme, err)
+		}
+		if !strings.HasPrefix(buf.String(), "Rendering 5 tiles (zoom 0-1)") {
+			t.Errorf("Expected the tile count announced, got %q", buf.String())
+		}
+		return dir
+	}
+	read := func(path string) []byte {
+		t.Helper()
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("Expected %s to be written: %v", path, err)
+		}
+		return data
+	}
+	xyz, tms := render(schemeXYZ), render(schemeTMS)
+
+	north := read(filepath.Join(xyz, "1", "0", "0.png"))
+	south := read(filepath.Join(xyz, "1", "0", "1.png"))
+	if bytes.Equal(north, south) {
+		t.Fatal("Expected the north and south tiles to differ")
+	}
+	if !bytes.Equal(read(filepath.Join(tms, "1", "0", "1.png")), north) {
+		t.Error("Expected the TMS render to write XYZ tile 1/0/0 at row 1")
+	}
+	if !bytes.Equal(read(filepath.Join(tms, "1", "0", "0.png")), south) {
+		t.Error("Expected the TMS render to write XYZ tile 1/0/1 at row 0")
+	}
+	if !bytes.Equal(read(filepath.Join(tms, "0", "0", "0.png")), read(filepath.Join(xyz, "0", "0", "0.png"))) {
+		t.Error("Expected the world tile in the same place in both schemes")
+	}
+
+	for dir, scheme := range map[string]string{xyz: schemeXYZ, tms: schemeTMS} {
+		var doc renderTileJSON
+		if err := json.Unmarshal(read(filepath.Join(dir, "tilejson.json")), &doc); err != nil {
+			t.Fatalf("Failed to parse tilejson.json: %v", err)
+		}
+		if doc.Scheme != scheme || doc.MaxZoom != 1 {
+			t.Errorf("Expected TileJSON with scheme %s and maxzoom 1, got %+v", scheme, doc)
+		}
+	}
+}
+
+func TestRunRender_BBox(t *testing.T) {
+	src := writeHalvesPNG(t)
+	tests := []struct {
+		bbox   tilemath.Bounds
+		tiles  []string // Files written, as z/x/y.png
+		bounds [4]float64
+		name   string
+	}{
+		{
+			tilemath.Bounds{West: 0, South: 0, East: 90, North: 60},
+			[]string{"0/0/0.png", "1/1/0.png", "2/2/1.png"},
+			[4]float64{0, 0, 90, 60},
+			"inside one tile per zoom",
+		},
+		{
+			tilemath.Bounds{West: -90, South: 0, East: 0, North: 90},
+			[]string{"0/0/0.png", "1/0/0.png", "2/1/0.png", "2/1/1.png"},
+			[4]float64{-90, 0, 0, tilemath.MaxLatitude},
+			"edges on tile boundaries",
+		},
+		{
+			tilemath.Bounds{West: 170, South: -10, East: -170, North: 10},
+			[]string{
+				"0/0/0.png",
+				"1/0/0.png", "1/0/1.png", "1/1/0.png", "1/1/1.png",
+				"2/0/1.png", "2/0/2.png", "2/3/1.png", "2/3/2.png",
+			},
+			[4]float64{170, -10, -170, 10},
+			"crossing the antimeridian",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			var buf bytes.Buffer
+			opts := renderOptions{imagePath: src, outDir: dir, maxZoom: 2, format: imagery.FormatPNG, scheme: schemeXYZ, bbox: &tt.bbox}
+			if err := runRender(&buf, opts); err != nil {
+				t.Fatalf("runRender() failed: %v", err)
+			}
+			if want := fmt.Sprintf("Rendering %d tiles (zoom 0-2)", len(tt.tiles)); !strings.HasPrefix(buf.String(), want) {
+				t.Errorf("Expected %q announced, got %q", want, buf.String())
+			}
+
+			var written []string
+			err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+				if err == nil && filepath.Ext(path) == ".png" {
+					rel, _ := filepath.Rel(dir, path)
+					written = append(written, filepath.ToSlash(rel))
+				}
+				return err
+			})
+			if err != nil {
+				t.Fatalf("Failed to list %s: %v", dir, err)
+			}
+			slices.Sort(written)
+			if !slices.Equal(written, tt.tiles) {
+				t.Errorf("Expected tiles %v, got %v", tt.tiles, written)
+			}
+
+			data, err := os.ReadFile(filepath.Join(dir, "tilejson.json"))
+			if err != nil {
+				t.Fatalf("Expected tilejson.json to be written: %v", err)
+			}
+			var doc renderTileJSON
+			if err := json.Unmarshal(data, &doc); err != nil {
+				t.Fatalf("Failed to parse tilejson.json: %v", err)
+			}
+			if doc.Bounds != tt.bounds {
+				t.Errorf("Expected TileJSON bounds %v, got %v", tt.bounds, doc.Bounds)
+			}
+		})
+	}
+}
+
+func TestRunRender_ConcurrentSameTiles(t *testing.T) {
+	src := writeHalvesPNG(t)
+	opts := renderOptions{imagePath: src, maxZoom: 1, format: imagery.FormatPNG, scheme: schemeXYZ}
+
+	want := t.TempDir()
+	opts.outDir = want
+	if err := runRender(io.Discard, opts); err != nil {
+		t.Fatalf("runRender() failed: %v", err)
+	}
+
+	expectedWorld, err := os.ReadFile(filepath.Join(want, "0", "0", "0.png"))
+	if err != nil {
+		t.Fatalf("Expected the world tile to be written: %v", err)
+	}
+
+	// Renders writing the same tiles at once leave whole files, and a reader
+	// meanwhile sees the world tile either missing or complete
+	dir := t.TempDir()
+	opts.outDir = dir
+	done := make(chan struct{})
+	var reads sync.WaitGroup
+	reads.Add(1)
+	go func() {
+		defer reads.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			if data, err := os.ReadFile(filepath.Join(dir, "0", "0", "0.png")); err == nil && !bytes.Equal(data, expectedWorld) {
+				t.Errorf("Expected the world tile complete, read %d of %d bytes", len(data), len(expectedWorld))
+				return
+			}
+		}
+	}()
+	var wg sync.WaitGroup
+	for i := range 16 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			opts := opts
+			if i > 0 {
+				opts.maxZoom = 0 // Rewrite the world tile more often than the rest
+			}
+			if err := runRender(io.Discard, opts); err != nil {
+				t.Errorf("runRender() failed: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	close(done)
+	reads.Wait()
+
+	for _, tile := range []string{"0/0/0.png", "1/0/0.png", "1/0/1.png", "1/1/0.png", "1/1/1.png", "tilejson.json"} {
+		expected, err := os.ReadFile(filepath.Join(want, tile))
+		if err != nil {
+			t.Fatalf("Expected %s to be written: %v", tile, err)
+		}
+		got, err := os.ReadFile(filepath.Join(dir, tile))
+		if err != nil {
+			t.Fatalf("Expected %s to be written: %v", tile, err)
+		}
+		if !bytes.Equal(got, expected) {
+			t.Errorf("Expected %s to match a render on its own", tile)
+		}
+	}
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && strings.HasPrefix(d.Name(), atomicfile.TempPrefix) {
+			t.Errorf("Expected no temporary files, found %s", path)
+		}
+		return nil
+	})
+}
+
+func TestRunRender_InvalidOptions(t *testing.T) {
+	tests := []struct {
+		opts renderOptions
+		name string
+	}{
+		{renderOptions{maxZoom: 1, scheme: "wmts"}, "unknown scheme"},
+		{renderOptions{minZoom: 2, maxZoom: 1, scheme: schemeXYZ}, "empty zoom range"},
+		{renderOptions{minZoom: -1, scheme: schemeXYZ}, "negative zoom"},
+		{renderOptions{maxZoom: 1, scheme: schemeXYZ, bbox: &tilemath.Bounds{West: 0, South: 86, East: 10, North: 89}}, "bbox beyond Web Mercator"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.outDir = t.TempDir()
+			var buf bytes.Buffer
+			if err := runRender(&buf, tt.opts); err == nil {
+				t.Errorf("Expected error for %+v", tt.opts)
+			}
+		})
+	}
+}
@@ -1,22 +1,131 @@
 package cmd
 
 import (
+	"cmp"
 	"fmt"
-	"log"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"org.xyzmaps.xyztiles/src/imagery"
 	"org.xyzmaps.xyztiles/src/resources"
 	"org.xyzmaps.xyztiles/src/server"
+	"org.xyzmaps.xyztiles/src/tilemath"
+	"org.xyzmaps.xyztiles/src/tileprovider"
 	"org.xyzmaps.xyztiles/src/version"
 )
 
 var (
-	versionFlag bool
-	port        int
-	imagePath   string
+	versionFlag     bool
+	printConfigFlag bool
+	port            int
+	host            string
+	listenAddrs     []string
+	tlsCert         string
+	tlsKey          string
+	socketMode      string
+	imagePath       string
+	mbtilesPath     string
+	layerFlags      []string
+	defaultLayer    string
+	basePath        string
+	maxPixels       int64
+	flipVertical    bool
+	flipHorizontal  bool
+	sourceBounds    string
+	disableViewer   bool
+	leafletCDN      bool
+	staticDir       string
+	spa             bool
+
+	viewerCenter string
+	viewerZoom   int
+	attribution  string
+	viewerRetina bool
+
+	viewerScale     bool
+	viewerGraticule bool
+
+	geoJSONFlags   []string
+	geoJSONMaxSize int64
+
+	jpegQuality     int
+	jpegFullChroma  bool
+	jpegProgressive bool
+	jpegAdaptive    string
+
+	accessLogPath   string
+	accessLogFormat string
+	trustProxy      bool
+
+	slowRequestThreshold time.Duration
+
+	rateLimit float64
+	rateBurst int
+
+	renderConcurrency  int
+	renderQueueTimeout time.Duration
+	renderTimeout      time.Duration
+	overviewSize       string
+	maxConnections     int
+	tileBuffer         int
+	backgroundColor    string
+	interpByZoom       string
+	collapseUniform    bool
+	uniformTolerance   int
+	bbox               string
+	blankOnNotFound    bool
+	debugHeaders       bool
+	debugTiles         bool
+	debugVars          bool
+	cacheSizeMB        int64
+	warmupZoom         int
+	warmupBlock        bool
+	openBrowser        bool
+	minZoom            int
+	maxZoom            int
+	overzoomLimit      int
+	disableOverzoom    bool
+
+	basicAuth  []string
+	signingKey string
+
+	admin     bool
+	adminAddr string
+
+	hideVersion bool
+
+	exportDir string
+
+	proxyURL         string
+	proxyTimeout     time.Duration
+	proxyTransparent bool
+
+	cacheS3Bucket   string
+	cacheS3Endpoint string
+	cacheS3Prefix   string
+
+	cacheRedisAddr   string
+	cacheRedisDB     int
+	cacheRedisTLS    bool
+	cacheRedisTTL    time.Duration
+	cacheRedisPrefix string
+
+	tilesetVersion string
+	versionedURLs  bool
+	immutableTiles bool
+
+	logLevel  string
+	logFormat string
 )
 
+// shutdownTimeout bounds how long in-flight requests may take to drain
+const shutdownTimeout = 10 * time.Second
+
 var rootCmd = &cobra.Command{
 	Use:   "xyztiles",
 	Short: "xyztiles - Embedded World Map Tile Server",
@@ -29,43 +138,309 @@ Zero external dependencies, no hosted services required - perfect for learning w
 			os.Exit(0)
 		}
 
-		// Create server configuration
-		cfg := server.Config{
-			Port: port,
+		// Without a subcommand, serve (kept for backward compatibility)
+		runServe(cmd, args)
+	},
+}
+
+func init() {
+	rootCmd.Flags().BoolVarP(&versionFlag, "version", "v", false, "Print version information")
+	addServeFlags(rootCmd.Flags())
+}
+
+// addServeFlags defines the server flags on flags. The root command and
+// serve share them, bound to the same variables.
+func addServeFlags(flags *pflag.FlagSet) {
+	flags.BoolVar(&printConfigFlag, "print-config", false, "Print the effective configuration as JSON and exit")
+	flags.IntVarP(&port, "port", "p", 8080, "Port to run the server on (0 picks any free port)")
+	flags.StringVar(&host, "host", "", "Interface to bind: hostname, IPv4, or [IPv6] literal (default all interfaces)")
+	flags.StringArrayVar(&listenAddrs, "listen", nil, "Listen address: unix:/path/to/socket, tcp://host:port or tls://host:port (overrides --port); repeat to serve several at once")
+	flags.StringVar(&tlsCert, "tls-cert", "", "PEM certificate chain served by tls:// listen addresses")
+	flags.StringVar(&tlsKey, "tls-key", "", "PEM private key for --tls-cert")
+	flags.StringVar(&socketMode, "socket-mode", "0660", "Permissions for the unix domain socket (octal)")
+	flags.BoolVar(&flipVertical, "flip-vertical", false, "Mirror the source image top-to-bottom (for images stored with north at the bottom)")
+	flags.BoolVar(&flipHorizontal, "flip-horizontal", false, "Mirror the source image left-to-right")
+	flags.StringVar(&sourceBounds, "source-bounds", "", "Extent the source image covers from its outer pixel edges, as west,south,east,north in degrees (default -180,-90,180,90)")
+	flags.Int64Var(&maxPixels, "max-image-pixels", 0, "Refuse source images larger than this many pixels (width*height), 0 for no limit")
+	flags.StringVar(&basePath, "base-path", "", "URL prefix to serve all routes under when behind a reverse proxy (e.g. /maps)")
+	flags.BoolVar(&disableViewer, "disable-viewer", false, "Do not serve the HTML map viewer; \"/\" returns 404")
+	flags.BoolVar(&hideVersion, "hide-version", false, "Do not reveal the build's version at /version; it returns 404")
+	flags.StringVar(&exportDir, "export-dir", "", "Also write every freshly rendered tile to this directory as {z}/{x}/{y}.{ext}, with a manifest.json, for static hosting")
+	flags.StringVar(&viewerCenter, "center", "", "Position the viewer opens at, as lon,lat in degrees (default: the --bbox area or the whole world)")
+	flags.IntVar(&viewerZoom, "zoom", 0, "Zoom level the viewer opens at (default 2)")
+	flags.StringVar(&attribution, "attribution", "", "Credit for the --image imagery in the viewer and TileJSON; <a href> links allowed (default: the NASA Blue Marble credit for the embedded map)")
+	flags.BoolVar(&viewerRetina, "retina", true, "Show tiles in the viewer at half size for high-DPI screens; --retina=false loads a quarter of the tiles")
+	flags.BoolVar(&viewerScale, "scale", true, "Show a metric and imperial scale bar in the viewer; --scale=false hides it")
+	flags.BoolVar(&viewerGraticule, "graticule", false, "Offer a latitude/longitude grid in the viewer's layer control, spaced to suit the zoom")
+	flags.BoolVar(&leafletCDN, "cdn", false, "Load Leaflet in the viewer from the unpkg CDN instead of the embedded copy")
+	flags.StringVar(&staticDir, "static-dir", "", "Serve this directory at \"/\" (e.g. your own map app); the built-in viewer moves to /viewer")
+	flags.BoolVar(&spa, "spa", false, "Serve index.html from --static-dir for unknown non-tile paths (single-page apps)")
+	flags.StringVar(&accessLogPath, "access-log", "stderr", "Access log destination: stderr, a file path, or off")
+	flags.StringVar(&accessLogFormat, "access-log-format", "combined", "Access log format: combined, common or json")
+	flags.DurationVar(&slowRequestThreshold, "slow-request-threshold", 0, "Log a warning, with a tile's cache, queue, render and encode times, for requests slower than this (e.g. 500ms; 0 disables)")
+	flags.BoolVar(&trustProxy, "trust-proxy", false, "Trust X-Forwarded-* headers for client IPs and TileJSON URLs (only behind a reverse proxy)")
+	flags.Float64Var(&rateLimit, "rate-limit", 0, "Tile requests per second allowed per client IP, 0 for no limit")
+	flags.IntVar(&rateBurst, "rate-burst", 0, "Burst size for --rate-limit (default: the rate rounded up)")
+	flags.IntVar(&renderConcurrency, "render-concurrency", 0, "Maximum tiles rendered at once (default GOMAXPROCS)")
+	flags.DurationVar(&renderQueueTimeout, "render-queue-timeout", server.DefaultRenderQueueTimeout, "How long a tile request waits for a render slot before returning 503")
+	flags.DurationVar(&renderTimeout, "render-timeout", server.DefaultRenderTimeout, "How long a tile may take to render and encode before the request gets 503")
+	flags.StringVar(&overviewSize, "overview-size", "", "Serve the whole world as one PNG of this WIDTHxHEIGHT at /overview.png, e.g. 1024x512 (default: not served)")
+	flags.IntVar(&maxConnections, "max-connections", 0, "Maximum connections held open at once; further clients wait until one closes (0 for no limit)")
+	flags.IntVar(&minZoom, "min-zoom", 0, "Lowest zoom level served")
+	flags.IntVar(&maxZoom, "max-zoom", 0, "Highest zoom level served (default: native max zoom plus --overzoom-limit)")
+	flags.IntVar(&overzoomLimit, "overzoom-limit", server.DefaultOverzoomLimit, "Zoom levels served beyond the image's native resolution when --max-zoom is not set")
+	flags.BoolVar(&disableOverzoom, "disable-overzoom", false, "Return 404 for zooms beyond the image's native resolution instead of serving upsampled tiles")
+	flags.IntVar(&warmupZoom, "warmup-zoom", -1, "Render zooms up to this level into the tile cache in the background at startup (-1 disables)")
+	flags.BoolVar(&warmupBlock, "warmup-block", false, "Wait for --warmup-zoom warming to finish before accepting connections")
+	flags.BoolVar(&openBrowser, "open", false, "Open the viewer in the default browser once listening (skipped in CI, without a terminal or without a display)")
+	flags.StringVar(&tilesetVersion, "tileset-version", "", "Version naming the imagery in tile ETags and /v/{version}/ URLs; change it to bust caches (default: a hash of each image file)")
+	flags.BoolVar(&versionedURLs, "versioned-urls", false, "Advertise /v/{version}/ tile URLs in the viewer and TileJSON, cached for a year")
+	flags.BoolVar(&immutableTiles, "immutable-tiles", false, "Cache unversioned tiles for a year too, marked immutable (use with --versioned-urls and --tileset-version)")
+	flags.Int64Var(&cacheSizeMB, "cache-size", 64, "In-memory tile cache size in MB, 0 to disable")
+	flags.StringVar(&cacheS3Bucket, "cache-s3-bucket", "", "Share rendered tiles with other replicas through this S3 bucket (credentials and region from AWS_* environment variables)")
+	flags.StringVar(&cacheS3Endpoint, "cache-s3-endpoint", "", "URL of an S3-compatible store for --cache-s3-bucket, e.g. http://localhost:9000 (default: AWS S3)")
+	flags.StringVar(&cacheS3Prefix, "cache-s3-prefix", "", "Key prefix for tiles in --cache-s3-bucket, e.g. tiles/")
+	flags.StringVar(&cacheRedisAddr, "cache-redis-addr", "", "Share rendered tiles with other replicas through the Redis server at this host:port (password from REDIS_PASSWORD)")
+	flags.IntVar(&cacheRedisDB, "cache-redis-db", 0, "Redis database for --cache-redis-addr")
+	flags.BoolVar(&cacheRedisTLS, "cache-redis-tls", false, "Connect to --cache-redis-addr over TLS")
+	flags.DurationVar(&cacheRedisTTL, "cache-redis-ttl", 24*time.Hour, "Expire tiles in --cache-redis-addr this long after they are stored, 0 to keep them")
+	flags.StringVar(&cacheRedisPrefix, "cache-redis-prefix", server.DefaultRedisPrefix, "Key prefix for tiles in --cache-redis-addr")
+	flags.StringVar(&bbox, "bbox", "", "Only serve tiles intersecting this box, as west,south,east,north in degrees (west > east crosses the antimeridian)")
+	flags.IntVar(&tileBuffer, "tile-buffer", 0, "Pixels of neighboring tiles to include on each side of every tile")
+	flags.StringVar(&backgroundColor, "background", "", "Color (#rrggbb or #rrggbbaa) filling tile areas the image leaves transparent (default transparent)")
+	flags.StringVar(&interpByZoom, "interp-by-zoom", "", "Interpolation kernel by zoom as RANGE=KERNEL rules, e.g. 0-3=catmullrom,+1-=approxbilinear (+ counts levels past native zoom)")
+	flags.BoolVar(&collapseUniform, "collapse-uniform", false, "Serve tiles of a single color (e.g. open ocean) as a solid fill instead of resampling them")
+	flags.IntVar(&uniformTolerance, "uniform-tolerance", imagery.DefaultUniformTolerance, "Per-channel color spread (1-255) up to which --collapse-uniform treats a tile as a single color")
+	flags.BoolVar(&blankOnNotFound, "blank-on-404", false, "Serve a transparent tile instead of 404 for tiles outside the grid")
+	flags.IntVar(&jpegQuality, "jpeg-quality", imagery.DefaultJPEGQuality, "Quality (1-100) of JPEG tiles")
+	flags.BoolVar(&jpegFullChroma, "jpeg-full-chroma", false, "Encode JPEG tiles without chroma subsampling (4:4:4) for crisper coastlines; needs a libjpeg build")
+	flags.BoolVar(&jpegProgressive, "jpeg-progressive", false, "Encode progressive JPEG tiles, usually smaller; needs a libjpeg build")
+	flags.StringVar(&jpegAdaptive, "jpeg-adaptive-quality", "", "Choose each JPEG tile's quality from its detail within min-max, e.g. 60-90, instead of --jpeg-quality")
+	flags.BoolVar(&debugHeaders, "debug-headers", false, "Add X-Tile-Bounds and X-Tile-Size headers to tile responses")
+	flags.BoolVar(&debugTiles, "debug-tiles", false, "Draw each tile's border and z/x/y on it, to tell tiles apart and spot seams")
+	flags.BoolVar(&debugVars, "debug-vars", false, "Serve Go runtime and tile serving statistics as JSON at /debug/vars and as an HTML page at /stats")
+	flags.StringArrayVar(&basicAuth, "basic-auth", nil, "Require HTTP Basic auth as user:password or user:<bcrypt hash> (repeatable)")
+	flags.StringVar(&signingKey, "signing-key", "", "Require tile, overview and /query URLs signed with this HMAC key (sig and exp query parameters); other endpoints are unaffected")
+	flags.BoolVar(&admin, "admin", false, "Enable the admin API (cache flush/stats, reload) under /admin/")
+	flags.StringVar(&adminAddr, "admin-addr", "127.0.0.1:8081", "Separate host:port the admin API listens on; empty serves it on the main listener (requires --basic-auth)")
+	flags.StringVar(&logLevel, "log-level", "info", "Log level: debug, info, warn, or error")
+	flags.StringVar(&logFormat, "log-format", "text", "Log format: text or json")
+	flags.StringVarP(&imagePath, "image", "i", "", "Path to custom equirectangular world map image (optional, uses embedded map if not specified)")
+	flags.StringVar(&mbtilesPath, "mbtiles", "", "Serve the default layer's tiles as stored in an MBTiles archive instead of rendering them from an image")
+	flags.StringArrayVar(&layerFlags, "layer", nil, "Additional layer served under /{name}/{z}/{x}/{y}, as name=path/to/image.jpg (repeatable)")
+	flags.StringArrayVar(&geoJSONFlags, "geojson", nil, "GeoJSON file shown as an overlay in the viewer and served at /overlays/{name}.json, as path.json or name=path.json (repeatable)")
+	flags.Int64Var(&geoJSONMaxSize, "geojson-max-size", server.DefaultMaxOverlayBytes>>20, "Largest --geojson file accepted, in MB")
+	flags.StringVar(&proxyURL, "proxy-url", "", "Serve tiles from an upstream XYZ server as the layer \"proxy\", e.g. https://tile.example.com/{z}/{x}/{y}.png")
+	flags.DurationVar(&proxyTimeout, "proxy-timeout", tileprovider.DefaultProxyTimeout, "How long to wait for an upstream --proxy-url tile")
+	flags.BoolVar(&proxyTransparent, "proxy-transparent", false, "Serve transparent tiles instead of 404s for tiles the --proxy-url server lacks or does not return in time")
+	flags.StringVar(&defaultLayer, "default-layer", "", "Layer served at bare /{z}/{x}/{y} paths (default: the --image layer, named \"default\")")
+}
+
+// buildConfig assembles the server configuration from the command-line flags.
+// The image source and access log destination are resolved separately since
+// they touch the filesystem.
+func buildConfig() (server.Config, error) {
+	cfg := server.Config{
+		Port:     port,
+		Host:     host,
+		BasePath: basePath,
+
+		TLSCertFile: tlsCert,
+		TLSKeyFile:  tlsKey,
+
+		DefaultLayer: defaultLayer,
+
+		DisableViewer: disableViewer,
+		LeafletCDN:    leafletCDN,
+		StaticDir:     staticDir,
+		SPA:           spa,
+
+		ViewerZoom:     viewerZoom,
+		Attribution:    attribution,
+		ViewerNoRetina: !viewerRetina,
+
+		ViewerNoScale:   !viewerScale,
+		ViewerGraticule: viewerGraticule,
+
+		JPEGOptions: imagery.JPEGOptions{
+			Quality:     jpegQuality,
+			FullChroma:  jpegFullChroma,
+			Progressive: jpegProgressive,
+		},
+
+		MaxImagePixels: maxPixels,
+		FlipVertical:   flipVertical,
+		FlipHorizontal: flipHorizontal,
+
+		AccessLogFormat: accessLogFormat,
+		TrustProxy:      trustProxy,
+
+		SlowRequestThreshold: slowRequestThreshold,
+
+		RateLimit: rateLimit,
+		RateBurst: rateBurst,
+
+		MaxConcurrentRenders: renderConcurrency,
+		RenderQueueTimeout:   renderQueueTimeout,
+		RenderTimeout:        renderTimeout,
+		MaxConnections:       maxConnections,
+
+		TileBuffer:           tileBuffer,
+		BackgroundColor:      backgroundColor,
+		CollapseUniformTiles: collapseUniform,
+		UniformTolerance:     uniformTolerance,
+		BlankOnNotFound:      blankOnNotFound,
+		DebugHeaders:         debugHeaders,
+		DebugTiles:           debugTiles,
+		DebugVars:            debugVars,
+		CacheMaxBytes:        cacheSizeMB << 20,
+		WarmOnStart:          warmupZoom >= 0,
+		WarmMaxZoom:          warmupZoom,
+
+		MinZoom:         minZoom,
+		MaxZoom:         maxZoom,
+		OverzoomLimit:   &overzoomLimit,
+		DisableOverzoom: disableOverzoom,
+
+		BasicAuth:  basicAuth,
+		SigningKey: signingKey,
+
+		Admin: admin,
+
+		HideVersion: hideVersion,
+
+		ExportDir: exportDir,
+
+		ProxyURLTemplate: proxyURL,
+		ProxyTimeout:     proxyTimeout,
+		ProxyTransparent: proxyTransparent,
+
+		TilesetVersion:    tilesetVersion,
+		VersionedTileURLs: versionedURLs,
+		ImmutableTiles:    immutableTiles,
+	}
+	if admin {
+		cfg.AdminAddr = adminAddr
+	}
+	if len(listenAddrs) > 0 {
+		cfg.Listen, cfg.ExtraListen = listenAddrs[0], listenAddrs[1:]
+	}
+	if cacheS3Bucket != "" {
+		cfg.CacheS3 = server.S3Config{
+			Bucket:          cacheS3Bucket,
+			Endpoint:        cacheS3Endpoint,
+			Prefix:          cacheS3Prefix,
+			Region:          cmp.Or(os.Getenv("AWS_REGION"), os.Getenv("AWS_DEFAULT_REGION")),
+			AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		}
+	} else if cacheS3Endpoint != "" || cacheS3Prefix != "" {
+		return cfg, fmt.Errorf("--cache-s3-endpoint and --cache-s3-prefix require --cache-s3-bucket")
+	}
+	if cacheRedisAddr != "" {
+		cfg.CacheRedis = server.RedisConfig{
+			Addr:     cacheRedisAddr,
+			Password: os.Getenv("REDIS_PASSWORD"),
+			DB:       cacheRedisDB,
+			TLS:      cacheRedisTLS,
+			Prefix:   cacheRedisPrefix,
+			TTL:      cacheRedisTTL,
+		}
+	}
+
+	if socketMode != "" {
+		mode, err := strconv.ParseUint(socketMode, 8, 32)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid --socket-mode %q (expected octal, e.g. 0660)", socketMode)
+		}
+		cfg.SocketMode = os.FileMode(mode)
+	}
+
+	if mbtilesPath != "" {
+		if imagePath != "" {
+			return cfg, fmt.Errorf("--image and --mbtiles cannot be used together")
+		}
+		cfg.MBTilesPath = mbtilesPath
+	}
+
+	for _, flag := range layerFlags {
+		name, path, ok := strings.Cut(flag, "=")
+		if !ok || name == "" || path == "" {
+			return cfg, fmt.Errorf("invalid --layer %q (expected name=path)", flag)
+		}
+		cfg.Layers = append(cfg.Layers, server.Layer{Name: name, ImagePath: path})
+	}
+
+	for _, flag := range geoJSONFlags {
+		name, path, ok := strings.Cut(flag, "=")
+		if !ok {
+			path = flag
+			name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		}
+		if name == "" || path == "" {
+			return cfg, fmt.Errorf("invalid --geojson %q (expected path.json or name=path.json)", flag)
+		}
+		cfg.Overlays = append(cfg.Overlays, server.Overlay{Name: name, Path: path})
+	}
+	cfg.MaxOverlayBytes = geoJSONMaxSize << 20
+
+	// The embedded map's imagery is credited unless told otherwise
+	if imagePath == "" && mbtilesPath == "" && cfg.Attribution == "" {
+		cfg.Attribution = resources.DefaultWorldMapAttribution
+	}
+
+	if viewerCenter != "" {
+		c, err := tilemath.ParseLonLat(viewerCenter)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid --center: %w", err)
 		}
+		cfg.ViewerCenter = &c
+	}
 
-		// Use embedded image or custom image path
-		if imagePath == "" {
-			// Use embedded image
-			if !resources.HasEmbeddedMap() {
-				log.Fatal("Error: No embedded map available and --image flag not provided.")
-			}
-			log.Printf("Using embedded world map (%d bytes)", resources.DefaultMapSize())
-			cfg.EmbeddedData = resources.DefaultWorldMap
-		} else {
-			// Use custom image from file
-			if _, err := os.Stat(imagePath); os.IsNotExist(err) {
-				log.Fatalf("Error: Image file not found at %s", imagePath)
-			}
-			cfg.ImagePath = imagePath
+	if jpegAdaptive != "" {
+		lo, hi, ok := strings.Cut(jpegAdaptive, "-")
+		minQuality, minErr := strconv.Atoi(lo)
+		maxQuality, maxErr := strconv.Atoi(hi)
+		if !ok || minErr != nil || maxErr != nil {
+			return cfg, fmt.Errorf("invalid --jpeg-adaptive-quality %q (expected min-max, e.g. 60-90)", jpegAdaptive)
 		}
+		cfg.AdaptiveQuality = imagery.AdaptiveQuality{Min: minQuality, Max: maxQuality}
+	}
 
-		// Create and start the server
-		srv, err := server.New(cfg)
+	if interpByZoom != "" {
+		table, err := imagery.ParseKernelTable(interpByZoom)
 		if err != nil {
-			log.Fatalf("Failed to create server: %v", err)
+			return cfg, fmt.Errorf("invalid --interp-by-zoom: %w", err)
 		}
+		cfg.InterpByZoom = table
+	}
 
-		if err := srv.Start(); err != nil {
-			log.Fatalf("Server error: %v", err)
+	if overviewSize != "" {
+		size, err := imagery.ParseImageSize(overviewSize)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid --overview-size: %w", err)
 		}
-	},
-}
+		cfg.OverviewSize = size
+	}
 
-func init() {
-	rootCmd.Flags().BoolVarP(&versionFlag, "version", "v", false, "Print version information")
-	rootCmd.Flags().IntVarP(&port, "port", "p", 8080, "Port to run the server on")
-	rootCmd.Flags().StringVarP(&imagePath, "image", "i", "", "Path to custom equirectangular world map image (optional, uses embedded map if not specified)")
+	if sourceBounds != "" {
+		b, err := imagery.ParseSourceBounds(sourceBounds)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid --source-bounds: %w", err)
+		}
+		cfg.SourceBounds = &b
+	}
+
+	if bbox != "" {
+		b, err := tilemath.ParseBounds(bbox)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid --bbox: %w", err)
+		}
+		cfg.Bounds = &b
+	}
+
+	return cfg, nil
 }
 
 // Execute runs the root command
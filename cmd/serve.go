@@ -0,0 +1,160 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/spf13/cobra"
+	"org.xyzmaps.xyztiles/src/resources"
+	"org.xyzmaps.xyztiles/src/server"
+)
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Start the tile server",
+	Long: `Serve XYZ tiles, TileJSON and the map viewer from an equirectangular
+world map image, the embedded one unless --image is given. Running
+xyztiles without a subcommand does the same.`,
+	Args: cobra.NoArgs,
+	Run:  runServe,
+}
+
+func init() {
+	addServeFlags(serveCmd.Flags())
+	rootCmd.AddCommand(serveCmd)
+}
+
+// runServe starts the server configured by the server flags and blocks
+// until it fails or is interrupted
+func runServe(cmd *cobra.Command, args []string) {
+	logger, err := newLogger(os.Stderr, logLevel, logFormat)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+	slog.SetDefault(logger)
+
+	// Create server configuration
+	cfg, err := buildConfig()
+	if err != nil {
+		fatal("Invalid configuration", "err", err)
+	}
+	cfg.Logger = logger
+
+	if server.SocketActivated() {
+		for _, name := range []string{"port", "host", "listen"} {
+			if cmd.Flags().Changed(name) {
+				logger.Warn("Ignoring --"+name+": listening on the socket passed by systemd", "flag", name)
+			}
+		}
+	}
+
+	if printConfigFlag {
+		if err := printConfig(cmd.OutOrStdout(), cfg); err != nil {
+			fatal("Failed to print configuration", "err", err)
+		}
+		return
+	}
+
+	switch accessLogPath {
+	case "off", "":
+		// Access logging disabled
+	case "stderr", "-":
+		cfg.AccessLogWriter = os.Stderr
+	default:
+		f, err := os.OpenFile(accessLogPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			fatal("Cannot open access log", "path", accessLogPath, "err", err)
+		}
+		defer f.Close()
+		cfg.AccessLogWriter = f
+	}
+
+	// Use an MBTiles archive, the embedded image or a custom image path
+	if mbtilesPath != "" {
+		if _, err := os.Stat(mbtilesPath); os.IsNotExist(err) {
+			fatal("MBTiles archive not found", "path", mbtilesPath)
+		}
+	} else if imagePath == "" {
+		// Use embedded image
+		if !resources.HasEmbeddedMap() {
+			fatal("No embedded map available and --image flag not provided")
+		}
+		logger.Info("Using embedded world map", "bytes", resources.DefaultMapSize())
+		cfg.EmbeddedData = resources.DefaultWorldMap
+	} else {
+		// Use custom image from file
+		if _, err := os.Stat(imagePath); os.IsNotExist(err) {
+			fatal("Image file not found", "path", imagePath)
+		}
+		cfg.ImagePath = imagePath
+	}
+
+	// Create and start the server
+	srv, err := server.New(cfg)
+	if err != nil {
+		fatal("Failed to create server", "err", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// SIGHUP reloads the base maps from disk without dropping connections
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	go func() {
+		for range hup {
+			logger.Info("Received SIGHUP, reloading base maps")
+			// Reload logs its own failures and keeps serving the old maps
+			_ = srv.Reload()
+		}
+	}()
+
+	if warmupBlock && cfg.WarmOnStart {
+		logger.Info("Waiting for cache warmup before accepting connections")
+		if err := srv.WaitForWarm(ctx); err != nil {
+			logger.Info("Shutting down")
+			srv.Shutdown(context.Background())
+			return
+		}
+	}
+
+	lns, err := srv.ListenAll()
+	if err != nil {
+		fatal("Server error", "err", err)
+	}
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- srv.StartListeners(lns)
+	}()
+	if openBrowser {
+		// The first TCP listener; a unix socket has no URL to open
+		ln := lns[0]
+		for _, l := range lns {
+			if l.Addr().Network() == "tcp" {
+				ln = l
+				break
+			}
+		}
+		openViewer(logger, ln.Addr(), server.ServesTLS(ln), cfg)
+	}
+
+	select {
+	case err := <-errCh:
+		if err != nil {
+			fatal("Server error", "err", err)
+		}
+	case <-ctx.Done():
+		logger.Info("Shutting down")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			fatal("Shutdown error", "err", err)
+		}
+	}
+}
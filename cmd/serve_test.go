@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/spf13/pflag"
+)
+
+func TestServe_Wiring(t *testing.T) {
+	tests := []struct {
+		args []string
+		name string
+	}{
+		{[]string{"serve", "--print-config", "--port", "9191", "--image", "world.png"}, "serve subcommand"},
+		{[]string{"--print-config", "--port", "9191", "--image", "world.png"}, "bare invocation"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			rootCmd.SetOut(&buf)
+			rootCmd.SetArgs(tt.args)
+			t.Cleanup(func() {
+				rootCmd.SetOut(nil)
+				rootCmd.SetArgs(nil)
+				printConfigFlag = false
+				port = 8080
+				imagePath = ""
+			})
+
+			if err := rootCmd.Execute(); err != nil {
+				t.Fatalf("Execute() failed: %v", err)
+			}
+
+			var got effectiveConfig
+			if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+				t.Fatalf("Expected JSON output, got %q: %v", buf.String(), err)
+			}
+			if got.Port != 9191 {
+				t.Errorf("Expected port 9191, got %d", got.Port)
+			}
+			if got.Image != "world.png" {
+				t.Errorf("Expected image world.png, got %s", got.Image)
+			}
+		})
+	}
+}
+
+func TestServe_SharesRootFlags(t *testing.T) {
+	serveCmd.Flags().VisitAll(func(f *pflag.Flag) {
+		if f.Name == "help" {
+			return // Added by cobra with a per-command usage
+		}
+		root := rootCmd.Flags().Lookup(f.Name)
+		if root == nil {
+			t.Errorf("Flag --%s is missing from the root command", f.Name)
+			return
+		}
+		if root.DefValue != f.DefValue || root.Usage != f.Usage || root.Shorthand != f.Shorthand {
+			t.Errorf("Flag --%s differs between serve and the root command", f.Name)
+		}
+	})
+	if serveCmd.Flags().Lookup("version") != nil {
+		t.Error("Expected --version to stay on the root command only")
+	}
+}
+
+func TestServe_RejectsArguments(t *testing.T) {
+	rootCmd.SetArgs([]string{"serve", "world.png"})
+	rootCmd.SetOut(&bytes.Buffer{})
+	rootCmd.SetErr(&bytes.Buffer{})
+	t.Cleanup(func() {
+		rootCmd.SetArgs(nil)
+		rootCmd.SetOut(nil)
+		rootCmd.SetErr(nil)
+	})
+
+	if err := rootCmd.Execute(); err == nil {
+		t.Error("Expected an error for a positional argument")
+	}
+}
@@ -0,0 +1,45 @@
+// Package atomicfile writes files so that readers, and other writers of the
+// same path, never see one partly written.
+package atomicfile
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// TempPrefix starts the names of the temporary files WriteFile writes
+// before renaming them into place
+const TempPrefix = ".tmp-"
+
+// WriteFile writes data to path through a temporary file in the same
+// directory renamed over path, creating the directory if needed. The file
+// is readable by everyone. Concurrent writes of one path leave the data of
+// one of them.
+func WriteFile(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, TempPrefix+"*")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Chmod(f.Name(), 0o644); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return nil
+}
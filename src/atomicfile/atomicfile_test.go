@@ -0,0 +1,104 @@
+package atomicfile
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// assertNoTempFiles fails if a temporary file was left below dir
+func assertNoTempFiles(t *testing.T, dir string) {
+	t.Helper()
+
+	filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err == nil && strings.HasPrefix(d.Name(), TempPrefix) {
+			t.Errorf("Expected no temporary files, found %s", path)
+		}
+		return nil
+	})
+}
+
+func TestWriteFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "2", "1", "1.png")
+
+	for _, data := range []string{"first", "second, longer"} {
+		if err := WriteFile(path, []byte(data)); err != nil {
+			t.Fatalf("WriteFile() failed: %v", err)
+		}
+		got, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", path, err)
+		}
+		if string(got) != data {
+			t.Errorf("Expected %q, got %q", data, got)
+		}
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Failed to stat %s: %v", path, err)
+	}
+	if mode := info.Mode().Perm(); mode != 0o644 {
+		t.Errorf("Expected mode 0644, got %v", mode)
+	}
+	assertNoTempFiles(t, dir)
+}
+
+func TestWriteFile_ConcurrentSamePath(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "0", "0", "0.png")
+
+	// Writers of different lengths, so a torn write cannot go unnoticed
+	contents := make([][]byte, 20)
+	for i := range contents {
+		contents[i] = bytes.Repeat([]byte{byte('a' + i)}, 1000*(i+1))
+	}
+	var wg sync.WaitGroup
+	for _, data := range contents {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := WriteFile(path, data); err != nil {
+				t.Errorf("WriteFile() failed: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", path, err)
+	}
+	if !slices.ContainsFunc(contents, func(data []byte) bool { return bytes.Equal(data, got) }) {
+		t.Errorf("Expected the data of one writer, got %d bytes starting %q", len(got), got[:min(len(got), 8)])
+	}
+	assertNoTempFiles(t, dir)
+}
+
+func TestWriteFile_Error(t *testing.T) {
+	dir := t.TempDir()
+	blocker := filepath.Join(dir, "blocker")
+	if err := os.WriteFile(blocker, nil, 0o644); err != nil {
+		t.Fatalf("Failed to write %s: %v", blocker, err)
+	}
+
+	// A directory cannot be created where a file is
+	if err := WriteFile(filepath.Join(blocker, "0.png"), []byte("tile")); err == nil {
+		t.Error("Expected an error writing below a file")
+	}
+	// Nor renamed over
+	if err := os.Mkdir(filepath.Join(dir, "taken.png"), 0o755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "taken.png", "child"), nil, 0o644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if err := WriteFile(filepath.Join(dir, "taken.png"), []byte("tile")); err == nil {
+		t.Error("Expected an error renaming over a non-empty directory")
+	}
+	assertNoTempFiles(t, dir)
+}
@@ -2,14 +2,19 @@ package imagery
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"image"
+	"image/color"
 	"image/draw"
 	"image/jpeg"
+	"io"
+	"math"
 	"os"
 
 	"org.xyzmaps.xyztiles/src/tilemath"
 	xdraw "golang.org/x/image/draw"
+	"golang.org/x/image/math/f64"
 )
 
 // BaseMap represents a loaded equirectangular world map image
@@ -20,11 +25,44 @@ type BaseMap struct {
 	bounds image.Rectangle
 	width  int
 	height int
+
+	orientation int // EXIF orientation corrected at load time; 0 or 1 if none
+
+	// extent is the area the image covers, edge to edge; the zero value
+	// means WorldBounds
+	extent tilemath.Bounds
 }
 
+// WorldBounds is the extent source images are assumed to cover unless
+// LoadOptions.SourceBounds says otherwise
+var WorldBounds = tilemath.Bounds{West: -180, South: -90, East: 180, North: 90}
+
+// Errors returned by ExtractTile, re-exported from tilemath so callers can
+// use errors.Is without importing tilemath
+var (
+	ErrInvalidZoom = tilemath.ErrInvalidZoom
+	ErrOutOfRange  = tilemath.ErrOutOfRange
+)
+
 // TileSize is the output size for generated tiles (512x512 as per spec)
 const TileSize = 512
 
+// MaxTileSize is the largest tile edge length TileOptions.Size accepts
+const MaxTileSize = 4 * TileSize
+
+// NewBaseMap wraps an already decoded image as a BaseMap.
+// The image is expected to be in equirectangular projection (EPSG:4326)
+// covering the full world extent (-180, -90, 180, 90).
+func NewBaseMap(img image.Image) *BaseMap {
+	bounds := img.Bounds()
+	return &BaseMap{
+		img:    img,
+		bounds: bounds,
+		width:  bounds.Dx(),
+		height: bounds.Dy(),
+	}
+}
+
 // LoadJPEG loads a JPEG image from the given file path.
 // The image is expected to be in equirectangular projection (EPSG:4326)
 // covering the full world extent (-180, -90, 180, 90).
@@ -40,13 +78,14 @@ func LoadJPEG(path string) (*BaseMap, error) {
 		return nil, fmt.Errorf("failed to decode JPEG: %w", err)
 	}
 
-	bounds := img.Bounds()
-	return &BaseMap{
-		img:    img,
-		bounds: bounds,
-		width:  bounds.Dx(),
-		height: bounds.Dy(),
-	}, nil
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to rewind image: %w", err)
+	}
+	img, orientation := applyEXIFOrientation(f, img)
+
+	bm := NewBaseMap(img)
+	bm.orientation = orientation
+	return bm, nil
 }
 
 // LoadJPEGFromBytes loads a JPEG image from a byte slice (e.g., embedded resource).
@@ -60,18 +99,72 @@ func LoadJPEGFromBytes(data []byte) (*BaseMap, error) {
 		return nil, fmt.Errorf("failed to decode JPEG from bytes: %w", err)
 	}
 
-	bounds := img.Bounds()
-	return &BaseMap{
-		img:    img,
-		bounds: bounds,
-		width:  bounds.Dx(),
-		height: bounds.Dy(),
-	}, nil
+	img, orientation := applyEXIFOrientation(bytes.NewReader(data), img)
+
+	bm := NewBaseMap(img)
+	bm.orientation = orientation
+	return bm, nil
 }
 
 // ExtractTile extracts and resamples a tile region from the base map.
-// Returns a 512x512 RGBA image containing the tile at the given XYZ coordinates.
+// Returns a TileSize square RGBA image containing the tile at the given XYZ
+// coordinates.
+// Invalid coordinates yield an error wrapping ErrInvalidZoom or ErrOutOfRange.
 func (bm *BaseMap) ExtractTile(z, x, y int) (*image.RGBA, error) {
+	return bm.ExtractTileCtx(context.Background(), z, x, y)
+}
+
+// ExtractTileCtx is like ExtractTile but gives up early, returning ctx.Err(),
+// once ctx is done. Cancellation is checked between strips of the
+// resampling, so a render stops soon after its deadline.
+func (bm *BaseMap) ExtractTileCtx(ctx context.Context, z, x, y int) (*image.RGBA, error) {
+	return bm.ExtractTileWithOptions(ctx, z, x, y, TileOptions{})
+}
+
+// TileOptions adjusts how ExtractTileWithOptions renders a tile
+type TileOptions struct {
+	// Size is the edge length in pixels the tile bounds are resampled to,
+	// in [1, MaxTileSize]. Zero means TileSize.
+	Size int
+
+	// Buffer expands the tile by this many output pixels of its neighbors on
+	// every side, producing a (Size+2*Buffer) square image whose center
+	// Size square covers the tile bounds. Must be in [0, TileSize].
+	Buffer int
+
+	// Background fills the tile before the source is drawn over it, showing
+	// through wherever the source is transparent or absent (beyond the poles
+	// in buffered tiles). Nil leaves those pixels transparent.
+	Background color.Color
+
+	// Kernels picks the interpolation kernel from the tile's zoom and the
+	// base map's native max zoom. Nil resamples with ResampleKernel.
+	Kernels KernelTable
+}
+
+// ExtractTileWithOptions is like ExtractTileCtx with rendering options.
+// Every tile is newly allocated, so callers may draw on it without affecting
+// the base map or other tiles.
+func (bm *BaseMap) ExtractTileWithOptions(ctx context.Context, z, x, y int, opts TileOptions) (*image.RGBA, error) {
+	if opts.Buffer < 0 || opts.Buffer > TileSize {
+		return nil, fmt.Errorf("tile buffer must be in range [0, %d], got %d", TileSize, opts.Buffer)
+	}
+	size := opts.Size
+	if size == 0 {
+		size = TileSize
+	}
+	if size < 0 || size > MaxTileSize {
+		return nil, fmt.Errorf("tile size must be in range [1, %d], got %d", MaxTileSize, opts.Size)
+	}
+	kernel, ok := opts.Kernels.Kernel(z, bm.NativeMaxZoom()).interpolator()
+	if !ok {
+		return nil, fmt.Errorf("unknown interpolation kernel %q", opts.Kernels.Kernel(z, bm.NativeMaxZoom()))
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	// Get geographic bounds of the tile
 	tileBounds, err := tilemath.TileBounds(z, x, y)
 	if err != nil {
@@ -81,30 +174,106 @@ func (bm *BaseMap) ExtractTile(z, x, y int) (*image.RGBA, error) {
 	// Convert geographic bounds to pixel bounds in the source image
 	pixelBounds := bm.geoBoundsToPixelBounds(tileBounds)
 
+	// Tiles drawn from fewer source pixels than they have, such as those
+	// near the poles, where Mercator stretches a few degrees of latitude over
+	// a whole tile, are mapped from the exact fractional source rectangle:
+	// rounding its edges to whole source pixels would misplace them by
+	// several tile pixels. Downsampled tiles are moved by less than a tile
+	// pixel, so they keep whole pixels and the faster Scale path. Tiles
+	// reaching past the image, where SourceBounds covers less than the
+	// world, are mapped the same way so the image only fills its extent.
+	src := bm.geoBoundsToSourceRect(tileBounds)
+	upsampled := src.maxX-src.minX < float64(size) || src.maxY-src.minY < float64(size)
+	partial := !src.within(bm.bounds)
+	if !upsampled && !partial {
+		src = sourceRect{float64(pixelBounds.Min.X), float64(pixelBounds.Min.Y), float64(pixelBounds.Max.X), float64(pixelBounds.Max.Y)}
+	}
+	if opts.Buffer > 0 || upsampled || partial {
+		return bm.transformTile(ctx, src, size, opts.Buffer, opts.Background, kernel)
+	}
+
 	// Extract the source region
 	sourceRegion := bm.extractRegion(pixelBounds)
 
-	// Resample to 512x512 using CatmullRom interpolation for better quality
-	tile := image.NewRGBA(image.Rect(0, 0, TileSize, TileSize))
-	xdraw.CatmullRom.Scale(tile, tile.Bounds(), sourceRegion, sourceRegion.Bounds(), xdraw.Over, nil)
+	// Resample to size x size with the kernel chosen for the zoom
+	tile := newTile(size, opts.Background)
+	if err := scaleCtx(ctx, kernel, tile, sourceRegion, sourceRegion.Bounds()); err != nil {
+		return nil, err
+	}
+
+	return tile, nil
+}
+
+// Tile is ExtractTileWithOptions returning an image.Image, so a BaseMap can
+// serve as a tileprovider.Provider
+func (bm *BaseMap) Tile(ctx context.Context, z, x, y int, opts TileOptions) (image.Image, error) {
+	return bm.ExtractTileWithOptions(ctx, z, x, y, opts)
+}
+
+// transformTile renders the tile covering src at size with buffer extra
+// output pixels on every side. The buffer extends the tile's own source to
+// output mapping, so the center size square matches the unbuffered tile.
+// Without a buffer the kernel reads no further than the image edges, as
+// ExtractTileWithOptions' other path does. Output pixels src maps beyond the
+// image keep the background, unless the image wraps around the world.
+func (bm *BaseMap) transformTile(ctx context.Context, src sourceRect, size, buffer int, background color.Color, kernel xdraw.Interpolator) (*image.RGBA, error) {
+	tile := newTile(size+2*buffer, background)
+	if src.maxX <= src.minX || src.maxY <= src.minY {
+		return tile, nil
+	}
+	scaleX := float64(size) / (src.maxX - src.minX)
+	scaleY := float64(size) / (src.maxY - src.minY)
+
+	// Source pixels needed for the buffer, plus room for the kernel support
+	padX := int(math.Ceil(float64(buffer)/scaleX)) + 2
+	padY := int(math.Ceil(float64(buffer)/scaleY)) + 2
+	source := image.Rect(int(math.Floor(src.minX))-padX, int(math.Floor(src.minY))-padY, int(math.Ceil(src.maxX))+padX, int(math.Ceil(src.maxY))+padY)
+	var sourceRegion image.Image
+	if buffer > 0 || (bm.wrapsLongitude() && !src.within(bm.bounds)) {
+		sourceRegion = bm.extractRegionWrapped(source)
+	} else {
+		sourceRegion = bm.extractRegion(source.Intersect(bm.bounds))
+	}
+
+	// Map source pixels to output pixels, offset by the buffer
+	b := float64(buffer)
+	s2d := f64.Aff3{
+		scaleX, 0, b - src.minX*scaleX,
+		0, scaleY, b - src.minY*scaleY,
+	}
+	if err := transformCtx(ctx, kernel, tile, s2d, sourceRegion, sourceRegion.Bounds()); err != nil {
+		return nil, err
+	}
 
 	return tile, nil
 }
 
+// newTile returns a size x size tile filled with background, or transparent
+// if background is nil
+func newTile(size int, background color.Color) *image.RGBA {
+	tile := image.NewRGBA(image.Rect(0, 0, size, size))
+	if background != nil {
+		draw.Draw(tile, tile.Bounds(), &image.Uniform{background}, image.Point{}, draw.Src)
+	}
+	return tile
+}
+
 // geoBoundsToPixelBounds converts geographic bounds (lat/lon) to pixel bounds
 // in the equirectangular source image.
-// For equirectangular projection covering full world extent:
-//   pixel_x = (lon + 180) / 360 * image_width
-//   pixel_y = (90 - lat) / 180 * image_height
+// For equirectangular projection covering the source extent:
+//   pixel_x = (lon - west) / (east - west) * image_width
+//   pixel_y = (north - lat) / (north - south) * image_height
 func (bm *BaseMap) geoBoundsToPixelBounds(geo tilemath.Bounds) image.Rectangle {
+	extent := bm.SourceBounds()
+
 	// Convert west/east longitude to x coordinates
-	x0 := lonToPixelX(geo.West, bm.width)
-	x1 := lonToPixelX(geo.East, bm.width)
+	x0 := lonToPixelX(geo.West, extent.West, extent.East, bm.width)
+	x1 := lonToPixelX(geo.East, extent.West, extent.East, bm.width)
 
 	// Convert north/south latitude to y coordinates
 	// Note: north latitude maps to smaller y (top of image)
-	y0 := latToPixelY(geo.North, bm.height)
-	y1 := latToPixelY(geo.South, bm.height)
+	y0 := latToPixelY(geo.North, extent.North, extent.South, bm.height)
+	y1 := latToPixelY(geo.South, extent.North, extent.South, bm.height)
 
 	// Clamp to image bounds
 	x0 = clamp(x0, 0, bm.width)
@@ -115,8 +284,42 @@ func (bm *BaseMap) geoBoundsToPixelBounds(geo tilemath.Bounds) image.Rectangle {
 	return image.Rect(x0, y0, x1, y1)
 }
 
+// sourceRect is a rectangle of the source image with fractional edges
+type sourceRect struct {
+	minX, minY, maxX, maxY float64
+}
+
+// within reports whether r lies inside the image bounds
+func (r sourceRect) within(bounds image.Rectangle) bool {
+	return r.minX >= float64(bounds.Min.X) && r.maxX <= float64(bounds.Max.X) &&
+		r.minY >= float64(bounds.Min.Y) && r.maxY <= float64(bounds.Max.Y)
+}
+
+// geoBoundsToSourceRect is geoBoundsToPixelBounds without truncating the
+// edges to whole pixels or clamping them to the image, so a tile only partly
+// inside SourceBounds keeps its true scale and position
+func (bm *BaseMap) geoBoundsToSourceRect(geo tilemath.Bounds) sourceRect {
+	extent := bm.SourceBounds()
+	return sourceRect{
+		minX: lonToSourceX(geo.West, extent.West, extent.East, bm.width),
+		maxX: lonToSourceX(geo.East, extent.West, extent.East, bm.width),
+		minY: latToSourceY(geo.North, extent.North, extent.South, bm.height),
+		maxY: latToSourceY(geo.South, extent.North, extent.South, bm.height),
+	}
+}
+
+// wrapsLongitude reports whether the image spans the whole globe east to
+// west, to within a pixel, so columns past one edge continue from the other
+func (bm *BaseMap) wrapsLongitude() bool {
+	extent := bm.SourceBounds()
+	span := extent.East - extent.West
+	return span >= 360-span/float64(bm.width)
+}
+
 // extractRegion extracts a sub-image from the base map.
 // For efficiency, this uses SubImage if available, otherwise copies the region.
+// A SubImage shares its pixels with the base map, so the region must only be
+// read; tiles are resampled from it into images of their own.
 func (bm *BaseMap) extractRegion(bounds image.Rectangle) image.Image {
 	// Check if we can use SubImage (most image types support this)
 	if subber, ok := bm.img.(interface {
@@ -131,19 +334,58 @@ func (bm *BaseMap) extractRegion(bounds image.Rectangle) image.Image {
 	return region
 }
 
-// lonToPixelX converts longitude to pixel x coordinate
-func lonToPixelX(lon float64, imageWidth int) int {
-	// Normalize longitude from [-180, 180] to [0, 1]
-	normalized := (lon + 180.0) / 360.0
-	return int(normalized * float64(imageWidth))
+// extractRegionWrapped is like extractRegion for bounds that may extend past
+// the image edges. Columns beyond the left or right edge wrap around the
+// antimeridian when the image spans the globe; rows beyond the poles, and
+// columns beyond a regional image, are left transparent.
+func (bm *BaseMap) extractRegionWrapped(bounds image.Rectangle) image.Image {
+	if bounds.In(bm.bounds) {
+		return bm.extractRegion(bounds)
+	}
+
+	region := image.NewRGBA(bounds)
+	shifts := []int{0}
+	if bm.wrapsLongitude() {
+		shifts = []int{-bm.width, 0, bm.width}
+	}
+	for _, shift := range shifts {
+		offset := image.Pt(shift, 0)
+		src := bounds.Add(offset).Intersect(bm.bounds)
+		if src.Empty() {
+			continue
+		}
+		draw.Draw(region, src.Sub(offset), bm.img, src.Min, draw.Src)
+	}
+	return region
+}
+
+// lonToPixelX converts longitude to pixel x coordinate in an image spanning
+// west to east
+func lonToPixelX(lon, west, east float64, imageWidth int) int {
+	return int(lonToSourceX(lon, west, east, imageWidth))
+}
+
+// latToPixelY converts latitude to pixel y coordinate in an image spanning
+// north to south
+func latToPixelY(lat, north, south float64, imageHeight int) int {
+	return int(latToSourceY(lat, north, south, imageHeight))
+}
+
+// lonToSourceX converts longitude to a fractional x coordinate in an image
+// spanning west to east, where pixel i covers [i, i+1)
+func lonToSourceX(lon, west, east float64, imageWidth int) float64 {
+	// Normalize longitude from [west, east] to [0, 1]
+	normalized := (lon - west) / (east - west)
+	return normalized * float64(imageWidth)
 }
 
-// latToPixelY converts latitude to pixel y coordinate
-func latToPixelY(lat float64, imageHeight int) int {
-	// Normalize latitude from [90, -90] to [0, 1]
+// latToSourceY converts latitude to a fractional y coordinate in an image
+// spanning north to south, where pixel row i covers [i, i+1)
+func latToSourceY(lat, north, south float64, imageHeight int) float64 {
+	// Normalize latitude from [north, south] to [0, 1]
 	// Note: y increases downward in images
-	normalized := (90.0 - lat) / 180.0
-	return int(normalized * float64(imageHeight))
+	normalized := (north - lat) / (north - south)
+	return normalized * float64(imageHeight)
 }
 
 // clamp restricts a value to the range [min, max]
@@ -166,3 +408,48 @@ func (bm *BaseMap) Width() int {
 func (bm *BaseMap) Height() int {
 	return bm.height
 }
+
+// SourceBounds returns the geographic extent the image covers, edge to edge
+func (bm *BaseMap) SourceBounds() tilemath.Bounds {
+	if bm.extent == (tilemath.Bounds{}) {
+		return WorldBounds
+	}
+	return bm.extent
+}
+
+// Orientation returns the EXIF orientation (2-8) the source image was
+// rotated or mirrored from when it was loaded, or 1 if it was stored upright
+func (bm *BaseMap) Orientation() int {
+	if bm.orientation == 0 {
+		return 1
+	}
+	return bm.orientation
+}
+
+// NativeMaxZoom returns the highest zoom level at which tiles are rendered
+// without upsampling the source image, i.e. where the source still has at
+// least TileSize pixels across each tile. Higher zooms are interpolated.
+func (bm *BaseMap) NativeMaxZoom() int {
+	z := 0
+	for bm.width>>uint(z+1) >= TileSize {
+		z++
+	}
+	return z
+}
+
+// MemoryBytes estimates the memory held by the decoded source image
+func (bm *BaseMap) MemoryBytes() int64 {
+	switch img := bm.img.(type) {
+	case *image.YCbCr:
+		return int64(len(img.Y) + len(img.Cb) + len(img.Cr))
+	case *image.RGBA:
+		return int64(len(img.Pix))
+	case *image.NRGBA:
+		return int64(len(img.Pix))
+	case *image.Gray:
+		return int64(len(img.Pix))
+	default:
+		// Assume 4 bytes per pixel for other image types
+		return int64(bm.width) * int64(bm.height) * 4
+	}
+}
@@ -1,9 +1,16 @@
 package imagery
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
 	"image"
 	"image/color"
+	"image/draw"
 	"image/jpeg"
+	"image/png"
+	"math"
 	"os"
 	"path/filepath"
 	"testing"
@@ -68,6 +75,19 @@ func TestLoadJPEGFromBytes(t *testing.T) {
 	t.Logf("Loaded basemap from bytes: %dx%d (%d bytes)", basemap.Width(), basemap.Height(), len(data))
 }
 
+func TestNewBaseMap(t *testing.T) {
+	img := createTestImage(200, 100)
+
+	basemap := NewBaseMap(img)
+	if basemap.Width() != 200 || basemap.Height() != 100 {
+		t.Errorf("Expected 200x100, got %dx%d", basemap.Width(), basemap.Height())
+	}
+
+	if _, err := basemap.ExtractTile(0, 0, 0); err != nil {
+		t.Errorf("ExtractTile on synthetic base map failed: %v", err)
+	}
+}
+
 func TestLoadJPEGFromBytes_InvalidData(t *testing.T) {
 	invalidData := []byte("This is not a JPEG image")
 
@@ -121,7 +141,7 @@ func TestLonToPixelX(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := lonToPixelX(tt.lon, tt.imageWidth)
+			result := lonToPixelX(tt.lon, -180, 180, tt.imageWidth)
 			if result != tt.expected {
 				t.Errorf("lonToPixelX(%f, %d) = %d, expected %d",
 					tt.lon, tt.imageWidth, result, tt.expected)
@@ -149,7 +169,7 @@ func TestLatToPixelY(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := latToPixelY(tt.lat, tt.imageHeight)
+			result := latToPixelY(tt.lat, 90, -90, tt.imageHeight)
 			if result != tt.expected {
 				t.Errorf("latToPixelY(%f, %d) = %d, expected %d",
 					tt.lat, tt.imageHeight, result, tt.expected)
@@ -181,6 +201,56 @@ func TestClamp(t *testing.T) {
 	}
 }
 
+func TestGeoBoundsToPixelBounds_SourceBounds(t *testing.T) {
+	world := image.Rect(0, 0, 3600, 1800)
+
+	tests := []struct {
+		extent   tilemath.Bounds
+		geo      tilemath.Bounds
+		expected image.Rectangle
+		name     string
+	}{
+		{
+			WorldBounds,
+			tilemath.Bounds{West: 0, South: 0, East: 90, North: 45},
+			image.Rect(1800, 450, 2700, 900),
+			"world extent",
+		},
+		{
+			// The image starts a degree east, so the window moves 10 pixels west
+			tilemath.Bounds{West: -179, South: -90, East: 181, North: 90},
+			tilemath.Bounds{West: 0, South: 0, East: 90, North: 45},
+			image.Rect(1790, 450, 2690, 900),
+			"shifted east",
+		},
+		{
+			// Half a pixel past every edge, as with pixel-center registration
+			tilemath.Bounds{West: -180.05, South: -90.05, East: 180.05, North: 90.05},
+			tilemath.Bounds{West: 90, South: -45, East: 180, North: 0},
+			image.Rect(2699, 900, 3599, 1349),
+			"pixel-center registration",
+		},
+		{
+			tilemath.Bounds{West: -180, South: -60, East: 180, North: 60},
+			tilemath.Bounds{West: -180, South: 0, East: 180, North: 30},
+			image.Rect(0, 450, 3600, 900),
+			"partial latitudes",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			basemap := &BaseMap{bounds: world, width: world.Dx(), height: world.Dy()}
+			if err := basemap.SetSourceBounds(tt.extent); err != nil {
+				t.Fatalf("SetSourceBounds(%v) failed: %v", tt.extent, err)
+			}
+			if result := basemap.geoBoundsToPixelBounds(tt.geo); result != tt.expected {
+				t.Errorf("geoBoundsToPixelBounds(%v) = %v, expected %v", tt.geo, result, tt.expected)
+			}
+		})
+	}
+}
+
 func TestGeoBoundsToPixelBounds(t *testing.T) {
 	// Create a test basemap with known dimensions
 	basemap := &BaseMap{
@@ -228,6 +298,43 @@ func TestGeoBoundsToPixelBounds(t *testing.T) {
 	}
 }
 
+func TestExtractTile_PolarEdge(t *testing.T) {
+	// A vertical ramp brightening by 3 gray levels per source row, so a
+	// sampled gray level gives the fractional row it was sampled at
+	img := image.NewGray(image.Rect(0, 0, 1152, 576))
+	for y := 0; y < 576; y++ {
+		for x := 0; x < 1152; x++ {
+			img.SetGray(x, y, color.Gray{uint8(min(3*y, 255))})
+		}
+	}
+	basemap := NewBaseMap(img)
+
+	// The top row of tiles at zoom 3 spans ~19 source rows, so a north edge
+	// rounded to a whole source row would be misplaced by tens of tile pixels
+	tile, err := basemap.ExtractTile(3, 3, 0)
+	if err != nil {
+		t.Fatalf("ExtractTile failed: %v", err)
+	}
+	geo, err := tilemath.TileBounds(3, 3, 0)
+	if err != nil {
+		t.Fatalf("TileBounds failed: %v", err)
+	}
+	north := latToSourceY(geo.North, 90, -90, 576)
+	south := latToSourceY(geo.South, 90, -90, 576)
+
+	// The top tile row samples half a tile pixel below the north edge; source
+	// row i holds its value at its center, i+0.5. Allow a quarter of a gray
+	// level, a twelfth of a source row, for the 8-bit rounding.
+	size := tile.Bounds().Dy()
+	sampledAt := north + 0.5*(south-north)/float64(size)
+	expected := 3 * (sampledAt - 0.5)
+	got := float64(color.GrayModel.Convert(tile.At(size/2, 0)).(color.Gray).Y)
+	if math.Abs(got-expected) > 0.25 {
+		t.Errorf("Top tile row sampled source row %.2f, expected %.2f",
+			got/3+0.5, sampledAt)
+	}
+}
+
 func TestExtractTile(t *testing.T) {
 	// Check if test image exists
 	if _, err := os.Stat(testImagePath); os.IsNotExist(err) {
@@ -324,6 +431,23 @@ func TestExtractTile_InvalidCoordinates(t *testing.T) {
 	}
 }
 
+func TestExtractTile_SentinelErrors(t *testing.T) {
+	testImg := createTestImage(100, 50)
+	basemap := &BaseMap{
+		img:    testImg,
+		bounds: testImg.Bounds(),
+		width:  100,
+		height: 50,
+	}
+
+	if _, err := basemap.ExtractTile(-1, 0, 0); !errors.Is(err, ErrInvalidZoom) {
+		t.Errorf("Expected ErrInvalidZoom for negative zoom, got %v", err)
+	}
+	if _, err := basemap.ExtractTile(1, 2, 0); !errors.Is(err, ErrOutOfRange) {
+		t.Errorf("Expected ErrOutOfRange for x out of range, got %v", err)
+	}
+}
+
 func TestExtractTile_SaveSampleTile(t *testing.T) {
 	// Check if test image exists
 	if _, err := os.Stat(testImagePath); os.IsNotExist(err) {
@@ -446,3 +570,411 @@ func (w *imageWrapper) Bounds() image.Rectangle {
 func (w *imageWrapper) At(x, y int) color.Color {
 	return w.Image.At(x, y)
 }
+
+func TestExtractTileCtx_Cancelled(t *testing.T) {
+	basemap := NewBaseMap(createTestImage(360, 180))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tile, err := basemap.ExtractTileCtx(ctx, 0, 0, 0)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+	if tile != nil {
+		t.Error("Expected no tile for a cancelled context")
+	}
+
+	// A live context renders normally
+	tile, err = basemap.ExtractTileCtx(context.Background(), 0, 0, 0)
+	if err != nil {
+		t.Fatalf("ExtractTileCtx() failed: %v", err)
+	}
+	if tile.Bounds().Dx() != TileSize {
+		t.Errorf("Expected %d px tile, got %d", TileSize, tile.Bounds().Dx())
+	}
+}
+
+func TestExtractTileWithOptions_Buffer(t *testing.T) {
+	// A fine checkerboard makes any misalignment show up as a large difference
+	basemap := NewBaseMap(createCheckerImage(3600, 1800, 40))
+	const buffer = 16
+
+	tests := []struct {
+		z, x, y int
+		name    string
+	}{
+		{2, 1, 1, "interior tile"},
+		{3, 0, 3, "west edge wraps"},
+		{3, 7, 4, "east edge wraps"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plain, err := basemap.ExtractTile(tt.z, tt.x, tt.y)
+			if err != nil {
+				t.Fatalf("ExtractTile() failed: %v", err)
+			}
+
+			buffered, err := basemap.ExtractTileWithOptions(context.Background(), tt.z, tt.x, tt.y, TileOptions{Buffer: buffer})
+			if err != nil {
+				t.Fatalf("ExtractTileWithOptions() failed: %v", err)
+			}
+
+			size := TileSize + 2*buffer
+			if b := buffered.Bounds(); b.Dx() != size || b.Dy() != size {
+				t.Fatalf("Expected %dx%d buffered tile, got %dx%d", size, size, b.Dx(), b.Dy())
+			}
+
+			// The center of the buffered tile lines up with the unbuffered tile,
+			// up to resampling and whole-pixel source rounding
+			center := buffered.SubImage(image.Rect(buffer, buffer, buffer+TileSize, buffer+TileSize)).(*image.RGBA)
+			if diff := meanChannelDiff(plain, center); diff > 1 {
+				t.Errorf("Center region differs from unbuffered tile by %.2f per channel", diff)
+			}
+
+			// Buffer pixels are filled, including across the antimeridian
+			for _, p := range []image.Point{{0, size / 2}, {size - 1, size / 2}} {
+				if a := buffered.RGBAAt(p.X, p.Y).A; a != 255 {
+					t.Errorf("Expected opaque buffer pixel at %v, got alpha %d", p, a)
+				}
+			}
+		})
+	}
+}
+
+func TestExtractTileWithOptions_InvalidBuffer(t *testing.T) {
+	basemap := NewBaseMap(createTestImage(360, 180))
+
+	for _, buffer := range []int{-1, TileSize + 1} {
+		if _, err := basemap.ExtractTileWithOptions(context.Background(), 0, 0, 0, TileOptions{Buffer: buffer}); err == nil {
+			t.Errorf("Expected error for buffer %d, got nil", buffer)
+		}
+	}
+}
+
+func TestExtractTileWithOptions_Size(t *testing.T) {
+	basemap := NewBaseMap(createCheckerImage(3600, 1800, 40))
+	plain, err := basemap.ExtractTile(2, 1, 1)
+	if err != nil {
+		t.Fatalf("ExtractTile() failed: %v", err)
+	}
+
+	tests := []struct {
+		opts       TileOptions
+		expectSize int
+		name       string
+	}{
+		{TileOptions{Size: 256}, 256, "half size"},
+		{TileOptions{Size: TileSize}, TileSize, "default size"},
+		{TileOptions{Size: 1024}, 1024, "double size"},
+		{TileOptions{Size: 256, Buffer: 8}, 272, "buffered"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tile, err := basemap.ExtractTileWithOptions(context.Background(), 2, 1, 1, tt.opts)
+			if err != nil {
+				t.Fatalf("ExtractTileWithOptions() failed: %v", err)
+			}
+			if b := tile.Bounds(); b.Dx() != tt.expectSize || b.Dy() != tt.expectSize {
+				t.Fatalf("Expected %dx%d tile, got %dx%d", tt.expectSize, tt.expectSize, b.Dx(), b.Dy())
+			}
+
+			// Every size covers the same area: the center pixel matches
+			c := tt.opts.Buffer + tt.opts.Size/2
+			if got, want := tile.RGBAAt(c, c), plain.RGBAAt(TileSize/2, TileSize/2); got != want {
+				t.Errorf("Expected center pixel %v, got %v", want, got)
+			}
+		})
+	}
+
+	for _, size := range []int{-1, MaxTileSize + 1} {
+		if _, err := basemap.ExtractTileWithOptions(context.Background(), 0, 0, 0, TileOptions{Size: size}); err == nil {
+			t.Errorf("Expected error for size %d, got nil", size)
+		}
+	}
+}
+
+// createEuropeImage creates a 1024x512 world image that is transparent
+// except for an opaque green box over Europe (10°W-40°E, 35°N-70°N)
+func createEuropeImage() *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, 1024, 512))
+	europe := image.Rect(lonToPixelX(-10, -180, 180, 1024), latToPixelY(70, 90, -90, 512), lonToPixelX(40, -180, 180, 1024), latToPixelY(35, 90, -90, 512))
+	draw.Draw(img, europe, &image.Uniform{color.RGBA{G: 200, A: 255}}, image.Point{}, draw.Src)
+	return img
+}
+
+func TestExtractTileWithOptions_Background(t *testing.T) {
+	basemap := NewBaseMap(createEuropeImage())
+	background := color.RGBA{R: 30, G: 60, B: 90, A: 255}
+
+	// Tile 2/2/1 spans 0°-90°E and 0°-66.5°N, so Europe covers its top left
+	tests := []struct {
+		opts    TileOptions
+		covered color.RGBA
+		outside color.RGBA
+		name    string
+	}{
+		{TileOptions{}, color.RGBA{G: 200, A: 255}, color.RGBA{}, "transparent by default"},
+		{TileOptions{Background: background}, color.RGBA{G: 200, A: 255}, background, "background color"},
+		{TileOptions{Buffer: 16, Background: background}, color.RGBA{G: 200, A: 255}, background, "background with buffer"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tile, err := basemap.ExtractTileWithOptions(context.Background(), 2, 2, 1, tt.opts)
+			if err != nil {
+				t.Fatalf("ExtractTileWithOptions failed: %v", err)
+			}
+			b := tt.opts.Buffer
+			if got := tile.RGBAAt(b+100, b+100); got != tt.covered {
+				t.Errorf("Expected covered pixel %v, got %v", tt.covered, got)
+			}
+			if got := tile.RGBAAt(b+450, b+450); got != tt.outside {
+				t.Errorf("Expected uncovered pixel %v, got %v", tt.outside, got)
+			}
+		})
+	}
+}
+
+func TestExtractTileWithOptions_RegionalSourceBounds(t *testing.T) {
+	red := color.RGBA{R: 255, A: 255}
+	background := color.RGBA{R: 30, G: 60, B: 90, A: 255}
+	solid := func(w, h int) image.Image {
+		img := image.NewRGBA(image.Rect(0, 0, w, h))
+		draw.Draw(img, img.Bounds(), &image.Uniform{red}, image.Point{}, draw.Src)
+		return img
+	}
+
+	// The zoom 0 tile is 512 pixels across: the prime meridian and the
+	// equator cross at its center
+	tests := []struct {
+		img     image.Image
+		extent  tilemath.Bounds
+		buffer  int
+		covered image.Point // Tile pixels the image must fill
+		outside image.Point // Tile pixels it must leave to the background
+		name    string
+	}{
+		{solid(1024, 512), tilemath.Bounds{West: -180, South: -90, East: 0, North: 90}, 0, image.Pt(100, 256), image.Pt(400, 256), "western hemisphere, downsampled"},
+		{solid(64, 64), tilemath.Bounds{West: -180, South: -90, East: 0, North: 90}, 0, image.Pt(100, 256), image.Pt(400, 256), "western hemisphere, upsampled"},
+		{solid(1024, 256), tilemath.Bounds{West: -180, South: 0, East: 180, North: 90}, 0, image.Pt(256, 100), image.Pt(256, 400), "northern hemisphere"},
+		// West of -180 is east of 180, which this image does not reach either
+		{solid(1024, 512), tilemath.Bounds{West: -180, South: -90, East: 0, North: 90}, 16, image.Pt(16+100, 16+256), image.Pt(4, 16+256), "buffer past the antimeridian"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			basemap := NewBaseMap(tt.img)
+			if err := basemap.SetSourceBounds(tt.extent); err != nil {
+				t.Fatalf("SetSourceBounds(%v) failed: %v", tt.extent, err)
+			}
+			tile, err := basemap.ExtractTileWithOptions(context.Background(), 0, 0, 0, TileOptions{Buffer: tt.buffer, Background: background})
+			if err != nil {
+				t.Fatalf("ExtractTileWithOptions failed: %v", err)
+			}
+			if got := tile.RGBAAt(tt.covered.X, tt.covered.Y); got != red {
+				t.Errorf("Expected the image at %v, got %v", tt.covered, got)
+			}
+			if got := tile.RGBAAt(tt.outside.X, tt.outside.Y); got != background {
+				t.Errorf("Expected the background at %v, got %v", tt.outside, got)
+			}
+		})
+	}
+}
+
+func TestExtractTile_DrawingLeavesBaseMapUntouched(t *testing.T) {
+	img := createTestImage(1024, 512)
+	source := bytes.Clone(img.Pix)
+	bm := NewBaseMap(img)
+
+	tests := []struct {
+		opts TileOptions
+		name string
+	}{
+		{TileOptions{}, "sub-image"},
+		{TileOptions{Buffer: 8}, "buffered"},
+		{TileOptions{Size: 256}, "native resolution"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tile, err := bm.ExtractTileWithOptions(context.Background(), 1, 0, 0, tt.opts)
+			if err != nil {
+				t.Fatalf("ExtractTileWithOptions failed: %v", err)
+			}
+			rendered := bytes.Clone(tile.Pix)
+
+			// Paint over the whole tile, then label it
+			draw.Draw(tile, tile.Bounds(), &image.Uniform{color.RGBA{R: 255, A: 255}}, image.Point{}, draw.Src)
+			DrawDebugOverlay(tile, tile.Bounds(), "1/0/0")
+
+			if !bytes.Equal(img.Pix, source) {
+				t.Fatal("Expected drawing on a tile to leave the base map untouched")
+			}
+			again, err := bm.ExtractTileWithOptions(context.Background(), 1, 0, 0, tt.opts)
+			if err != nil {
+				t.Fatalf("ExtractTileWithOptions failed: %v", err)
+			}
+			if !bytes.Equal(again.Pix, rendered) {
+				t.Error("Expected the tile rendered again to match the first render")
+			}
+		})
+	}
+}
+
+func TestTile(t *testing.T) {
+	bm := NewBaseMap(createTestImage(1024, 512))
+	opts := TileOptions{Size: 256, Buffer: 4}
+
+	got, err := bm.Tile(context.Background(), 2, 1, 1, opts)
+	if err != nil {
+		t.Fatalf("Tile failed: %v", err)
+	}
+	want, err := bm.ExtractTileWithOptions(context.Background(), 2, 1, 1, opts)
+	if err != nil {
+		t.Fatalf("ExtractTileWithOptions failed: %v", err)
+	}
+	if rgba, ok := got.(*image.RGBA); !ok || !bytes.Equal(rgba.Pix, want.Pix) {
+		t.Error("Expected Tile to render like ExtractTileWithOptions")
+	}
+
+	if _, err := bm.Tile(context.Background(), 2, 4, 0, TileOptions{}); !errors.Is(err, ErrOutOfRange) {
+		t.Errorf("Expected ErrOutOfRange, got %v", err)
+	}
+}
+
+// createCheckerImage creates a black and white checkerboard with square cells
+func createCheckerImage(width, height, cell int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			c := color.RGBA{A: 255}
+			if (x/cell+y/cell)%2 == 0 {
+				c = color.RGBA{R: 255, G: 255, B: 255, A: 255}
+			}
+			img.SetRGBA(x, y, c)
+		}
+	}
+	return img
+}
+
+// meanChannelDiff returns the mean absolute difference per RGB channel
+// between two images of the same size
+func meanChannelDiff(a, b *image.RGBA) float64 {
+	var sum float64
+	bb := b.Bounds()
+	for y := 0; y < bb.Dy(); y++ {
+		for x := 0; x < bb.Dx(); x++ {
+			ca := a.RGBAAt(a.Bounds().Min.X+x, a.Bounds().Min.Y+y)
+			cb := b.RGBAAt(bb.Min.X+x, bb.Min.Y+y)
+			sum += math.Abs(float64(ca.R)-float64(cb.R)) +
+				math.Abs(float64(ca.G)-float64(cb.G)) +
+				math.Abs(float64(ca.B)-float64(cb.B))
+		}
+	}
+	return sum / float64(3*bb.Dx()*bb.Dy())
+}
+
+func TestNativeMaxZoom(t *testing.T) {
+	tests := []struct {
+		width  int
+		expect int
+		name   string
+	}{
+		{360, 0, "smaller than one tile"},
+		{512, 0, "exactly one tile"},
+		{1024, 1, "two tiles across"},
+		{1500, 1, "between zooms rounds down"},
+		{5400, 3, "Blue Marble 5400x2700"},
+		{86400, 7, "high resolution source"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			basemap := &BaseMap{width: tt.width, height: tt.width / 2}
+			if got := basemap.NativeMaxZoom(); got != tt.expect {
+				t.Errorf("NativeMaxZoom() for width %d = %d, expected %d", tt.width, got, tt.expect)
+			}
+		})
+	}
+}
+
+func TestMemoryBytes(t *testing.T) {
+	rgba := NewBaseMap(createTestImage(100, 50))
+	if got := rgba.MemoryBytes(); got != 100*50*4 {
+		t.Errorf("Expected %d bytes for RGBA, got %d", 100*50*4, got)
+	}
+
+	// 4:2:0 JPEG data takes 1.5 bytes per pixel
+	ycbcr := NewBaseMap(image.NewYCbCr(image.Rect(0, 0, 100, 50), image.YCbCrSubsampleRatio420))
+	if got := ycbcr.MemoryBytes(); got != 100*50*3/2 {
+		t.Errorf("Expected %d bytes for YCbCr 4:2:0, got %d", 100*50*3/2, got)
+	}
+}
+
+// goldenBaseMap is a small synthetic equirectangular image with gradients,
+// grid lines, a disc and a fine checker, so resampling changes show up
+const goldenBaseMap = "testdata/synthetic_basemap.png"
+
+// goldenTolerance allows for harmless rounding differences while still
+// catching any visible change in the resampler
+const goldenTolerance = 0.002
+
+// TestExtractTile_Golden compares rendered tiles against checked-in PNGs.
+// Run with UPDATE_GOLDEN=1 to regenerate them after an intended change.
+func TestExtractTile_Golden(t *testing.T) {
+	basemap, err := LoadImage(goldenBaseMap, LoadOptions{})
+	if err != nil {
+		t.Fatalf("LoadImage failed: %v", err)
+	}
+	update := os.Getenv("UPDATE_GOLDEN") != ""
+
+	tests := []struct {
+		z, x, y int
+		name    string
+	}{
+		{0, 0, 0, "world"},
+		{1, 1, 0, "north-east quarter"},
+		{2, 1, 1, "disc"},
+		{3, 5, 2, "grid"},
+		{3, 6, 5, "checker"},
+		{5, 10, 12, "overzoom"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tile, err := basemap.ExtractTile(tt.z, tt.x, tt.y)
+			if err != nil {
+				t.Fatalf("ExtractTile failed: %v", err)
+			}
+			path := filepath.Join("testdata", fmt.Sprintf("golden_%d_%d_%d.png", tt.z, tt.x, tt.y))
+
+			if update {
+				var buf bytes.Buffer
+				if err := png.Encode(&buf, tile); err != nil {
+					t.Fatalf("Failed to encode PNG: %v", err)
+				}
+				if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+					t.Fatalf("Failed to write golden tile: %v", err)
+				}
+				return
+			}
+
+			f, err := os.Open(path)
+			if err != nil {
+				t.Fatalf("Failed to open golden tile (run with UPDATE_GOLDEN=1 to create it): %v", err)
+			}
+			defer f.Close()
+			decoded, err := png.Decode(f)
+			if err != nil {
+				t.Fatalf("Failed to decode golden tile: %v", err)
+			}
+			want := image.NewRGBA(decoded.Bounds())
+			draw.Draw(want, want.Rect, decoded, decoded.Bounds().Min, draw.Src)
+
+			assertTilesMatch(t, tile, want, goldenTolerance)
+		})
+	}
+}
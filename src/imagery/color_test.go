@@ -0,0 +1,41 @@
+package imagery
+
+import (
+	"image/color"
+	"testing"
+)
+
+func TestParseHexColor(t *testing.T) {
+	tests := []struct {
+		input       string
+		expected    color.RGBA
+		expectError bool
+		name        string
+	}{
+		{"#1e90ff", color.RGBA{0x1e, 0x90, 0xff, 0xff}, false, "rgb"},
+		{"1E90FF", color.RGBA{0x1e, 0x90, 0xff, 0xff}, false, "no hash, upper case"},
+		{"#ff000080", color.RGBA{0x80, 0, 0, 0x80}, false, "alpha is premultiplied"},
+		{"#00000000", color.RGBA{}, false, "transparent"},
+		{"#fff", color.RGBA{}, true, "short form"},
+		{"#gg0000", color.RGBA{}, true, "not hex"},
+		{"", color.RGBA{}, true, "empty"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseHexColor(tt.input)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Expected error for %q, got %v", tt.input, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseHexColor(%q) failed: %v", tt.input, err)
+			}
+			if got != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,35 @@
+package imagery
+
+import (
+	"fmt"
+	"image"
+)
+
+// CompareTiles returns the mean absolute difference between a and b over
+// every R, G, B and A sample, normalized to [0, 1]: 0 for identical tiles,
+// 1 when every sample differs by 255. It is meant for catching visual
+// regressions against golden tiles, where small resampling changes score
+// close to 0. The tiles must be the same size; their origins may differ.
+func CompareTiles(a, b *image.RGBA) (float64, error) {
+	size := a.Bounds().Size()
+	if b.Bounds().Size() != size {
+		return 0, fmt.Errorf("tile sizes differ: %v and %v", size, b.Bounds().Size())
+	}
+	if size.X == 0 || size.Y == 0 {
+		return 0, nil
+	}
+
+	var sum uint64
+	for y := range size.Y {
+		rowA := a.Pix[a.PixOffset(a.Rect.Min.X, a.Rect.Min.Y+y):][:size.X*4]
+		rowB := b.Pix[b.PixOffset(b.Rect.Min.X, b.Rect.Min.Y+y):][:size.X*4]
+		for i := range rowA {
+			if rowA[i] > rowB[i] {
+				sum += uint64(rowA[i] - rowB[i])
+			} else {
+				sum += uint64(rowB[i] - rowA[i])
+			}
+		}
+	}
+	return float64(sum) / (255 * 4 * float64(size.X*size.Y)), nil
+}
@@ -0,0 +1,123 @@
+package imagery
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+// assertTilesMatch fails the test if got differs from want by more than
+// tolerance, as scored by CompareTiles
+func assertTilesMatch(t *testing.T, got, want *image.RGBA, tolerance float64) {
+	t.Helper()
+	diff, err := CompareTiles(got, want)
+	if err != nil {
+		t.Fatalf("CompareTiles() failed: %v", err)
+	}
+	if diff > tolerance {
+		t.Errorf("Tiles differ by %.4f, more than the tolerance %.4f", diff, tolerance)
+	}
+}
+
+// gradientTile returns a size x size opaque tile with a color gradient
+func gradientTile(size int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	for y := range size {
+		for x := range size {
+			img.SetRGBA(x, y, color.RGBA{uint8(x * 255 / size), uint8(y * 255 / size), 128, 255})
+		}
+	}
+	return img
+}
+
+// invertTile returns img with its color channels inverted
+func invertTile(img *image.RGBA) *image.RGBA {
+	out := image.NewRGBA(img.Rect)
+	for i := 0; i < len(img.Pix); i += 4 {
+		out.Pix[i], out.Pix[i+1], out.Pix[i+2], out.Pix[i+3] = 255-img.Pix[i], 255-img.Pix[i+1], 255-img.Pix[i+2], img.Pix[i+3]
+	}
+	return out
+}
+
+func TestCompareTiles(t *testing.T) {
+	base := gradientTile(64)
+	rendered, err := halfAndHalfBaseMap(color.RGBA{0, 0, 255, 255}, color.RGBA{0, 255, 0, 255}).ExtractTile(1, 0, 0)
+	if err != nil {
+		t.Fatalf("ExtractTile() failed: %v", err)
+	}
+	black := image.NewRGBA(image.Rect(0, 0, 64, 64))
+	white := image.NewRGBA(image.Rect(0, 0, 64, 64))
+	for i := range black.Pix {
+		white.Pix[i] = 255
+		if i%4 == 3 {
+			black.Pix[i] = 255
+		}
+	}
+	shifted := image.NewRGBA(image.Rect(0, 0, 64, 64))
+	for i, v := range base.Pix {
+		shifted.Pix[i] = v
+		if i%4 == 0 && v < 255 {
+			shifted.Pix[i] = v + 1
+		}
+	}
+
+	tests := []struct {
+		a, b      *image.RGBA
+		expectMin float64
+		expectMax float64
+		name      string
+	}{
+		{base, base, 0, 0, "identical"},
+		{base, base.SubImage(base.Rect).(*image.RGBA), 0, 0, "same pixels, shared buffer"},
+		{base, shifted, 0, 0.001, "one level off in red"},
+		{base, invertTile(base), 0.2, 0.3, "inverted gradient"},
+		{rendered, invertTile(rendered), 0.75, 0.75, "inverted map tile"},
+		{black, white, 0.75, 0.75, "black and white, both opaque"},
+		{image.NewRGBA(image.Rect(0, 0, 64, 64)), white, 1, 1, "transparent and white"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diff, err := CompareTiles(tt.a, tt.b)
+			if err != nil {
+				t.Fatalf("CompareTiles() failed: %v", err)
+			}
+			if diff < tt.expectMin || diff > tt.expectMax {
+				t.Errorf("Expected a difference in [%v, %v], got %v", tt.expectMin, tt.expectMax, diff)
+			}
+		})
+	}
+}
+
+func TestCompareTiles_Offset(t *testing.T) {
+	// A tile cut from the middle of a larger image compares by position
+	// within each tile, not by absolute coordinates
+	big := gradientTile(128)
+	cut := big.SubImage(image.Rect(32, 32, 96, 96)).(*image.RGBA)
+	copied := image.NewRGBA(image.Rect(0, 0, 64, 64))
+	for y := range 64 {
+		for x := range 64 {
+			copied.SetRGBA(x, y, big.RGBAAt(x+32, y+32))
+		}
+	}
+	assertTilesMatch(t, cut, copied, 0)
+}
+
+func TestCompareTiles_SizeMismatch(t *testing.T) {
+	if _, err := CompareTiles(gradientTile(64), gradientTile(32)); err == nil {
+		t.Error("Expected error for tiles of different sizes, got nil")
+	}
+}
+
+func TestCompareTiles_RenderedTileStable(t *testing.T) {
+	bm := halfAndHalfBaseMap(color.RGBA{0, 0, 255, 255}, color.RGBA{0, 255, 0, 255})
+	first, err := bm.ExtractTile(1, 0, 0)
+	if err != nil {
+		t.Fatalf("ExtractTile() failed: %v", err)
+	}
+	second, err := bm.ExtractTile(1, 0, 0)
+	if err != nil {
+		t.Fatalf("ExtractTile() failed: %v", err)
+	}
+	assertTilesMatch(t, first, second, 0)
+}
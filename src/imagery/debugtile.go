@@ -0,0 +1,54 @@
+package imagery
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+// Colors of the debug overlay: a border and a label box that stand out
+// against both imagery and blank tiles
+var (
+	debugBorderColor = color.RGBA{255, 0, 0, 255}
+	debugLabelColor  = color.RGBA{0, 0, 0, 255}
+	debugLabelBox    = color.RGBA{255, 255, 255, 255}
+)
+
+// debugLabelPadding is the space in pixels between the label text and the
+// edges of its box
+const debugLabelPadding = 3
+
+// DrawDebugOverlay outlines r in tile with a 1 pixel border and writes label,
+// such as the tile's z/x/y, in its top left corner, so that tiles can be told
+// apart and seams spotted in a map viewer
+func DrawDebugOverlay(tile *image.RGBA, r image.Rectangle, label string) {
+	r = r.Intersect(tile.Bounds())
+	if r.Empty() {
+		return
+	}
+
+	border := &image.Uniform{debugBorderColor}
+	for _, edge := range []image.Rectangle{
+		image.Rect(r.Min.X, r.Min.Y, r.Max.X, r.Min.Y+1),
+		image.Rect(r.Min.X, r.Max.Y-1, r.Max.X, r.Max.Y),
+		image.Rect(r.Min.X, r.Min.Y, r.Min.X+1, r.Max.Y),
+		image.Rect(r.Max.X-1, r.Min.Y, r.Max.X, r.Max.Y),
+	} {
+		draw.Draw(tile, edge, border, image.Point{}, draw.Src)
+	}
+
+	face := basicfont.Face7x13
+	d := &font.Drawer{Dst: tile, Src: &image.Uniform{debugLabelColor}, Face: face}
+	width := d.MeasureString(label).Ceil()
+	metrics := face.Metrics()
+	box := image.Rect(0, 0, width+2*debugLabelPadding, metrics.Height.Ceil()+2*debugLabelPadding).
+		Add(r.Min.Add(image.Pt(2, 2))).Intersect(r.Inset(1))
+	draw.Draw(tile, box, &image.Uniform{debugLabelBox}, image.Point{}, draw.Src)
+
+	d.Dot = fixed.P(box.Min.X+debugLabelPadding, box.Min.Y+debugLabelPadding+metrics.Ascent.Ceil())
+	d.DrawString(label)
+}
@@ -0,0 +1,50 @@
+package imagery
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestDrawDebugOverlay(t *testing.T) {
+	tile := image.NewRGBA(image.Rect(0, 0, 64, 64))
+	DrawDebugOverlay(tile, image.Rect(8, 8, 56, 56), "3/5/2")
+
+	for i := 8; i < 56; i++ {
+		for _, p := range []image.Point{{i, 8}, {i, 55}, {8, i}, {55, i}} {
+			if c := tile.RGBAAt(p.X, p.Y); c != debugBorderColor {
+				t.Fatalf("Expected border color at %v, got %v", p, c)
+			}
+		}
+	}
+	if c := tile.RGBAAt(4, 4); c != (color.RGBA{}) {
+		t.Errorf("Expected pixels outside the rectangle untouched, got %v", c)
+	}
+	if c := tile.RGBAAt(32, 50); c != (color.RGBA{}) {
+		t.Errorf("Expected pixels away from the border and label untouched, got %v", c)
+	}
+
+	// The label is dark text on a light box in the top left corner
+	text := 0
+	for y := 10; y < 30; y++ {
+		for x := 10; x < 56; x++ {
+			if tile.RGBAAt(x, y) == debugLabelColor {
+				text++
+			}
+		}
+	}
+	if text == 0 {
+		t.Error("Expected label text in the top left corner")
+	}
+}
+
+func TestDrawDebugOverlay_Outside(t *testing.T) {
+	tile := image.NewRGBA(image.Rect(0, 0, 16, 16))
+	DrawDebugOverlay(tile, image.Rect(32, 32, 48, 48), "0/0/0")
+
+	for _, v := range tile.Pix {
+		if v != 0 {
+			t.Fatal("Expected a rectangle outside the tile to draw nothing")
+		}
+	}
+}
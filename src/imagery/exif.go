@@ -0,0 +1,124 @@
+package imagery
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// JPEG markers read while looking for EXIF data
+const (
+	markerSOI  = 0xD8 // Start of image
+	markerSOS  = 0xDA // Start of scan; metadata segments precede it
+	markerAPP1 = 0xE1 // Application segment holding EXIF
+)
+
+// exifOrientationTag is the TIFF tag holding the EXIF orientation (1-8)
+const exifOrientationTag = 0x0112
+
+// readJPEGOrientation returns the EXIF orientation of the JPEG stream in r,
+// or 1 (upright) if the image has no orientation tag. Only the segments before
+// the image data are read.
+func readJPEGOrientation(r io.Reader) (int, error) {
+	br := bufio.NewReader(r)
+
+	var soi [2]byte
+	if _, err := io.ReadFull(br, soi[:]); err != nil {
+		return 0, fmt.Errorf("failed to read JPEG header: %w", err)
+	}
+	if soi[0] != 0xFF || soi[1] != markerSOI {
+		return 0, errors.New("not a JPEG stream")
+	}
+
+	for {
+		var hdr [4]byte
+		if _, err := io.ReadFull(br, hdr[:2]); err != nil {
+			return 0, fmt.Errorf("failed to read JPEG marker: %w", err)
+		}
+		if hdr[0] != 0xFF {
+			return 0, fmt.Errorf("invalid JPEG marker %#x", hdr[0])
+		}
+		marker := hdr[1]
+		if marker == 0xFF {
+			// Fill byte before the actual marker
+			br.UnreadByte()
+			continue
+		}
+		if marker == markerSOS {
+			return 1, nil
+		}
+		if marker >= 0xD0 && marker <= 0xD7 || marker == 0x01 {
+			// Standalone markers carry no length
+			continue
+		}
+
+		if _, err := io.ReadFull(br, hdr[2:]); err != nil {
+			return 0, fmt.Errorf("failed to read JPEG segment length: %w", err)
+		}
+		length := int(binary.BigEndian.Uint16(hdr[2:])) - 2
+		if length < 0 {
+			return 0, errors.New("invalid JPEG segment length")
+		}
+
+		if marker != markerAPP1 {
+			if _, err := br.Discard(length); err != nil {
+				return 0, fmt.Errorf("failed to skip JPEG segment: %w", err)
+			}
+			continue
+		}
+
+		seg := make([]byte, length)
+		if _, err := io.ReadFull(br, seg); err != nil {
+			return 0, fmt.Errorf("failed to read APP1 segment: %w", err)
+		}
+		if bytes.HasPrefix(seg, []byte("Exif\x00\x00")) {
+			return parseEXIFOrientation(seg[6:])
+		}
+	}
+}
+
+// parseEXIFOrientation reads the orientation tag from the TIFF structure
+// of an EXIF block, returning 1 if it is absent
+func parseEXIFOrientation(tiff []byte) (int, error) {
+	if len(tiff) < 8 {
+		return 0, errors.New("EXIF data too short")
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0, errors.New("invalid EXIF byte order")
+	}
+	if order.Uint16(tiff[2:]) != 42 {
+		return 0, errors.New("invalid EXIF TIFF header")
+	}
+
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 0, errors.New("invalid EXIF IFD offset")
+	}
+	entries := int(order.Uint16(tiff[ifd:]))
+	for i := 0; i < entries; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 0, errors.New("truncated EXIF IFD")
+		}
+		if order.Uint16(tiff[entry:]) != exifOrientationTag {
+			continue
+		}
+		// SHORT value, stored left-aligned in the value field
+		orientation := int(order.Uint16(tiff[entry+8:]))
+		if orientation < 1 || orientation > 8 {
+			return 0, fmt.Errorf("invalid EXIF orientation %d", orientation)
+		}
+		return orientation, nil
+	}
+	return 1, nil
+}
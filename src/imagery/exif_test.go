@@ -0,0 +1,76 @@
+package imagery
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image/jpeg"
+	"testing"
+)
+
+// withEXIFOrientation inserts an APP1 EXIF segment holding only an
+// orientation tag directly after the SOI marker of a JPEG stream
+func withEXIFOrientation(jpegData []byte, orientation uint16, order binary.ByteOrder) []byte {
+	tiff := make([]byte, 26)
+	if order == binary.LittleEndian {
+		copy(tiff, "II")
+	} else {
+		copy(tiff, "MM")
+	}
+	order.PutUint16(tiff[2:], 42)
+	order.PutUint32(tiff[4:], 8) // IFD0 offset
+	order.PutUint16(tiff[8:], 1) // One entry
+	order.PutUint16(tiff[10:], exifOrientationTag)
+	order.PutUint16(tiff[12:], 3) // SHORT
+	order.PutUint32(tiff[14:], 1) // Count
+	order.PutUint16(tiff[18:], orientation)
+	// Next IFD offset (tiff[22:26]) stays zero
+
+	payload := append([]byte("Exif\x00\x00"), tiff...)
+	seg := []byte{0xFF, markerAPP1, 0, 0}
+	binary.BigEndian.PutUint16(seg[2:], uint16(len(payload)+2))
+	seg = append(seg, payload...)
+
+	out := append([]byte{}, jpegData[:2]...)
+	out = append(out, seg...)
+	return append(out, jpegData[2:]...)
+}
+
+func TestReadJPEGOrientation(t *testing.T) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, createTestImage(16, 8), nil); err != nil {
+		t.Fatalf("Failed to encode JPEG: %v", err)
+	}
+	plain := buf.Bytes()
+
+	tests := []struct {
+		data        []byte
+		expect      int
+		expectError bool
+		name        string
+	}{
+		{plain, 1, false, "no EXIF"},
+		{withEXIFOrientation(plain, 3, binary.LittleEndian), 3, false, "little endian"},
+		{withEXIFOrientation(plain, 6, binary.BigEndian), 6, false, "big endian"},
+		{withEXIFOrientation(plain, 9, binary.BigEndian), 0, true, "invalid orientation"},
+		{[]byte("\x89PNG\r\n\x1a\n"), 0, true, "not a JPEG"},
+		{plain[:10], 0, true, "truncated"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readJPEGOrientation(bytes.NewReader(tt.data))
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Expected error, got orientation %d", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("readJPEGOrientation failed: %v", err)
+			}
+			if got != tt.expect {
+				t.Errorf("Expected orientation %d, got %d", tt.expect, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package imagery
+
+import (
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"strings"
+
+	"github.com/HugoSmits86/nativewebp"
+)
+
+// Format identifies a tile output encoding
+type Format string
+
+// Supported tile output formats
+const (
+	FormatPNG  Format = "png"
+	FormatJPEG Format = "jpeg"
+	FormatWebP Format = "webp"
+)
+
+// SupportedFormats returns all tile output formats in preference order
+func SupportedFormats() []Format {
+	return []Format{FormatPNG, FormatJPEG, FormatWebP}
+}
+
+// DefaultJPEGQuality is the quality used when encoding JPEG tiles
+const DefaultJPEGQuality = 90
+
+// FormatFromExtension returns the format for a file extension such as ".png"
+// or "jpg". The match is case-insensitive.
+func FormatFromExtension(ext string) (Format, error) {
+	switch strings.ToLower(strings.TrimPrefix(ext, ".")) {
+	case "png":
+		return FormatPNG, nil
+	case "jpg", "jpeg":
+		return FormatJPEG, nil
+	case "webp":
+		return FormatWebP, nil
+	default:
+		return "", fmt.Errorf("unsupported tile format %q", ext)
+	}
+}
+
+// ContentType returns the MIME type for the format
+func (f Format) ContentType() string {
+	switch f {
+	case FormatJPEG:
+		return "image/jpeg"
+	case FormatWebP:
+		return "image/webp"
+	default:
+		return "image/png"
+	}
+}
+
+// Extension returns the canonical file extension for the format, including the dot
+func (f Format) Extension() string {
+	switch f {
+	case FormatJPEG:
+		return ".jpg"
+	case FormatWebP:
+		return ".webp"
+	default:
+		return ".png"
+	}
+}
+
+// Encode writes img to w in the given format.
+// WebP output is lossless; JPEG output uses DefaultJPEGQuality.
+func Encode(w io.Writer, img image.Image, f Format) error {
+	return Encoder{}.Encode(w, img, f)
+}
+
+// Encoder encodes tiles with per-format options. The zero value encodes
+// like Encode.
+type Encoder struct {
+	JPEG JPEGOptions
+
+	// Adaptive, if enabled, replaces JPEG.Quality with a quality chosen for
+	// each image from its ImageStats
+	Adaptive AdaptiveQuality
+}
+
+// Encode writes img to w in the given format
+func (e Encoder) Encode(w io.Writer, img image.Image, f Format) error {
+	switch f {
+	case FormatPNG:
+		return png.Encode(w, img)
+	case FormatJPEG:
+		o := e.JPEG
+		if e.Adaptive.Enabled() {
+			o.Quality = e.Adaptive.Quality(ImageStats(img))
+		}
+		return EncodeJPEG(w, img, o)
+	case FormatWebP:
+		return nativewebp.Encode(w, img, nil)
+	default:
+		return fmt.Errorf("unsupported tile format %q", f)
+	}
+}
@@ -0,0 +1,94 @@
+package imagery
+
+import (
+	"bytes"
+	"image"
+	"testing"
+)
+
+func TestFormatFromExtension(t *testing.T) {
+	tests := []struct {
+		ext         string
+		expect      Format
+		expectError bool
+		name        string
+	}{
+		{".png", FormatPNG, false, "png with dot"},
+		{"png", FormatPNG, false, "png without dot"},
+		{"jpg", FormatJPEG, false, "jpg"},
+		{".jpeg", FormatJPEG, false, "jpeg"},
+		{"webp", FormatWebP, false, "webp"},
+		{".PNG", FormatPNG, false, "uppercase"},
+		{".gif", "", true, "unsupported"},
+		{"", "", true, "empty"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := FormatFromExtension(tt.ext)
+
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Expected error for extension %q, got nil", tt.ext)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if f != tt.expect {
+				t.Errorf("FormatFromExtension(%q) = %s, expected %s", tt.ext, f, tt.expect)
+			}
+		})
+	}
+}
+
+func TestEncode_RoundTrip(t *testing.T) {
+	src := createTestImage(64, 32)
+
+	for _, f := range []Format{FormatPNG, FormatJPEG, FormatWebP} {
+		t.Run(string(f), func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := Encode(&buf, src, f); err != nil {
+				t.Fatalf("Encode(%s) failed: %v", f, err)
+			}
+
+			img, name, err := image.Decode(&buf)
+			if err != nil {
+				t.Fatalf("Failed to decode %s output: %v", f, err)
+			}
+
+			if img.Bounds().Dx() != 64 || img.Bounds().Dy() != 32 {
+				t.Errorf("Expected 64x32 image, got %dx%d", img.Bounds().Dx(), img.Bounds().Dy())
+			}
+
+			expectName := map[Format]string{FormatPNG: "png", FormatJPEG: "jpeg", FormatWebP: "webp"}[f]
+			if name != expectName {
+				t.Errorf("Expected decoded format %s, got %s", expectName, name)
+			}
+		})
+	}
+}
+
+func TestEncode_UnsupportedFormat(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Encode(&buf, createTestImage(8, 8), Format("gif")); err == nil {
+		t.Error("Expected error for unsupported format, got nil")
+	}
+}
+
+func TestSupportedFormats(t *testing.T) {
+	formats := SupportedFormats()
+	if len(formats) != 3 {
+		t.Fatalf("Expected 3 formats, got %v", formats)
+	}
+
+	// Every supported format round-trips through its extension
+	for _, f := range formats {
+		got, err := FormatFromExtension(f.Extension())
+		if err != nil || got != f {
+			t.Errorf("FormatFromExtension(%q) = %q, %v; expected %q", f.Extension(), got, err, f)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package imagery
+
+import (
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io"
+	"math"
+)
+
+// JPEGOptions control how JPEG tiles are encoded. The zero value encodes at
+// DefaultJPEGQuality with 4:2:0 chroma subsampling, baseline.
+type JPEGOptions struct {
+	Quality int // 1-100; zero means DefaultJPEGQuality
+
+	// FullChroma keeps color at full resolution (4:4:4) so coastlines and
+	// labels stay crisp, and Progressive writes progressive scans, which are
+	// usually smaller. Both need a build with libjpeg (see JPEGExtended) and
+	// are ignored otherwise.
+	FullChroma  bool
+	Progressive bool
+}
+
+// JPEGExtended reports whether this binary encodes JPEG with libjpeg, which
+// honors JPEGOptions.FullChroma and Progressive. It is true for builds with
+// the "libjpeg" build tag and cgo enabled, which link against libjpeg(-turbo).
+const JPEGExtended = jpegExtended
+
+// Validate checks that the options are in range
+func (o JPEGOptions) Validate() error {
+	if o.Quality < 0 || o.Quality > 100 {
+		return fmt.Errorf("JPEG quality must be in range [1, 100], got %d", o.Quality)
+	}
+	return nil
+}
+
+// quality returns the effective quality
+func (o JPEGOptions) quality() int {
+	if o.Quality == 0 {
+		return DefaultJPEGQuality
+	}
+	return o.Quality
+}
+
+// adaptiveFullDetail is the luma standard deviation at and above which
+// AdaptiveQuality encodes a tile at its maximum quality
+const adaptiveFullDetail = 32.0
+
+// AdaptiveQuality chooses the quality of each JPEG tile between Min and Max
+// from how much detail the tile has: flat tiles such as open ocean are
+// encoded at Min, busy ones such as coastlines at up to Max. The zero value
+// disables it.
+type AdaptiveQuality struct {
+	Min int // 1-100
+	Max int // Min-100
+}
+
+// Enabled reports whether qualities are chosen per tile
+func (a AdaptiveQuality) Enabled() bool {
+	return a != AdaptiveQuality{}
+}
+
+// Validate checks that the bounds are in range and ordered
+func (a AdaptiveQuality) Validate() error {
+	if !a.Enabled() {
+		return nil
+	}
+	if a.Min < 1 || a.Max > 100 || a.Min > a.Max {
+		return fmt.Errorf("adaptive JPEG quality must satisfy 1 <= min <= max <= 100, got %d-%d", a.Min, a.Max)
+	}
+	return nil
+}
+
+// Quality returns the quality for a tile with the given stats, rising
+// linearly with the standard deviation of its luma
+func (a AdaptiveQuality) Quality(s TileStats) int {
+	detail := min(math.Sqrt(s.Variance)/adaptiveFullDetail, 1)
+	return a.Min + int(math.Round(detail*float64(a.Max-a.Min)))
+}
+
+// EncodeJPEG writes img to w as a JPEG. Without libjpeg, FullChroma and
+// Progressive are ignored and the standard library encoder is used.
+func EncodeJPEG(w io.Writer, img image.Image, o JPEGOptions) error {
+	if JPEGExtended && (o.FullChroma || o.Progressive) {
+		return encodeLibJPEG(w, img, o)
+	}
+	return jpeg.Encode(w, img, &jpeg.Options{Quality: o.quality()})
+}
@@ -0,0 +1,135 @@
+//go:build cgo && libjpeg
+
+package imagery
+
+/*
+#cgo LDFLAGS: -ljpeg
+#include <setjmp.h>
+#include <stdio.h>
+#include <stdlib.h>
+#include <jpeglib.h>
+
+struct xyz_error_mgr {
+	struct jpeg_error_mgr pub;
+	jmp_buf jmp;
+};
+
+static void xyz_error_exit(j_common_ptr cinfo) {
+	longjmp(((struct xyz_error_mgr *)cinfo->err)->jmp, 1);
+}
+
+// xyz_encode_rgb compresses a packed RGB image into a malloc'd buffer the
+// caller frees. On failure it returns 0 and writes a message to errbuf.
+static int xyz_encode_rgb(unsigned char *pix, int width, int height, int quality,
+		int full_chroma, int progressive,
+		unsigned char **out, unsigned long *outsize, char *errbuf) {
+	struct jpeg_compress_struct cinfo;
+	struct xyz_error_mgr jerr;
+
+	*out = NULL;
+	*outsize = 0;
+	cinfo.err = jpeg_std_error(&jerr.pub);
+	jerr.pub.error_exit = xyz_error_exit;
+	if (setjmp(jerr.jmp)) {
+		(*cinfo.err->format_message)((j_common_ptr)&cinfo, errbuf);
+		jpeg_destroy_compress(&cinfo);
+		free(*out);
+		*out = NULL;
+		return 0;
+	}
+
+	jpeg_create_compress(&cinfo);
+	jpeg_mem_dest(&cinfo, out, outsize);
+	cinfo.image_width = width;
+	cinfo.image_height = height;
+	cinfo.input_components = 3;
+	cinfo.in_color_space = JCS_RGB;
+	jpeg_set_defaults(&cinfo);
+	jpeg_set_quality(&cinfo, quality, TRUE);
+	cinfo.optimize_coding = TRUE;
+	if (full_chroma) {
+		cinfo.comp_info[0].h_samp_factor = 1;
+		cinfo.comp_info[0].v_samp_factor = 1;
+	}
+	if (progressive) {
+		jpeg_simple_progression(&cinfo);
+	}
+
+	jpeg_start_compress(&cinfo, TRUE);
+	while (cinfo.next_scanline < cinfo.image_height) {
+		JSAMPROW row = pix + (size_t)cinfo.next_scanline * width * 3;
+		jpeg_write_scanlines(&cinfo, &row, 1);
+	}
+	jpeg_finish_compress(&cinfo);
+	jpeg_destroy_compress(&cinfo);
+	return 1;
+}
+*/
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"unsafe"
+)
+
+const jpegExtended = true
+
+// encodeLibJPEG encodes img with libjpeg, honoring every JPEGOptions field.
+// Alpha is dropped, as with image/jpeg.
+func encodeLibJPEG(w io.Writer, img image.Image, o JPEGOptions) error {
+	b := img.Bounds()
+	if b.Empty() {
+		return errors.New("cannot encode an empty image as JPEG")
+	}
+	pix := C.malloc(C.size_t(b.Dx() * b.Dy() * 3))
+	defer C.free(pix)
+	packRGB(unsafe.Slice((*byte)(pix), b.Dx()*b.Dy()*3), img)
+
+	var out *C.uchar
+	var size C.ulong
+	var errbuf [C.JMSG_LENGTH_MAX]C.char
+	ok := C.xyz_encode_rgb((*C.uchar)(pix), C.int(b.Dx()), C.int(b.Dy()), C.int(o.quality()),
+		cBool(o.FullChroma), cBool(o.Progressive), &out, &size, &errbuf[0])
+	if ok == 0 {
+		return fmt.Errorf("libjpeg: %s", C.GoString(&errbuf[0]))
+	}
+	defer C.free(unsafe.Pointer(out))
+
+	_, err := w.Write(unsafe.Slice((*byte)(out), int(size)))
+	return err
+}
+
+// packRGB writes img's pixels to dst as packed 8-bit RGB rows
+func packRGB(dst []byte, img image.Image) {
+	b := img.Bounds()
+	i := 0
+	if rgba, ok := img.(*image.RGBA); ok {
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			row := rgba.Pix[rgba.PixOffset(b.Min.X, y):]
+			for x := 0; x < b.Dx(); x++ {
+				copy(dst[i:i+3], row[x*4:x*4+3])
+				i += 3
+			}
+		}
+		return
+	}
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := color.RGBAModel.Convert(img.At(x, y)).(color.RGBA)
+			dst[i], dst[i+1], dst[i+2] = c.R, c.G, c.B
+			i += 3
+		}
+	}
+}
+
+// cBool converts b to a C int flag
+func cBool(b bool) C.int {
+	if b {
+		return 1
+	}
+	return 0
+}
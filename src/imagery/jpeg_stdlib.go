@@ -0,0 +1,16 @@
+//go:build !cgo || !libjpeg
+
+package imagery
+
+import (
+	"errors"
+	"image"
+	"io"
+)
+
+const jpegExtended = false
+
+// encodeLibJPEG is never called without libjpeg
+func encodeLibJPEG(io.Writer, image.Image, JPEGOptions) error {
+	return errors.New("built without libjpeg")
+}
@@ -0,0 +1,173 @@
+package imagery
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"math/rand/v2"
+	"testing"
+)
+
+func TestEncodeJPEG(t *testing.T) {
+	tests := []struct {
+		opts       JPEGOptions
+		size       image.Point
+		expect444  bool // Only with JPEGExtended
+		expectProg bool // Only with JPEGExtended
+		name       string
+	}{
+		{JPEGOptions{}, image.Pt(TileSize, TileSize), false, false, "defaults"},
+		{JPEGOptions{Quality: 40}, image.Pt(TileSize, TileSize), false, false, "low quality"},
+		{JPEGOptions{FullChroma: true}, image.Pt(TileSize, TileSize), true, false, "full chroma"},
+		{JPEGOptions{Progressive: true}, image.Pt(TileSize, TileSize), false, true, "progressive"},
+		{JPEGOptions{FullChroma: true, Progressive: true, Quality: 75}, image.Pt(TileSize+16, TileSize+16), true, true, "buffered tile"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img := image.NewRGBA(image.Rectangle{Max: tt.size})
+			for y := range tt.size.Y {
+				for x := range tt.size.X {
+					img.Set(x, y, color.RGBA{uint8(x), uint8(y), uint8(x ^ y), 255})
+				}
+			}
+
+			var buf bytes.Buffer
+			if err := EncodeJPEG(&buf, img, tt.opts); err != nil {
+				t.Fatalf("EncodeJPEG() failed: %v", err)
+			}
+			data := buf.Bytes()
+
+			decoded, err := jpeg.Decode(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("Failed to decode JPEG: %v", err)
+			}
+			if got := decoded.Bounds().Size(); got != tt.size {
+				t.Errorf("Expected %v, got %v", tt.size, got)
+			}
+
+			ycc, ok := decoded.(*image.YCbCr)
+			if !ok {
+				t.Fatalf("Expected a YCbCr image, got %T", decoded)
+			}
+			expectRatio := image.YCbCrSubsampleRatio420
+			if tt.expect444 && JPEGExtended {
+				expectRatio = image.YCbCrSubsampleRatio444
+			}
+			if ycc.SubsampleRatio != expectRatio {
+				t.Errorf("Expected subsampling %v, got %v", expectRatio, ycc.SubsampleRatio)
+			}
+
+			// SOF2 starts a progressive frame
+			if isProg := bytes.Contains(data, []byte{0xFF, 0xC2}); isProg != (tt.expectProg && JPEGExtended) {
+				t.Errorf("Expected progressive: %v, got %v", tt.expectProg && JPEGExtended, isProg)
+			}
+		})
+	}
+}
+
+func TestJPEGOptions_Validate(t *testing.T) {
+	tests := []struct {
+		quality     int
+		expectError bool
+		name        string
+	}{
+		{0, false, "default"},
+		{1, false, "lowest"},
+		{100, false, "highest"},
+		{-1, true, "negative"},
+		{101, true, "too high"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := JPEGOptions{Quality: tt.quality}.Validate()
+			if (err != nil) != tt.expectError {
+				t.Errorf("Validate() error = %v, expected error: %v", err, tt.expectError)
+			}
+		})
+	}
+}
+
+func TestAdaptiveQuality(t *testing.T) {
+	a := AdaptiveQuality{Min: 60, Max: 90}
+
+	tests := []struct {
+		variance float64
+		expect   int
+		name     string
+	}{
+		{0, 60, "flat"},
+		{16 * 16, 75, "half detail"},
+		{32 * 32, 90, "full detail"},
+		{100 * 100, 90, "capped"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := a.Quality(TileStats{Variance: tt.variance}); got != tt.expect {
+				t.Errorf("Quality() = %d, expected %d", got, tt.expect)
+			}
+		})
+	}
+}
+
+func TestAdaptiveQuality_Validate(t *testing.T) {
+	tests := []struct {
+		a           AdaptiveQuality
+		expectError bool
+		name        string
+	}{
+		{AdaptiveQuality{}, false, "disabled"},
+		{AdaptiveQuality{60, 90}, false, "range"},
+		{AdaptiveQuality{75, 75}, false, "single quality"},
+		{AdaptiveQuality{0, 90}, true, "min too low"},
+		{AdaptiveQuality{60, 101}, true, "max too high"},
+		{AdaptiveQuality{90, 60}, true, "reversed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.a.Validate()
+			if (err != nil) != tt.expectError {
+				t.Errorf("Validate() error = %v, expected error: %v", err, tt.expectError)
+			}
+		})
+	}
+}
+
+func TestEncoder_AdaptiveQuality(t *testing.T) {
+	// A faint gradient like open ocean, and noise busier than any coastline
+	flat := image.NewRGBA(image.Rect(0, 0, TileSize, TileSize))
+	busy := image.NewRGBA(image.Rect(0, 0, TileSize, TileSize))
+	rng := rand.New(rand.NewPCG(1, 2))
+	for y := range TileSize {
+		for x := range TileSize {
+			v := uint8(100 + x/32)
+			flat.SetRGBA(x, y, color.RGBA{v, v, v + 40, 255})
+			busy.SetRGBA(x, y, color.RGBA{uint8(rng.IntN(256)), uint8(rng.IntN(256)), uint8(rng.IntN(256)), 255})
+		}
+	}
+
+	encode := func(e Encoder, img image.Image) int {
+		var buf bytes.Buffer
+		if err := e.Encode(&buf, img, FormatJPEG); err != nil {
+			t.Fatalf("Encode() failed: %v", err)
+		}
+		return buf.Len()
+	}
+	adaptive := Encoder{Adaptive: AdaptiveQuality{Min: 40, Max: 90}}
+	fixed := Encoder{JPEG: JPEGOptions{Quality: 90}}
+
+	flatSize, busySize := encode(adaptive, flat), encode(adaptive, busy)
+	if flatSize >= busySize {
+		t.Errorf("Expected the flat tile to encode smaller than the busy one, got %d and %d bytes", flatSize, busySize)
+	}
+	if fixedSize := encode(fixed, flat); flatSize >= fixedSize {
+		t.Errorf("Expected the flat tile to encode smaller than at quality 90, got %d and %d bytes", flatSize, fixedSize)
+	}
+	if fixedSize := encode(fixed, busy); busySize != fixedSize {
+		t.Errorf("Expected the busy tile to encode at quality 90 (%d bytes), got %d bytes", fixedSize, busySize)
+	}
+}
@@ -0,0 +1,143 @@
+package imagery
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	xdraw "golang.org/x/image/draw"
+
+	"org.xyzmaps.xyztiles/src/tilemath"
+)
+
+// Kernel names an interpolation kernel tiles are resampled with
+type Kernel string
+
+// Supported kernels, from fastest to sharpest
+const (
+	KernelNearest        Kernel = "nearest"
+	KernelApproxBiLinear Kernel = "approxbilinear"
+	KernelBiLinear       Kernel = "bilinear"
+	KernelCatmullRom     Kernel = "catmullrom"
+)
+
+// ResampleKernel is the kernel tiles are resampled with when no KernelTable
+// rule applies
+const ResampleKernel = KernelCatmullRom
+
+// interpolator returns the x/image/draw implementation of k
+func (k Kernel) interpolator() (xdraw.Interpolator, bool) {
+	switch k {
+	case KernelNearest:
+		return xdraw.NearestNeighbor, true
+	case KernelApproxBiLinear:
+		return xdraw.ApproxBiLinear, true
+	case KernelBiLinear:
+		return xdraw.BiLinear, true
+	case KernelCatmullRom:
+		return xdraw.CatmullRom, true
+	}
+	return nil, false
+}
+
+// KernelRule selects Kernel for zooms MinZoom through MaxZoom. With Overzoom
+// set the range counts levels past the base map's native max zoom instead,
+// 1 being the first level beyond it.
+type KernelRule struct {
+	MinZoom  int
+	MaxZoom  int
+	Overzoom bool
+	Kernel   Kernel
+}
+
+// matches reports whether the rule applies to zoom z of a base map whose
+// native max zoom is nativeMaxZoom
+func (r KernelRule) matches(z, nativeMaxZoom int) bool {
+	if r.Overzoom {
+		z -= nativeMaxZoom
+	}
+	return z >= r.MinZoom && z <= r.MaxZoom
+}
+
+// KernelTable picks the kernel a tile is resampled with from its zoom. The
+// first matching rule wins; zooms no rule matches use ResampleKernel.
+type KernelTable []KernelRule
+
+// Kernel returns the kernel for zoom z of a base map whose native max zoom
+// is nativeMaxZoom
+func (t KernelTable) Kernel(z, nativeMaxZoom int) Kernel {
+	for _, r := range t {
+		if r.matches(z, nativeMaxZoom) {
+			return r.Kernel
+		}
+	}
+	return ResampleKernel
+}
+
+// Validate reports a rule with an unknown kernel or an empty zoom range
+func (t KernelTable) Validate() error {
+	for _, r := range t {
+		if _, ok := r.Kernel.interpolator(); !ok {
+			return fmt.Errorf("unknown interpolation kernel %q (expected nearest, approxbilinear, bilinear or catmullrom)", r.Kernel)
+		}
+		if r.MinZoom > r.MaxZoom {
+			return fmt.Errorf("invalid zoom range %d-%d for kernel %s", r.MinZoom, r.MaxZoom, r.Kernel)
+		}
+	}
+	return nil
+}
+
+// ParseKernelTable parses comma-separated RANGE=KERNEL rules, such as
+// "0-3=catmullrom,+1-=approxbilinear". A range is a zoom ("5"), an inclusive
+// span ("0-3") or an open one ("4-"); a leading "+" counts levels past the
+// native max zoom.
+func ParseKernelTable(s string) (KernelTable, error) {
+	var table KernelTable
+	for _, entry := range strings.Split(s, ",") {
+		zooms, kernel, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid rule %q: expected RANGE=KERNEL", entry)
+		}
+		r := KernelRule{Kernel: Kernel(strings.ToLower(kernel))}
+		zooms, r.Overzoom = strings.CutPrefix(zooms, "+")
+
+		lo, hi, span := strings.Cut(zooms, "-")
+		var err error
+		if r.MinZoom, err = strconv.Atoi(lo); err != nil {
+			return nil, fmt.Errorf("invalid zoom range %q", zooms)
+		}
+		switch {
+		case !span:
+			r.MaxZoom = r.MinZoom
+		case hi == "":
+			r.MaxZoom = tilemath.MaxZoom
+		default:
+			if r.MaxZoom, err = strconv.Atoi(hi); err != nil {
+				return nil, fmt.Errorf("invalid zoom range %q", zooms)
+			}
+		}
+		table = append(table, r)
+	}
+	return table, table.Validate()
+}
+
+// String formats the table in the form ParseKernelTable accepts
+func (t KernelTable) String() string {
+	rules := make([]string, len(t))
+	for i, r := range t {
+		var zooms string
+		switch {
+		case r.MinZoom == r.MaxZoom:
+			zooms = strconv.Itoa(r.MinZoom)
+		case r.MaxZoom >= tilemath.MaxZoom:
+			zooms = strconv.Itoa(r.MinZoom) + "-"
+		default:
+			zooms = strconv.Itoa(r.MinZoom) + "-" + strconv.Itoa(r.MaxZoom)
+		}
+		if r.Overzoom {
+			zooms = "+" + zooms
+		}
+		rules[i] = zooms + "=" + string(r.Kernel)
+	}
+	return strings.Join(rules, ",")
+}
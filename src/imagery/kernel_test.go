@@ -0,0 +1,133 @@
+package imagery
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"testing"
+
+	"org.xyzmaps.xyztiles/src/tilemath"
+)
+
+func TestKernelTable_Kernel(t *testing.T) {
+	table := KernelTable{
+		{MinZoom: 0, MaxZoom: 3, Kernel: KernelCatmullRom},
+		{MinZoom: 1, MaxZoom: tilemath.MaxZoom, Overzoom: true, Kernel: KernelApproxBiLinear},
+		{MinZoom: 4, MaxZoom: 6, Kernel: KernelBiLinear},
+	}
+
+	tests := []struct {
+		table         KernelTable
+		z             int
+		nativeMaxZoom int
+		expected      Kernel
+		name          string
+	}{
+		{nil, 5, 3, KernelCatmullRom, "no table"},
+		{table, 0, 5, KernelCatmullRom, "low zoom"},
+		{table, 3, 5, KernelCatmullRom, "end of range"},
+		{table, 4, 5, KernelBiLinear, "below native"},
+		{table, 5, 5, KernelBiLinear, "native zoom"},
+		{table, 6, 5, KernelApproxBiLinear, "first level past native"},
+		{table, 12, 5, KernelApproxBiLinear, "far past native"},
+		{table, 7, 8, KernelCatmullRom, "no rule matches"},
+		{table, 2, 1, KernelCatmullRom, "first rule wins"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.table.Kernel(tt.z, tt.nativeMaxZoom); got != tt.expected {
+				t.Errorf("Expected %s at zoom %d (native %d), got %s", tt.expected, tt.z, tt.nativeMaxZoom, got)
+			}
+		})
+	}
+}
+
+func TestParseKernelTable(t *testing.T) {
+	tests := []struct {
+		input       string
+		expected    KernelTable
+		expectError bool
+		name        string
+	}{
+		{"0-3=catmullrom", KernelTable{{0, 3, false, KernelCatmullRom}}, false, "span"},
+		{"5=Nearest", KernelTable{{5, 5, false, KernelNearest}}, false, "single zoom, any case"},
+		{"4-=bilinear", KernelTable{{4, tilemath.MaxZoom, false, KernelBiLinear}}, false, "open span"},
+		{"0-3=catmullrom, +1-=approxbilinear", KernelTable{
+			{0, 3, false, KernelCatmullRom},
+			{1, tilemath.MaxZoom, true, KernelApproxBiLinear},
+		}, false, "past native"},
+		{"0-3", nil, true, "no kernel"},
+		{"0-3=lanczos", nil, true, "unknown kernel"},
+		{"3-1=bilinear", nil, true, "empty range"},
+		{"a-3=bilinear", nil, true, "not a zoom"},
+		{"", nil, true, "empty"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseKernelTable(tt.input)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Expected error for %q, got %v", tt.input, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseKernelTable(%q) failed: %v", tt.input, err)
+			}
+			if len(got) != len(tt.expected) {
+				t.Fatalf("Expected %v, got %v", tt.expected, got)
+			}
+			for i := range got {
+				if got[i] != tt.expected[i] {
+					t.Errorf("Expected rule %d to be %+v, got %+v", i, tt.expected[i], got[i])
+				}
+			}
+
+			again, err := ParseKernelTable(got.String())
+			if err != nil || again.String() != got.String() {
+				t.Errorf("Expected %q to round-trip, got %q (%v)", got.String(), again.String(), err)
+			}
+		})
+	}
+}
+
+func TestExtractTileWithOptions_Kernels(t *testing.T) {
+	// Black and white stripes one source pixel wide; native max zoom is 1
+	img := image.NewRGBA(image.Rect(0, 0, 1024, 512))
+	for y := range 512 {
+		for x := 0; x < 1024; x += 2 {
+			img.SetRGBA(x, y, color.RGBA{255, 255, 255, 255})
+			img.SetRGBA(x+1, y, color.RGBA{0, 0, 0, 255})
+		}
+	}
+	bm := NewBaseMap(img)
+
+	// Upscaled past native zoom, nearest neighbor copies source pixels while
+	// CatmullRom blends the stripes into grays
+	grays := func(kernels KernelTable) int {
+		t.Helper()
+		tile, err := bm.ExtractTileWithOptions(context.Background(), 4, 0, 7, TileOptions{Kernels: kernels})
+		if err != nil {
+			t.Fatalf("ExtractTileWithOptions() failed: %v", err)
+		}
+		n := 0
+		for x := range TileSize {
+			if v := tile.RGBAAt(x, TileSize/2).R; v != 0 && v != 255 {
+				n++
+			}
+		}
+		return n
+	}
+
+	if n := grays(KernelTable{{MinZoom: 1, MaxZoom: tilemath.MaxZoom, Overzoom: true, Kernel: KernelNearest}}); n != 0 {
+		t.Errorf("Expected nearest neighbor past native zoom to keep source colors, got %d gray pixels", n)
+	}
+	if n := grays(KernelTable{{MinZoom: 0, MaxZoom: 1, Kernel: KernelNearest}}); n == 0 {
+		t.Error("Expected CatmullRom where no rule matches to blend the stripes")
+	}
+	if _, err := bm.ExtractTileWithOptions(context.Background(), 0, 0, 0, TileOptions{Kernels: KernelTable{{Kernel: "lanczos"}}}); err == nil {
+		t.Error("Expected an unknown kernel to fail")
+	}
+}
@@ -0,0 +1,211 @@
+package imagery
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/jpeg" // register JPEG decoder
+	_ "image/png"  // register PNG decoder
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"org.xyzmaps.xyztiles/src/tilemath"
+)
+
+// ErrImageTooLarge is returned when a source image exceeds LoadOptions.MaxPixels
+var ErrImageTooLarge = errors.New("image exceeds pixel limit")
+
+// LoadOptions controls how source images are loaded
+type LoadOptions struct {
+	// MaxPixels rejects images whose width*height exceeds this limit.
+	// Dimensions are read from the image header before any pixel data is
+	// decoded, so oversized images are refused without allocating for them.
+	// Zero means no limit.
+	MaxPixels int64
+
+	// FlipVertical mirrors the image top-to-bottom after decoding, for
+	// exports that put north at the bottom
+	FlipVertical bool
+
+	// FlipHorizontal mirrors the image left-to-right after decoding
+	FlipHorizontal bool
+
+	// SourceBounds is the extent the image covers from its outer pixel
+	// edges, overriding WorldBounds. Imagery registered on pixel centers
+	// reaches half a pixel past ±180/±90; setting its true extent removes
+	// the sub-pixel shift that assuming WorldBounds causes. Nil assumes
+	// WorldBounds.
+	SourceBounds *tilemath.Bounds
+}
+
+// ImageInfo describes a source image as read from its header
+type ImageInfo struct {
+	Width  int
+	Height int
+	Format string // Decoder name, e.g. "jpeg" or "png"
+}
+
+// ReadImageInfo reads the dimensions and format of the image at path
+// without decoding its pixel data
+func ReadImageInfo(path string) (ImageInfo, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return ImageInfo{}, fmt.Errorf("failed to open image: %w", err)
+	}
+	defer f.Close()
+
+	return readImageInfo(f)
+}
+
+// ReadImageInfoFromBytes reads the dimensions and format of an in-memory
+// image without decoding its pixel data
+func ReadImageInfoFromBytes(data []byte) (ImageInfo, error) {
+	return readImageInfo(bytes.NewReader(data))
+}
+
+// readImageInfo decodes only the image header from r
+func readImageInfo(r io.Reader) (ImageInfo, error) {
+	cfg, format, err := image.DecodeConfig(r)
+	if err != nil {
+		return ImageInfo{}, fmt.Errorf("failed to read image header: %w", err)
+	}
+	return ImageInfo{Width: cfg.Width, Height: cfg.Height, Format: format}, nil
+}
+
+// LoadImage loads a JPEG or PNG image from the given file path.
+// The image is expected to be in equirectangular projection (EPSG:4326)
+// covering the full world extent (-180, -90, 180, 90).
+func LoadImage(path string, opts LoadOptions) (*BaseMap, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open image: %w", err)
+	}
+	defer f.Close()
+
+	return decodeImage(f, opts)
+}
+
+// LoadImageFromBytes loads a JPEG or PNG image from a byte slice (e.g., embedded resource).
+// The image is expected to be in equirectangular projection (EPSG:4326)
+// covering the full world extent (-180, -90, 180, 90).
+func LoadImageFromBytes(data []byte, opts LoadOptions) (*BaseMap, error) {
+	return decodeImage(bytes.NewReader(data), opts)
+}
+
+// decodeImage checks the image dimensions against opts, then decodes it fully
+func decodeImage(r io.ReadSeeker, opts LoadOptions) (*BaseMap, error) {
+	if opts.MaxPixels > 0 {
+		info, err := readImageInfo(r)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkPixelLimit(info.Width, info.Height, opts.MaxPixels); err != nil {
+			return nil, err
+		}
+		if _, err := r.Seek(0, io.SeekStart); err != nil {
+			return nil, fmt.Errorf("failed to rewind image: %w", err)
+		}
+	}
+
+	img, format, err := image.Decode(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+
+	orientation := 1
+	if format == "jpeg" {
+		if _, err := r.Seek(0, io.SeekStart); err != nil {
+			return nil, fmt.Errorf("failed to rewind image: %w", err)
+		}
+		img, orientation = applyEXIFOrientation(r, img)
+	}
+
+	if opts.MaxPixels > 0 {
+		b := img.Bounds()
+		if err := checkPixelLimit(b.Dx(), b.Dy(), opts.MaxPixels); err != nil {
+			return nil, err
+		}
+	}
+
+	bm := NewBaseMap(flipImage(img, opts.FlipVertical, opts.FlipHorizontal))
+	bm.orientation = orientation
+	if opts.SourceBounds != nil {
+		if err := bm.SetSourceBounds(*opts.SourceBounds); err != nil {
+			return nil, err
+		}
+	}
+	return bm, nil
+}
+
+// applyEXIFOrientation rotates or mirrors img, decoded from the JPEG stream
+// in r, according to its EXIF orientation tag and returns the upright image
+// with the orientation that was applied. Missing or unreadable EXIF data
+// leaves img unchanged, since the pixel data itself decoded fine.
+func applyEXIFOrientation(r io.Reader, img image.Image) (image.Image, int) {
+	orientation, err := readJPEGOrientation(r)
+	if err != nil {
+		return img, 1
+	}
+	return orientImage(img, orientation), orientation
+}
+
+// checkPixelLimit returns ErrImageTooLarge if width*height exceeds maxPixels
+func checkPixelLimit(width, height int, maxPixels int64) error {
+	pixels := int64(width) * int64(height)
+	if pixels > maxPixels {
+		return fmt.Errorf("%w: %dx%d is %d pixels, limit is %d", ErrImageTooLarge, width, height, pixels, maxPixels)
+	}
+	return nil
+}
+
+// SetSourceBounds sets the extent the image covers from its outer pixel
+// edges, in place of WorldBounds. Unlike a tile bounding box, the edges may
+// lie slightly beyond ±180/±90, but west must be less than east and south
+// less than north.
+func (bm *BaseMap) SetSourceBounds(b tilemath.Bounds) error {
+	if err := validateSourceBounds(b); err != nil {
+		return err
+	}
+	bm.extent = b
+	return nil
+}
+
+// validateSourceBounds checks that b has finite edges in the right order
+func validateSourceBounds(b tilemath.Bounds) error {
+	for _, v := range []float64{b.West, b.South, b.East, b.North} {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return fmt.Errorf("invalid source bounds %s: edges must be finite", b)
+		}
+	}
+	if b.West >= b.East || b.South >= b.North {
+		return fmt.Errorf("invalid source bounds %s: expected west < east and south < north", b)
+	}
+	return nil
+}
+
+// ParseSourceBounds parses a source extent given as "west,south,east,north"
+// in decimal degrees, e.g. "-180.0042,-90.0042,179.9958,89.9958"
+func ParseSourceBounds(s string) (tilemath.Bounds, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 4 {
+		return tilemath.Bounds{}, fmt.Errorf("source bounds must be west,south,east,north, got %q", s)
+	}
+
+	var v [4]float64
+	for i, p := range parts {
+		f, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil {
+			return tilemath.Bounds{}, fmt.Errorf("invalid source bounds value %q", p)
+		}
+		v[i] = f
+	}
+	b := tilemath.Bounds{West: v[0], South: v[1], East: v[2], North: v[3]}
+	if err := validateSourceBounds(b); err != nil {
+		return tilemath.Bounds{}, err
+	}
+	return b, nil
+}
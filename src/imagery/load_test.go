@@ -0,0 +1,328 @@
+package imagery
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"org.xyzmaps.xyztiles/src/tilemath"
+)
+
+func TestLoadImage_JPEGAndPNG(t *testing.T) {
+	src := createTestImage(120, 60)
+	dir := t.TempDir()
+
+	jpegPath := filepath.Join(dir, "world.jpg")
+	f, err := os.Create(jpegPath)
+	if err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	jpeg.Encode(f, src, nil)
+	f.Close()
+
+	pngPath := filepath.Join(dir, "world.png")
+	f, err = os.Create(pngPath)
+	if err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	png.Encode(f, src)
+	f.Close()
+
+	for _, path := range []string{jpegPath, pngPath} {
+		basemap, err := LoadImage(path, LoadOptions{})
+		if err != nil {
+			t.Fatalf("LoadImage(%s) failed: %v", path, err)
+		}
+		if basemap.Width() != 120 || basemap.Height() != 60 {
+			t.Errorf("Expected 120x60, got %dx%d", basemap.Width(), basemap.Height())
+		}
+	}
+}
+
+func TestLoadImage_MaxPixels(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, createTestImage(100, 50)); err != nil {
+		t.Fatalf("Failed to encode PNG: %v", err)
+	}
+
+	tests := []struct {
+		maxPixels   int64
+		expectError bool
+		name        string
+	}{
+		{0, false, "no limit"},
+		{5000, false, "exactly at limit"},
+		{10000, false, "under limit"},
+		{4999, true, "one pixel over limit"},
+		{100, true, "far over limit"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadImageFromBytes(buf.Bytes(), LoadOptions{MaxPixels: tt.maxPixels})
+
+			if tt.expectError {
+				if !errors.Is(err, ErrImageTooLarge) {
+					t.Errorf("Expected ErrImageTooLarge, got %v", err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		})
+	}
+
+	// The file-based loader applies the same limit
+	path := filepath.Join(t.TempDir(), "big.png")
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if _, err := LoadImage(path, LoadOptions{MaxPixels: 100}); !errors.Is(err, ErrImageTooLarge) {
+		t.Errorf("Expected ErrImageTooLarge from LoadImage, got %v", err)
+	}
+}
+
+func TestLoadImage_FlipVertical(t *testing.T) {
+	// North (top half) red, south (bottom half) blue
+	src := image.NewRGBA(image.Rect(0, 0, 512, 256))
+	red := color.RGBA{255, 0, 0, 255}
+	blue := color.RGBA{0, 0, 255, 255}
+	draw.Draw(src, image.Rect(0, 0, 512, 128), &image.Uniform{red}, image.Point{}, draw.Src)
+	draw.Draw(src, image.Rect(0, 128, 512, 256), &image.Uniform{blue}, image.Point{}, draw.Src)
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, src); err != nil {
+		t.Fatalf("Failed to encode PNG: %v", err)
+	}
+
+	tests := []struct {
+		flip   bool
+		top    color.RGBA
+		bottom color.RGBA
+		name   string
+	}{
+		{false, red, blue, "as stored"},
+		{true, blue, red, "flipped"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			basemap, err := LoadImageFromBytes(buf.Bytes(), LoadOptions{FlipVertical: tt.flip})
+			if err != nil {
+				t.Fatalf("LoadImageFromBytes failed: %v", err)
+			}
+			tile, err := basemap.ExtractTile(0, 0, 0)
+			if err != nil {
+				t.Fatalf("ExtractTile failed: %v", err)
+			}
+			if got := tile.RGBAAt(TileSize/2, 0); got != tt.top {
+				t.Errorf("Expected top row %v, got %v", tt.top, got)
+			}
+			if got := tile.RGBAAt(TileSize/2, TileSize-1); got != tt.bottom {
+				t.Errorf("Expected bottom row %v, got %v", tt.bottom, got)
+			}
+		})
+	}
+}
+
+func TestLoadImage_EXIFOrientation(t *testing.T) {
+	// Stored upside down: south (blue) on top
+	src := image.NewRGBA(image.Rect(0, 0, 64, 32))
+	red := color.RGBA{255, 0, 0, 255}
+	blue := color.RGBA{0, 0, 255, 255}
+	draw.Draw(src, image.Rect(0, 0, 64, 16), &image.Uniform{blue}, image.Point{}, draw.Src)
+	draw.Draw(src, image.Rect(0, 16, 64, 32), &image.Uniform{red}, image.Point{}, draw.Src)
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, src, &jpeg.Options{Quality: 95}); err != nil {
+		t.Fatalf("Failed to encode JPEG: %v", err)
+	}
+	data := withEXIFOrientation(buf.Bytes(), 3, binary.BigEndian)
+
+	path := filepath.Join(t.TempDir(), "rotated.jpg")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatalf("Failed to write JPEG: %v", err)
+	}
+
+	loaders := []struct {
+		load func() (*BaseMap, error)
+		name string
+	}{
+		{func() (*BaseMap, error) { return LoadImage(path, LoadOptions{}) }, "LoadImage"},
+		{func() (*BaseMap, error) { return LoadImageFromBytes(data, LoadOptions{}) }, "LoadImageFromBytes"},
+		{func() (*BaseMap, error) { return LoadJPEG(path) }, "LoadJPEG"},
+		{func() (*BaseMap, error) { return LoadJPEGFromBytes(data) }, "LoadJPEGFromBytes"},
+	}
+
+	for _, l := range loaders {
+		t.Run(l.name, func(t *testing.T) {
+			basemap, err := l.load()
+			if err != nil {
+				t.Fatalf("Load failed: %v", err)
+			}
+			if basemap.Orientation() != 3 {
+				t.Errorf("Expected orientation 3, got %d", basemap.Orientation())
+			}
+
+			// Corrected: north (red) on top
+			top := color.RGBAModel.Convert(basemap.img.At(32, 2)).(color.RGBA)
+			bottom := color.RGBAModel.Convert(basemap.img.At(32, 29)).(color.RGBA)
+			if top.R < 200 || top.B > 55 {
+				t.Errorf("Expected red top row after correction, got %v", top)
+			}
+			if bottom.B < 200 || bottom.R > 55 {
+				t.Errorf("Expected blue bottom row after correction, got %v", bottom)
+			}
+		})
+	}
+}
+
+func TestLoadImage_Invalid(t *testing.T) {
+	if _, err := LoadImage("/nonexistent/path/image.png", LoadOptions{}); err == nil {
+		t.Error("Expected error for nonexistent file, got nil")
+	}
+
+	if _, err := LoadImageFromBytes([]byte("not an image"), LoadOptions{}); err == nil {
+		t.Error("Expected error for invalid data, got nil")
+	}
+
+	if _, err := LoadImageFromBytes([]byte("not an image"), LoadOptions{MaxPixels: 100}); err == nil {
+		t.Error("Expected error for invalid data with a pixel limit, got nil")
+	}
+}
+
+func TestReadImageInfo(t *testing.T) {
+	imagePath := "../../res/world.topo.200407.3x5400x2700.jpg"
+	if _, err := os.Stat(imagePath); os.IsNotExist(err) {
+		t.Skip("Test image not found, skipping test")
+	}
+
+	info, err := ReadImageInfo(imagePath)
+	if err != nil {
+		t.Fatalf("ReadImageInfo() failed: %v", err)
+	}
+
+	basemap, err := LoadImage(imagePath, LoadOptions{})
+	if err != nil {
+		t.Fatalf("LoadImage() failed: %v", err)
+	}
+
+	if info.Width != basemap.Width() || info.Height != basemap.Height() {
+		t.Errorf("Header dimensions %dx%d do not match decoded %dx%d",
+			info.Width, info.Height, basemap.Width(), basemap.Height())
+	}
+	if info.Format != "jpeg" {
+		t.Errorf("Expected format jpeg, got %q", info.Format)
+	}
+}
+
+func TestReadImageInfoFromBytes(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, createTestImage(64, 32)); err != nil {
+		t.Fatalf("Failed to encode PNG: %v", err)
+	}
+
+	info, err := ReadImageInfoFromBytes(buf.Bytes())
+	if err != nil {
+		t.Fatalf("ReadImageInfoFromBytes() failed: %v", err)
+	}
+	if info != (ImageInfo{Width: 64, Height: 32, Format: "png"}) {
+		t.Errorf("Unexpected image info: %+v", info)
+	}
+
+	if _, err := ReadImageInfoFromBytes([]byte("not an image")); err == nil {
+		t.Error("Expected error for invalid image data, got nil")
+	}
+}
+
+func TestLoadImage_SourceBounds(t *testing.T) {
+	// A red line one pixel wide at the prime meridian of a world image
+	src := image.NewRGBA(image.Rect(0, 0, 512, 256))
+	draw.Draw(src, src.Bounds(), &image.Uniform{color.RGBA{0, 0, 255, 255}}, image.Point{}, draw.Src)
+	draw.Draw(src, image.Rect(256, 0, 257, 256), &image.Uniform{color.RGBA{255, 0, 0, 255}}, image.Point{}, draw.Src)
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, src); err != nil {
+		t.Fatalf("Failed to encode PNG: %v", err)
+	}
+
+	// Column of the reddest pixel in the middle row of zoom 1 tile x/0
+	redColumn := func(opts LoadOptions, x int) int {
+		t.Helper()
+		basemap, err := LoadImageFromBytes(buf.Bytes(), opts)
+		if err != nil {
+			t.Fatalf("LoadImageFromBytes failed: %v", err)
+		}
+		tile, err := basemap.ExtractTile(1, x, 0)
+		if err != nil {
+			t.Fatalf("ExtractTile failed: %v", err)
+		}
+		best := 0
+		for x := range TileSize {
+			if tile.RGBAAt(x, TileSize/2).R > tile.RGBAAt(best, TileSize/2).R {
+				best = x
+			}
+		}
+		return best
+	}
+
+	// The line starts the eastern hemisphere
+	if column := redColumn(LoadOptions{}, 1); column > 2 {
+		t.Errorf("Expected the line at the western edge of tile 1/1/0, got column %d", column)
+	}
+	// Declared 10° further west, the line lies at 10°W, 484 pixels into
+	// the western hemisphere's 512
+	shifted := redColumn(LoadOptions{SourceBounds: &tilemath.Bounds{West: -190, South: -90, East: 170, North: 90}}, 0)
+	if shifted < 481 || shifted > 487 {
+		t.Errorf("Expected the line near column 484 of tile 1/0/0, got %d", shifted)
+	}
+
+	if _, err := LoadImageFromBytes(buf.Bytes(), LoadOptions{SourceBounds: &tilemath.Bounds{West: 10, South: -90, East: -10, North: 90}}); err == nil {
+		t.Error("Expected source bounds with west > east to be rejected")
+	}
+}
+
+func TestParseSourceBounds(t *testing.T) {
+	tests := []struct {
+		input       string
+		expected    tilemath.Bounds
+		expectError bool
+		name        string
+	}{
+		{"-180.0042, -90.0042, 179.9958, 89.9958", tilemath.Bounds{West: -180.0042, South: -90.0042, East: 179.9958, North: 89.9958}, false, "pixel-center registration"},
+		{"-180,-90,180,90", WorldBounds, false, "world"},
+		{"-180,-90,180", tilemath.Bounds{}, true, "three values"},
+		{"180,-90,-180,90", tilemath.Bounds{}, true, "west above east"},
+		{"-180,90,180,-90", tilemath.Bounds{}, true, "south above north"},
+		{"-180,-90,180,NaN", tilemath.Bounds{}, true, "not a number"},
+		{"-180,-90,180,x", tilemath.Bounds{}, true, "malformed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseSourceBounds(tt.input)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Expected error for %q, got %v", tt.input, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseSourceBounds(%q) failed: %v", tt.input, err)
+			}
+			if got != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
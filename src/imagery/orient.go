@@ -0,0 +1,82 @@
+package imagery
+
+import (
+	"image"
+	"image/draw"
+)
+
+// orientImage returns img transformed so that an image stored with the
+// given EXIF orientation (1-8) is upright. Orientation 1 and unknown values
+// return img unchanged.
+func orientImage(img image.Image, orientation int) image.Image {
+	switch orientation {
+	case 2:
+		return flipImage(img, false, true)
+	case 3:
+		return flipImage(img, true, true)
+	case 4:
+		return flipImage(img, true, false)
+	case 5:
+		return transposeImage(img)
+	case 6:
+		return flipImage(transposeImage(img), false, true)
+	case 7:
+		return flipImage(transposeImage(img), true, true)
+	case 8:
+		return flipImage(transposeImage(img), true, false)
+	}
+	return img
+}
+
+// flipImage returns a copy of img mirrored top-to-bottom and/or
+// left-to-right. img is returned unchanged if neither flip is requested.
+func flipImage(img image.Image, vertical, horizontal bool) image.Image {
+	if !vertical && !horizontal {
+		return img
+	}
+
+	b := img.Bounds()
+	src := toRGBA(img)
+	dst := image.NewRGBA(src.Bounds())
+	rowBytes := b.Dx() * 4
+	for y := 0; y < b.Dy(); y++ {
+		dy := y
+		if vertical {
+			dy = b.Dy() - 1 - y
+		}
+		srcRow := src.Pix[y*src.Stride : y*src.Stride+rowBytes]
+		dstRow := dst.Pix[dy*dst.Stride : dy*dst.Stride+rowBytes]
+		if !horizontal {
+			copy(dstRow, srcRow)
+			continue
+		}
+		for x := 0; x < b.Dx(); x++ {
+			copy(dstRow[(b.Dx()-1-x)*4:(b.Dx()-x)*4], srcRow[x*4:x*4+4])
+		}
+	}
+	return dst
+}
+
+// transposeImage returns a copy of img mirrored across its top-left to
+// bottom-right diagonal, swapping width and height
+func transposeImage(img image.Image) image.Image {
+	src := toRGBA(img)
+	b := src.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dy(), b.Dx()))
+	for y := 0; y < b.Dy(); y++ {
+		for x := 0; x < b.Dx(); x++ {
+			si := y*src.Stride + x*4
+			di := x*dst.Stride + y*4
+			copy(dst.Pix[di:di+4], src.Pix[si:si+4])
+		}
+	}
+	return dst
+}
+
+// toRGBA copies img into an RGBA image whose bounds start at the origin
+func toRGBA(img image.Image) *image.RGBA {
+	b := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Bounds(), img, b.Min, draw.Src)
+	return dst
+}
@@ -0,0 +1,91 @@
+package imagery
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestOrientImage(t *testing.T) {
+	// 3x2 source, i.e. a stored image; each pixel encodes its coordinates
+	src := image.NewRGBA(image.Rect(0, 0, 3, 2))
+	for y := 0; y < 2; y++ {
+		for x := 0; x < 3; x++ {
+			src.Set(x, y, color.RGBA{uint8(x * 100), uint8(y * 100), 0, 255})
+		}
+	}
+
+	tests := []struct {
+		orientation int
+		size        image.Point
+		// Source pixel expected at the upright image's top-left corner
+		topLeft image.Point
+		name    string
+	}{
+		{1, image.Pt(3, 2), image.Pt(0, 0), "upright"},
+		{2, image.Pt(3, 2), image.Pt(2, 0), "mirrored horizontally"},
+		{3, image.Pt(3, 2), image.Pt(2, 1), "rotated 180"},
+		{4, image.Pt(3, 2), image.Pt(0, 1), "mirrored vertically"},
+		{5, image.Pt(2, 3), image.Pt(0, 0), "transposed"},
+		{6, image.Pt(2, 3), image.Pt(0, 1), "rotated 90 clockwise"},
+		{7, image.Pt(2, 3), image.Pt(2, 1), "transverse"},
+		{8, image.Pt(2, 3), image.Pt(2, 0), "rotated 90 counter-clockwise"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := orientImage(src, tt.orientation)
+			if got := out.Bounds().Size(); got != tt.size {
+				t.Fatalf("Expected size %v, got %v", tt.size, got)
+			}
+			got := color.RGBAModel.Convert(out.At(0, 0))
+			if want := src.At(tt.topLeft.X, tt.topLeft.Y); got != want {
+				t.Errorf("Expected top-left %v (source %v), got %v", want, tt.topLeft, got)
+			}
+		})
+	}
+}
+
+func TestFlipImage(t *testing.T) {
+	// 3x2 image with a distinct color in each pixel, offset from the origin
+	src := image.NewRGBA(image.Rect(10, 20, 13, 22))
+	for y := 0; y < 2; y++ {
+		for x := 0; x < 3; x++ {
+			src.Set(10+x, 20+y, color.RGBA{uint8(x * 100), uint8(y * 100), 0, 255})
+		}
+	}
+
+	tests := []struct {
+		vertical   bool
+		horizontal bool
+		// Source pixel expected at output (0,0) and (2,1)
+		topLeft     image.Point
+		bottomRight image.Point
+		name        string
+	}{
+		{false, false, image.Pt(0, 0), image.Pt(2, 1), "no flip"},
+		{true, false, image.Pt(0, 1), image.Pt(2, 0), "vertical"},
+		{false, true, image.Pt(2, 0), image.Pt(0, 1), "horizontal"},
+		{true, true, image.Pt(2, 1), image.Pt(0, 0), "both"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := flipImage(src, tt.vertical, tt.horizontal)
+			b := out.Bounds()
+			if b.Dx() != 3 || b.Dy() != 2 {
+				t.Fatalf("Expected 3x2 image, got %dx%d", b.Dx(), b.Dy())
+			}
+
+			check := func(at, from image.Point) {
+				got := color.RGBAModel.Convert(out.At(b.Min.X+at.X, b.Min.Y+at.Y))
+				want := src.At(10+from.X, 20+from.Y)
+				if got != want {
+					t.Errorf("Pixel %v: expected %v (source %v), got %v", at, want, from, got)
+				}
+			}
+			check(image.Pt(0, 0), tt.topLeft)
+			check(image.Pt(2, 1), tt.bottomRight)
+		})
+	}
+}
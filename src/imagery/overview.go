@@ -0,0 +1,65 @@
+package imagery
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"strconv"
+	"strings"
+
+	xdraw "golang.org/x/image/draw"
+	"golang.org/x/image/math/f64"
+)
+
+// MaxOverviewSize is the largest width or height of an overview image
+const MaxOverviewSize = 8192
+
+// ExtractOverview renders the whole world as a width x height
+// equirectangular image, -180 to 180 degrees across and 90 to -90 down.
+// A base map covering less than the world, see SourceBounds, is placed in
+// its extent on background, or on transparency if background is nil.
+func (bm *BaseMap) ExtractOverview(ctx context.Context, width, height int, background color.Color) (*image.RGBA, error) {
+	if width < 1 || height < 1 || width > MaxOverviewSize || height > MaxOverviewSize {
+		return nil, fmt.Errorf("overview size must be in range [1, %d] on both sides, got %dx%d", MaxOverviewSize, width, height)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	overview := image.NewRGBA(image.Rect(0, 0, width, height))
+	if background != nil {
+		xdraw.Draw(overview, overview.Bounds(), &image.Uniform{background}, image.Point{}, xdraw.Src)
+	}
+
+	// Map source pixels into the world: x from the extent's west edge, y from
+	// its north edge, each at the output's degrees per pixel
+	extent := bm.SourceBounds()
+	world := WorldBounds
+	scaleX := (extent.East - extent.West) / (world.East - world.West) * float64(width) / float64(bm.width)
+	scaleY := (extent.North - extent.South) / (world.North - world.South) * float64(height) / float64(bm.height)
+	s2d := f64.Aff3{
+		scaleX, 0, (extent.West - world.West) / (world.East - world.West) * float64(width),
+		0, scaleY, (world.North - extent.North) / (world.North - world.South) * float64(height),
+	}
+
+	kernel, _ := ResampleKernel.interpolator()
+	if err := transformCtx(ctx, kernel, overview, s2d, bm.img, bm.bounds); err != nil {
+		return nil, err
+	}
+	return overview, nil
+}
+
+// ParseImageSize parses an image size given as WIDTHxHEIGHT, e.g. 1024x512
+func ParseImageSize(s string) (image.Point, error) {
+	w, h, ok := strings.Cut(strings.ToLower(strings.TrimSpace(s)), "x")
+	if !ok {
+		return image.Point{}, fmt.Errorf("invalid size %q (expected WIDTHxHEIGHT, e.g. 1024x512)", s)
+	}
+	width, errW := strconv.Atoi(w)
+	height, errH := strconv.Atoi(h)
+	if errW != nil || errH != nil || width < 1 || height < 1 {
+		return image.Point{}, fmt.Errorf("invalid size %q (expected positive WIDTHxHEIGHT, e.g. 1024x512)", s)
+	}
+	return image.Pt(width, height), nil
+}
@@ -0,0 +1,104 @@
+package imagery
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"testing"
+
+	"org.xyzmaps.xyztiles/src/tilemath"
+)
+
+func TestExtractOverview(t *testing.T) {
+	// White northern hemisphere, black southern
+	img := image.NewRGBA(image.Rect(0, 0, 1024, 512))
+	for y := range 512 {
+		for x := range 1024 {
+			if y < 256 {
+				img.SetRGBA(x, y, color.RGBA{255, 255, 255, 255})
+			} else {
+				img.SetRGBA(x, y, color.RGBA{0, 0, 0, 255})
+			}
+		}
+	}
+	bm := NewBaseMap(img)
+
+	overview, err := bm.ExtractOverview(context.Background(), 200, 100, nil)
+	if err != nil {
+		t.Fatalf("ExtractOverview() failed: %v", err)
+	}
+	if got := overview.Bounds(); got != image.Rect(0, 0, 200, 100) {
+		t.Fatalf("Expected a 200x100 overview, got %v", got)
+	}
+	if c := overview.RGBAAt(100, 10); c != (color.RGBA{255, 255, 255, 255}) {
+		t.Errorf("Expected white in the north, got %v", c)
+	}
+	if c := overview.RGBAAt(100, 90); c != (color.RGBA{0, 0, 0, 255}) {
+		t.Errorf("Expected black in the south, got %v", c)
+	}
+}
+
+func TestExtractOverview_SourceBounds(t *testing.T) {
+	// A red image covering only the eastern hemisphere
+	img := image.NewRGBA(image.Rect(0, 0, 256, 256))
+	for y := range 256 {
+		for x := range 256 {
+			img.SetRGBA(x, y, color.RGBA{255, 0, 0, 255})
+		}
+	}
+	bm := NewBaseMap(img)
+	if err := bm.SetSourceBounds(tilemath.Bounds{West: 0, South: -90, East: 180, North: 90}); err != nil {
+		t.Fatalf("SetSourceBounds() failed: %v", err)
+	}
+
+	background := color.RGBA{0, 0, 255, 255}
+	overview, err := bm.ExtractOverview(context.Background(), 200, 100, background)
+	if err != nil {
+		t.Fatalf("ExtractOverview() failed: %v", err)
+	}
+	if c := overview.RGBAAt(50, 50); c != background {
+		t.Errorf("Expected the background west of the extent, got %v", c)
+	}
+	if c := overview.RGBAAt(150, 50); c != (color.RGBA{255, 0, 0, 255}) {
+		t.Errorf("Expected the image east of the prime meridian, got %v", c)
+	}
+}
+
+func TestExtractOverview_InvalidSize(t *testing.T) {
+	bm := NewBaseMap(image.NewRGBA(image.Rect(0, 0, 64, 32)))
+	for _, size := range []image.Point{{0, 10}, {10, -1}, {MaxOverviewSize + 1, 10}} {
+		if _, err := bm.ExtractOverview(context.Background(), size.X, size.Y, nil); err == nil {
+			t.Errorf("Expected error for size %v", size)
+		}
+	}
+}
+
+func TestParseImageSize(t *testing.T) {
+	tests := []struct {
+		input       string
+		expected    image.Point
+		expectError bool
+		name        string
+	}{
+		{"1024x512", image.Pt(1024, 512), false, "width by height"},
+		{" 800X400 ", image.Pt(800, 400), false, "upper case and spaces"},
+		{"1024", image.Point{}, true, "no height"},
+		{"0x512", image.Point{}, true, "zero width"},
+		{"ax512", image.Point{}, true, "not a number"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseImageSize(tt.input)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Expected error for %q, got %v", tt.input, got)
+				}
+				return
+			}
+			if err != nil || got != tt.expected {
+				t.Errorf("ParseImageSize(%q) = %v, %v; expected %v", tt.input, got, err, tt.expected)
+			}
+		})
+	}
+}
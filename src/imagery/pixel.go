@@ -0,0 +1,26 @@
+package imagery
+
+import (
+	"image"
+	"image/color"
+)
+
+// SourcePixel returns the pixel of the source image containing lon, lat in
+// degrees, mapped as tiles are, and false if the point lies outside the
+// image's extent (see SourceBounds). Points on the east or south edge of the
+// extent belong to the last column or row.
+func (bm *BaseMap) SourcePixel(lon, lat float64) (image.Point, bool) {
+	extent := bm.SourceBounds()
+	if lon < extent.West || lon > extent.East || lat < extent.South || lat > extent.North {
+		return image.Point{}, false
+	}
+	x := lonToPixelX(lon, extent.West, extent.East, bm.width)
+	y := latToPixelY(lat, extent.North, extent.South, bm.height)
+	return image.Pt(clamp(x, 0, bm.width-1), clamp(y, 0, bm.height-1)), true
+}
+
+// PixelColor returns the color of source pixel p, as returned by
+// SourcePixel, in non-premultiplied RGBA
+func (bm *BaseMap) PixelColor(p image.Point) color.NRGBA {
+	return color.NRGBAModel.Convert(bm.img.At(bm.bounds.Min.X+p.X, bm.bounds.Min.Y+p.Y)).(color.NRGBA)
+}
@@ -0,0 +1,69 @@
+package imagery
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"org.xyzmaps.xyztiles/src/tilemath"
+)
+
+// gradientBaseMap returns a 360x180 base map, one pixel per degree, whose
+// red channel is the column and green channel the row (each mod 256)
+func gradientBaseMap() *BaseMap {
+	img := image.NewNRGBA(image.Rect(0, 0, 360, 180))
+	for y := range 180 {
+		for x := range 360 {
+			img.SetNRGBA(x, y, color.NRGBA{uint8(x), uint8(y), 0, 255})
+		}
+	}
+	return NewBaseMap(img)
+}
+
+func TestSourcePixel(t *testing.T) {
+	bm := gradientBaseMap()
+
+	tests := []struct {
+		lon, lat float64
+		expected image.Point
+		expectOK bool
+		name     string
+	}{
+		{-180, 90, image.Pt(0, 0), true, "north west corner"},
+		{0, 0, image.Pt(180, 90), true, "origin"},
+		{2.35, 48.86, image.Pt(182, 41), true, "paris"},
+		{180, -90, image.Pt(359, 179), true, "south east corner"},
+		{-180.5, 0, image.Point{}, false, "west of the extent"},
+		{0, 90.5, image.Point{}, false, "north of the extent"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := bm.SourcePixel(tt.lon, tt.lat)
+			if ok != tt.expectOK || got != tt.expected {
+				t.Errorf("SourcePixel(%g, %g) = %v, %v; expected %v, %v", tt.lon, tt.lat, got, ok, tt.expected, tt.expectOK)
+			}
+		})
+	}
+}
+
+func TestSourcePixel_SourceBounds(t *testing.T) {
+	bm := gradientBaseMap()
+	if err := bm.SetSourceBounds(tilemath.Bounds{West: 0, South: 0, East: 36, North: 18}); err != nil {
+		t.Fatalf("SetSourceBounds() failed: %v", err)
+	}
+
+	if got, ok := bm.SourcePixel(18, 9); !ok || got != image.Pt(180, 90) {
+		t.Errorf("Expected the extent's center at pixel (180,90), got %v, %v", got, ok)
+	}
+	if _, ok := bm.SourcePixel(-1, 9); ok {
+		t.Error("Expected a point west of the extent to have no pixel")
+	}
+}
+
+func TestPixelColor(t *testing.T) {
+	bm := gradientBaseMap()
+	if got := bm.PixelColor(image.Pt(182, 41)); got != (color.NRGBA{182, 41, 0, 255}) {
+		t.Errorf("Expected the gradient's color at (182,41), got %v", got)
+	}
+}
@@ -0,0 +1,71 @@
+package imagery
+
+import (
+	"context"
+	"image"
+
+	xdraw "golang.org/x/image/draw"
+	"golang.org/x/image/math/f64"
+)
+
+// resampleStrip is how many rows (or columns) are resampled between checks
+// of the context, so a render gives up soon after its deadline instead of
+// once the whole image is done
+const resampleStrip = 64
+
+// transformCtx is kernel.Transform drawing dst in strips of rows, returning
+// ctx.Err() between strips once ctx is done. Each strip maps through the
+// same s2d, so the result matches a single Transform.
+func transformCtx(ctx context.Context, kernel xdraw.Interpolator, dst *image.RGBA, s2d f64.Aff3, src image.Image, sr image.Rectangle) error {
+	b := dst.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y += resampleStrip {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		strip := dst.SubImage(image.Rect(b.Min.X, y, b.Max.X, min(y+resampleStrip, b.Max.Y))).(*image.RGBA)
+		kernel.Transform(strip, s2d, src, sr, xdraw.Over, nil)
+	}
+	return ctx.Err()
+}
+
+// scaleCtx is kernel.Scale of sr onto the whole of dst, returning ctx.Err()
+// between strips once ctx is done
+func scaleCtx(ctx context.Context, kernel xdraw.Interpolator, dst *image.RGBA, src image.Image, sr image.Rectangle) error {
+	dr := dst.Bounds()
+	k, ok := kernel.(*xdraw.Kernel)
+	if !ok {
+		// Nearest neighbor and approximate bilinear read a few source pixels
+		// per output pixel, so scaling strips of dst costs no more than the
+		// whole
+		for y := dr.Min.Y; y < dr.Max.Y; y += resampleStrip {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			strip := dst.SubImage(image.Rect(dr.Min.X, y, dr.Max.X, min(y+resampleStrip, dr.Max.Y))).(*image.RGBA)
+			kernel.Scale(strip, dr, src, sr, xdraw.Over, nil)
+		}
+		return ctx.Err()
+	}
+
+	// A kernel's Scale makes its horizontal pass over every source row
+	// whatever part of dst is drawn, so the two passes are made here
+	// instead: strips of source rows are scaled across into tmp, then strips
+	// of tmp's columns down into dst. Every supported kernel interpolates,
+	// so scaling by one along the other axis copies pixels unchanged.
+	tmp := image.NewRGBA(image.Rect(0, 0, dr.Dx(), sr.Dy()))
+	for y := 0; y < sr.Dy(); y += 4 * resampleStrip {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		rows := min(4*resampleStrip, sr.Dy()-y)
+		k.Scale(tmp, image.Rect(0, y, dr.Dx(), y+rows), src, image.Rect(sr.Min.X, sr.Min.Y+y, sr.Max.X, sr.Min.Y+y+rows), xdraw.Src, nil)
+	}
+	for x := 0; x < dr.Dx(); x += resampleStrip {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		cols := min(resampleStrip, dr.Dx()-x)
+		k.Scale(dst, image.Rect(dr.Min.X+x, dr.Min.Y, dr.Min.X+x+cols, dr.Max.Y), tmp, image.Rect(x, 0, x+cols, sr.Dy()), xdraw.Over, nil)
+	}
+	return ctx.Err()
+}
@@ -0,0 +1,120 @@
+package imagery
+
+import (
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"testing"
+
+	xdraw "golang.org/x/image/draw"
+	"golang.org/x/image/math/f64"
+)
+
+// countdownCtx is a context whose Err reports it canceled from the nth call
+// on, so tests can cancel a resample partway through
+type countdownCtx struct {
+	context.Context
+	n int
+}
+
+func (c *countdownCtx) Err() error {
+	if c.n--; c.n < 0 {
+		return context.Canceled
+	}
+	return nil
+}
+
+// createNoiseImage returns an image with detail at every pixel, so
+// resampling errors are not hidden by smooth gradients
+func createNoiseImage(width, height int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := range height {
+		for x := range width {
+			v := uint8((x*7 + y*13 + x*y) % 256)
+			img.SetRGBA(x, y, color.RGBA{v, 255 - v, uint8(x), 255})
+		}
+	}
+	return img
+}
+
+func TestScaleCtx(t *testing.T) {
+	src := createNoiseImage(1000, 600)
+	sr := image.Rect(100, 50, 900, 550)
+
+	// Tiles only take this path when downsampled. The separate passes round
+	// to 8 bits in between, and clip the overshoot of CatmullRom's negative
+	// lobes there.
+	tests := []struct {
+		kernel    Kernel
+		tolerance int
+		name      string
+	}{
+		{KernelNearest, 0, "nearest"},
+		{KernelApproxBiLinear, 0, "approximate bilinear"},
+		{KernelBiLinear, 1, "bilinear"},
+		{KernelCatmullRom, 4, "catmullrom"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kernel, _ := tt.kernel.interpolator()
+			for _, size := range []int{128, 200, 300} {
+				want := image.NewRGBA(image.Rect(0, 0, size, size))
+				kernel.Scale(want, want.Bounds(), src, sr, xdraw.Over, nil)
+				got := image.NewRGBA(image.Rect(0, 0, size, size))
+				if err := scaleCtx(context.Background(), kernel, got, src, sr); err != nil {
+					t.Fatalf("scaleCtx failed: %v", err)
+				}
+				for i := range got.Pix {
+					if d := int(got.Pix[i]) - int(want.Pix[i]); d > tt.tolerance || d < -tt.tolerance {
+						t.Fatalf("Size %d: byte %d is %d, Scale gives %d", size, i, got.Pix[i], want.Pix[i])
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestTransformCtx(t *testing.T) {
+	src := createNoiseImage(300, 200)
+	s2d := f64.Aff3{1.7, 0, 12, 0, 1.3, -5}
+	want := image.NewRGBA(image.Rect(0, 0, 400, 250))
+	xdraw.CatmullRom.Transform(want, s2d, src, src.Bounds(), xdraw.Over, nil)
+	got := image.NewRGBA(image.Rect(0, 0, 400, 250))
+	if err := transformCtx(context.Background(), xdraw.CatmullRom, got, s2d, src, src.Bounds()); err != nil {
+		t.Fatalf("transformCtx failed: %v", err)
+	}
+	for i := range got.Pix {
+		if got.Pix[i] != want.Pix[i] {
+			t.Fatalf("Byte %d is %d, Transform gives %d", i, got.Pix[i], want.Pix[i])
+		}
+	}
+}
+
+func TestResampleCtx_Cancelled(t *testing.T) {
+	src := createNoiseImage(1000, 600)
+	kernel, _ := KernelCatmullRom.interpolator()
+	resamples := map[string]func(ctx context.Context) error{
+		"scale": func(ctx context.Context) error {
+			return scaleCtx(ctx, kernel, image.NewRGBA(image.Rect(0, 0, 512, 512)), src, src.Bounds())
+		},
+		"transform": func(ctx context.Context) error {
+			return transformCtx(ctx, kernel, image.NewRGBA(image.Rect(0, 0, 512, 512)), f64.Aff3{0.5, 0, 0, 0, 0.5, 0}, src, src.Bounds())
+		},
+	}
+
+	for name, resample := range resamples {
+		t.Run(name, func(t *testing.T) {
+			// Canceled after the first strip, partway through
+			if err := resample(&countdownCtx{Context: context.Background(), n: 1}); !errors.Is(err, context.Canceled) {
+				t.Errorf("Expected context.Canceled between strips, got %v", err)
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			if err := resample(ctx); !errors.Is(err, context.Canceled) {
+				t.Errorf("Expected context.Canceled before starting, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package imagery
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+
+	"org.xyzmaps.xyztiles/src/tilemath"
+)
+
+// DefaultUniformTolerance is the per-channel spread up to which a tile
+// counts as uniform, absorbing JPEG noise in flat areas such as oceans
+const DefaultUniformTolerance = 2
+
+// TileStats summarizes the pixels of a tile, either the source pixels it is
+// rendered from (BaseMap.TileStats) or the rendered tile (ImageStats)
+type TileStats struct {
+	Mean     color.RGBA // Per-channel mean, rounded
+	Min      color.RGBA // Per-channel minimum
+	Max      color.RGBA // Per-channel maximum
+	Variance float64    // Variance of luma (0-255), a measure of detail
+	Samples  int        // Number of pixels sampled
+}
+
+// Uniform reports whether every sampled pixel is within tolerance of every
+// other in each channel, so the tile can be drawn as a single color
+func (s TileStats) Uniform(tolerance uint8) bool {
+	return s.Max.R-s.Min.R <= tolerance &&
+		s.Max.G-s.Min.G <= tolerance &&
+		s.Max.B-s.Min.B <= tolerance &&
+		s.Max.A-s.Min.A <= tolerance
+}
+
+// TileStats computes color statistics for the tile at the given XYZ
+// coordinates from the source image, without rendering it. Tiles covering
+// more than TileSize source pixels in either direction are sampled on an
+// even grid at the tile's output resolution, so details finer than one
+// output pixel may be missed. Invalid coordinates yield an error wrapping
+// ErrInvalidZoom or ErrOutOfRange.
+func (bm *BaseMap) TileStats(z, x, y int) (TileStats, error) {
+	tileBounds, err := tilemath.TileBounds(z, x, y)
+	if err != nil {
+		return TileStats{}, fmt.Errorf("invalid tile coordinates: %w", err)
+	}
+
+	// Deep overzoom can cover less than one source pixel; use the pixel
+	// the tile lies in
+	r := bm.geoBoundsToPixelBounds(tileBounds)
+	if r.Dx() == 0 {
+		r.Min.X, r.Max.X = min(r.Min.X, bm.width-1), min(r.Min.X, bm.width-1)+1
+	}
+	if r.Dy() == 0 {
+		r.Min.Y, r.Max.Y = min(r.Min.Y, bm.height-1), min(r.Min.Y, bm.height-1)+1
+	}
+
+	return sampleStats(bm.img, r), nil
+}
+
+// ImageStats computes color statistics for a rendered image such as a tile,
+// sampling at most TileSize pixels in each direction
+func ImageStats(img image.Image) TileStats {
+	return sampleStats(img, img.Bounds())
+}
+
+// sampleStats computes TileStats over r of img, sampling at most TileSize
+// pixels in each direction
+func sampleStats(img image.Image, r image.Rectangle) TileStats {
+	stepX := (r.Dx() + TileSize - 1) / TileSize
+	stepY := (r.Dy() + TileSize - 1) / TileSize
+
+	stats := TileStats{Min: color.RGBA{255, 255, 255, 255}}
+	var sum [4]uint64
+	var lumaSum, lumaSquares float64
+	for py := r.Min.Y; py < r.Max.Y; py += stepY {
+		for px := r.Min.X; px < r.Max.X; px += stepX {
+			c := color.RGBAModel.Convert(img.At(px, py)).(color.RGBA)
+			sum[0] += uint64(c.R)
+			sum[1] += uint64(c.G)
+			sum[2] += uint64(c.B)
+			sum[3] += uint64(c.A)
+			luma := 0.299*float64(c.R) + 0.587*float64(c.G) + 0.114*float64(c.B)
+			lumaSum += luma
+			lumaSquares += luma * luma
+			stats.Min = color.RGBA{min(stats.Min.R, c.R), min(stats.Min.G, c.G), min(stats.Min.B, c.B), min(stats.Min.A, c.A)}
+			stats.Max = color.RGBA{max(stats.Max.R, c.R), max(stats.Max.G, c.G), max(stats.Max.B, c.B), max(stats.Max.A, c.A)}
+			stats.Samples++
+		}
+	}
+
+	if stats.Samples == 0 {
+		return TileStats{}
+	}
+	n := uint64(stats.Samples)
+	stats.Mean = color.RGBA{
+		R: uint8((sum[0] + n/2) / n),
+		G: uint8((sum[1] + n/2) / n),
+		B: uint8((sum[2] + n/2) / n),
+		A: uint8((sum[3] + n/2) / n),
+	}
+	lumaMean := lumaSum / float64(n)
+	stats.Variance = max(0, lumaSquares/float64(n)-lumaMean*lumaMean)
+	return stats
+}
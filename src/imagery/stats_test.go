@@ -0,0 +1,134 @@
+package imagery
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"testing"
+)
+
+// halfAndHalfBaseMap returns a 1024x512 base map whose western hemisphere
+// is west and eastern hemisphere is east
+func halfAndHalfBaseMap(west, east color.RGBA) *BaseMap {
+	img := image.NewRGBA(image.Rect(0, 0, 1024, 512))
+	draw.Draw(img, image.Rect(0, 0, 512, 512), &image.Uniform{west}, image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(512, 0, 1024, 512), &image.Uniform{east}, image.Point{}, draw.Src)
+	return NewBaseMap(img)
+}
+
+func TestTileStats(t *testing.T) {
+	ocean := color.RGBA{10, 40, 120, 255}
+	land := color.RGBA{90, 140, 40, 255}
+	bm := halfAndHalfBaseMap(ocean, land)
+
+	tests := []struct {
+		z, x, y       int
+		expectMean    color.RGBA
+		expectUniform bool
+		name          string
+	}{
+		{1, 0, 0, ocean, true, "western tile"},
+		{1, 1, 1, land, true, "eastern tile"},
+		{0, 0, 0, color.RGBA{50, 90, 80, 255}, false, "whole world mixes both"},
+		{22, 100, 100, ocean, true, "deep overzoom inside one pixel"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stats, err := bm.TileStats(tt.z, tt.x, tt.y)
+			if err != nil {
+				t.Fatalf("TileStats() failed: %v", err)
+			}
+			if stats.Mean != tt.expectMean {
+				t.Errorf("Expected mean %v, got %v", tt.expectMean, stats.Mean)
+			}
+			if got := stats.Uniform(DefaultUniformTolerance); got != tt.expectUniform {
+				t.Errorf("Expected uniform %v, got %v (min %v, max %v)", tt.expectUniform, got, stats.Min, stats.Max)
+			}
+			if stats.Samples == 0 {
+				t.Error("Expected at least one sample")
+			}
+		})
+	}
+}
+
+func TestTileStats_SolidColor(t *testing.T) {
+	c := color.RGBA{12, 34, 56, 255}
+	img := image.NewRGBA(image.Rect(0, 0, 5400, 2700))
+	draw.Draw(img, img.Bounds(), &image.Uniform{c}, image.Point{}, draw.Src)
+	bm := NewBaseMap(img)
+
+	stats, err := bm.TileStats(0, 0, 0)
+	if err != nil {
+		t.Fatalf("TileStats() failed: %v", err)
+	}
+	if stats.Mean != c || stats.Min != c || stats.Max != c || !stats.Uniform(0) {
+		t.Errorf("Expected uniform %v, got %+v", c, stats)
+	}
+	// Large tiles are sampled at no more than the output resolution
+	if stats.Samples > TileSize*TileSize {
+		t.Errorf("Expected at most %d samples, got %d", TileSize*TileSize, stats.Samples)
+	}
+}
+
+func TestTileStats_Tolerance(t *testing.T) {
+	bm := halfAndHalfBaseMap(color.RGBA{100, 100, 100, 255}, color.RGBA{103, 100, 100, 255})
+	stats, err := bm.TileStats(0, 0, 0)
+	if err != nil {
+		t.Fatalf("TileStats() failed: %v", err)
+	}
+	if stats.Uniform(2) {
+		t.Error("Expected a spread of 3 not to be uniform within 2")
+	}
+	if !stats.Uniform(3) {
+		t.Error("Expected a spread of 3 to be uniform within 3")
+	}
+}
+
+func TestTileStats_InvalidCoordinates(t *testing.T) {
+	bm := halfAndHalfBaseMap(color.RGBA{}, color.RGBA{})
+	if _, err := bm.TileStats(1, 2, 0); !errors.Is(err, ErrOutOfRange) {
+		t.Errorf("Expected ErrOutOfRange, got %v", err)
+	}
+	if _, err := bm.TileStats(-1, 0, 0); !errors.Is(err, ErrInvalidZoom) {
+		t.Errorf("Expected ErrInvalidZoom, got %v", err)
+	}
+}
+
+func TestImageStats(t *testing.T) {
+	checker := image.NewRGBA(image.Rect(0, 0, 16, 16))
+	for y := range 16 {
+		for x := range 16 {
+			if (x+y)%2 == 0 {
+				checker.SetRGBA(x, y, color.RGBA{255, 255, 255, 255})
+			} else {
+				checker.SetRGBA(x, y, color.RGBA{0, 0, 0, 255})
+			}
+		}
+	}
+	solid := image.NewRGBA(image.Rect(0, 0, 16, 16))
+	draw.Draw(solid, solid.Bounds(), &image.Uniform{color.RGBA{12, 34, 56, 255}}, image.Point{}, draw.Src)
+
+	tests := []struct {
+		img            image.Image
+		expectVariance float64
+		name           string
+	}{
+		{checker, 255 * 255 / 4.0, "black and white"},
+		{solid, 0, "solid"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stats := ImageStats(tt.img)
+			if math.Abs(stats.Variance-tt.expectVariance) > 0.01 {
+				t.Errorf("Expected variance %.2f, got %.2f", tt.expectVariance, stats.Variance)
+			}
+			if stats.Samples != 256 {
+				t.Errorf("Expected 256 samples, got %d", stats.Samples)
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+// Package lrucache holds byte slices by key within a total size, evicting
+// the least recently used ones to make room.
+package lrucache
+
+import (
+	"container/list"
+	"sync"
+)
+
+// Cache is a least recently used cache of byte slices bounded by their
+// total size in bytes. It is safe for concurrent use.
+type Cache struct {
+	mu       sync.Mutex
+	maxBytes int64
+	bytes    int64
+	ll       *list.List // Of *entry, most recently used first
+	items    map[string]*list.Element
+}
+
+// entry is a cached value and its key
+type entry struct {
+	key  string
+	data []byte
+}
+
+// New returns a cache holding at most maxBytes
+func New(maxBytes int64) *Cache {
+	return &Cache{maxBytes: maxBytes, ll: list.New(), items: map[string]*list.Element{}}
+}
+
+// Get returns the value cached for key, marking it recently used
+func (c *Cache) Get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	c.ll.MoveToFront(el)
+	return el.Value.(*entry).data, true
+}
+
+// Contains reports whether key is cached without marking it recently used
+func (c *Cache) Contains(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.items[key]
+	return ok
+}
+
+// Add caches data under key, evicting the least recently used values to
+// make room. Values larger than the whole cache are not stored.
+func (c *Cache) Add(key string, data []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	size := int64(len(data))
+	if size > c.maxBytes {
+		return
+	}
+
+	if el, ok := c.items[key]; ok {
+		e := el.Value.(*entry)
+		c.bytes += size - int64(len(e.data))
+		e.data = data
+		c.ll.MoveToFront(el)
+	} else {
+		c.items[key] = c.ll.PushFront(&entry{key: key, data: data})
+		c.bytes += size
+	}
+
+	for c.bytes > c.maxBytes {
+		c.removeElement(c.ll.Back())
+	}
+}
+
+// Remove drops the value cached for key, if any
+func (c *Cache) Remove(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[key]; ok {
+		c.removeElement(el)
+	}
+}
+
+// removeElement drops el from the cache; c.mu must be held
+func (c *Cache) removeElement(el *list.Element) {
+	e := el.Value.(*entry)
+	c.ll.Remove(el)
+	delete(c.items, e.key)
+	c.bytes -= int64(len(e.data))
+}
+
+// Clear removes every value and returns how many values and bytes were
+// removed
+func (c *Cache) Clear() (entries int, bytes int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entries, bytes = c.ll.Len(), c.bytes
+	c.ll.Init()
+	clear(c.items)
+	c.bytes = 0
+	return entries, bytes
+}
+
+// Len returns the number of cached values
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ll.Len()
+}
+
+// Bytes returns the total size of the cached values
+func (c *Cache) Bytes() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.bytes
+}
+
+// MaxBytes returns the size the cache is bounded by
+func (c *Cache) MaxBytes() int64 {
+	return c.maxBytes
+}
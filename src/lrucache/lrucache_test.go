@@ -0,0 +1,41 @@
+package lrucache
+
+import "testing"
+
+func TestCache(t *testing.T) {
+	c := New(10)
+	c.Add("a", []byte("1234"))
+	c.Add("b", []byte("1234"))
+	c.Get("a") // b is now the least recently used
+	c.Add("c", []byte("1234"))
+
+	if _, ok := c.Get("b"); ok {
+		t.Error("Expected b evicted")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok := c.Get(key); !ok {
+			t.Errorf("Expected %s cached", key)
+		}
+	}
+	c.Add("big", make([]byte, 11))
+	if _, ok := c.Get("big"); ok || c.Len() != 2 {
+		t.Errorf("Expected a value larger than the cache not stored, %d cached", c.Len())
+	}
+
+	// Replacing a value counts only its new size
+	c.Add("a", []byte("12"))
+	if got := c.Bytes(); got != 6 {
+		t.Errorf("Expected 6 bytes after replacing a, got %d", got)
+	}
+
+	c.Remove("a")
+	if c.Contains("a") || c.Bytes() != 4 {
+		t.Errorf("Expected a removed leaving 4 bytes, got %d", c.Bytes())
+	}
+	if entries, bytes := c.Clear(); entries != 1 || bytes != 4 {
+		t.Errorf("Expected Clear to remove 1 value of 4 bytes, got %d and %d", entries, bytes)
+	}
+	if c.Len() != 0 || c.Bytes() != 0 {
+		t.Errorf("Expected an empty cache, got %d values of %d bytes", c.Len(), c.Bytes())
+	}
+}
@@ -0,0 +1,423 @@
+// Package mbtiles reads tiles from MBTiles archives
+// (https://github.com/mapbox/mbtiles-spec), the SQLite databases that
+// package a tileset as a single file. It reads the database file directly
+// and needs no SQLite library, but only understands the plain layout: a
+// tiles table, ideally with an index on its coordinates, and a metadata
+// table. Archives that define tiles as a view over deduplicated images
+// are rejected.
+package mbtiles
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ErrTileNotFound is returned by Tile for a tile the archive does not hold
+var ErrTileNotFound = errors.New("tile not found in archive")
+
+// tileColumns are the columns of the tiles table, in the order Reader
+// keeps their positions
+var tileColumns = [4]string{"zoom_level", "tile_column", "tile_row", "tile_data"}
+
+// Reader reads tiles from an MBTiles archive. It is safe for concurrent use.
+type Reader struct {
+	db     *database
+	closer io.Closer
+
+	tilesRoot uint32 // Root page of the tiles table
+	indexRoot uint32 // Root page of an index on (zoom_level, tile_column, tile_row); 0 if there is none
+	columns   [4]int // Positions of tileColumns in a tiles row
+
+	// rowids maps the coordinates of every tile to its rowid when there is
+	// no index to search; the archive is scanned for it once, on open
+	rowids map[[3]int64]int64
+
+	metadata         map[string]string
+	minZoom, maxZoom int
+}
+
+// Open opens the MBTiles archive at path
+func Open(path string) (*Reader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	// Changes still in the write-ahead log are not in the database file
+	if wal, err := os.Stat(path + "-wal"); err == nil && wal.Size() > 0 {
+		f.Close()
+		return nil, fmt.Errorf("%s has uncommitted changes in %s-wal; checkpoint it first (e.g. sqlite3 %s 'PRAGMA wal_checkpoint(TRUNCATE)')", path, path, path)
+	}
+
+	r, err := NewReader(f, info.Size())
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	r.closer = f
+	return r, nil
+}
+
+// NewReader reads an MBTiles archive of size bytes from r, such as one
+// embedded in the binary
+func NewReader(r io.ReaderAt, size int64) (*Reader, error) {
+	db, err := openDatabase(r, size)
+	if err != nil {
+		return nil, err
+	}
+	m := &Reader{db: db}
+	if err := m.readSchema(); err != nil {
+		return nil, err
+	}
+	if m.indexRoot == 0 {
+		if err := m.scanTiles(); err != nil {
+			return nil, err
+		}
+	}
+	if err := m.readZoomRange(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Close closes the archive file, if Open opened one
+func (m *Reader) Close() error {
+	if m.closer == nil {
+		return nil
+	}
+	return m.closer.Close()
+}
+
+// Metadata returns the name/value pairs of the archive's metadata table,
+// such as name, format, bounds and attribution
+func (m *Reader) Metadata() map[string]string {
+	return maps.Clone(m.metadata)
+}
+
+// Format returns the tile format named by the archive's metadata, e.g.
+// "png", "jpg", "webp" or "pbf", or "" if it names none
+func (m *Reader) Format() string {
+	return strings.ToLower(m.metadata["format"])
+}
+
+// ZoomRange returns the lowest and highest zoom levels of the archive: the
+// minzoom and maxzoom metadata if set, otherwise those of the stored tiles
+func (m *Reader) ZoomRange() (minZoom, maxZoom int) {
+	return m.minZoom, m.maxZoom
+}
+
+// Tile returns the data of tile z/x/y, in XYZ numbering with y growing
+// southwards, or ErrTileNotFound if the archive does not hold it. The
+// archive itself numbers rows the TMS way, from the south.
+func (m *Reader) Tile(z, x, y int) ([]byte, error) {
+	if z < 0 || z > 30 || x < 0 || y < 0 || x >= 1<<z || y >= 1<<z {
+		return nil, ErrTileNotFound
+	}
+	key := [3]int64{int64(z), int64(x), int64(1)<<z - 1 - int64(y)}
+
+	var rowid int64
+	if m.indexRoot != 0 {
+		entry, err := m.db.findIndex(m.indexRoot, key[:])
+		if err != nil {
+			return nil, err
+		}
+		if entry == nil {
+			return nil, ErrTileNotFound
+		}
+		id, ok := entry[len(entry)-1].(int64)
+		if !ok || len(entry) != 4 {
+			return nil, fmt.Errorf("%w: bad tile index entry", errCorrupt)
+		}
+		rowid = id
+	} else {
+		id, ok := m.rowids[key]
+		if !ok {
+			return nil, ErrTileNotFound
+		}
+		rowid = id
+	}
+
+	payload, err := m.db.findRow(m.tilesRoot, rowid)
+	if err != nil {
+		return nil, err
+	}
+	if payload == nil {
+		return nil, fmt.Errorf("%w: tile index names missing row %d", errCorrupt, rowid)
+	}
+	values, err := decodeRecord(payload)
+	if err != nil {
+		return nil, err
+	}
+	coords, data, err := m.tileRow(values)
+	if err != nil {
+		return nil, err
+	}
+	if coords != key {
+		return nil, fmt.Errorf("%w: tile index names the wrong row for %d/%d/%d", errCorrupt, z, x, y)
+	}
+	return data, nil
+}
+
+// tileRow returns the coordinates and data of a decoded tiles row
+func (m *Reader) tileRow(values []any) (coords [3]int64, data []byte, err error) {
+	for i := range coords {
+		v, ok := column(values, m.columns[i]).(int64)
+		if !ok {
+			return coords, nil, fmt.Errorf("tiles row has a non-integer %s", tileColumns[i])
+		}
+		coords[i] = v
+	}
+	switch v := column(values, m.columns[3]).(type) {
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	case nil:
+	default:
+		return coords, nil, errors.New("tiles row has a non-blob tile_data")
+	}
+	return coords, data, nil
+}
+
+// column returns values[i], or nil for a column past the end of the record,
+// which SQLite leaves out when it was added by a later ALTER TABLE
+func column(values []any, i int) any {
+	if i < len(values) {
+		return values[i]
+	}
+	return nil
+}
+
+// readSchema finds the tiles table, an index on its coordinates and the
+// metadata in the schema table on page 1
+func (m *Reader) readSchema() error {
+	type object struct {
+		kind, name, table, sql string
+		root                   uint32
+	}
+	var objects []object
+	err := m.db.walkTable(1, func(_ int64, payload []byte) (bool, error) {
+		values, err := decodeRecord(payload)
+		if err != nil {
+			return false, err
+		}
+		var o object
+		o.kind, _ = column(values, 0).(string)
+		o.name, _ = column(values, 1).(string)
+		o.table, _ = column(values, 2).(string)
+		root, _ := column(values, 3).(int64)
+		o.root = uint32(root)
+		o.sql, _ = column(values, 4).(string)
+		objects = append(objects, o)
+		return true, nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read the database schema: %w", err)
+	}
+
+	var metadataRoot uint32
+	for _, o := range objects {
+		switch {
+		case strings.EqualFold(o.name, "tiles") && o.kind == "view":
+			return errors.New("tiles is a view, as in deduplicated archives; only archives with a tiles table are supported")
+		case strings.EqualFold(o.name, "tiles") && o.kind == "table":
+			m.tilesRoot = o.root
+			if m.columns, err = tableColumns(o.sql); err != nil {
+				return err
+			}
+		case strings.EqualFold(o.name, "metadata") && o.kind == "table":
+			metadataRoot = o.root
+		}
+	}
+	if m.tilesRoot == 0 {
+		return errors.New("not an MBTiles archive: no tiles table")
+	}
+
+	for _, o := range objects {
+		if o.kind == "index" && strings.EqualFold(o.table, "tiles") && o.root != 0 && isTileIndex(o.sql) {
+			m.indexRoot = o.root
+			break
+		}
+	}
+
+	m.metadata = make(map[string]string)
+	if metadataRoot == 0 {
+		return nil
+	}
+	return m.db.walkTable(metadataRoot, func(_ int64, payload []byte) (bool, error) {
+		values, err := decodeRecord(payload)
+		if err != nil {
+			return false, err
+		}
+		name, _ := column(values, 0).(string)
+		switch v := column(values, 1).(type) {
+		case string:
+			m.metadata[name] = v
+		case int64:
+			m.metadata[name] = strconv.FormatInt(v, 10)
+		case float64:
+			m.metadata[name] = strconv.FormatFloat(v, 'g', -1, 64)
+		}
+		return true, nil
+	})
+}
+
+// scanTiles indexes the coordinates of every tile, for archives without a
+// tile index
+func (m *Reader) scanTiles() error {
+	m.rowids = make(map[[3]int64]int64)
+	return m.db.walkTable(m.tilesRoot, func(rowid int64, payload []byte) (bool, error) {
+		values, err := decodeRecord(payload)
+		if err != nil {
+			return false, err
+		}
+		coords, _, err := m.tileRow(values)
+		if err != nil {
+			return false, err
+		}
+		m.rowids[coords] = rowid
+		return true, nil
+	})
+}
+
+// readZoomRange sets the zoom range from the metadata, falling back to the
+// zooms of the first and last tiles
+func (m *Reader) readZoomRange() error {
+	minZoom, minErr := strconv.Atoi(m.metadata["minzoom"])
+	maxZoom, maxErr := strconv.Atoi(m.metadata["maxzoom"])
+	if minErr != nil || maxErr != nil {
+		var ok bool
+		if minZoom, maxZoom, ok = m.storedZoomRange(); !ok {
+			return errors.New("archive holds no tiles")
+		}
+	}
+	if minZoom < 0 || maxZoom > 30 || minZoom > maxZoom {
+		return fmt.Errorf("invalid zoom range %d-%d in archive metadata", minZoom, maxZoom)
+	}
+	m.minZoom, m.maxZoom = minZoom, maxZoom
+	return nil
+}
+
+// storedZoomRange returns the lowest and highest zoom of the stored tiles
+func (m *Reader) storedZoomRange() (minZoom, maxZoom int, ok bool) {
+	if m.indexRoot == 0 {
+		for coords := range m.rowids {
+			if !ok || int(coords[0]) < minZoom {
+				minZoom = int(coords[0])
+			}
+			if !ok || int(coords[0]) > maxZoom {
+				maxZoom = int(coords[0])
+			}
+			ok = true
+		}
+		return minZoom, maxZoom, ok
+	}
+
+	first, err := m.db.indexEdge(m.indexRoot, false)
+	if err != nil || first == nil {
+		return 0, 0, false
+	}
+	last, err := m.db.indexEdge(m.indexRoot, true)
+	if err != nil || last == nil {
+		return 0, 0, false
+	}
+	lo, ok1 := first[0].(int64)
+	hi, ok2 := last[0].(int64)
+	return int(lo), int(hi), ok1 && ok2
+}
+
+// tableColumns finds the positions of tileColumns in a CREATE TABLE
+// statement
+func tableColumns(sql string) ([4]int, error) {
+	var positions [4]int
+	defs := definitions(sql)
+	for i, name := range tileColumns {
+		positions[i] = -1
+		for j, def := range defs {
+			if strings.EqualFold(firstWord(def), name) {
+				positions[i] = j
+				break
+			}
+		}
+		if positions[i] < 0 {
+			return positions, fmt.Errorf("tiles table has no %s column", name)
+		}
+	}
+	return positions, nil
+}
+
+// isTileIndex reports whether a CREATE INDEX statement indexes exactly the
+// tile coordinates, in MBTiles order, so entries can be searched by them
+func isTileIndex(sql string) bool {
+	defs := definitions(sql)
+	if len(defs) != 3 {
+		return false
+	}
+	for i, def := range defs {
+		fields := strings.Fields(def)
+		if len(fields) == 0 || !strings.EqualFold(unquote(fields[0]), tileColumns[i]) {
+			return false
+		}
+		// A descending column would reverse the search order
+		if len(fields) > 1 && !strings.EqualFold(fields[len(fields)-1], "asc") {
+			return false
+		}
+	}
+	return true
+}
+
+// definitions splits the parenthesized list of a CREATE TABLE or CREATE
+// INDEX statement at its top-level commas
+func definitions(sql string) []string {
+	start := strings.Index(sql, "(")
+	end := strings.LastIndex(sql, ")")
+	if start < 0 || end < start {
+		return nil
+	}
+	var defs []string
+	depth, from := 0, start+1
+	for i := start + 1; i < end; i++ {
+		switch sql[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				defs = append(defs, strings.TrimSpace(sql[from:i]))
+				from = i + 1
+			}
+		}
+	}
+	return append(defs, strings.TrimSpace(sql[from:end]))
+}
+
+// firstWord returns the unquoted first word of a column definition
+func firstWord(def string) string {
+	fields := strings.Fields(def)
+	if len(fields) == 0 {
+		return ""
+	}
+	return unquote(fields[0])
+}
+
+// unquote strips SQL identifier quotes
+func unquote(s string) string {
+	if len(s) >= 2 {
+		switch {
+		case s[0] == '"' && s[len(s)-1] == '"', s[0] == '`' && s[len(s)-1] == '`', s[0] == '[' && s[len(s)-1] == ']':
+			return s[1 : len(s)-1]
+		}
+	}
+	return s
+}
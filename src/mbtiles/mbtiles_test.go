@@ -0,0 +1,302 @@
+package mbtiles
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// The archives in testdata are built by the SQL scripts next to them
+const (
+	testArchive        = "testdata/tiles.mbtiles"
+	testArchiveNoIndex = "testdata/noindex.mbtiles"
+	testArchiveNoZoom  = "testdata/nozoom.mbtiles"
+	testArchiveEmpty   = "testdata/empty.mbtiles"
+)
+
+// openTest opens path, closing it when the test ends
+func openTest(t *testing.T, path string) *Reader {
+	t.Helper()
+	r, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open(%s) failed: %v", path, err)
+	}
+	t.Cleanup(func() { r.Close() })
+	return r
+}
+
+func TestReader_Tile(t *testing.T) {
+	r := openTest(t, testArchive)
+
+	// Every stored tile reads back, with its rows flipped to XYZ
+	for z := range 5 {
+		for x := range 1 << z {
+			for y := range 1 << z {
+				data, err := r.Tile(z, x, y)
+				if err != nil {
+					t.Fatalf("Tile(%d, %d, %d) failed: %v", z, x, y, err)
+				}
+				if expect := fmt.Sprintf("tile %d/%d/%d", z, x, y); string(data) != expect {
+					t.Fatalf("Tile(%d, %d, %d) = %q, expected %q", z, x, y, data, expect)
+				}
+			}
+		}
+	}
+}
+
+func TestReader_TileOverflow(t *testing.T) {
+	r := openTest(t, testArchive)
+
+	data, err := r.Tile(5, 0, 0)
+	if err != nil {
+		t.Fatalf("Tile(5, 0, 0) failed: %v", err)
+	}
+	if !bytes.Equal(data, bytes.Repeat([]byte("a"), 3000)) {
+		t.Errorf("Expected 3000 bytes of 'a' from overflow pages, got %d bytes", len(data))
+	}
+}
+
+func TestReader_TileNotFound(t *testing.T) {
+	r := openTest(t, testArchive)
+
+	tests := []struct {
+		z, x, y int
+		name    string
+	}{
+		{5, 1, 0, "not stored"},
+		{6, 0, 0, "above the stored zooms"},
+		{1, 2, 0, "outside the grid"},
+		{-1, 0, 0, "negative zoom"},
+		{31, 0, 0, "zoom too high"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := r.Tile(tt.z, tt.x, tt.y); !errors.Is(err, ErrTileNotFound) {
+				t.Errorf("Expected ErrTileNotFound, got %v", err)
+			}
+		})
+	}
+}
+
+func TestReader_Metadata(t *testing.T) {
+	r := openTest(t, testArchive)
+
+	if f := r.Format(); f != "png" {
+		t.Errorf("Expected format png, got %q", f)
+	}
+	if minZoom, maxZoom := r.ZoomRange(); minZoom != 0 || maxZoom != 5 {
+		t.Errorf("Expected zoom range 0-5, got %d-%d", minZoom, maxZoom)
+	}
+	md := r.Metadata()
+	if md["name"] != "Test tiles" || md["attribution"] != "Test data" {
+		t.Errorf("Unexpected metadata: %v", md)
+	}
+
+	// The returned map is a copy
+	md["format"] = "jpg"
+	if f := r.Format(); f != "png" {
+		t.Errorf("Expected changing the metadata copy to leave the format, got %q", f)
+	}
+}
+
+func TestReader_NoIndex(t *testing.T) {
+	r := openTest(t, testArchiveNoIndex)
+
+	for _, tile := range [][3]int{{1, 0, 0}, {1, 1, 1}, {2, 3, 0}} {
+		data, err := r.Tile(tile[0], tile[1], tile[2])
+		if err != nil {
+			t.Fatalf("Tile(%v) failed: %v", tile, err)
+		}
+		if expect := fmt.Sprintf("tile %d/%d/%d", tile[0], tile[1], tile[2]); string(data) != expect {
+			t.Errorf("Tile(%v) = %q, expected %q", tile, data, expect)
+		}
+	}
+	if _, err := r.Tile(1, 1, 0); !errors.Is(err, ErrTileNotFound) {
+		t.Errorf("Expected ErrTileNotFound, got %v", err)
+	}
+
+	// Without minzoom and maxzoom metadata the stored tiles set the range
+	if minZoom, maxZoom := r.ZoomRange(); minZoom != 1 || maxZoom != 2 {
+		t.Errorf("Expected zoom range 1-2, got %d-%d", minZoom, maxZoom)
+	}
+	if f := r.Format(); f != "" {
+		t.Errorf("Expected no format, got %q", f)
+	}
+}
+
+func TestNewReader(t *testing.T) {
+	data, err := os.ReadFile(testArchive)
+	if err != nil {
+		t.Fatalf("Failed to read archive: %v", err)
+	}
+	r, err := NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("NewReader() failed: %v", err)
+	}
+	if tile, err := r.Tile(2, 1, 3); err != nil || string(tile) != "tile 2/1/3" {
+		t.Errorf("Tile(2, 1, 3) = %q, %v", tile, err)
+	}
+	if err := r.Close(); err != nil {
+		t.Errorf("Close() failed: %v", err)
+	}
+}
+
+func TestOpen_Invalid(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, data []byte) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+		return path
+	}
+	archive, err := os.ReadFile(testArchive)
+	if err != nil {
+		t.Fatalf("Failed to read archive: %v", err)
+	}
+
+	walPath := write("wal.mbtiles", archive)
+	write("wal.mbtiles-wal", []byte("pending"))
+
+	tests := []struct {
+		path string
+		name string
+	}{
+		{filepath.Join(dir, "missing.mbtiles"), "missing"},
+		{write("text.mbtiles", []byte("not a database")), "not SQLite"},
+		{write("truncated.mbtiles", archive[:1024]), "truncated"},
+		{walPath, "uncheckpointed WAL"},
+		{testArchiveEmpty, "no tiles and no zoom range"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := Open(tt.path)
+			if err == nil {
+				r.Close()
+				t.Fatal("Expected an error")
+			}
+		})
+	}
+}
+
+func TestReader_StoredZoomRange(t *testing.T) {
+	r := openTest(t, testArchiveNoZoom)
+
+	// Without minzoom and maxzoom metadata the first and last index entries
+	// set the range, found through the interior index pages
+	if minZoom, maxZoom := r.ZoomRange(); minZoom != 2 || maxZoom != 4 {
+		t.Errorf("Expected zoom range 2-4, got %d-%d", minZoom, maxZoom)
+	}
+	for _, tile := range [][3]int{{2, 0, 0}, {3, 5, 2}, {4, 15, 15}} {
+		data, err := r.Tile(tile[0], tile[1], tile[2])
+		if err != nil {
+			t.Fatalf("Tile(%v) failed: %v", tile, err)
+		}
+		if expect := fmt.Sprintf("tile %d/%d/%d", tile[0], tile[1], tile[2]); string(data) != expect {
+			t.Errorf("Tile(%v) = %q, expected %q", tile, data, expect)
+		}
+	}
+}
+
+func TestReader_TileRow(t *testing.T) {
+	m := &Reader{columns: [4]int{0, 1, 2, 3}}
+
+	tests := []struct {
+		values      []any
+		expectData  []byte
+		expectError bool
+		name        string
+	}{
+		{[]any{int64(1), int64(0), int64(1), []byte("png")}, []byte("png"), false, "blob"},
+		{[]any{int64(1), int64(0), int64(1), "png"}, []byte("png"), false, "text"},
+		{[]any{int64(1), int64(0), int64(1), nil}, nil, false, "null"},
+		{[]any{int64(1), int64(0), int64(1)}, nil, false, "added by ALTER TABLE"},
+		{[]any{int64(1), int64(0), int64(1), 1.5}, nil, true, "float data"},
+		{[]any{int64(1), "0", int64(1), []byte("png")}, nil, true, "text column"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			coords, data, err := m.tileRow(tt.values)
+			if tt.expectError {
+				if err == nil {
+					t.Error("Expected an error")
+				}
+				return
+			}
+			if err != nil || coords != [3]int64{1, 0, 1} || !bytes.Equal(data, tt.expectData) {
+				t.Errorf("tileRow() = %v, %q, %v, expected [1 0 1], %q", coords, data, err, tt.expectData)
+			}
+		})
+	}
+}
+
+func TestReader_TileCorrupt(t *testing.T) {
+	// Each case breaks the link between the tile index and the tiles table
+	// of a fresh reader
+	tests := []struct {
+		corrupt func(r *Reader)
+		name    string
+	}{
+		{func(r *Reader) { r.indexRoot = r.tilesRoot }, "index root is a table"},
+		{func(r *Reader) { r.tilesRoot = r.indexRoot }, "table root is an index"},
+		{func(r *Reader) {
+			r.indexRoot = 0
+			r.rowids = map[[3]int64]int64{{1, 0, 0}: 1 << 40}
+		}, "missing row"},
+		{func(r *Reader) {
+			r.indexRoot = 0
+			r.rowids = map[[3]int64]int64{{1, 0, 0}: 1}
+		}, "wrong row"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, _ := openCorruptible(t)
+			tt.corrupt(r)
+			if _, err := r.Tile(1, 0, 1); !errors.Is(err, errCorrupt) {
+				t.Errorf("Expected a malformed database error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestNewReader_Invalid(t *testing.T) {
+	// Each case rewrites bytes of testArchive, keeping its length
+	tests := []struct {
+		old, new    string
+		expectError string
+		name        string
+	}{
+		{"tabletilestiles", "tabletoolstools", "no tiles table", "no tiles table"},
+		{"tile_data blob", "tile_date blob", "no tile_data column", "missing column"},
+		{"minzoom0", "minzoom9", "invalid zoom range 9-5", "inverted zoom range"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := readArchive(t, testArchive)
+			i := bytes.Index(data, []byte(tt.old))
+			if i < 0 {
+				t.Fatalf("Expected %q in the archive", tt.old)
+			}
+			copy(data[i:], tt.new)
+			_, err := NewReader(bytes.NewReader(data), int64(len(data)))
+			if err == nil || !strings.Contains(err.Error(), tt.expectError) {
+				t.Errorf("Expected an error containing %q, got %v", tt.expectError, err)
+			}
+		})
+	}
+
+	// A reader shorter than the size it was given fails on the missing pages
+	data := readArchive(t, testArchive)
+	if _, err := NewReader(bytes.NewReader(data[:512]), int64(len(data))); err == nil {
+		t.Error("Expected an error for a short reader")
+	}
+}
@@ -0,0 +1,536 @@
+package mbtiles
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// This file reads the parts of the SQLite file format
+// (https://www.sqlite.org/fileformat.html) an MBTiles archive needs: table
+// and index b-trees, overflow pages and records. It never writes, and
+// ignores the freelist and pointer map pages.
+
+// sqliteMagic starts every SQLite database file
+const sqliteMagic = "SQLite format 3\x00"
+
+// maxTreeDepth bounds b-tree descent, so a corrupt file with a page cycle
+// fails instead of looping. Real trees are a handful of levels deep.
+const maxTreeDepth = 64
+
+// B-tree page types
+const (
+	pageIndexInterior = 0x02
+	pageTableInterior = 0x05
+	pageIndexLeaf     = 0x0a
+	pageTableLeaf     = 0x0d
+)
+
+// errCorrupt reports a database file that does not follow the format
+var errCorrupt = errors.New("malformed database file")
+
+// database is an open SQLite database file
+type database struct {
+	r         io.ReaderAt
+	pageSize  int
+	usable    int    // Page size less the reserved bytes at the end of each page
+	pageCount uint32 // Pages in the file, from its size
+}
+
+// openDatabase reads the header of the SQLite database in r
+func openDatabase(r io.ReaderAt, size int64) (*database, error) {
+	var header [100]byte
+	if _, err := r.ReadAt(header[:], 0); err != nil {
+		return nil, fmt.Errorf("not an SQLite database: %w", err)
+	}
+	if string(header[:16]) != sqliteMagic {
+		return nil, errors.New("not an SQLite database")
+	}
+
+	pageSize := int(binary.BigEndian.Uint16(header[16:]))
+	if pageSize == 1 {
+		pageSize = 65536
+	}
+	if pageSize < 512 || pageSize&(pageSize-1) != 0 {
+		return nil, fmt.Errorf("%w: invalid page size %d", errCorrupt, pageSize)
+	}
+	if enc := binary.BigEndian.Uint32(header[56:]); enc > 1 {
+		return nil, fmt.Errorf("unsupported text encoding %d (only UTF-8 is supported)", enc)
+	}
+
+	db := &database{
+		r:         r,
+		pageSize:  pageSize,
+		usable:    pageSize - int(header[20]),
+		pageCount: uint32(size / int64(pageSize)),
+	}
+	if db.usable < 480 {
+		return nil, fmt.Errorf("%w: usable page size %d is below 480", errCorrupt, db.usable)
+	}
+
+	// The page count in the header is only kept up to date by SQLite
+	// versions that also store the change counter it was written at
+	changes, validFor := binary.BigEndian.Uint32(header[24:]), binary.BigEndian.Uint32(header[92:])
+	if pages := binary.BigEndian.Uint32(header[28:]); changes == validFor && pages > db.pageCount {
+		return nil, fmt.Errorf("%w: file is truncated (%d of %d pages)", errCorrupt, db.pageCount, pages)
+	}
+	return db, nil
+}
+
+// page reads page number n, counting from 1
+func (db *database) page(n uint32) ([]byte, error) {
+	if n < 1 || n > db.pageCount {
+		return nil, fmt.Errorf("%w: page %d out of range", errCorrupt, n)
+	}
+	buf := make([]byte, db.pageSize)
+	if _, err := db.r.ReadAt(buf, int64(n-1)*int64(db.pageSize)); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// btreePage is a parsed b-tree page header
+type btreePage struct {
+	data      []byte
+	kind      byte
+	cells     []int  // Offsets of the cells in data, in key order
+	rightmost uint32 // Child with the largest keys; interior pages only
+}
+
+// btreePage reads page n as a b-tree page
+func (db *database) btreePage(n uint32) (*btreePage, error) {
+	data, err := db.page(n)
+	if err != nil {
+		return nil, err
+	}
+	start := 0
+	if n == 1 {
+		start = 100 // Page 1 starts with the database header
+	}
+	p := &btreePage{data: data, kind: data[start]}
+
+	headerSize := 8
+	switch p.kind {
+	case pageIndexInterior, pageTableInterior:
+		headerSize = 12
+		p.rightmost = binary.BigEndian.Uint32(data[start+8:])
+	case pageIndexLeaf, pageTableLeaf:
+	default:
+		return nil, fmt.Errorf("%w: page %d has unknown type %#x", errCorrupt, n, p.kind)
+	}
+
+	count := int(binary.BigEndian.Uint16(data[start+3:]))
+	pointers := start + headerSize
+	if pointers+2*count > db.usable {
+		return nil, fmt.Errorf("%w: page %d has too many cells", errCorrupt, n)
+	}
+	p.cells = make([]int, count)
+	for i := range p.cells {
+		off := int(binary.BigEndian.Uint16(data[pointers+2*i:]))
+		if off < pointers+2*count || off >= db.usable {
+			return nil, fmt.Errorf("%w: page %d has a cell outside the page", errCorrupt, n)
+		}
+		p.cells[i] = off
+	}
+	return p, nil
+}
+
+// cell is a parsed b-tree cell
+type cell struct {
+	child   uint32 // Left child; interior pages only
+	rowid   int64  // Table pages only
+	payload []byte // Record; nil on table interior pages
+}
+
+// cell parses the i-th cell of p, reading any overflow pages of its payload
+func (db *database) cell(p *btreePage, i int) (cell, error) {
+	var c cell
+	b := p.data[p.cells[i]:db.usable]
+
+	if p.kind == pageTableInterior || p.kind == pageIndexInterior {
+		if len(b) < 4 {
+			return c, errCorrupt
+		}
+		c.child = binary.BigEndian.Uint32(b)
+		b = b[4:]
+	}
+
+	var size uint64
+	if p.kind != pageTableInterior {
+		var n int
+		if size, n = varint(b); n == 0 {
+			return c, errCorrupt
+		}
+		b = b[n:]
+	}
+	if p.kind == pageTableInterior || p.kind == pageTableLeaf {
+		rowid, n := varint(b)
+		if n == 0 {
+			return c, errCorrupt
+		}
+		c.rowid = int64(rowid)
+		b = b[n:]
+	}
+	if p.kind == pageTableInterior {
+		return c, nil
+	}
+
+	payload, err := db.payload(b, size, p.kind == pageTableLeaf)
+	if err != nil {
+		return c, err
+	}
+	c.payload = payload
+	return c, nil
+}
+
+// payload assembles a cell payload of size bytes whose local part starts b,
+// following the overflow chain for the rest
+func (db *database) payload(b []byte, size uint64, tableLeaf bool) ([]byte, error) {
+	u := uint64(db.usable)
+	maxLocal := (u-12)*64/255 - 23
+	if tableLeaf {
+		maxLocal = u - 35
+	}
+	minLocal := (u-12)*32/255 - 23
+
+	local := size
+	if size > maxLocal {
+		local = minLocal + (size-minLocal)%(u-4)
+		if local > maxLocal {
+			local = minLocal
+		}
+	}
+	if uint64(len(b)) < local {
+		return nil, fmt.Errorf("%w: cell overflows its page", errCorrupt)
+	}
+	if size > uint64(db.pageCount)*u {
+		return nil, fmt.Errorf("%w: payload of %d bytes is larger than the file", errCorrupt, size)
+	}
+
+	out := make([]byte, 0, size)
+	out = append(out, b[:local]...)
+	if local == size {
+		return out, nil
+	}
+	if uint64(len(b)) < local+4 {
+		return nil, fmt.Errorf("%w: cell overflows its page", errCorrupt)
+	}
+
+	next := binary.BigEndian.Uint32(b[local:])
+	for pages := uint32(0); uint64(len(out)) < size; pages++ {
+		if next == 0 || pages > db.pageCount {
+			return nil, fmt.Errorf("%w: broken overflow chain", errCorrupt)
+		}
+		data, err := db.page(next)
+		if err != nil {
+			return nil, err
+		}
+		next = binary.BigEndian.Uint32(data)
+		n := min(size-uint64(len(out)), u-4)
+		out = append(out, data[4:4+n]...)
+	}
+	return out, nil
+}
+
+// walkTable calls fn with the rowid and record payload of every row of the
+// table b-tree rooted at page root, in rowid order, until fn returns false
+func (db *database) walkTable(root uint32, fn func(rowid int64, payload []byte) (bool, error)) error {
+	_, err := db.walkTablePage(root, 0, fn)
+	return err
+}
+
+func (db *database) walkTablePage(n uint32, depth int, fn func(int64, []byte) (bool, error)) (bool, error) {
+	if depth > maxTreeDepth {
+		return false, fmt.Errorf("%w: b-tree too deep", errCorrupt)
+	}
+	p, err := db.btreePage(n)
+	if err != nil {
+		return false, err
+	}
+	for i := range p.cells {
+		c, err := db.cell(p, i)
+		if err != nil {
+			return false, err
+		}
+		more := true
+		switch p.kind {
+		case pageTableInterior:
+			more, err = db.walkTablePage(c.child, depth+1, fn)
+		case pageTableLeaf:
+			more, err = fn(c.rowid, c.payload)
+		default:
+			err = fmt.Errorf("%w: page %d is not a table page", errCorrupt, n)
+		}
+		if err != nil || !more {
+			return false, err
+		}
+	}
+	if p.kind == pageTableInterior {
+		return db.walkTablePage(p.rightmost, depth+1, fn)
+	}
+	return true, nil
+}
+
+// findRow returns the record payload of the row with the given rowid in the
+// table b-tree rooted at page root, or nil if there is none
+func (db *database) findRow(root uint32, rowid int64) ([]byte, error) {
+	n := root
+	for depth := 0; depth <= maxTreeDepth; depth++ {
+		p, err := db.btreePage(n)
+		if err != nil {
+			return nil, err
+		}
+		if p.kind != pageTableInterior && p.kind != pageTableLeaf {
+			return nil, fmt.Errorf("%w: page %d is not a table page", errCorrupt, n)
+		}
+
+		// Interior cells hold the largest rowid of their left child
+		next := p.rightmost
+		for i := range p.cells {
+			c, err := db.cell(p, i)
+			if err != nil {
+				return nil, err
+			}
+			if p.kind == pageTableLeaf {
+				if c.rowid == rowid {
+					return c.payload, nil
+				}
+				continue
+			}
+			if rowid <= c.rowid {
+				next = c.child
+				break
+			}
+		}
+		if p.kind == pageTableLeaf {
+			return nil, nil
+		}
+		n = next
+	}
+	return nil, fmt.Errorf("%w: b-tree too deep", errCorrupt)
+}
+
+// findIndex searches the index b-tree rooted at page root for an entry whose
+// leading columns equal key, returning its decoded columns, or nil if there
+// is none
+func (db *database) findIndex(root uint32, key []int64) ([]any, error) {
+	n := root
+	for depth := 0; depth <= maxTreeDepth; depth++ {
+		p, err := db.btreePage(n)
+		if err != nil {
+			return nil, err
+		}
+		if p.kind != pageIndexInterior && p.kind != pageIndexLeaf {
+			return nil, fmt.Errorf("%w: page %d is not an index page", errCorrupt, n)
+		}
+
+		// Entries in interior cells sit between their left child and the
+		// next cell's, so the search stops at the first one not below key
+		next := p.rightmost
+		for i := range p.cells {
+			c, err := db.cell(p, i)
+			if err != nil {
+				return nil, err
+			}
+			values, err := decodeRecord(c.payload)
+			if err != nil {
+				return nil, err
+			}
+			cmp := compareKey(values, key)
+			if cmp == 0 {
+				return values, nil
+			}
+			if cmp > 0 {
+				next = c.child
+				break
+			}
+		}
+		if p.kind == pageIndexLeaf {
+			return nil, nil
+		}
+		n = next
+	}
+	return nil, fmt.Errorf("%w: b-tree too deep", errCorrupt)
+}
+
+// indexEdge returns the decoded columns of the first entry, or with last
+// set the last entry, of the index b-tree rooted at page root, or nil if
+// the index is empty
+func (db *database) indexEdge(root uint32, last bool) ([]any, error) {
+	n := root
+	for depth := 0; depth <= maxTreeDepth; depth++ {
+		p, err := db.btreePage(n)
+		if err != nil {
+			return nil, err
+		}
+		switch p.kind {
+		case pageIndexInterior:
+			if last {
+				n = p.rightmost
+				continue
+			}
+			if len(p.cells) == 0 {
+				return nil, fmt.Errorf("%w: interior page %d has no cells", errCorrupt, n)
+			}
+			c, err := db.cell(p, 0)
+			if err != nil {
+				return nil, err
+			}
+			n = c.child
+		case pageIndexLeaf:
+			if len(p.cells) == 0 {
+				return nil, nil
+			}
+			i := 0
+			if last {
+				i = len(p.cells) - 1
+			}
+			c, err := db.cell(p, i)
+			if err != nil {
+				return nil, err
+			}
+			return decodeRecord(c.payload)
+		default:
+			return nil, fmt.Errorf("%w: page %d is not an index page", errCorrupt, n)
+		}
+	}
+	return nil, fmt.Errorf("%w: b-tree too deep", errCorrupt)
+}
+
+// compareKey compares the leading columns of an index entry with key, in
+// SQLite's order: NULL sorts before numbers, and text and blobs after them
+func compareKey(values []any, key []int64) int {
+	for i, k := range key {
+		if i >= len(values) {
+			return -1
+		}
+		var v float64
+		switch x := values[i].(type) {
+		case nil:
+			return -1
+		case int64:
+			if x != k {
+				return cmpInt(x, k)
+			}
+			continue
+		case float64:
+			v = x
+		default:
+			return 1
+		}
+		if v != float64(k) {
+			if v < float64(k) {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// cmpInt compares two integers, returning -1, 0 or 1
+func cmpInt(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// decodeRecord decodes a record into its column values: nil, int64,
+// float64, string or []byte
+func decodeRecord(b []byte) ([]any, error) {
+	headerSize, n := varint(b)
+	if n == 0 || headerSize > uint64(len(b)) || headerSize < uint64(n) {
+		return nil, fmt.Errorf("%w: bad record header", errCorrupt)
+	}
+	header, body := b[n:headerSize], b[headerSize:]
+
+	var values []any
+	for len(header) > 0 {
+		serial, n := varint(header)
+		if n == 0 {
+			return nil, fmt.Errorf("%w: bad record header", errCorrupt)
+		}
+		header = header[n:]
+
+		size := serialSize(serial)
+		if uint64(len(body)) < size {
+			return nil, fmt.Errorf("%w: record shorter than its header", errCorrupt)
+		}
+		field := body[:size]
+		body = body[size:]
+
+		switch {
+		case serial == 0:
+			values = append(values, nil)
+		case serial <= 6:
+			values = append(values, bigEndianInt(field))
+		case serial == 7:
+			values = append(values, math.Float64frombits(binary.BigEndian.Uint64(field)))
+		case serial == 8:
+			values = append(values, int64(0))
+		case serial == 9:
+			values = append(values, int64(1))
+		case serial >= 12 && serial%2 == 0:
+			values = append(values, bytes.Clone(field))
+		case serial >= 13:
+			values = append(values, string(field))
+		default:
+			return nil, fmt.Errorf("%w: reserved serial type %d", errCorrupt, serial)
+		}
+	}
+	return values, nil
+}
+
+// serialSize returns the size in bytes of a value of the given serial type
+func serialSize(serial uint64) uint64 {
+	switch serial {
+	case 1, 2, 3, 4:
+		return serial
+	case 5:
+		return 6
+	case 6, 7:
+		return 8
+	}
+	if serial >= 12 {
+		return (serial - 12) / 2
+	}
+	return 0
+}
+
+// bigEndianInt decodes a big-endian two's complement integer of 1 to 8 bytes
+func bigEndianInt(b []byte) int64 {
+	var v int64
+	if len(b) > 0 && b[0]&0x80 != 0 {
+		v = -1
+	}
+	for _, c := range b {
+		v = v<<8 | int64(c)
+	}
+	return v
+}
+
+// varint decodes an SQLite variable-length integer, returning it and its
+// length in bytes, or a length of 0 if b is too short
+func varint(b []byte) (uint64, int) {
+	var v uint64
+	for i := 0; i < 8; i++ {
+		if i >= len(b) {
+			return 0, 0
+		}
+		v = v<<7 | uint64(b[i]&0x7f)
+		if b[i]&0x80 == 0 {
+			return v, i + 1
+		}
+	}
+	if len(b) < 9 {
+		return 0, 0
+	}
+	return v<<8 | uint64(b[8]), 9
+}
@@ -0,0 +1,534 @@
+package mbtiles
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestVarint(t *testing.T) {
+	tests := []struct {
+		in         []byte
+		expect     uint64
+		expectSize int
+		name       string
+	}{
+		{[]byte{0x00}, 0, 1, "zero"},
+		{[]byte{0x7f}, 127, 1, "one byte"},
+		{[]byte{0x81, 0x00}, 128, 2, "two bytes"},
+		{[]byte{0x82, 0x80, 0x01}, 0x8001, 3, "three bytes"},
+		{bytes.Repeat([]byte{0xff}, 9), 0xffffffffffffffff, 9, "nine bytes"},
+		{[]byte{0x81}, 0, 0, "truncated"},
+		{bytes.Repeat([]byte{0xff}, 8), 0, 0, "truncated ninth byte"},
+		{nil, 0, 0, "empty"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, n := varint(tt.in)
+			if v != tt.expect || n != tt.expectSize {
+				t.Errorf("varint(%x) = %d, %d, expected %d, %d", tt.in, v, n, tt.expect, tt.expectSize)
+			}
+		})
+	}
+}
+
+func TestDecodeRecord(t *testing.T) {
+	// Header of 9 bytes: NULL, 1-byte int, 2-byte int, 0, 1, float,
+	// 3-byte blob, 2-byte text
+	record := []byte{
+		0x09, 0x00, 0x01, 0x02, 0x08, 0x09, 0x07, 0x12, 0x11,
+		0xfe,
+		0x01, 0x00,
+		0x40, 0x09, 0x21, 0xfb, 0x54, 0x44, 0x2d, 0x18,
+		'a', 'b', 'c',
+		'h', 'i',
+	}
+	values, err := decodeRecord(record)
+	if err != nil {
+		t.Fatalf("decodeRecord() failed: %v", err)
+	}
+	expect := []any{nil, int64(-2), int64(256), int64(0), int64(1), 3.141592653589793, []byte("abc"), "hi"}
+	if !reflect.DeepEqual(values, expect) {
+		t.Errorf("decodeRecord() = %#v, expected %#v", values, expect)
+	}
+
+	if _, err := decodeRecord(record[:len(record)-1]); err == nil {
+		t.Error("Expected an error for a record shorter than its header")
+	}
+}
+
+func TestCompareKey(t *testing.T) {
+	tests := []struct {
+		values []any
+		key    []int64
+		expect int
+		name   string
+	}{
+		{[]any{int64(1), int64(2), int64(3), int64(9)}, []int64{1, 2, 3}, 0, "equal"},
+		{[]any{int64(1), int64(2), int64(2)}, []int64{1, 2, 3}, -1, "less"},
+		{[]any{int64(2), int64(0), int64(0)}, []int64{1, 2, 3}, 1, "greater"},
+		{[]any{nil, int64(0), int64(0)}, []int64{1, 2, 3}, -1, "null first"},
+		{[]any{"1", int64(0), int64(0)}, []int64{1, 2, 3}, 1, "text last"},
+		{[]any{1.5, int64(0), int64(0)}, []int64{1, 2, 3}, 1, "float"},
+		{[]any{0.5, int64(0), int64(0)}, []int64{1, 2, 3}, -1, "smaller float"},
+		{[]any{1.0, int64(2), int64(3)}, []int64{1, 2, 3}, 0, "equal float"},
+		{[]any{int64(1), int64(2)}, []int64{1, 2, 3}, -1, "prefix"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := compareKey(tt.values, tt.key); got != tt.expect {
+				t.Errorf("compareKey(%v, %v) = %d, expected %d", tt.values, tt.key, got, tt.expect)
+			}
+		})
+	}
+}
+
+func TestIsTileIndex(t *testing.T) {
+	tests := []struct {
+		sql    string
+		expect bool
+		name   string
+	}{
+		{"CREATE UNIQUE INDEX tile_index on tiles (zoom_level, tile_column, tile_row)", true, "mbutil"},
+		{`CREATE INDEX i ON "tiles" ("zoom_level" ASC, [tile_column], tile_row)`, true, "quoted"},
+		{"CREATE INDEX i ON tiles (tile_row, tile_column, zoom_level)", false, "reordered"},
+		{"CREATE INDEX i ON tiles (zoom_level, tile_column, tile_row DESC)", false, "descending"},
+		{"CREATE INDEX i ON tiles (zoom_level)", false, "partial"},
+		{"", false, "autoindex"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isTileIndex(tt.sql); got != tt.expect {
+				t.Errorf("isTileIndex(%q) = %v, expected %v", tt.sql, got, tt.expect)
+			}
+		})
+	}
+}
+
+func TestTableColumns(t *testing.T) {
+	positions, err := tableColumns("CREATE TABLE tiles (tile_data blob, zoom_level integer, tile_row integer, tile_column integer, UNIQUE (zoom_level, tile_column, tile_row))")
+	if err != nil {
+		t.Fatalf("tableColumns() failed: %v", err)
+	}
+	if positions != [4]int{1, 3, 2, 0} {
+		t.Errorf("Expected positions [1 3 2 0], got %v", positions)
+	}
+
+	if _, err := tableColumns("CREATE TABLE tiles (zoom_level, tile_column, tile_row)"); err == nil {
+		t.Error("Expected an error for a table without tile_data")
+	}
+}
+
+// readArchive returns the bytes of the archive at path
+func readArchive(t *testing.T, path string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read archive: %v", err)
+	}
+	return data
+}
+
+// openCorruptible opens a copy of testArchive, returning the reader and the
+// bytes it reads, which a test may corrupt afterwards
+func openCorruptible(t *testing.T) (*Reader, []byte) {
+	t.Helper()
+	data := readArchive(t, testArchive)
+	r, err := NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("NewReader() failed: %v", err)
+	}
+	return r, data
+}
+
+// pageHeader returns the offset in the file of page n's b-tree header
+func pageHeader(db *database, n uint32) int {
+	off := int(n-1) * db.pageSize
+	if n == 1 {
+		off += 100
+	}
+	return off
+}
+
+// cellPointer returns the offset in the file of the i-th cell pointer of
+// interior page n
+func cellPointer(db *database, n uint32, i int) int {
+	return pageHeader(db, n) + 12 + 2*i
+}
+
+// leftmostLeaf returns the first leaf page of the b-tree rooted at root
+func leftmostLeaf(t *testing.T, db *database, root uint32) uint32 {
+	t.Helper()
+	n := root
+	for {
+		p, err := db.btreePage(n)
+		if err != nil {
+			t.Fatalf("btreePage(%d) failed: %v", n, err)
+		}
+		if p.kind == pageTableLeaf || p.kind == pageIndexLeaf {
+			return n
+		}
+		c, err := db.cell(p, 0)
+		if err != nil {
+			t.Fatalf("cell() of page %d failed: %v", n, err)
+		}
+		n = c.child
+	}
+}
+
+func TestCorruptPages(t *testing.T) {
+	// Each corruption is applied to a fresh copy of testArchive, whose
+	// tiles table and index both have interior root pages
+	tests := []struct {
+		corrupt func(t *testing.T, r *Reader, data []byte)
+		read    func(r *Reader) error
+		name    string
+	}{
+		{
+			func(t *testing.T, r *Reader, data []byte) {
+				binary.BigEndian.PutUint32(data[pageHeader(r.db, r.tilesRoot)+8:], r.tilesRoot)
+			},
+			walkAll,
+			"table page cycle",
+		},
+		{
+			func(t *testing.T, r *Reader, data []byte) {
+				binary.BigEndian.PutUint32(data[pageHeader(r.db, r.tilesRoot)+8:], 1000)
+			},
+			walkAll,
+			"table child out of range",
+		},
+		{
+			func(t *testing.T, r *Reader, data []byte) {
+				binary.BigEndian.PutUint32(data[pageHeader(r.db, r.tilesRoot)+8:], r.indexRoot)
+			},
+			walkAll,
+			"index page in a table",
+		},
+		{
+			func(t *testing.T, r *Reader, data []byte) {
+				data[pageHeader(r.db, r.tilesRoot)] = 0x42
+			},
+			walkAll,
+			"unknown page type",
+		},
+		{
+			func(t *testing.T, r *Reader, data []byte) {
+				binary.BigEndian.PutUint16(data[pageHeader(r.db, r.tilesRoot)+3:], 0xffff)
+			},
+			walkAll,
+			"too many cells",
+		},
+		{
+			func(t *testing.T, r *Reader, data []byte) {
+				binary.BigEndian.PutUint16(data[cellPointer(r.db, r.tilesRoot, 0):], 1)
+			},
+			walkAll,
+			"cell pointer into the header",
+		},
+		{
+			func(t *testing.T, r *Reader, data []byte) {
+				binary.BigEndian.PutUint16(data[cellPointer(r.db, r.tilesRoot, 0):], uint16(r.db.usable-2))
+			},
+			walkAll,
+			"truncated interior cell",
+		},
+		{
+			func(t *testing.T, r *Reader, data []byte) {
+				leaf := leftmostLeaf(t, r.db, r.tilesRoot)
+				binary.BigEndian.PutUint16(data[pageHeader(r.db, leaf)+8:], uint16(r.db.usable-1))
+				data[int(leaf)*r.db.pageSize-1] = 0xff
+			},
+			walkAll,
+			"truncated leaf cell",
+		},
+		{
+			func(t *testing.T, r *Reader, data []byte) {
+				binary.BigEndian.PutUint32(data[pageHeader(r.db, r.tilesRoot)+8:], r.tilesRoot)
+			},
+			func(r *Reader) error {
+				_, err := r.db.findRow(r.tilesRoot, 1<<40)
+				return err
+			},
+			"table page cycle searching",
+		},
+		{
+			func(t *testing.T, r *Reader, data []byte) {
+				binary.BigEndian.PutUint16(data[cellPointer(r.db, r.tilesRoot, 0):], uint16(r.db.usable-2))
+			},
+			func(r *Reader) error {
+				_, err := r.db.findRow(r.tilesRoot, 1)
+				return err
+			},
+			"truncated cell searching a table",
+		},
+		{
+			func(t *testing.T, r *Reader, data []byte) {},
+			func(r *Reader) error {
+				_, err := r.db.findRow(r.indexRoot, 1)
+				return err
+			},
+			"index searched as a table",
+		},
+		{
+			func(t *testing.T, r *Reader, data []byte) {
+				binary.BigEndian.PutUint32(data[pageHeader(r.db, r.indexRoot)+8:], r.indexRoot)
+			},
+			func(r *Reader) error {
+				_, err := r.db.findIndex(r.indexRoot, []int64{30, 0, 0})
+				return err
+			},
+			"index page cycle searching",
+		},
+		{
+			func(t *testing.T, r *Reader, data []byte) {
+				binary.BigEndian.PutUint16(data[cellPointer(r.db, r.indexRoot, 0):], uint16(r.db.usable-2))
+			},
+			func(r *Reader) error {
+				_, err := r.db.findIndex(r.indexRoot, []int64{0, 0, 0})
+				return err
+			},
+			"truncated cell searching an index",
+		},
+		{
+			func(t *testing.T, r *Reader, data []byte) {},
+			func(r *Reader) error {
+				_, err := r.db.findIndex(r.tilesRoot, []int64{0, 0, 0})
+				return err
+			},
+			"table searched as an index",
+		},
+		{
+			func(t *testing.T, r *Reader, data []byte) {
+				binary.BigEndian.PutUint32(data[pageHeader(r.db, r.indexRoot)+8:], r.indexRoot)
+			},
+			func(r *Reader) error {
+				_, err := r.db.indexEdge(r.indexRoot, true)
+				return err
+			},
+			"index page cycle to the last entry",
+		},
+		{
+			func(t *testing.T, r *Reader, data []byte) {
+				binary.BigEndian.PutUint16(data[cellPointer(r.db, r.indexRoot, 0):], uint16(r.db.usable-2))
+			},
+			func(r *Reader) error {
+				_, err := r.db.indexEdge(r.indexRoot, false)
+				return err
+			},
+			"truncated interior cell to the first entry",
+		},
+		{
+			func(t *testing.T, r *Reader, data []byte) {
+				binary.BigEndian.PutUint16(data[pageHeader(r.db, r.indexRoot)+3:], 0)
+			},
+			func(r *Reader) error {
+				_, err := r.db.indexEdge(r.indexRoot, false)
+				return err
+			},
+			"empty interior page to the first entry",
+		},
+		{
+			func(t *testing.T, r *Reader, data []byte) {
+				leaf := leftmostLeaf(t, r.db, r.indexRoot)
+				binary.BigEndian.PutUint16(data[pageHeader(r.db, leaf)+8:], uint16(r.db.usable-1))
+				data[int(leaf)*r.db.pageSize-1] = 0xff
+			},
+			func(r *Reader) error {
+				_, err := r.db.indexEdge(r.indexRoot, false)
+				return err
+			},
+			"truncated leaf cell at the first entry",
+		},
+		{
+			func(t *testing.T, r *Reader, data []byte) {
+				binary.BigEndian.PutUint32(data[pageHeader(r.db, r.indexRoot)+8:], 1000)
+			},
+			func(r *Reader) error {
+				_, err := r.db.indexEdge(r.indexRoot, true)
+				return err
+			},
+			"index child out of range",
+		},
+		{
+			func(t *testing.T, r *Reader, data []byte) {},
+			func(r *Reader) error {
+				_, err := r.db.indexEdge(r.tilesRoot, false)
+				return err
+			},
+			"table read as an index",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, data := openCorruptible(t)
+			tt.corrupt(t, r, data)
+			if err := tt.read(r); !errors.Is(err, errCorrupt) {
+				t.Errorf("Expected a malformed database error, got %v", err)
+			}
+		})
+	}
+}
+
+// walkAll walks every row of the tiles table
+func walkAll(r *Reader) error {
+	return r.db.walkTable(r.tilesRoot, func(int64, []byte) (bool, error) { return true, nil })
+}
+
+func TestWalkTable_Stop(t *testing.T) {
+	r, _ := openCorruptible(t)
+
+	// Rows are visited across leaves until the callback stops the walk
+	var rows int
+	err := r.db.walkTable(r.tilesRoot, func(int64, []byte) (bool, error) {
+		rows++
+		return rows < 100, nil
+	})
+	if err != nil || rows != 100 {
+		t.Errorf("Expected the walk to stop after 100 rows, got %d rows and %v", rows, err)
+	}
+
+	errStop := errors.New("stop")
+	err = r.db.walkTable(r.tilesRoot, func(int64, []byte) (bool, error) { return true, errStop })
+	if !errors.Is(err, errStop) {
+		t.Errorf("Expected the callback's error, got %v", err)
+	}
+}
+
+func TestStoredZoomRange_CorruptIndex(t *testing.T) {
+	tests := []struct {
+		corrupt func(r *Reader, data []byte)
+		name    string
+	}{
+		{func(r *Reader, data []byte) { data[pageHeader(r.db, r.indexRoot)] = 0x42 }, "first entry unreadable"},
+		{func(r *Reader, data []byte) {
+			binary.BigEndian.PutUint32(data[pageHeader(r.db, r.indexRoot)+8:], 1000)
+		}, "last entry unreadable"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, data := openCorruptible(t)
+			tt.corrupt(r, data)
+			if _, _, ok := r.storedZoomRange(); ok {
+				t.Error("Expected no zoom range from a corrupt index")
+			}
+		})
+	}
+}
+
+func TestOpenDatabase_Invalid(t *testing.T) {
+	tests := []struct {
+		corrupt     func(header []byte)
+		expectError string
+		name        string
+	}{
+		{func(header []byte) { header[0] = 's' }, "not an SQLite database", "magic"},
+		{func(header []byte) { binary.BigEndian.PutUint16(header[16:], 1000) }, "invalid page size 1000", "page size not a power of two"},
+		{func(header []byte) { binary.BigEndian.PutUint16(header[16:], 256) }, "invalid page size 256", "page size too small"},
+		{func(header []byte) { binary.BigEndian.PutUint16(header[16:], 1) }, "truncated", "65536 byte pages"},
+		{func(header []byte) { binary.BigEndian.PutUint32(header[56:], 3) }, "unsupported text encoding 3", "UTF-16"},
+		{func(header []byte) { header[20] = 64 }, "usable page size 448", "reserved bytes"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := readArchive(t, testArchive)
+			tt.corrupt(data[:100])
+			_, err := openDatabase(bytes.NewReader(data), int64(len(data)))
+			if err == nil || !strings.Contains(err.Error(), tt.expectError) {
+				t.Errorf("Expected an error containing %q, got %v", tt.expectError, err)
+			}
+		})
+	}
+
+	if _, err := openDatabase(bytes.NewReader([]byte(sqliteMagic)), int64(len(sqliteMagic))); err == nil {
+		t.Error("Expected an error for a file shorter than the header")
+	}
+}
+
+func TestPayload_CorruptOverflow(t *testing.T) {
+	// Tile 5/0/0 is the last row, in the rightmost leaf, and its 3000 bytes
+	// of 'a' run from its page into an overflow chain whose first page
+	// number follows them
+	tests := []struct {
+		next uint32
+		name string
+	}{
+		{0, "chain ends early"},
+		{1000, "page out of range"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, data := openCorruptible(t)
+			n := r.tilesRoot
+			for {
+				p, err := r.db.btreePage(n)
+				if err != nil {
+					t.Fatalf("btreePage(%d) failed: %v", n, err)
+				}
+				if p.kind == pageTableLeaf {
+					break
+				}
+				n = p.rightmost
+			}
+			page := data[int(n-1)*r.db.pageSize : int(n)*r.db.pageSize]
+			start := bytes.IndexByte(page, 'a')
+			end := start + bytes.IndexFunc(page[start:], func(c rune) bool { return c != 'a' })
+			binary.BigEndian.PutUint32(page[end:], tt.next)
+
+			if _, err := r.Tile(5, 0, 0); !errors.Is(err, errCorrupt) {
+				t.Errorf("Expected a malformed database error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestPayload_Oversized(t *testing.T) {
+	db := &database{pageSize: 512, usable: 512, pageCount: 2}
+
+	// Larger than the local part left on the page
+	if _, err := db.payload(make([]byte, 100), 200, true); !errors.Is(err, errCorrupt) {
+		t.Errorf("Expected a malformed database error for a short cell, got %v", err)
+	}
+	// Larger than the whole file
+	if _, err := db.payload(make([]byte, 500), 1<<20, true); !errors.Is(err, errCorrupt) {
+		t.Errorf("Expected a malformed database error for a huge payload, got %v", err)
+	}
+	// Spilling to an overflow page with no room left for its number, after
+	// the 92 bytes kept locally
+	if _, err := db.payload(make([]byte, 94), 600, true); !errors.Is(err, errCorrupt) {
+		t.Errorf("Expected a malformed database error without an overflow page number, got %v", err)
+	}
+}
+
+func TestDecodeRecord_Invalid(t *testing.T) {
+	tests := []struct {
+		record []byte
+		name   string
+	}{
+		{nil, "empty"},
+		{[]byte{0x05, 0x01}, "header longer than the record"},
+		{[]byte{0x00}, "header shorter than its size"},
+		{[]byte{0x02, 0x81}, "truncated serial type"},
+		{[]byte{0x02, 0x0a}, "reserved serial type"},
+		{[]byte{0x02, 0x05, 0x00}, "6-byte integer cut short"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := decodeRecord(tt.record); !errors.Is(err, errCorrupt) {
+				t.Errorf("Expected a malformed database error, got %v", err)
+			}
+		})
+	}
+}
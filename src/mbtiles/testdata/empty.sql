@@ -0,0 +1,7 @@
+-- Builds empty.mbtiles, an archive with a tile index but no tiles and no
+-- metadata zoom range:
+--
+--   sqlite3 empty.mbtiles < empty.sql
+CREATE TABLE metadata (name text, value text);
+CREATE TABLE tiles (zoom_level integer, tile_column integer, tile_row integer, tile_data blob);
+CREATE UNIQUE INDEX tile_index ON tiles (zoom_level, tile_column, tile_row);
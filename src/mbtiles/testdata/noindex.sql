@@ -0,0 +1,12 @@
+-- Builds noindex.mbtiles, an archive without a tile index, metadata zoom
+-- range or format, and with the columns of the tiles table reordered:
+--
+--   sqlite3 noindex.mbtiles < noindex.sql
+CREATE TABLE metadata (name text, value text);
+CREATE TABLE tiles (tile_data blob, tile_row integer, tile_column integer, zoom_level integer);
+
+INSERT INTO metadata VALUES ('name', 'No index');
+INSERT INTO tiles VALUES
+    (CAST('tile 1/0/0' AS BLOB), 1, 0, 1),
+    (CAST('tile 1/1/1' AS BLOB), 0, 1, 1),
+    (CAST('tile 2/3/0' AS BLOB), 3, 3, 2);
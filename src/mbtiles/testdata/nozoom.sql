@@ -0,0 +1,22 @@
+-- Builds nozoom.mbtiles, an archive with a tile index but no metadata zoom
+-- range, so the range is read from the first and last index entries:
+--
+--   sqlite3 nozoom.mbtiles < nozoom.sql
+--
+-- Zooms 2-4 are stored, with the largest tiles last, and the small page
+-- size makes the index several levels deep.
+PRAGMA page_size = 512;
+
+CREATE TABLE metadata (name text, value text);
+CREATE TABLE tiles (zoom_level integer, tile_column integer, tile_row integer, tile_data blob);
+CREATE UNIQUE INDEX tile_index ON tiles (zoom_level, tile_column, tile_row);
+
+INSERT INTO metadata VALUES ('name', 'No zoom range');
+
+WITH RECURSIVE
+    zooms(z) AS (SELECT 2 UNION ALL SELECT z + 1 FROM zooms WHERE z < 4),
+    coords(n) AS (SELECT 0 UNION ALL SELECT n + 1 FROM coords WHERE n < 15)
+INSERT INTO tiles
+SELECT z, x.n, (1 << z) - 1 - y.n, CAST(printf('tile %d/%d/%d', z, x.n, y.n) AS BLOB)
+FROM zooms, coords AS x, coords AS y
+WHERE x.n < (1 << z) AND y.n < (1 << z);
@@ -0,0 +1,31 @@
+-- Builds tiles.mbtiles, the archive the tests read:
+--
+--   sqlite3 tiles.mbtiles < tiles.sql
+--
+-- Every tile of zooms 0-4 holds the text "tile z/x/y" in XYZ numbering, so
+-- tests can tell the TMS row flip went right. Tile 5/0/0 holds 3000 bytes,
+-- enough to spill onto overflow pages, and the small page size makes the
+-- b-trees several levels deep.
+PRAGMA page_size = 512;
+
+CREATE TABLE metadata (name text, value text);
+CREATE TABLE tiles (zoom_level integer, tile_column integer, tile_row integer, tile_data blob);
+CREATE UNIQUE INDEX tile_index ON tiles (zoom_level, tile_column, tile_row);
+
+INSERT INTO metadata VALUES
+    ('name', 'Test tiles'),
+    ('format', 'png'),
+    ('minzoom', '0'),
+    ('maxzoom', '5'),
+    ('bounds', '-180,-85.05112878,180,85.05112878'),
+    ('attribution', 'Test data');
+
+WITH RECURSIVE
+    zooms(z) AS (SELECT 0 UNION ALL SELECT z + 1 FROM zooms WHERE z < 4),
+    coords(n) AS (SELECT 0 UNION ALL SELECT n + 1 FROM coords WHERE n < 15)
+INSERT INTO tiles
+SELECT z, x.n, (1 << z) - 1 - y.n, CAST(printf('tile %d/%d/%d', z, x.n, y.n) AS BLOB)
+FROM zooms, coords AS x, coords AS y
+WHERE x.n < (1 << z) AND y.n < (1 << z);
+
+INSERT INTO tiles VALUES (5, 0, 31, CAST(printf('%.3000c', 'a') AS BLOB));
@@ -1,20 +1,42 @@
 package resources
 
 import (
-	_ "embed"
+	"embed"
+	"io/fs"
 )
 
+//go:generate go run gen_leaflet.go
+
 // DefaultWorldMap contains the embedded Blue Marble world map image
 // This is embedded at compile time from the res/ directory
 //
 //go:embed world.topo.200407.3x5400x2700.jpg
 var DefaultWorldMap []byte
 
-// ViewerHTML contains the embedded Leaflet viewer HTML
+// DefaultWorldMapAttribution credits the embedded map's imagery
+const DefaultWorldMapAttribution = "Map data: NASA Blue Marble"
+
+// ViewerHTML contains the embedded Leaflet viewer HTML.
+// It is an html/template rendered by the server with per-request settings.
 //
 //go:embed viewer.html
 var ViewerHTML string
 
+// assets holds static files served under /assets/, such as Leaflet once
+// fetched with go generate
+//
+//go:embed assets
+var assets embed.FS
+
+// Assets returns the embedded static assets, rooted at the assets directory
+func Assets() fs.FS {
+	sub, err := fs.Sub(assets, "assets")
+	if err != nil {
+		panic(err) // The directory is embedded, so this cannot fail
+	}
+	return sub
+}
+
 // HasEmbeddedMap returns true if the default world map is embedded
 func HasEmbeddedMap() bool {
 	return len(DefaultWorldMap) > 0
@@ -1,6 +1,10 @@
 package resources
 
 import (
+	"crypto/sha256"
+	"encoding/base64"
+	"io/fs"
+	"regexp"
 	"strings"
 	"testing"
 )
@@ -66,3 +70,42 @@ func TestViewerHTML(t *testing.T) {
 
 	t.Logf("Viewer HTML size: %d bytes", len(ViewerHTML))
 }
+
+func TestAssets(t *testing.T) {
+	if _, err := fs.Stat(Assets(), "README.md"); err != nil {
+		t.Errorf("Expected assets to be rooted at the assets directory: %v", err)
+	}
+}
+
+// cdnLeaflet matches the unpkg fallback tags in the viewer, capturing each
+// file's name and the sha256 digest it is pinned to
+var cdnLeaflet = regexp.MustCompile(`(?:src|href)="https://unpkg\.com/leaflet@[\d.]+/dist/([\w.]+)"\s+integrity="sha256-([^"]+)"`)
+
+func TestAssets_Leaflet(t *testing.T) {
+	assets := Assets()
+	if _, err := fs.Stat(assets, "leaflet/leaflet.js"); err != nil {
+		t.Skip("Leaflet is not vendored; run go generate ./src/resources and commit src/resources/assets/leaflet/")
+	}
+
+	// The vendored release is the one the CDN fallback pins
+	pins := cdnLeaflet.FindAllStringSubmatch(ViewerHTML, -1)
+	if len(pins) != 2 {
+		t.Fatalf("Expected leaflet.js and leaflet.css pinned in the viewer, found %d", len(pins))
+	}
+	for _, pin := range pins {
+		data, err := fs.ReadFile(assets, "leaflet/"+pin[1])
+		if err != nil {
+			t.Errorf("Expected %s to be vendored: %v", pin[1], err)
+			continue
+		}
+		sum := sha256.Sum256(data)
+		if got := base64.StdEncoding.EncodeToString(sum[:]); got != pin[2] {
+			t.Errorf("Expected %s to have sha256 %s, got %s", pin[1], pin[2], got)
+		}
+	}
+	for _, name := range []string{"layers.png", "layers-2x.png", "marker-icon.png", "marker-icon-2x.png", "marker-shadow.png"} {
+		if _, err := fs.Stat(assets, "leaflet/images/"+name); err != nil {
+			t.Errorf("Expected images/%s to be vendored: %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+//go:build ignore
+
+// gen_leaflet downloads the Leaflet release the viewer uses into
+// assets/leaflet/, so it is embedded in the binary and the viewer works
+// without internet access. Run it with go generate from this directory.
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+const leafletBaseURL = "https://unpkg.com/leaflet@1.9.4/dist/"
+
+// leafletFiles maps each file to its expected SRI sha256 digest, or "" for
+// files not pinned by the viewer
+var leafletFiles = map[string]string{
+	"leaflet.js":                "20nQCchB9co0qIjJZRGuk2/Z9VM+kNiyxNV1lvTlZBo=",
+	"leaflet.css":               "p4NxAoJBhIIN+hmNHrzRCf9tD/miZyoHS5obTRR9BMY=",
+	"images/layers.png":         "",
+	"images/layers-2x.png":      "",
+	"images/marker-icon.png":    "",
+	"images/marker-icon-2x.png": "",
+	"images/marker-shadow.png":  "",
+}
+
+func main() {
+	for name, digest := range leafletFiles {
+		if err := fetch(name, digest); err != nil {
+			fmt.Fprintln(os.Stderr, "gen_leaflet:", err)
+			os.Exit(1)
+		}
+	}
+}
+
+// fetch downloads name into assets/leaflet/, verifying its digest if one is given
+func fetch(name, digest string) error {
+	resp, err := http.Get(leafletBaseURL + name)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", name, resp.Status)
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	if digest != "" {
+		sum := sha256.Sum256(data)
+		if got := base64.StdEncoding.EncodeToString(sum[:]); got != digest {
+			return fmt.Errorf("%s: sha256 %s does not match pinned %s", name, got, digest)
+		}
+	}
+
+	path := filepath.Join("assets", "leaflet", filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
@@ -0,0 +1,160 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Access log formats accepted by Config.AccessLogFormat
+const (
+	AccessLogCombined = "combined" // Apache/NCSA Combined Log Format plus request duration and ID
+	AccessLogCommon   = "common"   // NCSA Common Log Format plus request duration and ID
+	AccessLogJSON     = "json"     // One JSON object per line
+)
+
+// accessLogger writes one line per request in the configured format
+type accessLogger struct {
+	mu         sync.Mutex
+	w          io.Writer
+	format     string
+	trustProxy bool
+}
+
+// newAccessLogger returns a logger writing to w, or an error for an unknown format.
+// An empty format selects AccessLogCombined.
+func newAccessLogger(w io.Writer, format string, trustProxy bool) (*accessLogger, error) {
+	switch format {
+	case "":
+		format = AccessLogCombined
+	case AccessLogCombined, AccessLogCommon, AccessLogJSON:
+	default:
+		return nil, fmt.Errorf("unknown access log format %q (expected %s, %s or %s)", format, AccessLogCombined, AccessLogCommon, AccessLogJSON)
+	}
+	return &accessLogger{w: w, format: format, trustProxy: trustProxy}, nil
+}
+
+// accessLogEntry holds the fields recorded for each request
+type accessLogEntry struct {
+	Time       time.Time `json:"time"`
+	RemoteIP   string    `json:"remote_ip"`
+	Method     string    `json:"method"`
+	Path       string    `json:"path"`
+	Proto      string    `json:"proto"`
+	Status     int       `json:"status"`
+	Bytes      int64     `json:"bytes"`
+	DurationMS float64   `json:"duration_ms"`
+	Referer    string    `json:"referer,omitempty"`
+	UserAgent  string    `json:"user_agent,omitempty"`
+	RequestID  string    `json:"request_id,omitempty"`
+}
+
+// middleware wraps next, logging each request after it completes
+func (l *accessLogger) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &responseRecorder{ResponseWriter: w}
+
+		next.ServeHTTP(rec, r)
+
+		l.log(accessLogEntry{
+			Time:       start,
+			RemoteIP:   clientIP(r, l.trustProxy),
+			Method:     r.Method,
+			Path:       r.URL.RequestURI(),
+			Proto:      r.Proto,
+			Status:     rec.Status(),
+			Bytes:      rec.bytes,
+			DurationMS: float64(time.Since(start).Microseconds()) / 1000,
+			Referer:    r.Referer(),
+			UserAgent:  r.UserAgent(),
+			RequestID:  requestID(r.Context()),
+		})
+	})
+}
+
+// log formats and writes a single entry
+func (l *accessLogger) log(e accessLogEntry) {
+	var line []byte
+	switch l.format {
+	case AccessLogJSON:
+		line, _ = json.Marshal(e)
+		line = append(line, '\n')
+	case AccessLogCommon:
+		line = []byte(fmt.Sprintf("%s - - [%s] %s %d %d %.3f %s\n",
+			e.RemoteIP,
+			e.Time.Format("02/Jan/2006:15:04:05 -0700"),
+			strconv.Quote(e.Method+" "+e.Path+" "+e.Proto),
+			e.Status,
+			e.Bytes,
+			e.DurationMS/1000,
+			quoteOrDash(e.RequestID),
+		))
+	default:
+		line = []byte(fmt.Sprintf("%s - - [%s] %s %d %d %s %s %.3f %s\n",
+			e.RemoteIP,
+			e.Time.Format("02/Jan/2006:15:04:05 -0700"),
+			strconv.Quote(e.Method+" "+e.Path+" "+e.Proto),
+			e.Status,
+			e.Bytes,
+			quoteOrDash(e.Referer),
+			quoteOrDash(e.UserAgent),
+			e.DurationMS/1000,
+			quoteOrDash(e.RequestID),
+		))
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.w.Write(line)
+}
+
+// quoteOrDash quotes s for a CLF field, using "-" for empty values
+func quoteOrDash(s string) string {
+	if s == "" {
+		return `"-"`
+	}
+	return strconv.Quote(s)
+}
+
+// responseRecorder captures the status code and body size of a response
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+// WriteHeader records the status code
+func (rr *responseRecorder) WriteHeader(code int) {
+	if rr.status == 0 {
+		rr.status = code
+	}
+	rr.ResponseWriter.WriteHeader(code)
+}
+
+// Write records the number of body bytes written
+func (rr *responseRecorder) Write(b []byte) (int, error) {
+	if rr.status == 0 {
+		rr.status = http.StatusOK
+	}
+	n, err := rr.ResponseWriter.Write(b)
+	rr.bytes += int64(n)
+	return n, err
+}
+
+// Status returns the response status, defaulting to 200 if nothing was written
+func (rr *responseRecorder) Status() int {
+	if rr.status == 0 {
+		return http.StatusOK
+	}
+	return rr.status
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (rr *responseRecorder) Unwrap() http.ResponseWriter {
+	return rr.ResponseWriter
+}
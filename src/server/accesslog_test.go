@@ -0,0 +1,242 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// combinedLogPattern matches a Combined Log Format line with trailing
+// duration and request ID
+var combinedLogPattern = regexp.MustCompile(
+	`^(\S+) - - \[([^\]]+)\] "(\S+) (\S+) (\S+)" (\d{3}) (\d+) "([^"]*)" "([^"]*)" (\d+\.\d{3}) "([^"]*)"$`)
+
+func TestAccessLog_CombinedFormat(t *testing.T) {
+	var buf bytes.Buffer
+	srv, err := New(Config{
+		ImagePath:       createTestJPEG(t),
+		AccessLogWriter: &buf,
+		AccessLogFormat: AccessLogCombined,
+	})
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "/1/0/0.png", nil)
+	req.RemoteAddr = "192.0.2.10:54321"
+	req.Header.Set("User-Agent", "test-agent/1.0")
+	req.Header.Set(RequestIDHeader, "req-42")
+	w := httptest.NewRecorder()
+
+	srv.Handler().ServeHTTP(w, req)
+
+	line := strings.TrimSpace(buf.String())
+	m := combinedLogPattern.FindStringSubmatch(line)
+	if m == nil {
+		t.Fatalf("Log line does not match combined format: %q", line)
+	}
+
+	if m[1] != "192.0.2.10" {
+		t.Errorf("Expected client IP 192.0.2.10, got %s", m[1])
+	}
+	if m[3] != "GET" || m[4] != "/1/0/0.png" {
+		t.Errorf("Expected request GET /1/0/0.png, got %s %s", m[3], m[4])
+	}
+	if m[6] != "200" {
+		t.Errorf("Expected status 200, got %s", m[6])
+	}
+	if size, _ := strconv.Atoi(m[7]); size != w.Body.Len() {
+		t.Errorf("Expected logged bytes %d, got %s", w.Body.Len(), m[7])
+	}
+	if m[9] != "test-agent/1.0" {
+		t.Errorf("Expected user agent test-agent/1.0, got %s", m[9])
+	}
+	if m[11] != "req-42" {
+		t.Errorf("Expected request ID req-42, got %s", m[11])
+	}
+}
+
+// commonLogPattern matches a Common Log Format line with trailing duration
+// and request ID
+var commonLogPattern = regexp.MustCompile(
+	`^(\S+) - - \[([^\]]+)\] "(\S+) (\S+) (\S+)" (\d{3}) (\d+) (\d+\.\d{3}) "([^"]*)"$`)
+
+func TestAccessLog_CommonFormat(t *testing.T) {
+	var buf bytes.Buffer
+	srv, err := New(Config{
+		ImagePath:       createTestJPEG(t),
+		AccessLogWriter: &buf,
+		AccessLogFormat: AccessLogCommon,
+	})
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "/tile/1/0/0.png", nil)
+	req.RemoteAddr = "192.0.2.10:54321"
+	req.Header.Set("User-Agent", "test-agent/1.0")
+	req.Header.Set(RequestIDHeader, "req-43")
+	w := httptest.NewRecorder()
+
+	srv.Handler().ServeHTTP(w, req)
+
+	line := strings.TrimSpace(buf.String())
+	m := commonLogPattern.FindStringSubmatch(line)
+	if m == nil {
+		t.Fatalf("Log line does not match common format: %q", line)
+	}
+
+	if m[1] != "192.0.2.10" {
+		t.Errorf("Expected client IP 192.0.2.10, got %s", m[1])
+	}
+	if _, err := time.Parse("02/Jan/2006:15:04:05 -0700", m[2]); err != nil {
+		t.Errorf("Expected a CLF timestamp, got %s: %v", m[2], err)
+	}
+	if m[3] != "GET" || m[4] != "/tile/1/0/0.png" || m[5] != "HTTP/1.1" {
+		t.Errorf("Expected request GET /tile/1/0/0.png HTTP/1.1, got %s %s %s", m[3], m[4], m[5])
+	}
+	if m[6] != "200" {
+		t.Errorf("Expected status 200, got %s", m[6])
+	}
+	if size, _ := strconv.Atoi(m[7]); size != w.Body.Len() {
+		t.Errorf("Expected logged bytes %d, got %s", w.Body.Len(), m[7])
+	}
+	if strings.Contains(line, "test-agent") {
+		t.Errorf("Expected no user agent in common format, got %q", line)
+	}
+	if m[9] != "req-43" {
+		t.Errorf("Expected request ID req-43, got %s", m[9])
+	}
+}
+
+func TestAccessLog_JSONFormat(t *testing.T) {
+	var buf bytes.Buffer
+	srv, err := New(Config{
+		ImagePath:       createTestJPEG(t),
+		AccessLogWriter: &buf,
+		AccessLogFormat: AccessLogJSON,
+	})
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "/0/1/0.png", nil)
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, req)
+
+	var entry accessLogEntry
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("Failed to parse JSON log line %q: %v", buf.String(), err)
+	}
+
+	if entry.Status != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", entry.Status)
+	}
+	if entry.Method != "GET" || entry.Path != "/0/1/0.png" {
+		t.Errorf("Unexpected request fields: %s %s", entry.Method, entry.Path)
+	}
+	if entry.Bytes != int64(w.Body.Len()) {
+		t.Errorf("Expected bytes %d, got %d", w.Body.Len(), entry.Bytes)
+	}
+	if entry.DurationMS < 0 {
+		t.Errorf("Expected non-negative duration, got %f", entry.DurationMS)
+	}
+	if entry.RequestID == "" || entry.RequestID != w.Header().Get(RequestIDHeader) {
+		t.Errorf("Expected logged request ID to match response header %q, got %q", w.Header().Get(RequestIDHeader), entry.RequestID)
+	}
+}
+
+func TestAccessLog_ForwardedIP(t *testing.T) {
+	tests := []struct {
+		trustProxy bool
+		expectIP   string
+		name       string
+	}{
+		{false, "10.0.0.1", "headers ignored without trust"},
+		{true, "203.0.113.7", "forwarded IP used with trust"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			srv, err := New(Config{
+				ImagePath:       createTestJPEG(t),
+				AccessLogWriter: &buf,
+				AccessLogFormat: AccessLogJSON,
+				TrustProxy:      tt.trustProxy,
+			})
+			if err != nil {
+				t.Fatalf("New() failed: %v", err)
+			}
+
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = "10.0.0.1:1234"
+			req.Header.Set("X-Forwarded-For", "203.0.113.7")
+			w := httptest.NewRecorder()
+			srv.Handler().ServeHTTP(w, req)
+
+			var entry accessLogEntry
+			if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+				t.Fatalf("Failed to parse JSON log line: %v", err)
+			}
+			if entry.RemoteIP != tt.expectIP {
+				t.Errorf("Expected remote IP %s, got %s", tt.expectIP, entry.RemoteIP)
+			}
+		})
+	}
+}
+
+func TestNew_InvalidAccessLogFormat(t *testing.T) {
+	_, err := New(Config{
+		ImagePath:       createTestJPEG(t),
+		AccessLogWriter: &bytes.Buffer{},
+		AccessLogFormat: "xml",
+	})
+	if err == nil {
+		t.Error("Expected error for unknown access log format, got nil")
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		remoteAddr string
+		xff        string
+		realIP     string
+		trustProxy bool
+		expect     string
+		name       string
+	}{
+		{"10.0.0.1:1234", "", "", false, "10.0.0.1", "remote address"},
+		{"10.0.0.1:1234", "203.0.113.7", "", false, "10.0.0.1", "untrusted XFF ignored"},
+		{"10.0.0.1:1234", "203.0.113.7", "", true, "203.0.113.7", "trusted XFF"},
+		{"10.0.0.1:1234", "198.51.100.1, 203.0.113.7", "", true, "203.0.113.7", "right-most XFF entry"},
+		{"10.0.0.1:1234", "203.0.113.7, garbage", "", true, "203.0.113.7", "invalid XFF entry skipped"},
+		{"10.0.0.1:1234", "", "203.0.113.9", true, "203.0.113.9", "trusted X-Real-IP"},
+		{"10.0.0.1:1234", "", "203.0.113.9", false, "10.0.0.1", "untrusted X-Real-IP ignored"},
+		{"[2001:db8::1]:1234", "", "", false, "2001:db8::1", "IPv6 remote address"},
+		{"@", "", "", false, "@", "unix socket peer"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.xff != "" {
+				req.Header.Set("X-Forwarded-For", tt.xff)
+			}
+			if tt.realIP != "" {
+				req.Header.Set("X-Real-IP", tt.realIP)
+			}
+
+			if got := clientIP(req, tt.trustProxy); got != tt.expect {
+				t.Errorf("clientIP() = %s, expected %s", got, tt.expect)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+)
+
+// newAdminHandler returns the admin API routes under /admin/
+func (s *Server) newAdminHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/admin/cache/flush", s.handleCacheFlush)
+	mux.HandleFunc("/admin/cache/stats", s.handleCacheStats)
+	mux.HandleFunc("/admin/reload", s.handleReload)
+	return mux
+}
+
+// handleCacheFlush empties the tile cache and reports what was removed.
+// ?disk=1 also clears the disk cache, which is rejected while there is none.
+func (s *Server) handleCacheFlush(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodPost) {
+		return
+	}
+	if r.URL.Query().Get("disk") == "1" {
+		writeError(w, r, newAPIError(http.StatusBadRequest, codeInvalidRequest, "No disk cache is configured"))
+		return
+	}
+
+	var flushed struct {
+		Entries int   `json:"entries"`
+		Bytes   int64 `json:"bytes"`
+	}
+	if s.cache != nil {
+		flushed.Entries, flushed.Bytes = s.cache.purge()
+	}
+	s.logger.Info("Flushed tile cache", "entries", flushed.Entries, "bytes", flushed.Bytes)
+	s.writeAdminJSON(w, flushed)
+}
+
+// handleCacheStats reports the tile cache's size and hit ratio. All counts
+// are zero when caching is disabled.
+func (s *Server) handleCacheStats(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+	var stats cacheStats
+	if s.cache != nil {
+		stats = s.cache.stats()
+	}
+	s.writeAdminJSON(w, stats)
+}
+
+// handleReload reloads the base maps from disk, see Reload
+func (s *Server) handleReload(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodPost) {
+		return
+	}
+	if err := s.Reload(); err != nil {
+		// Reload logged the cause, which may name files on the server
+		writeError(w, r, newAPIError(http.StatusInternalServerError, codeInternal, "Reload failed, see the server log"))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeAdminJSON writes v as an uncacheable JSON response
+func (s *Server) writeAdminJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		s.logger.Error("Error encoding admin response", "err", err)
+	}
+}
+
+// requireMethod answers 405 Method Not Allowed unless r uses method
+func requireMethod(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method == method {
+		return true
+	}
+	w.Header().Set("Allow", method)
+	writeError(w, r, newAPIError(http.StatusMethodNotAllowed, codeMethodNotAllowed, "Method not allowed"))
+	return false
+}
+
+// serveAdmin serves the admin API with srv on ln until Shutdown is called
+func (s *Server) serveAdmin(srv *http.Server, ln net.Listener) {
+	s.logger.Info("Starting admin API", "addr", "http://"+ln.Addr().String()+"/admin/")
+	if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		s.logger.Error("Admin API error", "err", err)
+	}
+}
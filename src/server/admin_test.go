@@ -0,0 +1,209 @@
+package server
+
+import (
+	"encoding/json"
+	"image/color"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+// newAdminTestServer returns a cached server with the admin API on a
+// separate handler, srv.admin
+func newAdminTestServer(t *testing.T) *Server {
+	t.Helper()
+	srv, err := NewWithBaseMap(solidBaseMap(color.RGBA{255, 0, 0, 255}), Config{
+		Admin:         true,
+		AdminAddr:     "127.0.0.1:0",
+		CacheMaxBytes: 16 << 20,
+	})
+	if err != nil {
+		t.Fatalf("NewWithBaseMap() failed: %v", err)
+	}
+	return srv
+}
+
+// fetchCacheStats calls GET /admin/cache/stats on h
+func fetchCacheStats(t *testing.T, h http.Handler) cacheStats {
+	t.Helper()
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/admin/cache/stats", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 for stats, got %d", w.Code)
+	}
+	var stats cacheStats
+	if err := json.NewDecoder(w.Body).Decode(&stats); err != nil {
+		t.Fatalf("Failed to decode stats: %v", err)
+	}
+	return stats
+}
+
+func TestAdmin_CacheStatsAndFlush(t *testing.T) {
+	srv := newAdminTestServer(t)
+	h := srv.admin
+
+	// Three distinct tiles, one of them requested twice
+	for _, p := range []string{"/0/0/0.png", "/1/0/0.png", "/1/1/0.png", "/1/1/0.png"} {
+		w := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(w, httptest.NewRequest("GET", p, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200 for %s, got %d", p, w.Code)
+		}
+	}
+
+	stats := fetchCacheStats(t, h)
+	if stats.Entries != 3 || stats.Hits != 1 || stats.Misses != 3 {
+		t.Errorf("Expected 3 entries, 1 hit and 3 misses, got %+v", stats)
+	}
+	if stats.Bytes <= 0 || stats.HitRatio != 0.25 {
+		t.Errorf("Expected positive size and hit ratio 0.25, got %+v", stats)
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("POST", "/admin/cache/flush", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 for flush, got %d", w.Code)
+	}
+	var flushed struct{ Entries int }
+	if err := json.NewDecoder(w.Body).Decode(&flushed); err != nil || flushed.Entries != 3 {
+		t.Errorf("Expected 3 flushed entries, got %d (%v)", flushed.Entries, err)
+	}
+
+	if stats := fetchCacheStats(t, h); stats.Entries != 0 || stats.Bytes != 0 {
+		t.Errorf("Expected empty cache after flush, got %+v", stats)
+	}
+	if srv.cache.len() != 0 {
+		t.Errorf("Expected cache to be empty, got %d entries", srv.cache.len())
+	}
+}
+
+func TestAdmin_Requests(t *testing.T) {
+	tests := []struct {
+		method     string
+		path       string
+		expectCode int
+		name       string
+	}{
+		{"GET", "/admin/cache/flush", http.StatusMethodNotAllowed, "flush requires POST"},
+		{"POST", "/admin/cache/stats", http.StatusMethodNotAllowed, "stats requires GET"},
+		{"GET", "/admin/reload", http.StatusMethodNotAllowed, "reload requires POST"},
+		{"POST", "/admin/cache/flush?disk=1", http.StatusBadRequest, "no disk cache"},
+		{"POST", "/admin/reload", http.StatusNoContent, "reload without image file"},
+		{"GET", "/admin/unknown", http.StatusNotFound, "unknown route"},
+	}
+
+	srv := newAdminTestServer(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			srv.admin.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+			if w.Code != tt.expectCode {
+				t.Errorf("Expected status %d, got %d", tt.expectCode, w.Code)
+			}
+		})
+	}
+}
+
+func TestAdmin_Reload(t *testing.T) {
+	blue := color.RGBA{0, 0, 255, 255}
+	path := filepath.Join(t.TempDir(), "world.png")
+	writeSolidPNG(t, path, color.RGBA{255, 0, 0, 255})
+
+	srv, err := New(Config{ImagePath: path, Admin: true, AdminAddr: "127.0.0.1:0"})
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+
+	writeSolidPNG(t, path, blue)
+	w := httptest.NewRecorder()
+	srv.admin.ServeHTTP(w, httptest.NewRequest("POST", "/admin/reload", nil))
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("Expected status 204 for reload, got %d", w.Code)
+	}
+	if got := tilePixel(t, srv.Handler(), "/1/0/0.png"); got != blue {
+		t.Errorf("Expected pixel %v after reload, got %v", blue, got)
+	}
+}
+
+func TestAdmin_Exposure(t *testing.T) {
+	tests := []struct {
+		cfg          Config
+		expectPublic int // Status on the main handler; anything but 200 means unreachable
+		expectAdmin  bool
+		name         string
+	}{
+		{Config{}, http.StatusBadRequest, false, "disabled by default"},
+		{Config{Admin: true, AdminAddr: "127.0.0.1:0"}, http.StatusBadRequest, true, "separate listener only"},
+		{Config{Admin: true, BasicAuth: []string{"ops:secret"}}, http.StatusUnauthorized, false, "main listener behind basic auth"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, err := NewWithBaseMap(solidBaseMap(color.RGBA{255, 0, 0, 255}), tt.cfg)
+			if err != nil {
+				t.Fatalf("NewWithBaseMap() failed: %v", err)
+			}
+
+			w := httptest.NewRecorder()
+			srv.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/admin/cache/stats", nil))
+			if w.Code != tt.expectPublic {
+				t.Errorf("Expected status %d on the main handler, got %d", tt.expectPublic, w.Code)
+			}
+
+			if (srv.admin != nil) != tt.expectAdmin {
+				t.Fatalf("Expected separate admin handler: %v", tt.expectAdmin)
+			}
+			if srv.admin != nil {
+				w := httptest.NewRecorder()
+				srv.admin.ServeHTTP(w, httptest.NewRequest("GET", "/admin/cache/stats", nil))
+				if w.Code != http.StatusOK {
+					t.Errorf("Expected status 200 on the admin handler, got %d", w.Code)
+				}
+			}
+		})
+	}
+}
+
+func TestAdmin_MainListenerAuth(t *testing.T) {
+	// Without credentials anyone reaching the tiles could flush and reload
+	if _, err := NewWithBaseMap(solidBaseMap(color.RGBA{}), Config{Admin: true}); err == nil {
+		t.Error("Expected error for the admin API on the main listener without basic auth")
+	}
+
+	srv, err := NewWithBaseMap(solidBaseMap(color.RGBA{}), Config{Admin: true, BasicAuth: []string{"ops:secret"}})
+	if err != nil {
+		t.Fatalf("NewWithBaseMap() failed: %v", err)
+	}
+	tests := []struct {
+		user       string
+		password   string
+		expectCode int
+		name       string
+	}{
+		{"", "", http.StatusUnauthorized, "no credentials"},
+		{"ops", "wrong", http.StatusUnauthorized, "wrong password"},
+		{"ops", "secret", http.StatusOK, "valid credentials"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/admin/cache/stats", nil)
+			if tt.user != "" {
+				req.SetBasicAuth(tt.user, tt.password)
+			}
+			w := httptest.NewRecorder()
+			srv.Handler().ServeHTTP(w, req)
+			if w.Code != tt.expectCode {
+				t.Errorf("Expected status %d, got %d", tt.expectCode, w.Code)
+			}
+		})
+	}
+}
+
+func TestNewWithBaseMap_InvalidAdminAddr(t *testing.T) {
+	_, err := NewWithBaseMap(solidBaseMap(color.RGBA{}), Config{Admin: true, AdminAddr: "localhost"})
+	if err == nil {
+		t.Error("Expected error for admin address without a port")
+	}
+}
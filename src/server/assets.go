@@ -0,0 +1,134 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// Leaflet files in the assets, as vendored by go generate ./src/resources
+const (
+	leafletJS  = "leaflet/leaflet.js"
+	leafletCSS = "leaflet/leaflet.css"
+)
+
+// viewerAssets are the static files served under /assets/, with the
+// compressed copies and content hashes derived from them at startup
+type viewerAssets struct {
+	files fs.FS
+	gz    map[string][]byte // Precompressed copies of compressible files
+	tags  map[string]string // Content hash of every file, versioning its URL
+}
+
+// newViewerAssets reads every file in files once to hash it and, if it is
+// compressible, gzip it
+func newViewerAssets(files fs.FS) (*viewerAssets, error) {
+	a := &viewerAssets{files: files, gz: make(map[string][]byte), tags: make(map[string]string)}
+	err := fs.WalkDir(files, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := fs.ReadFile(files, name)
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(data)
+		a.tags[name] = hex.EncodeToString(sum[:8])
+
+		if !compressible(mime.TypeByExtension(path.Ext(name))) {
+			return nil
+		}
+		var buf bytes.Buffer
+		zw, _ := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+		zw.Write(data)
+		if err := zw.Close(); err != nil {
+			return err
+		}
+		a.gz[name] = buf.Bytes()
+		return nil
+	})
+	return a, err
+}
+
+// handleAssets serves the embedded static files used by the viewer, such as
+// Leaflet, under /assets/. Requests carrying the file's current content hash
+// as ?v= may be cached indefinitely.
+func (s *Server) handleAssets(w http.ResponseWriter, r *http.Request) {
+	if s.assets == nil {
+		http.NotFound(w, r)
+		return
+	}
+	name := strings.TrimPrefix(r.URL.Path, "/assets/")
+	if tag := s.assets.tags[name]; tag != "" && r.URL.Query().Get("v") == tag {
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable") // 1 year
+	} else {
+		w.Header().Set("Cache-Control", "public, max-age=86400") // 24 hours
+	}
+
+	f, err := s.assets.files.Open(name)
+	if err != nil {
+		writeError(w, r, newAPIError(http.StatusNotFound, codeNotFound, "404 page not found"))
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		writeError(w, r, newAPIError(http.StatusNotFound, codeNotFound, "404 page not found"))
+		return
+	}
+	content, seekable := f.(io.ReadSeeker)
+	if !seekable {
+		writeError(w, r, newAPIError(http.StatusInternalServerError, codeInternal, "Failed to read file"))
+		return
+	}
+
+	// The content hash doubles as an ETag, so ServeContent can answer
+	// If-None-Match and If-Range as well as Range requests. Embedded files
+	// have no modification time, so there is no Last-Modified.
+	tag := s.assets.tags[name]
+
+	// Serve the copy compressed at startup when the client takes gzip. A
+	// range of it is a range of the gzip stream, with its own ETag.
+	if gz, ok := s.assets.gz[name]; ok {
+		addVary(w.Header(), "Accept-Encoding")
+		if acceptsGzip(r.Header.Get("Accept-Encoding")) {
+			w.Header().Set("Content-Type", mime.TypeByExtension(path.Ext(name)))
+			w.Header().Set("Content-Encoding", "gzip")
+			w.Header().Set("ETag", `"`+tag+`-gzip"`)
+			http.ServeContent(w, r, name, info.ModTime(), bytes.NewReader(gz))
+			return
+		}
+	}
+	w.Header().Set("ETag", `"`+tag+`"`)
+	http.ServeContent(w, r, name, info.ModTime(), content)
+}
+
+// assetURL returns the versioned URL of the named asset, or "" if there is
+// no such asset
+func (s *Server) assetURL(name string) string {
+	if s.assets == nil || s.assets.tags[name] == "" {
+		return ""
+	}
+	return s.basePath + "/assets/" + name + "?v=" + s.assets.tags[name]
+}
+
+// leafletURLs returns the URLs the viewer loads Leaflet from, or empty
+// strings to load it from the CDN: when LeafletCDN is set or Leaflet has
+// not been vendored
+func (s *Server) leafletURLs() (css, js string) {
+	if s.cdn {
+		return "", ""
+	}
+	css, js = s.assetURL(leafletCSS), s.assetURL(leafletJS)
+	if css == "" || js == "" {
+		return "", ""
+	}
+	return css, js
+}
@@ -0,0 +1,235 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// testLeaflet stands in for the vendored Leaflet release
+var testLeaflet = fstest.MapFS{
+	"leaflet/leaflet.js":        {Data: []byte("window.L = {};")},
+	"leaflet/leaflet.css":       {Data: []byte(".leaflet-container {}")},
+	"leaflet/images/layers.png": {Data: []byte("\x89PNG")},
+}
+
+// externalResource matches scripts and stylesheets loaded from another host
+var externalResource = regexp.MustCompile(`<(script|link)[^>]+(src|href)="(https?:)?//`)
+
+// withAssets replaces the server's viewer assets with files
+func withAssets(t *testing.T, srv *Server, files fstest.MapFS) {
+	t.Helper()
+	assets, err := newViewerAssets(files)
+	if err != nil {
+		t.Fatalf("newViewerAssets() failed: %v", err)
+	}
+	srv.assets = assets
+}
+
+func TestHandleAssets(t *testing.T) {
+	srv, err := New(Config{ImagePath: createTestJPEG(t), BasePath: "/maps"})
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+	withAssets(t, srv, testLeaflet)
+
+	tests := []struct {
+		path        string
+		expectCode  int
+		contentType string
+		expectBody  string
+		name        string
+	}{
+		{"/maps/assets/leaflet/leaflet.js", http.StatusOK, "text/javascript", "window.L = {};", "script"},
+		{"/maps/assets/leaflet/leaflet.css", http.StatusOK, "text/css", ".leaflet-container {}", "stylesheet"},
+		{"/maps/assets/leaflet/images/layers.png", http.StatusOK, "image/png", "\x89PNG", "image"},
+		{"/maps/assets/leaflet/missing.js", http.StatusNotFound, "", "", "missing"},
+		{"/maps/assets/leaflet/", http.StatusNotFound, "", "", "directory"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			srv.Handler().ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+			if w.Code != tt.expectCode {
+				t.Fatalf("Expected status %d, got %d", tt.expectCode, w.Code)
+			}
+			if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, tt.contentType) {
+				t.Errorf("Expected Content-Type %s, got %s", tt.contentType, ct)
+			}
+			if tt.expectBody != "" && w.Body.String() != tt.expectBody {
+				t.Errorf("Expected the embedded bytes %q, got %q", tt.expectBody, w.Body.String())
+			}
+		})
+	}
+
+	// The viewer switches to the local copy and loads nothing from elsewhere
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/maps/", nil))
+	body := w.Body.String()
+	js, css := srv.assetURL(leafletJS), srv.assetURL(leafletCSS)
+	if !strings.HasPrefix(js, "/maps/assets/leaflet/leaflet.js?v=") || !strings.HasPrefix(css, "/maps/assets/leaflet/leaflet.css?v=") {
+		t.Fatalf("Expected versioned asset URLs, got %q and %q", js, css)
+	}
+	if !strings.Contains(body, `src="`+js+`"`) || !strings.Contains(body, `href="`+css+`"`) {
+		t.Error("Expected viewer to load Leaflet from /maps/assets/leaflet/")
+	}
+	if m := externalResource.FindString(body); m != "" {
+		t.Errorf("Expected viewer to load no external resources, found %q", m)
+	}
+}
+
+func TestHandleAssets_CacheHeaders(t *testing.T) {
+	srv, err := New(Config{ImagePath: createTestJPEG(t)})
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+	withAssets(t, srv, testLeaflet)
+	tag := srv.assets.tags[leafletJS]
+
+	tests := []struct {
+		path        string
+		expectCache string
+		name        string
+	}{
+		{"/assets/leaflet/leaflet.js?v=" + tag, "public, max-age=31536000, immutable", "current hash"},
+		{"/assets/leaflet/leaflet.js?v=0123456789abcdef", "public, max-age=86400", "stale hash"},
+		{"/assets/leaflet/leaflet.js", "public, max-age=86400", "unversioned"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			srv.Handler().ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+			if got := w.Header().Get("Cache-Control"); got != tt.expectCache {
+				t.Errorf("Expected Cache-Control %q, got %q", tt.expectCache, got)
+			}
+		})
+	}
+
+	// Changed content gets a new URL
+	changed := fstest.MapFS{"leaflet/leaflet.js": {Data: []byte("window.L = {v: 2};")}}
+	assets, err := newViewerAssets(changed)
+	if err != nil {
+		t.Fatalf("newViewerAssets() failed: %v", err)
+	}
+	if assets.tags[leafletJS] == tag {
+		t.Error("Expected a different hash for different content")
+	}
+}
+
+func TestHandleAssets_Range(t *testing.T) {
+	srv, err := New(Config{ImagePath: createTestJPEG(t)})
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+	withAssets(t, srv, testLeaflet)
+	etag := `"` + srv.assets.tags[leafletJS] + `"`
+	gz := srv.assets.gz[leafletJS]
+
+	tests := []struct {
+		header         map[string]string
+		expectCode     int
+		expectBody     string
+		expectRange    string
+		expectEncoding string
+		name           string
+	}{
+		{map[string]string{"Range": "bytes=0-5"}, http.StatusPartialContent, "window", "bytes 0-5/14", "", "first bytes"},
+		{map[string]string{"Range": "bytes=-3"}, http.StatusPartialContent, "{};", "bytes 11-13/14", "", "suffix"},
+		{map[string]string{"Range": "bytes=0-5", "If-Range": etag}, http.StatusPartialContent, "window", "bytes 0-5/14", "", "If-Range current"},
+		{map[string]string{"Range": "bytes=0-5", "If-Range": `"0123456789abcdef"`}, http.StatusOK, "window.L = {};", "", "", "If-Range stale"},
+		{map[string]string{"Range": "bytes=100-"}, http.StatusRequestedRangeNotSatisfiable, "", "bytes */14", "", "unsatisfiable"},
+		{map[string]string{"If-None-Match": etag}, http.StatusNotModified, "", "", "", "not modified"},
+		{
+			map[string]string{"Range": "bytes=0-1", "Accept-Encoding": "gzip"}, http.StatusPartialContent, string(gz[:2]),
+			"bytes 0-1/" + strconv.Itoa(len(gz)), "gzip", "range of the compressed copy",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/assets/"+leafletJS, nil)
+			for k, v := range tt.header {
+				req.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			srv.Handler().ServeHTTP(w, req)
+			if w.Code != tt.expectCode {
+				t.Fatalf("Expected status %d, got %d", tt.expectCode, w.Code)
+			}
+			if tt.expectBody != "" && w.Body.String() != tt.expectBody {
+				t.Errorf("Expected body %q, got %q", tt.expectBody, w.Body.String())
+			}
+			if got := w.Header().Get("Content-Range"); got != tt.expectRange {
+				t.Errorf("Expected Content-Range %q, got %q", tt.expectRange, got)
+			}
+			if got := w.Header().Get("Content-Encoding"); got != tt.expectEncoding {
+				t.Errorf("Expected Content-Encoding %q, got %q", tt.expectEncoding, got)
+			}
+		})
+	}
+}
+
+func TestHandleAssets_CDNFallback(t *testing.T) {
+	tests := []struct {
+		cfg    Config
+		assets fstest.MapFS
+		name   string
+	}{
+		{Config{}, fstest.MapFS{}, "Leaflet not vendored"},
+		{Config{LeafletCDN: true}, testLeaflet, "CDN requested"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.ImagePath = createTestJPEG(t)
+			srv, err := New(tt.cfg)
+			if err != nil {
+				t.Fatalf("New() failed: %v", err)
+			}
+			withAssets(t, srv, tt.assets)
+
+			w := httptest.NewRecorder()
+			srv.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+			if !strings.Contains(w.Body.String(), "https://unpkg.com/leaflet@1.9.4/dist/leaflet.js") {
+				t.Error("Expected viewer to load Leaflet from the CDN")
+			}
+			if strings.Contains(w.Body.String(), "/assets/leaflet/") {
+				t.Error("Expected viewer not to reference the local copy")
+			}
+		})
+	}
+}
+
+func TestHandleAssets_Embedded(t *testing.T) {
+	// Unlike the tests above, this serves the assets embedded in the binary
+	srv, err := New(Config{ImagePath: createTestJPEG(t)})
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+	if srv.assets.tags[leafletJS] == "" {
+		t.Skip("Leaflet is not vendored; run go generate ./src/resources and commit src/resources/assets/leaflet/")
+	}
+
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	body := w.Body.String()
+	if m := externalResource.FindString(body); m != "" {
+		t.Errorf("Expected the default viewer to load no external resources, found %q", m)
+	}
+	for _, asset := range []string{srv.assetURL(leafletJS), srv.assetURL(leafletCSS)} {
+		if !strings.Contains(body, asset) {
+			t.Errorf("Expected the viewer to load %s", asset)
+		}
+		w := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(w, httptest.NewRequest("GET", asset, nil))
+		if w.Code != http.StatusOK || w.Body.Len() == 0 {
+			t.Errorf("Expected %s to be served, got status %d with %d bytes", asset, w.Code, w.Body.Len())
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package server
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+// attributionLink matches the one piece of markup attributions may use, a
+// link to an http(s) URL around plain text
+var attributionLink = regexp.MustCompile(`(?is)<a\s+href\s*=\s*"(https?://[^"<>]*)"\s*>([^<]*)</a\s*>`)
+
+// sanitizeAttribution turns an operator-supplied attribution into HTML that
+// is safe to show in the viewer and TileJSON clients. Links to http(s) URLs
+// and character references such as &copy; are kept; any other markup is
+// escaped and shown as text.
+func sanitizeAttribution(s string) string {
+	var b strings.Builder
+	last := 0
+	for _, m := range attributionLink.FindAllStringSubmatchIndex(s, -1) {
+		b.WriteString(escapeAttributionText(s[last:m[0]]))
+		b.WriteString(`<a href="`)
+		b.WriteString(escapeAttributionText(s[m[2]:m[3]]))
+		b.WriteString(`">`)
+		b.WriteString(escapeAttributionText(s[m[4]:m[5]]))
+		b.WriteString(`</a>`)
+		last = m[1]
+	}
+	b.WriteString(escapeAttributionText(s[last:]))
+	return b.String()
+}
+
+// escapeAttributionText escapes s as HTML text, first resolving character
+// references so they are not escaped twice
+func escapeAttributionText(s string) string {
+	return html.EscapeString(html.UnescapeString(s))
+}
@@ -0,0 +1,30 @@
+package server
+
+import "testing"
+
+func TestSanitizeAttribution(t *testing.T) {
+	tests := []struct {
+		input  string
+		expect string
+		name   string
+	}{
+		{"", "", "empty"},
+		{"© NASA Blue Marble", "© NASA Blue Marble", "plain text"},
+		{"&copy; NASA", "© NASA", "character reference"},
+		{"Tom & Jerry", "Tom &amp; Jerry", "ampersand"},
+		{`<a href="https://example.com/">Example</a>`, `<a href="https://example.com/">Example</a>`, "link"},
+		{`Data <A HREF="http://example.com/?a=1&amp;b=2">Ex</A> and <a href="https://b.example">B</a>`, `Data <a href="http://example.com/?a=1&amp;b=2">Ex</a> and <a href="https://b.example">B</a>`, "several links"},
+		{`<a href="javascript:alert(1)">x</a>`, `&lt;a href=&#34;javascript:alert(1)&#34;&gt;x&lt;/a&gt;`, "script URL"},
+		{`<a href="https://example.com/" onclick="x()">x</a>`, `&lt;a href=&#34;https://example.com/&#34; onclick=&#34;x()&#34;&gt;x&lt;/a&gt;`, "extra attribute"},
+		{`<a href="https://example.com/"><img src=x></a>`, `&lt;a href=&#34;https://example.com/&#34;&gt;&lt;img src=x&gt;&lt;/a&gt;`, "nested markup"},
+		{`<b>bold</b>`, `&lt;b&gt;bold&lt;/b&gt;`, "other tags"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sanitizeAttribution(tt.input); got != tt.expect {
+				t.Errorf("sanitizeAttribution(%q) = %q, expected %q", tt.input, got, tt.expect)
+			}
+		})
+	}
+}
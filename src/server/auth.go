@@ -0,0 +1,86 @@
+package server
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// basicAuthRealm is sent in the WWW-Authenticate challenge
+const basicAuthRealm = "xyztiles"
+
+// basicAuth checks RFC 7617 Basic credentials against a fixed set of users
+type basicAuth struct {
+	users map[string]basicAuthCredential
+}
+
+// basicAuthCredential holds either a plaintext password or a bcrypt hash
+type basicAuthCredential struct {
+	password []byte
+	hash     []byte
+}
+
+// newBasicAuth parses "user:password" entries. A password starting with a
+// bcrypt prefix ($2a$, $2b$ or $2y$) is treated as a bcrypt hash.
+func newBasicAuth(entries []string) (*basicAuth, error) {
+	auth := &basicAuth{users: make(map[string]basicAuthCredential, len(entries))}
+
+	for i, entry := range entries {
+		// Don't echo the entry in errors, it may contain a password
+		user, password, ok := strings.Cut(entry, ":")
+		if !ok || user == "" || password == "" {
+			return nil, fmt.Errorf("invalid basic auth entry #%d: expected user:password", i+1)
+		}
+		if _, dup := auth.users[user]; dup {
+			return nil, fmt.Errorf("duplicate basic auth user %q", user)
+		}
+
+		var cred basicAuthCredential
+		if isBcryptHash(password) {
+			if _, err := bcrypt.Cost([]byte(password)); err != nil {
+				return nil, fmt.Errorf("invalid bcrypt hash for basic auth user %q: %w", user, err)
+			}
+			cred.hash = []byte(password)
+		} else {
+			cred.password = []byte(password)
+		}
+		auth.users[user] = cred
+	}
+
+	return auth, nil
+}
+
+// isBcryptHash reports whether s looks like a bcrypt hash
+func isBcryptHash(s string) bool {
+	return strings.HasPrefix(s, "$2a$") || strings.HasPrefix(s, "$2b$") || strings.HasPrefix(s, "$2y$")
+}
+
+// verify reports whether user and password match a configured credential
+func (a *basicAuth) verify(user, password string) bool {
+	cred, ok := a.users[user]
+	if !ok {
+		return false
+	}
+
+	if cred.hash != nil {
+		return bcrypt.CompareHashAndPassword(cred.hash, []byte(password)) == nil
+	}
+	return subtle.ConstantTimeCompare(cred.password, []byte(password)) == 1
+}
+
+// middleware wraps next, rejecting requests without valid credentials with
+// 401 and a Basic challenge
+func (a *basicAuth) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, password, ok := r.BasicAuth()
+		if !ok || !a.verify(user, password) {
+			w.Header().Set("WWW-Authenticate", `Basic realm="`+basicAuthRealm+`", charset="UTF-8"`)
+			writeError(w, r, newAPIError(http.StatusUnauthorized, codeUnauthorized, "Unauthorized"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
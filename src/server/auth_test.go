@@ -0,0 +1,122 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestNewBasicAuth_Invalid(t *testing.T) {
+	tests := []struct {
+		entries []string
+		name    string
+	}{
+		{[]string{"alice"}, "missing colon"},
+		{[]string{":secret"}, "empty user"},
+		{[]string{"alice:"}, "empty password"},
+		{[]string{"alice:a", "alice:b"}, "duplicate user"},
+		{[]string{"alice:$2y$10$tooshort"}, "malformed bcrypt hash"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newBasicAuth(tt.entries); err == nil {
+				t.Error("Expected error, got nil")
+			}
+		})
+	}
+}
+
+func TestNewBasicAuth_ErrorOmitsPassword(t *testing.T) {
+	_, err := newBasicAuth([]string{"supersecret"})
+	if err == nil || strings.Contains(err.Error(), "supersecret") {
+		t.Errorf("Expected error without the entry text, got %v", err)
+	}
+}
+
+func TestHandler_BasicAuth(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("hashed-pw"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("GenerateFromPassword() failed: %v", err)
+	}
+	// Accept the $2y$ prefix produced by htpasswd and PHP
+	hashY := "$2y$" + strings.TrimPrefix(string(hash), "$2a$")
+
+	srv, err := New(Config{
+		ImagePath: createTestJPEG(t),
+		BasicAuth: []string{"alice:plain-pw", "bob:" + hashY},
+	})
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+
+	tests := []struct {
+		path       string
+		user, pass string
+		expectCode int
+		name       string
+	}{
+		{"/0/0/0.png", "alice", "plain-pw", http.StatusOK, "plaintext password"},
+		{"/0/0/0.png", "bob", "hashed-pw", http.StatusOK, "bcrypt password"},
+		{"/", "alice", "plain-pw", http.StatusOK, "viewer with credentials"},
+		{"/0/0/0.png", "alice", "wrong", http.StatusUnauthorized, "bad plaintext password"},
+		{"/0/0/0.png", "bob", "wrong", http.StatusUnauthorized, "bad bcrypt password"},
+		{"/0/0/0.png", "mallory", "plain-pw", http.StatusUnauthorized, "unknown user"},
+		{"/0/0/0.png", "", "", http.StatusUnauthorized, "no credentials"},
+		{"/", "", "", http.StatusUnauthorized, "viewer without credentials"},
+		{"/tilejson.json", "", "", http.StatusUnauthorized, "tilejson without credentials"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.path, nil)
+			if tt.user != "" {
+				req.SetBasicAuth(tt.user, tt.pass)
+			}
+			w := httptest.NewRecorder()
+			srv.Handler().ServeHTTP(w, req)
+
+			if w.Code != tt.expectCode {
+				t.Errorf("Expected status %d, got %d", tt.expectCode, w.Code)
+			}
+
+			challenge := w.Header().Get("WWW-Authenticate")
+			if tt.expectCode == http.StatusUnauthorized {
+				if !strings.HasPrefix(challenge, `Basic realm="xyztiles"`) {
+					t.Errorf("Expected Basic challenge, got %q", challenge)
+				}
+			} else if challenge != "" {
+				t.Errorf("Unexpected challenge on success: %q", challenge)
+			}
+		})
+	}
+}
+
+func TestHandler_BasicAuthWithBasePath(t *testing.T) {
+	srv, err := New(Config{
+		ImagePath: createTestJPEG(t),
+		BasePath:  "/maps",
+		BasicAuth: []string{"alice:plain-pw"},
+	})
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "/maps/0/0/0.png", nil)
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without credentials, got %d", w.Code)
+	}
+
+	req = httptest.NewRequest("GET", "/maps/0/0/0.png", nil)
+	req.SetBasicAuth("alice", "plain-pw")
+	w = httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected 200 with credentials, got %d", w.Code)
+	}
+}
@@ -0,0 +1,53 @@
+package server
+
+import (
+	"math"
+
+	"org.xyzmaps.xyztiles/src/tilemath"
+)
+
+// tileInBounds reports whether the tile at z/x/y intersects the configured
+// bounding box. Without a box, and for coordinates outside the tile grid
+// (which the renderer rejects on its own), it returns true.
+func (s *Server) tileInBounds(z, x, y int) bool {
+	if s.bounds == nil {
+		return true
+	}
+	tb, err := tilemath.TileBounds(z, x, y)
+	if err != nil {
+		return true
+	}
+	return s.bounds.Intersects(tb)
+}
+
+// servedBounds returns the area tiles are served for as [west, south, east,
+// north], clamped to the Web Mercator latitude limits. West is greater than
+// east for a box crossing the antimeridian.
+func (s *Server) servedBounds() [4]float64 {
+	b := tilemath.Bounds{West: -180, South: -90, East: 180, North: 90}
+	if s.bounds != nil {
+		b = *s.bounds
+	}
+	return [4]float64{
+		b.West,
+		math.Max(b.South, -tilemath.MaxLatitude),
+		b.East,
+		math.Min(b.North, tilemath.MaxLatitude),
+	}
+}
+
+// viewerMaxBounds returns the bounding box as Leaflet [[south, west], [north,
+// east]] corners, or nil when tiles are served for the whole world. Leaflet
+// does not wrap longitudes, so a box crossing the antimeridian gets an east
+// edge beyond 180°.
+func (s *Server) viewerMaxBounds() [][2]float64 {
+	if s.bounds == nil {
+		return nil
+	}
+	b := s.servedBounds()
+	east := b[2]
+	if s.bounds.CrossesAntimeridian() {
+		east += 360
+	}
+	return [][2]float64{{b[1], b[0]}, {b[3], east}}
+}
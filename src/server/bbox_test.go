@@ -0,0 +1,102 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"org.xyzmaps.xyztiles/src/tilemath"
+)
+
+func TestHandleTile_Bounds(t *testing.T) {
+	europe := &tilemath.Bounds{West: -10, South: 35, East: 30, North: 70}
+	pacific := &tilemath.Bounds{West: 170, South: -50, East: -170, North: -30}
+
+	tests := []struct {
+		bounds     *tilemath.Bounds
+		blank      bool
+		lon, lat   float64
+		expectCode int
+		name       string
+	}{
+		{europe, false, 2.35, 48.85, http.StatusOK, "paris inside europe"},
+		{europe, false, 133.8, -25.3, http.StatusNotFound, "australia outside europe"},
+		{europe, true, 133.8, -25.3, http.StatusOK, "australia outside europe with blank tiles"},
+		{pacific, false, 175, -40, http.StatusOK, "west of antimeridian"},
+		{pacific, false, -175, -40, http.StatusOK, "east of antimeridian"},
+		{pacific, false, 0, -40, http.StatusNotFound, "outside antimeridian box"},
+		{nil, false, 133.8, -25.3, http.StatusOK, "no bounds"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, err := New(Config{ImagePath: createTestJPEG(t), Bounds: tt.bounds, BlankOnNotFound: tt.blank})
+			if err != nil {
+				t.Fatalf("New() failed: %v", err)
+			}
+			tc, err := tilemath.LonLatToTile(tt.lon, tt.lat, 3)
+			if err != nil {
+				t.Fatalf("LonLatToTile failed: %v", err)
+			}
+
+			w := httptest.NewRecorder()
+			srv.Handler().ServeHTTP(w, httptest.NewRequest("GET", fmt.Sprintf("/%d/%d/%d.png", tc.Z, tc.X, tc.Y), nil))
+			if w.Code != tt.expectCode {
+				t.Errorf("Expected status %d for %s, got %d", tt.expectCode, tc, w.Code)
+			}
+		})
+	}
+}
+
+func TestBounds_AdvertisedToClients(t *testing.T) {
+	srv, err := New(Config{
+		ImagePath: createTestJPEG(t),
+		Bounds:    &tilemath.Bounds{West: 170, South: -90, East: -170, North: -30},
+	})
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/tilejson.json", nil))
+	var doc tileJSON
+	if err := json.NewDecoder(w.Body).Decode(&doc); err != nil {
+		t.Fatalf("Failed to decode TileJSON: %v", err)
+	}
+	expect := [4]float64{170, -tilemath.MaxLatitude, -170, -30}
+	if doc.Bounds != expect {
+		t.Errorf("Expected TileJSON bounds %v, got %v", expect, doc.Bounds)
+	}
+
+	// Leaflet gets an unwrapped east edge
+	w = httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if body := w.Body.String(); !strings.Contains(body, "[[-85.05112878,170],[-30,190]]") {
+		t.Error("Expected viewer maxBounds [[-85.05112878,170],[-30,190]]")
+	}
+}
+
+func TestWarmCache_SkipsTilesOutsideBounds(t *testing.T) {
+	srv := newCachingServer(t, Config{
+		Bounds: &tilemath.Bounds{West: -10, South: 35, East: 30, North: 70},
+	})
+
+	if err := srv.WarmCache(context.Background(), 0, 2); err != nil {
+		t.Fatalf("WarmCache() failed: %v", err)
+	}
+
+	// 1 + 2 + 4 tiles intersect the box at zooms 0-2
+	if got := srv.cache.len(); got != 7 {
+		t.Errorf("Expected 7 cached tiles, got %d", got)
+	}
+	if _, ok := srv.cache.get("default/2/1/1.png"); !ok {
+		t.Error("Expected 2/1/1.png to be cached")
+	}
+	if _, ok := srv.cache.get("default/2/3/2.png"); ok {
+		t.Error("Expected 2/3/2.png outside the box not to be cached")
+	}
+}
@@ -0,0 +1,40 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"net/http"
+	"strconv"
+
+	"org.xyzmaps.xyztiles/src/imagery"
+)
+
+// encodeBlankTiles encodes a fully transparent tile once per tile size,
+// expanded by buffer pixels on every side, and supported format. JPEG has no
+// alpha channel, so its blank tile is black.
+func encodeBlankTiles(buffer int) (map[int]map[imagery.Format][]byte, error) {
+	tiles := make(map[int]map[imagery.Format][]byte, len(tileSizes))
+	for _, size := range tileSizes {
+		blank := image.NewRGBA(image.Rect(0, 0, size+2*buffer, size+2*buffer))
+		tiles[size] = make(map[imagery.Format][]byte)
+		for _, format := range imagery.SupportedFormats() {
+			var buf bytes.Buffer
+			if err := imagery.Encode(&buf, blank, format); err != nil {
+				return nil, fmt.Errorf("failed to encode blank %s tile: %w", format, err)
+			}
+			tiles[size][format] = buf.Bytes()
+		}
+	}
+	return tiles, nil
+}
+
+// serveBlankTile writes the pre-encoded blank tile in the given format and
+// size
+func (s *Server) serveBlankTile(w http.ResponseWriter, format imagery.Format, size int) {
+	data := s.blankTiles[size][format]
+	w.Header().Set("Content-Type", format.ContentType())
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Header().Set("Cache-Control", "public, max-age=86400") // 24 hours
+	w.Write(data)
+}
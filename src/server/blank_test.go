@@ -0,0 +1,80 @@
+package server
+
+import (
+	"bytes"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"org.xyzmaps.xyztiles/src/imagery"
+)
+
+func TestHandleTile_BlankOnNotFound(t *testing.T) {
+	imagePath := createTestJPEG(t)
+
+	get := func(srv *Server, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w
+	}
+
+	plain, err := New(Config{ImagePath: imagePath})
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+	if w := get(plain, "/0/1/0.png"); w.Code != http.StatusNotFound {
+		t.Errorf("Without the option expected 404, got %d", w.Code)
+	}
+
+	srv, err := New(Config{ImagePath: imagePath, BlankOnNotFound: true})
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+
+	w := get(srv, "/0/1/0.png")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "image/png" {
+		t.Errorf("Expected image/png, got %s", ct)
+	}
+	if cc := w.Header().Get("Cache-Control"); cc == "" {
+		t.Error("Expected Cache-Control on blank tile")
+	}
+
+	tile, err := png.Decode(w.Body)
+	if err != nil {
+		t.Fatalf("Failed to decode blank PNG: %v", err)
+	}
+	if b := tile.Bounds(); b.Dx() != 512 || b.Dy() != 512 {
+		t.Errorf("Expected 512x512 blank tile, got %dx%d", b.Dx(), b.Dy())
+	}
+	for _, p := range [][2]int{{0, 0}, {256, 256}, {511, 511}} {
+		if _, _, _, a := tile.At(p[0], p[1]).RGBA(); a != 0 {
+			t.Errorf("Expected transparent pixel at %v, got alpha %d", p, a)
+		}
+	}
+
+	// The blank tile is encoded once and reused
+	if again := get(srv, "/3/8/8.png"); !bytes.Equal(again.Body.Bytes(), srv.blankTiles[imagery.TileSize]["png"]) {
+		t.Error("Expected the same pre-encoded blank tile for every miss")
+	}
+
+	// Other formats get a blank tile in the requested format
+	w = get(srv, "/0/0/1.jpg")
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "image/jpeg" {
+		t.Errorf("Expected 200 image/jpeg, got %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+	if _, err := jpeg.Decode(w.Body); err != nil {
+		t.Errorf("Failed to decode blank JPEG: %v", err)
+	}
+
+	// Malformed and invalid requests still fail
+	for _, path := range []string{"/0/abc/0.png", "/-1/0/0.png"} {
+		if w := get(srv, path); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", path, w.Code)
+		}
+	}
+}
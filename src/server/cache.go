@@ -0,0 +1,170 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"org.xyzmaps.xyztiles/src/imagery"
+	"org.xyzmaps.xyztiles/src/lrucache"
+)
+
+// ErrCacheMiss is returned by TileCache.Get for a tile that is not cached
+var ErrCacheMiss = errors.New("tile not cached")
+
+// ErrCacheEntryTooLarge is returned by TileCache.Put for a tile larger than
+// the cache stores
+var ErrCacheEntryTooLarge = errors.New("tile too large to cache")
+
+// TileCache stores encoded tiles by key. Keys are slash-separated paths
+// naming the tileset version, layer, coordinates, size and format, such as
+// 3fa2c1d0e9b84a17/default/2/1/3.png, so a cache may be shared by servers
+// rendering the same images. Get returns ErrCacheMiss for a tile that is
+// not cached. Implementations must be safe for concurrent use.
+type TileCache interface {
+	Get(ctx context.Context, key string) ([]byte, error)
+	Put(ctx context.Context, key string, data []byte) error
+	Delete(ctx context.Context, key string) error
+}
+
+var (
+	_ TileCache = (*tileCache)(nil)
+	_ TileCache = (*S3Cache)(nil)
+	_ TileCache = (*RedisCache)(nil)
+)
+
+// tileCache is an LRU cache of encoded tiles bounded by total size in
+// bytes, counting lookups
+type tileCache struct {
+	lru *lrucache.Cache
+
+	mu     sync.Mutex // Guards the counters, and orders addIfCurrent and purge
+	gen    uint64     // incremented by purge
+	hits   uint64
+	misses uint64
+}
+
+// cacheStats is a snapshot of a tileCache's size and effectiveness
+type cacheStats struct {
+	Entries  int     `json:"entries"`
+	Bytes    int64   `json:"bytes"`
+	MaxBytes int64   `json:"max_bytes"`
+	Hits     uint64  `json:"hits"`
+	Misses   uint64  `json:"misses"`
+	HitRatio float64 `json:"hit_ratio"` // hits / (hits + misses), 0 before any lookup
+}
+
+// newTileCache returns a cache holding up to maxBytes of tile data
+func newTileCache(maxBytes int64) *tileCache {
+	return &tileCache{lru: lrucache.New(maxBytes)}
+}
+
+// tileKey returns the cache key for a tile of a layer in a given size and
+// format. Tiles of the default size keep the key they had before sizes.
+func tileKey(layer string, z, x, y, size int, format imagery.Format) string {
+	if size != imagery.TileSize {
+		return fmt.Sprintf("%s/%d/%d/%d@%d.%s", layer, z, x, y, size, format)
+	}
+	return fmt.Sprintf("%s/%d/%d/%d.%s", layer, z, x, y, format)
+}
+
+// get returns the cached data for key, marking it recently used
+func (c *tileCache) get(key string) ([]byte, bool) {
+	data, ok := c.lru.Get(key)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if ok {
+		c.hits++
+	} else {
+		c.misses++
+	}
+	return data, ok
+}
+
+// Get implements TileCache
+func (c *tileCache) Get(_ context.Context, key string) ([]byte, error) {
+	if data, ok := c.get(key); ok {
+		return data, nil
+	}
+	return nil, ErrCacheMiss
+}
+
+// Put implements TileCache
+func (c *tileCache) Put(_ context.Context, key string, data []byte) error {
+	c.add(key, data)
+	return nil
+}
+
+// Delete implements TileCache
+func (c *tileCache) Delete(_ context.Context, key string) error {
+	c.lru.Remove(key)
+	return nil
+}
+
+// contains reports whether key is cached without counting a lookup or
+// marking it recently used
+func (c *tileCache) contains(key string) bool {
+	return c.lru.Contains(key)
+}
+
+// add stores data under key, evicting least recently used entries to stay
+// within maxBytes. Entries larger than the whole cache are not stored.
+func (c *tileCache) add(key string, data []byte) {
+	c.lru.Add(key, data)
+}
+
+// addIfCurrent stores data under key unless the cache has been purged since
+// generation gen was read, so tiles rendered from a replaced base map are
+// not cached
+func (c *tileCache) addIfCurrent(gen uint64, key string, data []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.gen != gen {
+		return
+	}
+	c.lru.Add(key, data)
+}
+
+// generation returns a token for addIfCurrent that is invalidated by purge
+func (c *tileCache) generation() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.gen
+}
+
+// purge removes every cached tile and returns how many tiles and bytes
+// were removed
+func (c *tileCache) purge() (entries int, bytes int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gen++
+	return c.lru.Clear()
+}
+
+// len returns the number of cached tiles
+func (c *tileCache) len() int {
+	return c.lru.Len()
+}
+
+// size returns the total bytes of cached tile data
+func (c *tileCache) size() int64 {
+	return c.lru.Bytes()
+}
+
+// stats returns a snapshot of the cache's size and hit counts
+func (c *tileCache) stats() cacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	st := cacheStats{
+		Entries:  c.lru.Len(),
+		Bytes:    c.lru.Bytes(),
+		MaxBytes: c.lru.MaxBytes(),
+		Hits:     c.hits,
+		Misses:   c.misses,
+	}
+	if lookups := c.hits + c.misses; lookups > 0 {
+		st.HitRatio = float64(c.hits) / float64(lookups)
+	}
+	return st
+}
@@ -0,0 +1,119 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"org.xyzmaps.xyztiles/src/imagery"
+)
+
+func TestTileCache_GetAdd(t *testing.T) {
+	c := newTileCache(100)
+
+	if _, ok := c.get("0/0/0.png"); ok {
+		t.Fatal("Expected miss on empty cache")
+	}
+
+	c.add("0/0/0.png", []byte("tile"))
+	data, ok := c.get("0/0/0.png")
+	if !ok || !bytes.Equal(data, []byte("tile")) {
+		t.Errorf("Expected cached tile, got %q, %v", data, ok)
+	}
+
+	// Replacing an entry updates the size accounting
+	c.add("0/0/0.png", []byte("longer tile"))
+	if c.len() != 1 || c.size() != int64(len("longer tile")) {
+		t.Errorf("Expected 1 entry of %d bytes, got %d entries of %d bytes", len("longer tile"), c.len(), c.size())
+	}
+}
+
+func TestTileCache_EvictsLeastRecentlyUsed(t *testing.T) {
+	c := newTileCache(30)
+	c.add("a", make([]byte, 10))
+	c.add("b", make([]byte, 10))
+	c.add("c", make([]byte, 10))
+
+	// Touch a so b becomes the oldest
+	c.get("a")
+	c.add("d", make([]byte, 10))
+
+	if _, ok := c.get("b"); ok {
+		t.Error("Expected least recently used entry to be evicted")
+	}
+	for _, key := range []string{"a", "c", "d"} {
+		if _, ok := c.get(key); !ok {
+			t.Errorf("Expected %s to remain cached", key)
+		}
+	}
+	if c.size() > 30 {
+		t.Errorf("Cache exceeds its limit: %d bytes", c.size())
+	}
+
+	// Entries larger than the cache are never stored
+	c.add("huge", make([]byte, 31))
+	if _, ok := c.get("huge"); ok {
+		t.Error("Expected oversized entry to be skipped")
+	}
+}
+
+func TestTileCache_Purge(t *testing.T) {
+	c := newTileCache(100)
+	c.add("a", []byte("tile"))
+	gen := c.generation()
+
+	c.purge()
+	if c.len() != 0 || c.size() != 0 {
+		t.Errorf("Expected empty cache after purge, got %d entries of %d bytes", c.len(), c.size())
+	}
+
+	// Tiles rendered before the purge are dropped, later ones are stored
+	c.addIfCurrent(gen, "b", []byte("stale"))
+	if _, ok := c.get("b"); ok {
+		t.Error("Expected tile from before the purge to be skipped")
+	}
+	c.addIfCurrent(c.generation(), "b", []byte("fresh"))
+	if data, ok := c.get("b"); !ok || string(data) != "fresh" {
+		t.Errorf("Expected fresh tile to be cached, got %q, %v", data, ok)
+	}
+}
+
+func TestTileCache_TileCache(t *testing.T) {
+	var c TileCache = newTileCache(100)
+	ctx := context.Background()
+
+	if _, err := c.Get(ctx, "a"); !errors.Is(err, ErrCacheMiss) {
+		t.Errorf("Expected ErrCacheMiss, got %v", err)
+	}
+	if err := c.Put(ctx, "a", []byte("tile")); err != nil {
+		t.Fatalf("Put() failed: %v", err)
+	}
+	if data, err := c.Get(ctx, "a"); err != nil || string(data) != "tile" {
+		t.Errorf("Expected the tile, got %q, %v", data, err)
+	}
+	if err := c.Delete(ctx, "a"); err != nil {
+		t.Fatalf("Delete() failed: %v", err)
+	}
+	if _, err := c.Get(ctx, "a"); !errors.Is(err, ErrCacheMiss) {
+		t.Errorf("Expected ErrCacheMiss after Delete, got %v", err)
+	}
+	if mem := c.(*tileCache); mem.len() != 0 || mem.size() != 0 {
+		t.Errorf("Expected an empty cache, got %d entries of %d bytes", mem.len(), mem.size())
+	}
+}
+
+func TestTileKey(t *testing.T) {
+	if got := tileKey("night", 3, 1, 2, imagery.TileSize, imagery.FormatWebP); got != "night/3/1/2.webp" {
+		t.Errorf("Expected night/3/1/2.webp, got %s", got)
+	}
+	if got := tileKey("night", 3, 1, 2, 256, imagery.FormatWebP); got != "night/3/1/2@256.webp" {
+		t.Errorf("Expected night/3/1/2@256.webp, got %s", got)
+	}
+	if tileKey("day", 1, 0, 0, imagery.TileSize, imagery.FormatPNG) == tileKey("day", 1, 0, 0, imagery.TileSize, imagery.FormatJPEG) {
+		t.Error("Expected formats to have distinct keys")
+	}
+	if tileKey("day", 1, 0, 0, imagery.TileSize, imagery.FormatPNG) == tileKey("night", 1, 0, 0, imagery.TileSize, imagery.FormatPNG) {
+		t.Error("Expected layers to have distinct keys")
+	}
+}
@@ -0,0 +1,89 @@
+package server
+
+import (
+	"context"
+	"image"
+	"log/slog"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHandleTile_ClientDisconnectAbortsRender(t *testing.T) {
+	rec := &recordingHandler{}
+	srv, err := New(Config{
+		ImagePath: createTestJPEG(t),
+		Logger:    slog.New(rec),
+	})
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+
+	// A slow render that only finishes when its context is cancelled
+	started := make(chan struct{})
+	aborted := make(chan error, 1)
+	srv.render = func(ctx context.Context, l *layer, z, x, y, size int) (*image.RGBA, error) {
+		close(started)
+		select {
+		case <-ctx.Done():
+			aborted <- ctx.Err()
+			return nil, ctx.Err()
+		case <-time.After(5 * time.Second):
+			return image.NewRGBA(image.Rect(0, 0, 8, 8)), nil
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req := httptest.NewRequest("GET", "/0/0/0.png", nil).WithContext(ctx)
+	w := httptest.NewRecorder()
+
+	done := make(chan struct{})
+	go func() {
+		srv.Handler().ServeHTTP(w, req)
+		close(done)
+	}()
+
+	<-started
+	cancel()
+
+	select {
+	case err := <-aborted:
+		if err != context.Canceled {
+			t.Errorf("Expected render to see context.Canceled, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Render was not aborted after the client disconnected")
+	}
+	<-done
+
+	if w.Body.Len() != 0 {
+		t.Errorf("Expected no bytes written, got %d", w.Body.Len())
+	}
+	for _, r := range rec.records {
+		if r.Level >= slog.LevelError {
+			t.Errorf("Cancelled render should not log an error, got %q", r.Message)
+		}
+	}
+}
+
+func TestHandleTile_CancelledBeforeEncode(t *testing.T) {
+	srv, err := New(Config{ImagePath: createTestJPEG(t)})
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+
+	// The client disconnects just as the render completes
+	ctx, cancel := context.WithCancel(context.Background())
+	srv.render = func(context.Context, *layer, int, int, int, int) (*image.RGBA, error) {
+		cancel()
+		return image.NewRGBA(image.Rect(0, 0, 8, 8)), nil
+	}
+
+	req := httptest.NewRequest("GET", "/0/0/0.png", nil).WithContext(ctx)
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, req)
+
+	if w.Body.Len() != 0 {
+		t.Errorf("Expected encoding to be skipped, got %d bytes", w.Body.Len())
+	}
+}
@@ -0,0 +1,34 @@
+package server
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// clientIP returns the IP address of the client that made r.
+// When trustProxy is set, the address appended by the nearest proxy in
+// X-Forwarded-For (the right-most entry) is used, falling back to X-Real-IP.
+// Otherwise the headers are ignored, since any client can set them.
+func clientIP(r *http.Request, trustProxy bool) string {
+	if trustProxy {
+		if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
+			parts := strings.Split(xff, ",")
+			for i := len(parts) - 1; i >= 0; i-- {
+				if ip := strings.TrimSpace(parts[i]); net.ParseIP(ip) != nil {
+					return ip
+				}
+			}
+		}
+		if ip := strings.TrimSpace(r.Header.Get("X-Real-IP")); net.ParseIP(ip) != nil {
+			return ip
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		// RemoteAddr without a port (e.g. unix socket connections)
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,70 @@
+package server
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+)
+
+// limitListener holds at most cap(sem) connections open at a time. Once the
+// limit is reached Accept holds the one connection it has just accepted
+// until an open connection closes, so further clients queue in the kernel's
+// accept backlog instead of each holding a file descriptor.
+type limitListener struct {
+	net.Listener
+	sem       chan struct{}
+	open      *atomic.Int64 // Connections accepted and not yet closed
+	done      chan struct{} // Closed by Close, ending a wait for a slot
+	closeOnce sync.Once
+}
+
+// newLimitListener wraps ln to hold at most n connections open, counting
+// them in open
+func newLimitListener(ln net.Listener, n int, open *atomic.Int64) *limitListener {
+	return &limitListener{Listener: ln, sem: make(chan struct{}, n), open: open, done: make(chan struct{})}
+}
+
+// share wraps ln to draw on l's slots, so the limit covers both listeners
+func (l *limitListener) share(ln net.Listener) *limitListener {
+	return &limitListener{Listener: ln, sem: l.sem, open: l.open, done: make(chan struct{})}
+}
+
+// Accept waits for the next connection, then for a free slot. A slot is
+// only taken for a connection in hand, so listeners sharing the limit do not
+// starve each other by waiting.
+func (l *limitListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	select {
+	case l.sem <- struct{}{}:
+	case <-l.done:
+		c.Close()
+		return nil, net.ErrClosed
+	}
+	l.open.Add(1)
+	return &limitConn{Conn: c, release: func() {
+		l.open.Add(-1)
+		<-l.sem
+	}}, nil
+}
+
+// Close closes the listener and ends any wait in Accept for a free slot
+func (l *limitListener) Close() error {
+	l.closeOnce.Do(func() { close(l.done) })
+	return l.Listener.Close()
+}
+
+// limitConn frees its listener slot the first time it is closed
+type limitConn struct {
+	net.Conn
+	once    sync.Once
+	release func()
+}
+
+func (c *limitConn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(c.release)
+	return err
+}
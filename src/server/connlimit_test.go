@@ -0,0 +1,171 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"image/color"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestMaxConnections(t *testing.T) {
+	const limit = 3
+	srv, err := NewWithBaseMap(solidBaseMap(color.RGBA{}), Config{Listen: "127.0.0.1:0", MaxConnections: limit})
+	if err != nil {
+		t.Fatalf("NewWithBaseMap() failed: %v", err)
+	}
+	ln, err := srv.Listen()
+	if err != nil {
+		t.Fatalf("Listen() failed: %v", err)
+	}
+	defer ln.Close()
+	go srv.Serve(ln)
+	defer srv.Shutdown(context.Background())
+
+	// Each connection sends a keep-alive request and reports when it gets a
+	// response; served connections then stay open
+	served := make(chan int, limit+5)
+	conns := make([]net.Conn, limit+5)
+	for i := range conns {
+		c, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			t.Fatalf("Dial %d failed: %v", i, err)
+		}
+		defer c.Close()
+		conns[i] = c
+		if _, err := c.Write([]byte("GET /0/0/0.png HTTP/1.1\r\nHost: localhost\r\n\r\n")); err != nil {
+			t.Fatalf("Write %d failed: %v", i, err)
+		}
+		go func() {
+			if _, err := bufio.NewReader(c).ReadString('\n'); err == nil {
+				served <- i
+			}
+		}()
+	}
+
+	var first []int
+	for len(first) < limit {
+		select {
+		case i := <-served:
+			first = append(first, i)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Expected %d connections served, got %d", limit, len(first))
+		}
+	}
+	select {
+	case i := <-served:
+		t.Fatalf("Expected only %d of %d connections served, got another (%d)", limit, len(conns), i)
+	case <-time.After(300 * time.Millisecond):
+	}
+	if open := srv.debugVars().OpenConns; open != limit {
+		t.Errorf("Expected %d open connections in debug vars, got %d", limit, open)
+	}
+
+	// Closing a served connection lets one waiting connection in
+	conns[first[0]].Close()
+	select {
+	case <-served:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected a waiting connection to be served after one closed")
+	}
+	select {
+	case i := <-served:
+		t.Errorf("Expected only one more connection served, got another (%d)", i)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestMaxConnections_ShutdownWhenFull(t *testing.T) {
+	srv, err := NewWithBaseMap(solidBaseMap(color.RGBA{}), Config{Listen: "127.0.0.1:0", MaxConnections: 1})
+	if err != nil {
+		t.Fatalf("NewWithBaseMap() failed: %v", err)
+	}
+	ln, err := srv.Listen()
+	if err != nil {
+		t.Fatalf("Listen() failed: %v", err)
+	}
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- srv.Serve(ln) }()
+
+	// An idle keep-alive connection holds the only slot
+	client := &http.Client{Transport: &http.Transport{}}
+	defer client.CloseIdleConnections()
+	resp, err := client.Get("http://" + ln.Addr().String() + "/0/0/0.png")
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	start := time.Now()
+	if err := srv.Shutdown(ctx); err != nil {
+		t.Errorf("Shutdown() failed: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("Expected Shutdown to return within its 2s deadline, took %v", elapsed)
+	}
+	select {
+	case err := <-serveErr:
+		if err != nil {
+			t.Errorf("Serve() returned %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Error("Expected Serve to return after Shutdown")
+	}
+}
+
+func TestMaxConnections_SharedByListeners(t *testing.T) {
+	srv, err := NewWithBaseMap(solidBaseMap(color.RGBA{}), Config{
+		Listen:         "127.0.0.1:0",
+		ExtraListen:    []string{"127.0.0.1:0", "127.0.0.1:0"},
+		MaxConnections: 1,
+	})
+	if err != nil {
+		t.Fatalf("NewWithBaseMap() failed: %v", err)
+	}
+	lns, err := srv.ListenAll()
+	if err != nil {
+		t.Fatalf("ListenAll() failed: %v", err)
+	}
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- srv.StartListeners(lns) }()
+
+	// Listeners waiting in Accept hold no slot, so each one serves in turn
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}, Timeout: 5 * time.Second}
+	for i, ln := range lns {
+		resp, err := client.Get("http://" + ln.Addr().String() + "/0/0/0.png")
+		if err != nil {
+			t.Fatalf("GET on listener %d failed: %v", i, err)
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("Expected status 200 on listener %d, got %d", i, resp.StatusCode)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		t.Errorf("Shutdown() failed: %v", err)
+	}
+	select {
+	case err := <-serveErr:
+		if err != nil {
+			t.Errorf("StartListeners() returned %v", err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Error("Expected StartListeners to return after Shutdown")
+	}
+}
+
+func TestNew_NegativeMaxConnections(t *testing.T) {
+	if _, err := NewWithBaseMap(solidBaseMap(color.RGBA{}), Config{MaxConnections: -1}); err == nil {
+		t.Error("Expected error for negative MaxConnections")
+	}
+}
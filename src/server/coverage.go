@@ -0,0 +1,101 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"org.xyzmaps.xyztiles/src/tilemath"
+)
+
+// maxCoverageTiles caps the tiles one /tiles.ndjson request may list,
+// counted over the whole zoom range before the bounds are applied
+var maxCoverageTiles int64 = 1 << 22
+
+// coverageEntry is one line of the /tiles.ndjson listing
+type coverageEntry struct {
+	Z      int        `json:"z"`
+	X      int        `json:"x"`
+	Y      int        `json:"y"`
+	Bounds [4]float64 `json:"bounds"` // west, south, east, north in degrees
+}
+
+// handleCoverage streams every tile the server serves for the zoom range
+// given by the min and max query parameters as newline-delimited JSON.
+// The range defaults to the served minimum zoom up to the base map's native
+// max zoom, and is clamped to the served zoom range. Tiles outside the
+// configured bounds are omitted. Ranges spanning more than maxCoverageTiles
+// tiles are rejected. The layer query parameter selects a layer
+// other than the default.
+func (s *Server) handleCoverage(w http.ResponseWriter, r *http.Request) {
+	l, err := s.layerFromQuery(r.URL.Query().Get("layer"))
+	if err != nil {
+		writeError(w, r, newAPIError(http.StatusNotFound, codeUnknownLayer, err.Error()))
+		return
+	}
+	minZoom, maxZoom, err := coverageRange(r, l)
+	if err != nil {
+		writeError(w, r, newAPIError(http.StatusBadRequest, codeInvalidRequest, err.Error()))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+
+	// Entries go out as they are produced; bufio only batches small writes
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	for z := minZoom; z <= maxZoom; z++ {
+		n := 1 << uint(z)
+		for x := 0; x < n; x++ {
+			if r.Context().Err() != nil {
+				return
+			}
+			for y := 0; y < n; y++ {
+				if !s.tileInBounds(z, x, y) {
+					continue
+				}
+				b, err := tilemath.TileBounds(z, x, y)
+				if err != nil {
+					continue
+				}
+				entry := coverageEntry{Z: z, X: x, Y: y, Bounds: [4]float64{b.West, b.South, b.East, b.North}}
+				if err := enc.Encode(entry); err != nil {
+					return
+				}
+			}
+		}
+	}
+	bw.Flush()
+}
+
+// coverageRange resolves the zoom range of l requested from /tiles.ndjson
+func coverageRange(r *http.Request, l *layer) (minZoom, maxZoom int, err error) {
+	minZoom = l.minZoom
+	maxZoom = min(l.nativeMaxZoom(), l.maxZoom)
+
+	q := r.URL.Query()
+	if v := q.Get("min"); v != "" {
+		if minZoom, err = strconv.Atoi(v); err != nil || minZoom < 0 {
+			return 0, 0, fmt.Errorf("invalid min zoom %q", v)
+		}
+	}
+	if v := q.Get("max"); v != "" {
+		if maxZoom, err = strconv.Atoi(v); err != nil || maxZoom < 0 {
+			return 0, 0, fmt.Errorf("invalid max zoom %q", v)
+		}
+	}
+
+	minZoom = max(minZoom, l.minZoom)
+	maxZoom = min(maxZoom, l.nativeMaxZoom(), l.maxZoom)
+	if minZoom > maxZoom {
+		return 0, 0, fmt.Errorf("empty zoom range %d-%d (served: %d-%d, native max zoom %d)",
+			minZoom, maxZoom, l.minZoom, l.maxZoom, l.nativeMaxZoom())
+	}
+	if n := tilemath.TileCount(minZoom, maxZoom); n > maxCoverageTiles {
+		return 0, 0, fmt.Errorf("zoom range %d-%d spans %d tiles, more than the limit of %d; narrow min and max",
+			minZoom, maxZoom, n, maxCoverageTiles)
+	}
+	return minZoom, maxZoom, nil
+}
@@ -0,0 +1,101 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"image"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"org.xyzmaps.xyztiles/src/imagery"
+	"org.xyzmaps.xyztiles/src/tilemath"
+)
+
+func TestHandleCoverage(t *testing.T) {
+	// 2048px wide: native max zoom 2
+	basemap := imagery.NewBaseMap(image.NewRGBA(image.Rect(0, 0, 2048, 1024)))
+	europe := &tilemath.Bounds{West: -10, South: 35, East: 30, North: 70}
+
+	tests := []struct {
+		query       string
+		bounds      *tilemath.Bounds
+		expectCode  int
+		expectLines int
+		name        string
+	}{
+		{"?min=1&max=1", nil, http.StatusOK, 4, "single zoom"},
+		{"?min=0&max=1", nil, http.StatusOK, 5, "two zooms"},
+		{"?min=0&max=5", nil, http.StatusOK, 21, "capped at native max zoom"},
+		{"", nil, http.StatusOK, 21, "defaults"},
+		{"?min=0&max=2", europe, http.StatusOK, 7, "only tiles within bounds"},
+		{"?min=3", nil, http.StatusBadRequest, 0, "above native max zoom"},
+		{"?min=2&max=1", nil, http.StatusBadRequest, 0, "inverted range"},
+		{"?max=abc", nil, http.StatusBadRequest, 0, "not a number"},
+		{"?min=-1", nil, http.StatusBadRequest, 0, "negative"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, err := NewWithBaseMap(basemap, Config{Bounds: tt.bounds})
+			if err != nil {
+				t.Fatalf("NewWithBaseMap() failed: %v", err)
+			}
+
+			w := httptest.NewRecorder()
+			srv.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/tiles.ndjson"+tt.query, nil))
+			if w.Code != tt.expectCode {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectCode, w.Code, w.Body.String())
+			}
+			if tt.expectCode != http.StatusOK {
+				return
+			}
+			if ct := w.Header().Get("Content-Type"); ct != "application/x-ndjson" {
+				t.Errorf("Expected Content-Type application/x-ndjson, got %s", ct)
+			}
+
+			lines := 0
+			scanner := bufio.NewScanner(w.Body)
+			for scanner.Scan() {
+				var entry coverageEntry
+				if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+					t.Fatalf("Line %d is not JSON: %v", lines+1, err)
+				}
+				b, err := tilemath.TileBounds(entry.Z, entry.X, entry.Y)
+				if err != nil {
+					t.Fatalf("Line %d has invalid tile: %v", lines+1, err)
+				}
+				if entry.Bounds != [4]float64{b.West, b.South, b.East, b.North} {
+					t.Errorf("Line %d: bounds %v do not match tile %d/%d/%d", lines+1, entry.Bounds, entry.Z, entry.X, entry.Y)
+				}
+				lines++
+			}
+			if lines != tt.expectLines {
+				t.Errorf("Expected %d lines, got %d", tt.expectLines, lines)
+			}
+		})
+	}
+}
+
+func TestHandleCoverage_TileLimit(t *testing.T) {
+	limit := maxCoverageTiles
+	maxCoverageTiles = 16
+	t.Cleanup(func() { maxCoverageTiles = limit })
+
+	// 2048px wide: native max zoom 2; zooms 0-2 span 21 tiles, zoom 2 alone 16
+	srv, err := NewWithBaseMap(imagery.NewBaseMap(image.NewRGBA(image.Rect(0, 0, 2048, 1024))), Config{})
+	if err != nil {
+		t.Fatalf("NewWithBaseMap() failed: %v", err)
+	}
+	h := srv.Handler()
+
+	if env := fetchError(t, h, "/tiles.ndjson?min=0&max=2", http.StatusBadRequest); env.Error.Code != codeInvalidRequest {
+		t.Errorf("Expected code %q, got %q", codeInvalidRequest, env.Error.Code)
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/tiles.ndjson?min=2&max=2", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 at the limit, got %d: %s", w.Code, w.Body.String())
+	}
+}
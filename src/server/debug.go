@@ -0,0 +1,36 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+
+	"org.xyzmaps.xyztiles/src/tilemath"
+)
+
+// Debug response headers, sent on tiles when Config.DebugHeaders is set
+const (
+	TileBoundsHeader = "X-Tile-Bounds" // west,south,east,north in degrees
+	TileSizeHeader   = "X-Tile-Size"   // Tile width and height in pixels
+	ResampleHeader   = "X-Resample"    // Interpolation kernel, e.g. catmullrom
+)
+
+// setDebugHeaders describes the tile z/x/y of l in the response headers if
+// debug headers are enabled. Coordinates outside the grid get no headers.
+func (s *Server) setDebugHeaders(w http.ResponseWriter, l *layer, z, x, y, size int) {
+	if !s.debug {
+		return
+	}
+	b, err := tilemath.TileBounds(z, x, y)
+	if err != nil {
+		return
+	}
+	w.Header().Set(TileBoundsHeader, formatDegrees(b.West)+","+formatDegrees(b.South)+","+
+		formatDegrees(b.East)+","+formatDegrees(b.North))
+	w.Header().Set(TileSizeHeader, strconv.Itoa(size+2*s.tileBuffer))
+	w.Header().Set(ResampleHeader, string(s.kernels.Kernel(z, l.nativeMaxZoom())))
+}
+
+// formatDegrees formats v with the fewest digits that round-trip
+func formatDegrees(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
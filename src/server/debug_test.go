@@ -0,0 +1,197 @@
+package server
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"org.xyzmaps.xyztiles/src/imagery"
+	"org.xyzmaps.xyztiles/src/tilemath"
+)
+
+func TestDebugHeaders(t *testing.T) {
+	tests := []struct {
+		cfg        Config
+		path       string
+		z, x, y    int
+		expectSize int
+		name       string
+	}{
+		{Config{DebugHeaders: true}, "/0/0/0.png", 0, 0, 0, 512, "whole world"},
+		{Config{DebugHeaders: true}, "/3/5/2.png", 3, 5, 2, 512, "zoom 3 tile"},
+		{Config{DebugHeaders: true, CacheMaxBytes: 16 << 20}, "/3/5/2.jpg", 3, 5, 2, 512, "cached tile"},
+		{Config{DebugHeaders: true, TileBuffer: 8}, "/2/1/1.png", 2, 1, 1, 528, "buffered tile"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, err := NewWithBaseMap(solidBaseMap(color.RGBA{0, 0, 255, 255}), tt.cfg)
+			if err != nil {
+				t.Fatalf("NewWithBaseMap() failed: %v", err)
+			}
+			want, err := tilemath.TileBounds(tt.z, tt.x, tt.y)
+			if err != nil {
+				t.Fatalf("TileBounds() failed: %v", err)
+			}
+
+			// Twice, so the cached case is served from the cache
+			for range 2 {
+				req := httptest.NewRequest("GET", tt.path, nil)
+				w := httptest.NewRecorder()
+				srv.Handler().ServeHTTP(w, req)
+				if w.Code != http.StatusOK {
+					t.Fatalf("Expected status 200, got %d", w.Code)
+				}
+
+				parts := strings.Split(w.Header().Get(TileBoundsHeader), ",")
+				if len(parts) != 4 {
+					t.Fatalf("Expected 4 comma-separated values, got %q", w.Header().Get(TileBoundsHeader))
+				}
+				var got [4]float64
+				for i, p := range parts {
+					if got[i], err = strconv.ParseFloat(p, 64); err != nil {
+						t.Fatalf("Invalid bound %q: %v", p, err)
+					}
+				}
+				if got != [4]float64{want.West, want.South, want.East, want.North} {
+					t.Errorf("Expected bounds %+v, got %v", want, got)
+				}
+				if size := w.Header().Get(TileSizeHeader); size != strconv.Itoa(tt.expectSize) {
+					t.Errorf("Expected tile size %d, got %q", tt.expectSize, size)
+				}
+				if kernel := w.Header().Get(ResampleHeader); kernel != "catmullrom" {
+					t.Errorf("Expected resample kernel catmullrom, got %q", kernel)
+				}
+			}
+		})
+	}
+}
+
+func TestDebugHeaders_Disabled(t *testing.T) {
+	srv, err := NewWithBaseMap(solidBaseMap(color.RGBA{}), Config{})
+	if err != nil {
+		t.Fatalf("NewWithBaseMap() failed: %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "/1/0/0.png", nil)
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, req)
+
+	if w.Header().Get(TileBoundsHeader) != "" || w.Header().Get(TileSizeHeader) != "" || w.Header().Get(ResampleHeader) != "" {
+		t.Error("Expected no debug headers by default")
+	}
+}
+
+func TestDebugHeaders_InterpByZoom(t *testing.T) {
+	// The 1024 pixel wide base map's native max zoom is 1
+	srv, err := NewWithBaseMap(solidBaseMap(color.RGBA{0, 0, 255, 255}), Config{
+		DebugHeaders: true,
+		InterpByZoom: imagery.KernelTable{
+			{MinZoom: 0, MaxZoom: 0, Kernel: imagery.KernelBiLinear},
+			{MinZoom: 1, MaxZoom: tilemath.MaxZoom, Overzoom: true, Kernel: imagery.KernelApproxBiLinear},
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewWithBaseMap() failed: %v", err)
+	}
+
+	for path, want := range map[string]string{
+		"/0/0/0.png": "bilinear",
+		"/1/0/0.png": "catmullrom",
+		"/2/0/0.png": "approxbilinear",
+		"/4/0/0.png": "approxbilinear",
+	} {
+		w := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if kernel := w.Header().Get(ResampleHeader); kernel != want {
+			t.Errorf("Expected %s to be resampled with %s, got %q", path, want, kernel)
+		}
+	}
+}
+
+func TestNew_InvalidInterpByZoom(t *testing.T) {
+	_, err := NewWithBaseMap(solidBaseMap(color.RGBA{}), Config{
+		InterpByZoom: imagery.KernelTable{{MinZoom: 0, MaxZoom: 3, Kernel: "lanczos"}},
+	})
+	if err == nil {
+		t.Error("Expected an unknown kernel to be rejected")
+	}
+}
+
+func TestDebugTiles(t *testing.T) {
+	background := color.RGBA{0, 0, 255, 255}
+
+	// Pixels along the edges of a decoded tile that differ from the base map
+	borderMarks := func(cfg Config) int {
+		t.Helper()
+		srv, err := NewWithBaseMap(solidBaseMap(background), cfg)
+		if err != nil {
+			t.Fatalf("NewWithBaseMap() failed: %v", err)
+		}
+		w := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/2/1/1.png", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", w.Code)
+		}
+		img, err := png.Decode(w.Body)
+		if err != nil {
+			t.Fatalf("Failed to decode tile: %v", err)
+		}
+
+		b := img.Bounds().Inset(cfg.TileBuffer)
+		n := 0
+		for i := range b.Dx() {
+			for _, p := range []image.Point{{b.Min.X + i, b.Min.Y}, {b.Min.X + i, b.Max.Y - 1}, {b.Min.X, b.Min.Y + i}, {b.Max.X - 1, b.Min.Y + i}} {
+				if color.RGBAModel.Convert(img.At(p.X, p.Y)) != background {
+					n++
+				}
+			}
+		}
+		return n
+	}
+
+	if n := borderMarks(Config{}); n != 0 {
+		t.Errorf("Expected no overlay by default, got %d border pixels", n)
+	}
+	if n := borderMarks(Config{DebugTiles: true}); n != 4*512 {
+		t.Errorf("Expected the whole border drawn, got %d of %d pixels", n, 4*512)
+	}
+	if n := borderMarks(Config{DebugTiles: true, TileBuffer: 8}); n != 4*512 {
+		t.Errorf("Expected the border around the unbuffered tile, got %d of %d pixels", n, 4*512)
+	}
+}
+
+func TestDebugTiles_SharedBaseMapUntouched(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 1024, 512))
+	draw.Draw(img, img.Bounds(), &image.Uniform{color.RGBA{0, 0, 255, 255}}, image.Point{}, draw.Src)
+	source := bytes.Clone(img.Pix)
+	bm := imagery.NewBaseMap(img)
+
+	// Both servers render from the same decoded image
+	debug, err := NewWithBaseMap(bm, Config{DebugTiles: true})
+	if err != nil {
+		t.Fatalf("NewWithBaseMap() failed: %v", err)
+	}
+	plain, err := NewWithBaseMap(bm, Config{})
+	if err != nil {
+		t.Fatalf("NewWithBaseMap() failed: %v", err)
+	}
+
+	before := fetchTileBytes(t, plain.Handler(), "/1/0/0.png")
+	for _, path := range []string{"/0/0/0.png", "/1/0/0.png", "/2/1/1.png"} {
+		fetchTileBytes(t, debug.Handler(), path)
+	}
+	if !bytes.Equal(img.Pix, source) {
+		t.Fatal("Expected debug tiles to leave the base map untouched")
+	}
+	if after := fetchTileBytes(t, plain.Handler(), "/1/0/0.png"); !bytes.Equal(after, before) {
+		t.Error("Expected tiles rendered after debug tiles to be unchanged")
+	}
+}
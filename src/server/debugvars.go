@@ -0,0 +1,120 @@
+package server
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"org.xyzmaps.xyztiles/src/tilemath"
+)
+
+// serverVars counts what the server has done for /debug/vars and /stats.
+// The counters are updated on every tile request whether or not the
+// endpoints are enabled, so they are atomics or sharded.
+type serverVars struct {
+	started     time.Time
+	tilesServed [tilemath.MaxZoom + 1]atomic.Int64 // Tiles written with 200, by zoom
+	tiles       tileCounter                        // Tiles written with 200, by tile
+	renderNanos atomic.Int64                       // Time spent rendering and encoding tiles
+	renderTimes renderHistogram
+	openConns   atomic.Int64 // Connections held open; counted only with MaxConnections
+}
+
+// tileServed counts tile z/x/y of the named layer written
+func (v *serverVars) tileServed(layer string, z, x, y int) {
+	if z >= 0 && z < len(v.tilesServed) {
+		v.tilesServed[z].Add(1)
+	}
+	v.tiles.count(tileID{layer: layer, z: z, x: x, y: y})
+}
+
+// rendered adds the time a tile took to render and encode
+func (v *serverVars) rendered(d time.Duration) {
+	v.renderNanos.Add(int64(d))
+	v.renderTimes.observe(d)
+}
+
+// debugVars is the server's own entry in /debug/vars
+type debugVars struct {
+	TilesServed map[string]int64         `json:"tiles_served"` // By zoom; zooms with no tiles are left out
+	CacheHits   uint64                   `json:"cache_hits"`
+	CacheMisses uint64                   `json:"cache_misses"`
+	RenderNanos int64                    `json:"render_ns_total"`
+	MaxConns    int                      `json:"max_connections"` // 0 for no limit
+	OpenConns   int64                    `json:"open_connections,omitempty"`
+	Renders     RenderStats              `json:"renders"`
+	SharedCache *sharedCacheStats        `json:"shared_cache,omitempty"` // Only with a shared cache
+	Layers      map[string]debugLayerVar `json:"layers"`
+}
+
+// debugLayerVar describes a layer's base map in /debug/vars. Layers served
+// from an archive or a tile provider have no dimensions.
+type debugLayerVar struct {
+	Width  int `json:"width,omitempty"`
+	Height int `json:"height,omitempty"`
+}
+
+// debugVars snapshots the counters
+func (s *Server) debugVars() debugVars {
+	dv := debugVars{
+		TilesServed: map[string]int64{},
+		RenderNanos: s.vars.renderNanos.Load(),
+		MaxConns:    s.maxConns,
+		OpenConns:   s.vars.openConns.Load(),
+		Renders:     s.renders.stats(),
+		Layers:      make(map[string]debugLayerVar, len(s.layers)),
+	}
+	for z := range s.vars.tilesServed {
+		if n := s.vars.tilesServed[z].Load(); n > 0 {
+			dv.TilesServed[strconv.Itoa(z)] = n
+		}
+	}
+	if s.cache != nil {
+		stats := s.cache.stats()
+		dv.CacheHits, dv.CacheMisses = stats.Hits, stats.Misses
+	}
+	if s.shared != nil {
+		stats := s.shared.stats()
+		dv.SharedCache = &stats
+	}
+	for name, l := range s.layers {
+		var lv debugLayerVar
+		if bm := l.baseMap(); bm != nil {
+			lv = debugLayerVar{Width: bm.Width(), Height: bm.Height()}
+		}
+		dv.Layers[name] = lv
+	}
+	return dv
+}
+
+// hiddenDebugVars are expvar variables left out of /debug/vars: cmdline
+// would reveal secrets given as flags, such as --signing-key
+var hiddenDebugVars = map[string]bool{"cmdline": true}
+
+// handleDebugVars serves the variables published with expvar, such as
+// memstats, together with the server's counters under "xyztiles", in the
+// format of expvar.Handler. The counters are not published with expvar
+// itself, where a second Server would collide.
+func (s *Server) handleDebugVars(w http.ResponseWriter, r *http.Request) {
+	own, err := json.Marshal(s.debugVars())
+	if err != nil {
+		s.logger.Error("Error encoding debug vars", "err", err)
+		writeError(w, r, newAPIError(http.StatusInternalServerError, codeInternal, "Failed to encode debug vars"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	fmt.Fprintf(w, "{\n")
+	expvar.Do(func(kv expvar.KeyValue) {
+		if hiddenDebugVars[kv.Key] {
+			return
+		}
+		fmt.Fprintf(w, "%q: %s,\n", kv.Key, kv.Value)
+	})
+	fmt.Fprintf(w, "%q: %s\n}\n", "xyztiles", own)
+}
@@ -0,0 +1,152 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"image/color"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHandleDebugVars(t *testing.T) {
+	night := Layer{Name: "night", BaseMap: solidBaseMap(color.RGBA{})}
+	srv, err := NewWithBaseMap(solidBaseMap(color.RGBA{0, 0, 255, 255}), Config{
+		DebugVars:     true,
+		CacheMaxBytes: 1 << 20,
+		Layers:        []Layer{night},
+	})
+	if err != nil {
+		t.Fatalf("NewWithBaseMap() failed: %v", err)
+	}
+
+	// Four tiles at zoom 1, one of them twice, one at zoom 2 and a bad path
+	for _, path := range []string{"/1/0/0.png", "/1/0/0.png", "/1/1/1.png", "/night/1/0/1.png", "/2/3/3.png", "/9/0/0/0.png"} {
+		w := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+	}
+
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/debug/vars", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/json; charset=utf-8" {
+		t.Errorf("Expected Content-Type application/json; charset=utf-8, got %s", ct)
+	}
+
+	var all map[string]json.RawMessage
+	if err := json.Unmarshal(w.Body.Bytes(), &all); err != nil {
+		t.Fatalf("Expected a JSON object, got %q: %v", w.Body.String(), err)
+	}
+	for _, key := range []string{"memstats", "xyztiles"} {
+		if all[key] == nil {
+			t.Errorf("Expected %q in /debug/vars", key)
+		}
+	}
+	if all["cmdline"] != nil {
+		t.Error("Expected cmdline to be left out of /debug/vars")
+	}
+
+	var vars debugVars
+	if err := json.Unmarshal(all["xyztiles"], &vars); err != nil {
+		t.Fatalf("Failed to decode the server's vars: %v", err)
+	}
+	if vars.TilesServed["1"] != 4 || vars.TilesServed["2"] != 1 || len(vars.TilesServed) != 2 {
+		t.Errorf("Expected 4 tiles at zoom 1 and 1 at zoom 2, got %v", vars.TilesServed)
+	}
+	if vars.CacheHits != 1 || vars.CacheMisses != 4 {
+		t.Errorf("Expected 1 cache hit and 4 misses, got %d and %d", vars.CacheHits, vars.CacheMisses)
+	}
+	if vars.RenderNanos <= 0 {
+		t.Errorf("Expected render time to be counted, got %d", vars.RenderNanos)
+	}
+	for _, name := range []string{PrimaryLayerName, "night"} {
+		if l := vars.Layers[name]; l.Width != 1024 || l.Height != 512 {
+			t.Errorf("Expected layer %s to be 1024x512, got %dx%d", name, l.Width, l.Height)
+		}
+	}
+}
+
+func TestHandleDebugVars_HidesFlags(t *testing.T) {
+	args := os.Args
+	os.Args = []string{"xyztiles", "--signing-key=hunter2", "--basic-auth=admin:swordfish", "--proxy-url=https://tiles.example.com/{z}/{x}/{y}.png?key=abc123"}
+	t.Cleanup(func() { os.Args = args })
+
+	srv, err := NewWithBaseMap(solidBaseMap(color.RGBA{}), Config{DebugVars: true})
+	if err != nil {
+		t.Fatalf("NewWithBaseMap() failed: %v", err)
+	}
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/debug/vars", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	for _, secret := range []string{"hunter2", "swordfish", "abc123"} {
+		if strings.Contains(w.Body.String(), secret) {
+			t.Errorf("Expected %q to be left out of /debug/vars", secret)
+		}
+	}
+}
+
+func TestHandleDebugVars_Disabled(t *testing.T) {
+	srv, err := NewWithBaseMap(solidBaseMap(color.RGBA{}), Config{})
+	if err != nil {
+		t.Fatalf("NewWithBaseMap() failed: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/debug/vars", nil))
+	if w.Code == http.StatusOK {
+		t.Errorf("Expected /debug/vars to be off by default, got status %d", w.Code)
+	}
+}
+
+// holdRenderSlots takes srv's only render slot and queues one more request
+// behind it, until the test ends
+func holdRenderSlots(t *testing.T, srv *Server) {
+	t.Helper()
+	if err := srv.renders.acquire(context.Background()); err != nil {
+		t.Fatalf("Failed to take the render slot: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if srv.renders.acquire(ctx) == nil {
+			srv.renders.release()
+		}
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+		srv.renders.release()
+	})
+	for srv.renders.stats().Queued == 0 {
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestHandleDebugVars_Renders(t *testing.T) {
+	srv, err := NewWithBaseMap(solidBaseMap(color.RGBA{}), Config{DebugVars: true, MaxConcurrentRenders: 1})
+	if err != nil {
+		t.Fatalf("NewWithBaseMap() failed: %v", err)
+	}
+	holdRenderSlots(t, srv)
+
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/debug/vars", nil))
+	var all struct {
+		Vars debugVars `json:"xyztiles"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &all); err != nil {
+		t.Fatalf("Expected a JSON object, got %q: %v", w.Body.String(), err)
+	}
+	want := RenderStats{Limit: 1, InFlight: 1, Queued: 1}
+	if all.Vars.Renders != want {
+		t.Errorf("Expected renders %+v, got %+v", want, all.Vars.Renders)
+	}
+}
@@ -0,0 +1,83 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Error codes identifying the cause of an error response
+const (
+	codeInvalidTilePath    = "invalid_tile_path"
+	codeInvalidZoom        = "invalid_zoom"
+	codeUnknownLayer       = "unknown_layer"
+	codeFormatNotAvailable = "format_not_available"
+	codeZoomNotServed      = "zoom_not_served"
+	codeOutsideBounds      = "tile_outside_bounds"
+	codePointOutsideBounds = "point_outside_bounds"
+	codeTileOutOfRange     = "tile_out_of_range"
+	codeTileNotInArchive   = "tile_not_in_archive"
+	codeTileNotUpstream    = "tile_not_upstream"
+	codeRenderFailed       = "render_failed"
+	codeServerBusy         = "server_busy"
+	codeRenderTimeout      = "render_timeout"
+	codeRateLimited        = "rate_limited"
+	codeUnauthorized       = "unauthorized"
+	codeForbidden          = "forbidden"
+	codeInvalidRequest     = "invalid_request"
+	codeMethodNotAllowed   = "method_not_allowed"
+	codeNotFound           = "not_found"
+	codeInternal           = "internal_error"
+)
+
+// apiError is an error response. Message is shown to clients, so it must
+// not carry internal details such as file paths; log those instead.
+type apiError struct {
+	status    int
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	Z         *int   `json:"z,omitempty"`
+	X         *int   `json:"x,omitempty"`
+	Y         *int   `json:"y,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// newAPIError returns an error response with the given status and code
+func newAPIError(status int, code, message string) *apiError {
+	return &apiError{status: status, Code: code, Message: message}
+}
+
+// tileError returns an error response about the tile z/x/y
+func tileError(status int, code, message string, z, x, y int) *apiError {
+	e := newAPIError(status, code, message)
+	e.Z, e.X, e.Y = &z, &x, &y
+	return e
+}
+
+// writeError sends e as a JSON envelope, {"error": {...}}, to clients whose
+// Accept header names application/json, and as plain text otherwise
+func writeError(w http.ResponseWriter, r *http.Request, e *apiError) {
+	if !acceptsJSON(r.Header.Get("Accept")) {
+		http.Error(w, e.Message, e.status)
+		return
+	}
+
+	w.Header().Del("Content-Length")
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(e.status)
+	e.RequestID = requestID(r.Context())
+	json.NewEncoder(w).Encode(struct {
+		Error *apiError `json:"error"`
+	}{e})
+}
+
+// acceptsJSON reports whether an Accept header explicitly asks for JSON.
+// Wildcards do not count, so browsers and curl keep getting plain text.
+func acceptsJSON(accept string) bool {
+	for _, r := range parseAccept(accept) {
+		if r.mediaType == "application/json" && r.q > 0 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,171 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"image"
+	"image/color"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"org.xyzmaps.xyztiles/src/imagery"
+)
+
+// errorEnvelope is the JSON body of an error response
+type errorEnvelope struct {
+	Error struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+		Z       *int   `json:"z"`
+		X       *int   `json:"x"`
+		Y       *int   `json:"y"`
+	} `json:"error"`
+}
+
+func TestErrorResponses_Codes(t *testing.T) {
+	tests := []struct {
+		cfg          Config
+		path         string
+		expectStatus int
+		expectCode   string
+		expectCoords bool
+		name         string
+	}{
+		{Config{}, "/1/2.png", http.StatusBadRequest, codeInvalidTilePath, false, "malformed path"},
+		{Config{}, "/1/0/0.gif", http.StatusBadRequest, codeInvalidTilePath, false, "unknown extension"},
+		{Config{}, "/64/0/0.png", http.StatusBadRequest, codeInvalidTilePath, false, "zoom 64"},
+		{Config{}, "/1/0/" + strings.Repeat("0", 5000) + ".png", http.StatusBadRequest, codeInvalidTilePath, false, "absurdly long path"},
+		{Config{}, strings.Repeat("/1", 5000) + ".png", http.StatusBadRequest, codeInvalidTilePath, false, "absurdly many slashes"},
+		{Config{}, "/unknown/1/0/0.png", http.StatusNotFound, codeUnknownLayer, false, "unknown layer"},
+		{Config{}, "/1/5/0.png", http.StatusNotFound, codeTileOutOfRange, true, "tile outside grid"},
+		{Config{MaxZoom: 2}, "/5/0/0.png", http.StatusNotFound, codeZoomNotServed, true, "zoom not served"},
+		{Config{Formats: FormatPolicy{Allowed: []imagery.Format{imagery.FormatPNG}}}, "/1/0/0.jpg", http.StatusNotAcceptable, codeFormatNotAvailable, true, "format not available"},
+		{Config{BasicAuth: []string{"ops:secret"}}, "/1/0/0.png", http.StatusUnauthorized, codeUnauthorized, false, "missing credentials"},
+		{Config{DisableViewer: true}, "/", http.StatusNotFound, codeNotFound, false, "viewer disabled"},
+		{Config{}, "/tiles.ndjson?min=x", http.StatusBadRequest, codeInvalidRequest, false, "bad coverage range"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, err := NewWithBaseMap(solidBaseMap(color.RGBA{255, 0, 0, 255}), tt.cfg)
+			if err != nil {
+				t.Fatalf("NewWithBaseMap() failed: %v", err)
+			}
+
+			env := fetchError(t, srv.Handler(), tt.path, tt.expectStatus)
+			if env.Error.Code != tt.expectCode {
+				t.Errorf("Expected code %q, got %q", tt.expectCode, env.Error.Code)
+			}
+			if env.Error.Message == "" {
+				t.Error("Expected a message")
+			}
+			if hasCoords := env.Error.Z != nil && env.Error.X != nil && env.Error.Y != nil; hasCoords != tt.expectCoords {
+				t.Errorf("Expected coordinates: %v, got z=%v x=%v y=%v", tt.expectCoords, env.Error.Z, env.Error.X, env.Error.Y)
+			}
+		})
+	}
+}
+
+func TestErrorResponses_RenderFailureHidesDetails(t *testing.T) {
+	srv, err := NewWithBaseMap(solidBaseMap(color.RGBA{}), Config{})
+	if err != nil {
+		t.Fatalf("NewWithBaseMap() failed: %v", err)
+	}
+	srv.render = func(context.Context, *layer, int, int, int, int) (*image.RGBA, error) {
+		return nil, errors.New("read /srv/private/world.jpg: input/output error")
+	}
+
+	env := fetchError(t, srv.Handler(), "/2/1/3.png", http.StatusInternalServerError)
+	if env.Error.Code != codeRenderFailed {
+		t.Errorf("Expected code %q, got %q", codeRenderFailed, env.Error.Code)
+	}
+	if strings.Contains(env.Error.Message, "/srv/private") {
+		t.Errorf("Expected internal error details to be hidden, got %q", env.Error.Message)
+	}
+	if *env.Error.Z != 2 || *env.Error.X != 1 || *env.Error.Y != 3 {
+		t.Errorf("Expected tile 2/1/3, got %d/%d/%d", *env.Error.Z, *env.Error.X, *env.Error.Y)
+	}
+}
+
+func TestErrorResponses_RateLimited(t *testing.T) {
+	srv, err := NewWithBaseMap(solidBaseMap(color.RGBA{}), Config{RateLimit: 1, CacheMaxBytes: 16 << 20})
+	if err != nil {
+		t.Fatalf("NewWithBaseMap() failed: %v", err)
+	}
+
+	fetchError(t, srv.Handler(), "/0/0/0.png", http.StatusOK)
+	if env := fetchError(t, srv.Handler(), "/0/0/0.png", http.StatusTooManyRequests); env.Error.Code != codeRateLimited {
+		t.Errorf("Expected code %q, got %q", codeRateLimited, env.Error.Code)
+	}
+}
+
+func TestErrorResponses_Negotiation(t *testing.T) {
+	tests := []struct {
+		accept     string
+		expectJSON bool
+		name       string
+	}{
+		{"", false, "no Accept header"},
+		{"*/*", false, "wildcard"},
+		{"text/plain", false, "plain text"},
+		{"application/json", true, "JSON"},
+		{"image/png, application/json;q=0.5", true, "JSON among image types"},
+		{"application/json;q=0", false, "JSON refused"},
+	}
+
+	srv, err := NewWithBaseMap(solidBaseMap(color.RGBA{}), Config{})
+	if err != nil {
+		t.Fatalf("NewWithBaseMap() failed: %v", err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/1/5/0.png", nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			w := httptest.NewRecorder()
+			srv.Handler().ServeHTTP(w, req)
+
+			if w.Code != http.StatusNotFound {
+				t.Fatalf("Expected status 404, got %d", w.Code)
+			}
+			contentType := w.Header().Get("Content-Type")
+			if isJSON := contentType == "application/json"; isJSON != tt.expectJSON {
+				t.Errorf("Expected JSON: %v, got Content-Type %q", tt.expectJSON, contentType)
+			}
+			if !tt.expectJSON && !strings.HasPrefix(w.Body.String(), "Tile not found") {
+				t.Errorf("Expected plain text message, got %q", w.Body.String())
+			}
+		})
+	}
+}
+
+// fetchError requests path as JSON, checks the status, and decodes the
+// error envelope of non-200 responses
+func fetchError(t *testing.T, h http.Handler, path string, expectStatus int) errorEnvelope {
+	t.Helper()
+
+	req := httptest.NewRequest("GET", path, nil)
+	req.Header.Set("Accept", "application/json")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	if w.Code != expectStatus {
+		t.Fatalf("Expected status %d for %s, got %d: %s", expectStatus, path, w.Code, w.Body.String())
+	}
+	var env errorEnvelope
+	if w.Code == http.StatusOK {
+		return env
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Fatalf("Expected JSON error, got Content-Type %q", ct)
+	}
+	if err := json.NewDecoder(w.Body).Decode(&env); err != nil {
+		t.Fatalf("Failed to decode error envelope: %v", err)
+	}
+	return env
+}
@@ -0,0 +1,167 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"org.xyzmaps.xyztiles/src/atomicfile"
+	"org.xyzmaps.xyztiles/src/imagery"
+)
+
+// exportQueueSize is how many rendered tiles may wait to be written to the
+// export directory before further tiles are dropped
+const exportQueueSize = 256
+
+// exportManifestName is the manifest file kept at the root of the export
+// directory
+const exportManifestName = "manifest.json"
+
+// exportJob is a rendered tile waiting to be written
+type exportJob struct {
+	path string // Relative to the export directory, e.g. 3/4/2.png
+	z    int
+	data []byte
+}
+
+// exportManifest describes the exported tiles in manifest.json
+type exportManifest struct {
+	Versions map[string]string `json:"tileset_versions"` // By layer; a hash of each image unless configured
+	Tiles    int               `json:"tiles"`            // Distinct tile files written since startup
+	ByZoom   map[string]int    `json:"tiles_by_zoom"`
+	Dropped  int64             `json:"dropped"` // Tiles not written because the queue was full
+	Updated  time.Time         `json:"updated"`
+}
+
+// tileExporter writes rendered tiles to a static tile tree in the
+// background, so a server's traffic can be recorded for hosting without it.
+// Each file is written to a temporary file and renamed into place, so
+// readers never see a partial tile.
+type tileExporter struct {
+	dir      string
+	versions func() map[string]string
+	logger   *slog.Logger
+	queue    chan exportJob
+	done     chan struct{} // Closed when the writer has stopped
+	lastSave error         // Of the writer's last manifest save, so failures are logged once
+
+	mu      sync.Mutex
+	closed  bool           // The queue is closed; enqueue drops tiles
+	written map[string]int // Zoom of every distinct path written
+	dropped int64
+}
+
+// newTileExporter creates dir and starts the writer. versions reports the
+// tileset version of each layer for the manifest.
+func newTileExporter(dir string, versions func() map[string]string, logger *slog.Logger) (*tileExporter, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create export directory: %w", err)
+	}
+	e := &tileExporter{
+		dir:      dir,
+		versions: versions,
+		logger:   logger,
+		queue:    make(chan exportJob, exportQueueSize),
+		done:     make(chan struct{}),
+		written:  map[string]int{},
+	}
+	go e.run()
+	return e, nil
+}
+
+// shutdown stops accepting tiles and waits for the queued ones and the
+// manifest to be written
+func (e *tileExporter) shutdown() {
+	e.mu.Lock()
+	if !e.closed {
+		e.closed = true
+		close(e.queue)
+	}
+	e.mu.Unlock()
+	<-e.done
+}
+
+// exportPath returns the path of a tile below the export directory, laid out
+// like its URL: {z}/{x}/{y}.{ext} for the default layer and size, under
+// {layer}/ for other layers, with @{size} for other sizes
+func (s *Server) exportPath(l *layer, z, x, y, size int, format imagery.Format) string {
+	name := strconv.Itoa(y)
+	if size != imagery.TileSize {
+		name += "@" + strconv.Itoa(size)
+	}
+	path := filepath.Join(strconv.Itoa(z), strconv.Itoa(x), name+format.Extension())
+	if l != s.defLayer {
+		path = filepath.Join(l.name, path)
+	}
+	return path
+}
+
+// enqueue queues data to be written at path without blocking. When the queue
+// is full the tile is dropped with a warning.
+func (e *tileExporter) enqueue(path string, z int, data []byte) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.closed {
+		return
+	}
+	select {
+	case e.queue <- exportJob{path: path, z: z, data: data}:
+	default:
+		e.dropped++
+		e.logger.Warn("Export queue full, dropping tile", "path", path, "queue", exportQueueSize)
+	}
+}
+
+// run writes queued tiles until the queue is closed, saving the manifest
+// whenever the queue runs empty
+func (e *tileExporter) run() {
+	defer close(e.done)
+	for job := range e.queue {
+		if err := atomicfile.WriteFile(filepath.Join(e.dir, job.path), job.data); err != nil {
+			e.logger.Warn("Failed to export tile", "path", job.path, "err", err)
+		} else {
+			e.mu.Lock()
+			e.written[job.path] = job.z
+			e.mu.Unlock()
+		}
+		if len(e.queue) == 0 {
+			e.saveManifest()
+		}
+	}
+	e.saveManifest()
+}
+
+// manifest snapshots the export counters
+func (e *tileExporter) manifest() exportManifest {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	m := exportManifest{
+		Versions: e.versions(),
+		Tiles:    len(e.written),
+		ByZoom:   map[string]int{},
+		Dropped:  e.dropped,
+		Updated:  time.Now().UTC(),
+	}
+	for _, z := range e.written {
+		m.ByZoom[strconv.Itoa(z)]++
+	}
+	return m
+}
+
+// saveManifest writes manifest.json, logging a failure once until a save
+// succeeds again
+func (e *tileExporter) saveManifest() {
+	data, err := json.MarshalIndent(e.manifest(), "", "  ")
+	if err == nil {
+		err = atomicfile.WriteFile(filepath.Join(e.dir, exportManifestName), append(data, '\n'))
+	}
+	if err != nil && e.lastSave == nil {
+		e.logger.Warn("Failed to write export manifest", "err", err)
+	}
+	e.lastSave = err
+}
@@ -0,0 +1,175 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"org.xyzmaps.xyztiles/src/atomicfile"
+	"org.xyzmaps.xyztiles/src/imagery"
+)
+
+// fetchTileBytes requests path from h and returns the body of a 200 response
+func fetchTileBytes(t *testing.T, h http.Handler, path string) []byte {
+	t.Helper()
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 for %s, got %d", path, w.Code)
+	}
+	return w.Body.Bytes()
+}
+
+// assertNoTempFiles fails if a temporary file was left below dir
+func assertNoTempFiles(t *testing.T, dir string) {
+	t.Helper()
+
+	filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err == nil && strings.HasPrefix(d.Name(), atomicfile.TempPrefix) {
+			t.Errorf("Expected no temporary files left, found %s", path)
+		}
+		return nil
+	})
+}
+
+func TestExportDir(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "export")
+	srv, err := NewWithBaseMap(solidBaseMap(color.RGBA{0, 0, 255, 255}), Config{ExportDir: dir, TilesetVersion: "v1"})
+	if err != nil {
+		t.Fatalf("NewWithBaseMap() failed: %v", err)
+	}
+
+	served := map[string][]byte{
+		"0/0/0.png": fetchTileBytes(t, srv.Handler(), "/0/0/0.png"),
+		"1/0/1.png": fetchTileBytes(t, srv.Handler(), "/1/0/1.png"),
+		"1/1/0.jpg": fetchTileBytes(t, srv.Handler(), "/1/1/0.jpg"),
+	}
+	if err := srv.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown() failed: %v", err)
+	}
+
+	for path, want := range served {
+		got, err := os.ReadFile(filepath.Join(dir, path))
+		if err != nil {
+			t.Fatalf("Expected %s to be exported: %v", path, err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("Expected %s to match the served bytes", path)
+		}
+		decode := png.Decode
+		if strings.HasSuffix(path, ".jpg") {
+			decode = jpeg.Decode
+		}
+		if _, err := decode(bytes.NewReader(got)); err != nil {
+			t.Errorf("Expected %s to decode: %v", path, err)
+		}
+	}
+	assertNoTempFiles(t, dir)
+
+	data, err := os.ReadFile(filepath.Join(dir, exportManifestName))
+	if err != nil {
+		t.Fatalf("Expected a manifest: %v", err)
+	}
+	var m exportManifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		t.Fatalf("Failed to parse manifest: %v", err)
+	}
+	if m.Tiles != 3 || m.ByZoom["0"] != 1 || m.ByZoom["1"] != 2 || m.Versions["default"] != "v1" {
+		t.Errorf("Expected 3 tiles, 1 at zoom 0 and 2 at zoom 1, of version v1, got %+v", m)
+	}
+}
+
+func TestExportDir_ConcurrentSameTile(t *testing.T) {
+	dir := t.TempDir()
+	srv, err := NewWithBaseMap(solidBaseMap(color.RGBA{255, 0, 0, 255}), Config{ExportDir: dir})
+	if err != nil {
+		t.Fatalf("NewWithBaseMap() failed: %v", err)
+	}
+
+	// Without a cache every request renders, and exports, the tile again
+	var wg sync.WaitGroup
+	bodies := make([][]byte, 20)
+	for i := range bodies {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w := httptest.NewRecorder()
+			srv.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/2/1/1.png", nil))
+			bodies[i] = w.Body.Bytes()
+		}()
+	}
+	wg.Wait()
+	srv.Shutdown(context.Background())
+
+	got, err := os.ReadFile(filepath.Join(dir, "2", "1", "1.png"))
+	if err != nil {
+		t.Fatalf("Expected the tile to be exported: %v", err)
+	}
+	if !bytes.Equal(got, bodies[0]) {
+		t.Error("Expected the exported tile to match the served bytes")
+	}
+	assertNoTempFiles(t, dir)
+}
+
+func TestExportPath(t *testing.T) {
+	srv, err := NewWithBaseMap(solidBaseMap(color.RGBA{}), Config{
+		Layers: []Layer{{Name: "night", BaseMap: solidBaseMap(color.RGBA{})}},
+	})
+	if err != nil {
+		t.Fatalf("NewWithBaseMap() failed: %v", err)
+	}
+
+	tests := []struct {
+		layer    string
+		size     int
+		format   imagery.Format
+		expected string
+		name     string
+	}{
+		{"default", imagery.TileSize, imagery.FormatPNG, "3/4/2.png", "default layer"},
+		{"default", imagery.TileSize, imagery.FormatJPEG, "3/4/2.jpg", "jpeg extension"},
+		{"default", 256, imagery.FormatPNG, "3/4/2@256.png", "other size"},
+		{"night", imagery.TileSize, imagery.FormatPNG, "night/3/4/2.png", "other layer"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := srv.exportPath(srv.layers[tt.layer], 3, 4, 2, tt.size, tt.format)
+			if got != filepath.FromSlash(tt.expected) {
+				t.Errorf("Expected %s, got %s", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestTileExporter_DropsWhenFull(t *testing.T) {
+	// An unbuffered queue nobody reads is always full
+	e := &tileExporter{queue: make(chan exportJob), logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+	e.enqueue("0/0/0.png", 0, []byte("tile"))
+	if e.dropped != 1 {
+		t.Errorf("Expected the tile to be dropped, got %d dropped", e.dropped)
+	}
+}
+
+func TestNew_ExportDirUncreatable(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(file, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewWithBaseMap(solidBaseMap(color.RGBA{}), Config{ExportDir: filepath.Join(file, "export")}); err == nil {
+		t.Error("Expected error for an export directory below a file")
+	}
+}
@@ -0,0 +1,141 @@
+package server
+
+import (
+	"compress/gzip"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// compressibleTypes are the media types gzipMiddleware compresses. Tiles are
+// already compressed images and are never included.
+var compressibleTypes = map[string]bool{
+	"text/html":              true,
+	"text/css":               true,
+	"text/javascript":        true,
+	"application/javascript": true,
+	"application/json":       true,
+	"application/geo+json":   true,
+	"application/x-ndjson":   true,
+	"application/xml":        true,
+	"text/xml":               true,
+}
+
+// compressible reports whether a response with the given Content-Type
+// should be gzipped
+func compressible(contentType string) bool {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	return compressibleTypes[strings.ToLower(strings.TrimSpace(mediaType))]
+}
+
+// acceptsGzip reports whether an Accept-Encoding header allows gzip
+func acceptsGzip(acceptEncoding string) bool {
+	for _, r := range parseAccept(acceptEncoding) {
+		if (r.mediaType == "gzip" || r.mediaType == "*") && r.q > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// gzipWriters recycles compressors across responses
+var gzipWriters = sync.Pool{
+	New: func() any { return gzip.NewWriter(nil) },
+}
+
+// gzipMiddleware compresses responses with a compressible Content-Type for
+// clients that accept gzip. Responses that already carry a Content-Encoding,
+// such as precompressed assets, are passed through unchanged.
+func gzipMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gw := &gzipResponseWriter{
+			ResponseWriter: w,
+			accepts:        r.Method != http.MethodHead && acceptsGzip(r.Header.Get("Accept-Encoding")),
+		}
+		defer gw.close()
+		next.ServeHTTP(gw, r)
+	})
+}
+
+// gzipResponseWriter decides whether to compress once the handler has set
+// its headers, on the first WriteHeader or Write
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	accepts     bool // Client accepts gzip
+	wroteHeader bool
+	gz          *gzip.Writer // Non-nil while compressing
+}
+
+// WriteHeader chooses between compressing and passing the body through
+func (gw *gzipResponseWriter) WriteHeader(code int) {
+	if gw.wroteHeader {
+		return
+	}
+	gw.wroteHeader = true
+
+	h := gw.Header()
+	if compressible(h.Get("Content-Type")) {
+		addVary(h, "Accept-Encoding")
+		if gw.accepts && h.Get("Content-Encoding") == "" && bodyAllowed(code) && h.Get("Content-Range") == "" {
+			h.Set("Content-Encoding", "gzip")
+			h.Del("Content-Length")
+			gw.gz = gzipWriters.Get().(*gzip.Writer)
+			gw.gz.Reset(gw.ResponseWriter)
+		}
+	}
+	gw.ResponseWriter.WriteHeader(code)
+}
+
+// Write compresses b if the response is being compressed
+func (gw *gzipResponseWriter) Write(b []byte) (int, error) {
+	if !gw.wroteHeader {
+		if gw.Header().Get("Content-Type") == "" {
+			gw.Header().Set("Content-Type", http.DetectContentType(b))
+		}
+		gw.WriteHeader(http.StatusOK)
+	}
+	if gw.gz != nil {
+		return gw.gz.Write(b)
+	}
+	return gw.ResponseWriter.Write(b)
+}
+
+// Flush sends buffered compressed data to the client
+func (gw *gzipResponseWriter) Flush() {
+	if gw.gz != nil {
+		gw.gz.Flush()
+	}
+	http.NewResponseController(gw.ResponseWriter).Flush()
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (gw *gzipResponseWriter) Unwrap() http.ResponseWriter {
+	return gw.ResponseWriter
+}
+
+// close finishes the gzip stream, if any, and recycles the compressor
+func (gw *gzipResponseWriter) close() {
+	if gw.gz == nil {
+		return
+	}
+	gw.gz.Close()
+	gzipWriters.Put(gw.gz)
+	gw.gz = nil
+}
+
+// addVary adds field to the Vary header unless it is already listed
+func addVary(h http.Header, field string) {
+	for _, v := range h.Values("Vary") {
+		for _, f := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(f), field) {
+				return
+			}
+		}
+	}
+	h.Add("Vary", field)
+}
+
+// bodyAllowed reports whether a response with the given status has a body
+func bodyAllowed(code int) bool {
+	return code >= 200 && code != http.StatusNoContent && code != http.StatusNotModified
+}
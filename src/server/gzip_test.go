@@ -0,0 +1,126 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"image/color"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+)
+
+// gunzip decompresses data or fails the test
+func gunzip(t *testing.T, data []byte) []byte {
+	t.Helper()
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Failed to open gzip stream: %v", err)
+	}
+	out, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("Failed to decompress: %v", err)
+	}
+	return out
+}
+
+// fetchEncoded requests path with the given Accept-Encoding
+func fetchEncoded(t *testing.T, h http.Handler, method, path, acceptEncoding string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, path, nil)
+	if acceptEncoding != "" {
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 for %s, got %d", path, w.Code)
+	}
+	return w
+}
+
+func TestGzip_CompressibleResponses(t *testing.T) {
+	srv, err := NewWithBaseMap(solidBaseMap(color.RGBA{}), Config{})
+	if err != nil {
+		t.Fatalf("NewWithBaseMap() failed: %v", err)
+	}
+	h := srv.Handler()
+
+	for _, path := range []string{"/", "/tilejson.json", "/tiles.ndjson?max=2"} {
+		t.Run(path, func(t *testing.T) {
+			plain := fetchEncoded(t, h, "GET", path, "")
+			if plain.Header().Get("Content-Encoding") != "" {
+				t.Error("Expected no compression without Accept-Encoding")
+			}
+			if plain.Header().Get("Vary") == "" {
+				t.Error("Expected Vary header on compressible response")
+			}
+
+			gz := fetchEncoded(t, h, "GET", path, "gzip, deflate, br")
+			if gz.Header().Get("Content-Encoding") != "gzip" {
+				t.Fatalf("Expected gzip encoding, got %q", gz.Header().Get("Content-Encoding"))
+			}
+			if gz.Header().Get("Content-Length") != "" {
+				t.Error("Expected Content-Length of the uncompressed body to be dropped")
+			}
+			if !bytes.Equal(gunzip(t, gz.Body.Bytes()), plain.Body.Bytes()) {
+				t.Error("Expected decompressed body to match the uncompressed response")
+			}
+		})
+	}
+}
+
+func TestGzip_SkipsTilesAndHead(t *testing.T) {
+	srv, err := NewWithBaseMap(solidBaseMap(color.RGBA{}), Config{})
+	if err != nil {
+		t.Fatalf("NewWithBaseMap() failed: %v", err)
+	}
+	h := srv.Handler()
+
+	for _, path := range []string{"/0/0/0.png", "/0/0/0.jpg", "/0/0/0.webp"} {
+		if w := fetchEncoded(t, h, "GET", path, "gzip"); w.Header().Get("Content-Encoding") != "" {
+			t.Errorf("Expected tile %s not to be gzipped", path)
+		}
+	}
+	if w := fetchEncoded(t, h, "HEAD", "/", "gzip"); w.Header().Get("Content-Encoding") != "" {
+		t.Error("Expected HEAD response not to be gzipped")
+	}
+	if w := fetchEncoded(t, h, "GET", "/", "gzip;q=0"); w.Header().Get("Content-Encoding") != "" {
+		t.Error("Expected no compression when gzip is refused")
+	}
+}
+
+func TestGzip_PrecompressedAssets(t *testing.T) {
+	srv, err := NewWithBaseMap(solidBaseMap(color.RGBA{}), Config{})
+	if err != nil {
+		t.Fatalf("NewWithBaseMap() failed: %v", err)
+	}
+	script := bytes.Repeat([]byte("L.map('map');\n"), 100)
+	withAssets(t, srv, fstest.MapFS{
+		"leaflet/leaflet.js":             {Data: script},
+		"leaflet/images/marker-icon.png": {Data: []byte("\x89PNG\r\n\x1a\n")},
+	})
+	if _, ok := srv.assets.gz["leaflet/images/marker-icon.png"]; ok {
+		t.Error("Expected images not to be precompressed")
+	}
+
+	w := fetchEncoded(t, srv.Handler(), "GET", "/assets/leaflet/leaflet.js", "gzip")
+	if w.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("Expected gzip encoding, got %q", w.Header().Get("Content-Encoding"))
+	}
+	if !bytes.Equal(w.Body.Bytes(), srv.assets.gz["leaflet/leaflet.js"]) {
+		t.Error("Expected the precompressed copy to be served as is")
+	}
+	if !bytes.Equal(gunzip(t, w.Body.Bytes()), script) {
+		t.Error("Expected decompressed asset to match the original")
+	}
+	if vary := w.Header().Values("Vary"); len(vary) != 1 {
+		t.Errorf("Expected a single Vary header, got %q", vary)
+	}
+
+	plain := fetchEncoded(t, srv.Handler(), "GET", "/assets/leaflet/leaflet.js", "")
+	if plain.Header().Get("Content-Encoding") != "" || !bytes.Equal(plain.Body.Bytes(), script) {
+		t.Error("Expected the uncompressed asset without Accept-Encoding")
+	}
+}
@@ -0,0 +1,245 @@
+package server
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync/atomic"
+
+	"org.xyzmaps.xyztiles/src/imagery"
+	"org.xyzmaps.xyztiles/src/mbtiles"
+	"org.xyzmaps.xyztiles/src/tileprovider"
+)
+
+// PrimaryLayerName is the name of the layer built from Config.ImagePath,
+// Config.EmbeddedData or Config.MBTilesPath
+const PrimaryLayerName = "default"
+
+// ProxyLayerName is the name of the layer serving Config.ProxyURLTemplate
+const ProxyLayerName = "proxy"
+
+// Layer is an additional named base map, served under /{name}/{z}/{x}/{y}
+type Layer struct {
+	Name      string
+	ImagePath string           // Loaded by New with the same options as the primary image, and reloaded by Reload
+	BaseMap   *imagery.BaseMap // Optional: already loaded base map, takes precedence over ImagePath
+
+	// Optional: renders the layer's tiles in place of a base map, leaving
+	// ImagePath and BaseMap unset. The layer is served from Config.MinZoom
+	// to Config.MaxZoom, which must then be set, and has no overview, pixel
+	// queries or uniform tile collapsing.
+	Provider tileprovider.Provider
+
+	// Optional: shown in the viewer's layer switcher, defaulting to Name,
+	// and credited like Config.Attribution
+	Title       string
+	Attribution string
+
+	// Optional: restricts and defaults the layer's tile formats in place of
+	// Config.Formats, e.g. JPEG only for a photographic layer next to a PNG
+	// one that needs transparency. The zero value uses Config.Formats.
+	Formats FormatPolicy
+}
+
+// layer is a base map being served together with its zoom range. The zoom
+// range is fixed when the server is created; Reload only swaps the base map.
+type layer struct {
+	name    string
+	basemap atomic.Pointer[imagery.BaseMap]
+	source  string                 // Image path Reload loads from; empty if not reloadable
+	version atomic.Pointer[string] // Tileset version of the current base map; nil for none
+	minZoom int
+	maxZoom int
+
+	archive *mbtiles.Reader // Archive tiles are served from; nil for a rendered layer
+	format  imagery.Format  // Format of the archive's tiles
+
+	provider tileprovider.Provider // Renders the tiles in place of a base map; nil if the layer has one
+	formats  FormatPolicy          // Normalized formats the layer is served in
+
+	title       string // Display name, never empty
+	attribution string // Sanitized attribution HTML, may be empty
+}
+
+// baseMap returns the base map currently served for the layer
+func (l *layer) baseMap() *imagery.BaseMap {
+	return l.basemap.Load()
+}
+
+// tiles returns the provider rendering the layer's tiles: its own, or its
+// current base map
+func (l *layer) tiles() tileprovider.Provider {
+	if l.provider != nil {
+		return l.provider
+	}
+	return l.baseMap()
+}
+
+// nativeMaxZoom returns the highest zoom the layer has source detail for.
+// A provider is taken to have detail up to the layer's max zoom.
+func (l *layer) nativeMaxZoom() int {
+	if l.archive != nil {
+		_, maxZoom := l.archive.ZoomRange()
+		return maxZoom
+	}
+	if l.provider != nil {
+		return l.maxZoom
+	}
+	return l.baseMap().NativeMaxZoom()
+}
+
+// describe returns a short description of the layer's source for the
+// fallback viewer page
+func (l *layer) describe() string {
+	if l.archive != nil {
+		return "MBTiles archive"
+	}
+	if l.provider != nil {
+		return "Tile provider"
+	}
+	return fmt.Sprintf("Base map: %dx%d pixels", l.baseMap().Width(), l.baseMap().Height())
+}
+
+// tilesetVersion returns the version of the layer's current base map, or ""
+// if it has none
+func (l *layer) tilesetVersion() string {
+	if v := l.version.Load(); v != nil {
+		return *v
+	}
+	return ""
+}
+
+// layerNamePattern restricts layer names to URL-safe identifiers that cannot
+// be mistaken for a zoom level
+var layerNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_-]*$`)
+
+// reservedLayerNames collide with fixed routes
+var reservedLayerNames = map[string]bool{"tile": true, "assets": true, "admin": true, "overlays": true, "v": true}
+
+// buildLayers validates the configured layers and resolves their zoom
+// ranges. The primary base map comes first, followed by cfg.Layers in order.
+// It returns the layers by name, their names in order, and the layer served
+// at bare /{z}/{x}/{y} paths. formats is the normalized Config.Formats.
+func buildLayers(primary *imagery.BaseMap, archive *mbtiles.Reader, format imagery.Format, formats FormatPolicy, cfg Config) (map[string]*layer, []string, *layer, error) {
+	all := append([]Layer{{Name: PrimaryLayerName, BaseMap: primary, Attribution: cfg.Attribution}}, cfg.Layers...)
+
+	layers := make(map[string]*layer, len(all))
+	names := make([]string, 0, len(all))
+	for _, l := range all {
+		if !layerNamePattern.MatchString(l.Name) || reservedLayerNames[l.Name] {
+			return nil, nil, nil, fmt.Errorf("invalid layer name %q: must be lowercase letters, digits, '-' or '_', starting with a letter", l.Name)
+		}
+		if layers[l.Name] != nil {
+			return nil, nil, nil, fmt.Errorf("duplicate layer name %q", l.Name)
+		}
+		if l.Name == PrimaryLayerName && archive != nil {
+			minZoom, maxZoom, err := archiveZoomRange(cfg, archive)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			nl := &layer{name: l.Name, minZoom: minZoom, maxZoom: maxZoom, archive: archive, format: format,
+				formats: formats, title: l.Name, attribution: sanitizeAttribution(l.Attribution)}
+			if cfg.TilesetVersion != "" {
+				nl.version.Store(&cfg.TilesetVersion)
+			}
+			layers[l.Name] = nl
+			names = append(names, l.Name)
+			continue
+		}
+		if l.Provider != nil && (l.BaseMap != nil || l.ImagePath != "") {
+			return nil, nil, nil, fmt.Errorf("layer %q has both a tile provider and a base map", l.Name)
+		}
+		if l.BaseMap == nil && l.Provider == nil {
+			return nil, nil, nil, fmt.Errorf("layer %q has no base map", l.Name)
+		}
+
+		var minZoom, maxZoom int
+		var err error
+		if l.Provider != nil {
+			minZoom, maxZoom, err = providerZoomRange(cfg, l.Name, l.Provider)
+		} else {
+			minZoom, maxZoom, err = zoomRange(cfg, l.BaseMap)
+		}
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		layerFormats := formats
+		if !l.Formats.isZero() {
+			if layerFormats, err = l.Formats.normalize(); err != nil {
+				return nil, nil, nil, fmt.Errorf("layer %q: %w", l.Name, err)
+			}
+		}
+		nl := &layer{name: l.Name, minZoom: minZoom, maxZoom: maxZoom, formats: layerFormats, title: l.Title, attribution: sanitizeAttribution(l.Attribution)}
+		if nl.title == "" {
+			nl.title = l.Name
+		}
+		if l.Provider != nil {
+			nl.provider = l.Provider
+		} else {
+			nl.basemap.Store(l.BaseMap)
+		}
+		if cfg.TilesetVersion != "" {
+			nl.version.Store(&cfg.TilesetVersion)
+		}
+		layers[l.Name] = nl
+		names = append(names, l.Name)
+	}
+
+	name := cfg.DefaultLayer
+	if name == "" {
+		name = PrimaryLayerName
+	}
+	def := layers[name]
+	if def == nil {
+		return nil, nil, nil, fmt.Errorf("default layer %q is not configured", name)
+	}
+	return layers, names, def, nil
+}
+
+// resolveLayer splits an optional layer name off a tile path.
+// /{layer}/{z}/{x}/{y} selects the named layer; any other path is for the
+// default layer. ok is false for a layer-prefixed path naming an unknown layer.
+// A path with a trailing slash is left to parseTilePath to reject.
+func (s *Server) resolveLayer(path string) (l *layer, rest string, ok bool) {
+	trimmed := strings.TrimPrefix(path, "/")
+	if strings.Count(trimmed, "/") != 3 || strings.HasSuffix(trimmed, "/") {
+		return s.defLayer, path, true
+	}
+	name, rest, _ := strings.Cut(trimmed, "/")
+	l = s.layers[name]
+	return l, "/" + rest, l != nil
+}
+
+// isTilePath reports whether path names a tile, with or without a version
+// and layer prefix
+func (s *Server) isTilePath(path string) bool {
+	_, path, _ = splitVersion(path)
+	_, rest, ok := s.resolveLayer(path)
+	if !ok {
+		return false
+	}
+	_, _, _, _, err := parseTilePath(rest)
+	return err == nil
+}
+
+// layerFromQuery returns the layer named by the "layer" query value, or the
+// default layer if it is empty
+func (s *Server) layerFromQuery(name string) (*layer, error) {
+	if name == "" {
+		return s.defLayer, nil
+	}
+	l := s.layers[name]
+	if l == nil {
+		return nil, fmt.Errorf("unknown layer %q", name)
+	}
+	return l, nil
+}
+
+// layerPath returns the URL path prefix of a layer's tiles: "" for the
+// default layer, which is served at bare paths, or "/{name}"
+func (s *Server) layerPath(l *layer) string {
+	if l == s.defLayer {
+		return ""
+	}
+	return "/" + l.name
+}
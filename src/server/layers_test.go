@@ -0,0 +1,317 @@
+package server
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"org.xyzmaps.xyztiles/src/imagery"
+)
+
+// solidBaseMap returns a 1024x512 base map filled with c
+func solidBaseMap(c color.RGBA) *imagery.BaseMap {
+	img := image.NewRGBA(image.Rect(0, 0, 1024, 512))
+	draw.Draw(img, img.Bounds(), &image.Uniform{c}, image.Point{}, draw.Src)
+	return imagery.NewBaseMap(img)
+}
+
+func TestLayers_Routing(t *testing.T) {
+	red := color.RGBA{255, 0, 0, 255}
+	blue := color.RGBA{0, 0, 255, 255}
+
+	tests := []struct {
+		defaultLayer string
+		path         string
+		expectCode   int
+		expectColor  color.RGBA
+		name         string
+	}{
+		{"", "/1/0/0.png", http.StatusOK, red, "bare path serves primary"},
+		{"", "/default/1/0/0.png", http.StatusOK, red, "primary by name"},
+		{"", "/night/1/0/0.png", http.StatusOK, blue, "named layer"},
+		{"", "/tile/night/1/0/0.png", http.StatusOK, blue, "named layer under /tile"},
+		{"night", "/1/0/0.png", http.StatusOK, blue, "configured default layer"},
+		{"", "/unknown/1/0/0.png", http.StatusNotFound, color.RGBA{}, "unknown layer"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, err := NewWithBaseMap(solidBaseMap(red), Config{
+				Layers:        []Layer{{Name: "night", BaseMap: solidBaseMap(blue)}},
+				DefaultLayer:  tt.defaultLayer,
+				CacheMaxBytes: 16 << 20,
+			})
+			if err != nil {
+				t.Fatalf("NewWithBaseMap() failed: %v", err)
+			}
+
+			w := httptest.NewRecorder()
+			srv.Handler().ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+			if w.Code != tt.expectCode {
+				t.Fatalf("Expected status %d, got %d", tt.expectCode, w.Code)
+			}
+			if tt.expectCode != http.StatusOK {
+				return
+			}
+
+			tile, err := png.Decode(w.Body)
+			if err != nil {
+				t.Fatalf("Failed to decode PNG: %v", err)
+			}
+			if got := color.RGBAModel.Convert(tile.At(256, 256)); got != tt.expectColor {
+				t.Errorf("Expected pixel %v, got %v", tt.expectColor, got)
+			}
+		})
+	}
+}
+
+func TestLayers_CacheKeyedPerLayer(t *testing.T) {
+	srv, err := NewWithBaseMap(solidBaseMap(color.RGBA{255, 0, 0, 255}), Config{
+		Layers:        []Layer{{Name: "night", BaseMap: solidBaseMap(color.RGBA{0, 0, 255, 255})}},
+		CacheMaxBytes: 16 << 20,
+	})
+	if err != nil {
+		t.Fatalf("NewWithBaseMap() failed: %v", err)
+	}
+
+	bodies := map[string]string{}
+	for _, path := range []string{"/0/0/0.png", "/night/0/0/0.png"} {
+		w := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		bodies[path] = w.Body.String()
+	}
+
+	if srv.cache.len() != 2 {
+		t.Errorf("Expected 2 cached tiles, got %d", srv.cache.len())
+	}
+	if bodies["/0/0/0.png"] == bodies["/night/0/0/0.png"] {
+		t.Error("Expected layers to serve distinct tiles")
+	}
+}
+
+func TestLayers_Advertised(t *testing.T) {
+	srv, err := NewWithBaseMap(solidBaseMap(color.RGBA{255, 0, 0, 255}), Config{
+		Layers: []Layer{{Name: "night", BaseMap: imagery.NewBaseMap(image.NewRGBA(image.Rect(0, 0, 4096, 2048)))}},
+	})
+	if err != nil {
+		t.Fatalf("NewWithBaseMap() failed: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, httptest.NewRequest("GET", "http://example.com/tilejson.json", nil))
+	var doc tileJSON
+	if err := json.NewDecoder(w.Body).Decode(&doc); err != nil {
+		t.Fatalf("Failed to decode TileJSON: %v", err)
+	}
+	if len(doc.Layers) != 2 || doc.Layers[0].Name != "default" || doc.Layers[1].Name != "night" {
+		t.Fatalf("Expected layers default and night, got %+v", doc.Layers)
+	}
+	if got := doc.Layers[1].Tiles[0]; got != "http://example.com/night/{z}/{x}/{y}.png" {
+		t.Errorf("Unexpected night tile URL %s", got)
+	}
+
+	// Per-layer documents carry the layer's own zoom range
+	w = httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/tilejson.json?layer=night", nil))
+	doc = tileJSON{}
+	if err := json.NewDecoder(w.Body).Decode(&doc); err != nil {
+		t.Fatalf("Failed to decode TileJSON: %v", err)
+	}
+	if doc.MaxZoom != 3+DefaultOverzoomLimit {
+		t.Errorf("Expected night max zoom %d, got %d", 3+DefaultOverzoomLimit, doc.MaxZoom)
+	}
+
+	w = httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/tilejson.json?layer=unknown", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for unknown layer, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if body := w.Body.String(); !strings.Contains(body, `"name":"night","path":"/night"`) {
+		t.Error("Expected viewer to offer the night layer")
+	}
+}
+
+func TestLayers_Invalid(t *testing.T) {
+	bm := solidBaseMap(color.RGBA{255, 0, 0, 255})
+
+	tests := []struct {
+		cfg  Config
+		name string
+	}{
+		{Config{Layers: []Layer{{Name: "Night", BaseMap: bm}}}, "uppercase name"},
+		{Config{Layers: []Layer{{Name: "7", BaseMap: bm}}}, "numeric name"},
+		{Config{Layers: []Layer{{Name: "assets", BaseMap: bm}}}, "reserved name"},
+		{Config{Layers: []Layer{{Name: "default", BaseMap: bm}}}, "duplicates primary"},
+		{Config{Layers: []Layer{{Name: "night"}}}, "no base map"},
+		{Config{MaxZoom: 6, Layers: []Layer{{Name: "night", BaseMap: bm, Provider: &fakeProvider{}}}}, "provider and base map"},
+		{Config{Layers: []Layer{{Name: "night", Provider: &fakeProvider{}}}}, "provider without max zoom"},
+		{Config{DefaultLayer: "night"}, "unknown default layer"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewWithBaseMap(bm, tt.cfg); err == nil {
+				t.Error("Expected error, got nil")
+			}
+		})
+	}
+}
+
+// fakeProvider renders every tile in one color as an NRGBA image, recording
+// the tiles and options it was asked for
+type fakeProvider struct {
+	color color.NRGBA
+
+	mu    sync.Mutex
+	calls []string // z/x/y of each tile rendered
+	opts  []imagery.TileOptions
+}
+
+func (p *fakeProvider) Tile(ctx context.Context, z, x, y int, opts imagery.TileOptions) (image.Image, error) {
+	p.mu.Lock()
+	p.calls = append(p.calls, fmt.Sprintf("%d/%d/%d", z, x, y))
+	p.opts = append(p.opts, opts)
+	p.mu.Unlock()
+
+	size := cmp.Or(opts.Size, imagery.TileSize) + 2*opts.Buffer
+	img := image.NewNRGBA(image.Rect(0, 0, size, size))
+	draw.Draw(img, img.Bounds(), &image.Uniform{p.color}, image.Point{}, draw.Src)
+	return img, nil
+}
+
+func TestLayers_Provider(t *testing.T) {
+	fake := &fakeProvider{color: color.NRGBA{0, 255, 0, 255}}
+	srv, err := NewWithBaseMap(solidBaseMap(color.RGBA{255, 0, 0, 255}), Config{
+		MaxZoom: 6,
+		Layers:  []Layer{{Name: "fake", Provider: fake}},
+	})
+	if err != nil {
+		t.Fatalf("NewWithBaseMap() failed: %v", err)
+	}
+
+	tests := []struct {
+		path       string
+		expectCall string
+		expectSize int
+		name       string
+	}{
+		{"/fake/3/1/2.png", "3/1/2", imagery.TileSize, "tile"},
+		{"/fake/6/63/0.png?size=256", "6/63/0", 256, "other size"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			srv.Handler().ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+			if w.Code != http.StatusOK {
+				t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+			}
+			tile, err := png.Decode(w.Body)
+			if err != nil {
+				t.Fatalf("Failed to decode PNG: %v", err)
+			}
+			if got := tile.Bounds().Dx(); got != tt.expectSize {
+				t.Errorf("Expected a %dpx tile, got %dpx", tt.expectSize, got)
+			}
+			if got := color.RGBAModel.Convert(tile.At(10, 10)); got != (color.RGBA{0, 255, 0, 255}) {
+				t.Errorf("Expected the provider's color, got %v", got)
+			}
+
+			fake.mu.Lock()
+			defer fake.mu.Unlock()
+			last := len(fake.calls) - 1
+			if last < 0 || fake.calls[last] != tt.expectCall || fake.opts[last].Size != tt.expectSize {
+				t.Errorf("Expected the provider asked for %s at %dpx, got calls %v", tt.expectCall, tt.expectSize, fake.calls)
+			}
+		})
+	}
+
+	// The provider's zoom range is the configured one, and the primary
+	// layer is still rendered from its base map
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/fake/7/0/0.png", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 past the max zoom, got %d", w.Code)
+	}
+	w = httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/1/0/0.png", nil))
+	if tile, err := png.Decode(w.Body); err != nil || color.RGBAModel.Convert(tile.At(10, 10)) != (color.RGBA{255, 0, 0, 255}) {
+		t.Errorf("Expected the primary layer rendered from its base map")
+	}
+	if got := len(fake.calls); got != 2 {
+		t.Errorf("Expected the provider called for its own tiles only, got %d calls", got)
+	}
+
+	if result := fetchQuery(t, srv.Handler(), "/query?lon=0&lat=0&layer=fake"); result.Pixel != nil {
+		t.Errorf("Expected no source pixel for a provider layer, got %+v", result.Pixel)
+	}
+}
+
+func TestLayers_Proxy(t *testing.T) {
+	var hits atomic.Int64
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		if r.URL.Path != "/2/1/1.png" {
+			http.NotFound(w, r)
+			return
+		}
+		tile := image.NewRGBA(image.Rect(0, 0, 256, 256))
+		draw.Draw(tile, tile.Bounds(), &image.Uniform{color.RGBA{0, 255, 0, 255}}, image.Point{}, draw.Src)
+		png.Encode(w, tile)
+	}))
+	defer upstream.Close()
+
+	srv, err := NewWithBaseMap(solidBaseMap(color.RGBA{255, 0, 0, 255}), Config{ProxyURLTemplate: upstream.URL + "/{z}/{x}/{y}.png"})
+	if err != nil {
+		t.Fatalf("NewWithBaseMap() failed: %v", err)
+	}
+
+	// Without a tile cache, the second request is served from the proxy's own
+	for range 2 {
+		w := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/proxy/2/1/1.png", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+		}
+		tile, err := png.Decode(w.Body)
+		if err != nil {
+			t.Fatalf("Failed to decode PNG: %v", err)
+		}
+		if got := color.RGBAModel.Convert(tile.At(100, 100)); got != (color.RGBA{0, 255, 0, 255}) {
+			t.Errorf("Expected the upstream tile, got %v", got)
+		}
+	}
+	if n := hits.Load(); n != 1 {
+		t.Errorf("Expected the upstream tile fetched once, got %d requests", n)
+	}
+
+	env := fetchError(t, srv.Handler(), "/proxy/2/0/0.png", http.StatusNotFound)
+	if env.Error.Code != codeTileNotUpstream {
+		t.Errorf("Expected code %s, got %s", codeTileNotUpstream, env.Error.Code)
+	}
+	fetchError(t, srv.Handler(), "/proxy/20/0/0.png", http.StatusNotFound)
+
+	blank, err := NewWithBaseMap(solidBaseMap(color.RGBA{}), Config{ProxyURLTemplate: upstream.URL + "/{z}/{x}/{y}.png", BlankOnNotFound: true})
+	if err != nil {
+		t.Fatalf("NewWithBaseMap() failed: %v", err)
+	}
+	fetchError(t, blank.Handler(), "/proxy/2/0/0.png", http.StatusOK)
+
+	if _, err := NewWithBaseMap(solidBaseMap(color.RGBA{}), Config{ProxyURLTemplate: "https://tile.example.com/{z}/{x}.png"}); err == nil {
+		t.Error("Expected an error for a template without {y}")
+	}
+}
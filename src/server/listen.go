@@ -0,0 +1,270 @@
+package server
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultSocketMode is the permission mode applied to unix domain sockets
+// when Config.SocketMode is not set
+const DefaultSocketMode os.FileMode = 0660
+
+// parseListenAddress splits a listen specification into a network and address.
+// Accepted forms:
+//
+//	unix:/run/xyztiles.sock   unix domain socket
+//	tcp://host:port           TCP address
+//	host:port                 TCP address (scheme optional)
+//	tls://host:port           TCP address serving HTTPS, network "tls"
+func parseListenAddress(spec string) (network, address string, err error) {
+	switch {
+	case strings.HasPrefix(spec, "unix:"):
+		address = strings.TrimPrefix(strings.TrimPrefix(spec, "unix:"), "//")
+		if address == "" {
+			return "", "", fmt.Errorf("unix listen address requires a socket path, got %q", spec)
+		}
+		return "unix", address, nil
+	case strings.HasPrefix(spec, "tcp://"):
+		network, address = "tcp", strings.TrimPrefix(spec, "tcp://")
+	case strings.HasPrefix(spec, "tls://"):
+		network, address = "tls", strings.TrimPrefix(spec, "tls://")
+	case strings.Contains(spec, "://"):
+		return "", "", fmt.Errorf("unsupported listen scheme in %q (expected unix:, tcp:// or tls://)", spec)
+	default:
+		network, address = "tcp", spec
+	}
+
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		return "", "", fmt.Errorf("invalid TCP listen address %q: %w", spec, err)
+	}
+	return network, address, nil
+}
+
+// listenTLSConfig checks cfg's listen addresses and returns the TLS
+// configuration its tls:// listeners serve, or nil if it has none
+func listenTLSConfig(cfg Config) (*tls.Config, error) {
+	secure := false
+	for i, spec := range append([]string{cfg.Listen}, cfg.ExtraListen...) {
+		if spec == "" && i == 0 {
+			continue // Host and Port
+		}
+		network, _, err := parseListenAddress(spec)
+		if err != nil {
+			return nil, err
+		}
+		secure = secure || network == "tls"
+	}
+
+	var tlsCfg *tls.Config
+	switch {
+	case !secure:
+		if cfg.TLSConfig != nil || cfg.TLSCertFile != "" || cfg.TLSKeyFile != "" {
+			return nil, errors.New("TLS certificate configured without a tls:// listen address")
+		}
+		return nil, nil
+	case cfg.TLSConfig != nil:
+		tlsCfg = cfg.TLSConfig.Clone()
+	case cfg.TLSCertFile == "" || cfg.TLSKeyFile == "":
+		return nil, errors.New("tls:// listen addresses need a TLS certificate and key file")
+	default:
+		cert, err := tls.LoadX509KeyPair(cfg.TLSCertFile, cfg.TLSKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load TLS certificate: %w", err)
+		}
+		tlsCfg = &tls.Config{Certificates: []tls.Certificate{cert}}
+	}
+	// Offer HTTP/2, which net/http serves on TLS connections that negotiate it
+	if len(tlsCfg.NextProtos) == 0 {
+		tlsCfg.NextProtos = []string{"h2", "http/1.1"}
+	}
+	return tlsCfg, nil
+}
+
+// tlsListener marks a listener whose connections speak TLS, so it can be
+// told apart from a plain TCP one
+type tlsListener struct {
+	net.Listener
+}
+
+// ServesTLS reports whether ln, as returned by Listen or ListenAll, serves
+// HTTPS
+func ServesTLS(ln net.Listener) bool {
+	_, ok := ln.(*tlsListener)
+	return ok
+}
+
+// listenerURL returns the URL a listener is reached at, http:// or
+// https:// followed by its address, or unix: followed by its path
+func listenerURL(ln net.Listener) string {
+	switch {
+	case ln.Addr().Network() == "unix":
+		return "unix:" + ln.Addr().String()
+	case ServesTLS(ln):
+		return "https://" + ln.Addr().String()
+	default:
+		return "http://" + ln.Addr().String()
+	}
+}
+
+// tcpListenAddress combines a host and port into a TCP listen address.
+// The host may be empty (all interfaces), a hostname, an IPv4 address, or an
+// IPv6 literal with or without brackets. Port 0 selects any free port.
+func tcpListenAddress(host string, port int) (string, error) {
+	if port < 0 || port > 65535 {
+		return "", fmt.Errorf("port must be in range [0, 65535], got %d", port)
+	}
+
+	if strings.HasPrefix(host, "[") {
+		if !strings.HasSuffix(host, "]") {
+			return "", fmt.Errorf("invalid host %q: unterminated IPv6 literal", host)
+		}
+		literal := host[1 : len(host)-1]
+		if ip := net.ParseIP(literal); ip == nil || ip.To4() != nil {
+			return "", fmt.Errorf("invalid host %q: not an IPv6 literal", host)
+		}
+		host = literal
+	} else if host != "" && net.ParseIP(host) == nil && !isValidHostname(host) {
+		return "", fmt.Errorf("invalid host %q: not an IP address or hostname", host)
+	}
+
+	return net.JoinHostPort(host, strconv.Itoa(port)), nil
+}
+
+// tcpNetwork picks the network to listen on address with. Go listens on
+// both IPv4 and IPv6 for "0.0.0.0" and "[::]" alike, so IP literals select
+// their own family ("tcp4" or "tcp6") to let operators bind just one. An
+// empty host or a hostname listens on every family with "tcp".
+func tcpNetwork(address string) string {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return "tcp"
+	}
+	ip := net.ParseIP(host)
+	switch {
+	case ip == nil:
+		return "tcp"
+	case ip.To4() != nil:
+		return "tcp4"
+	default:
+		return "tcp6"
+	}
+}
+
+// listenFDsStart is the first file descriptor passed by socket activation,
+// SD_LISTEN_FDS_START in sd_listen_fds(3)
+var listenFDsStart = 3
+
+// activationFDs returns the number of listening sockets systemd passed to
+// this process through socket activation, or 0 if it passed none
+func activationFDs() int {
+	if pid, err := strconv.Atoi(os.Getenv("LISTEN_PID")); err != nil || pid != os.Getpid() {
+		return 0
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n < 0 {
+		return 0
+	}
+	return n
+}
+
+// SocketActivated reports whether systemd passed listening sockets to the
+// process, in which case Listen serves the first of them instead of the
+// configured address
+func SocketActivated() bool {
+	return activationFDs() > 0
+}
+
+// activatedListener returns a listener for the first socket passed by socket
+// activation. The activation variables are removed from the environment so
+// that child processes do not mistake the sockets for their own.
+func activatedListener() (net.Listener, error) {
+	for _, name := range []string{"LISTEN_PID", "LISTEN_FDS", "LISTEN_FDNAMES"} {
+		os.Unsetenv(name)
+	}
+
+	// FileListener duplicates the descriptor, so the original is closed
+	f := os.NewFile(uintptr(listenFDsStart), "listen-fd")
+	defer f.Close()
+	ln, err := net.FileListener(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to use socket passed by systemd: %w", err)
+	}
+	return ln, nil
+}
+
+// isValidHostname reports whether name is a syntactically valid DNS hostname
+func isValidHostname(name string) bool {
+	name = strings.TrimSuffix(name, ".")
+	if name == "" || len(name) > 253 {
+		return false
+	}
+
+	for _, label := range strings.Split(name, ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, c := range label {
+			isAlnum := (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+			if !isAlnum && c != '-' {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// listenUnix creates a unix domain socket at path with the given permissions.
+// A stale socket file left behind by a previous process is removed, but a
+// socket that still has a live listener is reported as an error.
+func listenUnix(path string, mode os.FileMode) (net.Listener, error) {
+	if err := removeStaleSocket(path); err != nil {
+		return nil, err
+	}
+
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on unix socket %s: %w", path, err)
+	}
+
+	if mode == 0 {
+		mode = DefaultSocketMode
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		ln.Close()
+		return nil, fmt.Errorf("failed to set permissions on unix socket %s: %w", path, err)
+	}
+
+	return ln, nil
+}
+
+// removeStaleSocket removes path if it is a socket nothing is listening on
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to stat unix socket %s: %w", path, err)
+	}
+
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("refusing to replace %s: file exists and is not a socket", path)
+	}
+
+	conn, err := net.DialTimeout("unix", path, time.Second)
+	if err == nil {
+		conn.Close()
+		return fmt.Errorf("unix socket %s is already in use", path)
+	}
+
+	if err := os.Remove(path); err != nil {
+		return fmt.Errorf("failed to remove stale unix socket %s: %w", path, err)
+	}
+	return nil
+}
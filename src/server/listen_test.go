@@ -0,0 +1,633 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"image/color"
+	"image/png"
+	"log/slog"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseListenAddress(t *testing.T) {
+	tests := []struct {
+		spec          string
+		expectNetwork string
+		expectAddress string
+		expectError   bool
+		name          string
+	}{
+		{"unix:/run/xyztiles.sock", "unix", "/run/xyztiles.sock", false, "unix socket"},
+		{"unix:///run/xyztiles.sock", "unix", "/run/xyztiles.sock", false, "unix socket with slashes"},
+		{"tcp://127.0.0.1:8080", "tcp", "127.0.0.1:8080", false, "tcp with scheme"},
+		{"tcp://:8080", "tcp", ":8080", false, "tcp all interfaces"},
+		{"localhost:9000", "tcp", "localhost:9000", false, "bare host:port"},
+		{"tls://:8443", "tls", ":8443", false, "tls all interfaces"},
+
+		// Error cases
+		{"unix:", "", "", true, "unix without path"},
+		{"udp://:8080", "", "", true, "unsupported scheme"},
+		{"tcp://localhost", "", "", true, "missing port"},
+		{"tls://localhost", "", "", true, "tls missing port"},
+		{"nonsense", "", "", true, "no port"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			network, address, err := parseListenAddress(tt.spec)
+
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Expected error for %q, got nil", tt.spec)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if network != tt.expectNetwork || address != tt.expectAddress {
+				t.Errorf("parseListenAddress(%q) = (%s, %s), expected (%s, %s)",
+					tt.spec, network, address, tt.expectNetwork, tt.expectAddress)
+			}
+		})
+	}
+}
+
+func TestTCPListenAddress(t *testing.T) {
+	tests := []struct {
+		host        string
+		port        int
+		expect      string
+		expectError bool
+		name        string
+	}{
+		{"", 8080, ":8080", false, "all interfaces"},
+		{"127.0.0.1", 8080, "127.0.0.1:8080", false, "IPv4 loopback"},
+		{"localhost", 9000, "localhost:9000", false, "hostname"},
+		{"tiles.example.com", 80, "tiles.example.com:80", false, "FQDN"},
+		{"[::1]", 8080, "[::1]:8080", false, "bracketed IPv6"},
+		{"::1", 8080, "[::1]:8080", false, "bare IPv6"},
+		{"127.0.0.1", 0, "127.0.0.1:0", false, "any free port"},
+
+		// Error cases
+		{"[::1", 8080, "", true, "unterminated IPv6"},
+		{"[127.0.0.1]", 8080, "", true, "bracketed IPv4"},
+		{"bad_host!", 8080, "", true, "invalid hostname"},
+		{"-leading.example.com", 8080, "", true, "label starts with hyphen"},
+		{"localhost", -1, "", true, "negative port"},
+		{"localhost", 70000, "", true, "port too large"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr, err := tcpListenAddress(tt.host, tt.port)
+
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Expected error for host %q port %d, got nil", tt.host, tt.port)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if addr != tt.expect {
+				t.Errorf("tcpListenAddress(%q, %d) = %q, expected %q", tt.host, tt.port, addr, tt.expect)
+			}
+		})
+	}
+}
+
+func TestTCPNetwork(t *testing.T) {
+	tests := []struct {
+		address string
+		expect  string
+		name    string
+	}{
+		{":8080", "tcp", "all interfaces"},
+		{"localhost:8080", "tcp", "hostname"},
+		{"0.0.0.0:8080", "tcp4", "IPv4 unspecified"},
+		{"127.0.0.1:8080", "tcp4", "IPv4 loopback"},
+		{"[::]:8080", "tcp6", "IPv6 unspecified"},
+		{"[::1]:8080", "tcp6", "IPv6 loopback"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tcpNetwork(tt.address); got != tt.expect {
+				t.Errorf("tcpNetwork(%q) = %q, expected %q", tt.address, got, tt.expect)
+			}
+		})
+	}
+}
+
+func TestListen_AddressFamily(t *testing.T) {
+	if ln, err := net.Listen("tcp6", "[::1]:0"); err != nil {
+		t.Skipf("IPv6 loopback not available: %v", err)
+	} else {
+		ln.Close()
+	}
+
+	tests := []struct {
+		cfg      Config
+		expectV4 bool // Reachable on 127.0.0.1
+		expectV6 bool // Reachable on [::1]
+		name     string
+	}{
+		{Config{Listen: "[::1]:0"}, false, true, "IPv6 loopback"},
+		{Config{Listen: "tcp://[::]:0"}, false, true, "IPv6 only"},
+		{Config{Listen: "0.0.0.0:0"}, true, false, "IPv4 only"},
+		{Config{Host: "::1"}, false, true, "IPv6 host and port"},
+		{Config{Listen: ":0"}, true, true, "dual stack"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, err := NewWithBaseMap(solidBaseMap(color.RGBA{}), tt.cfg)
+			if err != nil {
+				t.Fatalf("NewWithBaseMap() failed: %v", err)
+			}
+			ln, err := srv.Listen()
+			if err != nil {
+				t.Fatalf("Listen() failed: %v", err)
+			}
+			defer ln.Close()
+			go srv.Serve(ln)
+			defer srv.Shutdown(context.Background())
+
+			port := ln.Addr().(*net.TCPAddr).Port
+			for _, probe := range []struct {
+				host   string
+				expect bool
+			}{{"127.0.0.1", tt.expectV4}, {"::1", tt.expectV6}} {
+				url := fmt.Sprintf("http://%s/0/0/0.png", net.JoinHostPort(probe.host, strconv.Itoa(port)))
+				resp, err := http.Get(url)
+				if err == nil {
+					resp.Body.Close()
+				}
+				if reached := err == nil && resp.StatusCode == http.StatusOK; reached != probe.expect {
+					t.Errorf("Expected %s reachable: %v, got error %v", probe.host, probe.expect, err)
+				}
+			}
+		})
+	}
+}
+
+func TestNew_InvalidHost(t *testing.T) {
+	cfg := Config{
+		Host:      "not a host",
+		Port:      8080,
+		ImagePath: createTestJPEG(t),
+	}
+
+	_, err := New(cfg)
+	if err == nil {
+		t.Error("Expected error for invalid host, got nil")
+	}
+}
+
+func TestServe_LocalhostAnyPort(t *testing.T) {
+	// Capture the startup log to verify the actual bound address is reported
+	var logBuf syncBuffer
+	srv, err := New(Config{
+		Host:      "127.0.0.1",
+		Port:      0,
+		ImagePath: createTestJPEG(t),
+		Logger:    slog.New(slog.NewTextHandler(&logBuf, nil)),
+	})
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+
+	ln, err := srv.Listen()
+	if err != nil {
+		t.Fatalf("Listen() failed: %v", err)
+	}
+
+	addr := ln.Addr().(*net.TCPAddr)
+	if !addr.IP.IsLoopback() {
+		t.Errorf("Expected loopback address, got %s", addr.IP)
+	}
+	if addr.Port == 0 {
+		t.Error("Expected a concrete port to be assigned for port 0")
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- srv.Serve(ln)
+	}()
+
+	resp, err := http.Get(fmt.Sprintf("http://%s/0/0/0.png", addr))
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", resp.StatusCode)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown() failed: %v", err)
+	}
+	if err := <-errCh; err != nil {
+		t.Errorf("Serve() returned error after shutdown: %v", err)
+	}
+
+	if !strings.Contains(logBuf.String(), addr.String()) {
+		t.Errorf("Expected startup log to contain bound address %s, got:\n%s", addr, logBuf.String())
+	}
+}
+
+// writeTestCert writes a self-signed certificate for 127.0.0.1 and its key
+// as PEM files, returning their paths and a pool trusting the certificate
+func writeTestCert(t *testing.T) (certFile, keyFile string, pool *x509.CertPool) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "xyztiles test"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("Failed to marshal key: %v", err)
+	}
+
+	dir := t.TempDir()
+	certFile, keyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	if err := os.WriteFile(certFile, certPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	pool = x509.NewCertPool()
+	pool.AppendCertsFromPEM(certPEM)
+	return certFile, keyFile, pool
+}
+
+func TestServe_HTTPAndHTTPS(t *testing.T) {
+	certFile, keyFile, pool := writeTestCert(t)
+	var logBuf syncBuffer
+	srv, err := New(Config{
+		Host:           "127.0.0.1",
+		ExtraListen:    []string{"tls://127.0.0.1:0"},
+		TLSCertFile:    certFile,
+		TLSKeyFile:     keyFile,
+		MaxConnections: 4,
+		ImagePath:      createTestJPEG(t),
+		Logger:         slog.New(slog.NewTextHandler(&logBuf, nil)),
+	})
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+
+	lns, err := srv.ListenAll()
+	if err != nil {
+		t.Fatalf("ListenAll() failed: %v", err)
+	}
+	if len(lns) != 2 || ServesTLS(lns[0]) || !ServesTLS(lns[1]) {
+		t.Fatalf("Expected a plain and a TLS listener, got %d", len(lns))
+	}
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- srv.StartListeners(lns)
+	}()
+
+	tlsClient := &http.Client{Transport: &http.Transport{
+		TLSClientConfig:   &tls.Config{RootCAs: pool},
+		ForceAttemptHTTP2: true,
+	}}
+	tests := []struct {
+		client      *http.Client
+		url         string
+		expectProto int
+		name        string
+	}{
+		{http.DefaultClient, "http://" + lns[0].Addr().String() + "/0/0/0.png", 1, "http"},
+		{tlsClient, "https://" + lns[1].Addr().String() + "/0/0/0.png", 2, "https"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := tt.client.Get(tt.url)
+			if err != nil {
+				t.Fatalf("GET failed: %v", err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+			}
+			if _, err := png.Decode(resp.Body); err != nil {
+				t.Errorf("Failed to decode PNG: %v", err)
+			}
+			if resp.ProtoMajor != tt.expectProto {
+				t.Errorf("Expected HTTP/%d, got %s", tt.expectProto, resp.Proto)
+			}
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown() failed: %v", err)
+	}
+	if err := <-errCh; err != nil {
+		t.Errorf("StartListeners() returned error after shutdown: %v", err)
+	}
+
+	// The startup log names every endpoint
+	for _, url := range []string{"http://" + lns[0].Addr().String(), "https://" + lns[1].Addr().String()} {
+		if !strings.Contains(logBuf.String(), "addr="+url) {
+			t.Errorf("Expected startup log to contain %s, got:\n%s", url, logBuf.String())
+		}
+	}
+}
+
+func TestServe_ListenerFailureStopsAll(t *testing.T) {
+	srv, err := New(Config{
+		Host:        "127.0.0.1",
+		ExtraListen: []string{"127.0.0.1:0"},
+		ImagePath:   createTestJPEG(t),
+	})
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+	lns, err := srv.ListenAll()
+	if err != nil {
+		t.Fatalf("ListenAll() failed: %v", err)
+	}
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- srv.StartListeners(lns)
+	}()
+	resp, err := http.Get("http://" + lns[0].Addr().String() + "/0/0/0.png")
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	resp.Body.Close()
+
+	// Closing one listener from under the server fails it
+	lns[1].Close()
+	select {
+	case err := <-errCh:
+		if err == nil {
+			t.Error("Expected the listener's failure to be returned")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the server to stop when a listener failed")
+	}
+	if conn, err := net.DialTimeout("tcp", lns[0].Addr().String(), time.Second); err == nil {
+		conn.Close()
+		t.Error("Expected the other listener closed too")
+	}
+}
+
+func TestNew_ListenTLS(t *testing.T) {
+	certFile, keyFile, _ := writeTestCert(t)
+	tests := []struct {
+		cfg       Config
+		expectErr bool
+		name      string
+	}{
+		{Config{Listen: "tls://:8443", TLSCertFile: certFile, TLSKeyFile: keyFile}, false, "certificate files"},
+		{Config{ExtraListen: []string{"tls://:8443"}, TLSConfig: &tls.Config{}}, false, "TLS config"},
+		{Config{Listen: "tls://:8443"}, true, "no certificate"},
+		{Config{Listen: "tls://:8443", TLSCertFile: certFile}, true, "no key"},
+		{Config{Listen: "tls://:8443", TLSCertFile: keyFile, TLSKeyFile: certFile}, true, "swapped files"},
+		{Config{TLSCertFile: certFile, TLSKeyFile: keyFile}, true, "certificate without a tls listener"},
+		{Config{ExtraListen: []string{"udp://:8080"}}, true, "invalid extra address"},
+		{Config{ExtraListen: []string{""}}, true, "empty extra address"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.ImagePath = createTestJPEG(t)
+			_, err := New(tt.cfg)
+			if (err != nil) != tt.expectErr {
+				t.Errorf("Expected error: %v, got %v", tt.expectErr, err)
+			}
+		})
+	}
+}
+
+func TestSocketActivated(t *testing.T) {
+	tests := []struct {
+		pid    string
+		fds    string
+		expect bool
+		name   string
+	}{
+		{strconv.Itoa(os.Getpid()), "1", true, "one socket"},
+		{strconv.Itoa(os.Getpid()), "2", true, "two sockets"},
+		{strconv.Itoa(os.Getpid()), "0", false, "no sockets"},
+		{strconv.Itoa(os.Getpid() + 1), "1", false, "another process"},
+		{"", "1", false, "no pid"},
+		{strconv.Itoa(os.Getpid()), "x", false, "invalid count"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("LISTEN_PID", tt.pid)
+			t.Setenv("LISTEN_FDS", tt.fds)
+			if got := SocketActivated(); got != tt.expect {
+				t.Errorf("SocketActivated() = %v, expected %v", got, tt.expect)
+			}
+		})
+	}
+}
+
+func TestNew_InvalidListenAddress(t *testing.T) {
+	cfg := Config{
+		Listen:    "udp://:8080",
+		ImagePath: createTestJPEG(t),
+	}
+
+	_, err := New(cfg)
+	if err == nil {
+		t.Error("Expected error for unsupported listen scheme, got nil")
+	}
+}
+
+func TestServe_UnixSocket(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "xyztiles.sock")
+
+	srv, err := New(Config{
+		Listen:     "unix:" + socketPath,
+		SocketMode: 0600,
+		ImagePath:  createTestJPEG(t),
+	})
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+
+	ln, err := srv.Listen()
+	if err != nil {
+		t.Fatalf("Listen() failed: %v", err)
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- srv.Serve(ln)
+	}()
+
+	// Check socket permissions
+	info, err := os.Stat(socketPath)
+	if err != nil {
+		t.Fatalf("Socket file not created: %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("Expected socket permissions 0600, got %o", perm)
+	}
+
+	// Fetch a tile over the socket
+	client := unixSocketClient(socketPath)
+	resp, err := client.Get("http://xyztiles/0/0/0.png")
+	if err != nil {
+		t.Fatalf("GET over unix socket failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+	}
+	if _, err := png.Decode(resp.Body); err != nil {
+		t.Fatalf("Failed to decode PNG: %v", err)
+	}
+
+	// Graceful shutdown removes the socket file
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown() failed: %v", err)
+	}
+	if err := <-errCh; err != nil {
+		t.Errorf("Serve() returned error after shutdown: %v", err)
+	}
+	if _, err := os.Stat(socketPath); !os.IsNotExist(err) {
+		t.Errorf("Expected socket file to be removed after shutdown, stat err: %v", err)
+	}
+}
+
+func TestListenUnix_RemovesStaleSocket(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "stale.sock")
+
+	// Create a socket file with nothing listening on it
+	ln, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatalf("Failed to create socket: %v", err)
+	}
+	ln.(*net.UnixListener).SetUnlinkOnClose(false)
+	ln.Close()
+
+	if _, err := os.Stat(socketPath); err != nil {
+		t.Fatalf("Expected stale socket file to exist: %v", err)
+	}
+
+	ln, err = listenUnix(socketPath, 0)
+	if err != nil {
+		t.Fatalf("listenUnix() should replace a stale socket, got: %v", err)
+	}
+	defer ln.Close()
+
+	info, err := os.Stat(socketPath)
+	if err != nil {
+		t.Fatalf("Socket file not created: %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != DefaultSocketMode {
+		t.Errorf("Expected default socket permissions %o, got %o", DefaultSocketMode, perm)
+	}
+}
+
+func TestListenUnix_SocketInUse(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "busy.sock")
+
+	ln, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatalf("Failed to create socket: %v", err)
+	}
+	defer ln.Close()
+
+	if _, err := listenUnix(socketPath, 0); err == nil {
+		t.Error("Expected error when socket is in use, got nil")
+	}
+}
+
+func TestListenUnix_RegularFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "not-a-socket")
+	if err := os.WriteFile(path, []byte("data"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+
+	if _, err := listenUnix(path, 0); err == nil {
+		t.Error("Expected error when path is a regular file, got nil")
+	}
+}
+
+// syncBuffer is a bytes.Buffer safe for concurrent writes and reads
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// unixSocketClient returns an HTTP client that dials the given unix socket
+func unixSocketClient(socketPath string) *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", socketPath)
+			},
+		},
+		Timeout: 10 * time.Second,
+	}
+}
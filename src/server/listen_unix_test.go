@@ -0,0 +1,92 @@
+//go:build unix
+
+package server
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestListen_SocketActivation(t *testing.T) {
+	// Stand in for systemd: open the socket and pass its descriptor on
+	inherited, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	rc, err := inherited.(*net.TCPListener).SyscallConn()
+	if err != nil {
+		t.Fatalf("Failed to get the listener's descriptor: %v", err)
+	}
+	fd := -1
+	rc.Control(func(s uintptr) { fd, err = syscall.Dup(int(s)) })
+	if err != nil {
+		t.Fatalf("Failed to duplicate the listener's descriptor: %v", err)
+	}
+	addr := inherited.Addr().String()
+	inherited.Close() // The duplicate keeps the socket open
+
+	start := listenFDsStart
+	listenFDsStart = fd
+	t.Cleanup(func() { listenFDsStart = start })
+	t.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+	t.Setenv("LISTEN_FDS", "1")
+	if !SocketActivated() {
+		t.Fatal("Expected SocketActivated() to report the passed socket")
+	}
+
+	var logBuf syncBuffer
+	srv, err := New(Config{
+		Host:      "127.0.0.1",
+		Port:      1, // Ignored in favour of the passed socket
+		ImagePath: createTestJPEG(t),
+		Logger:    slog.New(slog.NewTextHandler(&logBuf, nil)),
+	})
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+
+	ln, err := srv.Listen()
+	if err != nil {
+		t.Fatalf("Listen() failed: %v", err)
+	}
+	if ln.Addr().String() != addr {
+		t.Errorf("Expected the passed socket's address %s, got %s", addr, ln.Addr())
+	}
+	if os.Getenv("LISTEN_FDS") != "" || os.Getenv("LISTEN_PID") != "" {
+		t.Error("Expected the activation variables to be removed from the environment")
+	}
+	if !strings.Contains(logBuf.String(), "socket activation") {
+		t.Errorf("Expected socket activation to be logged, got:\n%s", logBuf.String())
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- srv.Serve(ln)
+	}()
+
+	resp, err := http.Get("http://" + addr + "/0/0/0.png")
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", resp.StatusCode)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown() failed: %v", err)
+	}
+	if err := <-errCh; err != nil {
+		t.Errorf("Serve() returned error after shutdown: %v", err)
+	}
+}
@@ -0,0 +1,169 @@
+package server
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"org.xyzmaps.xyztiles/src/imagery"
+)
+
+// negotiationOrder lists the formats the server can produce, most preferred first
+var negotiationOrder = []imagery.Format{imagery.FormatWebP, imagery.FormatPNG, imagery.FormatJPEG}
+
+// FormatPolicy restricts which tile formats are served
+type FormatPolicy struct {
+	// Default is served when Accept negotiation finds no acceptable format,
+	// and advertised in the viewer and TileJSON. Defaults to PNG if allowed,
+	// otherwise the first allowed format. Formats here and in Allowed may be
+	// given as any file extension imagery.FormatFromExtension accepts.
+	Default imagery.Format
+
+	// Allowed lists the formats that may be served. Empty allows all.
+	Allowed []imagery.Format
+
+	// Transcode serves the Default format when a request names a format that
+	// is not allowed. Otherwise such requests get 406 Not Acceptable.
+	Transcode bool
+}
+
+// normalize validates p, replacing each format by its canonical name (so
+// "jpg", ".PNG" and "png" all name the same format), and fills in its
+// default format
+func (p FormatPolicy) normalize() (FormatPolicy, error) {
+	allowed := make([]imagery.Format, len(p.Allowed))
+	for i, f := range p.Allowed {
+		format, err := imagery.FormatFromExtension(string(f))
+		if err != nil {
+			return p, fmt.Errorf("invalid format policy: %w", err)
+		}
+		allowed[i] = format
+	}
+	if len(allowed) > 0 {
+		p.Allowed = allowed
+	}
+
+	if p.Default != "" {
+		format, err := imagery.FormatFromExtension(string(p.Default))
+		if err != nil {
+			return p, fmt.Errorf("invalid format policy: default: %w", err)
+		}
+		p.Default = format
+	} else {
+		p.Default = imagery.FormatPNG
+		if !p.allows(p.Default) {
+			p.Default = p.Allowed[0]
+		}
+	}
+	if !p.allows(p.Default) {
+		return p, fmt.Errorf("invalid format policy: default format %s is not allowed", p.Default)
+	}
+	return p, nil
+}
+
+// isZero reports whether p is the zero value, which leaves the formats to
+// the server-wide policy when set on a Layer
+func (p FormatPolicy) isZero() bool {
+	return p.Default == "" && len(p.Allowed) == 0 && !p.Transcode
+}
+
+// allows reports whether the policy permits serving format f
+func (p FormatPolicy) allows(f imagery.Format) bool {
+	return len(p.Allowed) == 0 || slices.Contains(p.Allowed, f)
+}
+
+// negotiate picks an allowed tile format from an Accept header.
+// Formats are ranked by the client's q-value, with ties broken by
+// negotiationOrder. WebP is only chosen when the client names it explicitly,
+// since wildcard Accept headers don't guarantee WebP decoding support.
+// The default format is returned when nothing acceptable is found.
+func (p FormatPolicy) negotiate(accept string) imagery.Format {
+	if strings.TrimSpace(accept) == "" {
+		return p.Default
+	}
+
+	ranges := parseAccept(accept)
+
+	best := p.Default
+	bestQ := 0.0
+	for _, f := range negotiationOrder {
+		if !p.allows(f) {
+			continue
+		}
+		q := acceptQuality(ranges, f)
+		if q > bestQ {
+			best, bestQ = f, q
+		}
+	}
+
+	return best
+}
+
+// negotiateFormat picks a tile format from an Accept header with no format
+// restrictions, falling back to PNG
+func negotiateFormat(accept string) imagery.Format {
+	return FormatPolicy{Default: imagery.FormatPNG}.negotiate(accept)
+}
+
+// acceptRange is one media range from an Accept header
+type acceptRange struct {
+	mediaType string
+	q         float64
+}
+
+// parseAccept parses an Accept header into media ranges with q-values
+func parseAccept(accept string) []acceptRange {
+	var ranges []acceptRange
+	for _, part := range strings.Split(accept, ",") {
+		params := strings.Split(part, ";")
+		mediaType := strings.ToLower(strings.TrimSpace(params[0]))
+		if mediaType == "" {
+			continue
+		}
+
+		q := 1.0
+		for _, param := range params[1:] {
+			key, value, ok := strings.Cut(strings.TrimSpace(param), "=")
+			if ok && strings.EqualFold(strings.TrimSpace(key), "q") {
+				if parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+
+		ranges = append(ranges, acceptRange{mediaType: mediaType, q: q})
+	}
+	return ranges
+}
+
+// acceptQuality returns the q-value the client assigns to format f.
+// The most specific matching range wins, as per RFC 9110.
+func acceptQuality(ranges []acceptRange, f imagery.Format) float64 {
+	contentType := f.ContentType()
+	exact, typeWildcard, anyWildcard := -1.0, -1.0, -1.0
+
+	for _, r := range ranges {
+		switch r.mediaType {
+		case contentType:
+			exact = r.q
+		case "image/*":
+			typeWildcard = r.q
+		case "*/*":
+			anyWildcard = r.q
+		}
+	}
+
+	switch {
+	case exact >= 0:
+		return exact
+	case f == imagery.FormatWebP:
+		return 0
+	case typeWildcard >= 0:
+		return typeWildcard
+	case anyWildcard >= 0:
+		return anyWildcard
+	default:
+		return 0
+	}
+}
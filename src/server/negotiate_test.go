@@ -0,0 +1,301 @@
+package server
+
+import (
+	"bytes"
+	"image/color"
+	"image/jpeg"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"golang.org/x/image/webp"
+	"org.xyzmaps.xyztiles/src/imagery"
+)
+
+func TestNegotiateFormat(t *testing.T) {
+	tests := []struct {
+		accept string
+		expect imagery.Format
+		name   string
+	}{
+		{"", imagery.FormatPNG, "no Accept header"},
+		{"*/*", imagery.FormatPNG, "any type"},
+		{"image/webp", imagery.FormatWebP, "webp only"},
+		{"image/png", imagery.FormatPNG, "png only"},
+		{"image/jpeg", imagery.FormatJPEG, "jpeg only"},
+		{"image/avif,image/webp,image/apng,image/*,*/*;q=0.8", imagery.FormatWebP, "browser image accept"},
+		{"image/webp;q=0.5, image/png", imagery.FormatPNG, "png preferred by q-value"},
+		{"image/webp;q=0, image/*", imagery.FormatPNG, "webp refused"},
+		{"image/jpeg, image/png;q=0.9", imagery.FormatJPEG, "jpeg preferred by q-value"},
+		{"image/png, image/jpeg", imagery.FormatPNG, "tie broken by server preference"},
+		{"text/html", imagery.FormatPNG, "nothing acceptable falls back to png"},
+		{"IMAGE/WEBP", imagery.FormatWebP, "case-insensitive"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := negotiateFormat(tt.accept); got != tt.expect {
+				t.Errorf("negotiateFormat(%q) = %s, expected %s", tt.accept, got, tt.expect)
+			}
+		})
+	}
+}
+
+func TestHandleTileRequest_AcceptNegotiation(t *testing.T) {
+	srv := createTestServer(t)
+
+	tests := []struct {
+		path       string
+		accept     string
+		expectType string
+		expectVary bool
+		name       string
+	}{
+		{"/0/0/0", "image/webp", "image/webp", true, "extensionless webp"},
+		{"/0/0/0", "image/png", "image/png", true, "extensionless png"},
+		{"/0/0/0", "", "image/png", true, "extensionless default"},
+		{"/0/0/0.png", "image/webp", "image/png", false, "explicit png wins over Accept"},
+		{"/0/0/0.jpg", "image/webp", "image/jpeg", false, "explicit jpg wins over Accept"},
+		{"/tile/0/0/0", "image/webp", "image/webp", true, "/tile/ prefix"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.path, nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			w := httptest.NewRecorder()
+
+			srv.Handler().ServeHTTP(w, req)
+
+			resp := w.Result()
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+			}
+
+			if ct := resp.Header.Get("Content-Type"); ct != tt.expectType {
+				t.Errorf("Expected Content-Type %s, got %s", tt.expectType, ct)
+			}
+
+			hasVary := resp.Header.Get("Vary") == "Accept"
+			if hasVary != tt.expectVary {
+				t.Errorf("Expected Vary: Accept = %v, got header %q", tt.expectVary, resp.Header.Get("Vary"))
+			}
+
+			// Verify the body decodes in the advertised format
+			var decodeErr error
+			switch tt.expectType {
+			case "image/webp":
+				_, decodeErr = webp.Decode(resp.Body)
+			case "image/jpeg":
+				_, decodeErr = jpeg.Decode(resp.Body)
+			}
+			if decodeErr != nil {
+				t.Errorf("Failed to decode %s body: %v", tt.expectType, decodeErr)
+			}
+		})
+	}
+}
+
+func TestHandleTileRequest_AcceptNegotiationCache(t *testing.T) {
+	srv, err := NewWithBaseMap(solidBaseMap(color.RGBA{0, 0, 255, 255}), Config{CacheMaxBytes: 16 << 20, TilesetVersion: "v1"})
+	if err != nil {
+		t.Fatalf("NewWithBaseMap() failed: %v", err)
+	}
+
+	get := func(accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/1/0/0", nil)
+		req.Header.Set("Accept", accept)
+		w := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(w, req)
+		return w
+	}
+
+	// A WebP client first must not leave its tile in the cache for others
+	webpTile := get("image/webp,*/*;q=0.8")
+	pngTile := get("image/png,*/*;q=0.8")
+	if ct := pngTile.Header().Get("Content-Type"); ct != "image/png" {
+		t.Fatalf("Expected a PNG client to get image/png, got %s", ct)
+	}
+	if stats := srv.cache.stats(); stats.Hits != 0 || stats.Misses != 2 {
+		t.Errorf("Expected each negotiated format to miss the cache, got %d hits and %d misses", stats.Hits, stats.Misses)
+	}
+	if webpTile.Header().Get("ETag") == pngTile.Header().Get("ETag") {
+		t.Errorf("Expected negotiated formats to have distinct ETags, got %s for both", pngTile.Header().Get("ETag"))
+	}
+
+	// The same client again is served from the cache
+	if again := get("image/webp"); !bytes.Equal(again.Body.Bytes(), webpTile.Body.Bytes()) || srv.cache.stats().Hits != 1 {
+		t.Error("Expected the cached WebP tile to be served to a WebP client")
+	}
+}
+
+func TestFormatPolicy_Normalize(t *testing.T) {
+	tests := []struct {
+		policy        FormatPolicy
+		expectDefault imagery.Format
+		expectAllowed []imagery.Format
+		expectError   bool
+		name          string
+	}{
+		{FormatPolicy{}, imagery.FormatPNG, nil, false, "zero value defaults to PNG"},
+		{FormatPolicy{Allowed: []imagery.Format{imagery.FormatJPEG, imagery.FormatWebP}}, imagery.FormatJPEG, []imagery.Format{imagery.FormatJPEG, imagery.FormatWebP}, false, "first allowed when PNG is not"},
+		{FormatPolicy{Default: imagery.FormatWebP}, imagery.FormatWebP, nil, false, "explicit default"},
+		{FormatPolicy{Default: imagery.FormatPNG, Allowed: []imagery.Format{imagery.FormatJPEG}}, "", nil, true, "default not allowed"},
+		{FormatPolicy{Allowed: []imagery.Format{"gif"}}, "", nil, true, "unknown format"},
+		{FormatPolicy{Allowed: []imagery.Format{"jpg"}}, imagery.FormatJPEG, []imagery.Format{imagery.FormatJPEG}, false, "alias"},
+		{FormatPolicy{Allowed: []imagery.Format{"PNG", "WebP"}}, imagery.FormatPNG, []imagery.Format{imagery.FormatPNG, imagery.FormatWebP}, false, "upper case"},
+		{FormatPolicy{Allowed: []imagery.Format{".png", ".JPEG"}}, imagery.FormatPNG, []imagery.Format{imagery.FormatPNG, imagery.FormatJPEG}, false, "leading dot"},
+		{FormatPolicy{Default: "JPG", Allowed: []imagery.Format{"jpeg"}}, imagery.FormatJPEG, []imagery.Format{imagery.FormatJPEG}, false, "default alias"},
+		{FormatPolicy{Default: ".webp"}, imagery.FormatWebP, nil, false, "default leading dot"},
+		{FormatPolicy{Default: "gif"}, "", nil, true, "unknown default"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.policy.normalize()
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Expected error, got default %s", got.Default)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("normalize() failed: %v", err)
+			}
+			if got.Default != tt.expectDefault {
+				t.Errorf("Expected default %s, got %s", tt.expectDefault, got.Default)
+			}
+			if !slices.Equal(got.Allowed, tt.expectAllowed) {
+				t.Errorf("Expected allowed %v, got %v", tt.expectAllowed, got.Allowed)
+			}
+		})
+	}
+}
+
+func TestHandleTileRequest_FormatPolicies(t *testing.T) {
+	// A photographic layer served only as JPEG, rejecting other formats, next
+	// to a layer that needs transparency, transcoding other requests to PNG
+	srv, err := New(Config{
+		ImagePath: createTestJPEG(t),
+		Formats:   FormatPolicy{Allowed: []imagery.Format{imagery.FormatJPEG}},
+		Layers: []Layer{{
+			Name:    "labels",
+			BaseMap: solidBaseMap(color.RGBA{0, 0, 0, 0}),
+			Formats: FormatPolicy{
+				Default:   imagery.FormatPNG,
+				Allowed:   []imagery.Format{imagery.FormatPNG, imagery.FormatWebP},
+				Transcode: true,
+			},
+		}},
+	})
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+
+	tests := []struct {
+		path       string
+		accept     string
+		expectCode int
+		expectType string
+		name       string
+	}{
+		{"/0/0/0.jpg", "", http.StatusOK, "image/jpeg", "satellite allowed extension"},
+		{"/0/0/0.png", "", http.StatusNotAcceptable, "", "satellite disallowed extension"},
+		{"/0/0/0", "image/webp,image/png", http.StatusOK, "image/jpeg", "satellite negotiation falls back to default"},
+		{"/labels/0/0/0.png", "", http.StatusOK, "image/png", "labels allowed extension"},
+		{"/labels/0/0/0.jpg", "", http.StatusOK, "image/png", "labels transcodes disallowed extension"},
+		{"/labels/0/0/0", "image/webp", http.StatusOK, "image/webp", "labels negotiates allowed format"},
+		{"/labels/0/0/0", "image/jpeg", http.StatusOK, "image/png", "labels negotiation skips disallowed format"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.path, nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			w := httptest.NewRecorder()
+			srv.Handler().ServeHTTP(w, req)
+
+			if w.Code != tt.expectCode {
+				t.Fatalf("Expected status %d, got %d", tt.expectCode, w.Code)
+			}
+			if tt.expectType != "" && w.Header().Get("Content-Type") != tt.expectType {
+				t.Errorf("Expected Content-Type %s, got %s", tt.expectType, w.Header().Get("Content-Type"))
+			}
+		})
+	}
+
+	// TileJSON and the viewer advertise each layer's default format
+	for _, tt := range []struct{ path, tiles string }{
+		{"/tilejson.json", `"http://example.com/{z}/{x}/{y}.jpg"`},
+		{"/tilejson.json?layer=labels", `"http://example.com/labels/{z}/{x}/{y}.png"`},
+	} {
+		w := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(w, httptest.NewRequest("GET", "http://example.com"+tt.path, nil))
+		if !strings.Contains(w.Body.String(), `"tiles":[`+tt.tiles+`]`) {
+			t.Errorf("Expected %s to advertise %s, got %s", tt.path, tt.tiles, w.Body.String())
+		}
+	}
+
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	body := w.Body.String()
+	if !strings.Contains(body, `const tileExtension = ".jpg";`) {
+		t.Error("Expected viewer to request .jpg tiles of the default layer")
+	}
+	if !strings.Contains(body, `"url":"/labels/{z}/{x}/{y}.png"`) {
+		t.Error("Expected viewer to request .png tiles of the labels layer")
+	}
+
+	// A layer's policy is validated like the server's
+	_, err = New(Config{
+		ImagePath: createTestJPEG(t),
+		Layers:    []Layer{{Name: "labels", BaseMap: solidBaseMap(color.RGBA{}), Formats: FormatPolicy{Allowed: []imagery.Format{"tiff"}}}},
+	})
+	if err == nil || !strings.Contains(err.Error(), `layer "labels"`) {
+		t.Errorf("Expected an invalid layer format policy to be rejected, got %v", err)
+	}
+	_, err = New(Config{ImagePath: createTestJPEG(t), Formats: FormatPolicy{Default: "gif"}})
+	if err == nil {
+		t.Error("Expected an unknown default format to be rejected")
+	}
+}
+
+func TestHandleTileRequest_FormatPolicyAliases(t *testing.T) {
+	srv, err := New(Config{ImagePath: createTestJPEG(t), Formats: FormatPolicy{Allowed: []imagery.Format{"jpg", ".WEBP"}}})
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+
+	tests := []struct {
+		path       string
+		expectCode int
+		expectType string
+		name       string
+	}{
+		{"/0/0/0.jpg", http.StatusOK, "image/jpeg", "alias extension"},
+		{"/0/0/0.jpeg", http.StatusOK, "image/jpeg", "canonical extension"},
+		{"/0/0/0.webp", http.StatusOK, "image/webp", "upper case with dot"},
+		{"/0/0/0.png", http.StatusNotAcceptable, "", "disallowed extension"},
+		{"/0/0/0", http.StatusOK, "image/jpeg", "no extension"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			srv.Handler().ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+
+			if w.Code != tt.expectCode {
+				t.Fatalf("Expected status %d, got %d", tt.expectCode, w.Code)
+			}
+			if tt.expectType != "" && w.Header().Get("Content-Type") != tt.expectType {
+				t.Errorf("Expected Content-Type %s, got %s", tt.expectType, w.Header().Get("Content-Type"))
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// DefaultMaxOverlayBytes bounds the size of a GeoJSON overlay when
+// Config.MaxOverlayBytes is not set. Overlays are held in memory and every
+// viewer downloads them in full.
+const DefaultMaxOverlayBytes = 16 << 20
+
+// Overlay is a GeoJSON file served at /overlays/{name}.json and drawn on
+// top of the tiles by the viewer
+type Overlay struct {
+	Name string
+	Path string // Read by New
+	Data []byte // Optional: GeoJSON document, takes precedence over Path
+}
+
+// overlay is a validated GeoJSON overlay held in memory
+type overlay struct {
+	name string
+	data []byte
+}
+
+// geoJSONTypes are the valid top-level "type" members of a GeoJSON document
+var geoJSONTypes = map[string]bool{
+	"FeatureCollection": true, "Feature": true, "GeometryCollection": true,
+	"Point": true, "MultiPoint": true, "LineString": true, "MultiLineString": true,
+	"Polygon": true, "MultiPolygon": true,
+}
+
+// loadOverlays reads and validates the configured overlays, in order
+func loadOverlays(overlays []Overlay, maxBytes int64) ([]overlay, error) {
+	if maxBytes == 0 {
+		maxBytes = DefaultMaxOverlayBytes
+	}
+
+	var out []overlay
+	seen := make(map[string]bool)
+	for _, o := range overlays {
+		if !layerNamePattern.MatchString(o.Name) {
+			return nil, fmt.Errorf("invalid overlay name %q: must be lowercase letters, digits, '-' or '_', starting with a letter", o.Name)
+		}
+		if seen[o.Name] {
+			return nil, fmt.Errorf("duplicate overlay name %q", o.Name)
+		}
+		seen[o.Name] = true
+
+		data := o.Data
+		if data == nil {
+			var err error
+			if data, err = readOverlayFile(o.Path, maxBytes); err != nil {
+				return nil, fmt.Errorf("overlay %q: %w", o.Name, err)
+			}
+		} else if int64(len(data)) > maxBytes {
+			return nil, fmt.Errorf("overlay %q is %d bytes, more than the limit of %d", o.Name, len(data), maxBytes)
+		}
+		if err := validateGeoJSON(data); err != nil {
+			return nil, fmt.Errorf("overlay %q: %w", o.Name, err)
+		}
+		out = append(out, overlay{name: o.Name, data: data})
+	}
+	return out, nil
+}
+
+// readOverlayFile reads path, refusing files larger than maxBytes
+func readOverlayFile(path string, maxBytes int64) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(io.LimitReader(f, maxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > maxBytes {
+		return nil, fmt.Errorf("%s is larger than the limit of %d bytes", path, maxBytes)
+	}
+	return data, nil
+}
+
+// validateGeoJSON checks that data is a JSON object with a GeoJSON type.
+// Geometries are not checked further; Leaflet skips ones it cannot draw.
+func validateGeoJSON(data []byte) error {
+	var doc struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("invalid GeoJSON: %w", err)
+	}
+	if !geoJSONTypes[doc.Type] {
+		return fmt.Errorf("invalid GeoJSON: unknown type %q", doc.Type)
+	}
+	return nil
+}
+
+// handleOverlay serves the overlay named by a /overlays/{name}.json path
+func (s *Server) handleOverlay(w http.ResponseWriter, r *http.Request) {
+	name, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/overlays/"), ".json")
+	if ok {
+		for _, o := range s.overlays {
+			if o.name == name {
+				w.Header().Set("Content-Type", "application/geo+json")
+				w.Header().Set("Cache-Control", "public, max-age=3600")
+				w.Header().Set("Content-Length", strconv.Itoa(len(o.data)))
+				w.Write(o.data)
+				return
+			}
+		}
+	}
+	writeError(w, r, newAPIError(http.StatusNotFound, codeNotFound, "Overlay not found"))
+}
@@ -0,0 +1,120 @@
+package server
+
+import (
+	"bytes"
+	"image/color"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testGeoJSON is a small FeatureCollection with one point
+const testGeoJSON = `{"type":"FeatureCollection","features":[{"type":"Feature","geometry":{"type":"Point","coordinates":[2.35,48.86]},"properties":{"name":"Paris"}}]}`
+
+// writeOverlay writes data to a file in a temporary directory and returns its path
+func writeOverlay(t *testing.T, name, data string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatalf("Failed to write overlay: %v", err)
+	}
+	return path
+}
+
+func TestHandleOverlay(t *testing.T) {
+	path := writeOverlay(t, "cities.geojson", testGeoJSON)
+	srv, err := NewWithBaseMap(solidBaseMap(color.RGBA{}), Config{
+		BasePath: "/maps",
+		Overlays: []Overlay{{Name: "cities", Path: path}, {Name: "route", Data: []byte(`{"type":"LineString","coordinates":[[0,0],[1,1]]}`)}},
+	})
+	if err != nil {
+		t.Fatalf("NewWithBaseMap() failed: %v", err)
+	}
+
+	tests := []struct {
+		path         string
+		expectStatus int
+		expectBody   string
+		name         string
+	}{
+		{"/maps/overlays/cities.json", http.StatusOK, testGeoJSON, "from file"},
+		{"/maps/overlays/route.json", http.StatusOK, `{"type":"LineString","coordinates":[[0,0],[1,1]]}`, "from data"},
+		{"/maps/overlays/missing.json", http.StatusNotFound, "", "unknown overlay"},
+		{"/maps/overlays/cities", http.StatusNotFound, "", "missing extension"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			srv.Handler().ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+			if w.Code != tt.expectStatus {
+				t.Fatalf("Expected status %d, got %d", tt.expectStatus, w.Code)
+			}
+			if tt.expectStatus != http.StatusOK {
+				return
+			}
+			if ct := w.Header().Get("Content-Type"); ct != "application/geo+json" {
+				t.Errorf("Expected Content-Type application/geo+json, got %q", ct)
+			}
+			if !bytes.Equal(w.Body.Bytes(), []byte(tt.expectBody)) {
+				t.Errorf("Expected the exact file, got %q", w.Body.String())
+			}
+		})
+	}
+
+	body := fetchViewer(t, srv, "/maps/", http.StatusOK)
+	for _, want := range []string{`"url":"/maps/overlays/cities.json"`, `"url":"/maps/overlays/route.json"`, "L.control.layers("} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected viewer to contain %q", want)
+		}
+	}
+}
+
+func TestHandleOverlay_NoneConfigured(t *testing.T) {
+	srv, err := NewWithBaseMap(solidBaseMap(color.RGBA{}), Config{})
+	if err != nil {
+		t.Fatalf("NewWithBaseMap() failed: %v", err)
+	}
+	if env := fetchError(t, srv.Handler(), "/overlays/cities.json", http.StatusNotFound); env.Error.Code != codeNotFound {
+		t.Errorf("Expected code %q, got %q", codeNotFound, env.Error.Code)
+	}
+	if body := fetchViewer(t, srv, "/", http.StatusOK); strings.Contains(body, "L.control.layers(") {
+		t.Error("Expected no layer control without overlays or extra layers")
+	}
+}
+
+func TestLoadOverlays_Validation(t *testing.T) {
+	tests := []struct {
+		overlays    []Overlay
+		maxBytes    int64
+		expectError string
+		name        string
+	}{
+		{[]Overlay{{Name: "cities", Data: []byte(testGeoJSON)}}, 0, "", "valid"},
+		{[]Overlay{{Name: "cities", Data: []byte(testGeoJSON)}}, 16, "more than the limit", "data too large"},
+		{[]Overlay{{Name: "cities", Path: writeOverlay(t, "big.json", testGeoJSON)}}, 16, "larger than the limit", "file too large"},
+		{[]Overlay{{Name: "cities", Path: filepath.Join(t.TempDir(), "missing.json")}}, 0, "no such file", "missing file"},
+		{[]Overlay{{Name: "cities", Data: []byte(`{"type":`)}}, 0, "invalid GeoJSON", "malformed JSON"},
+		{[]Overlay{{Name: "cities", Data: []byte(`{"type":"Topology"}`)}}, 0, "unknown type", "not GeoJSON"},
+		{[]Overlay{{Name: "Cities", Data: []byte(testGeoJSON)}}, 0, "invalid overlay name", "invalid name"},
+		{[]Overlay{{Name: "a", Data: []byte(testGeoJSON)}, {Name: "a", Data: []byte(testGeoJSON)}}, 0, "duplicate overlay", "duplicate name"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := loadOverlays(tt.overlays, tt.maxBytes)
+			if tt.expectError == "" {
+				if err != nil {
+					t.Errorf("Unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.expectError) {
+				t.Errorf("Expected error containing %q, got %v", tt.expectError, err)
+			}
+		})
+	}
+}
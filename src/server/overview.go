@@ -0,0 +1,72 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"net/http"
+	"strconv"
+
+	"org.xyzmaps.xyztiles/src/imagery"
+)
+
+// overviewPath is where the overview is served, below any base path
+const overviewPath = "/overview.png"
+
+// handleOverview serves the default layer's whole world as a single
+// equirectangular PNG of Config.OverviewSize, for embedding where an
+// interactive map is too heavy. It takes a render slot and is bounded by
+// the render timeout like a tile.
+func (s *Server) handleOverview(w http.ResponseWriter, r *http.Request) {
+	l := s.defLayer
+	if l.archive != nil {
+		writeError(w, r, newAPIError(http.StatusNotFound, codeNotFound,
+			fmt.Sprintf("No overview: layer %q is served from an archive", l.name)))
+		return
+	}
+	if l.provider != nil {
+		writeError(w, r, newAPIError(http.StatusNotFound, codeNotFound,
+			fmt.Sprintf("No overview: layer %q is served by a tile provider", l.name)))
+		return
+	}
+
+	if err := s.renders.acquire(r.Context()); err != nil {
+		if errors.Is(err, errRenderBusy) {
+			w.Header().Set("Retry-After", "1")
+			writeError(w, r, newAPIError(http.StatusServiceUnavailable, codeServerBusy, "Server busy, try again later"))
+		}
+		return
+	}
+	img, err := func() (*image.RGBA, error) {
+		defer s.renders.release()
+		ctx, cancel := context.WithTimeout(r.Context(), s.renderMax)
+		defer cancel()
+		return l.baseMap().ExtractOverview(ctx, s.overview.X, s.overview.Y, s.background)
+	}()
+	switch {
+	case err == nil:
+	case r.Context().Err() != nil:
+		return
+	case errors.Is(err, context.DeadlineExceeded):
+		w.Header().Set("Retry-After", "1")
+		writeError(w, r, newAPIError(http.StatusServiceUnavailable, codeRenderTimeout, "Overview render timed out, try again later"))
+		return
+	default:
+		s.logger.Error("Error rendering overview", "request_id", requestID(r.Context()), "err", err)
+		writeError(w, r, newAPIError(http.StatusInternalServerError, codeRenderFailed, "Failed to render overview"))
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := s.encode(&buf, img, imagery.FormatPNG); err != nil {
+		s.logger.Error("Error encoding overview", "request_id", requestID(r.Context()), "err", err)
+		writeError(w, r, newAPIError(http.StatusInternalServerError, codeRenderFailed, "Failed to encode overview"))
+		return
+	}
+	w.Header().Set("Content-Type", imagery.FormatPNG.ContentType())
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	w.Write(buf.Bytes())
+}
@@ -0,0 +1,57 @@
+package server
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHandleOverview(t *testing.T) {
+	srv, err := NewWithBaseMap(solidBaseMap(color.RGBA{0, 128, 0, 255}), Config{OverviewSize: image.Pt(1024, 512)})
+	if err != nil {
+		t.Fatalf("NewWithBaseMap() failed: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/overview.png", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "image/png" {
+		t.Errorf("Expected Content-Type image/png, got %s", ct)
+	}
+	img, err := png.Decode(w.Body)
+	if err != nil {
+		t.Fatalf("Failed to decode overview: %v", err)
+	}
+	if got := img.Bounds(); got != image.Rect(0, 0, 1024, 512) {
+		t.Errorf("Expected a 1024x512 overview, got %v", got)
+	}
+	if c := color.RGBAModel.Convert(img.At(512, 256)).(color.RGBA); c != (color.RGBA{0, 128, 0, 255}) {
+		t.Errorf("Expected the base map's color, got %v", c)
+	}
+}
+
+func TestHandleOverview_NotConfigured(t *testing.T) {
+	srv, err := NewWithBaseMap(solidBaseMap(color.RGBA{}), Config{})
+	if err != nil {
+		t.Fatalf("NewWithBaseMap() failed: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/overview.png", nil))
+	if w.Code == http.StatusOK {
+		t.Error("Expected no overview without OverviewSize")
+	}
+}
+
+func TestNew_InvalidOverviewSize(t *testing.T) {
+	for _, size := range []image.Point{{1024, 0}, {-1, 512}, {100000, 512}} {
+		if _, err := NewWithBaseMap(solidBaseMap(color.RGBA{}), Config{OverviewSize: size}); err == nil {
+			t.Errorf("Expected error for overview size %v", size)
+		}
+	}
+}
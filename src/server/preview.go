@@ -0,0 +1,141 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strconv"
+)
+
+// maxPreviewZoom caps the zoom of the tile grid preview: zoom 5 already
+// lays out 1024 tiles
+const maxPreviewZoom = 5
+
+// previewTemplate lays out every tile of one zoom in its grid, edge to
+// edge so seams show, with each tile's z/x/y over its corner
+var previewTemplate = template.Must(template.New("preview").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="utf-8">
+    <title>xyztiles - {{.Layer}} tiles at zoom {{.Zoom}}</title>
+    <style>
+        body { font-family: sans-serif; margin: 16px; background: #333; color: #eee; }
+        a { color: #8cf; }
+        nav { margin-bottom: 12px; }
+        nav strong { margin-right: 4px; }
+        .grid { display: grid; grid-template-columns: repeat({{.Size}}, {{.CellSize}}px); width: max-content; }
+        .tile { position: relative; width: {{.CellSize}}px; height: {{.CellSize}}px; margin: 0; background: #222; }
+        .tile img { display: block; width: 100%; height: 100%; }
+        .tile figcaption { position: absolute; top: 0; left: 0; padding: 1px 3px; font: 10px monospace; background: rgba(0, 0, 0, 0.6); }
+    </style>
+</head>
+<body>
+    <nav>
+        <strong>Zoom:</strong>{{range .Zooms}} {{if eq . $.Zoom}}{{.}}{{else}}<a href="?z={{.}}{{if $.LayerParam}}&amp;layer={{$.LayerParam}}{{end}}">{{.}}</a>{{end}}{{end}}
+{{- if gt (len .Layers) 1}}
+        | <strong>Layer:</strong>{{range .Layers}} {{if eq . $.Layer}}{{.}}{{else}}<a href="?z={{$.Zoom}}&amp;layer={{.}}">{{.}}</a>{{end}}{{end}}
+{{- end}}
+        | <a href="{{.BasePath}}/">Viewer</a>
+    </nav>
+    <div class="grid">
+{{- range .Tiles}}
+        <figure class="tile">{{if .URL}}<img src="{{.URL}}" alt="{{.Caption}}" loading="lazy">{{end}}<figcaption>{{.Caption}}</figcaption></figure>
+{{- end}}
+    </div>
+</body>
+</html>
+`))
+
+// previewData holds the values injected into previewTemplate
+type previewData struct {
+	BasePath   string
+	Layer      string   // Name of the previewed layer
+	LayerParam string   // The layer query value to keep in zoom links; "" for the default layer
+	Layers     []string // Every served layer, the default first
+	Zoom       int
+	Zooms      []int // Zooms that can be previewed
+	Size       int   // Tiles per row and column
+	CellSize   int   // CSS pixels per tile
+	Tiles      []previewTile
+}
+
+// previewTile is one cell of the preview grid, in row-major order
+type previewTile struct {
+	URL     string // Empty for tiles outside the configured bounds
+	Caption string // z/x/y
+}
+
+// handlePreview serves an HTML page showing every tile of one zoom laid out
+// in its grid, for checking a basemap for seams and orientation problems.
+// The z query parameter picks the zoom, at most maxPreviewZoom, and the
+// layer parameter a layer other than the default. Like the viewer, it is
+// turned off by DisableViewer.
+func (s *Server) handlePreview(w http.ResponseWriter, r *http.Request) {
+	if s.noViewer {
+		writeError(w, r, newAPIError(http.StatusNotFound, codeNotFound, "404 page not found"))
+		return
+	}
+	q := r.URL.Query()
+	l, err := s.layerFromQuery(q.Get("layer"))
+	if err != nil {
+		writeError(w, r, newAPIError(http.StatusNotFound, codeUnknownLayer, err.Error()))
+		return
+	}
+
+	maxZoom := min(l.maxZoom, maxPreviewZoom)
+	if l.minZoom > maxZoom {
+		writeError(w, r, newAPIError(http.StatusNotFound, codeNotFound,
+			fmt.Sprintf("No zoom to preview: layer %q starts at zoom %d, above the preview limit %d", l.name, l.minZoom, maxPreviewZoom)))
+		return
+	}
+	z := l.minZoom
+	if v := q.Get("z"); v != "" {
+		if z, err = strconv.Atoi(v); err != nil || z < l.minZoom || z > maxZoom {
+			writeError(w, r, newAPIError(http.StatusBadRequest, codeInvalidRequest,
+				fmt.Sprintf("Invalid zoom %q (expected a zoom from %d to %d)", v, l.minZoom, maxZoom)))
+			return
+		}
+	}
+
+	n := 1 << uint(z)
+	data := previewData{
+		BasePath: s.basePath,
+		Layer:    l.name,
+		Zoom:     z,
+		Size:     n,
+		CellSize: max(512>>uint(z), 64),
+	}
+	if l != s.defLayer {
+		data.LayerParam = l.name
+	}
+	data.Layers = append(data.Layers, s.defLayer.name)
+	for _, name := range s.layerNames {
+		if name != s.defLayer.name {
+			data.Layers = append(data.Layers, name)
+		}
+	}
+	for zoom := l.minZoom; zoom <= maxZoom; zoom++ {
+		data.Zooms = append(data.Zooms, zoom)
+	}
+	prefix := s.basePath + s.tilePrefix(l)
+	ext := l.formats.Default.Extension()
+	for y := range n {
+		for x := range n {
+			tile := previewTile{Caption: fmt.Sprintf("%d/%d/%d", z, x, y)}
+			if s.tileInBounds(z, x, y) {
+				tile.URL = fmt.Sprintf("%s/%d/%d/%d%s", prefix, z, x, y, ext)
+			}
+			data.Tiles = append(data.Tiles, tile)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := previewTemplate.Execute(&buf, data); err != nil {
+		s.logger.Error("Error rendering preview", "request_id", requestID(r.Context()), "err", err)
+		writeError(w, r, newAPIError(http.StatusInternalServerError, codeInternal, "Failed to render preview"))
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(buf.Bytes())
+}
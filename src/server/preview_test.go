@@ -0,0 +1,120 @@
+package server
+
+import (
+	"image/color"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+
+	"org.xyzmaps.xyztiles/src/imagery"
+	"org.xyzmaps.xyztiles/src/tilemath"
+)
+
+// previewImage matches the tile image URLs in the preview page
+var previewImage = regexp.MustCompile(`<img src="([^"]+)"`)
+
+func TestHandlePreview(t *testing.T) {
+	night := Layer{Name: "night", BaseMap: solidBaseMap(color.RGBA{})}
+
+	tests := []struct {
+		cfg        Config
+		path       string
+		expectURLs []string
+		name       string
+	}{
+		{
+			Config{}, "/preview?z=1",
+			[]string{"/1/0/0.png", "/1/1/0.png", "/1/0/1.png", "/1/1/1.png"},
+			"zoom 1",
+		},
+		{Config{}, "/preview", []string{"/0/0/0.png"}, "defaults to the min zoom"},
+		{
+			Config{BasePath: "/maps", Layers: []Layer{night}}, "/maps/preview?z=1&layer=night",
+			[]string{"/maps/night/1/0/0.png", "/maps/night/1/1/0.png", "/maps/night/1/0/1.png", "/maps/night/1/1/1.png"},
+			"base path and layer",
+		},
+		{
+			Config{Formats: FormatPolicy{Default: imagery.FormatJPEG}}, "/preview?z=1",
+			[]string{"/1/0/0.jpg", "/1/1/0.jpg", "/1/0/1.jpg", "/1/1/1.jpg"},
+			"default format",
+		},
+		{
+			// Only the north-east quarter is served
+			Config{Bounds: &tilemath.Bounds{West: 10, South: 10, East: 170, North: 80}}, "/preview?z=1",
+			[]string{"/1/1/0.png"},
+			"outside bounds",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, err := NewWithBaseMap(solidBaseMap(color.RGBA{}), tt.cfg)
+			if err != nil {
+				t.Fatalf("NewWithBaseMap() failed: %v", err)
+			}
+
+			body := fetchViewer(t, srv, tt.path, http.StatusOK)
+			var urls []string
+			for _, m := range previewImage.FindAllStringSubmatch(body, -1) {
+				urls = append(urls, m[1])
+			}
+			if !slices.Equal(urls, tt.expectURLs) {
+				t.Errorf("Expected tile images %v, got %v", tt.expectURLs, urls)
+			}
+		})
+	}
+}
+
+func TestHandlePreview_Captions(t *testing.T) {
+	srv, err := NewWithBaseMap(solidBaseMap(color.RGBA{}), Config{})
+	if err != nil {
+		t.Fatalf("NewWithBaseMap() failed: %v", err)
+	}
+	body := fetchViewer(t, srv, "/preview?z=2", http.StatusOK)
+	if n := strings.Count(body, "<figcaption>"); n != 16 {
+		t.Errorf("Expected 16 captioned tiles at zoom 2, got %d", n)
+	}
+	if !strings.Contains(body, "<figcaption>2/3/1</figcaption>") {
+		t.Error("Expected a z/x/y caption for tile 2/3/1")
+	}
+}
+
+func TestHandlePreview_Invalid(t *testing.T) {
+	tests := []struct {
+		cfg          Config
+		path         string
+		expectStatus int
+		name         string
+	}{
+		{Config{}, "/preview?z=6", http.StatusBadRequest, "above the preview limit"},
+		{Config{}, "/preview?z=-1", http.StatusBadRequest, "negative"},
+		{Config{}, "/preview?z=one", http.StatusBadRequest, "not a number"},
+		{Config{MaxZoom: 2}, "/preview?z=3", http.StatusBadRequest, "above the served zooms"},
+		{Config{MinZoom: 2}, "/preview?z=1", http.StatusBadRequest, "below the served zooms"},
+		{Config{MinZoom: 6, MaxZoom: 8}, "/preview", http.StatusNotFound, "nothing to preview"},
+		{Config{}, "/preview?layer=night", http.StatusNotFound, "unknown layer"},
+		{Config{DisableViewer: true}, "/preview", http.StatusNotFound, "viewer disabled"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, err := NewWithBaseMap(solidBaseMap(color.RGBA{}), tt.cfg)
+			if err != nil {
+				t.Fatalf("NewWithBaseMap() failed: %v", err)
+			}
+			fetchViewer(t, srv, tt.path, tt.expectStatus)
+		})
+	}
+}
+
+func TestHandleViewer_PreviewLink(t *testing.T) {
+	srv, err := NewWithBaseMap(solidBaseMap(color.RGBA{}), Config{BasePath: "/maps"})
+	if err != nil {
+		t.Fatalf("NewWithBaseMap() failed: %v", err)
+	}
+	if body := fetchViewer(t, srv, "/maps/", http.StatusOK); !strings.Contains(body, `href="/maps/preview"`) {
+		t.Error("Expected the viewer to link to /maps/preview")
+	}
+}
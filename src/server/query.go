@@ -0,0 +1,104 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+
+	"org.xyzmaps.xyztiles/src/tilemath"
+)
+
+// queryResult is the /query response describing what lies at a coordinate
+type queryResult struct {
+	Lon        float64        `json:"lon"`
+	Lat        float64        `json:"lat"`
+	ClampedLat float64        `json:"clamped_lat"` // Lat within the Web Mercator limits tiles are found at
+	Layer      string         `json:"layer"`
+	Pixel      *queryPixel    `json:"pixel,omitempty"` // Absent outside the image or without a base map
+	Tile       *coverageEntry `json:"tile,omitempty"`  // Present when the z query parameter is given
+}
+
+// queryPixel is the source image pixel a coordinate maps to
+type queryPixel struct {
+	X    int      `json:"x"`
+	Y    int      `json:"y"`
+	RGBA [4]uint8 `json:"rgba"` // Not premultiplied
+}
+
+// queryPath is where point queries are served, below any base path
+const queryPath = "/query"
+
+// handleQuery serves JSON describing the point given by the lon and lat
+// query parameters: the source pixel it maps to and that pixel's color, and
+// with z the tile containing it at that zoom and the tile's bounds. For
+// debugging georeferencing. The layer parameter selects a layer other than
+// the default. Points outside Config.Bounds get 404, like the tiles there.
+func (s *Server) handleQuery(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	l, err := s.layerFromQuery(q.Get("layer"))
+	if err != nil {
+		writeError(w, r, newAPIError(http.StatusNotFound, codeUnknownLayer, err.Error()))
+		return
+	}
+	lon, err := parseCoordinate(q.Get("lon"), "lon", 180)
+	if err != nil {
+		writeError(w, r, newAPIError(http.StatusBadRequest, codeInvalidRequest, err.Error()))
+		return
+	}
+	lat, err := parseCoordinate(q.Get("lat"), "lat", 90)
+	if err != nil {
+		writeError(w, r, newAPIError(http.StatusBadRequest, codeInvalidRequest, err.Error()))
+		return
+	}
+	if s.bounds != nil && !s.bounds.Contains(tilemath.LonLat{Lon: lon, Lat: lat}) {
+		writeError(w, r, newAPIError(http.StatusNotFound, codePointOutsideBounds, "Point outside served bounds"))
+		return
+	}
+	result := queryResult{
+		Lon:        lon,
+		Lat:        lat,
+		ClampedLat: math.Max(-tilemath.MaxLatitude, math.Min(lat, tilemath.MaxLatitude)),
+		Layer:      l.name,
+	}
+
+	if v := q.Get("z"); v != "" {
+		z, err := strconv.Atoi(v)
+		if err != nil || z < 0 || z > tilemath.MaxZoom {
+			writeError(w, r, newAPIError(http.StatusBadRequest, codeInvalidRequest,
+				fmt.Sprintf("Invalid zoom %q (expected a zoom from 0 to %d)", v, tilemath.MaxZoom)))
+			return
+		}
+		// The coordinates are already validated, so this cannot fail
+		tc, _ := tilemath.LonLatToTile(lon, result.ClampedLat, z)
+		b, _ := tc.Bounds()
+		result.Tile = &coverageEntry{Z: tc.Z, X: tc.X, Y: tc.Y, Bounds: [4]float64{b.West, b.South, b.East, b.North}}
+	}
+
+	if bm := l.baseMap(); bm != nil {
+		if p, ok := bm.SourcePixel(lon, lat); ok {
+			c := bm.PixelColor(p)
+			result.Pixel = &queryPixel{X: p.X, Y: p.Y, RGBA: [4]uint8{c.R, c.G, c.B, c.A}}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		s.logger.Error("Error encoding query result", "request_id", requestID(r.Context()), "err", err)
+	}
+}
+
+// parseCoordinate parses the query value v of the coordinate name, which
+// must lie within ±limit degrees
+func parseCoordinate(v, name string, limit float64) (float64, error) {
+	if v == "" {
+		return 0, fmt.Errorf("missing %s", name)
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil || math.IsNaN(f) || f < -limit || f > limit {
+		return 0, fmt.Errorf("invalid %s %q (expected degrees from %g to %g)", name, v, -limit, limit)
+	}
+	return f, nil
+}
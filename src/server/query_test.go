@@ -0,0 +1,135 @@
+package server
+
+import (
+	"encoding/json"
+	"image"
+	"image/color"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"org.xyzmaps.xyztiles/src/imagery"
+	"org.xyzmaps.xyztiles/src/tilemath"
+)
+
+// newGradientServer returns a server over a 360x180 base map, one pixel per
+// degree, whose red channel is the column and green channel the row
+func newGradientServer(t *testing.T) *Server {
+	t.Helper()
+
+	img := image.NewNRGBA(image.Rect(0, 0, 360, 180))
+	for y := range 180 {
+		for x := range 360 {
+			img.SetNRGBA(x, y, color.NRGBA{uint8(x), uint8(y), 0, 255})
+		}
+	}
+	srv, err := NewWithBaseMap(imagery.NewBaseMap(img), Config{})
+	if err != nil {
+		t.Fatalf("NewWithBaseMap() failed: %v", err)
+	}
+	return srv
+}
+
+// fetchQuery requests path and decodes the queryResult
+func fetchQuery(t *testing.T, h http.Handler, path string) queryResult {
+	t.Helper()
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 for %s, got %d: %s", path, w.Code, w.Body.String())
+	}
+	var result queryResult
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+		t.Fatalf("Failed to decode query result: %v", err)
+	}
+	return result
+}
+
+func TestHandleQuery(t *testing.T) {
+	srv := newGradientServer(t)
+
+	result := fetchQuery(t, srv.Handler(), "/query?lon=2.35&lat=48.86&z=10")
+	if result.Lon != 2.35 || result.Lat != 48.86 || result.ClampedLat != 48.86 || result.Layer != "default" {
+		t.Errorf("Expected the coordinates echoed for the default layer, got %+v", result)
+	}
+	if result.Pixel == nil || result.Pixel.X != 182 || result.Pixel.Y != 41 {
+		t.Fatalf("Expected pixel (182,41), got %+v", result.Pixel)
+	}
+	if result.Pixel.RGBA != [4]uint8{182, 41, 0, 255} {
+		t.Errorf("Expected the gradient's color at (182,41), got %v", result.Pixel.RGBA)
+	}
+
+	expected, _ := tilemath.LonLatToTile(2.35, 48.86, 10)
+	if result.Tile == nil || result.Tile.Z != 10 || result.Tile.X != expected.X || result.Tile.Y != expected.Y {
+		t.Fatalf("Expected tile %v, got %+v", expected, result.Tile)
+	}
+	if b := result.Tile.Bounds; b[0] > 2.35 || b[2] < 2.35 || b[1] > 48.86 || b[3] < 48.86 {
+		t.Errorf("Expected the tile's bounds %v to contain the point", b)
+	}
+}
+
+func TestHandleQuery_Clamped(t *testing.T) {
+	srv := newGradientServer(t)
+
+	result := fetchQuery(t, srv.Handler(), "/query?lon=-180&lat=89.5&z=2")
+	if result.ClampedLat != tilemath.MaxLatitude {
+		t.Errorf("Expected latitude clamped to %g, got %g", tilemath.MaxLatitude, result.ClampedLat)
+	}
+	if result.Tile == nil || result.Tile.X != 0 || result.Tile.Y != 0 {
+		t.Errorf("Expected the north west tile, got %+v", result.Tile)
+	}
+	if result.Pixel == nil || result.Pixel.X != 0 || result.Pixel.Y != 0 {
+		t.Errorf("Expected the source's first pixel beyond the tile grid, got %+v", result.Pixel)
+	}
+
+	if result := fetchQuery(t, srv.Handler(), "/query?lon=0&lat=0"); result.Tile != nil {
+		t.Errorf("Expected no tile without z, got %+v", result.Tile)
+	}
+}
+
+func TestHandleQuery_Invalid(t *testing.T) {
+	srv := newGradientServer(t)
+
+	tests := []struct {
+		path         string
+		expectStatus int
+		expectCode   string
+		name         string
+	}{
+		{"/query?lat=0", http.StatusBadRequest, codeInvalidRequest, "missing lon"},
+		{"/query?lon=0", http.StatusBadRequest, codeInvalidRequest, "missing lat"},
+		{"/query?lon=180.5&lat=0", http.StatusBadRequest, codeInvalidRequest, "lon out of range"},
+		{"/query?lon=0&lat=-91", http.StatusBadRequest, codeInvalidRequest, "lat out of range"},
+		{"/query?lon=NaN&lat=0", http.StatusBadRequest, codeInvalidRequest, "not a number"},
+		{"/query?lon=0&lat=abc", http.StatusBadRequest, codeInvalidRequest, "not numeric"},
+		{"/query?lon=0&lat=0&z=31", http.StatusBadRequest, codeInvalidRequest, "zoom too high"},
+		{"/query?lon=0&lat=0&layer=nope", http.StatusNotFound, codeUnknownLayer, "unknown layer"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := fetchError(t, srv.Handler(), tt.path, tt.expectStatus)
+			if env.Error.Code != tt.expectCode {
+				t.Errorf("Expected code %q, got %q", tt.expectCode, env.Error.Code)
+			}
+		})
+	}
+}
+
+func TestHandleQuery_Bounds(t *testing.T) {
+	srv, err := NewWithBaseMap(solidBaseMap(color.RGBA{0, 128, 0, 255}), Config{
+		Bounds: &tilemath.Bounds{West: -10, South: 35, East: 30, North: 70},
+	})
+	if err != nil {
+		t.Fatalf("NewWithBaseMap() failed: %v", err)
+	}
+
+	if result := fetchQuery(t, srv.Handler(), "/query?lon=2.35&lat=48.86"); result.Pixel == nil {
+		t.Errorf("Expected a pixel inside the bounds, got %+v", result)
+	}
+	env := fetchError(t, srv.Handler(), "/query?lon=151.2&lat=-33.9", http.StatusNotFound)
+	if env.Error.Code != codePointOutsideBounds {
+		t.Errorf("Expected code %q outside the bounds, got %q", codePointOutsideBounds, env.Error.Code)
+	}
+}
@@ -0,0 +1,112 @@
+package server
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// rateLimiter is a per-key token bucket limiter. Each key refills at rate
+// tokens per second up to burst tokens. Buckets left idle long enough to
+// refill completely are dropped, since a fresh bucket behaves identically.
+type rateLimiter struct {
+	mu        sync.Mutex
+	rate      float64
+	burst     float64
+	idle      time.Duration
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// tokenBucket holds the state of a single key
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// newRateLimiter returns a limiter allowing rate requests per second per key
+// with bursts of up to burst requests. A burst below 1 is raised to 1.
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	b := math.Max(float64(burst), 1)
+	return &rateLimiter{
+		rate:    rate,
+		burst:   b,
+		idle:    time.Duration(b / rate * float64(time.Second)),
+		buckets: make(map[string]*tokenBucket),
+		now:     time.Now,
+	}
+}
+
+// allow reports whether a request for key may proceed, consuming a token if
+// so. When it may not, the returned duration is how long until a token is
+// available.
+func (l *rateLimiter) allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	} else {
+		elapsed := now.Sub(b.last).Seconds()
+		b.tokens = math.Min(l.burst, b.tokens+elapsed*l.rate)
+		b.last = now
+	}
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+
+	wait := (1 - b.tokens) / l.rate
+	return false, time.Duration(wait * float64(time.Second))
+}
+
+// sweep drops buckets that have been idle long enough to be full again.
+// It runs at most once per idle period so allow stays cheap.
+func (l *rateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < l.idle {
+		return
+	}
+	l.lastSweep = now
+	for key, b := range l.buckets {
+		if now.Sub(b.last) >= l.idle {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// size returns the number of tracked keys
+func (l *rateLimiter) size() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.buckets)
+}
+
+// allowRequest applies the server's rate limit to r, writing a 429 response
+// with Retry-After and returning false when the client is over its limit
+func (s *Server) allowRequest(w http.ResponseWriter, r *http.Request) bool {
+	if s.limiter == nil {
+		return true
+	}
+
+	ok, wait := s.limiter.allow(clientIP(r, s.trustProxy))
+	if ok {
+		return true
+	}
+
+	retryAfter := int(math.Ceil(wait.Seconds()))
+	if retryAfter < 1 {
+		retryAfter = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	writeError(w, r, newAPIError(http.StatusTooManyRequests, codeRateLimited, "Too many requests"))
+	return false
+}
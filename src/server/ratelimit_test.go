@@ -0,0 +1,136 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter_Allow(t *testing.T) {
+	now := time.Unix(0, 0)
+	l := newRateLimiter(2, 3)
+	l.now = func() time.Time { return now }
+
+	// The full burst is available immediately
+	for i := 0; i < 3; i++ {
+		if ok, _ := l.allow("a"); !ok {
+			t.Fatalf("request %d within burst was rejected", i+1)
+		}
+	}
+
+	ok, wait := l.allow("a")
+	if ok {
+		t.Fatal("request beyond burst was allowed")
+	}
+	if wait != 500*time.Millisecond {
+		t.Errorf("Expected wait of 500ms at 2 req/s, got %v", wait)
+	}
+
+	// Tokens refill at the configured rate
+	now = now.Add(500 * time.Millisecond)
+	if ok, _ := l.allow("a"); !ok {
+		t.Error("request after refill was rejected")
+	}
+}
+
+func TestRateLimiter_ExpiresIdleEntries(t *testing.T) {
+	now := time.Unix(0, 0)
+	l := newRateLimiter(10, 10)
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < 100; i++ {
+		l.allow("10.0.0." + strconv.Itoa(i))
+	}
+	if got := l.size(); got != 100 {
+		t.Fatalf("Expected 100 tracked keys, got %d", got)
+	}
+
+	// After the refill period every bucket is full again and can be dropped
+	now = now.Add(2 * time.Second)
+	l.allow("10.0.1.1")
+	if got := l.size(); got != 1 {
+		t.Errorf("Expected idle keys to expire leaving 1, got %d", got)
+	}
+}
+
+func TestHandler_RateLimit(t *testing.T) {
+	srv, err := New(Config{
+		ImagePath: createTestJPEG(t),
+		RateLimit: 1,
+		RateBurst: 5,
+	})
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+
+	get := func(path, remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		req.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(w, req)
+		return w
+	}
+
+	// Hammer the tile endpoint from one client until it is throttled
+	var limited *httptest.ResponseRecorder
+	for i := 0; i < 20; i++ {
+		w := get("/0/0/0.png", "192.0.2.1:1234")
+		if w.Code == http.StatusTooManyRequests {
+			limited = w
+			break
+		}
+		if w.Code != http.StatusOK {
+			t.Fatalf("Unexpected status %d before limit", w.Code)
+		}
+	}
+	if limited == nil {
+		t.Fatal("Expected 429 after exceeding the burst")
+	}
+	if ra, err := strconv.Atoi(limited.Header().Get("Retry-After")); err != nil || ra < 1 {
+		t.Errorf("Expected positive Retry-After, got %q", limited.Header().Get("Retry-After"))
+	}
+
+	// Other clients are unaffected
+	if w := get("/0/0/0.png", "192.0.2.2:1234"); w.Code != http.StatusOK {
+		t.Errorf("Second client got status %d, want 200", w.Code)
+	}
+
+	// Non-tile routes are not rate limited
+	if w := get("/tilejson.json", "192.0.2.1:1234"); w.Code != http.StatusOK {
+		t.Errorf("TileJSON got status %d, want 200", w.Code)
+	}
+}
+
+func TestHandler_RateLimitTrustProxy(t *testing.T) {
+	srv, err := New(Config{
+		ImagePath:  createTestJPEG(t),
+		RateLimit:  1,
+		RateBurst:  1,
+		TrustProxy: true,
+	})
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+
+	get := func(forwardedFor string) int {
+		req := httptest.NewRequest("GET", "/0/0/0.png", nil)
+		req.RemoteAddr = "127.0.0.1:1234" // the reverse proxy
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		w := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if code := get("198.51.100.1"); code != http.StatusOK {
+		t.Fatalf("First request got %d, want 200", code)
+	}
+	if code := get("198.51.100.1"); code != http.StatusTooManyRequests {
+		t.Errorf("Repeat request got %d, want 429", code)
+	}
+	// A different client behind the same proxy has its own bucket
+	if code := get("198.51.100.2"); code != http.StatusOK {
+		t.Errorf("Other client got %d, want 200", code)
+	}
+}
@@ -0,0 +1,57 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"runtime/debug"
+)
+
+// recoverMiddleware turns a panicking handler into a logged 500 response,
+// so a malformed image that trips up the renderer or an encoder fails one
+// request instead of the connection. If the handler had already started
+// its response, the connection is aborted as net/http would do.
+func (s *Server) recoverMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pw := &panicResponseWriter{ResponseWriter: w}
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			if err, ok := v.(error); ok && errors.Is(err, http.ErrAbortHandler) {
+				panic(v)
+			}
+
+			s.logger.Error("Panic serving request", "request_id", requestID(r.Context()),
+				"method", r.Method, "path", r.URL.Path, "panic", v, "stack", string(debug.Stack()))
+			if pw.wroteHeader {
+				panic(http.ErrAbortHandler)
+			}
+			writeError(w, r, newAPIError(http.StatusInternalServerError, codeInternal, "Internal server error"))
+		}()
+		next.ServeHTTP(pw, r)
+	})
+}
+
+// panicResponseWriter records whether the response has been started
+type panicResponseWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+// WriteHeader records that the response has started
+func (pw *panicResponseWriter) WriteHeader(code int) {
+	pw.wroteHeader = true
+	pw.ResponseWriter.WriteHeader(code)
+}
+
+// Write records that the response has started
+func (pw *panicResponseWriter) Write(b []byte) (int, error) {
+	pw.wroteHeader = true
+	return pw.ResponseWriter.Write(b)
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (pw *panicResponseWriter) Unwrap() http.ResponseWriter {
+	return pw.ResponseWriter
+}
@@ -0,0 +1,119 @@
+package server
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"org.xyzmaps.xyztiles/src/imagery"
+)
+
+func TestRecover_PanickingRender(t *testing.T) {
+	rec := &recordingHandler{}
+	srv, err := NewWithBaseMap(solidBaseMap(color.RGBA{0, 0, 255, 255}), Config{
+		MaxConcurrentRenders: 1,
+		Logger:               slog.New(rec),
+	})
+	if err != nil {
+		t.Fatalf("NewWithBaseMap() failed: %v", err)
+	}
+	render := srv.render
+	srv.render = func(ctx context.Context, l *layer, z, x, y, size int) (*image.RGBA, error) {
+		if z == 2 {
+			panic("corrupt source image")
+		}
+		return render(ctx, l, z, x, y, size)
+	}
+
+	env := fetchError(t, srv.Handler(), "/2/1/1.png", http.StatusInternalServerError)
+	if env.Error.Code != codeInternal {
+		t.Errorf("Expected code %q, got %q", codeInternal, env.Error.Code)
+	}
+
+	r := rec.find("Panic serving request")
+	if r == nil {
+		t.Fatal("Expected the panic to be logged")
+	}
+	attrs := map[string]string{}
+	r.Attrs(func(a slog.Attr) bool {
+		attrs[a.Key] = a.Value.String()
+		return true
+	})
+	if attrs["path"] != "/2/1/1.png" || attrs["panic"] != "corrupt source image" {
+		t.Errorf("Unexpected log fields: path=%q panic=%q", attrs["path"], attrs["panic"])
+	}
+
+	// The render slot was released, so the single-slot server still renders
+	fetchError(t, srv.Handler(), "/1/0/0.png", http.StatusOK)
+}
+
+func TestRecover_PlainText(t *testing.T) {
+	srv, err := NewWithBaseMap(solidBaseMap(color.RGBA{}), Config{Logger: slog.New(&recordingHandler{})})
+	if err != nil {
+		t.Fatalf("NewWithBaseMap() failed: %v", err)
+	}
+	srv.render = func(context.Context, *layer, int, int, int, int) (*image.RGBA, error) {
+		panic("boom")
+	}
+
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/0/0/0.png", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("Expected status 500, got %d", w.Code)
+	}
+	if got := w.Body.String(); got != "Internal server error\n" {
+		t.Errorf("Expected plain text message, got %q", got)
+	}
+}
+
+func TestRecover_StartedResponseAborts(t *testing.T) {
+	srv := &Server{logger: slog.New(&recordingHandler{})}
+	h := srv.recoverMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("partial"))
+		panic("boom")
+	}))
+
+	defer func() {
+		if v := recover(); v != http.ErrAbortHandler {
+			t.Errorf("Expected http.ErrAbortHandler, got %v", v)
+		}
+	}()
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	t.Error("Expected the panic to propagate")
+}
+
+func TestRecover_ServerSurvives(t *testing.T) {
+	srv, err := NewWithBaseMap(solidBaseMap(color.RGBA{}), Config{Logger: slog.New(&recordingHandler{})})
+	if err != nil {
+		t.Fatalf("NewWithBaseMap() failed: %v", err)
+	}
+	srv.encode = func(w io.Writer, img image.Image, format imagery.Format) error {
+		panic("encoder bug")
+	}
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	for range 3 {
+		resp, err := http.Get(ts.URL + "/0/0/0.png")
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusInternalServerError {
+			t.Fatalf("Expected status 500, got %d", resp.StatusCode)
+		}
+	}
+	resp, err := http.Get(ts.URL + "/tilejson.json")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected status 200 after panics, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,334 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultRedisPrefix is prepended to the keys of tiles stored in Redis when
+// RedisConfig.Prefix is empty
+const DefaultRedisPrefix = "xyztiles:"
+
+// DefaultRedisMaxEntryBytes bounds the size of a tile stored in Redis when
+// RedisConfig.MaxEntryBytes is 0
+const DefaultRedisMaxEntryBytes = 2 << 20
+
+// redisIdleConns is how many idle connections a RedisCache keeps open
+const redisIdleConns = 8
+
+// redisDialTimeout bounds connecting to Redis when the request's context
+// has no earlier deadline
+const redisDialTimeout = 5 * time.Second
+
+// RedisConfig configures a RedisCache
+type RedisConfig struct {
+	Addr     string // host:port of the Redis server
+	Password string // Optional: sent with AUTH on every new connection
+	DB       int    // Database selected on every new connection (default 0)
+	TLS      bool   // Connect over TLS
+
+	// Prefix is prepended to every key (default DefaultRedisPrefix). TTL,
+	// when set, expires tiles that long after they are stored.
+	Prefix string
+	TTL    time.Duration
+
+	// MaxEntryBytes refuses to store larger tiles, so a misconfigured tile
+	// size cannot fill Redis (default DefaultRedisMaxEntryBytes)
+	MaxEntryBytes int
+
+	TLSConfig *tls.Config // Optional: used with TLS instead of the defaults for Addr's host
+}
+
+// RedisCache is a TileCache storing tiles as Redis strings, so replicas of a
+// server can share rendered tiles through a Redis they already run. It
+// speaks the GET, SET and DEL subset of the Redis protocol over a small pool
+// of connections.
+type RedisCache struct {
+	cfg  RedisConfig
+	idle chan *redisConn
+
+	mu     sync.Mutex
+	closed bool // Close was called; connections are no longer pooled
+}
+
+// redisConn is a connection to Redis with buffered reads and writes, so the
+// commands of a handshake are sent in one write
+type redisConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+	w    *bufio.Writer
+}
+
+// redisError is an error reply from Redis. The connection it arrived on is
+// still usable.
+type redisError string
+
+func (e redisError) Error() string {
+	return "redis: " + string(e)
+}
+
+// NewRedisCache returns a RedisCache for cfg.Addr. It does not contact the
+// server; Ping does.
+func NewRedisCache(cfg RedisConfig) (*RedisCache, error) {
+	if cfg.Addr == "" {
+		return nil, errors.New("Redis cache needs an address")
+	}
+	if _, _, err := net.SplitHostPort(cfg.Addr); err != nil {
+		return nil, fmt.Errorf("invalid Redis address %q: expected host:port", cfg.Addr)
+	}
+	if cfg.DB < 0 {
+		return nil, fmt.Errorf("invalid Redis database %d: must not be negative", cfg.DB)
+	}
+	if cfg.TTL < 0 {
+		return nil, fmt.Errorf("invalid Redis TTL %v: must not be negative", cfg.TTL)
+	}
+	if cfg.MaxEntryBytes < 0 {
+		return nil, fmt.Errorf("invalid Redis entry size limit %d: must not be negative", cfg.MaxEntryBytes)
+	}
+	if cfg.Prefix == "" {
+		cfg.Prefix = DefaultRedisPrefix
+	}
+	if cfg.MaxEntryBytes == 0 {
+		cfg.MaxEntryBytes = DefaultRedisMaxEntryBytes
+	}
+	return &RedisCache{cfg: cfg, idle: make(chan *redisConn, redisIdleConns)}, nil
+}
+
+// Get implements TileCache
+func (c *RedisCache) Get(ctx context.Context, key string) ([]byte, error) {
+	reply, err := c.do(ctx, "GET", c.cfg.Prefix+key)
+	if err != nil {
+		return nil, err
+	}
+	if reply == nil {
+		return nil, ErrCacheMiss
+	}
+	data, ok := reply.([]byte)
+	if !ok {
+		return nil, fmt.Errorf("redis: unexpected reply %v to GET", reply)
+	}
+	return data, nil
+}
+
+// Put implements TileCache. Tiles larger than the configured
+// MaxEntryBytes are refused with ErrCacheEntryTooLarge.
+func (c *RedisCache) Put(ctx context.Context, key string, data []byte) error {
+	if len(data) > c.cfg.MaxEntryBytes {
+		return fmt.Errorf("%w: %d bytes, Redis limit is %d", ErrCacheEntryTooLarge, len(data), c.cfg.MaxEntryBytes)
+	}
+	args := []string{"SET", c.cfg.Prefix + key, string(data)}
+	if c.cfg.TTL > 0 {
+		args = append(args, "PX", strconv.FormatInt(max(c.cfg.TTL.Milliseconds(), 1), 10))
+	}
+	_, err := c.do(ctx, args...)
+	return err
+}
+
+// Delete implements TileCache. Deleting a missing key succeeds.
+func (c *RedisCache) Delete(ctx context.Context, key string) error {
+	_, err := c.do(ctx, "DEL", c.cfg.Prefix+key)
+	return err
+}
+
+// Ping checks that the server can be reached with the configured
+// credentials and database
+func (c *RedisCache) Ping(ctx context.Context) error {
+	_, err := c.do(ctx, "PING")
+	return err
+}
+
+// Close closes the idle connections. Connections in use are closed when
+// their command completes.
+func (c *RedisCache) Close() error {
+	c.mu.Lock()
+	c.closed = true
+	c.mu.Unlock()
+	for {
+		select {
+		case rc := <-c.idle:
+			rc.conn.Close()
+		default:
+			return nil
+		}
+	}
+}
+
+// do sends one command and reads its reply: nil for a nil reply, []byte for
+// a bulk string, string for a status and int64 for an integer. An error
+// reply is returned as a redisError.
+func (c *RedisCache) do(ctx context.Context, args ...string) (any, error) {
+	rc, err := c.conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	reply, err := rc.roundTrip(ctx, c.cfg.MaxEntryBytes, args)
+	c.release(rc, err)
+	if err != nil && ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	return reply, err
+}
+
+// conn returns an idle connection or dials a new one, authenticating and
+// selecting the database in a single round trip
+func (c *RedisCache) conn(ctx context.Context) (*redisConn, error) {
+	select {
+	case rc := <-c.idle:
+		return rc, nil
+	default:
+	}
+
+	dialCtx, cancel := context.WithTimeout(ctx, redisDialTimeout)
+	defer cancel()
+	var d net.Dialer
+	conn, err := d.DialContext(dialCtx, "tcp", c.cfg.Addr)
+	if err != nil {
+		return nil, err
+	}
+	if c.cfg.TLS {
+		tlsCfg := c.cfg.TLSConfig
+		if tlsCfg == nil {
+			host, _, _ := net.SplitHostPort(c.cfg.Addr)
+			tlsCfg = &tls.Config{ServerName: host}
+		}
+		tc := tls.Client(conn, tlsCfg)
+		if err := tc.HandshakeContext(dialCtx); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		conn = tc
+	}
+	rc := &redisConn{conn: conn, r: bufio.NewReader(conn), w: bufio.NewWriter(conn)}
+
+	var handshake [][]string
+	if c.cfg.Password != "" {
+		handshake = append(handshake, []string{"AUTH", c.cfg.Password})
+	}
+	if c.cfg.DB != 0 {
+		handshake = append(handshake, []string{"SELECT", strconv.Itoa(c.cfg.DB)})
+	}
+	if len(handshake) > 0 {
+		if err := rc.pipeline(dialCtx, handshake); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return rc, nil
+}
+
+// release returns rc to the pool after a command that left it usable, and
+// closes it otherwise
+func (c *RedisCache) release(rc *redisConn, err error) {
+	var replyErr redisError
+	if err != nil && !errors.As(err, &replyErr) {
+		rc.conn.Close()
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.closed {
+		select {
+		case c.idle <- rc:
+			return
+		default:
+		}
+	}
+	rc.conn.Close()
+}
+
+// roundTrip writes one command and reads its reply, giving up with ctx
+func (rc *redisConn) roundTrip(ctx context.Context, maxBulk int, args []string) (any, error) {
+	stop := rc.watch(ctx)
+	defer stop()
+	rc.writeCommand(args)
+	if err := rc.w.Flush(); err != nil {
+		return nil, err
+	}
+	return rc.readReply(maxBulk)
+}
+
+// pipeline writes cmds in one go and reads their replies, which must all
+// succeed
+func (rc *redisConn) pipeline(ctx context.Context, cmds [][]string) error {
+	stop := rc.watch(ctx)
+	defer stop()
+	for _, args := range cmds {
+		rc.writeCommand(args)
+	}
+	if err := rc.w.Flush(); err != nil {
+		return err
+	}
+	for _, args := range cmds {
+		if _, err := rc.readReply(0); err != nil {
+			return fmt.Errorf("redis %s: %w", args[0], err)
+		}
+	}
+	return nil
+}
+
+// watch applies ctx's deadline to the connection and interrupts it when ctx
+// is canceled. The returned function stops watching.
+func (rc *redisConn) watch(ctx context.Context) func() {
+	deadline, _ := ctx.Deadline()
+	rc.conn.SetDeadline(deadline)
+	stop := context.AfterFunc(ctx, func() {
+		rc.conn.SetDeadline(time.Now())
+	})
+	return func() { stop() }
+}
+
+// writeCommand buffers args as an array of bulk strings
+func (rc *redisConn) writeCommand(args []string) {
+	fmt.Fprintf(rc.w, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(rc.w, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+}
+
+// readReply reads a status, error, integer or bulk string reply. Bulk
+// strings longer than maxBulk, when it is positive, are refused.
+func (rc *redisConn) readReply(maxBulk int) (any, error) {
+	line, err := rc.r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("redis: empty reply")
+	}
+	switch kind, rest := line[0], line[1:]; kind {
+	case '+':
+		return rest, nil
+	case '-':
+		return nil, redisError(rest)
+	case ':':
+		return strconv.ParseInt(rest, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(rest)
+		if err != nil {
+			return nil, fmt.Errorf("redis: invalid bulk length %q", rest)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		if maxBulk > 0 && n > maxBulk {
+			return nil, fmt.Errorf("redis: %d byte value is larger than the %d byte limit", n, maxBulk)
+		}
+		data := make([]byte, n+2)
+		if _, err := io.ReadFull(rc.r, data); err != nil {
+			return nil, err
+		}
+		return data[:n], nil
+	default:
+		return nil, fmt.Errorf("redis: unsupported reply %q", line)
+	}
+}
@@ -0,0 +1,302 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRedis is an in-memory Redis server speaking the AUTH, SELECT, PING,
+// GET, SET (with PX) and DEL subset of the protocol, with a clock tests can
+// advance to expire keys
+type fakeRedis struct {
+	ln       net.Listener
+	password string
+
+	mu       sync.Mutex
+	now      time.Time
+	dbs      map[int]map[string]fakeRedisValue
+	commands []string // Names of the commands received, in order
+}
+
+// fakeRedisValue is a stored value and when it expires, if ever
+type fakeRedisValue struct {
+	data    string
+	expires time.Time
+}
+
+// newFakeRedis starts a fakeRedis on a local port, requiring password when
+// it is set
+func newFakeRedis(t *testing.T, password string) *fakeRedis {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	f := &fakeRedis{ln: ln, password: password, now: time.Now(), dbs: map[int]map[string]fakeRedisValue{}}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+	return f
+}
+
+func (f *fakeRedis) addr() string {
+	return f.ln.Addr().String()
+}
+
+// advance moves the clock forward by d
+func (f *fakeRedis) advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.now = f.now.Add(d)
+}
+
+// value returns the value stored under key in db
+func (f *fakeRedis) value(db int, key string) (fakeRedisValue, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	v, ok := f.dbs[db][key]
+	return v, ok
+}
+
+// serve answers the commands of one connection until it is closed
+func (f *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	authed := f.password == ""
+	db := 0
+	for {
+		args, err := readFakeRedisCommand(r)
+		if err != nil {
+			return
+		}
+		name := strings.ToUpper(args[0])
+		f.mu.Lock()
+		f.commands = append(f.commands, name)
+		f.mu.Unlock()
+
+		var reply string
+		switch {
+		case name == "AUTH":
+			if len(args) == 2 && args[1] == f.password {
+				authed = true
+				reply = "+OK\r\n"
+			} else {
+				reply = "-WRONGPASS invalid username-password pair\r\n"
+			}
+		case !authed:
+			reply = "-NOAUTH Authentication required.\r\n"
+		case name == "SELECT":
+			db, _ = strconv.Atoi(args[1])
+			reply = "+OK\r\n"
+		case name == "PING":
+			reply = "+PONG\r\n"
+		default:
+			reply = f.exec(db, name, args[1:])
+		}
+		if _, err := io.WriteString(conn, reply); err != nil {
+			return
+		}
+	}
+}
+
+// exec runs a data command against db and returns its encoded reply
+func (f *fakeRedis) exec(db int, name string, args []string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.dbs[db] == nil {
+		f.dbs[db] = map[string]fakeRedisValue{}
+	}
+	values := f.dbs[db]
+	if v, ok := values[args[0]]; ok && !v.expires.IsZero() && !f.now.Before(v.expires) {
+		delete(values, args[0])
+	}
+	switch name {
+	case "GET":
+		v, ok := values[args[0]]
+		if !ok {
+			return "$-1\r\n"
+		}
+		return fmt.Sprintf("$%d\r\n%s\r\n", len(v.data), v.data)
+	case "SET":
+		v := fakeRedisValue{data: args[1]}
+		if len(args) == 4 && strings.ToUpper(args[2]) == "PX" {
+			ms, _ := strconv.ParseInt(args[3], 10, 64)
+			v.expires = f.now.Add(time.Duration(ms) * time.Millisecond)
+		}
+		values[args[0]] = v
+		return "+OK\r\n"
+	case "DEL":
+		_, ok := values[args[0]]
+		delete(values, args[0])
+		if ok {
+			return ":1\r\n"
+		}
+		return ":0\r\n"
+	}
+	return "-ERR unknown command '" + name + "'\r\n"
+}
+
+// readFakeRedisCommand reads a command sent as an array of bulk strings
+func readFakeRedisCommand(r *bufio.Reader) ([]string, error) {
+	var n int
+	if _, err := fmt.Fscanf(r, "*%d\r\n", &n); err != nil {
+		return nil, err
+	}
+	args := make([]string, n)
+	for i := range args {
+		var size int
+		if _, err := fmt.Fscanf(r, "$%d\r\n", &size); err != nil {
+			return nil, err
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
+
+// newTestRedisCache returns a RedisCache for cfg, closed with the test
+func newTestRedisCache(t *testing.T, cfg RedisConfig) *RedisCache {
+	t.Helper()
+	c, err := NewRedisCache(cfg)
+	if err != nil {
+		t.Fatalf("NewRedisCache() failed: %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestRedisCache(t *testing.T) {
+	fake := newFakeRedis(t, "secret")
+	c := newTestRedisCache(t, RedisConfig{Addr: fake.addr(), Password: "secret", DB: 2})
+	ctx := context.Background()
+
+	if _, err := c.Get(ctx, "v1/default/1/0/0.png"); !errors.Is(err, ErrCacheMiss) {
+		t.Errorf("Expected ErrCacheMiss, got %v", err)
+	}
+	tile := "tile\r\nwith\x00binary"
+	if err := c.Put(ctx, "v1/default/1/0/0.png", []byte(tile)); err != nil {
+		t.Fatalf("Put() failed: %v", err)
+	}
+	if v, ok := fake.value(2, DefaultRedisPrefix+"v1/default/1/0/0.png"); !ok || v.data != tile || !v.expires.IsZero() {
+		t.Errorf("Expected the tile stored without expiry in database 2 under the default prefix, got %+v, %v", v, ok)
+	}
+	if data, err := c.Get(ctx, "v1/default/1/0/0.png"); err != nil || string(data) != tile {
+		t.Errorf("Expected the tile, got %q, %v", data, err)
+	}
+
+	if err := c.Delete(ctx, "v1/default/1/0/0.png"); err != nil {
+		t.Fatalf("Delete() failed: %v", err)
+	}
+	if _, err := c.Get(ctx, "v1/default/1/0/0.png"); !errors.Is(err, ErrCacheMiss) {
+		t.Errorf("Expected ErrCacheMiss after Delete, got %v", err)
+	}
+	if err := c.Delete(ctx, "v1/default/1/0/0.png"); err != nil {
+		t.Errorf("Expected deleting a missing key to succeed, got %v", err)
+	}
+
+	// The connection is reused, so the handshake is sent once
+	auths := 0
+	fake.mu.Lock()
+	for _, name := range fake.commands {
+		if name == "AUTH" {
+			auths++
+		}
+	}
+	fake.mu.Unlock()
+	if auths != 1 {
+		t.Errorf("Expected 1 AUTH on a pooled connection, got %d", auths)
+	}
+}
+
+func TestRedisCache_Expiry(t *testing.T) {
+	fake := newFakeRedis(t, "")
+	c := newTestRedisCache(t, RedisConfig{Addr: fake.addr(), Prefix: "tiles:", TTL: time.Hour})
+	ctx := context.Background()
+
+	if err := c.Put(ctx, "v1/default/0/0/0.png", []byte("tile")); err != nil {
+		t.Fatalf("Put() failed: %v", err)
+	}
+	if _, ok := fake.value(0, "tiles:v1/default/0/0/0.png"); !ok {
+		t.Fatal("Expected the tile stored under the configured prefix")
+	}
+	fake.advance(59 * time.Minute)
+	if _, err := c.Get(ctx, "v1/default/0/0/0.png"); err != nil {
+		t.Errorf("Expected the tile before its TTL, got %v", err)
+	}
+	fake.advance(time.Minute)
+	if _, err := c.Get(ctx, "v1/default/0/0/0.png"); !errors.Is(err, ErrCacheMiss) {
+		t.Errorf("Expected ErrCacheMiss after the TTL, got %v", err)
+	}
+}
+
+func TestRedisCache_Errors(t *testing.T) {
+	fake := newFakeRedis(t, "secret")
+	ctx := context.Background()
+
+	wrong := newTestRedisCache(t, RedisConfig{Addr: fake.addr(), Password: "wrong"})
+	if err := wrong.Ping(ctx); err == nil || !strings.Contains(err.Error(), "WRONGPASS") {
+		t.Errorf("Expected an authentication error, got %v", err)
+	}
+	none := newTestRedisCache(t, RedisConfig{Addr: fake.addr()})
+	if _, err := none.Get(ctx, "v1/default/0/0/0.png"); err == nil || errors.Is(err, ErrCacheMiss) {
+		t.Errorf("Expected NOAUTH rather than a miss, got %v", err)
+	}
+
+	c := newTestRedisCache(t, RedisConfig{Addr: fake.addr(), Password: "secret", MaxEntryBytes: 8})
+	if err := c.Put(ctx, "v1/default/0/0/0.png", []byte("too large")); !errors.Is(err, ErrCacheEntryTooLarge) {
+		t.Errorf("Expected ErrCacheEntryTooLarge, got %v", err)
+	}
+	if _, ok := fake.value(0, DefaultRedisPrefix+"v1/default/0/0/0.png"); ok {
+		t.Error("Expected a tile over the size limit not stored")
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := c.Ping(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
+
+func TestNewRedisCache(t *testing.T) {
+	tests := []struct {
+		cfg       RedisConfig
+		expectErr bool
+		name      string
+	}{
+		{RedisConfig{Addr: "localhost:6379"}, false, "address"},
+		{RedisConfig{Addr: "redis.example.com:6380", Password: "secret", DB: 3, TLS: true, TTL: time.Hour}, false, "all options"},
+		{RedisConfig{}, true, "no address"},
+		{RedisConfig{Addr: "localhost"}, true, "no port"},
+		{RedisConfig{Addr: "localhost:6379", DB: -1}, true, "negative database"},
+		{RedisConfig{Addr: "localhost:6379", TTL: -time.Second}, true, "negative TTL"},
+		{RedisConfig{Addr: "localhost:6379", MaxEntryBytes: -1}, true, "negative entry size"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewRedisCache(tt.cfg)
+			if (err != nil) != tt.expectErr {
+				t.Errorf("Expected error: %v, got %v", tt.expectErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package server
+
+import (
+	"fmt"
+	"time"
+
+	"org.xyzmaps.xyztiles/src/imagery"
+)
+
+// Reload loads every layer that was read from an image file again from the
+// same path and with the same options, then swaps the new base maps in and
+// empties the tile cache. Requests keep being served from the old base maps
+// while the images decode. If any layer fails to load, no layer is swapped
+// and the error is returned. Layers from embedded data or preloaded base
+// maps are not reloaded; if there are no others, Reload only logs that it
+// has nothing to do. Unless Config.TilesetVersion is set, each reloaded
+// layer's version is derived from its new image.
+func (s *Server) Reload() error {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	start := time.Now()
+	loaded := make(map[*layer]*imagery.BaseMap)
+	versions := make(map[*layer]string)
+	for _, name := range s.layerNames {
+		l := s.layers[name]
+		if l.source == "" {
+			continue
+		}
+		if !s.fixedVersion {
+			// Hash before decoding, so a file replaced in between gets a
+			// version that is new rather than one matching older tiles
+			v, err := fileVersion(l.source)
+			if err != nil {
+				s.logger.Error("Reload failed, keeping the current base maps", "layer", name, "path", l.source, "err", err)
+				return fmt.Errorf("failed to reload layer %q: %w", name, err)
+			}
+			versions[l] = withRenderOptions(v, s.renderFP)
+		}
+		bm, err := imagery.LoadImage(l.source, s.loadOpts)
+		if err != nil {
+			s.logger.Error("Reload failed, keeping the current base maps", "layer", name, "path", l.source, "err", err)
+			return fmt.Errorf("failed to reload layer %q: %w", name, err)
+		}
+		loaded[l] = bm
+	}
+
+	if len(loaded) == 0 {
+		s.logger.Info("Reload is a no-op: no base map was loaded from an image file")
+		return nil
+	}
+
+	for l, bm := range loaded {
+		l.basemap.Store(bm)
+		if v, ok := versions[l]; ok {
+			l.version.Store(&v)
+		}
+		s.logger.Info("Reloaded base map", "layer", l.name, "width", bm.Width(), "height", bm.Height(),
+			"memory_bytes", bm.MemoryBytes(), "source", l.source, "tileset_version", l.tilesetVersion())
+	}
+	if s.cache != nil {
+		s.cache.purge()
+	}
+	s.logger.Info("Reload complete", "layers", len(loaded), "duration", time.Since(start))
+	return nil
+}
@@ -0,0 +1,152 @@
+package server
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// writeSolidPNG atomically replaces path with a 1024x512 PNG filled with c
+func writeSolidPNG(t *testing.T, path string, c color.RGBA) {
+	t.Helper()
+
+	img := image.NewRGBA(image.Rect(0, 0, 1024, 512))
+	draw.Draw(img, img.Bounds(), &image.Uniform{c}, image.Point{}, draw.Src)
+
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		t.Fatalf("Failed to create image: %v", err)
+	}
+	if err := png.Encode(f, img); err != nil {
+		t.Fatalf("Failed to encode PNG: %v", err)
+	}
+	f.Close()
+	if err := os.Rename(tmp, path); err != nil {
+		t.Fatalf("Failed to replace image: %v", err)
+	}
+}
+
+// tilePixel fetches a tile and returns its center pixel
+func tilePixel(t *testing.T, h http.Handler, path string) color.RGBA {
+	t.Helper()
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 for %s, got %d", path, w.Code)
+	}
+	tile, err := png.Decode(w.Body)
+	if err != nil {
+		t.Fatalf("Failed to decode PNG: %v", err)
+	}
+	return color.RGBAModel.Convert(tile.At(256, 256)).(color.RGBA)
+}
+
+func TestReload_SwapsBaseMap(t *testing.T) {
+	red := color.RGBA{255, 0, 0, 255}
+	blue := color.RGBA{0, 0, 255, 255}
+	path := filepath.Join(t.TempDir(), "world.png")
+	writeSolidPNG(t, path, red)
+
+	srv, err := New(Config{ImagePath: path, CacheMaxBytes: 16 << 20})
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+	h := srv.Handler()
+
+	if got := tilePixel(t, h, "/1/0/0.png"); got != red {
+		t.Fatalf("Expected pixel %v before reload, got %v", red, got)
+	}
+
+	// Keep requesting tiles throughout the reload; none may fail
+	stop := make(chan struct{})
+	var failures atomic.Int64
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				w := httptest.NewRecorder()
+				h.ServeHTTP(w, httptest.NewRequest("GET", "/1/0/0.png", nil))
+				if w.Code != http.StatusOK {
+					failures.Add(1)
+				}
+			}
+		}()
+	}
+
+	writeSolidPNG(t, path, blue)
+	err = srv.Reload()
+	close(stop)
+	wg.Wait()
+
+	if err != nil {
+		t.Fatalf("Reload() failed: %v", err)
+	}
+	if n := failures.Load(); n > 0 {
+		t.Errorf("Expected no failed requests during reload, got %d", n)
+	}
+	if got := tilePixel(t, h, "/1/0/0.png"); got != blue {
+		t.Errorf("Expected pixel %v after reload, got %v", blue, got)
+	}
+}
+
+func TestReload_FailureKeepsBaseMap(t *testing.T) {
+	red := color.RGBA{255, 0, 0, 255}
+	dir := t.TempDir()
+	path := filepath.Join(dir, "world.png")
+	nightPath := filepath.Join(dir, "night.png")
+	writeSolidPNG(t, path, red)
+	writeSolidPNG(t, nightPath, red)
+
+	srv, err := New(Config{ImagePath: path, Layers: []Layer{{Name: "night", ImagePath: nightPath}}})
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+
+	// A good primary image is not swapped in when another layer fails
+	writeSolidPNG(t, path, color.RGBA{0, 0, 255, 255})
+	if err := os.WriteFile(nightPath, []byte("not an image"), 0o644); err != nil {
+		t.Fatalf("Failed to corrupt image: %v", err)
+	}
+
+	if err := srv.Reload(); err == nil {
+		t.Fatal("Expected Reload() to fail for a corrupt image")
+	}
+	for _, p := range []string{"/1/0/0.png", "/night/1/0/0.png"} {
+		if got := tilePixel(t, srv.Handler(), p); got != red {
+			t.Errorf("Expected %s to keep pixel %v, got %v", p, red, got)
+		}
+	}
+}
+
+func TestReload_NoOpWithoutImageFile(t *testing.T) {
+	red := color.RGBA{255, 0, 0, 255}
+	srv, err := NewWithBaseMap(solidBaseMap(red), Config{})
+	if err != nil {
+		t.Fatalf("NewWithBaseMap() failed: %v", err)
+	}
+	bm := srv.defLayer.baseMap()
+
+	if err := srv.Reload(); err != nil {
+		t.Fatalf("Reload() failed: %v", err)
+	}
+	if srv.defLayer.baseMap() != bm {
+		t.Error("Expected base map without a source file to be kept")
+	}
+}
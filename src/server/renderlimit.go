@@ -0,0 +1,98 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultRenderQueueTimeout is how long a tile request waits for a free
+// render slot before it is rejected with 503
+const DefaultRenderQueueTimeout = 5 * time.Second
+
+// DefaultRenderTimeout is how long a tile may take to render and encode
+// before the request is answered with 503
+const DefaultRenderTimeout = 10 * time.Second
+
+// errRenderBusy is returned when no render slot frees up in time
+var errRenderBusy = errors.New("render queue timeout")
+
+// renderLimiter bounds the number of tiles rendered at once. Requests beyond
+// the limit wait up to timeout for a slot.
+type renderLimiter struct {
+	slots   chan struct{}
+	timeout time.Duration
+	queued  atomic.Int64
+}
+
+// RenderStats reports the state of the render limiter
+type RenderStats struct {
+	Limit    int `json:"limit"`     // Maximum concurrent renders
+	InFlight int `json:"in_flight"` // Renders currently running
+	Queued   int `json:"queued"`    // Requests waiting for a render slot
+}
+
+// newRenderLimiter returns a limiter allowing limit concurrent renders
+func newRenderLimiter(limit int, timeout time.Duration) *renderLimiter {
+	return &renderLimiter{
+		slots:   make(chan struct{}, limit),
+		timeout: timeout,
+	}
+}
+
+// acquire blocks until a render slot is free, the timeout elapses, or ctx is
+// done. On success the caller must call release.
+func (l *renderLimiter) acquire(ctx context.Context) error {
+	// Fast path: a slot is free
+	select {
+	case l.slots <- struct{}{}:
+		return nil
+	default:
+	}
+
+	l.queued.Add(1)
+	defer l.queued.Add(-1)
+
+	timer := time.NewTimer(l.timeout)
+	defer timer.Stop()
+
+	select {
+	case l.slots <- struct{}{}:
+		return nil
+	case <-timer.C:
+		return errRenderBusy
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// wait blocks until a render slot is free or ctx is done, without the queue
+// timeout applied by acquire. On success the caller must call release.
+func (l *renderLimiter) wait(ctx context.Context) error {
+	select {
+	case l.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// release frees a slot taken by acquire or wait
+func (l *renderLimiter) release() {
+	<-l.slots
+}
+
+// stats returns a snapshot of the limiter state
+func (l *renderLimiter) stats() RenderStats {
+	return RenderStats{
+		Limit:    cap(l.slots),
+		InFlight: len(l.slots),
+		Queued:   int(l.queued.Load()),
+	}
+}
+
+// RenderStats returns the current render concurrency and queue depth
+func (s *Server) RenderStats() RenderStats {
+	return s.renders.stats()
+}
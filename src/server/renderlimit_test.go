@@ -0,0 +1,270 @@
+package server
+
+import (
+	"context"
+	"image"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"org.xyzmaps.xyztiles/src/imagery"
+)
+
+// slowRenderer returns a render func that blocks until unblock is closed,
+// recording the peak number of concurrent calls
+type slowRenderer struct {
+	inFlight atomic.Int32
+	peak     atomic.Int32
+	started  chan struct{}
+	unblock  chan struct{}
+}
+
+func newSlowRenderer() *slowRenderer {
+	return &slowRenderer{
+		started: make(chan struct{}, 100),
+		unblock: make(chan struct{}),
+	}
+}
+
+func (r *slowRenderer) render(_ context.Context, _ *layer, z, x, y, _ int) (*image.RGBA, error) {
+	n := r.inFlight.Add(1)
+	defer r.inFlight.Add(-1)
+	for {
+		peak := r.peak.Load()
+		if n <= peak || r.peak.CompareAndSwap(peak, n) {
+			break
+		}
+	}
+	r.started <- struct{}{}
+	<-r.unblock
+	return image.NewRGBA(image.Rect(0, 0, 8, 8)), nil
+}
+
+func TestRenderLimit_RejectsWhenSaturated(t *testing.T) {
+	srv, err := New(Config{
+		ImagePath:            createTestJPEG(t),
+		MaxConcurrentRenders: 2,
+		RenderQueueTimeout:   100 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+	renderer := newSlowRenderer()
+	srv.render = renderer.render
+
+	get := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/0/0/0.png", nil))
+		return w
+	}
+
+	// Occupy both render slots
+	var wg sync.WaitGroup
+	first := make([]*httptest.ResponseRecorder, 2)
+	for i := range first {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			first[i] = get()
+		}()
+	}
+	<-renderer.started
+	<-renderer.started
+
+	// Further requests queue, then give up with 503
+	excess := make([]*httptest.ResponseRecorder, 3)
+	var excessWG sync.WaitGroup
+	for i := range excess {
+		excessWG.Add(1)
+		go func() {
+			defer excessWG.Done()
+			excess[i] = get()
+		}()
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for srv.RenderStats().Queued < len(excess) && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if stats := srv.RenderStats(); stats.InFlight != 2 || stats.Limit != 2 {
+		t.Errorf("Unexpected render stats while saturated: %+v", stats)
+	}
+
+	excessWG.Wait()
+	for i, w := range excess {
+		if w.Code != http.StatusServiceUnavailable {
+			t.Errorf("Excess request %d: expected 503, got %d", i, w.Code)
+		}
+		if w.Header().Get("Retry-After") == "" {
+			t.Errorf("Excess request %d: missing Retry-After header", i)
+		}
+	}
+
+	close(renderer.unblock)
+	wg.Wait()
+	for i, w := range first {
+		if w.Code != http.StatusOK {
+			t.Errorf("Request %d holding a slot: expected 200, got %d", i, w.Code)
+		}
+	}
+
+	if peak := renderer.peak.Load(); peak > 2 {
+		t.Errorf("Expected at most 2 concurrent renders, saw %d", peak)
+	}
+	if stats := srv.RenderStats(); stats.InFlight != 0 || stats.Queued != 0 {
+		t.Errorf("Expected idle render stats, got %+v", stats)
+	}
+}
+
+func TestRenderLimit_BoundsConcurrency(t *testing.T) {
+	srv, err := New(Config{
+		ImagePath:            createTestJPEG(t),
+		MaxConcurrentRenders: 3,
+		RenderQueueTimeout:   10 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+	renderer := newSlowRenderer()
+	srv.render = renderer.render
+
+	// Release renders gradually while 20 requests compete for 3 slots
+	go func() {
+		for range 20 {
+			<-renderer.started
+			time.Sleep(time.Millisecond)
+			renderer.unblock <- struct{}{}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	codes := make([]int, 20)
+	for i := range codes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w := httptest.NewRecorder()
+			srv.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/0/0/0.png", nil))
+			codes[i] = w.Code
+		}()
+	}
+	wg.Wait()
+
+	for i, code := range codes {
+		if code != http.StatusOK {
+			t.Errorf("Request %d: expected 200, got %d", i, code)
+		}
+	}
+	if peak := renderer.peak.Load(); peak > 3 {
+		t.Errorf("Expected at most 3 concurrent renders, saw %d", peak)
+	}
+}
+
+// ctxSleepRender returns a render func that takes d unless its context is
+// done first
+func ctxSleepRender(d time.Duration) func(context.Context, *layer, int, int, int, int) (*image.RGBA, error) {
+	return func(ctx context.Context, _ *layer, _, _, _, _ int) (*image.RGBA, error) {
+		select {
+		case <-time.After(d):
+			return image.NewRGBA(image.Rect(0, 0, 8, 8)), nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func TestRenderTimeout(t *testing.T) {
+	var logBuf syncBuffer
+	srv, err := New(Config{
+		ImagePath:     createTestJPEG(t),
+		RenderTimeout: 100 * time.Millisecond,
+		Logger:        slog.New(slog.NewTextHandler(&logBuf, nil)),
+	})
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+	srv.render = ctxSleepRender(5 * time.Second)
+
+	start := time.Now()
+	env := fetchError(t, srv.Handler(), "/1/0/1.png", http.StatusServiceUnavailable)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected 503 near the 100ms deadline, got it after %s", elapsed)
+	}
+	if env.Error.Code != codeRenderTimeout {
+		t.Errorf("Expected code %q, got %q", codeRenderTimeout, env.Error.Code)
+	}
+	if stats := srv.RenderStats(); stats.InFlight != 0 {
+		t.Errorf("Expected the render slot released, got %d in flight", stats.InFlight)
+	}
+	if log := logBuf.String(); !strings.Contains(log, "level=WARN") || !strings.Contains(log, "z=1 x=0 y=1") {
+		t.Errorf("Expected a warning with the tile coordinates, got:\n%s", log)
+	}
+
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/1/0/1.png", nil))
+	if w.Header().Get("Retry-After") == "" {
+		t.Error("Expected Retry-After on a timed out render")
+	}
+}
+
+func TestRenderTimeout_RealRender(t *testing.T) {
+	// Large enough that resampling the world tile takes a while
+	basemap := imagery.NewBaseMap(image.NewRGBA(image.Rect(0, 0, 4096, 2048)))
+	render := func(timeout time.Duration) (*Server, int, time.Duration) {
+		t.Helper()
+		srv, err := NewWithBaseMap(basemap, Config{RenderTimeout: timeout, Logger: slog.New(slog.NewTextHandler(io.Discard, nil))})
+		if err != nil {
+			t.Fatalf("NewWithBaseMap() failed: %v", err)
+		}
+		start := time.Now()
+		w := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/0/0/0.png", nil))
+		return srv, w.Code, time.Since(start)
+	}
+
+	_, code, full := render(time.Minute)
+	if code != http.StatusOK {
+		t.Fatalf("Expected 200 without a tight deadline, got %d", code)
+	}
+	srv, code, elapsed := render(time.Millisecond)
+	if code != http.StatusServiceUnavailable {
+		t.Fatalf("Expected 503 once the deadline passed, got %d", code)
+	}
+	if elapsed > full/4 {
+		t.Errorf("Expected the resample abandoned near the deadline, took %s of a %s render", elapsed, full)
+	}
+	if stats := srv.RenderStats(); stats.InFlight != 0 {
+		t.Errorf("Expected the render slot released, got %d in flight", stats.InFlight)
+	}
+}
+
+func TestRenderTimeout_ClientGoneFirst(t *testing.T) {
+	var logBuf syncBuffer
+	srv, err := New(Config{
+		ImagePath:     createTestJPEG(t),
+		RenderTimeout: 5 * time.Second,
+		Logger:        slog.New(slog.NewTextHandler(&logBuf, nil)),
+	})
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+	srv.render = ctxSleepRender(10 * time.Second)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/1/0/1.png", nil).WithContext(ctx))
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected the render to stop when the client went away, took %s", elapsed)
+	}
+	if w.Body.Len() != 0 || strings.Contains(logBuf.String(), "timed out") {
+		t.Errorf("Expected nothing written or logged for a departed client, got %d bytes and log:\n%s", w.Body.Len(), logBuf.String())
+	}
+}
@@ -0,0 +1,94 @@
+package server
+
+import (
+	"image/color"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestRequestID(t *testing.T) {
+	tests := []struct {
+		supplied string
+		echoed   bool
+		name     string
+	}{
+		{"", false, "generated when absent"},
+		{"abc-123_x.y:z", true, "sane ID echoed"},
+		{"has space", false, "invalid characters replaced"},
+		{strings.Repeat("a", maxRequestIDLength+1), false, "overlong ID replaced"},
+	}
+
+	srv, err := NewWithBaseMap(solidBaseMap(color.RGBA{}), Config{})
+	if err != nil {
+		t.Fatalf("NewWithBaseMap() failed: %v", err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/0/0/0.png", nil)
+			if tt.supplied != "" {
+				req.Header.Set(RequestIDHeader, tt.supplied)
+			}
+			w := httptest.NewRecorder()
+			srv.Handler().ServeHTTP(w, req)
+
+			got := w.Header().Get(RequestIDHeader)
+			if tt.echoed && got != tt.supplied {
+				t.Errorf("Expected supplied ID %q to be echoed, got %q", tt.supplied, got)
+			}
+			if !tt.echoed && (got == "" || got == tt.supplied || !validRequestID(got)) {
+				t.Errorf("Expected a generated ID, got %q", got)
+			}
+		})
+	}
+}
+
+func TestRequestID_ErrorResponses(t *testing.T) {
+	srv, err := NewWithBaseMap(solidBaseMap(color.RGBA{}), Config{})
+	if err != nil {
+		t.Fatalf("NewWithBaseMap() failed: %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "/1/5/0.png", nil)
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set(RequestIDHeader, "client-7")
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("Expected status 404, got %d", w.Code)
+	}
+	if got := w.Header().Get(RequestIDHeader); got != "client-7" {
+		t.Errorf("Expected request ID header on error, got %q", got)
+	}
+	if !strings.Contains(w.Body.String(), `"request_id":"client-7"`) {
+		t.Errorf("Expected request ID in error envelope, got %s", w.Body.String())
+	}
+}
+
+func TestRequestID_DistinctPerRequest(t *testing.T) {
+	srv, err := NewWithBaseMap(solidBaseMap(color.RGBA{}), Config{})
+	if err != nil {
+		t.Fatalf("NewWithBaseMap() failed: %v", err)
+	}
+
+	ids := make([]string, 2)
+	var wg sync.WaitGroup
+	for i := range ids {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w := httptest.NewRecorder()
+			srv.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/0/0/0.png", nil))
+			ids[i] = w.Header().Get(RequestIDHeader)
+		}()
+	}
+	wg.Wait()
+
+	if ids[0] == "" || ids[0] == ids[1] {
+		t.Errorf("Expected distinct request IDs, got %q and %q", ids[0], ids[1])
+	}
+}
@@ -0,0 +1,66 @@
+package server
+
+import (
+	"net/http"
+)
+
+// newTileMux returns the routes below the fixed endpoints: tiles at
+// /{z}/{x}/{y}, behind optional /tile, /v/{version} and /{layer} prefixes,
+// and the viewer at "/". Their wildcard segments would conflict with the
+// /assets/ and /admin/ subtrees, so they get a mux of their own, mounted
+// at "/" of the main one.
+//
+// Any other path gets the error a malformed tile path would, or the static
+// site if one is configured, and a method other than GET or HEAD gets 405.
+func (s *Server) newTileMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	for _, prefix := range []string{"", "/v/{version}"} {
+		for _, layer := range []string{"", "/{layer}"} {
+			mux.HandleFunc("GET "+prefix+layer+"/{z}/{x}/{y}", s.handleRootTile)
+			mux.HandleFunc("GET /tile"+prefix+layer+"/{z}/{x}/{y}", s.handleTile)
+		}
+	}
+	mux.HandleFunc("GET /{$}", s.handleRoot)
+	mux.HandleFunc("/", s.handleUnrouted)
+	return mux
+}
+
+// handleTile serves the tile named by the z, x and y path values, of the
+// layer and tileset version in the layer and version values if present
+func (s *Server) handleTile(w http.ResponseWriter, r *http.Request) {
+	if !s.allowRequest(w, r) {
+		return
+	}
+
+	t := tileRequest{layer: s.defLayer, z: r.PathValue("z"), x: r.PathValue("x"), y: r.PathValue("y")}
+	if name := r.PathValue("layer"); name != "" {
+		if t.layer = s.layers[name]; t.layer == nil {
+			writeError(w, r, newAPIError(http.StatusNotFound, codeUnknownLayer, "Tile not found: unknown layer"))
+			return
+		}
+	}
+	if t.version = r.PathValue("version"); t.version != "" {
+		t.versioned = true
+	}
+	s.serveTile(w, r, t)
+}
+
+// handleRootTile is handleTile for tile routes outside /tile/, which the
+// static site, if there is one, serves unless they name a tile
+func (s *Server) handleRootTile(w http.ResponseWriter, r *http.Request) {
+	if s.static != nil && !s.isTilePath(r.URL.Path) {
+		s.static.serve(w, r)
+		return
+	}
+	s.handleTile(w, r)
+}
+
+// handleUnrouted serves requests no other route matches
+func (s *Server) handleUnrouted(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		writeError(w, r, newAPIError(http.StatusMethodNotAllowed, codeMethodNotAllowed, "Method not allowed"))
+		return
+	}
+	s.handleRoot(w, r)
+}
@@ -0,0 +1,142 @@
+package server
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestRoutes_MethodNotAllowed(t *testing.T) {
+	srv, err := NewWithBaseMap(solidBaseMap(color.RGBA{}), Config{})
+	if err != nil {
+		t.Fatalf("NewWithBaseMap() failed: %v", err)
+	}
+
+	tests := []struct {
+		method string
+		path   string
+		name   string
+	}{
+		{"POST", "/1/0/0.png", "tile"},
+		{"PUT", "/tile/1/0/0.png", "tile under /tile/"},
+		{"DELETE", "/v/v1/1/0/0.png", "versioned tile"},
+		{"POST", "/", "viewer"},
+		{"POST", "/tilejson.json", "tilejson"},
+		{"POST", "/preview", "preview"},
+		{"POST", "/assets/leaflet/leaflet.js", "asset"},
+		{"POST", "/unknown", "unrouted"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			req.Header.Set("Accept", "application/json")
+			w := httptest.NewRecorder()
+			srv.Handler().ServeHTTP(w, req)
+			if w.Code != http.StatusMethodNotAllowed {
+				t.Fatalf("Expected status 405, got %d", w.Code)
+			}
+			if allow := w.Header().Get("Allow"); allow != "GET, HEAD" {
+				t.Errorf("Expected Allow %q, got %q", "GET, HEAD", allow)
+			}
+			if !strings.Contains(w.Body.String(), `"code":"method_not_allowed"`) {
+				t.Errorf("Expected a method_not_allowed error, got %s", w.Body.String())
+			}
+		})
+	}
+
+	// HEAD is served wherever GET is
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, httptest.NewRequest("HEAD", "/1/0/0.png", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200 for HEAD, got %d", w.Code)
+	}
+}
+
+func TestRoutes_MethodNotAllowedSkipsRendering(t *testing.T) {
+	srv, err := NewWithBaseMap(solidBaseMap(color.RGBA{}), Config{})
+	if err != nil {
+		t.Fatalf("NewWithBaseMap() failed: %v", err)
+	}
+	var renders atomic.Int64
+	render := srv.render
+	srv.render = func(ctx context.Context, l *layer, z, x, y, size int) (*image.RGBA, error) {
+		renders.Add(1)
+		return render(ctx, l, z, x, y, size)
+	}
+
+	for _, method := range []string{"POST", "PUT", "DELETE", "PATCH", "OPTIONS"} {
+		t.Run(method, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			srv.Handler().ServeHTTP(w, httptest.NewRequest(method, "/1/0/0.png", nil))
+			if w.Code != http.StatusMethodNotAllowed {
+				t.Fatalf("Expected status 405, got %d", w.Code)
+			}
+			if allow := w.Header().Get("Allow"); allow != "GET, HEAD" {
+				t.Errorf("Expected Allow %q, got %q", "GET, HEAD", allow)
+			}
+			if n := renders.Load(); n != 0 {
+				t.Errorf("Expected no tile to be rendered, got %d renders", n)
+			}
+		})
+	}
+
+	// The counter does move for a GET
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/1/0/0.png", nil))
+	if w.Code != http.StatusOK || renders.Load() != 1 {
+		t.Errorf("Expected GET to render once with status 200, got status %d and %d renders", w.Code, renders.Load())
+	}
+}
+
+func TestRoutes_Precedence(t *testing.T) {
+	night := Layer{Name: "night", BaseMap: solidBaseMap(color.RGBA{})}
+	srv, err := NewWithBaseMap(solidBaseMap(color.RGBA{}), Config{TilesetVersion: "v1", Layers: []Layer{night}})
+	if err != nil {
+		t.Fatalf("NewWithBaseMap() failed: %v", err)
+	}
+	withAssets(t, srv, testLeaflet)
+
+	tests := []struct {
+		path        string
+		expectCode  int
+		contentType string
+		name        string
+	}{
+		{"/tilejson.json", http.StatusOK, "application/json", "tilejson"},
+		{"/tiles.ndjson", http.StatusOK, "application/x-ndjson", "coverage"},
+		{"/version", http.StatusOK, "application/json", "version"},
+		{"/preview", http.StatusOK, "text/html; charset=utf-8", "preview"},
+		{"/", http.StatusOK, "text/html; charset=utf-8", "viewer"},
+		{"/assets/leaflet/images/layers.png", http.StatusOK, "image/png", "asset as deep as a layer tile"},
+		{"/1/0/0.png", http.StatusOK, "image/png", "tile"},
+		{"/night/1/0/0.png", http.StatusOK, "image/png", "layer tile"},
+		{"/v/v1/night/1/0/0.png", http.StatusOK, "image/png", "versioned layer tile"},
+		{"/tile/v/v1/night/1/0/0.png", http.StatusOK, "image/png", "versioned layer tile under /tile/"},
+		{"/tile/1/0/0", http.StatusOK, "image/png", "tile without extension"},
+		{"/tilejson.json/0/0", http.StatusBadRequest, "", "tile route shaped like an endpoint"},
+		{"/day/1/0/0.png", http.StatusNotFound, "", "unknown layer"},
+		{"/tile/day/1/0/0.png", http.StatusNotFound, "", "unknown layer under /tile/"},
+		{"/1/0", http.StatusBadRequest, "", "too few segments"},
+		{"/night/1/0/0.png/", http.StatusBadRequest, "", "trailing slash"},
+		{"/1/2/0.png", http.StatusNotFound, "", "out of range"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			srv.Handler().ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+			if w.Code != tt.expectCode {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectCode, w.Code, w.Body.String())
+			}
+			if tt.contentType != "" && !strings.HasPrefix(w.Header().Get("Content-Type"), tt.contentType) {
+				t.Errorf("Expected Content-Type %q, got %q", tt.contentType, w.Header().Get("Content-Type"))
+			}
+		})
+	}
+}
@@ -0,0 +1,272 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+	"time"
+)
+
+// s3DefaultRegion is the region requests are signed for when none is set
+const s3DefaultRegion = "us-east-1"
+
+// s3MaxObjectBytes bounds the size of a tile read from S3
+const s3MaxObjectBytes = 16 << 20
+
+// S3Config configures an S3Cache
+type S3Config struct {
+	Bucket   string
+	Endpoint string // Optional: S3-compatible service addressed path-style, e.g. http://localhost:9000 (default: AWS S3 in Region)
+	Prefix   string // Optional: prepended to every key, e.g. tiles/
+	Region   string // Region requests are signed for (default us-east-1)
+
+	// AccessKeyID and SecretAccessKey sign requests with AWS Signature
+	// Version 4; without them requests are anonymous. SessionToken is sent
+	// with temporary credentials.
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+
+	Client *http.Client // Optional: used instead of http.DefaultClient
+}
+
+// S3Cache is a TileCache storing tiles as objects in an S3 bucket or an
+// S3-compatible object store, so replicas of a server can share rendered
+// tiles. It speaks the GetObject, PutObject and DeleteObject subset of the
+// S3 API over plain HTTP requests.
+type S3Cache struct {
+	cfg    S3Config
+	base   *url.URL // The bucket, with its escaped path in RawPath
+	client *http.Client
+	now    func() time.Time
+}
+
+// NewS3Cache returns an S3Cache for cfg.Bucket. It does not contact the
+// store, so a bucket that cannot be reached shows up as failing lookups.
+func NewS3Cache(cfg S3Config) (*S3Cache, error) {
+	if cfg.Bucket == "" {
+		return nil, errors.New("S3 cache needs a bucket")
+	}
+	if strings.ContainsAny(cfg.Bucket, "/?#") {
+		return nil, fmt.Errorf("invalid S3 bucket name %q", cfg.Bucket)
+	}
+	if (cfg.AccessKeyID == "") != (cfg.SecretAccessKey == "") {
+		return nil, errors.New("S3 cache needs both an access key ID and a secret access key, or neither")
+	}
+	if cfg.Region == "" {
+		cfg.Region = s3DefaultRegion
+	}
+
+	var base *url.URL
+	if cfg.Endpoint == "" {
+		base = &url.URL{Scheme: "https", Host: cfg.Bucket + ".s3." + cfg.Region + ".amazonaws.com"}
+	} else {
+		u, err := url.Parse(cfg.Endpoint)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.RawQuery != "" {
+			return nil, fmt.Errorf("invalid S3 endpoint %q: expected an http or https URL", cfg.Endpoint)
+		}
+		p := strings.TrimSuffix(u.Path, "/") + "/" + cfg.Bucket
+		base = &url.URL{Scheme: u.Scheme, Host: u.Host, Path: p, RawPath: s3Escape(p)}
+	}
+
+	client := cfg.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &S3Cache{cfg: cfg, base: base, client: client, now: time.Now}, nil
+}
+
+// objectURL returns the URL of the object holding key
+func (c *S3Cache) objectURL(key string) *url.URL {
+	p := c.base.Path + "/" + c.cfg.Prefix + key
+	return &url.URL{Scheme: c.base.Scheme, Host: c.base.Host, Path: p, RawPath: s3Escape(p)}
+}
+
+// do sends a signed request for key with body, which may be nil
+func (c *S3Cache) do(ctx context.Context, method, key string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.objectURL(key).String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = int64(len(body))
+	if body != nil {
+		if ct := mime.TypeByExtension(path.Ext(key)); ct != "" {
+			req.Header.Set("Content-Type", ct)
+		}
+	}
+	c.sign(req, body)
+	return c.client.Do(req)
+}
+
+// Get implements TileCache
+func (c *S3Cache) Get(ctx context.Context, key string) ([]byte, error) {
+	resp, err := c.do(ctx, http.MethodGet, key, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, ErrCacheMiss
+	default:
+		return nil, s3Error(resp)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, s3MaxObjectBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > s3MaxObjectBytes {
+		return nil, fmt.Errorf("S3 object %s is larger than %d bytes", key, s3MaxObjectBytes)
+	}
+	return data, nil
+}
+
+// Put implements TileCache
+func (c *S3Cache) Put(ctx context.Context, key string, data []byte) error {
+	if data == nil {
+		data = []byte{}
+	}
+	resp, err := c.do(ctx, http.MethodPut, key, data)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return s3Error(resp)
+	}
+	return nil
+}
+
+// Delete implements TileCache. Deleting a missing object succeeds.
+func (c *S3Cache) Delete(ctx context.Context, key string) error {
+	resp, err := c.do(ctx, http.MethodDelete, key, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusNoContent, http.StatusNotFound:
+		return nil
+	}
+	return s3Error(resp)
+}
+
+// s3Error describes a failed S3 response, including the start of its body,
+// which holds the S3 error code
+func s3Error(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	if msg := strings.TrimSpace(string(body)); msg != "" {
+		return fmt.Errorf("S3 %s %s returned %s: %s", resp.Request.Method, resp.Request.URL.Path, resp.Status, msg)
+	}
+	return fmt.Errorf("S3 %s %s returned %s", resp.Request.Method, resp.Request.URL.Path, resp.Status)
+}
+
+// sign adds the date, payload hash and, with credentials, the Signature
+// Version 4 Authorization header to req
+func (c *S3Cache) sign(req *http.Request, body []byte) {
+	sum := sha256.Sum256(body)
+	req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(sum[:]))
+	req.Header.Set("X-Amz-Date", c.now().UTC().Format("20060102T150405Z"))
+	if c.cfg.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", c.cfg.SessionToken)
+	}
+	if c.cfg.AccessKeyID != "" {
+		req.Header.Set("Authorization", signatureV4(req, c.cfg.Region, c.cfg.AccessKeyID, c.cfg.SecretAccessKey))
+	}
+}
+
+// signatureV4 returns the Authorization header signing req for the s3
+// service in region, covering the host and every header set on req. req must
+// carry X-Amz-Date and X-Amz-Content-Sha256.
+func signatureV4(req *http.Request, region, accessKeyID, secretAccessKey string) string {
+	amzDate := req.Header.Get("X-Amz-Date")
+	scope := amzDate[:8] + "/" + region + "/s3/aws4_request"
+
+	headers := map[string]string{"host": req.URL.Host}
+	if req.Host != "" {
+		headers["host"] = req.Host
+	}
+	for name, values := range req.Header {
+		name = strings.ToLower(name)
+		if name == "authorization" {
+			continue
+		}
+		trimmed := make([]string, len(values))
+		for i, v := range values {
+			trimmed[i] = strings.Join(strings.Fields(v), " ")
+		}
+		headers[name] = strings.Join(trimmed, ",")
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	query := req.URL.Query()
+	params := make([]string, 0, len(query))
+	for k, vs := range query {
+		for _, v := range vs {
+			params = append(params, s3Escape(k)+"="+strings.ReplaceAll(s3Escape(v), "/", "%2F"))
+		}
+	}
+	slices.Sort(params)
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		strings.Join(params, "&"),
+		canonicalHeaders.String(),
+		signedHeaders,
+		req.Header.Get("X-Amz-Content-Sha256"),
+	}, "\n")
+	hash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(hash[:])
+
+	key := []byte("AWS4" + secretAccessKey)
+	for _, part := range []string{amzDate[:8], region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	return "AWS4-HMAC-SHA256 Credential=" + accessKeyID + "/" + scope + ", SignedHeaders=" + signedHeaders + ", Signature=" + signature
+}
+
+// hmacSHA256 returns the HMAC-SHA256 of data under key
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// s3Escape percent-encodes every byte of s except unreserved characters and
+// '/', as S3 expects in signed paths
+func s3Escape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || strings.IndexByte("-._~/", c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
@@ -1,29 +1,407 @@
 package server
 
 import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
-	"image/png"
-	"log"
+	"html/template"
+	"image"
+	"image/color"
+	"image/draw"
+	"io"
+	"log/slog"
+	"math"
+	"net"
 	"net/http"
+	"os"
+	"path"
+	"runtime"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"org.xyzmaps.xyztiles/src/imagery"
+	"org.xyzmaps.xyztiles/src/mbtiles"
 	"org.xyzmaps.xyztiles/src/resources"
+	"org.xyzmaps.xyztiles/src/tilemath"
+	"org.xyzmaps.xyztiles/src/tileprovider"
+	"org.xyzmaps.xyztiles/src/version"
 )
 
 // Server represents the HTTP tile server
 type Server struct {
-	basemap *imagery.BaseMap
-	port    int
-	mux     *http.ServeMux
+	layers     map[string]*layer
+	layerNames []string // Layer names in configuration order, primary first
+	defLayer   *layer   // Layer served at bare /{z}/{x}/{y} paths
+	port       int
+	tcpAddr    string
+	listen     string
+	extraLns   []string    // ExtraListen
+	tlsConfig  *tls.Config // For tls:// listeners; nil if there are none
+	socketMode os.FileMode
+	maxConns   int // MaxConnections; 0 for no limit
+	basePath   string
+	viewer     *template.Template
+	noViewer   bool        // DisableViewer: "/" returns 404
+	noVersion  bool        // HideVersion: /version returns 404
+	embedded   bool        // The primary layer is EmbeddedData
+	static     *staticSite // Site served at "/" instead of the viewer; nil if none
+	overlays   []overlay
+	viewerOpts viewerOptions
+	assets     *viewerAssets // Static viewer assets served under /assets/; nil if none
+	cdn        bool          // LeafletCDN: the viewer loads Leaflet from the CDN
+	logger     *slog.Logger
+	limiter    *rateLimiter
+	signer     *urlSigner // Checks signed tile URLs; nil unless Config.SigningKey is set
+	renders    *renderLimiter
+	renderMax  time.Duration // RenderTimeout: deadline for rendering and encoding a tile
+	overview   image.Point   // OverviewSize; zero when /overview.png is not served
+	background color.Color   // BackgroundColor; nil for transparency
+	// render returns a newly allocated tile, which the caller may draw on
+	render     func(ctx context.Context, l *layer, z, x, y, size int) (*image.RGBA, error)
+	encode     func(w io.Writer, img image.Image, format imagery.Format) error
+	blankTiles map[int]map[imagery.Format][]byte // By tile size; nil unless BlankOnNotFound is set
+	bounds     *tilemath.Bounds                  // nil serves the whole world
+	tileBuffer int                               // TileBuffer: pixels of neighboring tiles added on every side
+	kernels    imagery.KernelTable
+	debug      bool       // DebugHeaders: send X-Tile-Bounds and X-Tile-Size with tiles
+	debugTiles bool       // DebugTiles: draw each tile's border and z/x/y on it
+	cache      *tileCache // nil when caching is disabled
+	vars       serverVars
+	trustProxy bool
+	mux        *http.ServeMux
+	handler    http.Handler
+	admin      http.Handler // Admin API served on adminAddr; nil unless Config.AdminAddr is set
+	adminAddr  string
+
+	versionedURLs bool   // VersionedTileURLs: advertise /v/{version}/ tile URLs
+	fixedVersion  bool   // TilesetVersion is configured rather than derived from the images
+	renderFP      string // renderFingerprint of the config; "" for the default options
+	immutable     bool   // ImmutableTiles: cache every tile response for a year
+
+	export *tileExporter // Writes rendered tiles below Config.ExportDir; nil if not set
+	shared *sharedCache  // Config.CacheStore, CacheS3 or a reachable CacheRedis; nil if none
+
+	mu          sync.Mutex
+	httpServer  *http.Server
+	adminServer *http.Server
+	sockets     []string // Paths of the unix sockets created, removed by Shutdown
+	stopWarm    context.CancelFunc
+	warmDone    chan struct{} // closed when background warming ends
+
+	reloadMu sync.Mutex          // serializes Reload
+	loadOpts imagery.LoadOptions // options Reload loads images with
 }
 
 // Config holds server configuration
 type Config struct {
 	Port         int
+	Host         string      // Optional: interface to bind (hostname, IPv4, or [IPv6]); empty binds all interfaces
+	Listen       string      // Optional: listen address (unix:/path.sock, tcp://host:port, tls://host:port); overrides Port
+	SocketMode   os.FileMode // Permissions for unix domain sockets (default DefaultSocketMode)
 	ImagePath    string
 	EmbeddedData []byte // Optional: embedded image data (overrides ImagePath if set)
+
+	// ExtraListen lists further listen addresses, in the forms Listen
+	// takes, served alongside the first with the same handler: for example
+	// HTTPS for clients next to plain HTTP for health checks. If any
+	// listener fails, the server shuts down on all of them.
+	ExtraListen []string
+
+	// TLSCertFile and TLSKeyFile hold the PEM certificate chain and key that
+	// tls:// listeners serve; TLSConfig, when set, is used instead of them.
+	// They are required with a tls:// listener and refused without one.
+	TLSCertFile string
+	TLSKeyFile  string
+	TLSConfig   *tls.Config
+
+	// MBTilesPath serves the primary layer's tiles from an MBTiles archive
+	// instead of rendering them from an image; ImagePath and EmbeddedData
+	// are then ignored. Tiles are served as stored, in the archive's format,
+	// which becomes the default format unless Formats is set, and in its
+	// zoom range, narrowed by MinZoom and MaxZoom if set. The archive's
+	// attribution is used unless Attribution is set. Rendering options such
+	// as TileBuffer do not apply to its tiles, and Reload leaves it as is.
+	MBTilesPath string
+
+	// Layers are additional base maps served under /{name}/{z}/{x}/{y}
+	// next to the primary image, which is the layer PrimaryLayerName.
+	// DefaultLayer names the layer served at bare /{z}/{x}/{y} paths
+	// (default PrimaryLayerName). Every layer is held in memory.
+	Layers       []Layer
+	DefaultLayer string
+
+	// ProxyURLTemplate, when set, adds the layer ProxyLayerName serving
+	// tiles fetched from an upstream XYZ tile server, such as
+	// https://tile.example.com/{z}/{x}/{y}.png, and cached in memory. Each
+	// upstream request may take up to ProxyTimeout (default
+	// tileprovider.DefaultProxyTimeout). Tiles the upstream server does not
+	// have or does not return in time are 404s, or transparent tiles with
+	// ProxyTransparent.
+	ProxyURLTemplate string
+	ProxyTimeout     time.Duration
+	ProxyTransparent bool
+
+	// Overlays are GeoJSON documents served under /overlays/ and shown by
+	// the viewer. Each may be at most MaxOverlayBytes (default
+	// DefaultMaxOverlayBytes).
+	Overlays        []Overlay
+	MaxOverlayBytes int64
+
+	// MaxImagePixels rejects source images larger than width*height pixels,
+	// checked from the image header before decoding. Zero means no limit.
+	MaxImagePixels int64
+
+	// FlipVertical and FlipHorizontal mirror the source image when it is
+	// loaded, for exports stored upside down or east-west reversed
+	FlipVertical   bool
+	FlipHorizontal bool
+
+	// SourceBounds overrides the full-world extent source images are
+	// assumed to cover, e.g. to correct the sub-pixel shift of imagery
+	// registered on pixel centers. Nil assumes imagery.WorldBounds.
+	SourceBounds *tilemath.Bounds
+
+	BasePath string // Optional: URL prefix all routes are served under, e.g. "/maps"
+
+	// DisableViewer turns off the HTML map viewer so "/" returns 404, for
+	// deployments that only serve the tile API
+	DisableViewer bool
+
+	// ViewerCenter and ViewerZoom set the view the viewer opens at. Without a
+	// center it fits Bounds or shows the whole world; zero ViewerZoom opens
+	// at zoom 2, within the served range. ViewerNoRetina shows tiles at
+	// their full 512 pixels instead of 256, a quarter of the requests but
+	// blurry on high-DPI screens.
+	ViewerCenter   *tilemath.LonLat
+	ViewerZoom     int
+	ViewerNoRetina bool
+
+	// ViewerNoScale hides the viewer's metric and imperial scale bar.
+	// ViewerGraticule adds a latitude/longitude grid to the viewer's layer
+	// control, drawn in the browser with a spacing that follows the zoom.
+	ViewerNoScale   bool
+	ViewerGraticule bool
+
+	// Attribution credits the primary layer's imagery in the viewer's map
+	// and TileJSON. Links (<a href="https://...">text</a>) and character
+	// references are kept; other markup is escaped. Empty shows no credit.
+	Attribution string
+
+	// LeafletCDN makes the viewer load Leaflet from the unpkg CDN even when
+	// a vendored copy is embedded under /assets/leaflet/
+	LeafletCDN bool
+
+	// StaticDir serves the files in this directory at "/", index.html for
+	// directories, in place of the viewer, which moves to /viewer. Tile
+	// paths take precedence over files. SPA additionally answers unknown
+	// non-tile paths with the root index.html, for client-side routing.
+	StaticDir string
+	SPA       bool
+
+	AccessLogWriter io.Writer // Optional: destination for access logs (nil disables access logging)
+	AccessLogFormat string    // Access log format: AccessLogCombined (default), AccessLogCommon or AccessLogJSON
+	TrustProxy      bool      // Derive client IPs and the TileJSON origin from X-Forwarded-* headers
+
+	// SlowRequestThreshold logs a warning for every request that takes
+	// longer than this to handle, breaking a tile request's time down into
+	// cache lookup, render slot wait, rendering and encoding. Zero disables
+	// it.
+	SlowRequestThreshold time.Duration
+
+	// RateLimit limits tile requests per client IP to this many per second,
+	// allowing bursts of up to RateBurst requests (default: RateLimit rounded up).
+	// Zero disables rate limiting.
+	RateLimit float64
+	RateBurst int
+
+	// MaxConcurrentRenders bounds how many tiles are rendered at once
+	// (default GOMAXPROCS). Requests that wait longer than RenderQueueTimeout
+	// (default DefaultRenderQueueTimeout) for a slot get 503 Service Unavailable.
+	MaxConcurrentRenders int
+	RenderQueueTimeout   time.Duration
+
+	// RenderTimeout bounds how long a tile may take to render and encode
+	// (default DefaultRenderTimeout). A request whose render runs over gets
+	// 503 Service Unavailable, freeing its render slot.
+	RenderTimeout time.Duration
+
+	// OverviewSize, when set, serves the primary layer's whole world at
+	// /overview.png as an equirectangular PNG of this width and height,
+	// each at most imagery.MaxOverviewSize
+	OverviewSize image.Point
+
+	// MaxConnections caps the connections the listener holds open at once,
+	// whether TCP, a unix socket or one passed by systemd; further clients
+	// wait in the accept backlog until one closes. Zero means no limit.
+	MaxConnections int
+
+	// BasicAuth protects all routes with HTTP Basic authentication. Each entry
+	// is "user:password" or "user:<bcrypt hash>". Empty disables authentication.
+	BasicAuth []string
+
+	// SigningKey, if set, requires tile, /overview.png and /query requests
+	// to carry a sig and exp query parameter made with this HMAC key by
+	// SignTileURL, SignOverviewURL or SignQueryURL; unsigned, tampered or
+	// expired URLs get 403 Forbidden. Other endpoints, such as the viewer, are not affected.
+	SigningKey string
+
+	// MinZoom and MaxZoom bound the zoom levels served; requests outside the
+	// range get 404. MaxZoom defaults to the base map's native max zoom plus
+	// OverzoomLimit levels of upsampling; nil means DefaultOverzoomLimit, and
+	// a limit of 0 serves no upsampled zooms.
+	// Upsampled tiles carry OverzoomHeader and a shorter cache lifetime.
+	// DisableOverzoom caps the range at the native max zoom instead.
+	MinZoom         int
+	MaxZoom         int
+	OverzoomLimit   *int
+	DisableOverzoom bool
+
+	// CacheMaxBytes enables an in-memory LRU cache of encoded tiles holding up
+	// to this many bytes. Zero disables caching.
+	CacheMaxBytes int64
+
+	// WarmOnStart renders the served zooms up to WarmMaxZoom into the cache
+	// in the background once the server is created, skipping tiles outside
+	// Bounds. Requires CacheMaxBytes.
+	WarmOnStart bool
+	WarmMaxZoom int
+
+	// Admin enables the admin API: POST /admin/cache/flush, GET
+	// /admin/cache/stats and POST /admin/reload. With AdminAddr (a TCP
+	// host:port) it gets a listener of its own, opened by Start, and is not
+	// reachable through the main one; otherwise it is served under /admin/
+	// next to the tiles, which requires BasicAuth. BasicAuth applies to it
+	// either way.
+	Admin     bool
+	AdminAddr string
+
+	// Formats restricts and defaults the tile formats served, for every
+	// layer without formats of its own. The zero value serves every format
+	// with PNG as the default.
+	Formats FormatPolicy
+
+	// JPEGOptions set the quality, chroma subsampling and progressive
+	// encoding of JPEG tiles. Subsampling and progressive encoding need a
+	// libjpeg build (imagery.JPEGExtended); other builds log a warning and
+	// use the standard library encoder.
+	JPEGOptions imagery.JPEGOptions
+
+	// AdaptiveQuality, if set, encodes each JPEG tile at a quality between
+	// its Min and Max chosen from the tile's detail, in place of
+	// JPEGOptions.Quality, saving bytes on flat tiles such as open ocean
+	AdaptiveQuality imagery.AdaptiveQuality
+
+	// BlankOnNotFound serves a transparent tile with 200 instead of 404 for
+	// well-formed tile coordinates outside the tile grid
+	BlankOnNotFound bool
+
+	// Bounds restricts tiles to those intersecting this box; others are
+	// treated like tiles outside the grid (404, or blank with
+	// BlankOnNotFound). Nil serves the whole world.
+	Bounds *tilemath.Bounds
+
+	// TileBuffer adds this many pixels of neighboring tiles on every side of
+	// each tile, so tiles are (512+2*TileBuffer) pixels square. Zero disables.
+	TileBuffer int
+
+	// BackgroundColor fills tile pixels the source image leaves transparent,
+	// as "#rrggbb" or "#rrggbbaa". JPEG tiles have no alpha channel and
+	// otherwise show such pixels as black. Empty keeps them transparent.
+	BackgroundColor string
+
+	// InterpByZoom picks the interpolation kernel tiles are resampled with
+	// by zoom, e.g. a cheaper kernel past the native max zoom where tiles
+	// are upscaled anyway. Nil resamples every zoom with CatmullRom.
+	InterpByZoom imagery.KernelTable
+
+	// CollapseUniformTiles serves tiles whose source pixels are all within
+	// UniformTolerance (default imagery.DefaultUniformTolerance) of each
+	// other in every channel as a single solid color, skipping resampling.
+	// Collapsed tiles keep the full tile size. Not supported with TileBuffer.
+	CollapseUniformTiles bool
+	UniformTolerance     int
+
+	// DebugHeaders adds X-Tile-Bounds (the tile's west,south,east,north in
+	// degrees) and X-Tile-Size (its edge length in pixels) to tile responses
+	DebugHeaders bool
+
+	// DebugTiles draws a 1 pixel border and the z/x/y label on every
+	// rendered tile, showing which tile is which and revealing seams.
+	// Tiles of an MBTiles archive are served as stored.
+	DebugTiles bool
+
+	// DebugVars serves Go's expvar variables, such as memstats, at
+	// /debug/vars, together with the server's counters of tiles served by
+	// zoom, cache hits and misses, time spent rendering and the layers'
+	// base map dimensions. It also serves a summary of the counters as an
+	// HTML page at /stats.
+	DebugVars bool
+
+	// TilesetVersion names the current imagery in tile ETags and in
+	// versioned tile URLs, /v/{version}/{z}/{x}/{y}.png, so caches fetch
+	// fresh tiles once it changes. It may hold up to 64 letters, digits,
+	// '.', '_' and '-'. Empty derives a version per layer from the image
+	// file or embedded data and the options that change tile bytes, such
+	// as JPEGOptions and BackgroundColor, so it changes when Reload loads a
+	// different image or the server restarts with other options; layers
+	// given as preloaded base maps then have none, and their tiles get no
+	// ETag. A configured version stays as it is in URLs, so change it by
+	// hand when rendering options change; ETags and shared cache keys
+	// follow the options either way.
+	TilesetVersion string
+
+	// VersionedTileURLs makes the viewer, TileJSON and preview page request
+	// tiles under /v/{version}/. Versioned paths are accepted either way:
+	// those naming the current version are cached for a year, and older
+	// versions are redirected to the current one.
+	VersionedTileURLs bool
+
+	// ImmutableTiles caches unversioned tile responses for a year too,
+	// marked immutable, so browsers and CDNs never revalidate them. Only
+	// set it with VersionedTileURLs and a fixed TilesetVersion: clients
+	// keep unversioned URLs, and their ETag, until they expire, so a new
+	// image reaches them only through a new version in the URL.
+	ImmutableTiles bool
+
+	// HideVersion makes /version return 404 instead of the build's version,
+	// commit and date, for deployments that do not want to reveal them
+	HideVersion bool
+
+	// ExportDir, when set, records every freshly rendered tile into a static
+	// tile tree below this directory, laid out like the tile URLs, with a
+	// manifest.json. Tiles are written in the background through a bounded
+	// queue; when it is full they are dropped with a warning.
+	ExportDir string
+
+	// CacheStore, when set, is a second tile cache shared by replicas of the
+	// server, such as an S3Cache; CacheS3, when its Bucket is set, or
+	// CacheRedis, when its Addr is set, builds one. Tiles missing from the
+	// memory cache are looked up there before rendering, and rendered tiles
+	// are written to it in the background. Keys include each layer's tileset
+	// version and a fingerprint of the options that change tile bytes, so
+	// layers without a version, such as tile provider layers, are not shared,
+	// and neither replicas nor restarts rendering with other options share
+	// tiles. Failures to reach the store are logged and the tile is rendered.
+	// A Redis server that cannot be reached at startup is logged and the
+	// server runs without it.
+	CacheStore TileCache
+	CacheS3    S3Config
+	CacheRedis RedisConfig
+
+	Logger *slog.Logger // Optional: logger for server events (defaults to slog.Default())
+}
+
+// logger returns the configured logger or the slog default
+func (cfg Config) logger() *slog.Logger {
+	if cfg.Logger != nil {
+		return cfg.Logger
+	}
+	return slog.Default()
 }
 
 // New creates a new tile server with the given configuration
@@ -32,156 +410,1250 @@ func New(cfg Config) (*Server, error) {
 	var err error
 	var source string
 
-	// Load from embedded data if provided, otherwise from file
-	if len(cfg.EmbeddedData) > 0 {
-		basemap, err = imagery.LoadJPEGFromBytes(cfg.EmbeddedData)
+	loadOpts := imagery.LoadOptions{
+		MaxPixels:      cfg.MaxImagePixels,
+		FlipVertical:   cfg.FlipVertical,
+		FlipHorizontal: cfg.FlipHorizontal,
+		SourceBounds:   cfg.SourceBounds,
+	}
+
+	// Open an archive if one is given, else load from embedded data if
+	// provided, otherwise from file
+	var archive *mbtiles.Reader
+	if cfg.MBTilesPath != "" {
+		archive, err = mbtiles.Open(cfg.MBTilesPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open MBTiles archive: %w", err)
+		}
+		minZoom, maxZoom := archive.ZoomRange()
+		cfg.logger().Info("Opened MBTiles archive", "layer", PrimaryLayerName, "format", archive.Format(),
+			"min_zoom", minZoom, "max_zoom", maxZoom, "source", cfg.MBTilesPath)
+	} else if len(cfg.EmbeddedData) > 0 {
+		basemap, err = imagery.LoadImageFromBytes(cfg.EmbeddedData, loadOpts)
 		if err != nil {
 			return nil, fmt.Errorf("failed to load embedded base map: %w", err)
 		}
 		source = fmt.Sprintf("embedded image (%d bytes)", len(cfg.EmbeddedData))
 	} else {
-		basemap, err = imagery.LoadJPEG(cfg.ImagePath)
+		basemap, err = imagery.LoadImage(cfg.ImagePath, loadOpts)
 		if err != nil {
 			return nil, fmt.Errorf("failed to load base map: %w", err)
 		}
 		source = cfg.ImagePath
 	}
 
-	log.Printf("Loaded base map: %dx%d pixels from %s", basemap.Width(), basemap.Height(), source)
+	if basemap != nil {
+		logBaseMap(cfg, PrimaryLayerName, basemap, source)
+	}
+
+	if len(cfg.Layers) > 0 {
+		layers := slices.Clone(cfg.Layers)
+		for i, l := range layers {
+			if l.BaseMap != nil || l.Provider != nil {
+				continue
+			}
+			bm, err := imagery.LoadImage(l.ImagePath, loadOpts)
+			if err != nil {
+				return nil, fmt.Errorf("failed to load layer %q: %w", l.Name, err)
+			}
+			logBaseMap(cfg, l.Name, bm, l.ImagePath)
+			layers[i].BaseMap = bm
+		}
+		cfg.Layers = layers
+	}
+
+	s, err := newServer(basemap, archive, cfg)
+	if err != nil {
+		if archive != nil {
+			archive.Close()
+		}
+		return nil, err
+	}
+
+	// Remember where file-backed layers came from so Reload can load them again
+	s.loadOpts = loadOpts
+	s.embedded = archive == nil && len(cfg.EmbeddedData) > 0
+	if archive == nil && len(cfg.EmbeddedData) == 0 {
+		s.layers[PrimaryLayerName].source = cfg.ImagePath
+	}
+	for _, l := range cfg.Layers {
+		s.layers[l.Name].source = l.ImagePath
+	}
+
+	// Without a configured version, each image's contents and the render
+	// options version its tiles
+	if !s.fixedVersion {
+		switch {
+		case archive != nil:
+			v, err := fileVersion(cfg.MBTilesPath)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read MBTiles archive: %w", err)
+			}
+			v = withRenderOptions(v, s.renderFP)
+			s.layers[PrimaryLayerName].version.Store(&v)
+		case len(cfg.EmbeddedData) > 0:
+			v := withRenderOptions(contentVersion(cfg.EmbeddedData), s.renderFP)
+			s.layers[PrimaryLayerName].version.Store(&v)
+		}
+		for _, name := range s.layerNames {
+			l := s.layers[name]
+			if l.source == "" {
+				continue
+			}
+			v, err := fileVersion(l.source)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read layer %q: %w", name, err)
+			}
+			v = withRenderOptions(v, s.renderFP)
+			l.version.Store(&v)
+		}
+	}
+	return s, nil
+}
+
+// logBaseMap reports a loaded base map and any orientation correction
+func logBaseMap(cfg Config, name string, basemap *imagery.BaseMap, source string) {
+	logger := cfg.logger()
+	logger.Info("Loaded base map", "layer", name, "width", basemap.Width(), "height", basemap.Height(),
+		"memory_bytes", basemap.MemoryBytes(), "source", source)
+
+	if o := basemap.Orientation(); o != 1 {
+		logger.Info("Corrected EXIF orientation of base map", "layer", name, "orientation", o)
+		if cfg.FlipVertical || cfg.FlipHorizontal {
+			logger.Warn("Flip options are applied after the EXIF orientation correction; the image may now be mirrored",
+				"layer", name, "orientation", o, "flip_vertical", cfg.FlipVertical, "flip_horizontal", cfg.FlipHorizontal)
+		}
+	}
+}
+
+// NewWithBaseMap creates a tile server around an already loaded base map.
+// ImagePath, EmbeddedData and the load options in cfg are ignored, and every
+// entry in cfg.Layers must have its BaseMap or Provider set.
+func NewWithBaseMap(basemap *imagery.BaseMap, cfg Config) (*Server, error) {
+	if basemap == nil {
+		return nil, errors.New("base map must not be nil")
+	}
+	return newServer(basemap, nil, cfg)
+}
+
+// newServer creates a tile server whose primary layer is served from
+// archive if it is not nil, and rendered from basemap otherwise
+func newServer(basemap *imagery.BaseMap, archive *mbtiles.Reader, cfg Config) (*Server, error) {
+	tcpAddr, err := tcpListenAddress(cfg.Host, cfg.Port)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig, err := listenTLSConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	basePath, err := normalizeBasePath(cfg.BasePath)
+	if err != nil {
+		return nil, err
+	}
+
+	var accessLog *accessLogger
+	if cfg.AccessLogWriter != nil {
+		accessLog, err = newAccessLogger(cfg.AccessLogWriter, cfg.AccessLogFormat, cfg.TrustProxy)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.RateLimit < 0 || cfg.RateBurst < 0 {
+		return nil, fmt.Errorf("rate limit and burst must not be negative")
+	}
+	var limiter *rateLimiter
+	if cfg.RateLimit > 0 {
+		burst := cfg.RateBurst
+		if burst == 0 {
+			burst = int(math.Ceil(cfg.RateLimit))
+		}
+		limiter = newRateLimiter(cfg.RateLimit, burst)
+	}
+
+	if cfg.SlowRequestThreshold < 0 {
+		return nil, fmt.Errorf("slow request threshold must not be negative, got %v", cfg.SlowRequestThreshold)
+	}
+
+	if cfg.MaxConnections < 0 {
+		return nil, fmt.Errorf("max connections must not be negative, got %d", cfg.MaxConnections)
+	}
+
+	if cfg.MaxConcurrentRenders < 0 || cfg.RenderQueueTimeout < 0 || cfg.RenderTimeout < 0 {
+		return nil, fmt.Errorf("render concurrency and timeouts must not be negative")
+	}
+	maxRenders := cfg.MaxConcurrentRenders
+	if maxRenders == 0 {
+		maxRenders = runtime.GOMAXPROCS(0)
+	}
+	queueTimeout := cfg.RenderQueueTimeout
+	if queueTimeout == 0 {
+		queueTimeout = DefaultRenderQueueTimeout
+	}
+	renderTimeout := cfg.RenderTimeout
+	if renderTimeout == 0 {
+		renderTimeout = DefaultRenderTimeout
+	}
+
+	if err := cfg.JPEGOptions.Validate(); err != nil {
+		return nil, err
+	}
+	if err := cfg.AdaptiveQuality.Validate(); err != nil {
+		return nil, err
+	}
+	if (cfg.JPEGOptions.FullChroma || cfg.JPEGOptions.Progressive) && !imagery.JPEGExtended {
+		cfg.logger().Warn("JPEG chroma and progressive options need a libjpeg build; using the standard encoder")
+	}
+
+	if cfg.TileBuffer < 0 || cfg.TileBuffer > imagery.TileSize {
+		return nil, fmt.Errorf("tile buffer must be in range [0, %d], got %d", imagery.TileSize, cfg.TileBuffer)
+	}
+	if err := cfg.InterpByZoom.Validate(); err != nil {
+		return nil, err
+	}
+	tileOpts := imagery.TileOptions{Buffer: cfg.TileBuffer, Kernels: cfg.InterpByZoom}
+	if cfg.BackgroundColor != "" {
+		bg, err := imagery.ParseHexColor(cfg.BackgroundColor)
+		if err != nil {
+			return nil, fmt.Errorf("invalid background color: %w", err)
+		}
+		tileOpts.Background = bg
+	}
+
+	if o := cfg.OverviewSize; o != (image.Point{}) && (o.X < 1 || o.Y < 1 || o.X > imagery.MaxOverviewSize || o.Y > imagery.MaxOverviewSize) {
+		return nil, fmt.Errorf("overview size must be in range [1, %d] on both sides, got %dx%d", imagery.MaxOverviewSize, o.X, o.Y)
+	}
+
+	var collapse *uniformCollapser
+	if cfg.CollapseUniformTiles {
+		collapse, err = newUniformCollapser(cfg.UniformTolerance, cfg.TileBuffer, tileOpts.Background)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var archiveFormat imagery.Format
+	if archive != nil {
+		if archiveFormat, err = imagery.FormatFromExtension(archive.Format()); err != nil {
+			return nil, fmt.Errorf("unsupported MBTiles archive: %w", err)
+		}
+		if cfg.Formats.Default == "" && len(cfg.Formats.Allowed) == 0 {
+			cfg.Formats = FormatPolicy{Default: archiveFormat, Allowed: []imagery.Format{archiveFormat}}
+		}
+		if cfg.Attribution == "" {
+			cfg.Attribution = archive.Metadata()["attribution"]
+		}
+	}
+
+	formats, err := cfg.Formats.normalize()
+	if err != nil {
+		return nil, err
+	}
+	if archive != nil && formats.Default != archiveFormat {
+		return nil, fmt.Errorf("the default format %s differs from the MBTiles archive's format %s", formats.Default, archiveFormat)
+	}
+
+	if err := validateTilesetVersion(cfg.TilesetVersion); err != nil {
+		return nil, err
+	}
+
+	if cfg.CacheMaxBytes < 0 {
+		return nil, fmt.Errorf("cache size must not be negative")
+	}
+	var cache *tileCache
+	if cfg.CacheMaxBytes > 0 {
+		cache = newTileCache(cfg.CacheMaxBytes)
+	}
+	if cfg.WarmOnStart && cache == nil {
+		return nil, errors.New("cache warming requires a tile cache")
+	}
+
+	if cfg.ProxyURLTemplate != "" {
+		proxy, err := tileprovider.NewProxy(cfg.ProxyURLTemplate, tileprovider.ProxyOptions{
+			Timeout:     cfg.ProxyTimeout,
+			UserAgent:   "xyztiles/" + version.Version,
+			Transparent: cfg.ProxyTransparent,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("invalid tile proxy: %w", err)
+		}
+		cfg.Layers = append(slices.Clone(cfg.Layers), Layer{Name: ProxyLayerName, Provider: proxy})
+	}
+
+	layers, layerNames, defLayer, err := buildLayers(basemap, archive, archiveFormat, formats, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	viewerOpts, err := newViewerOptions(cfg, defLayer)
+	if err != nil {
+		return nil, err
+	}
+
+	var blankTiles map[int]map[imagery.Format][]byte
+	if cfg.BlankOnNotFound {
+		blankTiles, err = encodeBlankTiles(cfg.TileBuffer)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var auth *basicAuth
+	if len(cfg.BasicAuth) > 0 {
+		auth, err = newBasicAuth(cfg.BasicAuth)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.Admin && cfg.AdminAddr != "" {
+		if _, _, err := net.SplitHostPort(cfg.AdminAddr); err != nil {
+			return nil, fmt.Errorf("invalid admin address %q: %w", cfg.AdminAddr, err)
+		}
+	}
+	if cfg.Admin && cfg.AdminAddr == "" && auth == nil {
+		return nil, errors.New("an admin API on the main listener requires basic auth")
+	}
+
+	overlays, err := loadOverlays(cfg.Overlays, cfg.MaxOverlayBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	var static *staticSite
+	if cfg.StaticDir != "" {
+		static, err = newStaticSite(cfg.StaticDir, cfg.SPA)
+		if err != nil {
+			return nil, err
+		}
+	} else if cfg.SPA {
+		return nil, errors.New("SPA fallback requires a static directory")
+	}
+
+	var viewer *template.Template
+	if resources.HasViewerHTML() {
+		viewer, err = template.New("viewer").Parse(resources.ViewerHTML)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse viewer template: %w", err)
+		}
+	}
 
 	s := &Server{
-		basemap: basemap,
-		port:    cfg.Port,
-		mux:     http.NewServeMux(),
+		layers:     layers,
+		layerNames: layerNames,
+		defLayer:   defLayer,
+		port:       cfg.Port,
+		tcpAddr:    tcpAddr,
+		listen:     cfg.Listen,
+		extraLns:   cfg.ExtraListen,
+		tlsConfig:  tlsConfig,
+		socketMode: cfg.SocketMode,
+		maxConns:   cfg.MaxConnections,
+		basePath:   basePath,
+		viewer:     viewer,
+		noViewer:   cfg.DisableViewer,
+		noVersion:  cfg.HideVersion,
+		cdn:        cfg.LeafletCDN,
+		static:     static,
+		overlays:   overlays,
+		viewerOpts: viewerOpts,
+		logger:     cfg.logger(),
+		limiter:    limiter,
+		signer:     newURLSigner(cfg.SigningKey),
+		renders:    newRenderLimiter(maxRenders, queueTimeout),
+		renderMax:  renderTimeout,
+		overview:   cfg.OverviewSize,
+		background: tileOpts.Background,
+		render: func(ctx context.Context, l *layer, z, x, y, size int) (*image.RGBA, error) {
+			if collapse != nil && l.provider == nil {
+				if tile := collapse.solidTile(l.baseMap(), z, x, y, size); tile != nil {
+					return tile, nil
+				}
+			}
+			opts := tileOpts
+			opts.Size = size
+			img, err := l.tiles().Tile(ctx, z, x, y, opts)
+			if err != nil {
+				return nil, err
+			}
+			return toRGBA(img), nil
+		},
+		encode:     imagery.Encoder{JPEG: cfg.JPEGOptions, Adaptive: cfg.AdaptiveQuality}.Encode,
+		blankTiles: blankTiles,
+		bounds:     cfg.Bounds,
+		tileBuffer: cfg.TileBuffer,
+		kernels:    cfg.InterpByZoom,
+		debug:      cfg.DebugHeaders,
+		debugTiles: cfg.DebugTiles,
+		cache:      cache,
+		trustProxy: cfg.TrustProxy,
+		mux:        http.NewServeMux(),
+
+		versionedURLs: cfg.VersionedTileURLs,
+		fixedVersion:  cfg.TilesetVersion != "",
+		renderFP:      renderFingerprint(cfg),
+		immutable:     cfg.ImmutableTiles,
 	}
+	s.vars.started = time.Now()
 
 	// Register handlers
-	s.mux.HandleFunc("/", s.handleRoot)
-	s.mux.HandleFunc("/tile/", s.handleTile)
+	s.mux.Handle("/", s.newTileMux())
+	s.mux.HandleFunc("GET /tilejson.json", s.handleTileJSON)
+	s.mux.HandleFunc("GET /tiles.ndjson", s.handleCoverage)
+	s.mux.HandleFunc("GET /overlays/", s.handleOverlay)
+	s.mux.HandleFunc("GET /preview", s.handlePreview)
+	s.mux.HandleFunc("GET "+queryPath, s.handleQuery)
+	s.mux.HandleFunc("GET /version", s.handleVersion)
+	if s.overview != (image.Point{}) {
+		s.mux.HandleFunc("GET "+overviewPath, s.handleOverview)
+	}
+	if cfg.DebugVars {
+		s.mux.HandleFunc("GET /debug/vars", s.handleDebugVars)
+		s.mux.HandleFunc("GET /stats", s.handleStats)
+	}
+	if !cfg.DisableViewer {
+		if static != nil {
+			s.mux.HandleFunc("GET /viewer", s.handleViewer)
+		}
+		if s.assets, err = newViewerAssets(resources.Assets()); err != nil {
+			return nil, fmt.Errorf("failed to load viewer assets: %w", err)
+		}
+		s.mux.HandleFunc("GET /assets/", s.handleAssets)
+	}
+
+	if cfg.Admin {
+		admin := s.newAdminHandler()
+		if cfg.AdminAddr != "" {
+			if auth != nil {
+				admin = auth.middleware(admin)
+			}
+			s.admin = requestIDMiddleware(s.recoverMiddleware(admin))
+			s.adminAddr = cfg.AdminAddr
+		} else {
+			// Basic auth, required above, wraps the whole main handler
+			s.mux.Handle("/admin/", admin)
+		}
+	}
+
+	s.handler = gzipMiddleware(s.mux)
+	if s.signer != nil {
+		s.handler = s.signer.middleware(s.isSignedPath, s.handler)
+	}
+	if auth != nil {
+		s.handler = auth.middleware(s.handler)
+	}
+
+	if basePath != "" {
+		// Mount everything under the prefix; anything outside it 404s
+		prefixed := http.NewServeMux()
+		prefixed.Handle(basePath+"/", http.StripPrefix(basePath, s.handler))
+		prefixed.HandleFunc(basePath, redirectToSlash)
+		s.handler = prefixed
+	}
+
+	s.handler = s.recoverMiddleware(s.handler)
+	if cfg.SlowRequestThreshold > 0 {
+		s.handler = slowRequestMiddleware(s.handler, cfg.SlowRequestThreshold, s.logger)
+	}
+	if accessLog != nil {
+		s.handler = accessLog.middleware(s.handler)
+	}
+	s.handler = requestIDMiddleware(s.handler)
+
+	store := cfg.CacheStore
+	if (store != nil && cfg.CacheS3.Bucket != "") || (store != nil && cfg.CacheRedis.Addr != "") || (cfg.CacheS3.Bucket != "" && cfg.CacheRedis.Addr != "") {
+		return nil, errors.New("set only one of a shared cache store, an S3 cache and a Redis cache")
+	}
+	if cfg.CacheS3.Bucket != "" {
+		s3, err := NewS3Cache(cfg.CacheS3)
+		if err != nil {
+			return nil, fmt.Errorf("invalid S3 cache: %w", err)
+		}
+		store = s3
+	}
+	var redis *RedisCache
+	if cfg.CacheRedis.Addr != "" {
+		if redis, err = NewRedisCache(cfg.CacheRedis); err != nil {
+			return nil, fmt.Errorf("invalid Redis cache: %w", err)
+		}
+	}
+
+	if cfg.ExportDir != "" {
+		versions := func() map[string]string {
+			v := make(map[string]string, len(s.layers))
+			for name, l := range s.layers {
+				v[name] = l.tilesetVersion()
+			}
+			return v
+		}
+		if s.export, err = newTileExporter(cfg.ExportDir, versions, s.logger); err != nil {
+			return nil, err
+		}
+	}
+
+	// Unlike an S3 bucket, Redis is checked up front: a deployment that
+	// cannot reach it is better off not waiting for it on every tile
+	if redis != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), sharedCacheTimeout)
+		err := redis.Ping(ctx)
+		cancel()
+		if err != nil {
+			s.logger.Warn("Redis tile cache unreachable, using the memory cache only", "addr", cfg.CacheRedis.Addr, "err", err)
+			redis.Close()
+			redis = nil
+		} else {
+			store = redis
+		}
+	}
+
+	// Started last, as its writers run until Shutdown
+	if store != nil {
+		s.shared = newSharedCache(store, s.logger)
+		if redis != nil {
+			s.shared.closer = redis
+		}
+	}
+
+	if cfg.WarmOnStart {
+		s.warmInBackground(cfg.WarmMaxZoom)
+	}
 
 	return s, nil
 }
 
-// Start starts the HTTP server
+// Start opens the configured listeners and serves requests until Shutdown is
+// called. The admin API is started on its own listener if it has one.
 func (s *Server) Start() error {
-	addr := fmt.Sprintf(":%d", s.port)
-	log.Printf("Starting tile server on http://localhost%s", addr)
-	log.Printf("Tile endpoint: http://localhost%s/{z}/{x}/{y}.png", addr)
-	return http.ListenAndServe(addr, s.mux)
+	lns, err := s.ListenAll()
+	if err != nil {
+		return err
+	}
+	return s.StartListeners(lns)
 }
 
-// handleRoot serves the root endpoint with embedded Leaflet viewer
-func (s *Server) handleRoot(w http.ResponseWriter, r *http.Request) {
-	if r.URL.Path != "/" {
-		// Try to parse as tile request
-		s.handleTileRequest(w, r, r.URL.Path)
-		return
+// StartListener is like Start on a listener opened by Listen, so the caller
+// can learn its address before requests are served
+func (s *Server) StartListener(ln net.Listener) error {
+	return s.StartListeners([]net.Listener{ln})
+}
+
+// StartListeners is like StartListener on the listeners opened by ListenAll
+func (s *Server) StartListeners(lns []net.Listener) error {
+	if s.admin != nil {
+		adminLn, err := net.Listen("tcp", s.adminAddr)
+		if err != nil {
+			for _, ln := range lns {
+				ln.Close()
+			}
+			return fmt.Errorf("failed to listen on admin address %s: %w", s.adminAddr, err)
+		}
+		// Register the admin server before serving so Shutdown always sees it
+		adminSrv := &http.Server{Handler: s.admin}
+		s.mu.Lock()
+		s.adminServer = adminSrv
+		s.mu.Unlock()
+		go s.serveAdmin(adminSrv, adminLn)
+	}
+	return s.serve(lns)
+}
+
+// Listen opens the listener described by the configuration without serving
+// requests. A socket passed by systemd socket activation takes precedence
+// over the configured address, and a Listen address over Host and Port. An
+// IPv4 or IPv6 literal host binds that address family only; see tcpNetwork.
+// With MaxConnections set, the listener holds at most that many connections.
+func (s *Server) Listen() (net.Listener, error) {
+	lns, err := s.listenOn([]string{s.listen})
+	if err != nil {
+		return nil, err
 	}
+	return lns[0], nil
+}
 
-	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	w.Header().Set("Cache-Control", "public, max-age=3600") // Cache viewer for 1 hour
+// ListenAll is like Listen, followed by a listener for each ExtraListen
+// address. MaxConnections then limits the connections of all of them
+// together. With socket activation only the socket systemd passed is
+// served.
+func (s *Server) ListenAll() ([]net.Listener, error) {
+	specs := []string{s.listen}
+	if !SocketActivated() {
+		specs = append(specs, s.extraLns...)
+	} else if len(s.extraLns) > 0 {
+		s.logger.Warn("Ignoring extra listen addresses: serving the socket passed by systemd", "addrs", s.extraLns)
+	}
+	return s.listenOn(specs)
+}
 
-	// Serve embedded Leaflet viewer
-	if resources.HasViewerHTML() {
-		fmt.Fprint(w, resources.ViewerHTML)
-	} else {
-		// Fallback to simple HTML if viewer is not embedded
-		fmt.Fprintf(w, `<!DOCTYPE html>
-<html>
-<head>
-    <title>xyztiles - Tile Server</title>
-</head>
-<body>
-    <h1>xyztiles Tile Server</h1>
-    <p>Server is running. Tile endpoint: <code>/{z}/{x}/{y}.png</code></p>
-    <p>Base map: %dx%d pixels</p>
-    <p>Example tiles:</p>
-    <ul>
-        <li><a href="/0/0/0.png">Zoom 0 (world)</a></li>
-        <li><a href="/1/0/0.png">Zoom 1, tile 0,0</a></li>
-        <li><a href="/2/1/1.png">Zoom 2, tile 1,1</a></li>
-    </ul>
-</body>
-</html>`, s.basemap.Width(), s.basemap.Height())
-	}
-}
-
-// handleTile serves tile requests from /tile/{z}/{x}/{y}.png
-func (s *Server) handleTile(w http.ResponseWriter, r *http.Request) {
-	path := strings.TrimPrefix(r.URL.Path, "/tile/")
-	s.handleTileRequest(w, r, "/"+path)
-}
-
-// handleTileRequest processes a tile request from a path like /{z}/{x}/{y}.png
+// listenOn opens a listener for each spec, the first of which may be
+// replaced by socket activation and "" stands for Host and Port. If one
+// fails, those already open are closed.
+func (s *Server) listenOn(specs []string) ([]net.Listener, error) {
+	lns := make([]net.Listener, 0, len(specs))
+	var limit *limitListener
+	for i, spec := range specs {
+		ln, secure, err := s.openListener(spec, i == 0)
+		if err != nil {
+			for _, ln := range lns {
+				ln.Close()
+			}
+			return nil, err
+		}
+		if s.maxConns > 0 {
+			if limit == nil {
+				s.logger.Info("Limiting simultaneous connections", "max_connections", s.maxConns)
+				limit = newLimitListener(ln, s.maxConns, &s.vars.openConns)
+				ln = limit
+			} else {
+				ln = limit.share(ln)
+			}
+		}
+		if secure {
+			ln = &tlsListener{tls.NewListener(ln, s.tlsConfig)}
+		}
+		lns = append(lns, ln)
+	}
+	return lns, nil
+}
+
+// openListener opens the listener for spec without a connection limit or
+// TLS, reporting whether it is to serve TLS. The first listener is the
+// socket passed by systemd, if any.
+func (s *Server) openListener(spec string, first bool) (ln net.Listener, secure bool, err error) {
+	if n := activationFDs(); n > 0 && first {
+		ln, err := activatedListener()
+		if err != nil {
+			return nil, false, err
+		}
+		s.logger.Info("Using socket passed by systemd socket activation", "addr", ln.Addr().String(), "sockets", n)
+		if n > 1 {
+			s.logger.Warn("Serving only the first of the sockets passed by systemd", "sockets", n)
+		}
+		return ln, false, nil
+	}
+
+	network, address := "tcp", s.tcpAddr
+	if spec != "" {
+		network, address, err = parseListenAddress(spec)
+		if err != nil {
+			return nil, false, err
+		}
+	}
+
+	if network == "unix" {
+		ln, err := listenUnix(address, s.socketMode)
+		if err != nil {
+			return nil, false, err
+		}
+		s.mu.Lock()
+		s.sockets = append(s.sockets, address)
+		s.mu.Unlock()
+		return ln, false, nil
+	}
+
+	ln, err = net.Listen(tcpNetwork(address), address)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to listen on %s: %w", address, err)
+	}
+	return ln, network == "tls", nil
+}
+
+// Serve serves requests on ln until Shutdown is called.
+// It returns nil after a graceful shutdown.
+func (s *Server) Serve(ln net.Listener) error {
+	return s.serve([]net.Listener{ln})
+}
+
+// failedListenerDrain bounds how long requests on the other listeners may
+// take to finish when one listener fails
+const failedListenerDrain = 30 * time.Second
+
+// serve serves requests on every listener in lns with one http.Server until
+// Shutdown is called, returning nil after a graceful shutdown. The first
+// listener to fail shuts the server down on all of them, and its error is
+// returned once their requests have drained.
+func (s *Server) serve(lns []net.Listener) error {
+	s.mu.Lock()
+	s.httpServer = &http.Server{Handler: s.handler}
+	srv := s.httpServer
+	s.mu.Unlock()
+
+	for _, ln := range lns {
+		url := listenerURL(ln)
+		if ln.Addr().Network() == "unix" {
+			s.logger.Info("Starting tile server", "addr", url)
+		} else {
+			s.logger.Info("Starting tile server", "addr", url, "tiles", url+s.basePath+"/{z}/{x}/{y}.png")
+		}
+	}
+
+	errs := make(chan error, len(lns))
+	for _, ln := range lns {
+		go func() {
+			err := srv.Serve(ln)
+			if errors.Is(err, http.ErrServerClosed) {
+				err = nil
+			}
+			errs <- err
+		}()
+	}
+
+	var first error
+	for range lns {
+		err := <-errs
+		if err == nil || first != nil {
+			continue
+		}
+		first = err
+		ctx, cancel := context.WithTimeout(context.Background(), failedListenerDrain)
+		if srv.Shutdown(ctx) != nil {
+			srv.Close()
+		}
+		cancel()
+	}
+	return first
+}
+
+// Shutdown gracefully stops the server, waiting for in-flight requests
+// until ctx is done, and removes the unix socket files it created.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	srv := s.httpServer
+	adminSrv := s.adminServer
+	sockets := s.sockets
+	stopWarm := s.stopWarm
+	s.mu.Unlock()
+
+	if stopWarm != nil {
+		stopWarm()
+	}
+
+	var err error
+	if srv != nil {
+		err = srv.Shutdown(ctx)
+	}
+	if adminSrv != nil {
+		if adminErr := adminSrv.Shutdown(ctx); err == nil {
+			err = adminErr
+		}
+	}
+
+	// Requests have drained, so no more tiles are queued for export
+	if s.export != nil {
+		s.export.shutdown()
+	}
+	if s.shared != nil {
+		s.shared.shutdown(ctx)
+	}
+
+	for _, path := range sockets {
+		if rmErr := os.Remove(path); rmErr != nil && !errors.Is(rmErr, os.ErrNotExist) && err == nil {
+			err = fmt.Errorf("failed to remove unix socket %s: %w", path, rmErr)
+		}
+	}
+
+	return err
+}
+
+// handleTileRequest processes a tile request from a path like /{z}/{x}/{y}.png,
+// with optional /v/{version} and /{layer} prefixes. It serves paths the
+// tile routes do not match, so malformed ones get the same errors as tiles.
 func (s *Server) handleTileRequest(w http.ResponseWriter, r *http.Request, path string) {
-	// Parse tile coordinates from path
-	z, x, y, err := parseTilePath(path)
+	if !s.allowRequest(w, r) {
+		return
+	}
+
+	t := tileRequest{}
+	t.version, path, t.versioned = splitVersion(path)
+	l, path, ok := s.resolveLayer(path)
+	if !ok {
+		writeError(w, r, newAPIError(http.StatusNotFound, codeUnknownLayer, "Tile not found: unknown layer"))
+		return
+	}
+	t.layer = l
+
+	var err error
+	if t.z, t.x, t.y, err = splitTilePath(path); err != nil {
+		writeError(w, r, newAPIError(http.StatusBadRequest, codeInvalidTilePath, fmt.Sprintf("Invalid tile path: %v", err)))
+		return
+	}
+	s.serveTile(w, r, t)
+}
+
+// tileRequest is a tile request split into its parts by the router
+type tileRequest struct {
+	layer     *layer
+	version   string // From a /v/{version} prefix
+	versioned bool   // The path had a /v/{version} prefix
+	z, x, y   string // Path segments; y carries any extension
+}
+
+// serveTile validates the coordinates of t and serves the tile. The caller
+// has already applied the rate limit.
+func (s *Server) serveTile(w http.ResponseWriter, r *http.Request, t tileRequest) {
+	l := t.layer
+	z, x, y, ext, err := parseTileSegments(t.z, t.x, t.y)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Invalid tile path: %v", err), http.StatusBadRequest)
+		writeError(w, r, newAPIError(http.StatusBadRequest, codeInvalidTilePath, fmt.Sprintf("Invalid tile path: %v", err)))
+		return
+	}
+
+	// A versioned URL is immutable, so one naming an older version must not
+	// get the current tile; send it to the current URL instead
+	if t.versioned && t.version != l.tilesetVersion() {
+		s.redirectToVersion(w, r, l, "/"+t.z+"/"+t.x+"/"+t.y)
 		return
 	}
 
-	// Extract the tile
-	tile, err := s.basemap.ExtractTile(z, x, y)
+	size, err := parseTileSize(r.URL.Query().Get("size"))
 	if err != nil {
-		log.Printf("Error extracting tile %d/%d/%d: %v", z, x, y, err)
-		http.Error(w, fmt.Sprintf("Failed to generate tile: %v", err), http.StatusNotFound)
+		writeError(w, r, tileError(http.StatusBadRequest, codeInvalidRequest, fmt.Sprintf("Invalid tile request: %v", err), z, x, y))
+		return
+	}
+
+	// An explicit extension is authoritative; otherwise negotiate via Accept
+	var format imagery.Format
+	if ext != "" {
+		format, err = imagery.FormatFromExtension(ext)
+		if err != nil {
+			writeError(w, r, tileError(http.StatusBadRequest, codeInvalidTilePath, fmt.Sprintf("Invalid tile path: %v", err), z, x, y))
+			return
+		}
+		if !l.formats.allows(format) {
+			if !l.formats.Transcode {
+				writeError(w, r, tileError(http.StatusNotAcceptable, codeFormatNotAvailable, fmt.Sprintf("Tile format %s is not available", format), z, x, y))
+				return
+			}
+			format = l.formats.Default
+		}
+	} else {
+		format = l.formats.negotiate(r.Header.Get("Accept"))
+		w.Header().Add("Vary", "Accept")
+	}
+
+	if z < l.minZoom || z > l.maxZoom {
+		writeError(w, r, tileError(http.StatusNotFound, codeZoomNotServed,
+			fmt.Sprintf("Tile not found: zoom %d outside served range %d-%d", z, l.minZoom, l.maxZoom), z, x, y))
+		return
+	}
+
+	if !s.tileInBounds(z, x, y) {
+		if s.blankTiles != nil {
+			s.serveBlankTile(w, format, size)
+		} else {
+			writeError(w, r, tileError(http.StatusNotFound, codeOutsideBounds, "Tile not found: outside served bounds", z, x, y))
+		}
+		return
+	}
+
+	// Tiles are immutable for a given image, so a version-based ETag lets
+	// clients revalidate without the tile being rendered
+	etag := s.tileETag(l, format, size)
+	cacheControl := "public, max-age=86400" // 24 hours
+	if t.versioned || s.immutable {
+		cacheControl = "public, max-age=31536000, immutable" // 1 year
+	} else if z > l.nativeMaxZoom() {
+		// Sharper imagery would replace upsampled tiles, so don't keep them long
+		cacheControl = "public, max-age=3600" // 1 hour
+	}
+	if z > l.nativeMaxZoom() {
+		w.Header().Set(OverzoomHeader, "true")
+	}
+	if etag != "" && etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Cache-Control", cacheControl)
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	timings := requestTimingsFrom(r.Context())
+	timings.tileRequested(l.name, z, x, y)
+
+	if l.archive != nil {
+		s.serveArchiveTile(w, r, l, z, x, y, size, format, etag, cacheControl)
 		return
 	}
 
-	// Set cache headers (tiles are immutable for a given image)
-	w.Header().Set("Content-Type", "image/png")
-	w.Header().Set("Cache-Control", "public, max-age=86400") // 24 hours
+	start := time.Now()
+
+	// Cached tiles skip the render queue entirely
+	var data []byte
+	if s.cache != nil || s.shared != nil {
+		data = s.cachedTile(r.Context(), l, z, x, y, size, format)
+		timings.cacheChecked(data != nil, time.Since(start))
+	}
+
+	if data == nil {
+		// Wait for a render slot so bursts cannot oversubscribe the CPU
+		wait := time.Now()
+		err := s.renders.acquire(r.Context())
+		timings.queued(time.Since(wait))
+		if err != nil {
+			if errors.Is(err, errRenderBusy) {
+				w.Header().Set("Retry-After", "1")
+				writeError(w, r, tileError(http.StatusServiceUnavailable, codeServerBusy, "Server busy, try again later", z, x, y))
+			}
+			return
+		}
+		// Release the slot even if rendering panics. The render deadline and
+		// the client going away both cancel it, whichever comes first.
+		data, err = func() ([]byte, error) {
+			defer s.renders.release()
+			ctx, cancel := context.WithTimeout(r.Context(), s.renderMax)
+			defer cancel()
+			return s.renderTile(ctx, l, z, x, y, size, format)
+		}()
+
+		if err != nil {
+			switch {
+			case r.Context().Err() != nil:
+				// Client went away; nothing to report
+			case errors.Is(err, context.DeadlineExceeded):
+				s.logger.Warn("Tile render timed out", "request_id", requestID(r.Context()), "layer", l.name,
+					"z", z, "x", x, "y", y, "format", format, "elapsed", time.Since(start), "timeout", s.renderMax)
+				w.Header().Set("Retry-After", "1")
+				writeError(w, r, tileError(http.StatusServiceUnavailable, codeRenderTimeout, "Tile render timed out, try again later", z, x, y))
+			case errors.Is(err, imagery.ErrInvalidZoom):
+				writeError(w, r, tileError(http.StatusBadRequest, codeInvalidZoom, fmt.Sprintf("Invalid tile request: %v", err), z, x, y))
+			case errors.Is(err, imagery.ErrOutOfRange) && s.blankTiles != nil:
+				s.serveBlankTile(w, format, size)
+			case errors.Is(err, imagery.ErrOutOfRange):
+				writeError(w, r, tileError(http.StatusNotFound, codeTileOutOfRange, fmt.Sprintf("Tile not found: %v", err), z, x, y))
+			case errors.Is(err, tileprovider.ErrTileNotFound) && s.blankTiles != nil:
+				s.serveBlankTile(w, format, size)
+			case errors.Is(err, tileprovider.ErrTileNotFound):
+				writeError(w, r, tileError(http.StatusNotFound, codeTileNotUpstream, "Tile not found: not available upstream", z, x, y))
+			default:
+				s.logger.Error("Error rendering tile", "request_id", requestID(r.Context()), "layer", l.name,
+					"z", z, "x", x, "y", y, "format", format, "err", err, "duration", time.Since(start))
+				writeError(w, r, tileError(http.StatusInternalServerError, codeRenderFailed, "Failed to generate tile", z, x, y))
+			}
+			return
+		}
+		if s.export != nil {
+			s.export.enqueue(s.exportPath(l, z, x, y, size, format), z, data)
+		}
+	}
+
+	w.Header().Set("Content-Type", format.ContentType())
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Header().Set("Cache-Control", cacheControl)
+	if etag != "" {
+		w.Header().Set("ETag", etag)
+	}
+	s.setDebugHeaders(w, l, z, x, y, size)
+	w.Write(data)
+	s.vars.tileServed(l.name, z, x, y)
+
+	s.logger.Debug("Served tile", "request_id", requestID(r.Context()), "layer", l.name,
+		"z", z, "x", x, "y", y, "format", format, "duration", time.Since(start))
+}
+
+// serveArchiveTile writes a tile of an archive layer as stored, bypassing
+// the cache and the render queue
+func (s *Server) serveArchiveTile(w http.ResponseWriter, r *http.Request, l *layer, z, x, y, size int, format imagery.Format, etag, cacheControl string) {
+	if format != l.format {
+		writeError(w, r, tileError(http.StatusNotAcceptable, codeFormatNotAvailable, fmt.Sprintf("Tile format %s is not available", format), z, x, y))
+		return
+	}
+	if size != imagery.TileSize {
+		writeError(w, r, tileError(http.StatusBadRequest, codeInvalidRequest, fmt.Sprintf("Invalid tile request: tiles of layer %s come in one size", l.name), z, x, y))
+		return
+	}
 
-	// Encode as PNG
-	if err := png.Encode(w, tile); err != nil {
-		log.Printf("Error encoding tile %d/%d/%d: %v", z, x, y, err)
-		http.Error(w, "Failed to encode tile", http.StatusInternalServerError)
+	data, err := l.archive.Tile(z, x, y)
+	switch {
+	case errors.Is(err, mbtiles.ErrTileNotFound) && s.blankTiles != nil:
+		s.serveBlankTile(w, format, size)
 		return
+	case errors.Is(err, mbtiles.ErrTileNotFound):
+		writeError(w, r, tileError(http.StatusNotFound, codeTileNotInArchive, "Tile not found: not in the archive", z, x, y))
+		return
+	case err != nil:
+		s.logger.Error("Error reading tile", "request_id", requestID(r.Context()), "layer", l.name,
+			"z", z, "x", x, "y", y, "err", err)
+		writeError(w, r, tileError(http.StatusInternalServerError, codeRenderFailed, "Failed to read tile", z, x, y))
+		return
+	}
+
+	w.Header().Set("Content-Type", format.ContentType())
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Header().Set("Cache-Control", cacheControl)
+	if etag != "" {
+		w.Header().Set("ETag", etag)
+	}
+	w.Write(data)
+	s.vars.tileServed(l.name, z, x, y)
+}
+
+// encodeBuffers holds scratch buffers for encoding tiles, so steady-state
+// rendering does not regrow a buffer for every tile
+var encodeBuffers = sync.Pool{
+	New: func() any { return new(bytes.Buffer) },
+}
+
+// renderTile renders and encodes a tile of the given size, storing the result
+// in the cache if one is configured. The caller must hold a render slot.
+func (s *Server) renderTile(ctx context.Context, l *layer, z, x, y, size int, format imagery.Format) ([]byte, error) {
+	// Read the cache generation before rendering, so a tile rendered from a
+	// base map that Reload replaces meanwhile is not cached
+	var gen uint64
+	if s.cache != nil {
+		gen = s.cache.generation()
+	}
+	// Likewise the tileset version, so a tile is shared only under the
+	// version of the base map it was rendered from
+	version := l.tilesetVersion()
+
+	start := time.Now()
+	defer func() { s.vars.rendered(time.Since(start)) }()
+
+	timings := requestTimingsFrom(ctx)
+	tile, err := s.render(ctx, l, z, x, y, size)
+	timings.rendered(time.Since(start))
+	if err != nil {
+		return nil, err
+	}
+	if s.debugTiles {
+		imagery.DrawDebugOverlay(tile, tile.Bounds().Inset(s.tileBuffer), fmt.Sprintf("%d/%d/%d", z, x, y))
+	}
+
+	// Skip encoding if the client gave up while the tile was rendering
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	// Encode into a pooled scratch buffer so a failed encode never reaches the
+	// client, then copy out exactly the encoded bytes
+	buf := encodeBuffers.Get().(*bytes.Buffer)
+	buf.Reset()
+	defer encodeBuffers.Put(buf)
+
+	encodeStart := time.Now()
+	err = s.encode(buf, tile, format)
+	timings.encoded(time.Since(encodeStart))
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode tile: %w", err)
 	}
 
-	log.Printf("Served tile: %d/%d/%d", z, x, y)
+	data := bytes.Clone(buf.Bytes())
+	if s.cache != nil {
+		s.cache.addIfCurrent(gen, tileKey(l.name, z, x, y, size, format), data)
+	}
+	if s.shared != nil && version != "" && l.tilesetVersion() == version {
+		s.shared.put(s.sharedKey(l, z, x, y, size, format), data)
+	}
+	return data, nil
 }
 
 // parseTilePath parses a tile path like /1/2/3.png into z, x, y coordinates
-func parseTilePath(path string) (z, x, y int, err error) {
+// and the lowercased file extension (without the dot). The extension is
+// empty when the path has none, e.g. /1/2/3. path must be a decoded URL
+// path without the query, such as r.URL.Path.
+func parseTilePath(path string) (z, x, y int, ext string, err error) {
+	zs, xs, ys, err := splitTilePath(path)
+	if err != nil {
+		return 0, 0, 0, "", err
+	}
+	return parseTileSegments(zs, xs, ys)
+}
+
+// splitTilePath splits a tile path like /1/2/3.png into its three segments
+func splitTilePath(path string) (z, x, y string, err error) {
+	// Bound the work done on crafted paths before splitting them
+	if len(path) > maxTilePathLength {
+		return "", "", "", fmt.Errorf("path is longer than %d bytes", maxTilePathLength)
+	}
+
 	// Remove leading slash
 	path = strings.TrimPrefix(path, "/")
+	if strings.HasSuffix(path, "/") {
+		return "", "", "", fmt.Errorf("expected path format /{z}/{x}/{y}.png without a trailing slash, got %s", path)
+	}
 
-	// Split by /
-	parts := strings.Split(path, "/")
+	// Split by /, into at most one part more than a tile path has
+	parts := strings.SplitN(path, "/", 4)
 	if len(parts) != 3 {
-		return 0, 0, 0, fmt.Errorf("expected path format /{z}/{x}/{y}.png, got %s", path)
+		return "", "", "", fmt.Errorf("expected path format /{z}/{x}/{y}.png, got %s", path)
 	}
+	return parts[0], parts[1], parts[2], nil
+}
 
-	// Parse z
-	z, err = strconv.Atoi(parts[0])
+// parseTileSegments parses the z, x and y segments of a tile path, the last
+// with an optional extension, as parseTilePath does
+func parseTileSegments(zs, xs, ys string) (z, x, y int, ext string, err error) {
+	// Parse z, checking it before any coordinate math is done with it
+	z, err = parseTileNumber(zs)
 	if err != nil {
-		return 0, 0, 0, fmt.Errorf("invalid zoom level: %w", err)
+		return 0, 0, 0, "", fmt.Errorf("invalid zoom level: %w", err)
+	}
+	if z > tilemath.MaxZoom {
+		return 0, 0, 0, "", fmt.Errorf("invalid zoom level: %d exceeds the maximum of %d", z, tilemath.MaxZoom)
 	}
 
 	// Parse x
-	x, err = strconv.Atoi(parts[1])
+	x, err = parseTileNumber(xs)
 	if err != nil {
-		return 0, 0, 0, fmt.Errorf("invalid x coordinate: %w", err)
+		return 0, 0, 0, "", fmt.Errorf("invalid x coordinate: %w", err)
 	}
 
-	// Parse y (remove .png extension)
-	yStr := parts[2]
-	if !strings.HasSuffix(yStr, ".png") {
-		return 0, 0, 0, fmt.Errorf("tile path must end with .png, got %s", yStr)
+	// Split the extension off y
+	yStr := ys
+	if i := strings.LastIndex(yStr, "."); i >= 0 {
+		yStr, ext = yStr[:i], strings.ToLower(yStr[i+1:])
+		if _, err := imagery.FormatFromExtension(ext); err != nil {
+			return 0, 0, 0, "", fmt.Errorf("tile path must end with .png, .jpg or .webp, got %s", ys)
+		}
 	}
-	yStr = strings.TrimSuffix(yStr, ".png")
 
-	y, err = strconv.Atoi(yStr)
+	y, err = parseTileNumber(yStr)
 	if err != nil {
-		return 0, 0, 0, fmt.Errorf("invalid y coordinate: %w", err)
+		return 0, 0, 0, "", fmt.Errorf("invalid y coordinate: %w", err)
 	}
 
-	return z, x, y, nil
+	return z, x, y, ext, nil
+}
+
+// Limits on tile paths, well above anything a valid tile needs: a tile at
+// tilemath.MaxZoom has coordinates of at most 10 digits
+const (
+	maxTilePathLength   = 256
+	maxTileNumberDigits = 12
+)
+
+// parseTileNumber parses a tile path segment made of decimal digits only.
+// strconv.Atoi alone would also take a sign, as in +3 or -1.
+func parseTileNumber(s string) (int, error) {
+	if s == "" {
+		return 0, errors.New("empty path segment")
+	}
+	if len(s) > maxTileNumberDigits {
+		return 0, fmt.Errorf("%.*q... has more than %d digits", maxTileNumberDigits, s, maxTileNumberDigits)
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return 0, fmt.Errorf("%q is not a non-negative decimal number", s)
+		}
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("%q is out of range", s)
+	}
+	return n, nil
 }
 
 // Handler returns the http.Handler for the server (useful for testing)
 func (s *Server) Handler() http.Handler {
-	return s.mux
+	return s.handler
+}
+
+// DefaultOverzoomLimit is how many zoom levels beyond the base map's native
+// resolution are served when Config.MaxZoom is not set
+const DefaultOverzoomLimit = 3
+
+// OverzoomHeader is set to "true" on tiles upsampled beyond the base map's
+// native resolution, which hold no more detail than the native zoom's tiles
+const OverzoomHeader = "X-XYZTiles-Overzoom"
+
+// zoomRange resolves the served zoom range from cfg and the base map
+func zoomRange(cfg Config, basemap *imagery.BaseMap) (minZoom, maxZoom int, err error) {
+	overzoom := DefaultOverzoomLimit
+	if cfg.OverzoomLimit != nil {
+		overzoom = *cfg.OverzoomLimit
+	}
+	if cfg.MinZoom < 0 || cfg.MaxZoom < 0 || overzoom < 0 {
+		return 0, 0, errors.New("zoom limits must not be negative")
+	}
+
+	maxZoom = cfg.MaxZoom
+	if maxZoom == 0 {
+		maxZoom = basemap.NativeMaxZoom() + overzoom
+	}
+	if cfg.DisableOverzoom {
+		maxZoom = min(maxZoom, basemap.NativeMaxZoom())
+	}
+
+	if cfg.MinZoom > maxZoom {
+		return 0, 0, fmt.Errorf("min zoom %d is greater than max zoom %d", cfg.MinZoom, maxZoom)
+	}
+	return cfg.MinZoom, maxZoom, nil
+}
+
+// providerZoomRange returns the zooms served for the tile provider layer
+// name: the configured ones, as a provider has no native resolution to
+// derive a max zoom from. Without a configured max zoom, a provider
+// implementing tileprovider.ZoomRanger supplies it.
+func providerZoomRange(cfg Config, name string, p tileprovider.Provider) (minZoom, maxZoom int, err error) {
+	if cfg.MinZoom < 0 || cfg.MaxZoom < 0 {
+		return 0, 0, errors.New("zoom limits must not be negative")
+	}
+	maxZoom = cfg.MaxZoom
+	if zr, ok := p.(tileprovider.ZoomRanger); ok && maxZoom == 0 {
+		_, maxZoom = zr.ZoomRange()
+	}
+	if maxZoom == 0 {
+		return 0, 0, fmt.Errorf("layer %q has a tile provider, which needs a max zoom to be set", name)
+	}
+	if cfg.MinZoom > maxZoom {
+		return 0, 0, fmt.Errorf("min zoom %d is greater than max zoom %d", cfg.MinZoom, maxZoom)
+	}
+	return cfg.MinZoom, maxZoom, nil
+}
+
+// toRGBA returns img as an *image.RGBA, converting it if needed
+func toRGBA(img image.Image) *image.RGBA {
+	if rgba, ok := img.(*image.RGBA); ok {
+		return rgba
+	}
+	rgba := image.NewRGBA(img.Bounds())
+	draw.Draw(rgba, rgba.Bounds(), img, img.Bounds().Min, draw.Src)
+	return rgba
+}
+
+// archiveZoomRange returns the zooms served from archive: those it stores,
+// narrowed by the configured minimum and maximum zoom if set
+func archiveZoomRange(cfg Config, archive *mbtiles.Reader) (minZoom, maxZoom int, err error) {
+	if cfg.MinZoom < 0 || cfg.MaxZoom < 0 {
+		return 0, 0, errors.New("zoom limits must not be negative")
+	}
+
+	minZoom, maxZoom = archive.ZoomRange()
+	minZoom = max(minZoom, cfg.MinZoom)
+	if cfg.MaxZoom != 0 {
+		maxZoom = min(maxZoom, cfg.MaxZoom)
+	}
+	if minZoom > maxZoom {
+		return 0, 0, fmt.Errorf("zoom range %d-%d does not overlap the MBTiles archive's zooms", cfg.MinZoom, cfg.MaxZoom)
+	}
+	return minZoom, maxZoom, nil
+}
+
+// redirectToSlash permanently redirects a request to the same path with a
+// trailing slash, preserving the query string
+func redirectToSlash(w http.ResponseWriter, r *http.Request) {
+	target := r.URL.Path + "/"
+	if r.URL.RawQuery != "" {
+		target += "?" + r.URL.RawQuery
+	}
+	http.Redirect(w, r, target, http.StatusMovedPermanently)
+}
+
+// normalizeBasePath cleans a URL prefix to the form "/maps" (leading slash,
+// no trailing slash). An empty or "/" prefix yields "".
+func normalizeBasePath(basePath string) (string, error) {
+	if basePath == "" {
+		return "", nil
+	}
+
+	if strings.ContainsAny(basePath, "?#") {
+		return "", fmt.Errorf("invalid base path %q: must not contain a query or fragment", basePath)
+	}
+
+	cleaned := path.Clean("/" + basePath)
+	if cleaned == "/" {
+		return "", nil
+	}
+	return cleaned, nil
 }
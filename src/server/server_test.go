@@ -1,17 +1,27 @@
 package server
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"image"
 	"image/color"
+	"image/draw"
 	"image/jpeg"
 	"image/png"
+	"io"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
+
+	"org.xyzmaps.xyztiles/src/imagery"
+	"org.xyzmaps.xyztiles/src/tilemath"
 )
 
 const testImagePath = "../../res/world.topo.200407.3x5400x2700.jpg"
@@ -41,7 +51,7 @@ func TestNew(t *testing.T) {
 		t.Errorf("Expected port 8080, got %d", srv.port)
 	}
 
-	if srv.basemap == nil {
+	if srv.defLayer == nil {
 		t.Fatal("Server basemap is nil")
 	}
 }
@@ -85,7 +95,7 @@ func TestNew_EmbeddedData(t *testing.T) {
 		t.Fatal("New() returned nil server")
 	}
 
-	if srv.basemap == nil {
+	if srv.defLayer == nil {
 		t.Fatal("Server basemap is nil")
 	}
 
@@ -106,34 +116,521 @@ func TestNew_EmbeddedDataInvalidJPEG(t *testing.T) {
 	}
 }
 
+func TestNew_MaxImagePixels(t *testing.T) {
+	imagePath := createTestJPEG(t) // 360x180
+
+	_, err := New(Config{ImagePath: imagePath, MaxImagePixels: 1000})
+	if !errors.Is(err, imagery.ErrImageTooLarge) {
+		t.Errorf("Expected ErrImageTooLarge, got %v", err)
+	}
+
+	if _, err := New(Config{ImagePath: imagePath, MaxImagePixels: 360 * 180}); err != nil {
+		t.Errorf("Expected image at the limit to load, got %v", err)
+	}
+}
+
+// testArchivePath is a PNG MBTiles archive of zooms 0-5 whose tiles hold
+// "tile z/x/y"; every tile of zooms 0-4 and only 5/0/0 are stored
+const testArchivePath = "../mbtiles/testdata/tiles.mbtiles"
+
+func TestNew_MBTiles(t *testing.T) {
+	srv, err := New(Config{MBTilesPath: testArchivePath})
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+
+	tests := []struct {
+		path        string
+		expectCode  int
+		expectBody  string
+		contentType string
+		name        string
+	}{
+		{"/0/0/0.png", http.StatusOK, "tile 0/0/0", "image/png", "root tile"},
+		{"/3/2/5.png", http.StatusOK, "tile 3/2/5", "image/png", "rows flipped from TMS"},
+		{"/tile/4/15/0", http.StatusOK, "tile 4/15/0", "image/png", "archive format by default"},
+		{"/5/1/0.png", http.StatusNotFound, "tile_not_in_archive", "", "not stored"},
+		{"/6/0/0.png", http.StatusNotFound, "zoom_not_served", "", "above the stored zooms"},
+		{"/1/0/0.jpg", http.StatusNotAcceptable, "format_not_available", "", "other format"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.path, nil)
+			req.Header.Set("Accept", "application/json")
+			w := httptest.NewRecorder()
+			srv.Handler().ServeHTTP(w, req)
+			if w.Code != tt.expectCode {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectCode, w.Code, w.Body.String())
+			}
+			if !strings.Contains(w.Body.String(), tt.expectBody) {
+				t.Errorf("Expected body containing %q, got %q", tt.expectBody, w.Body.String())
+			}
+			if tt.contentType != "" && w.Header().Get("Content-Type") != tt.contentType {
+				t.Errorf("Expected Content-Type %q, got %q", tt.contentType, w.Header().Get("Content-Type"))
+			}
+		})
+	}
+
+	// The archive's metadata describes the tileset
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/tilejson.json", nil))
+	var doc tileJSON
+	if err := json.NewDecoder(w.Body).Decode(&doc); err != nil {
+		t.Fatalf("Failed to decode TileJSON: %v", err)
+	}
+	if doc.MinZoom != 0 || doc.MaxZoom != 5 {
+		t.Errorf("Expected zooms 0-5, got %d-%d", doc.MinZoom, doc.MaxZoom)
+	}
+	if doc.Attribution != "Test data" {
+		t.Errorf("Expected the archive's attribution, got %q", doc.Attribution)
+	}
+	if len(doc.Tiles) != 1 || !strings.HasSuffix(doc.Tiles[0], ".png") {
+		t.Errorf("Expected PNG tile URLs, got %v", doc.Tiles)
+	}
+}
+
+func TestNew_MBTilesConfig(t *testing.T) {
+	tests := []struct {
+		cfg           Config
+		expectErr     bool
+		expectMinZoom int
+		expectMaxZoom int
+		name          string
+	}{
+		{Config{MinZoom: 2, MaxZoom: 4}, false, 2, 4, "zooms narrowed"},
+		{Config{MaxZoom: 12}, false, 0, 5, "zooms not widened"},
+		{Config{MinZoom: 6}, true, 0, 0, "no stored zooms"},
+		{Config{Formats: FormatPolicy{Default: imagery.FormatJPEG}}, true, 0, 0, "other default format"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.MBTilesPath = testArchivePath
+			srv, err := New(tt.cfg)
+			if tt.expectErr {
+				if err == nil {
+					t.Fatal("Expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("New() failed: %v", err)
+			}
+			if l := srv.defLayer; l.minZoom != tt.expectMinZoom || l.maxZoom != tt.expectMaxZoom {
+				t.Errorf("Expected zooms %d-%d, got %d-%d", tt.expectMinZoom, tt.expectMaxZoom, l.minZoom, l.maxZoom)
+			}
+		})
+	}
+}
+
+func TestNewWithBaseMap(t *testing.T) {
+	// Synthetic solid-red world map
+	img := image.NewRGBA(image.Rect(0, 0, 360, 180))
+	red := color.RGBA{R: 255, A: 255}
+	for y := 0; y < 180; y++ {
+		for x := 0; x < 360; x++ {
+			img.SetRGBA(x, y, red)
+		}
+	}
+
+	srv, err := NewWithBaseMap(imagery.NewBaseMap(img), Config{Port: 9090})
+	if err != nil {
+		t.Fatalf("NewWithBaseMap() failed: %v", err)
+	}
+
+	if srv.port != 9090 {
+		t.Errorf("Expected port 9090, got %d", srv.port)
+	}
+
+	req := httptest.NewRequest("GET", "/1/1/0.png", nil)
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+
+	tile, err := png.Decode(w.Body)
+	if err != nil {
+		t.Fatalf("Failed to decode PNG: %v", err)
+	}
+
+	r, g, b, _ := tile.At(256, 256).RGBA()
+	if r>>8 != 255 || g>>8 != 0 || b>>8 != 0 {
+		t.Errorf("Expected red tile center, got (%d, %d, %d)", r>>8, g>>8, b>>8)
+	}
+}
+
+func TestHandleTile_TileBuffer(t *testing.T) {
+	srv, err := New(Config{ImagePath: createTestJPEG(t), TileBuffer: 8})
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "/1/0/0.png", nil)
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+
+	tile, err := png.Decode(w.Body)
+	if err != nil {
+		t.Fatalf("Failed to decode PNG: %v", err)
+	}
+	if b := tile.Bounds(); b.Dx() != 528 || b.Dy() != 528 {
+		t.Errorf("Expected 528x528 buffered tile, got %dx%d", b.Dx(), b.Dy())
+	}
+
+	if _, err := New(Config{ImagePath: createTestJPEG(t), TileBuffer: -1}); err == nil {
+		t.Error("Expected error for negative tile buffer, got nil")
+	}
+}
+
+func TestHandleTile_ZoomLimits(t *testing.T) {
+	srv, err := New(Config{ImagePath: createTestJPEG(t), MinZoom: 1, MaxZoom: 3})
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+
+	tests := []struct {
+		path       string
+		expectCode int
+		name       string
+	}{
+		{"/0/0/0.png", http.StatusNotFound, "below min zoom"},
+		{"/1/0/0.png", http.StatusOK, "at min zoom"},
+		{"/3/7/7.png", http.StatusOK, "at max zoom"},
+		{"/4/0/0.png", http.StatusNotFound, "above max zoom"},
+		{"/-1/0/0.png", http.StatusBadRequest, "negative zoom"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			srv.Handler().ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+			if w.Code != tt.expectCode {
+				t.Errorf("Expected status %d, got %d", tt.expectCode, w.Code)
+			}
+		})
+	}
+
+	// Clients are told the same limits
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/tilejson.json", nil))
+	var doc tileJSON
+	if err := json.NewDecoder(w.Body).Decode(&doc); err != nil {
+		t.Fatalf("Failed to decode TileJSON: %v", err)
+	}
+	if doc.MinZoom != 1 || doc.MaxZoom != 3 {
+		t.Errorf("Expected TileJSON zoom range 1-3, got %d-%d", doc.MinZoom, doc.MaxZoom)
+	}
+
+	w = httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	body := w.Body.String()
+	if minZoom := viewerConst(t, body, "minZoom"); minZoom != float64(1) {
+		t.Errorf("Expected viewer min zoom 1, got %v", minZoom)
+	}
+	if !strings.Contains(body, "<strong>Zoom Levels:</strong> 1-3") {
+		t.Error("Expected viewer to advertise zoom range 1-3")
+	}
+}
+
+func TestHandleTile_Overzoom(t *testing.T) {
+	// A 512x256 image has full detail only at zoom 0
+	img := image.NewRGBA(image.Rect(0, 0, 512, 256))
+	draw.Draw(img, img.Bounds(), &image.Uniform{color.RGBA{0, 128, 0, 255}}, image.Point{}, draw.Src)
+	bm := imagery.NewBaseMap(img)
+
+	tests := []struct {
+		cfg                Config
+		path               string
+		expectCode         int
+		expectOverzoom     bool
+		expectCacheControl string
+		name               string
+	}{
+		{Config{}, "/0/0/0.png", http.StatusOK, false, "public, max-age=86400", "native zoom"},
+		{Config{}, "/1/0/0.png", http.StatusOK, true, "public, max-age=3600", "first upsampled zoom"},
+		{Config{}, "/3/7/7.png", http.StatusOK, true, "public, max-age=3600", "at overzoom limit"},
+		{Config{}, "/4/0/0.png", http.StatusNotFound, false, "", "past overzoom limit"},
+		{Config{OverzoomLimit: overzoomLimit(1)}, "/2/0/0.png", http.StatusNotFound, false, "", "past custom overzoom limit"},
+		{Config{ImmutableTiles: true}, "/2/0/0.png", http.StatusOK, true, "public, max-age=31536000, immutable", "immutable tiles keep their lifetime"},
+		{Config{DisableOverzoom: true}, "/0/0/0.png", http.StatusOK, false, "public, max-age=86400", "native zoom without overzoom"},
+		{Config{DisableOverzoom: true}, "/1/0/0.png", http.StatusNotFound, false, "", "overzoom disabled"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, err := NewWithBaseMap(bm, tt.cfg)
+			if err != nil {
+				t.Fatalf("NewWithBaseMap() failed: %v", err)
+			}
+			w := httptest.NewRecorder()
+			srv.Handler().ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+			if w.Code != tt.expectCode {
+				t.Fatalf("Expected status %d, got %d", tt.expectCode, w.Code)
+			}
+			if overzoom := w.Header().Get(OverzoomHeader) == "true"; overzoom != tt.expectOverzoom {
+				t.Errorf("Expected %s: %v, got %q", OverzoomHeader, tt.expectOverzoom, w.Header().Get(OverzoomHeader))
+			}
+			if tt.expectCode == http.StatusOK && w.Header().Get("Cache-Control") != tt.expectCacheControl {
+				t.Errorf("Expected Cache-Control %q, got %q", tt.expectCacheControl, w.Header().Get("Cache-Control"))
+			}
+		})
+	}
+
+	// Clients are told where native detail ends
+	srv, err := NewWithBaseMap(bm, Config{})
+	if err != nil {
+		t.Fatalf("NewWithBaseMap() failed: %v", err)
+	}
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/tilejson.json", nil))
+	var doc tileJSON
+	if err := json.NewDecoder(w.Body).Decode(&doc); err != nil {
+		t.Fatalf("Failed to decode TileJSON: %v", err)
+	}
+	if doc.NativeMaxZoom != 0 || doc.MaxZoom != DefaultOverzoomLimit {
+		t.Errorf("Expected native max zoom 0 of 0-%d, got %d of %d-%d", DefaultOverzoomLimit, doc.NativeMaxZoom, doc.MinZoom, doc.MaxZoom)
+	}
+
+	w = httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if !strings.Contains(w.Body.String(), "upsampled past 0,") {
+		t.Error("Expected viewer to advertise the native max zoom")
+	}
+}
+
+func TestHandleTile_ContentLength(t *testing.T) {
+	srv, err := New(Config{ImagePath: createTestJPEG(t)})
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+
+	for _, method := range []string{"GET", "HEAD"} {
+		t.Run(method, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			srv.Handler().ServeHTTP(w, httptest.NewRequest(method, "/1/0/0.png", nil))
+			if w.Code != http.StatusOK {
+				t.Fatalf("Expected status 200, got %d", w.Code)
+			}
+
+			length := w.Header().Get("Content-Length")
+			if length == "" || length == "0" {
+				t.Fatalf("Expected a Content-Length, got %q", length)
+			}
+			if method == "GET" && length != fmt.Sprint(w.Body.Len()) {
+				t.Errorf("Content-Length %s does not match body size %d", length, w.Body.Len())
+			}
+		})
+	}
+}
+
+func TestHandleTile_EncodeFailure(t *testing.T) {
+	srv, err := New(Config{ImagePath: createTestJPEG(t)})
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+
+	// Fail after part of the tile has been written
+	srv.encode = func(w io.Writer, img image.Image, format imagery.Format) error {
+		w.Write([]byte("\x89PNG partial"))
+		return errors.New("encoder exploded")
+	}
+
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/0/0/0.png", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("Expected status 500, got %d", w.Code)
+	}
+	if strings.Contains(w.Body.String(), "PNG partial") {
+		t.Error("Partially encoded tile leaked into the response")
+	}
+	if ct := w.Header().Get("Content-Type"); strings.HasPrefix(ct, "image/") {
+		t.Errorf("Expected an error response, got Content-Type %s", ct)
+	}
+}
+
+// overzoomLimit returns a Config.OverzoomLimit of n levels
+func overzoomLimit(n int) *int {
+	return &n
+}
+
+func TestZoomRange(t *testing.T) {
+	// 1024px wide: native max zoom 1
+	basemap := imagery.NewBaseMap(image.NewRGBA(image.Rect(0, 0, 1024, 512)))
+
+	tests := []struct {
+		cfg         Config
+		expectMin   int
+		expectMax   int
+		expectError bool
+		name        string
+	}{
+		{Config{}, 0, 1 + DefaultOverzoomLimit, false, "native plus default overzoom"},
+		{Config{OverzoomLimit: overzoomLimit(1)}, 0, 2, false, "custom overzoom"},
+		{Config{OverzoomLimit: overzoomLimit(0)}, 0, 1, false, "no overzoom"},
+		{Config{MinZoom: 1, MaxZoom: 8}, 1, 8, false, "explicit range"},
+		{Config{DisableOverzoom: true}, 0, 1, false, "overzoom disabled"},
+		{Config{MaxZoom: 8, DisableOverzoom: true}, 0, 1, false, "overzoom disabled caps explicit max"},
+		{Config{MinZoom: 5, MaxZoom: 4}, 0, 0, true, "min above max"},
+		{Config{MinZoom: -1}, 0, 0, true, "negative min"},
+		{Config{OverzoomLimit: overzoomLimit(-1)}, 0, 0, true, "negative overzoom"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			minZoom, maxZoom, err := zoomRange(tt.cfg, basemap)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Expected error, got %d-%d", minZoom, maxZoom)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("zoomRange() failed: %v", err)
+			}
+			if minZoom != tt.expectMin || maxZoom != tt.expectMax {
+				t.Errorf("Expected %d-%d, got %d-%d", tt.expectMin, tt.expectMax, minZoom, maxZoom)
+			}
+		})
+	}
+}
+
+func TestNewWithBaseMap_Nil(t *testing.T) {
+	if _, err := NewWithBaseMap(nil, Config{}); err == nil {
+		t.Error("Expected error for nil base map, got nil")
+	}
+}
+
+func TestNewWithBaseMap_JPEGOptions(t *testing.T) {
+	if _, err := NewWithBaseMap(solidBaseMap(color.RGBA{}), Config{JPEGOptions: imagery.JPEGOptions{Quality: 101}}); err == nil {
+		t.Error("Expected error for JPEG quality 101, got nil")
+	}
+
+	srv, err := NewWithBaseMap(solidBaseMap(color.RGBA{0, 128, 255, 255}), Config{
+		JPEGOptions: imagery.JPEGOptions{Quality: 60, FullChroma: true, Progressive: true},
+		TileBuffer:  8,
+		Logger:      slog.New(&recordingHandler{}),
+	})
+	if err != nil {
+		t.Fatalf("NewWithBaseMap() failed: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/1/0/0.jpg", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	img, err := jpeg.Decode(w.Body)
+	if err != nil {
+		t.Fatalf("Failed to decode JPEG tile: %v", err)
+	}
+	if size := img.Bounds().Dx(); size != imagery.TileSize+16 {
+		t.Errorf("Expected a %d pixel tile, got %d", imagery.TileSize+16, size)
+	}
+}
+
+func TestNewWithBaseMap_AdaptiveQuality(t *testing.T) {
+	if _, err := NewWithBaseMap(solidBaseMap(color.RGBA{}), Config{AdaptiveQuality: imagery.AdaptiveQuality{Min: 90, Max: 60}}); err == nil {
+		t.Error("Expected error for a reversed adaptive quality range, got nil")
+	}
+
+	// A flat tile is encoded at the low end of the range
+	tileSize := func(cfg Config) int {
+		srv, err := NewWithBaseMap(gradientBaseMap(), cfg)
+		if err != nil {
+			t.Fatalf("NewWithBaseMap() failed: %v", err)
+		}
+		w := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/2/1/1.jpg", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", w.Code)
+		}
+		return w.Body.Len()
+	}
+	fixed := tileSize(Config{JPEGOptions: imagery.JPEGOptions{Quality: 95}})
+	adaptive := tileSize(Config{JPEGOptions: imagery.JPEGOptions{Quality: 95}, AdaptiveQuality: imagery.AdaptiveQuality{Min: 20, Max: 95}})
+	if adaptive >= fixed {
+		t.Errorf("Expected the adaptive tile to be smaller than at quality 95, got %d and %d bytes", adaptive, fixed)
+	}
+}
+
+// gradientBaseMap returns a base map shading gently from west to east, with
+// too little detail for adaptive JPEG quality to raise the quality
+func gradientBaseMap() *imagery.BaseMap {
+	img := image.NewRGBA(image.Rect(0, 0, 1024, 512))
+	for y := range 512 {
+		for x := range 1024 {
+			v := uint8(80 + x/64)
+			img.SetRGBA(x, y, color.RGBA{v, v + 20, v + 60, 255})
+		}
+	}
+	return imagery.NewBaseMap(img)
+}
+
 func TestParseTilePath(t *testing.T) {
 	tests := []struct {
 		path        string
 		expectZ     int
 		expectX     int
 		expectY     int
+		expectExt   string
 		expectError bool
 		name        string
 	}{
-		{"/0/0/0.png", 0, 0, 0, false, "zoom 0"},
-		{"/1/0/0.png", 1, 0, 0, false, "zoom 1"},
-		{"/5/10/15.png", 5, 10, 15, false, "zoom 5"},
-		{"/12/2048/1024.png", 12, 2048, 1024, false, "zoom 12"},
-		{"0/0/0.png", 0, 0, 0, false, "no leading slash"},
+		{"/0/0/0.png", 0, 0, 0, "png", false, "zoom 0"},
+		{"/1/0/0.png", 1, 0, 0, "png", false, "zoom 1"},
+		{"/5/10/15.png", 5, 10, 15, "png", false, "zoom 5"},
+		{"/12/2048/1024.png", 12, 2048, 1024, "png", false, "zoom 12"},
+		{"0/0/0.png", 0, 0, 0, "png", false, "no leading slash"},
+		{"/0/0/0.jpg", 0, 0, 0, "jpg", false, "jpg extension"},
+		{"/0/0/0.jpeg", 0, 0, 0, "jpeg", false, "jpeg extension"},
+		{"/0/0/0.webp", 0, 0, 0, "webp", false, "webp extension"},
+		{"/0/0/0", 0, 0, 0, "", false, "no extension"},
+		{"/3/4/2.PNG", 3, 4, 2, "png", false, "uppercase extension"},
+		{"/3/4/2.JpEg", 3, 4, 2, "jpeg", false, "mixed case extension"},
+		{"/03/004/2.png", 3, 4, 2, "png", false, "leading zeros"},
+		{"/30/1073741823/0.png", 30, 1073741823, 0, "png", false, "max zoom"},
 
 		// Error cases
-		{"/0/0.png", 0, 0, 0, true, "missing coordinate"},
-		{"/0/0/0/0.png", 0, 0, 0, true, "too many parts"},
-		{"/a/0/0.png", 0, 0, 0, true, "invalid z"},
-		{"/0/b/0.png", 0, 0, 0, true, "invalid x"},
-		{"/0/0/c.png", 0, 0, 0, true, "invalid y"},
-		{"/0/0/0.jpg", 0, 0, 0, true, "wrong extension"},
-		{"/0/0/0", 0, 0, 0, true, "no extension"},
+		{"/0/0.png", 0, 0, 0, "", true, "missing coordinate"},
+		{"/0/0/0/0.png", 0, 0, 0, "", true, "too many parts"},
+		{"/a/0/0.png", 0, 0, 0, "", true, "invalid z"},
+		{"/0/b/0.png", 0, 0, 0, "", true, "invalid x"},
+		{"/0/0/c.png", 0, 0, 0, "", true, "invalid y"},
+		{"/0/0/0.gif", 0, 0, 0, "", true, "unsupported extension"},
+		{"/3/4/2.png/", 0, 0, 0, "", true, "trailing slash"},
+		{"/3/4/", 0, 0, 0, "", true, "empty y"},
+		{"/3//2.png", 0, 0, 0, "", true, "empty x"},
+		{"//4/2.png", 0, 0, 0, "", true, "empty z"},
+		{"/3/4/.png", 0, 0, 0, "", true, "extension only"},
+		{"/3/4/2.", 0, 0, 0, "", true, "empty extension"},
+		{"/+3/4/2.png", 0, 0, 0, "", true, "leading plus"},
+		{"/-1/0/0.png", 0, 0, 0, "", true, "negative zoom"},
+		{"/3/-4/2.png", 0, 0, 0, "", true, "negative x"},
+		{"/3/0x4/2.png", 0, 0, 0, "", true, "hex x"},
+		{"/3/4/ 2.png", 0, 0, 0, "", true, "leading space"},
+		{"/3/4/2 .png", 0, 0, 0, "", true, "trailing space"},
+		{"/3/1_0/2.png", 0, 0, 0, "", true, "underscore"},
+		{"/3/٤/2.png", 0, 0, 0, "", true, "non-ASCII digit"},
+		{"/31/0/0.png", 0, 0, 0, "", true, "zoom above 30"},
+		{"/99999999999999999999/0/0.png", 0, 0, 0, "", true, "zoom overflow"},
+		{"/3/99999999999999999999/2.png", 0, 0, 0, "", true, "x overflow"},
+		{"/3/4/2.png?foo=bar", 0, 0, 0, "", true, "query in path"},
+		{"/64/0/0.png", 0, 0, 0, "", true, "zoom that would overflow 1<<z"},
+		{"/3/0000000000004/2.png", 0, 0, 0, "", true, "too many digits"},
+		{"/3/4/" + strings.Repeat("0", 300) + "2.png", 0, 0, 0, "", true, "absurdly long y"},
+		{strings.Repeat("/3", 10000) + "/4/2.png", 0, 0, 0, "", true, "absurdly many slashes"},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			z, x, y, err := parseTilePath(tt.path)
+			z, x, y, ext, err := parseTilePath(tt.path)
 
 			if tt.expectError {
 				if err == nil {
@@ -146,9 +643,69 @@ func TestParseTilePath(t *testing.T) {
 				t.Fatalf("Unexpected error: %v", err)
 			}
 
-			if z != tt.expectZ || x != tt.expectX || y != tt.expectY {
-				t.Errorf("parseTilePath(%s) = (%d, %d, %d), expected (%d, %d, %d)",
-					tt.path, z, x, y, tt.expectZ, tt.expectX, tt.expectY)
+			if z != tt.expectZ || x != tt.expectX || y != tt.expectY || ext != tt.expectExt {
+				t.Errorf("parseTilePath(%s) = (%d, %d, %d, %q), expected (%d, %d, %d, %q)",
+					tt.path, z, x, y, ext, tt.expectZ, tt.expectX, tt.expectY, tt.expectExt)
+			}
+		})
+	}
+}
+
+func FuzzParseTilePath(f *testing.F) {
+	for _, seed := range []string{
+		"/0/0/0.png", "/3/4/2.PNG", "/12/2048/1024.webp", "/3/4/2", "/3/4/2.png/",
+		"/+3/4/2.png", "/3/0x4/2.png", "/31/0/0.png", "/3/4/2.png?foo=bar", "",
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, path string) {
+		z, x, y, ext, err := parseTilePath(path)
+		if err != nil {
+			return
+		}
+		if z < 0 || z > tilemath.MaxZoom || x < 0 || y < 0 {
+			t.Fatalf("parseTilePath(%q) accepted out-of-range z/x/y %d/%d/%d", path, z, x, y)
+		}
+
+		// Accepted paths round-trip through their canonical form
+		canonical := tilemath.TileCoord{Z: z, X: x, Y: y}.Path(ext)
+		z2, x2, y2, ext2, err := parseTilePath(canonical)
+		if err != nil {
+			t.Fatalf("parseTilePath(%q) failed for the canonical form of %q: %v", canonical, path, err)
+		}
+		if z2 != z || x2 != x || y2 != y || ext2 != ext {
+			t.Fatalf("%q parsed as %d/%d/%d.%s, but its canonical form %q as %d/%d/%d.%s",
+				path, z, x, y, ext, canonical, z2, x2, y2, ext2)
+		}
+	})
+}
+
+func TestHandleTile_PathForms(t *testing.T) {
+	srv := createTestServer(t)
+
+	tests := []struct {
+		path       string
+		expectCode int
+		name       string
+	}{
+		{"/1/0/0.png?foo=bar", http.StatusOK, "query string"},
+		{"/tile/1/0/0.png?foo=bar", http.StatusOK, "query string under /tile/"},
+		{"/1/0/0.PNG", http.StatusOK, "uppercase extension"},
+		{"/tile/1/0/0.PNG", http.StatusOK, "uppercase extension under /tile/"},
+		{"/%31/0/0.png", http.StatusOK, "percent-encoded digit"},
+		{"/1/0/0.png/", http.StatusBadRequest, "trailing slash"},
+		{"/tile/1/0/0.png/", http.StatusBadRequest, "trailing slash under /tile/"},
+		{"/+1/0/0.png", http.StatusBadRequest, "leading plus"},
+		{"/31/0/0.png", http.StatusBadRequest, "zoom above 30"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			srv.Handler().ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+			if w.Code != tt.expectCode {
+				t.Errorf("Expected status %d for %s, got %d: %s", tt.expectCode, tt.path, w.Code, w.Body.String())
 			}
 		})
 	}
@@ -198,6 +755,36 @@ func TestHandleRoot(t *testing.T) {
 	}
 }
 
+func TestHandleRoot_DisableViewer(t *testing.T) {
+	srv, err := New(Config{ImagePath: createTestJPEG(t), DisableViewer: true})
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+
+	tests := []struct {
+		path       string
+		expectCode int
+		name       string
+	}{
+		{"/", http.StatusNotFound, "viewer"},
+		{"/0/0/0.png", http.StatusOK, "tiles still served"},
+		{"/tilejson.json", http.StatusOK, "tilejson still served"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			srv.Handler().ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+			if w.Code != tt.expectCode {
+				t.Errorf("Expected status %d, got %d", tt.expectCode, w.Code)
+			}
+			if strings.Contains(w.Body.String(), "leaflet") {
+				t.Error("Response should not reference Leaflet")
+			}
+		})
+	}
+}
+
 func TestHandleTileRequest_Success(t *testing.T) {
 	srv := createTestServer(t)
 
@@ -259,7 +846,7 @@ func TestHandleTileRequest_InvalidPath(t *testing.T) {
 		name       string
 	}{
 		{"/invalid", http.StatusBadRequest, "invalid path"},
-		{"/0/0/0.jpg", http.StatusBadRequest, "wrong extension"},
+		{"/0/0/0.gif", http.StatusBadRequest, "unsupported extension"},
 		{"/a/b/c.png", http.StatusBadRequest, "non-numeric coordinates"},
 		{"/0/0.png", http.StatusBadRequest, "missing coordinate"},
 	}
@@ -307,6 +894,34 @@ func TestHandleTileRequest_OutOfRange(t *testing.T) {
 	}
 }
 
+func TestHandleTileRequest_ErrorStatus(t *testing.T) {
+	srv := createTestServer(t)
+
+	tests := []struct {
+		path       string
+		expectCode int
+		name       string
+	}{
+		{"/tile/-1/0/0.png", http.StatusBadRequest, "negative zoom"},
+		{"/-3/0/0.png", http.StatusBadRequest, "negative zoom without prefix"},
+		{"/2/4/0.png", http.StatusNotFound, "x out of range"},
+		{"/2/0/4.png", http.StatusNotFound, "y out of range"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.path, nil)
+			w := httptest.NewRecorder()
+
+			srv.Handler().ServeHTTP(w, req)
+
+			if w.Code != tt.expectCode {
+				t.Errorf("Expected status %d, got %d", tt.expectCode, w.Code)
+			}
+		})
+	}
+}
+
 func TestHandler_Integration(t *testing.T) {
 	srv := createTestServer(t)
 
@@ -345,6 +960,201 @@ func TestHandler_Integration(t *testing.T) {
 	}
 }
 
+func TestNormalizeBasePath(t *testing.T) {
+	tests := []struct {
+		input       string
+		expect      string
+		expectError bool
+		name        string
+	}{
+		{"", "", false, "empty"},
+		{"/", "", false, "root"},
+		{"/maps", "/maps", false, "simple prefix"},
+		{"maps", "/maps", false, "missing leading slash"},
+		{"/maps/", "/maps", false, "trailing slash"},
+		{"//maps//tiles/", "/maps/tiles", false, "duplicate slashes"},
+		{"/maps?x=1", "", true, "query string"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := normalizeBasePath(tt.input)
+
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Expected error for %q, got nil", tt.input)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if got != tt.expect {
+				t.Errorf("normalizeBasePath(%q) = %q, expected %q", tt.input, got, tt.expect)
+			}
+		})
+	}
+}
+
+func TestHandler_BasePath(t *testing.T) {
+	srv, err := New(Config{
+		ImagePath: createTestJPEG(t),
+		BasePath:  "/maps/",
+	})
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+
+	tests := []struct {
+		path       string
+		expectCode int
+		expectType string
+		name       string
+	}{
+		{"/maps/2/1/1.png", http.StatusOK, "image/png", "prefixed tile"},
+		{"/maps/tile/2/1/1.png", http.StatusOK, "image/png", "prefixed /tile/ route"},
+		{"/maps/", http.StatusOK, "text/html; charset=utf-8", "prefixed viewer"},
+		{"/maps/tilejson.json", http.StatusOK, "application/json", "prefixed TileJSON"},
+		{"/maps", http.StatusMovedPermanently, "", "viewer trailing-slash redirect"},
+		{"/2/1/1.png", http.StatusNotFound, "", "tile without prefix"},
+		{"/", http.StatusNotFound, "", "root without prefix"},
+		{"/mapsx/2/1/1.png", http.StatusNotFound, "", "similar prefix"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.path, nil)
+			w := httptest.NewRecorder()
+
+			srv.Handler().ServeHTTP(w, req)
+
+			resp := w.Result()
+			if resp.StatusCode != tt.expectCode {
+				t.Errorf("Expected status %d, got %d", tt.expectCode, resp.StatusCode)
+			}
+
+			if tt.expectType != "" {
+				if ct := resp.Header.Get("Content-Type"); ct != tt.expectType {
+					t.Errorf("Expected Content-Type %s, got %s", tt.expectType, ct)
+				}
+			}
+
+			if tt.expectCode == http.StatusMovedPermanently {
+				if loc := resp.Header.Get("Location"); loc != "/maps/" {
+					t.Errorf("Expected redirect to /maps/, got %q", loc)
+				}
+			}
+		})
+	}
+}
+
+func TestHandler_BasePathViewerAndTileJSON(t *testing.T) {
+	srv, err := New(Config{
+		ImagePath: createTestJPEG(t),
+		BasePath:  "/maps",
+	})
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+
+	// Viewer receives the prefix for its tile layer URL
+	req := httptest.NewRequest("GET", "/maps/", nil)
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, req)
+
+	body := w.Body.String()
+	for _, expected := range []string{
+		`"url":"/maps/{z}/{x}/{y}.png"`,
+		"<code>/maps/{z}/{x}/{y}.png</code>",
+	} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("Viewer should contain %q", expected)
+		}
+	}
+
+	// TileJSON emits the prefixed tile template
+	req = httptest.NewRequest("GET", "http://tiles.example.com/maps/tilejson.json", nil)
+	w = httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, req)
+
+	expected := `"http://tiles.example.com/maps/{z}/{x}/{y}.png"`
+	if !strings.Contains(w.Body.String(), expected) {
+		t.Errorf("TileJSON should contain %s, got %s", expected, w.Body.String())
+	}
+}
+
+func TestLogging_LevelsAndFields(t *testing.T) {
+	rec := &recordingHandler{}
+	srv, err := New(Config{
+		ImagePath: createTestJPEG(t),
+		Logger:    slog.New(rec),
+	})
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "/1/0/1.png", nil)
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, req)
+
+	loaded := rec.find("Loaded base map")
+	if loaded == nil || loaded.Level != slog.LevelInfo {
+		t.Errorf("Expected info-level 'Loaded base map' record, got %+v", loaded)
+	}
+
+	served := rec.find("Served tile")
+	if served == nil {
+		t.Fatal("Expected a 'Served tile' record")
+	}
+	if served.Level != slog.LevelDebug {
+		t.Errorf("Expected 'Served tile' at debug level, got %s", served.Level)
+	}
+
+	attrs := map[string]slog.Value{}
+	served.Attrs(func(a slog.Attr) bool {
+		attrs[a.Key] = a.Value
+		return true
+	})
+	if attrs["z"].Int64() != 1 || attrs["x"].Int64() != 0 || attrs["y"].Int64() != 1 {
+		t.Errorf("Unexpected tile fields: z=%v x=%v y=%v", attrs["z"], attrs["x"], attrs["y"])
+	}
+	if _, ok := attrs["duration"]; !ok {
+		t.Error("Expected a duration field on 'Served tile'")
+	}
+}
+
+// recordingHandler is a slog.Handler that keeps every record for inspection
+type recordingHandler struct {
+	mu      sync.Mutex
+	records []slog.Record
+}
+
+func (h *recordingHandler) Enabled(context.Context, slog.Level) bool { return true }
+
+func (h *recordingHandler) Handle(_ context.Context, r slog.Record) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.records = append(h.records, r.Clone())
+	return nil
+}
+
+func (h *recordingHandler) WithAttrs([]slog.Attr) slog.Handler { return h }
+
+func (h *recordingHandler) WithGroup(string) slog.Handler { return h }
+
+// find returns the first record with the given message, or nil
+func (h *recordingHandler) find(msg string) *slog.Record {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i := range h.records {
+		if h.records[i].Message == msg {
+			return &h.records[i]
+		}
+	}
+	return nil
+}
+
 // createTestServer creates a server for testing
 // Uses a small test image if the real image isn't available
 func createTestServer(t *testing.T) *Server {
@@ -466,3 +1276,46 @@ func TestTileEndpoint_RealWorld(t *testing.T) {
 		t.Logf("Saved tile %d/%d/%d to %s", tc.z, tc.x, tc.y, outputPath)
 	}
 }
+
+func TestHandleTile_BackgroundColor(t *testing.T) {
+	// Transparent world with an opaque box over Europe (10°W-40°E, 35°N-70°N)
+	img := image.NewRGBA(image.Rect(0, 0, 1024, 512))
+	draw.Draw(img, image.Rect(540, 57, 626, 156), &image.Uniform{color.RGBA{G: 200, A: 255}}, image.Point{}, draw.Src)
+	background := color.RGBA{R: 0x1e, G: 0x90, B: 0xff, A: 0xff}
+
+	tests := []struct {
+		cfg  Config
+		path string
+		name string
+	}{
+		{Config{BackgroundColor: "#1e90ff"}, "/2/2/1.png", "edge of Europe"},
+		{Config{BackgroundColor: "#1e90ff", CollapseUniformTiles: true}, "/2/2/1.png", "edge of Europe with collapsing"},
+		{Config{BackgroundColor: "#1e90ff", CollapseUniformTiles: true}, "/2/0/3.png", "collapsed empty tile"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, err := NewWithBaseMap(imagery.NewBaseMap(img), tt.cfg)
+			if err != nil {
+				t.Fatalf("NewWithBaseMap() failed: %v", err)
+			}
+			w := httptest.NewRecorder()
+			srv.Handler().ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+			if w.Code != http.StatusOK {
+				t.Fatalf("Expected status 200, got %d", w.Code)
+			}
+			tile, err := png.Decode(w.Body)
+			if err != nil {
+				t.Fatalf("Failed to decode PNG: %v", err)
+			}
+			// Bottom right of 2/2/1 and all of 2/0/3 lie outside Europe
+			if got := color.RGBAModel.Convert(tile.At(450, 450)); got != background {
+				t.Errorf("Expected uncovered pixel %v, got %v", background, got)
+			}
+		})
+	}
+
+	if _, err := NewWithBaseMap(imagery.NewBaseMap(img), Config{BackgroundColor: "blue"}); err == nil {
+		t.Error("Expected error for invalid background color")
+	}
+}
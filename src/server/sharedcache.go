@@ -0,0 +1,240 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"org.xyzmaps.xyztiles/src/imagery"
+)
+
+// sharedCacheQueueSize is how many rendered tiles may wait to be written to
+// the shared cache before further tiles are dropped
+const sharedCacheQueueSize = 256
+
+// sharedCacheWriters is how many tiles are written to the shared cache at
+// once
+const sharedCacheWriters = 4
+
+// sharedCacheTimeout bounds every shared cache lookup and write, so a store
+// that cannot be reached delays a tile by at most this long before it is
+// rendered
+const sharedCacheTimeout = 2 * time.Second
+
+// sharedWrite is a rendered tile waiting to be written to the shared cache
+type sharedWrite struct {
+	key  string
+	data []byte
+}
+
+// sharedCacheStats counts the shared cache's lookups and writes
+type sharedCacheStats struct {
+	Hits    int64 `json:"hits"`
+	Misses  int64 `json:"misses"`
+	Errors  int64 `json:"errors"`  // Lookups and writes that failed
+	Written int64 `json:"written"` // Tiles written
+	Dropped int64 `json:"dropped"` // Tiles not written because the queue was full or the store refused their size
+}
+
+// sharedCache puts a TileCache shared between servers behind the memory
+// cache: tiles are read through it before rendering and written to it in
+// the background after. Its failures are logged and counted, and the tile
+// is rendered as if it had missed.
+type sharedCache struct {
+	store  TileCache
+	logger *slog.Logger
+	queue  chan sharedWrite
+	done   chan struct{}      // Closed when the writers have stopped
+	ctx    context.Context    // Of writes; canceled when shutdown gives up
+	cancel context.CancelFunc // Cancels ctx
+	down   atomic.Bool        // The last lookup or write failed, so recovery is logged
+	closer io.Closer          // Optional: closed by shutdown, for a store built from Config
+
+	hits, misses, errors, written, dropped atomic.Int64
+
+	mu     sync.Mutex
+	closed bool // The queue is closed; put drops tiles
+}
+
+// newSharedCache starts the writers for store
+func newSharedCache(store TileCache, logger *slog.Logger) *sharedCache {
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &sharedCache{
+		store:  store,
+		logger: logger,
+		queue:  make(chan sharedWrite, sharedCacheQueueSize),
+		done:   make(chan struct{}),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	var wg sync.WaitGroup
+	for range sharedCacheWriters {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.run()
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(c.done)
+	}()
+	return c
+}
+
+// sharedKey returns the shared cache key of a tile of l: the tileKey under
+// the layer's contentTag, so servers rendering other images, or the same
+// images with other options, never share tiles. It returns "" for layers
+// without a version, which are not shared.
+func (s *Server) sharedKey(l *layer, z, x, y, size int, format imagery.Format) string {
+	v := s.contentTag(l)
+	if v == "" {
+		return ""
+	}
+	return v + "/" + tileKey(l.name, z, x, y, size, format)
+}
+
+// get looks key up in the store, reporting a failure as a miss. It gives up
+// with ctx or after sharedCacheTimeout.
+func (c *sharedCache) get(ctx context.Context, key string) ([]byte, bool) {
+	ctx, cancel := context.WithTimeout(ctx, sharedCacheTimeout)
+	defer cancel()
+	data, err := c.store.Get(ctx, key)
+	switch {
+	case err == nil:
+		c.hits.Add(1)
+		c.reachable()
+		return data, true
+	case errors.Is(err, ErrCacheMiss):
+		c.misses.Add(1)
+		c.reachable()
+	case ctx.Err() == context.Canceled:
+		// The client went away; the store is not to blame
+	default:
+		c.failed("Shared tile cache lookup failed, rendering instead", key, err)
+	}
+	return nil, false
+}
+
+// put queues data to be written under key without blocking. When the queue
+// is full the tile is dropped.
+func (c *sharedCache) put(key string, data []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return
+	}
+	select {
+	case c.queue <- sharedWrite{key: key, data: data}:
+	default:
+		if c.dropped.Add(1) == 1 {
+			c.logger.Warn("Shared tile cache queue full, dropping tiles", "queue", sharedCacheQueueSize)
+		}
+	}
+}
+
+// run writes queued tiles until the queue is closed
+func (c *sharedCache) run() {
+	for w := range c.queue {
+		ctx, cancel := context.WithTimeout(c.ctx, sharedCacheTimeout)
+		err := c.store.Put(ctx, w.key, w.data)
+		cancel()
+		if errors.Is(err, ErrCacheEntryTooLarge) {
+			// The store is fine; the tile is not worth sharing
+			c.dropped.Add(1)
+			c.logger.Debug("Tile too large for the shared cache", "key", w.key, "bytes", len(w.data))
+			continue
+		}
+		if err != nil {
+			c.failed("Failed to write tile to the shared cache", w.key, err)
+			continue
+		}
+		c.written.Add(1)
+		c.reachable()
+	}
+}
+
+// failed counts a failure, logging it only when the store was working
+// before, so a store that is down does not flood the log
+func (c *sharedCache) failed(msg, key string, err error) {
+	c.errors.Add(1)
+	if !c.down.Swap(true) {
+		c.logger.Warn(msg, "key", key, "err", err)
+	}
+}
+
+// reachable notes a working store, logging its recovery from failures
+func (c *sharedCache) reachable() {
+	if c.down.Swap(false) {
+		c.logger.Info("Shared tile cache reachable again")
+	}
+}
+
+// stats snapshots the counters
+func (c *sharedCache) stats() sharedCacheStats {
+	return sharedCacheStats{
+		Hits:    c.hits.Load(),
+		Misses:  c.misses.Load(),
+		Errors:  c.errors.Load(),
+		Written: c.written.Load(),
+		Dropped: c.dropped.Load(),
+	}
+}
+
+// shutdown stops accepting tiles and waits for the queued ones to be
+// written. If ctx ends first, the writes in progress are canceled and the
+// rest are abandoned. The closer, if any, is closed last.
+func (c *sharedCache) shutdown(ctx context.Context) {
+	c.mu.Lock()
+	if !c.closed {
+		c.closed = true
+		close(c.queue)
+	}
+	c.mu.Unlock()
+	select {
+	case <-c.done:
+	case <-ctx.Done():
+		c.cancel()
+		// Drain the queue so the writers stop promptly
+		for range c.queue {
+		}
+		<-c.done
+	}
+	c.cancel()
+	if c.closer != nil {
+		c.closer.Close()
+	}
+}
+
+// cachedTile returns a tile of l from the memory cache or, failing that,
+// the shared cache, which then fills the memory cache. It returns nil when
+// neither has the tile.
+func (s *Server) cachedTile(ctx context.Context, l *layer, z, x, y, size int, format imagery.Format) []byte {
+	key := tileKey(l.name, z, x, y, size, format)
+	var gen uint64
+	if s.cache != nil {
+		gen = s.cache.generation()
+		if data, ok := s.cache.get(key); ok {
+			return data
+		}
+	}
+	if s.shared == nil {
+		return nil
+	}
+	sk := s.sharedKey(l, z, x, y, size, format)
+	if sk == "" {
+		return nil
+	}
+	data, ok := s.shared.get(ctx, sk)
+	if !ok {
+		return nil
+	}
+	if s.cache != nil {
+		s.cache.addIfCurrent(gen, key, data)
+	}
+	return data
+}
@@ -0,0 +1,312 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"io"
+	"log/slog"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// errStoreDown is returned by a failing test store
+var errStoreDown = errors.New("store down")
+
+// blockingStore is a TileCache whose Put blocks until release is closed or
+// its ctx ends, and whose Get always fails
+type blockingStore struct {
+	release chan struct{}
+}
+
+func (b *blockingStore) Get(context.Context, string) ([]byte, error) {
+	return nil, errStoreDown
+}
+
+func (b *blockingStore) Put(ctx context.Context, _ string, _ []byte) error {
+	select {
+	case <-b.release:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (b *blockingStore) Delete(context.Context, string) error {
+	return nil
+}
+
+func TestSharedCache_ReadThroughWriteBehind(t *testing.T) {
+	fake := newFakeS3("tiles")
+	ts := httptest.NewServer(fake)
+	defer ts.Close()
+	cfg := Config{
+		TilesetVersion: "v1",
+		CacheMaxBytes:  1 << 20,
+		CacheS3: S3Config{
+			Bucket:          "tiles",
+			Endpoint:        ts.URL,
+			Prefix:          "xyz/",
+			AccessKeyID:     testAccessKeyID,
+			SecretAccessKey: testSecretAccessKey,
+		},
+	}
+
+	// The first replica renders the tile and writes it to the bucket
+	first, err := NewWithBaseMap(solidBaseMap(color.RGBA{0, 0, 255, 255}), cfg)
+	if err != nil {
+		t.Fatalf("NewWithBaseMap() failed: %v", err)
+	}
+	rendered := fetchTileBytes(t, first.Handler(), "/2/1/1.png")
+	if err := first.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown() failed: %v", err)
+	}
+	if stored, ok := fake.object("xyz/v1/default/2/1/1.png"); !ok || !bytes.Equal(stored, rendered) {
+		t.Fatalf("Expected the rendered tile written to the bucket, got %d bytes, %v", len(stored), ok)
+	}
+	if stats := first.shared.stats(); stats.Written != 1 || stats.Misses != 1 {
+		t.Errorf("Expected 1 miss and 1 write, got %+v", stats)
+	}
+
+	// A second replica serves it from the bucket without rendering, then
+	// from its memory cache
+	second, err := NewWithBaseMap(solidBaseMap(color.RGBA{0, 0, 255, 255}), cfg)
+	if err != nil {
+		t.Fatalf("NewWithBaseMap() failed: %v", err)
+	}
+	defer second.Shutdown(context.Background())
+	second.render = func(context.Context, *layer, int, int, int, int) (*image.RGBA, error) {
+		t.Error("Expected the tile read from the shared cache, not rendered")
+		return nil, errors.New("unexpected render")
+	}
+	for range 2 {
+		if got := fetchTileBytes(t, second.Handler(), "/2/1/1.png"); !bytes.Equal(got, rendered) {
+			t.Error("Expected the tile rendered by the first replica")
+		}
+	}
+	if stats := second.shared.stats(); stats.Hits != 1 {
+		t.Errorf("Expected 1 shared cache hit before the memory cache took over, got %+v", stats)
+	}
+
+	// Another tileset version does not see the first one's tiles
+	cfg.TilesetVersion = "v2"
+	third, err := NewWithBaseMap(solidBaseMap(color.RGBA{255, 0, 0, 255}), cfg)
+	if err != nil {
+		t.Fatalf("NewWithBaseMap() failed: %v", err)
+	}
+	defer third.Shutdown(context.Background())
+	if got := fetchTileBytes(t, third.Handler(), "/2/1/1.png"); bytes.Equal(got, rendered) {
+		t.Error("Expected a tile rendered from the v2 image")
+	}
+
+	// Nor does a restart under the first version with other render options
+	cfg.TilesetVersion = "v1"
+	cfg.BackgroundColor = "#102030"
+	fourth, err := NewWithBaseMap(solidBaseMap(color.RGBA{0, 0, 255, 255}), cfg)
+	if err != nil {
+		t.Fatalf("NewWithBaseMap() failed: %v", err)
+	}
+	fetchTileBytes(t, fourth.Handler(), "/2/1/1.png")
+	if err := fourth.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown() failed: %v", err)
+	}
+	if stats := fourth.shared.stats(); stats.Hits != 0 || stats.Written != 1 {
+		t.Errorf("Expected the tile rendered and written anew, got %+v", stats)
+	}
+	if _, ok := fake.object("xyz/v1." + renderFingerprint(cfg) + "/default/2/1/1.png"); !ok {
+		t.Error("Expected the tile stored under the render options' fingerprint")
+	}
+}
+
+func TestSharedCache_StoreDown(t *testing.T) {
+	fake := newFakeS3("tiles")
+	fake.fail.Store(true)
+	ts := httptest.NewServer(fake)
+	defer ts.Close()
+
+	var logBuf syncBuffer
+	srv, err := NewWithBaseMap(solidBaseMap(color.RGBA{0, 255, 0, 255}), Config{
+		TilesetVersion: "v1",
+		CacheS3: S3Config{
+			Bucket:          "tiles",
+			Endpoint:        ts.URL,
+			AccessKeyID:     testAccessKeyID,
+			SecretAccessKey: testSecretAccessKey,
+		},
+		Logger: slog.New(slog.NewTextHandler(&logBuf, nil)),
+	})
+	if err != nil {
+		t.Fatalf("NewWithBaseMap() failed: %v", err)
+	}
+
+	// Every tile is still rendered and served
+	for _, path := range []string{"/1/0/0.png", "/1/1/0.png", "/1/0/1.png"} {
+		fetchTileBytes(t, srv.Handler(), path)
+	}
+	if err := srv.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown() failed: %v", err)
+	}
+	if stats := srv.shared.stats(); stats.Errors != 6 || stats.Hits != 0 {
+		t.Errorf("Expected 3 failed lookups and 3 failed writes, got %+v", stats)
+	}
+	if n := strings.Count(logBuf.String(), "level=WARN"); n != 1 {
+		t.Errorf("Expected the outage logged once, got %d warnings:\n%s", n, logBuf.String())
+	}
+
+	// Recovery is logged
+	fake.fail.Store(false)
+	srv.shared.get(context.Background(), "v1/default/1/0/0.png")
+	if !strings.Contains(logBuf.String(), "Shared tile cache reachable again") {
+		t.Errorf("Expected the recovery logged, got:\n%s", logBuf.String())
+	}
+}
+
+func TestSharedCache_Redis(t *testing.T) {
+	fake := newFakeRedis(t, "")
+	var logBuf syncBuffer
+	srv, err := NewWithBaseMap(solidBaseMap(color.RGBA{0, 0, 255, 255}), Config{
+		TilesetVersion: "v1",
+		CacheRedis:     RedisConfig{Addr: fake.addr(), TTL: time.Hour},
+		Logger:         slog.New(slog.NewTextHandler(&logBuf, nil)),
+	})
+	if err != nil {
+		t.Fatalf("NewWithBaseMap() failed: %v", err)
+	}
+	rendered := fetchTileBytes(t, srv.Handler(), "/2/1/1.png")
+	if err := srv.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown() failed: %v", err)
+	}
+	if v, ok := fake.value(0, "xyztiles:v1/default/2/1/1.png"); !ok || v.data != string(rendered) || v.expires.IsZero() {
+		t.Errorf("Expected the rendered tile stored with a TTL, got %d bytes, %v", len(v.data), ok)
+	}
+
+	// A tile over the size limit is dropped without marking Redis down
+	srv, err = NewWithBaseMap(solidBaseMap(color.RGBA{0, 0, 255, 255}), Config{
+		TilesetVersion: "v2",
+		CacheRedis:     RedisConfig{Addr: fake.addr(), MaxEntryBytes: 10},
+		Logger:         slog.New(slog.NewTextHandler(&logBuf, nil)),
+	})
+	if err != nil {
+		t.Fatalf("NewWithBaseMap() failed: %v", err)
+	}
+	fetchTileBytes(t, srv.Handler(), "/2/1/1.png")
+	if err := srv.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown() failed: %v", err)
+	}
+	if stats := srv.shared.stats(); stats.Dropped != 1 || stats.Errors != 0 {
+		t.Errorf("Expected the tile dropped without an error, got %+v", stats)
+	}
+	if strings.Contains(logBuf.String(), "level=WARN") {
+		t.Errorf("Expected no warnings, got:\n%s", logBuf.String())
+	}
+}
+
+func TestSharedCache_RedisUnreachable(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	var logBuf syncBuffer
+	srv, err := NewWithBaseMap(solidBaseMap(color.RGBA{0, 255, 0, 255}), Config{
+		TilesetVersion: "v1",
+		CacheRedis:     RedisConfig{Addr: addr},
+		Logger:         slog.New(slog.NewTextHandler(&logBuf, nil)),
+	})
+	if err != nil {
+		t.Fatalf("Expected an unreachable Redis not to be fatal, got %v", err)
+	}
+	defer srv.Shutdown(context.Background())
+	if !strings.Contains(logBuf.String(), "Redis tile cache unreachable") {
+		t.Errorf("Expected a warning, got:\n%s", logBuf.String())
+	}
+	if srv.shared != nil {
+		t.Error("Expected the server to run with the memory cache only")
+	}
+	fetchTileBytes(t, srv.Handler(), "/1/0/0.png")
+}
+
+func TestSharedCache_UnversionedLayersNotShared(t *testing.T) {
+	store := newTileCache(1 << 20)
+	srv, err := NewWithBaseMap(solidBaseMap(color.RGBA{}), Config{CacheStore: store})
+	if err != nil {
+		t.Fatalf("NewWithBaseMap() failed: %v", err)
+	}
+	fetchTileBytes(t, srv.Handler(), "/1/0/0.png")
+	if err := srv.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown() failed: %v", err)
+	}
+	if store.len() != 0 {
+		t.Errorf("Expected no tiles shared for a layer without a tileset version, got %d", store.len())
+	}
+}
+
+func TestSharedCache_Config(t *testing.T) {
+	tests := []struct {
+		cfg  Config
+		name string
+	}{
+		{Config{CacheStore: newTileCache(1), CacheS3: S3Config{Bucket: "tiles"}}, "store and S3"},
+		{Config{CacheS3: S3Config{Bucket: "tiles", Endpoint: "localhost"}}, "invalid S3 endpoint"},
+		{Config{CacheS3: S3Config{Bucket: "tiles"}, CacheRedis: RedisConfig{Addr: "localhost:6379"}}, "S3 and Redis"},
+		{Config{CacheStore: newTileCache(1), CacheRedis: RedisConfig{Addr: "localhost:6379"}}, "store and Redis"},
+		{Config{CacheRedis: RedisConfig{Addr: "localhost"}}, "invalid Redis address"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewWithBaseMap(solidBaseMap(color.RGBA{}), tt.cfg); err == nil {
+				t.Error("Expected an error")
+			}
+		})
+	}
+}
+
+func TestSharedCache_QueueFull(t *testing.T) {
+	store := &blockingStore{release: make(chan struct{})}
+	c := newSharedCache(store, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	// The writers each hold one tile, the queue the next ones, and the rest
+	// are dropped without blocking
+	total := sharedCacheWriters + sharedCacheQueueSize + 10
+	for i := range total {
+		c.put(strings.Repeat("k", i+1), []byte("tile"))
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for c.stats().Dropped == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if dropped := c.stats().Dropped; dropped == 0 || dropped > int64(total-sharedCacheQueueSize) {
+		t.Errorf("Expected some tiles dropped once the queue filled, got %d", dropped)
+	}
+
+	close(store.release)
+	c.shutdown(context.Background())
+	if stats := c.stats(); stats.Written+stats.Dropped != int64(total) {
+		t.Errorf("Expected every tile written or dropped, got %+v", stats)
+	}
+}
+
+func TestSharedCache_ShutdownGivesUp(t *testing.T) {
+	store := &blockingStore{release: make(chan struct{})}
+	c := newSharedCache(store, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	for i := range 20 {
+		c.put(strings.Repeat("k", i+1), []byte("tile"))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	c.shutdown(ctx)
+	if elapsed := time.Since(start); elapsed > sharedCacheTimeout {
+		t.Errorf("Expected shutdown to give up with its context, took %v", elapsed)
+	}
+	c.put("late", []byte("tile")) // Dropped without panicking
+}
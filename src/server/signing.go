@@ -0,0 +1,117 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"image"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Query parameters of a signed tile URL
+const (
+	signatureParam = "sig" // Hex HMAC-SHA256 of the path and expiry
+	expiryParam    = "exp" // Unix time in seconds after which the URL is rejected
+)
+
+// urlSigner signs tile URLs and checks their signatures with an HMAC key
+type urlSigner struct {
+	key []byte
+	now func() time.Time
+}
+
+// newURLSigner returns a signer for key, or nil if key is empty
+func newURLSigner(key string) *urlSigner {
+	if key == "" {
+		return nil
+	}
+	return &urlSigner{key: []byte(key), now: time.Now}
+}
+
+// mac returns the HMAC of path, below any base path, valid until the Unix
+// time exp
+func (u *urlSigner) mac(path string, exp int64) []byte {
+	mac := hmac.New(sha256.New, u.key)
+	mac.Write([]byte(path + "?" + expiryParam + "=" + strconv.FormatInt(exp, 10)))
+	return mac.Sum(nil)
+}
+
+// verify checks the signature and expiry in query against path
+func (u *urlSigner) verify(path string, query url.Values) error {
+	exp, err := strconv.ParseInt(query.Get(expiryParam), 10, 64)
+	if err != nil {
+		return errors.New("missing or malformed expiry")
+	}
+	sig, err := hex.DecodeString(query.Get(signatureParam))
+	if err != nil || !hmac.Equal(sig, u.mac(path, exp)) {
+		return errors.New("invalid signature")
+	}
+	if u.now().Unix() > exp {
+		return errors.New("expired")
+	}
+	return nil
+}
+
+// middleware wraps next, rejecting requests for guarded paths without a
+// valid, unexpired signature with 403. Other paths, such as the viewer, pass
+// through.
+func (u *urlSigner) middleware(guarded func(string) bool, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if guarded(r.URL.Path) {
+			if err := u.verify(r.URL.Path, r.URL.Query()); err != nil {
+				writeError(w, r, newAPIError(http.StatusForbidden, codeForbidden, "Forbidden: "+err.Error()))
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// isSignedPath reports whether path needs a signature: tiles, and the
+// overview and point queries, which would otherwise give the imagery away
+// unsigned
+func (s *Server) isSignedPath(path string) bool {
+	switch path {
+	case overviewPath:
+		return s.overview != image.Point{}
+	case queryPath:
+		return true
+	}
+	return s.isTilePath(path)
+}
+
+// SignTileURL returns the path, including any base path, of tile z/x/y of
+// the default layer in the default format, signed to be served until ttl
+// from now. Without Config.SigningKey the path is returned unsigned.
+func (s *Server) SignTileURL(z, x, y int, ttl time.Duration) string {
+	return s.signPath(s.tilePrefix(s.defLayer)+"/"+strconv.Itoa(z)+"/"+strconv.Itoa(x)+"/"+strconv.Itoa(y)+s.defLayer.formats.Default.Extension(), ttl)
+}
+
+// SignOverviewURL returns the path, including any base path, of
+// /overview.png signed to be served until ttl from now, like SignTileURL
+func (s *Server) SignOverviewURL(ttl time.Duration) string {
+	return s.signPath(overviewPath, ttl)
+}
+
+// SignQueryURL returns the path, including any base path, of /query signed
+// to be served until ttl from now, like SignTileURL. The signature does not
+// cover the query parameters, so the URL may be used for any point.
+func (s *Server) SignQueryURL(ttl time.Duration) string {
+	return s.signPath(queryPath, ttl)
+}
+
+// signPath returns the base path and path, signed until ttl from now when
+// there is a signer
+func (s *Server) signPath(path string, ttl time.Duration) string {
+	if s.signer == nil {
+		return s.basePath + path
+	}
+
+	exp := s.signer.now().Add(ttl).Unix()
+	query := url.Values{expiryParam: {strconv.FormatInt(exp, 10)}, signatureParam: {hex.EncodeToString(s.signer.mac(path, exp))}}
+	return s.basePath + path + "?" + query.Encode()
+}
@@ -0,0 +1,165 @@
+package server
+
+import (
+	"image"
+	"image/color"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignedTileURLs(t *testing.T) {
+	srv, err := NewWithBaseMap(solidBaseMap(color.RGBA{0, 0, 255, 255}), Config{SigningKey: "s3cret"})
+	if err != nil {
+		t.Fatalf("NewWithBaseMap() failed: %v", err)
+	}
+	now := time.Unix(1_700_000_000, 0)
+	srv.signer.now = func() time.Time { return now }
+
+	signed := srv.SignTileURL(2, 1, 3, time.Hour)
+	if !strings.HasPrefix(signed, "/2/1/3.png?") {
+		t.Fatalf("Expected a signed URL for /2/1/3.png, got %s", signed)
+	}
+	path, query, _ := strings.Cut(signed, "?")
+
+	tests := []struct {
+		url          string
+		elapsed      time.Duration
+		expectStatus int
+		name         string
+	}{
+		{signed, 0, http.StatusOK, "valid"},
+		{signed, time.Hour, http.StatusOK, "valid until expiry"},
+		{signed, time.Hour + time.Second, http.StatusForbidden, "expired"},
+		{strings.Replace(signed, "sig=", "sig=00", 1), 0, http.StatusForbidden, "tampered signature"},
+		{strings.Replace(signed, "exp=", "exp=9", 1), 0, http.StatusForbidden, "extended expiry"},
+		{"/2/1/2.png?" + query, 0, http.StatusForbidden, "other tile"},
+		{path, 0, http.StatusForbidden, "unsigned"},
+		{"/", 0, http.StatusOK, "viewer needs no signature"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv.signer.now = func() time.Time { return now.Add(tt.elapsed) }
+			w := httptest.NewRecorder()
+			srv.Handler().ServeHTTP(w, httptest.NewRequest("GET", tt.url, nil))
+			if w.Code != tt.expectStatus {
+				t.Errorf("Expected status %d for %s, got %d", tt.expectStatus, tt.url, w.Code)
+			}
+		})
+	}
+}
+
+func TestSignedTileURLs_ErrorCode(t *testing.T) {
+	srv, err := NewWithBaseMap(solidBaseMap(color.RGBA{}), Config{SigningKey: "s3cret"})
+	if err != nil {
+		t.Fatalf("NewWithBaseMap() failed: %v", err)
+	}
+
+	env := fetchError(t, srv.Handler(), "/1/0/0.png", http.StatusForbidden)
+	if env.Error.Code != codeForbidden {
+		t.Errorf("Expected code %q, got %q", codeForbidden, env.Error.Code)
+	}
+}
+
+func TestSignTileURL_BasePath(t *testing.T) {
+	srv, err := NewWithBaseMap(solidBaseMap(color.RGBA{}), Config{SigningKey: "s3cret", BasePath: "/maps"})
+	if err != nil {
+		t.Fatalf("NewWithBaseMap() failed: %v", err)
+	}
+
+	signed := srv.SignTileURL(1, 0, 0, time.Minute)
+	if !strings.HasPrefix(signed, "/maps/1/0/0.png?") {
+		t.Fatalf("Expected the base path in %s", signed)
+	}
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, httptest.NewRequest("GET", signed, nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", w.Code)
+	}
+}
+
+func TestSignTileURL_NoKey(t *testing.T) {
+	srv, err := NewWithBaseMap(solidBaseMap(color.RGBA{}), Config{})
+	if err != nil {
+		t.Fatalf("NewWithBaseMap() failed: %v", err)
+	}
+
+	if got := srv.SignTileURL(1, 0, 0, time.Minute); got != "/1/0/0.png" {
+		t.Errorf("Expected an unsigned URL without a key, got %s", got)
+	}
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/1/0/0.png", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected unsigned tiles to be served without a key, got %d", w.Code)
+	}
+}
+
+func TestSignedOverviewURL(t *testing.T) {
+	srv, err := NewWithBaseMap(solidBaseMap(color.RGBA{0, 128, 0, 255}), Config{SigningKey: "s3cret", OverviewSize: image.Pt(64, 32)})
+	if err != nil {
+		t.Fatalf("NewWithBaseMap() failed: %v", err)
+	}
+
+	signed := srv.SignOverviewURL(time.Minute)
+	if !strings.HasPrefix(signed, "/overview.png?") {
+		t.Fatalf("Expected a signed URL for /overview.png, got %s", signed)
+	}
+	_, query, _ := strings.Cut(signed, "?")
+
+	tests := []struct {
+		url          string
+		expectStatus int
+		name         string
+	}{
+		{signed, http.StatusOK, "valid"},
+		{"/overview.png", http.StatusForbidden, "unsigned"},
+		{strings.Replace(signed, "sig=", "sig=00", 1), http.StatusForbidden, "tampered signature"},
+		{"/overview.png?" + query + "&size=512", http.StatusOK, "other parameters unsigned"},
+		{"/1/0/0.png?" + query, http.StatusForbidden, "signature of another path"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			srv.Handler().ServeHTTP(w, httptest.NewRequest("GET", tt.url, nil))
+			if w.Code != tt.expectStatus {
+				t.Errorf("Expected status %d for %s, got %d", tt.expectStatus, tt.url, w.Code)
+			}
+		})
+	}
+}
+
+func TestSignedQueryURL(t *testing.T) {
+	srv, err := NewWithBaseMap(solidBaseMap(color.RGBA{0, 128, 0, 255}), Config{SigningKey: "s3cret"})
+	if err != nil {
+		t.Fatalf("NewWithBaseMap() failed: %v", err)
+	}
+
+	signed := srv.SignQueryURL(time.Minute)
+	if !strings.HasPrefix(signed, "/query?") {
+		t.Fatalf("Expected a signed URL for /query, got %s", signed)
+	}
+
+	tests := []struct {
+		url          string
+		expectStatus int
+		name         string
+	}{
+		{signed + "&lon=2.35&lat=48.86", http.StatusOK, "valid"},
+		{"/query?lon=2.35&lat=48.86", http.StatusForbidden, "unsigned"},
+		{strings.Replace(signed, "sig=", "sig=00", 1) + "&lon=2.35&lat=48.86", http.StatusForbidden, "tampered signature"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			srv.Handler().ServeHTTP(w, httptest.NewRequest("GET", tt.url, nil))
+			if w.Code != tt.expectStatus {
+				t.Errorf("Expected status %d for %s, got %d", tt.expectStatus, tt.url, w.Code)
+			}
+		})
+	}
+}
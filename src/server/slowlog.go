@@ -0,0 +1,94 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// requestTimings records where the time serving a tile went, for the slow
+// request log. Each request is handled on one goroutine, so the fields need
+// no locking.
+type requestTimings struct {
+	tile        bool // A tile was looked up; the fields below are set
+	layer       string
+	z, x, y     int
+	cacheHit    bool
+	cacheLookup time.Duration
+	queueWait   time.Duration // Waiting for a render slot
+	render      time.Duration
+	encode      time.Duration
+}
+
+// timingsKey is the context key of a request's timings
+type timingsKey struct{}
+
+// requestTimingsFrom returns the timings of the request ctx belongs to, or
+// nil when slow requests are not logged
+func requestTimingsFrom(ctx context.Context) *requestTimings {
+	t, _ := ctx.Value(timingsKey{}).(*requestTimings)
+	return t
+}
+
+// tileRequested records the tile a request is for. Like the other recording
+// methods it does nothing on a nil receiver, so callers need not check
+// whether slow requests are logged.
+func (t *requestTimings) tileRequested(layer string, z, x, y int) {
+	if t != nil {
+		t.tile, t.layer, t.z, t.x, t.y = true, layer, z, x, y
+	}
+}
+
+// cacheChecked records a cache lookup that took d
+func (t *requestTimings) cacheChecked(hit bool, d time.Duration) {
+	if t != nil {
+		t.cacheHit, t.cacheLookup = hit, d
+	}
+}
+
+// queued records the time spent waiting for a render slot
+func (t *requestTimings) queued(d time.Duration) {
+	if t != nil {
+		t.queueWait = d
+	}
+}
+
+// rendered records the time spent rendering the tile
+func (t *requestTimings) rendered(d time.Duration) {
+	if t != nil {
+		t.render = d
+	}
+}
+
+// encoded records the time spent encoding the tile
+func (t *requestTimings) encoded(d time.Duration) {
+	if t != nil {
+		t.encode = d
+	}
+}
+
+// slowRequestMiddleware logs a warning for every request next takes longer
+// than threshold to handle, breaking a tile request's time down by stage
+func slowRequestMiddleware(next http.Handler, threshold time.Duration, logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		timings := &requestTimings{}
+		rec := &responseRecorder{ResponseWriter: w}
+
+		next.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), timingsKey{}, timings)))
+
+		elapsed := time.Since(start)
+		if elapsed <= threshold {
+			return
+		}
+		args := []any{"request_id", requestID(r.Context()), "method", r.Method, "path", r.URL.Path,
+			"status", rec.Status(), "duration", elapsed, "threshold", threshold}
+		if timings.tile {
+			args = append(args, "layer", timings.layer, "z", timings.z, "x", timings.x, "y", timings.y,
+				"cache_hit", timings.cacheHit, "cache_lookup", timings.cacheLookup,
+				"queue_wait", timings.queueWait, "render", timings.render, "encode", timings.encode)
+		}
+		logger.Warn("Slow request", args...)
+	})
+}
@@ -0,0 +1,133 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"image"
+	"image/color"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// slowLogEntries returns the "Slow request" entries of a JSON log
+func slowLogEntries(t *testing.T, log string) []map[string]any {
+	t.Helper()
+
+	var entries []map[string]any
+	sc := bufio.NewScanner(strings.NewReader(log))
+	for sc.Scan() {
+		var e map[string]any
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			t.Fatalf("Failed to parse log line %q: %v", sc.Text(), err)
+		}
+		if e["msg"] == "Slow request" {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+func TestSlowRequestLog(t *testing.T) {
+	var logBuf syncBuffer
+	srv, err := NewWithBaseMap(solidBaseMap(color.RGBA{0, 0, 255, 255}), Config{
+		SlowRequestThreshold: 100 * time.Millisecond,
+		CacheMaxBytes:        1 << 20,
+		Logger:               slog.New(slog.NewJSONHandler(&logBuf, nil)),
+	})
+	if err != nil {
+		t.Fatalf("NewWithBaseMap() failed: %v", err)
+	}
+	// Tiles at zoom 2 take 200ms to render, others none
+	srv.render = func(ctx context.Context, _ *layer, z, _, _, _ int) (*image.RGBA, error) {
+		if z == 2 {
+			time.Sleep(200 * time.Millisecond)
+		}
+		return image.NewRGBA(image.Rect(0, 0, 8, 8)), nil
+	}
+
+	// The slow tile again is a fast cache hit
+	for _, path := range []string{"/1/0/0.png", "/2/1/3.png", "/2/1/3.png", "/tilejson.json"} {
+		w := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200 for %s, got %d", path, w.Code)
+		}
+	}
+
+	entries := slowLogEntries(t, logBuf.String())
+	if len(entries) != 1 {
+		t.Fatalf("Expected exactly one slow request logged, got %d:\n%s", len(entries), logBuf.String())
+	}
+	e := entries[0]
+	if e["level"] != "WARN" || e["path"] != "/2/1/3.png" || e["status"] != float64(200) {
+		t.Errorf("Expected a warning for /2/1/3.png with status 200, got %v", e)
+	}
+	if e["layer"] != PrimaryLayerName || e["z"] != float64(2) || e["x"] != float64(1) || e["y"] != float64(3) {
+		t.Errorf("Expected the tile coordinates, got %v", e)
+	}
+	if e["cache_hit"] != false {
+		t.Errorf("Expected a cache miss, got %v", e["cache_hit"])
+	}
+	render, _ := e["render"].(float64)
+	duration, _ := e["duration"].(float64)
+	if time.Duration(render) < 200*time.Millisecond || duration < render {
+		t.Errorf("Expected the render to account for the time, got render %v of %v", time.Duration(render), time.Duration(duration))
+	}
+	for _, stage := range []string{"cache_lookup", "queue_wait", "encode", "threshold", "request_id"} {
+		if _, ok := e[stage]; !ok {
+			t.Errorf("Expected %s in the entry", stage)
+		}
+	}
+}
+
+func TestSlowRequestLog_QueueWait(t *testing.T) {
+	var logBuf syncBuffer
+	srv, err := NewWithBaseMap(solidBaseMap(color.RGBA{}), Config{
+		SlowRequestThreshold: 100 * time.Millisecond,
+		MaxConcurrentRenders: 1,
+		Logger:               slog.New(slog.NewJSONHandler(&logBuf, nil)),
+	})
+	if err != nil {
+		t.Fatalf("NewWithBaseMap() failed: %v", err)
+	}
+
+	// Hold the only render slot, so the request waits 200ms before a fast render
+	if err := srv.renders.acquire(context.Background()); err != nil {
+		t.Fatalf("acquire() failed: %v", err)
+	}
+	time.AfterFunc(200*time.Millisecond, srv.renders.release)
+	fetchTileBytes(t, srv.Handler(), "/1/0/0.png")
+
+	entries := slowLogEntries(t, logBuf.String())
+	if len(entries) != 1 {
+		t.Fatalf("Expected one slow request logged, got %d:\n%s", len(entries), logBuf.String())
+	}
+	if wait, _ := entries[0]["queue_wait"].(float64); time.Duration(wait) < 150*time.Millisecond {
+		t.Errorf("Expected the render slot wait to be reported, got %v", time.Duration(wait))
+	}
+}
+
+func TestSlowRequestLog_Disabled(t *testing.T) {
+	var logBuf syncBuffer
+	srv, err := NewWithBaseMap(solidBaseMap(color.RGBA{}), Config{Logger: slog.New(slog.NewJSONHandler(&logBuf, nil))})
+	if err != nil {
+		t.Fatalf("NewWithBaseMap() failed: %v", err)
+	}
+	srv.render = ctxSleepRender(50 * time.Millisecond)
+
+	fetchTileBytes(t, srv.Handler(), "/1/0/0.png")
+	if entries := slowLogEntries(t, logBuf.String()); len(entries) != 0 {
+		t.Errorf("Expected no slow request log by default, got %v", entries)
+	}
+}
+
+func TestNew_NegativeSlowRequestThreshold(t *testing.T) {
+	if _, err := NewWithBaseMap(solidBaseMap(color.RGBA{}), Config{SlowRequestThreshold: -time.Second}); err == nil {
+		t.Error("Expected error for a negative slow request threshold")
+	}
+}
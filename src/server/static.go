@@ -0,0 +1,76 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+)
+
+// staticSite serves a user-provided directory in place of the viewer
+type staticSite struct {
+	files fs.FS // Confined to the directory; symlinks cannot escape it
+	spa   bool  // Serve index.html for unknown non-tile paths
+}
+
+// newStaticSite opens dir for serving. With spa, dir must contain index.html.
+func newStaticSite(dir string, spa bool) (*staticSite, error) {
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		return nil, fmt.Errorf("invalid static directory: %w", err)
+	}
+	site := &staticSite{files: root.FS(), spa: spa}
+	if spa {
+		if _, err := fs.Stat(site.files, "index.html"); err != nil {
+			return nil, fmt.Errorf("SPA fallback requires index.html in the static directory: %w", err)
+		}
+	}
+	return site, nil
+}
+
+// resolve maps a URL path to the file to serve: the file itself, or
+// index.html for directories. ok is false if there is no such file.
+func (site *staticSite) resolve(urlPath string) (name string, ok bool) {
+	name = strings.TrimPrefix(path.Clean("/"+urlPath), "/")
+	if name == "" {
+		name = "."
+	}
+	info, err := fs.Stat(site.files, name)
+	if err == nil && info.IsDir() {
+		name = path.Join(name, "index.html")
+		info, err = fs.Stat(site.files, name)
+	}
+	return name, err == nil && info.Mode().IsRegular()
+}
+
+// serve writes the file at r.URL.Path, falling back to index.html in SPA
+// mode. Directories are never listed.
+func (site *staticSite) serve(w http.ResponseWriter, r *http.Request) {
+	name, ok := site.resolve(r.URL.Path)
+	if !ok && site.spa && (r.Method == http.MethodGet || r.Method == http.MethodHead) {
+		name, ok = "index.html", true
+	}
+	if !ok {
+		writeError(w, r, newAPIError(http.StatusNotFound, codeNotFound, "404 page not found"))
+		return
+	}
+
+	// http.FileServer would list directories and redirect .../index.html;
+	// serve the resolved file directly instead
+	f, err := site.files.Open(name)
+	if err != nil {
+		writeError(w, r, newAPIError(http.StatusNotFound, codeNotFound, "404 page not found"))
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	content, seekable := f.(io.ReadSeeker)
+	if err != nil || !seekable {
+		writeError(w, r, newAPIError(http.StatusInternalServerError, codeInternal, "Failed to read file"))
+		return
+	}
+	http.ServeContent(w, r, name, info.ModTime(), content)
+}
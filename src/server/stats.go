@@ -0,0 +1,334 @@
+package server
+
+import (
+	"bytes"
+	"cmp"
+	"fmt"
+	"html/template"
+	"math"
+	"net/http"
+	"runtime"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// renderBuckets are the upper bounds of the render time histogram. Renders
+// slower than the last bound fall in an extra, unbounded bucket.
+var renderBuckets = [...]time.Duration{
+	time.Millisecond, 2 * time.Millisecond, 5 * time.Millisecond,
+	10 * time.Millisecond, 20 * time.Millisecond, 50 * time.Millisecond,
+	100 * time.Millisecond, 200 * time.Millisecond, 500 * time.Millisecond,
+	time.Second, 2 * time.Second, 5 * time.Second,
+}
+
+// renderHistogram counts render times in renderBuckets without locking
+type renderHistogram struct {
+	counts [len(renderBuckets) + 1]atomic.Int64
+}
+
+// observe counts a render that took d
+func (h *renderHistogram) observe(d time.Duration) {
+	i, _ := slices.BinarySearch(renderBuckets[:], d)
+	h.counts[i].Add(1)
+}
+
+// snapshot returns the count in each bucket
+func (h *renderHistogram) snapshot() [len(renderBuckets) + 1]int64 {
+	var counts [len(renderBuckets) + 1]int64
+	for i := range h.counts {
+		counts[i] = h.counts[i].Load()
+	}
+	return counts
+}
+
+// percentile estimates the render time below which the fraction p of the
+// counted renders fell, as the upper bound of its bucket. It returns 0 before
+// any render and, for the unbounded bucket, the last bound with ok false.
+func percentile(counts [len(renderBuckets) + 1]int64, p float64) (d time.Duration, ok bool) {
+	var total int64
+	for _, n := range counts {
+		total += n
+	}
+	if total == 0 {
+		return 0, true
+	}
+	rank := int64(p*float64(total-1)) + 1
+	var seen int64
+	for i, n := range counts[:len(renderBuckets)] {
+		if seen += n; seen >= rank {
+			return renderBuckets[i], true
+		}
+	}
+	return renderBuckets[len(renderBuckets)-1], false
+}
+
+// tileCounterShards is how many independently locked maps tileCounter
+// spreads tiles over, so concurrent requests rarely contend
+const tileCounterShards = 16
+
+// maxCountedTiles bounds the memory tileCounter uses: once a shard holds
+// its share, a tile it has not seen replaces its least requested one
+const maxCountedTiles = 4096
+
+// tileID identifies a tile of a layer
+type tileID struct {
+	layer   string
+	z, x, y int
+}
+
+// tileCounter counts requests per tile for the busiest tiles on /stats.
+// It keeps a bounded number of tiles with the space-saving algorithm: a new
+// tile takes over the count of the tile it evicts, so counts are exact until
+// a shard fills up and overestimates after that, but a tile that becomes
+// busy later still rises to the top.
+type tileCounter struct {
+	shards [tileCounterShards]struct {
+		mu     sync.Mutex
+		counts map[tileID]int64
+	}
+}
+
+// count counts a request for t
+func (c *tileCounter) count(t tileID) {
+	sh := &c.shards[uint(t.z*31+t.x*17+t.y)%tileCounterShards]
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	if _, ok := sh.counts[t]; !ok {
+		if sh.counts == nil {
+			sh.counts = map[tileID]int64{}
+		}
+		if len(sh.counts) >= maxCountedTiles/tileCounterShards {
+			var least tileID
+			leastCount := int64(math.MaxInt64)
+			for id, count := range sh.counts {
+				if count < leastCount {
+					least, leastCount = id, count
+				}
+			}
+			delete(sh.counts, least)
+			sh.counts[t] = leastCount
+		}
+	}
+	sh.counts[t]++
+}
+
+// tileCount is a tile and how often it was requested
+type tileCount struct {
+	tileID
+	Count int64
+}
+
+// top returns the n most requested tiles, most requested first
+func (c *tileCounter) top(n int) []tileCount {
+	var all []tileCount
+	for i := range c.shards {
+		sh := &c.shards[i]
+		sh.mu.Lock()
+		for t, count := range sh.counts {
+			all = append(all, tileCount{t, count})
+		}
+		sh.mu.Unlock()
+	}
+	slices.SortFunc(all, func(a, b tileCount) int {
+		if c := cmp.Compare(b.Count, a.Count); c != 0 {
+			return c
+		}
+		return cmp.Or(cmp.Compare(a.layer, b.layer), cmp.Compare(a.z, b.z), cmp.Compare(a.x, b.x), cmp.Compare(a.y, b.y))
+	})
+	return all[:min(n, len(all))]
+}
+
+// statsTopTiles is how many of the most requested tiles /stats lists
+const statsTopTiles = 10
+
+// statsRefresh is how often the /stats page reloads itself
+const statsRefresh = 5 * time.Second
+
+// statsTemplate shows the server's counters as small tables
+var statsTemplate = template.Must(template.New("stats").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="utf-8">
+    <meta http-equiv="refresh" content="{{.Refresh}}">
+    <title>xyztiles - statistics</title>
+    <style>
+        body { font-family: sans-serif; margin: 16px; }
+        table { border-collapse: collapse; margin-bottom: 16px; }
+        th, td { padding: 2px 12px 2px 0; text-align: left; }
+        td.n { text-align: right; font-variant-numeric: tabular-nums; }
+        caption { text-align: left; font-weight: bold; padding-bottom: 4px; }
+    </style>
+</head>
+<body>
+    <h1>xyztiles</h1>
+    <table>
+        <caption>Server</caption>
+        <tr><th>Uptime</th><td class="n" id="uptime">{{.Uptime}}</td></tr>
+        <tr><th>Tiles served</th><td class="n" id="tiles-served">{{.TilesServed}}</td></tr>
+        <tr><th>Heap in use</th><td class="n">{{.HeapBytes}}</td></tr>
+        <tr><th>Memory from the OS</th><td class="n">{{.SysBytes}}</td></tr>
+        <tr><th>Goroutines</th><td class="n">{{.Goroutines}}</td></tr>
+    </table>
+    <table>
+        <caption>Tile cache</caption>
+{{- if .Cache}}
+        <tr><th>Hits</th><td class="n" id="cache-hits">{{.Cache.Hits}}</td></tr>
+        <tr><th>Misses</th><td class="n" id="cache-misses">{{.Cache.Misses}}</td></tr>
+        <tr><th>Hit ratio</th><td class="n" id="cache-hit-ratio">{{printf "%.1f%%" .CacheHitPercent}}</td></tr>
+        <tr><th>Tiles held</th><td class="n">{{.Cache.Entries}}</td></tr>
+{{- else}}
+        <tr><td>Disabled</td></tr>
+{{- end}}
+    </table>
+    <table>
+        <caption>Render slots</caption>
+        <tr><th>Rendering</th><td class="n" id="renders-in-flight">{{.RenderSlots.InFlight}}</td></tr>
+        <tr><th>Waiting</th><td class="n" id="renders-queued">{{.RenderSlots.Queued}}</td></tr>
+        <tr><th>Limit</th><td class="n" id="renders-limit">{{.RenderSlots.Limit}}</td></tr>
+    </table>
+    <table>
+        <caption>Render times</caption>
+        <tr><th>Renders</th><td class="n" id="renders">{{.Renders}}</td></tr>
+        <tr><th>Average</th><td class="n">{{.RenderMean}}</td></tr>
+{{- range .RenderPercentiles}}
+        <tr><th>{{.Name}}</th><td class="n">{{.Value}}</td></tr>
+{{- end}}
+    </table>
+    <table>
+        <caption>Tiles served by zoom</caption>
+        <tr><th>Zoom</th><th>Tiles</th></tr>
+{{- range .ByZoom}}
+        <tr><td>{{.Zoom}}</td><td class="n" id="zoom-{{.Zoom}}">{{.Tiles}}</td></tr>
+{{- end}}
+    </table>
+    <table>
+        <caption>Most requested tiles</caption>
+        <tr><th>Layer</th><th>Tile</th><th>Requests</th></tr>
+{{- range .TopTiles}}
+        <tr><td>{{.Layer}}</td><td>{{.Tile}}</td><td class="n">{{.Count}}</td></tr>
+{{- end}}
+    </table>
+</body>
+</html>
+`))
+
+// statsData holds the values injected into statsTemplate
+type statsData struct {
+	Refresh           int // Seconds between reloads
+	Uptime            time.Duration
+	TilesServed       int64
+	HeapBytes         string
+	SysBytes          string
+	Goroutines        int
+	Cache             *cacheStats // nil without a cache
+	CacheHitPercent   float64
+	RenderSlots       RenderStats
+	Renders           int64
+	RenderMean        time.Duration
+	RenderPercentiles []statsRow
+	ByZoom            []statsZoom // Zooms with no tiles are left out
+	TopTiles          []statsTile
+}
+
+// statsRow is a named value on /stats
+type statsRow struct {
+	Name  string
+	Value string
+}
+
+// statsZoom is the number of tiles served at one zoom
+type statsZoom struct {
+	Zoom  int
+	Tiles int64
+}
+
+// statsTile is one of the most requested tiles
+type statsTile struct {
+	Layer string
+	Tile  string // z/x/y
+	Count int64
+}
+
+// statsData snapshots the counters for /stats
+func (s *Server) statsData() statsData {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	data := statsData{
+		Refresh:     int(statsRefresh / time.Second),
+		Uptime:      time.Since(s.vars.started).Round(time.Second),
+		HeapBytes:   formatByteCount(mem.HeapInuse),
+		SysBytes:    formatByteCount(mem.Sys),
+		Goroutines:  runtime.NumGoroutine(),
+		RenderSlots: s.renders.stats(),
+	}
+	for z := range s.vars.tilesServed {
+		if n := s.vars.tilesServed[z].Load(); n > 0 {
+			data.TilesServed += n
+			data.ByZoom = append(data.ByZoom, statsZoom{Zoom: z, Tiles: n})
+		}
+	}
+	if s.cache != nil {
+		stats := s.cache.stats()
+		data.Cache = &stats
+		data.CacheHitPercent = 100 * stats.HitRatio
+	}
+
+	counts := s.vars.renderTimes.snapshot()
+	for _, n := range counts {
+		data.Renders += n
+	}
+	if data.Renders > 0 {
+		data.RenderMean = (time.Duration(s.vars.renderNanos.Load()) / time.Duration(data.Renders)).Round(time.Microsecond)
+	}
+	for _, p := range []struct {
+		name string
+		p    float64
+	}{{"Median", 0.5}, {"90th percentile", 0.9}, {"99th percentile", 0.99}} {
+		d, ok := percentile(counts, p.p)
+		value := "at most " + d.String()
+		if !ok {
+			value = "over " + d.String()
+		}
+		if data.Renders == 0 {
+			value = "-"
+		}
+		data.RenderPercentiles = append(data.RenderPercentiles, statsRow{Name: p.name, Value: value})
+	}
+
+	for _, t := range s.vars.tiles.top(statsTopTiles) {
+		data.TopTiles = append(data.TopTiles, statsTile{Layer: t.layer, Tile: fmt.Sprintf("%d/%d/%d", t.z, t.x, t.y), Count: t.Count})
+	}
+	return data
+}
+
+// formatByteCount formats n bytes in binary units, e.g. 1.5 MiB
+func formatByteCount(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := uint64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// handleStats serves an HTML page summarizing what the server has done
+// since it started, from the counters behind /debug/vars. It reloads itself
+// every statsRefresh.
+func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
+	var buf bytes.Buffer
+	if err := statsTemplate.Execute(&buf, s.statsData()); err != nil {
+		s.logger.Error("Error rendering stats", "request_id", requestID(r.Context()), "err", err)
+		writeError(w, r, newAPIError(http.StatusInternalServerError, codeInternal, "Failed to render stats"))
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(buf.Bytes())
+}
@@ -0,0 +1,212 @@
+package server
+
+import (
+	"image/color"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHandleStats(t *testing.T) {
+	night := Layer{Name: "night", BaseMap: solidBaseMap(color.RGBA{})}
+	srv, err := NewWithBaseMap(solidBaseMap(color.RGBA{0, 0, 255, 255}), Config{
+		DebugVars:     true,
+		CacheMaxBytes: 1 << 20,
+		Layers:        []Layer{night},
+	})
+	if err != nil {
+		t.Fatalf("NewWithBaseMap() failed: %v", err)
+	}
+
+	// Four tiles at zoom 1, one of them three times, one at zoom 2 and a bad path
+	for _, path := range []string{"/1/0/0.png", "/1/0/0.png", "/1/0/0.png", "/1/1/1.png", "/night/1/0/1.png", "/2/3/3.png", "/9/0/0/0.png"} {
+		w := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+	}
+
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/stats", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "text/html; charset=utf-8" {
+		t.Errorf("Expected Content-Type text/html; charset=utf-8, got %s", ct)
+	}
+
+	body := w.Body.String()
+	for _, want := range []string{
+		`<meta http-equiv="refresh" content="5">`,
+		`id="tiles-served">6<`,
+		`id="zoom-1">5<`,
+		`id="zoom-2">1<`,
+		`id="cache-hits">2<`,
+		`id="cache-misses">4<`,
+		`id="cache-hit-ratio">33.3%<`,
+		`id="renders">4<`,
+		`<td>default</td><td>1/0/0</td><td class="n">3</td>`,
+		`<td>night</td><td>1/0/1</td><td class="n">1</td>`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected the page to contain %q", want)
+		}
+	}
+	if strings.Contains(body, `id="zoom-9"`) {
+		t.Error("Expected no row for a zoom without tiles")
+	}
+	// The most requested tile is listed first
+	if strings.Index(body, "1/0/0") > strings.Index(body, "1/1/1") {
+		t.Error("Expected the tiles ordered by requests")
+	}
+}
+
+func TestHandleStats_Renders(t *testing.T) {
+	srv, err := NewWithBaseMap(solidBaseMap(color.RGBA{}), Config{DebugVars: true, MaxConcurrentRenders: 1})
+	if err != nil {
+		t.Fatalf("NewWithBaseMap() failed: %v", err)
+	}
+	holdRenderSlots(t, srv)
+
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/stats", nil))
+	body := w.Body.String()
+	for _, want := range []string{`id="renders-in-flight">1<`, `id="renders-queued">1<`, `id="renders-limit">1<`} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected the page to contain %q", want)
+		}
+	}
+}
+
+func TestHandleStats_Disabled(t *testing.T) {
+	srv, err := NewWithBaseMap(solidBaseMap(color.RGBA{}), Config{})
+	if err != nil {
+		t.Fatalf("NewWithBaseMap() failed: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/stats", nil))
+	if w.Code == http.StatusOK {
+		t.Errorf("Expected /stats to be off by default, got status %d", w.Code)
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	var h renderHistogram
+	for range 90 {
+		h.observe(3 * time.Millisecond)
+	}
+	for range 9 {
+		h.observe(150 * time.Millisecond)
+	}
+	h.observe(time.Minute)
+	counts := h.snapshot()
+
+	tests := []struct {
+		p        float64
+		expected time.Duration
+		expectOK bool
+		name     string
+	}{
+		{0.5, 5 * time.Millisecond, true, "median"},
+		{0.9, 5 * time.Millisecond, true, "90th"},
+		{0.95, 200 * time.Millisecond, true, "95th"},
+		{1, 5 * time.Second, false, "slowest beyond the buckets"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := percentile(counts, tt.p)
+			if got != tt.expected || ok != tt.expectOK {
+				t.Errorf("Expected %v, %v, got %v, %v", tt.expected, tt.expectOK, got, ok)
+			}
+		})
+	}
+
+	if d, ok := percentile([len(renderBuckets) + 1]int64{}, 0.5); d != 0 || !ok {
+		t.Errorf("Expected 0 before any render, got %v, %v", d, ok)
+	}
+}
+
+func TestTileCounter(t *testing.T) {
+	var c tileCounter
+	var wg sync.WaitGroup
+	for i := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 100 {
+				c.count(tileID{layer: "default", z: 3, x: 1, y: 2})
+			}
+			c.count(tileID{layer: "default", z: 4, x: i, y: 0})
+		}()
+	}
+	wg.Wait()
+
+	top := c.top(2)
+	if len(top) != 2 || top[0].Count != 800 || top[0].z != 3 {
+		t.Fatalf("Expected 3/1/2 first with 800 requests, got %+v", top)
+	}
+	if top[1].Count != 1 || top[1].z != 4 || top[1].x != 0 {
+		t.Errorf("Expected ties ordered by tile, got %+v", top[1])
+	}
+}
+
+func TestTileCounter_Bounded(t *testing.T) {
+	var c tileCounter
+	for x := range 2 * maxCountedTiles {
+		for y := range 4 {
+			c.count(tileID{z: 12, x: x, y: y})
+		}
+	}
+	if n := len(c.top(3 * maxCountedTiles)); n > maxCountedTiles {
+		t.Errorf("Expected at most %d tiles counted, got %d", maxCountedTiles, n)
+	}
+}
+
+func TestTileCounter_LateTile(t *testing.T) {
+	var c tileCounter
+	early := tileID{z: 3, x: 1, y: 2}
+	for range 5 {
+		c.count(early)
+	}
+	for x := range 2 * maxCountedTiles {
+		c.count(tileID{z: 12, x: x})
+	}
+
+	// A tile first requested once the counter is full still becomes the top tile
+	late := tileID{z: 14, x: 100, y: 200}
+	for range 10 {
+		c.count(late)
+	}
+	top := c.top(2)
+	if len(top) != 2 || top[0].tileID != late {
+		t.Fatalf("Expected %v first, got %+v", late, top)
+	}
+	if top[1].tileID != early {
+		t.Errorf("Expected %v second, got %+v", early, top[1])
+	}
+}
+
+func TestFormatByteCount(t *testing.T) {
+	tests := []struct {
+		n        uint64
+		expected string
+		name     string
+	}{
+		{0, "0 B", "zero"},
+		{1023, "1023 B", "bytes"},
+		{1536, "1.5 KiB", "kibibytes"},
+		{64 << 20, "64.0 MiB", "mebibytes"},
+		{3 << 30, "3.0 GiB", "gibibytes"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := formatByteCount(tt.n); got != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, got)
+			}
+		})
+	}
+}
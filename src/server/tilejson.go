@@ -0,0 +1,163 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"org.xyzmaps.xyztiles/src/imagery"
+)
+
+// TileJSONVersion is the TileJSON specification version served at /tilejson.json
+const TileJSONVersion = "3.0.0"
+
+// tileJSON is a TileJSON document describing the served tileset.
+// See https://github.com/mapbox/tilejson-spec
+type tileJSON struct {
+	TileJSON string     `json:"tilejson"`
+	Name     string     `json:"name"`
+	Scheme   string     `json:"scheme"`
+	Tiles    []string   `json:"tiles"`
+	MinZoom  int        `json:"minzoom"`
+	MaxZoom  int        `json:"maxzoom"`
+	Bounds   [4]float64 `json:"bounds"`
+	TileSize int        `json:"tileSize"` // Edge length of tiles in pixels without ?size=
+
+	Attribution string `json:"attribution,omitempty"` // HTML crediting the imagery
+
+	// NativeMaxZoom is the highest zoom with full source detail; tiles up to
+	// MaxZoom beyond it are upsampled (an xyztiles extension to TileJSON)
+	NativeMaxZoom int `json:"native_maxzoom"`
+
+	// Resampling lists the interpolation kernel tiles are resampled with at
+	// each served zoom; empty for a layer served from an MBTiles archive,
+	// whose tiles are not resampled (an xyztiles extension to TileJSON)
+	Resampling []tileJSONKernel `json:"resampling,omitempty"`
+
+	// Layers lists every served layer when there is more than one
+	// (an xyztiles extension to TileJSON)
+	Layers []tileJSONLayer `json:"layers,omitempty"`
+}
+
+// tileJSONLayer describes one layer in tileJSON.Layers
+type tileJSONLayer struct {
+	Name     string   `json:"name"`
+	Tiles    []string `json:"tiles"`
+	TileJSON string   `json:"tilejson_url"` // TileJSON document of just this layer
+}
+
+// tileJSONKernel is the kernel of one zoom in tileJSON.Resampling
+type tileJSONKernel struct {
+	Zoom   int            `json:"zoom"`
+	Kernel imagery.Kernel `json:"kernel"`
+}
+
+// handleTileJSON serves a TileJSON document with absolute tile URLs for the
+// layer named by the layer query parameter, or the default layer
+func (s *Server) handleTileJSON(w http.ResponseWriter, r *http.Request) {
+	l, err := s.layerFromQuery(r.URL.Query().Get("layer"))
+	if err != nil {
+		writeError(w, r, newAPIError(http.StatusNotFound, codeUnknownLayer, err.Error()))
+		return
+	}
+
+	origin := requestOrigin(r, s.trustProxy) + s.basePath
+	name := "xyztiles"
+	if l != s.defLayer {
+		name += " " + l.name
+	}
+	doc := tileJSON{
+		TileJSON: TileJSONVersion,
+		Name:     name,
+		Scheme:   "xyz",
+		Tiles:    []string{s.tileURL(origin, l)},
+		MinZoom:  l.minZoom,
+		MaxZoom:  l.maxZoom,
+		Bounds:   s.servedBounds(),
+		TileSize: imagery.TileSize,
+
+		Attribution: l.attribution,
+
+		NativeMaxZoom: min(l.nativeMaxZoom(), l.maxZoom),
+	}
+	if l.archive == nil {
+		for z := l.minZoom; z <= l.maxZoom; z++ {
+			doc.Resampling = append(doc.Resampling, tileJSONKernel{Zoom: z, Kernel: s.kernels.Kernel(z, l.nativeMaxZoom())})
+		}
+	}
+	if len(s.layerNames) > 1 {
+		for _, n := range s.layerNames {
+			doc.Layers = append(doc.Layers, tileJSONLayer{
+				Name:     n,
+				Tiles:    []string{s.tileURL(origin, s.layers[n])},
+				TileJSON: origin + "/tilejson.json?layer=" + n,
+			})
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	if err := json.NewEncoder(w).Encode(doc); err != nil {
+		s.logger.Error("Error encoding TileJSON", "request_id", requestID(r.Context()), "err", err)
+	}
+}
+
+// tileURL returns the tile URL template of l under prefix
+func (s *Server) tileURL(prefix string, l *layer) string {
+	return prefix + s.tilePrefix(l) + "/{z}/{x}/{y}" + l.formats.Default.Extension()
+}
+
+// requestOrigin returns the scheme and host the client used, e.g.
+// "http://localhost:8080". When trustProxy is set, the scheme and host the
+// nearest proxy reports in X-Forwarded-Proto and X-Forwarded-Host, or else
+// in Forwarded, take precedence, so that behind a TLS-terminating proxy the
+// URLs point at the proxy rather than the internal address.
+func requestOrigin(r *http.Request, trustProxy bool) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	host := r.Host
+	if trustProxy {
+		proto, fwdHost := forwardedOrigin(r.Header)
+		if proto = strings.ToLower(proto); proto == "http" || proto == "https" {
+			scheme = proto
+		}
+		if fwdHost != "" && !strings.ContainsAny(fwdHost, "/\\@?# \t") {
+			host = fwdHost
+		}
+	}
+	return scheme + "://" + host
+}
+
+// forwardedOrigin returns the scheme and host in the proxy headers of h,
+// taking the right-most entry of each list as clientIP does: the one the
+// nearest proxy appended
+func forwardedOrigin(h http.Header) (proto, host string) {
+	proto = lastListEntry(h.Get("X-Forwarded-Proto"))
+	host = lastListEntry(h.Get("X-Forwarded-Host"))
+	if proto != "" || host != "" {
+		return proto, host
+	}
+
+	// Forwarded: for=192.0.2.1;proto=https;host=tiles.example.com (RFC 7239)
+	for _, pair := range strings.Split(lastListEntry(h.Get("Forwarded")), ";") {
+		key, value, _ := strings.Cut(strings.TrimSpace(pair), "=")
+		value = strings.Trim(value, `"`)
+		switch strings.ToLower(key) {
+		case "proto":
+			proto = value
+		case "host":
+			host = value
+		}
+	}
+	return proto, host
+}
+
+// lastListEntry returns the last entry of a comma-separated header value
+func lastListEntry(v string) string {
+	if i := strings.LastIndexByte(v, ','); i >= 0 {
+		v = v[i+1:]
+	}
+	return strings.TrimSpace(v)
+}
@@ -0,0 +1,177 @@
+package server
+
+import (
+	"encoding/json"
+	"image/color"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"org.xyzmaps.xyztiles/src/imagery"
+	"org.xyzmaps.xyztiles/src/tilemath"
+)
+
+func TestHandleTileJSON(t *testing.T) {
+	srv := createTestServer(t)
+
+	req := httptest.NewRequest("GET", "http://tiles.example.com/tilejson.json", nil)
+	w := httptest.NewRecorder()
+
+	srv.Handler().ServeHTTP(w, req)
+
+	resp := w.Result()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+	}
+
+	if ct := resp.Header.Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Expected Content-Type application/json, got %s", ct)
+	}
+
+	var doc tileJSON
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		t.Fatalf("Failed to decode TileJSON: %v", err)
+	}
+
+	if doc.TileJSON != TileJSONVersion {
+		t.Errorf("Expected tilejson %s, got %s", TileJSONVersion, doc.TileJSON)
+	}
+
+	if len(doc.Tiles) != 1 || doc.Tiles[0] != "http://tiles.example.com/{z}/{x}/{y}.png" {
+		t.Errorf("Unexpected tiles: %v", doc.Tiles)
+	}
+
+	expectBounds := [4]float64{-180, -tilemath.MaxLatitude, 180, tilemath.MaxLatitude}
+	if doc.Bounds != expectBounds {
+		t.Errorf("Expected bounds %v, got %v", expectBounds, doc.Bounds)
+	}
+	if doc.TileSize != 512 {
+		t.Errorf("Expected tile size 512, got %d", doc.TileSize)
+	}
+
+	// The served range defaults to the native max zoom plus the overzoom allowance
+	expectMax := srv.defLayer.baseMap().NativeMaxZoom() + DefaultOverzoomLimit
+	if doc.MinZoom != 0 || doc.MaxZoom != expectMax {
+		t.Errorf("Expected zoom range 0-%d, got %d-%d", expectMax, doc.MinZoom, doc.MaxZoom)
+	}
+}
+
+func TestHandleTileJSON_Attribution(t *testing.T) {
+	night := Layer{Name: "night", BaseMap: solidBaseMap(color.RGBA{}), Attribution: `<a href="https://example.com/night">Night Survey</a>`}
+
+	tests := []struct {
+		cfg    Config
+		path   string
+		expect string
+		name   string
+	}{
+		{Config{}, "/tilejson.json", "", "none"},
+		{Config{Attribution: "© NASA Blue Marble"}, "/tilejson.json", "© NASA Blue Marble", "verbatim"},
+		{Config{Attribution: "NASA <script>alert(1)</script>"}, "/tilejson.json", "NASA &lt;script&gt;alert(1)&lt;/script&gt;", "markup escaped"},
+		{Config{Attribution: "© NASA", Layers: []Layer{night}}, "/tilejson.json?layer=night", `<a href="https://example.com/night">Night Survey</a>`, "per layer"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, err := NewWithBaseMap(solidBaseMap(color.RGBA{}), tt.cfg)
+			if err != nil {
+				t.Fatalf("NewWithBaseMap() failed: %v", err)
+			}
+			w := httptest.NewRecorder()
+			srv.Handler().ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+
+			var doc map[string]any
+			if err := json.NewDecoder(w.Body).Decode(&doc); err != nil {
+				t.Fatalf("Failed to decode TileJSON: %v", err)
+			}
+			got, ok := doc["attribution"]
+			if tt.expect == "" {
+				if ok {
+					t.Errorf("Expected no attribution, got %q", got)
+				}
+				return
+			}
+			if got != tt.expect {
+				t.Errorf("Expected attribution %q, got %q", tt.expect, got)
+			}
+		})
+	}
+}
+
+func TestHandleTileJSON_Resampling(t *testing.T) {
+	// Zoom 0 is bilinear, upscaled zooms past native zoom 1 nearest
+	kernels, err := imagery.ParseKernelTable("0=bilinear,+1-=nearest")
+	if err != nil {
+		t.Fatalf("ParseKernelTable() failed: %v", err)
+	}
+	srv, err := NewWithBaseMap(solidBaseMap(color.RGBA{}), Config{InterpByZoom: kernels, MaxZoom: 3})
+	if err != nil {
+		t.Fatalf("NewWithBaseMap() failed: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/tilejson.json", nil))
+	var doc tileJSON
+	if err := json.NewDecoder(w.Body).Decode(&doc); err != nil {
+		t.Fatalf("Failed to decode TileJSON: %v", err)
+	}
+	expect := []tileJSONKernel{
+		{0, imagery.KernelBiLinear},
+		{1, imagery.ResampleKernel},
+		{2, imagery.KernelNearest},
+		{3, imagery.KernelNearest},
+	}
+	if !reflect.DeepEqual(doc.Resampling, expect) {
+		t.Errorf("Expected resampling %v, got %v", expect, doc.Resampling)
+	}
+
+	// Archive tiles are served as stored
+	archive, err := New(Config{MBTilesPath: testArchivePath})
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+	w = httptest.NewRecorder()
+	archive.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/tilejson.json", nil))
+	if strings.Contains(w.Body.String(), `"resampling"`) {
+		t.Errorf("Expected no resampling for an archive, got %s", w.Body.String())
+	}
+}
+
+func TestHandleTileJSON_ForwardedOrigin(t *testing.T) {
+	tests := []struct {
+		trustProxy bool
+		header     http.Header
+		expect     string
+		name       string
+	}{
+		{true, http.Header{"X-Forwarded-Proto": {"https"}, "X-Forwarded-Host": {"tiles.example.com"}}, "https://tiles.example.com/{z}/{x}/{y}.png", "x-forwarded"},
+		{true, http.Header{"X-Forwarded-Proto": {"HTTPS"}}, "https://10.0.0.5:8080/{z}/{x}/{y}.png", "proto only"},
+		{true, http.Header{"X-Forwarded-Proto": {"http, https"}, "X-Forwarded-Host": {"spoofed.example.com, tiles.example.com"}}, "https://tiles.example.com/{z}/{x}/{y}.png", "nearest proxy wins"},
+		{true, http.Header{"Forwarded": {`for=192.0.2.1;proto=https;host="tiles.example.com"`}}, "https://tiles.example.com/{z}/{x}/{y}.png", "forwarded"},
+		{true, http.Header{"X-Forwarded-Proto": {"gopher"}, "X-Forwarded-Host": {"evil.example.com/x"}}, "http://10.0.0.5:8080/{z}/{x}/{y}.png", "invalid values ignored"},
+		{false, http.Header{"X-Forwarded-Proto": {"https"}, "X-Forwarded-Host": {"tiles.example.com"}}, "http://10.0.0.5:8080/{z}/{x}/{y}.png", "untrusted"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, err := NewWithBaseMap(solidBaseMap(color.RGBA{}), Config{TrustProxy: tt.trustProxy})
+			if err != nil {
+				t.Fatalf("NewWithBaseMap() failed: %v", err)
+			}
+			req := httptest.NewRequest("GET", "http://10.0.0.5:8080/tilejson.json", nil)
+			req.Header = tt.header
+			w := httptest.NewRecorder()
+			srv.Handler().ServeHTTP(w, req)
+
+			var doc tileJSON
+			if err := json.NewDecoder(w.Body).Decode(&doc); err != nil {
+				t.Fatalf("Failed to decode TileJSON: %v", err)
+			}
+			if len(doc.Tiles) != 1 || doc.Tiles[0] != tt.expect {
+				t.Errorf("Expected tiles [%s], got %v", tt.expect, doc.Tiles)
+			}
+		})
+	}
+}
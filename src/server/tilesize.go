@@ -0,0 +1,26 @@
+package server
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+
+	"org.xyzmaps.xyztiles/src/imagery"
+)
+
+// tileSizes are the tile edge lengths in pixels a tile request may ask for
+// with ?size=. Without it tiles are imagery.TileSize pixels.
+var tileSizes = []int{256, imagery.TileSize, 1024}
+
+// parseTileSize parses the size query parameter of a tile request, an
+// empty value meaning imagery.TileSize
+func parseTileSize(v string) (int, error) {
+	if v == "" {
+		return imagery.TileSize, nil
+	}
+	size, err := strconv.Atoi(v)
+	if err != nil || !slices.Contains(tileSizes, size) {
+		return 0, fmt.Errorf("invalid tile size %q (expected one of %v)", v, tileSizes)
+	}
+	return size, nil
+}
@@ -0,0 +1,107 @@
+package server
+
+import (
+	"bytes"
+	"image/color"
+	"image/png"
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+func TestParseTileSize(t *testing.T) {
+	tests := []struct {
+		value      string
+		expectSize int
+		expectErr  bool
+		name       string
+	}{
+		{"", 512, false, "default"},
+		{"256", 256, false, "256"},
+		{"512", 512, false, "512"},
+		{"1024", 1024, false, "1024"},
+		{"333", 0, true, "not allowed"},
+		{"2048", 0, true, "too large"},
+		{"big", 0, true, "not a number"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			size, err := parseTileSize(tt.value)
+			if (err != nil) != tt.expectErr {
+				t.Fatalf("Expected error: %v, got %v", tt.expectErr, err)
+			}
+			if size != tt.expectSize {
+				t.Errorf("Expected size %d, got %d", tt.expectSize, size)
+			}
+		})
+	}
+}
+
+func TestHandleTile_Size(t *testing.T) {
+	srv, err := NewWithBaseMap(solidBaseMap(color.RGBA{0, 128, 0, 255}), Config{TilesetVersion: "v1"})
+	if err != nil {
+		t.Fatalf("NewWithBaseMap() failed: %v", err)
+	}
+
+	etags := map[string]int{}
+	for _, size := range tileSizes {
+		t.Run(strconv.Itoa(size), func(t *testing.T) {
+			w := fetchTile(t, srv.Handler(), "/1/0/0.png?size="+strconv.Itoa(size), "")
+			if w.Code != http.StatusOK {
+				t.Fatalf("Expected status 200, got %d", w.Code)
+			}
+			if cl := w.Header().Get("Content-Length"); cl != strconv.Itoa(w.Body.Len()) {
+				t.Errorf("Expected Content-Length %d, got %s", w.Body.Len(), cl)
+			}
+			etags[w.Header().Get("ETag")]++
+
+			img, err := png.Decode(w.Body)
+			if err != nil {
+				t.Fatalf("Failed to decode tile: %v", err)
+			}
+			if b := img.Bounds(); b.Dx() != size || b.Dy() != size {
+				t.Errorf("Expected a %dx%d tile, got %dx%d", size, size, b.Dx(), b.Dy())
+			}
+		})
+	}
+	if len(etags) != len(tileSizes) {
+		t.Errorf("Expected a distinct ETag per size, got %v", etags)
+	}
+}
+
+func TestHandleTile_SizeNotAllowed(t *testing.T) {
+	srv, err := NewWithBaseMap(solidBaseMap(color.RGBA{}), Config{})
+	if err != nil {
+		t.Fatalf("NewWithBaseMap() failed: %v", err)
+	}
+
+	env := fetchError(t, srv.Handler(), "/1/0/0.png?size=333", http.StatusBadRequest)
+	if env.Error.Code != codeInvalidRequest {
+		t.Errorf("Expected code %q, got %q", codeInvalidRequest, env.Error.Code)
+	}
+}
+
+func TestHandleTile_SizeCacheIsolation(t *testing.T) {
+	srv, err := NewWithBaseMap(solidBaseMap(color.RGBA{255, 0, 0, 255}), Config{CacheMaxBytes: 16 << 20})
+	if err != nil {
+		t.Fatalf("NewWithBaseMap() failed: %v", err)
+	}
+
+	small := fetchTile(t, srv.Handler(), "/1/0/0.png?size=256", "")
+	full := fetchTile(t, srv.Handler(), "/1/0/0.png", "")
+	if stats := srv.cache.stats(); stats.Hits != 0 || stats.Misses != 2 {
+		t.Errorf("Expected each size to miss the cache, got %d hits and %d misses", stats.Hits, stats.Misses)
+	}
+	if bytes.Equal(small.Body.Bytes(), full.Body.Bytes()) {
+		t.Error("Expected tiles of different sizes to differ")
+	}
+
+	again := fetchTile(t, srv.Handler(), "/1/0/0.png?size=256", "")
+	if stats := srv.cache.stats(); stats.Hits != 1 {
+		t.Errorf("Expected the second 256 pixel tile to hit the cache, got %d hits", stats.Hits)
+	}
+	if !bytes.Equal(again.Body.Bytes(), small.Body.Bytes()) {
+		t.Error("Expected the cached 256 pixel tile to be served")
+	}
+}
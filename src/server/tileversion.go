@@ -0,0 +1,182 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"org.xyzmaps.xyztiles/src/imagery"
+	"org.xyzmaps.xyztiles/src/tilemath"
+)
+
+// versionPrefix starts tile paths that name a tileset version,
+// /v/{version}/{z}/{x}/{y}
+const versionPrefix = "/v/"
+
+// tilesetVersionPattern restricts TilesetVersion to characters that are
+// safe in a URL path segment and inside a quoted ETag
+var tilesetVersionPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// validateTilesetVersion checks a configured TilesetVersion; empty is valid
+func validateTilesetVersion(v string) error {
+	if v != "" && !tilesetVersionPattern.MatchString(v) {
+		return fmt.Errorf("invalid tileset version %q: must be 1-64 letters, digits, '.', '_' or '-'", v)
+	}
+	return nil
+}
+
+// contentVersion derives a tileset version from the bytes of a source
+// image, the same way asset URLs are versioned
+func contentVersion(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
+
+// fileVersion derives a tileset version from the contents of the image
+// file at path
+func fileVersion(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)[:8]), nil
+}
+
+// splitVersion splits a /v/{version} prefix off a tile path, reporting
+// whether there was one
+func splitVersion(path string) (version, rest string, ok bool) {
+	after, found := strings.CutPrefix(path, versionPrefix)
+	if !found {
+		return "", path, false
+	}
+	version, rest, found = strings.Cut(after, "/")
+	if !found {
+		return "", path, false
+	}
+	return version, "/" + rest, true
+}
+
+// tilePrefix returns the URL path prefix of l's tiles below the base path:
+// its layer path, behind /v/{version} when VersionedTileURLs is set and the
+// layer has a version
+func (s *Server) tilePrefix(l *layer) string {
+	if v := l.tilesetVersion(); s.versionedURLs && v != "" {
+		return versionPrefix + v + s.layerPath(l)
+	}
+	return s.layerPath(l)
+}
+
+// renderOptions are the Config fields that change the bytes of rendered
+// tiles, summarized by renderFingerprint
+type renderOptions struct {
+	FlipVertical, FlipHorizontal bool
+	SourceBounds                 tilemath.Bounds
+	JPEG                         imagery.JPEGOptions
+	AdaptiveQuality              imagery.AdaptiveQuality
+	TileBuffer                   int
+	BackgroundColor              string
+	InterpByZoom                 string
+	CollapseUniformTiles         bool
+	UniformTolerance             int
+	DebugTiles                   bool
+}
+
+// renderFingerprint hashes the options cfg renders tiles with, or returns ""
+// when they are all at their defaults, so a restart with other options
+// neither revalidates nor shares tiles rendered with the old ones
+func renderFingerprint(cfg Config) string {
+	opts := renderOptions{
+		FlipVertical:         cfg.FlipVertical,
+		FlipHorizontal:       cfg.FlipHorizontal,
+		JPEG:                 cfg.JPEGOptions,
+		AdaptiveQuality:      cfg.AdaptiveQuality,
+		TileBuffer:           cfg.TileBuffer,
+		BackgroundColor:      strings.ToLower(cfg.BackgroundColor),
+		CollapseUniformTiles: cfg.CollapseUniformTiles,
+		UniformTolerance:     cfg.UniformTolerance,
+		DebugTiles:           cfg.DebugTiles,
+	}
+	if cfg.SourceBounds != nil {
+		opts.SourceBounds = *cfg.SourceBounds
+	}
+	if len(cfg.InterpByZoom) > 0 {
+		opts.InterpByZoom = cfg.InterpByZoom.String()
+	}
+	if opts == (renderOptions{}) {
+		return ""
+	}
+	return contentVersion(fmt.Appendf(nil, "%+v", opts))[:8]
+}
+
+// withRenderOptions folds a renderFingerprint into a tileset version derived
+// from an image, leaving it as it is for the default options
+func withRenderOptions(version, fingerprint string) string {
+	if fingerprint == "" {
+		return version
+	}
+	return contentVersion([]byte(version + "/" + fingerprint))
+}
+
+// contentTag returns what l's tile ETags and shared cache keys are built
+// from, or "" if the layer has no version: a derived tileset version, which
+// includes the render options already, or a configured one with their
+// fingerprint appended
+func (s *Server) contentTag(l *layer) string {
+	v := l.tilesetVersion()
+	if v == "" || !s.fixedVersion || s.renderFP == "" {
+		return v
+	}
+	return v + "." + s.renderFP
+}
+
+// tileETag returns the ETag of l's tiles in format and size, or "" if the
+// layer has no version. Tiles of one layer share it: an ETag only has to
+// tell representations of the same URL apart.
+func (s *Server) tileETag(l *layer, format imagery.Format, size int) string {
+	v := s.contentTag(l)
+	if v == "" {
+		return ""
+	}
+	if size != imagery.TileSize {
+		return `"` + v + "-" + string(format) + "-" + strconv.Itoa(size) + `"`
+	}
+	return `"` + v + "-" + string(format) + `"`
+}
+
+// etagMatches reports whether an If-None-Match header value lists etag,
+// using the weak comparison RFC 9110 prescribes for it
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// redirectToVersion sends a request for a tile of an older tileset version
+// to the tile's current URL. The redirect is not cached, as the target
+// changes with the next version.
+func (s *Server) redirectToVersion(w http.ResponseWriter, r *http.Request, l *layer, rest string) {
+	target := s.basePath + s.layerPath(l) + rest
+	if v := l.tilesetVersion(); v != "" {
+		target = s.basePath + versionPrefix + v + s.layerPath(l) + rest
+	}
+	if r.URL.RawQuery != "" {
+		target += "?" + r.URL.RawQuery
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	http.Redirect(w, r, target, http.StatusFound)
+}
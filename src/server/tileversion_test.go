@@ -0,0 +1,362 @@
+package server
+
+import (
+	"encoding/json"
+	"image/color"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"org.xyzmaps.xyztiles/src/imagery"
+	"org.xyzmaps.xyztiles/src/tilemath"
+)
+
+// fetchTile requests path from h with the given If-None-Match header, if any
+func fetchTile(t *testing.T, h http.Handler, path, ifNoneMatch string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest("GET", path, nil)
+	if ifNoneMatch != "" {
+		req.Header.Set("If-None-Match", ifNoneMatch)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w
+}
+
+func TestTileETag_VersionChanges(t *testing.T) {
+	etagOf := func(version string) string {
+		t.Helper()
+		srv, err := NewWithBaseMap(solidBaseMap(color.RGBA{0, 0, 255, 255}), Config{TilesetVersion: version})
+		if err != nil {
+			t.Fatalf("NewWithBaseMap() failed: %v", err)
+		}
+		w := fetchTile(t, srv.Handler(), "/1/0/0.png", "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", w.Code)
+		}
+		return w.Header().Get("ETag")
+	}
+
+	first, again, second := etagOf("2024-01"), etagOf("2024-01"), etagOf("2024-02")
+	if first == "" {
+		t.Fatal("Expected an ETag for a versioned tileset")
+	}
+	if first != again {
+		t.Errorf("Expected the same version to give the same ETag, got %s and %s", first, again)
+	}
+	if first == second {
+		t.Errorf("Expected a new version to change the ETag, got %s for both", first)
+	}
+	if etag := etagOf(""); etag != "" {
+		t.Errorf("Expected no ETag for a preloaded base map without a version, got %s", etag)
+	}
+}
+
+func TestTileETag_Formats(t *testing.T) {
+	srv, err := NewWithBaseMap(solidBaseMap(color.RGBA{}), Config{TilesetVersion: "v1"})
+	if err != nil {
+		t.Fatalf("NewWithBaseMap() failed: %v", err)
+	}
+	png := fetchTile(t, srv.Handler(), "/1/0/0.png", "").Header().Get("ETag")
+	jpeg := fetchTile(t, srv.Handler(), "/1/0/0.jpg", "").Header().Get("ETag")
+	if png == jpeg {
+		t.Errorf("Expected different ETags for different formats, got %s for both", png)
+	}
+}
+
+func TestHandleTile_IfNoneMatch(t *testing.T) {
+	srv, err := NewWithBaseMap(solidBaseMap(color.RGBA{}), Config{TilesetVersion: "v1"})
+	if err != nil {
+		t.Fatalf("NewWithBaseMap() failed: %v", err)
+	}
+	etag := fetchTile(t, srv.Handler(), "/1/0/0.png", "").Header().Get("ETag")
+
+	tests := []struct {
+		ifNoneMatch string
+		expectCode  int
+		name        string
+	}{
+		{etag, http.StatusNotModified, "current"},
+		{"W/" + etag, http.StatusNotModified, "weak"},
+		{`"other", ` + etag, http.StatusNotModified, "in a list"},
+		{"*", http.StatusNotModified, "any"},
+		{`"v0-png"`, http.StatusOK, "old version"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := fetchTile(t, srv.Handler(), "/1/0/0.png", tt.ifNoneMatch)
+			if w.Code != tt.expectCode {
+				t.Fatalf("Expected status %d, got %d", tt.expectCode, w.Code)
+			}
+			if got := w.Header().Get("ETag"); got != etag {
+				t.Errorf("Expected ETag %s, got %s", etag, got)
+			}
+			if tt.expectCode == http.StatusNotModified && w.Body.Len() != 0 {
+				t.Errorf("Expected an empty body, got %d bytes", w.Body.Len())
+			}
+		})
+	}
+}
+
+func TestHandleTile_VersionedPath(t *testing.T) {
+	night := Layer{Name: "night", BaseMap: solidBaseMap(color.RGBA{})}
+	srv, err := NewWithBaseMap(solidBaseMap(color.RGBA{}), Config{TilesetVersion: "v2", Layers: []Layer{night}, BasePath: "/maps"})
+	if err != nil {
+		t.Fatalf("NewWithBaseMap() failed: %v", err)
+	}
+
+	tests := []struct {
+		path           string
+		expectCode     int
+		expectCache    string
+		expectLocation string
+		name           string
+	}{
+		{"/maps/v/v2/1/0/0.png", http.StatusOK, "public, max-age=31536000, immutable", "", "current version"},
+		{"/maps/v/v2/night/1/0/0.png", http.StatusOK, "public, max-age=31536000, immutable", "", "current version of a layer"},
+		{"/maps/tile/v/v2/1/0/0.png", http.StatusOK, "public, max-age=31536000, immutable", "", "tile prefix"},
+		{"/maps/1/0/0.png", http.StatusOK, "public, max-age=86400", "", "unversioned"},
+		{"/maps/v/v1/1/0/0.png", http.StatusFound, "no-store", "/maps/v/v2/1/0/0.png", "older version"},
+		{"/maps/v/v1/night/1/0/0.png?x=1", http.StatusFound, "no-store", "/maps/v/v2/night/1/0/0.png?x=1", "older version of a layer"},
+		{"/maps/v/v2/day/1/0/0.png", http.StatusNotFound, "", "", "unknown layer"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := fetchTile(t, srv.Handler(), tt.path, "")
+			if w.Code != tt.expectCode {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectCode, w.Code, w.Body.String())
+			}
+			if tt.expectCache != "" {
+				if got := w.Header().Get("Cache-Control"); got != tt.expectCache {
+					t.Errorf("Expected Cache-Control %q, got %q", tt.expectCache, got)
+				}
+			}
+			if got := w.Header().Get("Location"); got != tt.expectLocation {
+				t.Errorf("Expected Location %q, got %q", tt.expectLocation, got)
+			}
+		})
+	}
+}
+
+func TestNew_DerivedVersion(t *testing.T) {
+	red := color.RGBA{255, 0, 0, 255}
+	blue := color.RGBA{0, 0, 255, 255}
+	path := filepath.Join(t.TempDir(), "world.png")
+	writeSolidPNG(t, path, red)
+
+	srv, err := New(Config{ImagePath: path})
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+	before := fetchTile(t, srv.Handler(), "/1/0/0.png", "").Header().Get("ETag")
+	if before == "" {
+		t.Fatal("Expected an ETag derived from the image file")
+	}
+
+	// Reloading the same image keeps the version
+	if err := srv.Reload(); err != nil {
+		t.Fatalf("Reload() failed: %v", err)
+	}
+	if same := fetchTile(t, srv.Handler(), "/1/0/0.png", "").Header().Get("ETag"); same != before {
+		t.Errorf("Expected an unchanged image to keep ETag %s, got %s", before, same)
+	}
+
+	// A new image gets a new version, and the old ETag no longer matches
+	writeSolidPNG(t, path, blue)
+	if err := srv.Reload(); err != nil {
+		t.Fatalf("Reload() failed: %v", err)
+	}
+	w := fetchTile(t, srv.Handler(), "/1/0/0.png", before)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 for the old ETag, got %d", w.Code)
+	}
+	if after := w.Header().Get("ETag"); after == before {
+		t.Errorf("Expected a new image to change the ETag, got %s for both", after)
+	}
+}
+
+func TestNew_DerivedVersionFixed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "world.png")
+	writeSolidPNG(t, path, color.RGBA{255, 0, 0, 255})
+
+	srv, err := New(Config{ImagePath: path, TilesetVersion: "release-7"})
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+	writeSolidPNG(t, path, color.RGBA{0, 0, 255, 255})
+	if err := srv.Reload(); err != nil {
+		t.Fatalf("Reload() failed: %v", err)
+	}
+	if etag := fetchTile(t, srv.Handler(), "/1/0/0.png", "").Header().Get("ETag"); etag != `"release-7-png"` {
+		t.Errorf("Expected the configured version to survive a reload, got ETag %s", etag)
+	}
+}
+
+func TestNew_DerivedVersionRenderOptions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "world.png")
+	writeSolidPNG(t, path, color.RGBA{255, 0, 0, 255})
+	etagOf := func(cfg Config) string {
+		t.Helper()
+		cfg.ImagePath = path
+		srv, err := New(cfg)
+		if err != nil {
+			t.Fatalf("New() failed: %v", err)
+		}
+		return fetchTile(t, srv.Handler(), "/1/0/0.jpg", "").Header().Get("ETag")
+	}
+	defaults := etagOf(Config{})
+
+	// Each restarts the server with an option changing the tile bytes
+	tests := []struct {
+		cfg  Config
+		name string
+	}{
+		{Config{JPEGOptions: imagery.JPEGOptions{Quality: 60}}, "jpeg quality"},
+		{Config{AdaptiveQuality: imagery.AdaptiveQuality{Min: 50, Max: 90}}, "adaptive quality"},
+		{Config{BackgroundColor: "#102030"}, "background color"},
+		{Config{TileBuffer: 8}, "tile buffer"},
+		{Config{DebugTiles: true}, "debug tiles"},
+		{Config{InterpByZoom: imagery.KernelTable{{MinZoom: 0, MaxZoom: 2, Kernel: imagery.KernelNearest}}}, "interpolation by zoom"},
+		{Config{CollapseUniformTiles: true}, "collapse uniform tiles"},
+		{Config{SourceBounds: &tilemath.Bounds{West: -170, South: -90, East: 190, North: 90}}, "source bounds"},
+		{Config{FlipVertical: true}, "flip"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			etag := etagOf(tt.cfg)
+			if etag == defaults {
+				t.Errorf("Expected the option to change the ETag, got %s for both", etag)
+			}
+			if again := etagOf(tt.cfg); again != etag {
+				t.Errorf("Expected the same options to give the same ETag, got %s and %s", etag, again)
+			}
+		})
+	}
+
+	// A configured version keeps its URLs, but its ETags still follow the
+	// options
+	fixed := etagOf(Config{TilesetVersion: "release-7"})
+	if changed := etagOf(Config{TilesetVersion: "release-7", BackgroundColor: "#102030"}); changed == fixed {
+		t.Errorf("Expected the options to change the ETag of a configured version, got %s for both", fixed)
+	}
+}
+
+func TestVersionedTileURLs(t *testing.T) {
+	srv, err := NewWithBaseMap(solidBaseMap(color.RGBA{}), Config{TilesetVersion: "v3", VersionedTileURLs: true, BasePath: "/maps"})
+	if err != nil {
+		t.Fatalf("NewWithBaseMap() failed: %v", err)
+	}
+
+	w := fetchTile(t, srv.Handler(), "/maps/tilejson.json", "")
+	var doc tileJSON
+	if err := json.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("Failed to decode TileJSON: %v", err)
+	}
+	if len(doc.Tiles) != 1 || !strings.HasSuffix(doc.Tiles[0], "/maps/v/v3/{z}/{x}/{y}.png") {
+		t.Errorf("Expected a versioned TileJSON tile URL, got %v", doc.Tiles)
+	}
+
+	body := fetchViewer(t, srv, "/maps/", http.StatusOK)
+	if !strings.Contains(body, `"/maps/v/v3/{z}/{x}/{y}.png"`) {
+		t.Error("Expected the viewer to request versioned tile URLs")
+	}
+	if body := fetchViewer(t, srv, "/maps/preview?z=0", http.StatusOK); !strings.Contains(body, `src="/maps/v/v3/0/0/0.png"`) {
+		t.Error("Expected the preview to show versioned tile URLs")
+	}
+}
+
+func TestValidateTilesetVersion(t *testing.T) {
+	tests := []struct {
+		version   string
+		expectErr bool
+		name      string
+	}{
+		{"", false, "empty"},
+		{"2024-06-01", false, "date"},
+		{"v1.2_rc", false, "punctuation"},
+		{strings.Repeat("a", 64), false, "longest"},
+		{strings.Repeat("a", 65), true, "too long"},
+		{"v/1", true, "slash"},
+		{`v"1`, true, "quote"},
+		{"v 1", true, "space"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateTilesetVersion(tt.version); (err != nil) != tt.expectErr {
+				t.Errorf("validateTilesetVersion(%q) error = %v, expected error: %v", tt.version, err, tt.expectErr)
+			}
+		})
+	}
+
+	if _, err := NewWithBaseMap(solidBaseMap(color.RGBA{}), Config{TilesetVersion: "a/b"}); err == nil {
+		t.Error("Expected NewWithBaseMap to reject an invalid tileset version")
+	}
+}
+
+func TestSplitVersion(t *testing.T) {
+	tests := []struct {
+		path          string
+		expectVersion string
+		expectRest    string
+		expectOK      bool
+		name          string
+	}{
+		{"/v/abc/1/2/3.png", "abc", "/1/2/3.png", true, "versioned"},
+		{"/v/abc/night/1/2/3.png", "abc", "/night/1/2/3.png", true, "versioned layer"},
+		{"/1/2/3.png", "", "/1/2/3.png", false, "unversioned"},
+		{"/v/abc", "", "/v/abc", false, "no tile"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			version, rest, ok := splitVersion(tt.path)
+			if version != tt.expectVersion || rest != tt.expectRest || ok != tt.expectOK {
+				t.Errorf("splitVersion(%q) = %q, %q, %v, expected %q, %q, %v",
+					tt.path, version, rest, ok, tt.expectVersion, tt.expectRest, tt.expectOK)
+			}
+		})
+	}
+}
+
+func TestImmutableTiles(t *testing.T) {
+	const immutable = "public, max-age=31536000, immutable"
+
+	tests := []struct {
+		immutableTiles bool
+		path           string
+		ifNoneMatch    string
+		expectCode     int
+		expectCache    string
+		name           string
+	}{
+		{true, "/1/0/0.png", "", http.StatusOK, immutable, "unversioned"},
+		{true, "/v/v1/1/0/0.png", "", http.StatusOK, immutable, "versioned"},
+		{true, "/1/0/0.png", `"v1-png"`, http.StatusNotModified, immutable, "not modified"},
+		{false, "/1/0/0.png", "", http.StatusOK, "public, max-age=86400", "disabled"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, err := NewWithBaseMap(solidBaseMap(color.RGBA{}), Config{TilesetVersion: "v1", ImmutableTiles: tt.immutableTiles})
+			if err != nil {
+				t.Fatalf("NewWithBaseMap() failed: %v", err)
+			}
+			w := fetchTile(t, srv.Handler(), tt.path, tt.ifNoneMatch)
+			if w.Code != tt.expectCode {
+				t.Fatalf("Expected status %d, got %d", tt.expectCode, w.Code)
+			}
+			if got := w.Header().Get("Cache-Control"); got != tt.expectCache {
+				t.Errorf("Expected Cache-Control %q, got %q", tt.expectCache, got)
+			}
+			if got := w.Header().Get("ETag"); got != `"v1-png"` {
+				t.Errorf("Expected ETag %q alongside the cache directive, got %q", `"v1-png"`, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+
+	"org.xyzmaps.xyztiles/src/imagery"
+)
+
+// uniformCollapser replaces tiles of a single color with a solid fill
+type uniformCollapser struct {
+	tolerance  uint8
+	background color.Color // Config.BackgroundColor; nil if transparent
+}
+
+// newUniformCollapser validates the tolerance from Config.UniformTolerance,
+// zero meaning imagery.DefaultUniformTolerance
+func newUniformCollapser(tolerance, tileBuffer int, background color.Color) (*uniformCollapser, error) {
+	if tileBuffer > 0 {
+		return nil, errors.New("collapsing uniform tiles is not supported with a tile buffer")
+	}
+	if tolerance < 0 || tolerance > 255 {
+		return nil, fmt.Errorf("uniform tolerance must be in range [0, 255], got %d", tolerance)
+	}
+	if tolerance == 0 {
+		tolerance = imagery.DefaultUniformTolerance
+	}
+	return &uniformCollapser{tolerance: uint8(tolerance), background: background}, nil
+}
+
+// solidTile returns the size x size tile filled with its mean color if its
+// source pixels are uniform, or nil if it has to be rendered
+func (u *uniformCollapser) solidTile(bm *imagery.BaseMap, z, x, y, size int) *image.RGBA {
+	stats, err := bm.TileStats(z, x, y)
+	if err != nil || !stats.Uniform(u.tolerance) {
+		// Invalid coordinates are reported by the regular render
+		return nil
+	}
+	// Composite over the background like a rendered tile would be
+	tile := image.NewRGBA(image.Rect(0, 0, size, size))
+	if u.background != nil {
+		draw.Draw(tile, tile.Bounds(), &image.Uniform{u.background}, image.Point{}, draw.Src)
+	}
+	draw.Draw(tile, tile.Bounds(), &image.Uniform{stats.Mean}, image.Point{}, draw.Over)
+	return tile
+}
@@ -0,0 +1,92 @@
+package server
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"org.xyzmaps.xyztiles/src/imagery"
+)
+
+// noisyOceanBaseMap returns a 1024x512 base map whose western hemisphere is
+// ocean blue with a one-step checkerboard of noise, like a flat JPEG area,
+// and whose eastern hemisphere is a land gradient
+func noisyOceanBaseMap() *imagery.BaseMap {
+	img := image.NewRGBA(image.Rect(0, 0, 1024, 512))
+	for y := 0; y < 512; y++ {
+		for x := 0; x < 1024; x++ {
+			if x < 512 {
+				img.SetRGBA(x, y, color.RGBA{10, 40, uint8(120 + (x+y)%2), 255})
+			} else {
+				img.SetRGBA(x, y, color.RGBA{uint8(x / 4), 140, 40, 255})
+			}
+		}
+	}
+	return imagery.NewBaseMap(img)
+}
+
+func TestCollapseUniformTiles(t *testing.T) {
+	bm := noisyOceanBaseMap()
+	fetch := func(cfg Config, path string) []byte {
+		t.Helper()
+		srv, err := NewWithBaseMap(bm, cfg)
+		if err != nil {
+			t.Fatalf("NewWithBaseMap() failed: %v", err)
+		}
+		w := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200 for %s, got %d", path, w.Code)
+		}
+		return w.Body.Bytes()
+	}
+
+	// The all-ocean western tile collapses to a solid full-size tile
+	rendered := fetch(Config{}, "/1/0/0.png")
+	collapsed := fetch(Config{CollapseUniformTiles: true}, "/1/0/0.png")
+	if len(collapsed) >= len(rendered) {
+		t.Errorf("Expected collapsed tile to be smaller than %d bytes, got %d", len(rendered), len(collapsed))
+	}
+
+	tile, err := png.Decode(bytes.NewReader(collapsed))
+	if err != nil {
+		t.Fatalf("Failed to decode PNG: %v", err)
+	}
+	if b := tile.Bounds(); b.Dx() != imagery.TileSize || b.Dy() != imagery.TileSize {
+		t.Errorf("Expected %dx%d tile, got %dx%d", imagery.TileSize, imagery.TileSize, b.Dx(), b.Dy())
+	}
+	expect := color.RGBA{10, 40, 121, 255}
+	for _, p := range []image.Point{{0, 0}, {255, 256}, {511, 511}} {
+		if got := color.RGBAModel.Convert(tile.At(p.X, p.Y)); got != expect {
+			t.Errorf("Expected pixel %v at %v, got %v", expect, p, got)
+		}
+	}
+
+	// Tiles with detail are rendered as usual
+	if mixed := fetch(Config{CollapseUniformTiles: true}, "/1/1/0.png"); len(mixed) != len(fetch(Config{}, "/1/1/0.png")) {
+		t.Error("Expected non-uniform tile to be rendered unchanged")
+	}
+}
+
+func TestNewWithBaseMap_CollapseUniformTilesValidation(t *testing.T) {
+	tests := []struct {
+		cfg  Config
+		name string
+	}{
+		{Config{CollapseUniformTiles: true, TileBuffer: 8}, "with tile buffer"},
+		{Config{CollapseUniformTiles: true, UniformTolerance: -1}, "negative tolerance"},
+		{Config{CollapseUniformTiles: true, UniformTolerance: 256}, "tolerance too large"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewWithBaseMap(solidBaseMap(color.RGBA{}), tt.cfg); err == nil {
+				t.Error("Expected configuration error")
+			}
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"runtime"
+
+	"org.xyzmaps.xyztiles/src/version"
+)
+
+// versionInfo is the JSON document served at /version
+type versionInfo struct {
+	Version     string `json:"version"`
+	Commit      string `json:"commit"`
+	Date        string `json:"date"`       // Build date
+	GoVersion   string `json:"go_version"` // Go runtime the binary was built with
+	EmbeddedMap bool   `json:"embedded_map"`
+}
+
+// handleVersion serves the build's version, commit and date and whether the
+// embedded map is in use, so deployment tooling can check what is running.
+// HideVersion turns it off.
+func (s *Server) handleVersion(w http.ResponseWriter, r *http.Request) {
+	if s.noVersion {
+		writeError(w, r, newAPIError(http.StatusNotFound, codeNotFound, "404 page not found"))
+		return
+	}
+	info := versionInfo{
+		Version:     version.Version,
+		Commit:      version.Commit,
+		Date:        version.Date,
+		GoVersion:   runtime.Version(),
+		EmbeddedMap: s.embedded,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := json.NewEncoder(w).Encode(info); err != nil {
+		s.logger.Error("Error encoding version", "request_id", requestID(r.Context()), "err", err)
+	}
+}
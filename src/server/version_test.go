@@ -0,0 +1,92 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+
+	"org.xyzmaps.xyztiles/src/version"
+)
+
+// setVersion overrides the build's version information for the test, as
+// ldflags would
+func setVersion(t *testing.T, v, commit, date string) {
+	t.Helper()
+	oldVersion, oldCommit, oldDate := version.Version, version.Commit, version.Date
+	version.Version, version.Commit, version.Date = v, commit, date
+	t.Cleanup(func() {
+		version.Version, version.Commit, version.Date = oldVersion, oldCommit, oldDate
+	})
+}
+
+func TestHandleVersion(t *testing.T) {
+	setVersion(t, "v1.2.3", "0123abc", "2026-01-02T03:04:05Z")
+	path := createTestJPEG(t)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read test image: %v", err)
+	}
+
+	tests := []struct {
+		cfg            Config
+		expectEmbedded bool
+		name           string
+	}{
+		{Config{EmbeddedData: data}, true, "embedded map"},
+		{Config{ImagePath: path}, false, "custom image"},
+		{Config{ImagePath: path, BasePath: "/maps"}, false, "base path"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, err := New(tt.cfg)
+			if err != nil {
+				t.Fatalf("New() failed: %v", err)
+			}
+
+			w := httptest.NewRecorder()
+			srv.Handler().ServeHTTP(w, httptest.NewRequest("GET", tt.cfg.BasePath+"/version", nil))
+			if w.Code != http.StatusOK {
+				t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+			}
+			if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+				t.Errorf("Expected Content-Type application/json, got %s", ct)
+			}
+
+			var got versionInfo
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			want := versionInfo{
+				Version:     "v1.2.3",
+				Commit:      "0123abc",
+				Date:        "2026-01-02T03:04:05Z",
+				GoVersion:   runtime.Version(),
+				EmbeddedMap: tt.expectEmbedded,
+			}
+			if got != want {
+				t.Errorf("Expected %+v, got %+v", want, got)
+			}
+		})
+	}
+}
+
+func TestHandleVersion_Hidden(t *testing.T) {
+	setVersion(t, "v1.2.3", "0123abc", "2026-01-02T03:04:05Z")
+	srv, err := New(Config{ImagePath: createTestJPEG(t), HideVersion: true})
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/version", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", w.Code)
+	}
+	if body := w.Body.String(); strings.Contains(body, "v1.2.3") || strings.Contains(body, "0123abc") {
+		t.Errorf("Expected no version information, got %s", body)
+	}
+}
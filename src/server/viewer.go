@@ -0,0 +1,303 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"org.xyzmaps.xyztiles/src/imagery"
+	"org.xyzmaps.xyztiles/src/tilemath"
+)
+
+// viewerData holds the values injected into the viewer template
+type viewerData struct {
+	BasePath      string // URL prefix for tile and asset URLs, e.g. "/maps" or ""
+	TileExtension string // Extension of the tiles the viewer requests, e.g. ".png"
+	TileFormat    string // Display name of that format, e.g. "PNG"
+	TileSize      int    // Edge length in pixels of the tiles the viewer requests with ?size=
+	MinZoom       int    // Lowest zoom served
+	MaxZoom       int    // Highest zoom served; the viewer scales tiles beyond it
+	NativeMaxZoom int    // Highest zoom with full source detail; served zooms beyond it are upsampled
+	MaxMapZoom    int    // Highest zoom the map can be zoomed to
+
+	Center   *[2]float64 // Leaflet [lat, lng] the map opens at; nil fits MaxBounds or shows the world
+	Zoom     int         // Zoom the map opens at
+	Retina   bool        // Show 512 pixel tiles at 256 CSS pixels, sharp on high-DPI screens
+	Decimals int         // Decimal places of the coordinate readout and URL hash
+
+	Scale     bool // Show a metric and imperial scale bar
+	Graticule bool // Offer a latitude/longitude grid in the layer control
+
+	OtherFormats []string // Other served formats the viewer can switch to with ?format=
+
+	MaxBounds [][2]float64 // Leaflet [[south, west], [north, east]] the map is confined to; nil for none
+
+	// Versioned URLs of the vendored Leaflet under /assets/; empty loads
+	// Leaflet from the CDN
+	LeafletCSS string
+	LeafletJS  string
+
+	Layers   []viewerLayer   // Served layers, the default layer first
+	Overlays []viewerOverlay // GeoJSON overlays, drawn in order
+}
+
+// viewerLayer describes a layer offered in the viewer's layer control
+type viewerLayer struct {
+	Name    string `json:"name"`
+	Path    string `json:"path"`    // Tile URL prefix below the base path, e.g. "", "/{name}" or "/v/{version}/{name}"
+	URL     string `json:"url"`     // Leaflet tile URL template, including the base path
+	MaxZoom int    `json:"maxZoom"` // Highest zoom served for the layer
+
+	Title       string `json:"title"`       // Name shown in the layer switcher
+	Attribution string `json:"attribution"` // Attribution HTML shown while the layer is active
+}
+
+// viewerOverlay describes a GeoJSON overlay to the viewer script
+type viewerOverlay struct {
+	Name string `json:"name"`
+	URL  string `json:"url"` // Including the base path
+}
+
+// Viewer defaults
+const (
+	defaultViewerZoom = 2 // Zoom the viewer opens at unless configured
+	viewerExtraZoom   = 4 // Zoom levels the viewer allows beyond the served ones, scaling tiles
+
+	// viewerDecimals is how many decimal places of degrees the viewer shows
+	// and writes to the URL hash, about 1 m at the equator
+	viewerDecimals = 5
+)
+
+// viewerOptions are the validated viewer settings from Config
+type viewerOptions struct {
+	center *tilemath.LonLat // nil fits the served bounds
+	zoom   int              // Zero picks defaultViewerZoom
+	retina bool
+
+	scale     bool // Show a scale bar
+	graticule bool // Offer a latitude/longitude grid overlay
+}
+
+// newViewerOptions validates the viewer settings in cfg against the zoom
+// range of the default layer
+func newViewerOptions(cfg Config, def *layer) (viewerOptions, error) {
+	opts := viewerOptions{
+		center: cfg.ViewerCenter,
+		zoom:   cfg.ViewerZoom,
+		retina: !cfg.ViewerNoRetina,
+
+		scale:     !cfg.ViewerNoScale,
+		graticule: cfg.ViewerGraticule,
+	}
+	if opts.center != nil {
+		if err := opts.center.Validate(); err != nil {
+			return opts, fmt.Errorf("invalid viewer center: %w", err)
+		}
+	}
+	if opts.zoom != 0 && (opts.zoom < def.minZoom || opts.zoom > def.maxZoom+viewerExtraZoom) {
+		return opts, fmt.Errorf("viewer zoom must be in range [%d, %d], got %d", def.minZoom, def.maxZoom+viewerExtraZoom, opts.zoom)
+	}
+	return opts, nil
+}
+
+// handleRoot serves the viewer, or the static site if one is configured, at
+// "/". Other paths reach it only when no route matches them; they get the
+// static site or the error for a malformed tile path.
+func (s *Server) handleRoot(w http.ResponseWriter, r *http.Request) {
+	if s.static != nil && !s.isTilePath(r.URL.Path) {
+		s.static.serve(w, r)
+		return
+	}
+
+	if r.URL.Path != "/" {
+		// Try to parse as tile request
+		s.handleTileRequest(w, r, r.URL.Path)
+		return
+	}
+
+	s.handleViewer(w, r)
+}
+
+// handleViewer serves the embedded Leaflet viewer
+func (s *Server) handleViewer(w http.ResponseWriter, r *http.Request) {
+	if s.noViewer {
+		writeError(w, r, newAPIError(http.StatusNotFound, codeNotFound, "404 page not found"))
+		return
+	}
+
+	// ?format= switches the tiles the viewer requests, for comparing formats
+	formats := s.defLayer.formats
+	format := formats.Default
+	if name := r.URL.Query().Get("format"); name != "" {
+		f, err := imagery.FormatFromExtension(name)
+		if err != nil || !formats.allows(f) {
+			writeError(w, r, newAPIError(http.StatusBadRequest, codeInvalidRequest, fmt.Sprintf("Invalid format %q", name)))
+			return
+		}
+		format = f
+	}
+
+	data := viewerData{
+		BasePath:      s.basePath,
+		TileExtension: format.Extension(),
+		TileFormat:    strings.ToUpper(string(format)),
+		TileSize:      imagery.TileSize,
+		MinZoom:       s.defLayer.minZoom,
+		MaxZoom:       s.defLayer.maxZoom,
+		NativeMaxZoom: min(s.defLayer.nativeMaxZoom(), s.defLayer.maxZoom),
+		MaxMapZoom:    s.defLayer.maxZoom + viewerExtraZoom,
+		MaxBounds:     s.viewerMaxBounds(),
+		Retina:        s.viewerOpts.retina,
+		Decimals:      viewerDecimals,
+		Scale:         s.viewerOpts.scale,
+		Graticule:     s.viewerOpts.graticule,
+		Layers:        s.viewerLayers(format),
+		Overlays:      s.viewerOverlays(),
+	}
+
+	// ?view=z/lat/lng (the viewer's URL hash) and ?lat=&lng=&z= override
+	// the configured view, for shareable links
+	center, zoom, err := s.initialView(r.URL.Query())
+	if err != nil {
+		writeError(w, r, newAPIError(http.StatusBadRequest, codeInvalidRequest, err.Error()))
+		return
+	}
+	if center != nil {
+		data.Center = &[2]float64{center.Lat, center.Lon}
+	}
+	data.Zoom = zoom
+
+	data.LeafletCSS, data.LeafletJS = s.leafletURLs()
+	for _, f := range imagery.SupportedFormats() {
+		if f != format && formats.allows(f) {
+			data.OtherFormats = append(data.OtherFormats, string(f))
+		}
+	}
+
+	// Serve embedded Leaflet viewer
+	if s.viewer != nil {
+		var buf bytes.Buffer
+		if err := s.viewer.Execute(&buf, data); err != nil {
+			s.logger.Error("Error rendering viewer", "request_id", requestID(r.Context()), "err", err)
+			writeError(w, r, newAPIError(http.StatusInternalServerError, codeInternal, "Failed to render viewer"))
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Cache-Control", "public, max-age=3600") // Cache viewer for 1 hour
+		w.Write(buf.Bytes())
+		return
+	}
+
+	// Fallback to simple HTML if viewer is not embedded
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "public, max-age=3600") // Cache viewer for 1 hour
+	fmt.Fprintf(w, `<!DOCTYPE html>
+<html>
+<head>
+    <title>xyztiles - Tile Server</title>
+</head>
+<body>
+    <h1>xyztiles Tile Server</h1>
+    <p>Server is running. Tile endpoint: <code>%[1]s/{z}/{x}/{y}%[3]s</code></p>
+    <p>%[2]s</p>
+    <p>Example tiles:</p>
+    <ul>
+        <li><a href="%[1]s/0/0/0%[3]s">Zoom 0 (world)</a></li>
+        <li><a href="%[1]s/1/0/0%[3]s">Zoom 1, tile 0,0</a></li>
+        <li><a href="%[1]s/2/1/1%[3]s">Zoom 2, tile 1,1</a></li>
+    </ul>
+</body>
+</html>`, data.BasePath, s.defLayer.describe(), data.TileExtension)
+}
+
+// initialView returns the center and zoom the viewer opens at: the lat,
+// lng and z query values if given, else the configured view. A nil center
+// fits the served bounds.
+func (s *Server) initialView(query url.Values) (*tilemath.LonLat, int, error) {
+	center, zoom := s.viewerOpts.center, s.viewerOpts.zoom
+	if zoom == 0 {
+		zoom = min(max(defaultViewerZoom, s.defLayer.minZoom), s.defLayer.maxZoom+viewerExtraZoom)
+	}
+
+	if view := query.Get("view"); view != "" {
+		z, p, err := parseView(view)
+		if err != nil {
+			return nil, 0, err
+		}
+		center, zoom = &p, z
+	}
+
+	lat, lng := query.Get("lat"), query.Get("lng")
+	if lat != "" || lng != "" {
+		p, err := tilemath.ParseLonLat(lng + "," + lat)
+		if err != nil {
+			return nil, 0, fmt.Errorf("invalid lat/lng: %w", err)
+		}
+		center = &p
+	}
+
+	if z := query.Get("z"); z != "" {
+		v, err := strconv.Atoi(z)
+		if err != nil {
+			return nil, 0, fmt.Errorf("invalid z %q: not a number", z)
+		}
+		zoom = v
+	}
+
+	if zoom < s.defLayer.minZoom || zoom > s.defLayer.maxZoom+viewerExtraZoom {
+		return nil, 0, fmt.Errorf("invalid zoom %d (expected a zoom from %d to %d)", zoom, s.defLayer.minZoom, s.defLayer.maxZoom+viewerExtraZoom)
+	}
+	return center, zoom, nil
+}
+
+// parseView parses a view in the viewer's URL hash form, "z/lat/lng"
+func parseView(s string) (int, tilemath.LonLat, error) {
+	parts := strings.Split(s, "/")
+	if len(parts) != 3 {
+		return 0, tilemath.LonLat{}, fmt.Errorf("invalid view %q (expected z/lat/lng)", s)
+	}
+	z, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, tilemath.LonLat{}, fmt.Errorf("invalid view %q: zoom is not a number", s)
+	}
+	p, err := tilemath.ParseLonLat(parts[2] + "," + parts[1])
+	if err != nil {
+		return 0, tilemath.LonLat{}, fmt.Errorf("invalid view %q: %w", s, err)
+	}
+	return z, p, nil
+}
+
+// viewerOverlays lists the GeoJSON overlays for the viewer
+func (s *Server) viewerOverlays() []viewerOverlay {
+	var overlays []viewerOverlay
+	for _, o := range s.overlays {
+		overlays = append(overlays, viewerOverlay{Name: o.name, URL: s.basePath + "/overlays/" + o.name + ".json"})
+	}
+	return overlays
+}
+
+// viewerLayers lists the served layers for the viewer, the default first,
+// with tile URLs in format, or in a layer's default format if it does not
+// allow format
+func (s *Server) viewerLayers(format imagery.Format) []viewerLayer {
+	var layers []viewerLayer
+	add := func(l *layer) {
+		path := s.tilePrefix(l)
+		f := format
+		if !l.formats.allows(f) {
+			f = l.formats.Default
+		}
+		layers = append(layers, viewerLayer{Name: l.name, Path: path, URL: s.basePath + path + "/{z}/{x}/{y}" + f.Extension(), MaxZoom: l.maxZoom, Title: l.title, Attribution: l.attribution})
+	}
+	add(s.defLayer)
+	for _, name := range s.layerNames {
+		if l := s.layers[name]; l != s.defLayer {
+			add(l)
+		}
+	}
+	return layers
+}
@@ -0,0 +1,320 @@
+package server
+
+import (
+	"encoding/json"
+	"image/color"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+
+	"org.xyzmaps.xyztiles/src/imagery"
+	"org.xyzmaps.xyztiles/src/tilemath"
+)
+
+// viewerConst decodes the JSON value of the first `const name = value;`
+// line in the viewer's script
+func viewerConst(t *testing.T, body, name string) any {
+	t.Helper()
+	m := regexp.MustCompile(`(?m)const ` + name + ` = \s*(.*?)\s*;\s*(?://.*)?$`).FindStringSubmatch(body)
+	if m == nil {
+		t.Fatalf("Expected const %s in viewer", name)
+	}
+	var v any
+	if err := json.Unmarshal([]byte(m[1]), &v); err != nil {
+		t.Fatalf("Failed to decode const %s = %s: %v", name, m[1], err)
+	}
+	return v
+}
+
+// fetchViewer requests the viewer at path and returns the page
+func fetchViewer(t *testing.T, srv *Server, path string, expectStatus int) string {
+	t.Helper()
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+	if w.Code != expectStatus {
+		t.Fatalf("Expected status %d for %s, got %d: %s", expectStatus, path, w.Code, w.Body.String())
+	}
+	return w.Body.String()
+}
+
+func TestHandleViewer_FormatToggle(t *testing.T) {
+	tests := []struct {
+		formats      FormatPolicy
+		path         string
+		expectStatus int
+		expectExt    string
+		expectLinks  []string
+		name         string
+	}{
+		{FormatPolicy{}, "/", http.StatusOK, ".png", []string{"jpeg", "webp"}, "default format"},
+		{FormatPolicy{}, "/?format=jpeg", http.StatusOK, ".jpg", []string{"png", "webp"}, "JPEG"},
+		{FormatPolicy{}, "/?format=jpg", http.StatusOK, ".jpg", []string{"png", "webp"}, "JPEG by extension"},
+		{FormatPolicy{}, "/?format=WEBP", http.StatusOK, ".webp", []string{"png", "jpeg"}, "case-insensitive"},
+		{FormatPolicy{}, "/?format=gif", http.StatusBadRequest, "", nil, "unknown format"},
+		{FormatPolicy{Allowed: []imagery.Format{imagery.FormatPNG}}, "/?format=webp", http.StatusBadRequest, "", nil, "format not served"},
+		{FormatPolicy{Allowed: []imagery.Format{imagery.FormatPNG}}, "/", http.StatusOK, ".png", nil, "single format"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, err := NewWithBaseMap(solidBaseMap(color.RGBA{}), Config{Formats: tt.formats})
+			if err != nil {
+				t.Fatalf("NewWithBaseMap() failed: %v", err)
+			}
+
+			body := fetchViewer(t, srv, tt.path, tt.expectStatus)
+			if tt.expectStatus != http.StatusOK {
+				return
+			}
+			if !strings.Contains(body, `const tileExtension = "`+tt.expectExt+`"`) {
+				t.Errorf("Expected tile URLs to end in %s", tt.expectExt)
+			}
+			for _, f := range imagery.SupportedFormats() {
+				link := `href="?format=` + string(f) + `"`
+				if want := slices.Contains(tt.expectLinks, string(f)); strings.Contains(body, link) != want {
+					t.Errorf("Expected link to %s: %v", f, want)
+				}
+			}
+		})
+	}
+}
+
+func TestHandleViewer_InitialView(t *testing.T) {
+	paris := &tilemath.LonLat{Lon: 2.35, Lat: 48.86}
+	europe := &tilemath.Bounds{West: -10, South: 35, East: 30, North: 70}
+
+	tests := []struct {
+		cfg          Config
+		path         string
+		expectStatus int
+		expectCenter any // Decoded [lat, lng], nil to fit the bounds
+		expectZoom   float64
+		name         string
+	}{
+		{Config{}, "/", http.StatusOK, nil, 2, "defaults"},
+		{Config{MinZoom: 3}, "/", http.StatusOK, nil, 3, "default zoom clamped"},
+		{Config{ViewerCenter: paris, ViewerZoom: 6}, "/", http.StatusOK, []any{48.86, 2.35}, 6, "configured view"},
+		{Config{ViewerCenter: paris, ViewerZoom: 6}, "/?lat=-33.9&lng=18.4&z=4", http.StatusOK, []any{-33.9, 18.4}, 4, "query overrides"},
+		{Config{ViewerCenter: paris, ViewerZoom: 6}, "/?z=3", http.StatusOK, []any{48.86, 2.35}, 3, "query zoom only"},
+		{Config{Bounds: europe}, "/?lat=50&lng=10", http.StatusOK, []any{50.0, 10.0}, 2, "query center within bounds"},
+		{Config{ViewerCenter: paris, ViewerZoom: 6}, "/?view=4/-33.9/18.4", http.StatusOK, []any{-33.9, 18.4}, 4, "hash-form view"},
+		{Config{}, "/?view=4/-33.9/18.4&z=5", http.StatusOK, []any{-33.9, 18.4}, 5, "query zoom overrides view"},
+		{Config{}, "/?view=4/-33.9", http.StatusBadRequest, nil, 0, "view missing longitude"},
+		{Config{}, "/?view=40/0/0", http.StatusBadRequest, nil, 0, "view zoom out of range"},
+		{Config{}, "/?view=4/0/200", http.StatusBadRequest, nil, 0, "view longitude out of range"},
+		{Config{}, "/?lat=50", http.StatusBadRequest, nil, 0, "lat without lng"},
+		{Config{}, "/?lat=95&lng=0", http.StatusBadRequest, nil, 0, "lat out of range"},
+		{Config{}, "/?z=40", http.StatusBadRequest, nil, 0, "zoom out of range"},
+		{Config{}, "/?z=x", http.StatusBadRequest, nil, 0, "zoom not a number"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, err := NewWithBaseMap(solidBaseMap(color.RGBA{}), tt.cfg)
+			if err != nil {
+				t.Fatalf("NewWithBaseMap() failed: %v", err)
+			}
+
+			body := fetchViewer(t, srv, tt.path, tt.expectStatus)
+			if tt.expectStatus != http.StatusOK {
+				return
+			}
+			if center := viewerConst(t, body, "center"); !reflect.DeepEqual(center, tt.expectCenter) {
+				t.Errorf("Expected center %v, got %v", tt.expectCenter, center)
+			}
+			if zoom := viewerConst(t, body, "zoom"); zoom != tt.expectZoom {
+				t.Errorf("Expected zoom %v, got %v", tt.expectZoom, zoom)
+			}
+			if !strings.Contains(body, "map.setView(center || [20, 0], zoom)") {
+				t.Error("Expected the viewer to set its view from center and zoom")
+			}
+		})
+	}
+}
+
+func TestHandleViewer_Permalink(t *testing.T) {
+	srv, err := NewWithBaseMap(solidBaseMap(color.RGBA{}), Config{})
+	if err != nil {
+		t.Fatalf("NewWithBaseMap() failed: %v", err)
+	}
+
+	body := fetchViewer(t, srv, "/", http.StatusOK)
+	if decimals := viewerConst(t, body, "decimals"); decimals != float64(viewerDecimals) {
+		t.Errorf("Expected decimals %d, got %v", viewerDecimals, decimals)
+	}
+	for _, want := range []string{
+		"parseViewHash(window.location.hash)",
+		"history.replaceState(null, '', hash)",
+		"addEventListener('hashchange'",
+		"coordinate-readout",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected viewer to contain %q", want)
+		}
+	}
+}
+
+func TestHandleViewer_TileLayerOptions(t *testing.T) {
+	tests := []struct {
+		cfg               Config
+		expectAttribution string
+		expectRetina      bool
+		name              string
+	}{
+		{Config{BasePath: "/maps"}, "", true, "defaults"},
+		{Config{BasePath: "/maps", Attribution: "© Example Survey", ViewerNoRetina: true}, "© Example Survey", false, "configured"},
+		{Config{BasePath: "/maps", Attribution: `<b>Survey</b> & <a href="https://example.com/">Partners</a>`}, `&lt;b&gt;Survey&lt;/b&gt; &amp; <a href="https://example.com/">Partners</a>`, true, "escaped"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, err := NewWithBaseMap(solidBaseMap(color.RGBA{}), tt.cfg)
+			if err != nil {
+				t.Fatalf("NewWithBaseMap() failed: %v", err)
+			}
+
+			body := fetchViewer(t, srv, "/maps/", http.StatusOK)
+			if attribution := viewerConst(t, body, "layers").([]any)[0].(map[string]any)["attribution"]; attribution != tt.expectAttribution {
+				t.Errorf("Expected attribution %q, got %v", tt.expectAttribution, attribution)
+			}
+			if size := viewerConst(t, body, "tileSize"); size != float64(imagery.TileSize) {
+				t.Errorf("Expected tile size %d, got %v", imagery.TileSize, size)
+			}
+			if retina := viewerConst(t, body, "retina"); retina != tt.expectRetina {
+				t.Errorf("Expected retina %v, got %v", tt.expectRetina, retina)
+			}
+			for _, want := range []string{
+				`"url":"/maps/{z}/{x}/{y}.png"`,
+				"attribution: layer.attribution,",
+				"layer.url + '?size=' + tileSize,",
+				"tileSize: retina ? tileSize / 2 : tileSize,",
+			} {
+				if !strings.Contains(body, want) {
+					t.Errorf("Expected %q in viewer", want)
+				}
+			}
+		})
+	}
+}
+
+func TestHandleViewer_LayerSwitcher(t *testing.T) {
+	night := Layer{Name: "night", BaseMap: solidBaseMap(color.RGBA{}), Title: "Night Lights", Attribution: "NASA Black Marble"}
+
+	tests := []struct {
+		cfg           Config
+		expectLayers  []viewerLayer
+		expectControl bool
+		name          string
+	}{
+		{
+			Config{},
+			[]viewerLayer{{Name: "default", URL: "/{z}/{x}/{y}.png", Title: "default"}},
+			false, "single layer",
+		},
+		{
+			Config{Layers: []Layer{night}},
+			[]viewerLayer{
+				{Name: "default", URL: "/{z}/{x}/{y}.png", Title: "default"},
+				{Name: "night", URL: "/night/{z}/{x}/{y}.png", Title: "Night Lights", Attribution: "NASA Black Marble"},
+			},
+			true, "two layers",
+		},
+		{
+			Config{Layers: []Layer{night}, DefaultLayer: "night", Attribution: "Example"},
+			[]viewerLayer{
+				{Name: "night", URL: "/{z}/{x}/{y}.png", Title: "Night Lights", Attribution: "NASA Black Marble"},
+				{Name: "default", URL: "/default/{z}/{x}/{y}.png", Title: "default", Attribution: "Example"},
+			},
+			true, "default layer first",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, err := NewWithBaseMap(solidBaseMap(color.RGBA{}), tt.cfg)
+			if err != nil {
+				t.Fatalf("NewWithBaseMap() failed: %v", err)
+			}
+
+			body := fetchViewer(t, srv, "/", http.StatusOK)
+			raw, _ := json.Marshal(viewerConst(t, body, "layers"))
+			var layers []viewerLayer
+			if err := json.Unmarshal(raw, &layers); err != nil {
+				t.Fatalf("Failed to decode layers: %v", err)
+			}
+			if len(layers) != len(tt.expectLayers) {
+				t.Fatalf("Expected %d layers, got %d", len(tt.expectLayers), len(layers))
+			}
+			for i, want := range tt.expectLayers {
+				got := layers[i]
+				if got.Name != want.Name || got.URL != want.URL || got.Title != want.Title || got.Attribution != want.Attribution {
+					t.Errorf("Layer %d: expected %+v, got %+v", i, want, got)
+				}
+			}
+
+			if hasControl := strings.Contains(body, "L.control.layers("); hasControl != tt.expectControl {
+				t.Errorf("Expected layer control: %v, got %v", tt.expectControl, hasControl)
+			}
+		})
+	}
+}
+
+func TestHandleViewer_ScaleAndGraticule(t *testing.T) {
+	tests := []struct {
+		cfg             Config
+		expectScale     bool
+		expectGraticule bool
+		expectControl   bool
+		name            string
+	}{
+		{Config{}, true, false, false, "scale by default"},
+		{Config{ViewerNoScale: true}, false, false, false, "neither"},
+		{Config{ViewerNoScale: true, ViewerGraticule: true}, false, true, true, "graticule"},
+		{Config{ViewerGraticule: true}, true, true, true, "both"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, err := NewWithBaseMap(solidBaseMap(color.RGBA{}), tt.cfg)
+			if err != nil {
+				t.Fatalf("NewWithBaseMap() failed: %v", err)
+			}
+
+			body := fetchViewer(t, srv, "/", http.StatusOK)
+			if hasScale := strings.Contains(body, "L.control.scale("); hasScale != tt.expectScale {
+				t.Errorf("Expected scale control: %v, got %v", tt.expectScale, hasScale)
+			}
+			if hasGraticule := strings.Contains(body, "overlayLayers['Graticule']"); hasGraticule != tt.expectGraticule {
+				t.Errorf("Expected graticule overlay: %v, got %v", tt.expectGraticule, hasGraticule)
+			}
+			// The graticule is toggled from the layer control, so it brings
+			// the control even with a single layer
+			if hasControl := strings.Contains(body, "L.control.layers("); hasControl != tt.expectControl {
+				t.Errorf("Expected layer control: %v, got %v", tt.expectControl, hasControl)
+			}
+		})
+	}
+}
+
+func TestNewViewerOptions_Validation(t *testing.T) {
+	tests := []struct {
+		cfg  Config
+		name string
+	}{
+		{Config{ViewerCenter: &tilemath.LonLat{Lon: 200, Lat: 0}}, "center out of range"},
+		{Config{ViewerZoom: 30}, "zoom above range"},
+		{Config{MinZoom: 3, ViewerZoom: 1}, "zoom below range"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewWithBaseMap(solidBaseMap(color.RGBA{}), tt.cfg); err == nil {
+				t.Error("Expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"org.xyzmaps.xyztiles/src/imagery"
+	"org.xyzmaps.xyztiles/src/tilemath"
+)
+
+// WarmCache renders every tile from minZoom through maxZoom of every layer
+// in its default format and stores it in the cache. Zooms outside a layer's
+// served range, tiles already cached and tiles outside the configured bounds
+// are skipped.
+// Rendering shares the render slots with requests, so warming never uses more
+// than the configured render concurrency. It stops early when ctx is done.
+func (s *Server) WarmCache(ctx context.Context, minZoom, maxZoom int) error {
+	if s.cache == nil {
+		return errors.New("cache warming requires a tile cache")
+	}
+	if minZoom < 0 || maxZoom < minZoom {
+		return fmt.Errorf("invalid warm zoom range %d-%d", minZoom, maxZoom)
+	}
+
+	// warmJob is a tile of a layer to render
+	type warmJob struct {
+		l  *layer
+		tc tilemath.TileCoord
+	}
+
+	jobs := make(chan warmJob)
+
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+	workers := s.renders.stats().Limit
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				if err := s.warmTile(ctx, job.l, job.tc, job.l.formats.Default); err != nil {
+					errOnce.Do(func() { firstErr = err })
+				}
+			}
+		}()
+	}
+
+	// Feed tile coordinates until done or cancelled
+produce:
+	for _, name := range s.layerNames {
+		l := s.layers[name]
+		if l.archive != nil {
+			continue // Archive tiles are read as stored, not rendered
+		}
+		for z := max(minZoom, l.minZoom); z <= min(maxZoom, l.maxZoom); z++ {
+			n := 1 << uint(z)
+			s.logger.Info("Warming zoom level", "layer", l.name, "z", z, "grid_tiles", n*n)
+			for x := 0; x < n; x++ {
+				for y := 0; y < n; y++ {
+					if !s.tileInBounds(z, x, y) {
+						continue
+					}
+					select {
+					case jobs <- warmJob{l, tilemath.TileCoord{Z: z, X: x, Y: y}}:
+					case <-ctx.Done():
+						break produce
+					}
+				}
+			}
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return firstErr
+}
+
+// warmTile renders a single tile into the cache unless it is already cached
+func (s *Server) warmTile(ctx context.Context, l *layer, tc tilemath.TileCoord, format imagery.Format) error {
+	if s.cache.contains(tileKey(l.name, tc.Z, tc.X, tc.Y, imagery.TileSize, format)) {
+		return nil
+	}
+
+	if err := s.renders.wait(ctx); err != nil {
+		return err
+	}
+	defer s.renders.release()
+
+	if _, err := s.renderTile(ctx, l, tc.Z, tc.X, tc.Y, imagery.TileSize, format); err != nil && ctx.Err() == nil {
+		return fmt.Errorf("failed to warm tile %s/%d/%d/%d: %w", l.name, tc.Z, tc.X, tc.Y, err)
+	}
+	return nil
+}
+
+// warmInBackground warms the served zooms up to maxZoom without blocking.
+// Shutdown cancels warming that is still in progress, and WaitForWarm
+// blocks until it has finished.
+func (s *Server) warmInBackground(maxZoom int) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	s.mu.Lock()
+	s.stopWarm = cancel
+	s.warmDone = done
+	s.mu.Unlock()
+
+	go func() {
+		defer close(done)
+		defer cancel()
+		s.logger.Info("Warming tile cache", "max_zoom", maxZoom, "layers", len(s.layerNames))
+		start := time.Now()
+		if err := s.WarmCache(ctx, 0, maxZoom); err != nil {
+			if !errors.Is(err, context.Canceled) {
+				s.logger.Error("Cache warming failed", "err", err)
+			}
+			return
+		}
+		s.logger.Info("Warmed tile cache",
+			"max_zoom", maxZoom, "tiles", s.cache.len(), "bytes", s.cache.size(), "duration", time.Since(start))
+	}()
+}
+
+// WaitForWarm blocks until warming started by Config.WarmOnStart has
+// finished or been cancelled, or ctx is done. It returns immediately if the
+// server is not warming its cache.
+func (s *Server) WaitForWarm(ctx context.Context) error {
+	s.mu.Lock()
+	done := s.warmDone
+	s.mu.Unlock()
+
+	if done == nil {
+		return nil
+	}
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
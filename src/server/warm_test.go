@@ -0,0 +1,179 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"image"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// newCachingServer creates a server over a small test image with a tile cache
+func newCachingServer(t *testing.T, cfg Config) *Server {
+	t.Helper()
+
+	cfg.ImagePath = createTestJPEG(t)
+	if cfg.CacheMaxBytes == 0 {
+		cfg.CacheMaxBytes = 64 << 20
+	}
+	srv, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+	return srv
+}
+
+// warmContext returns a context that ends shortly before the test binary's
+// -timeout, so slow runs (-race on one CPU) wait as long as they need while
+// a hung warm-up still fails with a message rather than a panic
+func warmContext(t *testing.T) context.Context {
+	t.Helper()
+
+	deadline, ok := t.Deadline()
+	if !ok {
+		return t.Context()
+	}
+	ctx, cancel := context.WithDeadline(t.Context(), deadline.Add(-time.Until(deadline)/10))
+	t.Cleanup(cancel)
+	return ctx
+}
+
+func TestWarmCache(t *testing.T) {
+	srv := newCachingServer(t, Config{})
+
+	if err := srv.WarmCache(context.Background(), 0, 2); err != nil {
+		t.Fatalf("WarmCache() failed: %v", err)
+	}
+
+	// 1 + 4 + 16 tiles for zooms 0-2
+	if got := srv.cache.len(); got != 21 {
+		t.Errorf("Expected 21 cached tiles, got %d", got)
+	}
+	if _, ok := srv.cache.get("default/2/3/3.png"); !ok {
+		t.Error("Expected 2/3/3.png to be cached")
+	}
+
+	// Warmed tiles are served without rendering
+	srv.render = func(context.Context, *layer, int, int, int, int) (*image.RGBA, error) {
+		t.Error("Unexpected render of a warmed tile")
+		return nil, errors.New("not cached")
+	}
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/1/1/0.png", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected 200 for warmed tile, got %d", w.Code)
+	}
+
+	// Warming again skips cached tiles
+	if err := srv.WarmCache(context.Background(), 0, 2); err != nil {
+		t.Errorf("Second WarmCache() failed: %v", err)
+	}
+}
+
+func TestWarmCache_Errors(t *testing.T) {
+	uncached, err := New(Config{ImagePath: createTestJPEG(t)})
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+	if err := uncached.WarmCache(context.Background(), 0, 1); err == nil {
+		t.Error("Expected error when the cache is disabled")
+	}
+
+	srv := newCachingServer(t, Config{})
+	if err := srv.WarmCache(context.Background(), 2, 1); err == nil {
+		t.Error("Expected error for inverted zoom range")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := srv.WarmCache(ctx, 0, 3); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+
+	if _, err := New(Config{ImagePath: createTestJPEG(t), WarmOnStart: true}); err == nil {
+		t.Error("Expected error for WarmOnStart without a cache")
+	}
+}
+
+func TestWarmOnStart(t *testing.T) {
+	srv := newCachingServer(t, Config{WarmOnStart: true, WarmMaxZoom: 1})
+	t.Cleanup(func() { srv.Shutdown(context.Background()) })
+
+	ctx := warmContext(t)
+	for srv.cache.len() < 5 && ctx.Err() == nil {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := srv.cache.len(); got != 5 {
+		t.Errorf("Expected 5 tiles warmed in the background, got %d", got)
+	}
+}
+
+func TestWaitForWarm(t *testing.T) {
+	tests := []struct {
+		cfg    Config
+		expect int
+		name   string
+	}{
+		{Config{WarmOnStart: true, WarmMaxZoom: 1}, 5, "zooms 0-1"},
+		{Config{WarmOnStart: true, WarmMaxZoom: 2, MinZoom: 2}, 16, "starts at min zoom"},
+		{Config{WarmOnStart: true, WarmMaxZoom: 10, MaxZoom: 1}, 5, "capped at max zoom"},
+		{Config{}, 0, "not warming"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newCachingServer(t, tt.cfg)
+			t.Cleanup(func() { srv.Shutdown(context.Background()) })
+
+			if err := srv.WaitForWarm(warmContext(t)); err != nil {
+				t.Fatalf("WaitForWarm() failed: %v", err)
+			}
+			if got := srv.cache.len(); got != tt.expect {
+				t.Errorf("Expected %d tiles warmed, got %d", tt.expect, got)
+			}
+		})
+	}
+}
+
+func TestWaitForWarm_Shutdown(t *testing.T) {
+	srv := newCachingServer(t, Config{WarmOnStart: true, WarmMaxZoom: 3, MaxConcurrentRenders: 1})
+	srv.Shutdown(context.Background())
+
+	if err := srv.WaitForWarm(warmContext(t)); err != nil {
+		t.Fatalf("Expected warming to stop after Shutdown, got %v", err)
+	}
+	if got := srv.cache.len(); got == 85 {
+		t.Error("Expected Shutdown to cancel warming before all 85 tiles were rendered")
+	}
+}
+
+func TestCacheHitBypassesRenderQueue(t *testing.T) {
+	srv := newCachingServer(t, Config{
+		MaxConcurrentRenders: 1,
+		RenderQueueTimeout:   10 * time.Millisecond,
+	})
+	if err := srv.WarmCache(context.Background(), 0, 0); err != nil {
+		t.Fatalf("WarmCache() failed: %v", err)
+	}
+
+	// Occupy the only render slot
+	if err := srv.renders.wait(context.Background()); err != nil {
+		t.Fatalf("wait() failed: %v", err)
+	}
+	defer srv.renders.release()
+
+	get := func(path string) int {
+		w := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w.Code
+	}
+
+	if code := get("/0/0/0.png"); code != http.StatusOK {
+		t.Errorf("Cached tile: expected 200 despite a full render queue, got %d", code)
+	}
+	if code := get("/1/0/0.png"); code != http.StatusServiceUnavailable {
+		t.Errorf("Uncached tile: expected 503 with a full render queue, got %d", code)
+	}
+}
@@ -1,8 +1,22 @@
 package tilemath
 
 import (
+	"cmp"
+	"errors"
 	"fmt"
 	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Sentinel errors for tile coordinate validation. Use errors.Is to test for them.
+var (
+	// ErrInvalidZoom indicates a zoom level that can never be valid (e.g. negative)
+	ErrInvalidZoom = errors.New("invalid zoom level")
+
+	// ErrOutOfRange indicates a well-formed tile coordinate outside the grid for its zoom
+	ErrOutOfRange = errors.New("tile coordinate out of range")
 )
 
 // Bounds represents geographic bounds in decimal degrees (EPSG:4326)
@@ -13,6 +27,12 @@ type Bounds struct {
 	North float64 // Northern latitude
 }
 
+// LonLat is a geographic position in decimal degrees (EPSG:4326)
+type LonLat struct {
+	Lon float64 // Longitude
+	Lat float64 // Latitude
+}
+
 // TileCoord represents an XYZ tile coordinate
 type TileCoord struct {
 	Z int // Zoom level
@@ -20,24 +40,35 @@ type TileCoord struct {
 	Y int // Row (0 = top edge at ~85°N)
 }
 
+// MaxZoom is the highest zoom level tile paths are accepted at. Zoom 30
+// tiles are a few centimeters across, and 2^30 columns still fit in an
+// int32.
+const MaxZoom = 30
+
 // MaxLatitude is the maximum latitude in Web Mercator projection (~85.0511°)
 // This is the limit where the Mercator projection approaches infinity
 const MaxLatitude = 85.05112878
 
+// EarthRadius is the WGS84 semi-major axis in meters used by Web Mercator
+const EarthRadius = 6378137.0
+
+// OriginShift is half the width of the Web Mercator plane in meters (π * EarthRadius)
+const OriginShift = math.Pi * EarthRadius
+
 // TileBounds calculates the geographic bounds of an XYZ tile.
 // Returns bounds in EPSG:4326 (latitude/longitude in degrees).
 func TileBounds(z, x, y int) (Bounds, error) {
-	if z < 0 {
-		return Bounds{}, fmt.Errorf("zoom level must be >= 0, got %d", z)
+	if z < 0 || z > MaxZoom {
+		return Bounds{}, fmt.Errorf("%w: zoom level must be in range [0, %d], got %d", ErrInvalidZoom, MaxZoom, z)
 	}
 
 	n := 1 << uint(z) // 2^z
 
 	if x < 0 || x >= n {
-		return Bounds{}, fmt.Errorf("x tile must be in range [0, %d) for zoom %d, got %d", n, z, x)
+		return Bounds{}, fmt.Errorf("%w: x tile must be in range [0, %d) for zoom %d, got %d", ErrOutOfRange, n, z, x)
 	}
 	if y < 0 || y >= n {
-		return Bounds{}, fmt.Errorf("y tile must be in range [0, %d) for zoom %d, got %d", n, z, y)
+		return Bounds{}, fmt.Errorf("%w: y tile must be in range [0, %d) for zoom %d, got %d", ErrOutOfRange, n, z, y)
 	}
 
 	// Calculate bounds using tile corners
@@ -57,6 +88,35 @@ func TileBounds(z, x, y int) (Bounds, error) {
 	}, nil
 }
 
+// TileBoundsMeters calculates the bounds of an XYZ tile in Web Mercator
+// meters (EPSG:3857).
+func TileBoundsMeters(z, x, y int) (minX, minY, maxX, maxY float64, err error) {
+	// Validate the coordinate the same way as TileBounds
+	if _, err := TileBounds(z, x, y); err != nil {
+		return 0, 0, 0, 0, err
+	}
+
+	n := float64(int(1) << uint(z))
+	size := 2 * OriginShift / n
+
+	minX = float64(x)*size - OriginShift
+	maxX = minX + size
+	maxY = OriginShift - float64(y)*size
+	minY = maxY - size
+
+	return minX, minY, maxX, maxY, nil
+}
+
+// Bounds returns the geographic bounds of the tile, see TileBounds
+func (tc TileCoord) Bounds() (Bounds, error) {
+	return TileBounds(tc.Z, tc.X, tc.Y)
+}
+
+// BoundsMeters returns the Web Mercator bounds of the tile, see TileBoundsMeters
+func (tc TileCoord) BoundsMeters() (minX, minY, maxX, maxY float64, err error) {
+	return TileBoundsMeters(tc.Z, tc.X, tc.Y)
+}
+
 // tileXToLon converts a tile X coordinate to longitude in degrees
 func tileXToLon(x, n int) float64 {
 	return float64(x)/float64(n)*360.0 - 180.0
@@ -73,8 +133,8 @@ func tileYToLat(y, n int) float64 {
 
 // LonLatToTile converts longitude/latitude to the tile coordinate containing that point
 func LonLatToTile(lon, lat float64, z int) (TileCoord, error) {
-	if z < 0 {
-		return TileCoord{}, fmt.Errorf("zoom level must be >= 0, got %d", z)
+	if z < 0 || z > MaxZoom {
+		return TileCoord{}, fmt.Errorf("%w: zoom level must be in range [0, %d], got %d", ErrInvalidZoom, MaxZoom, z)
 	}
 
 	if lon < -180.0 || lon > 180.0 {
@@ -122,6 +182,228 @@ func LonLatToTile(lon, lat float64, z int) (TileCoord, error) {
 	return TileCoord{Z: z, X: xtile, Y: ytile}, nil
 }
 
+// LonLatToTileStrict is like LonLatToTile but rejects latitudes outside [-90, 90].
+// Latitudes between the Web Mercator limit (~85.0511°) and the poles are still
+// clamped, so this distinguishes "pole region, clamp" from "nonsense input, reject".
+func LonLatToTileStrict(lon, lat float64, z int) (TileCoord, error) {
+	if math.IsNaN(lat) || lat < -90.0 || lat > 90.0 {
+		return TileCoord{}, fmt.Errorf("latitude must be in range [-90, 90], got %f", lat)
+	}
+
+	return LonLatToTile(lon, lat, z)
+}
+
+// TileSize is the width and height of a tile in pixels, the size zoom
+// levels are defined against
+const TileSize = 256
+
+// Resolution returns the Web Mercator ground resolution at zoom z, in
+// meters per pixel at the equator
+func Resolution(z int) float64 {
+	return 2 * OriginShift / (TileSize * math.Exp2(float64(z)))
+}
+
+// ViewportBounds returns the geographic extent of a widthPx x heightPx
+// screen centered on (centerLon, centerLat) at zoom z. Latitudes are clamped
+// to the Web Mercator limit. A viewport crossing the antimeridian gets a west
+// edge greater than its east edge; one at least as wide as the world spans
+// the full -180 to 180.
+func ViewportBounds(centerLon, centerLat float64, z, widthPx, heightPx int) (Bounds, error) {
+	if z < 0 || z > MaxZoom {
+		return Bounds{}, fmt.Errorf("%w: zoom level must be in range [0, %d], got %d", ErrInvalidZoom, MaxZoom, z)
+	}
+	if widthPx <= 0 || heightPx <= 0 {
+		return Bounds{}, fmt.Errorf("viewport size must be positive, got %dx%d", widthPx, heightPx)
+	}
+	if math.IsNaN(centerLon) || centerLon < -180.0 || centerLon > 180.0 {
+		return Bounds{}, fmt.Errorf("longitude must be in range [-180, 180], got %f", centerLon)
+	}
+	if math.IsNaN(centerLat) || centerLat < -90.0 || centerLat > 90.0 {
+		return Bounds{}, fmt.Errorf("latitude must be in range [-90, 90], got %f", centerLat)
+	}
+	centerLat = max(min(centerLat, MaxLatitude), -MaxLatitude)
+
+	res := Resolution(z)
+	halfWidth := float64(widthPx) * res / 2
+	halfHeight := float64(heightPx) * res / 2
+
+	// Project the center to meters and offset by half the screen each way
+	cx := centerLon * OriginShift / 180.0
+	latRad := centerLat * math.Pi / 180.0
+	cy := math.Log(math.Tan(math.Pi/4+latRad/2)) * EarthRadius
+
+	minY := max(cy-halfHeight, -OriginShift)
+	maxY := min(cy+halfHeight, OriginShift)
+	b := Bounds{
+		South: metersToLat(minY),
+		North: metersToLat(maxY),
+		West:  -180.0,
+		East:  180.0,
+	}
+	if halfWidth < OriginShift {
+		b.West = wrapLon((cx - halfWidth) * 180.0 / OriginShift)
+		b.East = wrapLon((cx + halfWidth) * 180.0 / OriginShift)
+	}
+	return b, nil
+}
+
+// metersToLat converts a Web Mercator y coordinate in meters to latitude
+func metersToLat(y float64) float64 {
+	return math.Atan(math.Sinh(y/EarthRadius)) * 180.0 / math.Pi
+}
+
+// wrapLon wraps a longitude into [-180, 180]
+func wrapLon(lon float64) float64 {
+	if lon >= -180.0 && lon <= 180.0 {
+		return lon
+	}
+	return math.Mod(math.Mod(lon+180.0, 360.0)+360.0, 360.0) - 180.0
+}
+
+// ParseBounds parses a bounding box given as "west,south,east,north" in
+// decimal degrees. A west edge greater than the east edge denotes a box
+// crossing the antimeridian, e.g. "170,-50,-170,-30".
+func ParseBounds(s string) (Bounds, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 4 {
+		return Bounds{}, fmt.Errorf("bounds must be west,south,east,north, got %q", s)
+	}
+
+	var v [4]float64
+	for i, p := range parts {
+		f, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil || math.IsNaN(f) {
+			return Bounds{}, fmt.Errorf("invalid bounds value %q", p)
+		}
+		v[i] = f
+	}
+	b := Bounds{West: v[0], South: v[1], East: v[2], North: v[3]}
+
+	if b.West < -180 || b.West > 180 || b.East < -180 || b.East > 180 {
+		return Bounds{}, fmt.Errorf("longitudes must be in range [-180, 180], got %s", b)
+	}
+	if b.South < -90 || b.North > 90 || b.South >= b.North {
+		return Bounds{}, fmt.Errorf("latitudes must satisfy -90 <= south < north <= 90, got %s", b)
+	}
+	if b.West == b.East {
+		return Bounds{}, fmt.Errorf("west and east must differ, got %s", b)
+	}
+	return b, nil
+}
+
+// ParseLonLat parses a position given as "lon,lat" in degrees, the
+// longitude first as in ParseBounds
+func ParseLonLat(s string) (LonLat, error) {
+	lon, lat, ok := strings.Cut(s, ",")
+	if !ok {
+		return LonLat{}, fmt.Errorf("position must be lon,lat, got %q", s)
+	}
+
+	var p LonLat
+	var err error
+	if p.Lon, err = strconv.ParseFloat(strings.TrimSpace(lon), 64); err != nil {
+		return LonLat{}, fmt.Errorf("invalid longitude %q", lon)
+	}
+	if p.Lat, err = strconv.ParseFloat(strings.TrimSpace(lat), 64); err != nil {
+		return LonLat{}, fmt.Errorf("invalid latitude %q", lat)
+	}
+	return p, p.Validate()
+}
+
+// Validate checks that the longitude is in [-180, 180] and the latitude in
+// [-90, 90]. Latitudes beyond MaxLatitude are valid but lie off the map.
+func (p LonLat) Validate() error {
+	if !(p.Lon >= -180 && p.Lon <= 180) {
+		return fmt.Errorf("longitude must be in range [-180, 180], got %v", p.Lon)
+	}
+	if !(p.Lat >= -90 && p.Lat <= 90) {
+		return fmt.Errorf("latitude must be in range [-90, 90], got %v", p.Lat)
+	}
+	return nil
+}
+
+// CrossesAntimeridian reports whether the bounds wrap across 180°,
+// i.e. the west edge lies east of the east edge
+func (b Bounds) CrossesAntimeridian() bool {
+	return b.West > b.East
+}
+
+// Intersects reports whether b and other share any area. Boxes that only
+// touch along an edge do not intersect. Either box may cross the antimeridian.
+func (b Bounds) Intersects(other Bounds) bool {
+	if b.South >= other.North || other.South >= b.North {
+		return false
+	}
+	for _, i := range b.lonIntervals() {
+		for _, j := range other.lonIntervals() {
+			if i[0] < j[1] && j[0] < i[1] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Contains reports whether p lies inside b or on its edges. b may cross the
+// antimeridian.
+func (b Bounds) Contains(p LonLat) bool {
+	if p.Lat < b.South || p.Lat > b.North {
+		return false
+	}
+	for _, i := range b.lonIntervals() {
+		if p.Lon >= i[0] && p.Lon <= i[1] {
+			return true
+		}
+	}
+	return false
+}
+
+// Clip returns the part of b inside to, and whether there is any: like
+// Intersects, boxes that only touch along an edge do not overlap. Either box
+// may cross the antimeridian. Where the overlap falls apart into separate
+// longitude spans, such as a box crossing the antimeridian clipped to one
+// that almost circles the globe, Clip returns the narrowest box covering all
+// of them.
+func (b Bounds) Clip(to Bounds) (Bounds, bool) {
+	south, north := max(b.South, to.South), min(b.North, to.North)
+	if south >= north {
+		return Bounds{}, false
+	}
+
+	var spans [][2]float64
+	for _, i := range b.lonIntervals() {
+		for _, j := range to.lonIntervals() {
+			if west, east := max(i[0], j[0]), min(i[1], j[1]); west < east {
+				spans = append(spans, [2]float64{west, east})
+			}
+		}
+	}
+	if len(spans) == 0 {
+		return Bounds{}, false
+	}
+	slices.SortFunc(spans, func(a, b [2]float64) int { return cmp.Compare(a[0], b[0]) })
+
+	// Leave out the widest gap between spans; when it is the one across the
+	// antimeridian, the result does not cross it
+	first, last := spans[0], spans[len(spans)-1]
+	west, east := first[0], last[1]
+	widest := first[0] + 360 - last[1]
+	for k := 1; k < len(spans); k++ {
+		if gap := spans[k][0] - spans[k-1][1]; gap > widest {
+			widest, west, east = gap, spans[k][0], spans[k-1][1]
+		}
+	}
+	return Bounds{West: west, South: south, East: east, North: north}, true
+}
+
+// lonIntervals splits the longitude span into non-wrapping [west, east] intervals
+func (b Bounds) lonIntervals() [][2]float64 {
+	if b.CrossesAntimeridian() {
+		return [][2]float64{{b.West, 180}, {-180, b.East}}
+	}
+	return [][2]float64{{b.West, b.East}}
+}
+
 // String returns a string representation of the bounds
 func (b Bounds) String() string {
 	return fmt.Sprintf("Bounds[W:%.6f, S:%.6f, E:%.6f, N:%.6f]", b.West, b.South, b.East, b.North)
@@ -131,3 +413,32 @@ func (b Bounds) String() string {
 func (tc TileCoord) String() string {
 	return fmt.Sprintf("Tile[z:%d, x:%d, y:%d]", tc.Z, tc.X, tc.Y)
 }
+
+// Path returns the tile's URL path, /{z}/{x}/{y}.{ext}, or /{z}/{x}/{y}
+// when ext is empty
+func (tc TileCoord) Path(ext string) string {
+	if ext == "" {
+		return fmt.Sprintf("/%d/%d/%d", tc.Z, tc.X, tc.Y)
+	}
+	return fmt.Sprintf("/%d/%d/%d.%s", tc.Z, tc.X, tc.Y, ext)
+}
+
+// FlipY converts row y at zoom z between the XYZ scheme, which counts rows
+// from the north, and TMS, which counts them from the south. It is its own
+// inverse.
+func FlipY(z, y int) int {
+	return 1<<uint(z) - 1 - y
+}
+
+// TileCount returns the number of tiles from minZoom to maxZoom inclusive,
+// the sum of 4^z over the range. The range is clamped to [0, MaxZoom], where
+// the count, just over 2^60, fits an int64; an empty range counts 0 tiles.
+func TileCount(minZoom, maxZoom int) int64 {
+	minZoom = max(minZoom, 0)
+	maxZoom = min(maxZoom, MaxZoom)
+	if minZoom > maxZoom {
+		return 0
+	}
+	// 4^min + ... + 4^max = (4^(max+1) - 4^min) / 3
+	return (int64(1)<<uint(2*(maxZoom+1)) - int64(1)<<uint(2*minZoom)) / 3
+}
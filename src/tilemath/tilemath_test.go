@@ -1,6 +1,7 @@
 package tilemath
 
 import (
+	"errors"
 	"math"
 	"testing"
 )
@@ -106,6 +107,99 @@ func TestTileBounds_Errors(t *testing.T) {
 	}
 }
 
+func TestTileBounds_SentinelErrors(t *testing.T) {
+	tests := []struct {
+		z, x, y int
+		expect  error
+		name    string
+	}{
+		{-1, 0, 0, ErrInvalidZoom, "negative zoom"},
+		{31, 0, 0, ErrInvalidZoom, "zoom 31"},
+		{63, 0, 0, ErrInvalidZoom, "zoom 63, where 1<<z goes negative"},
+		{64, 0, 0, ErrInvalidZoom, "zoom 64, where 1<<z is zero"},
+		{0, 1, 0, ErrOutOfRange, "x out of range"},
+		{3, 0, 8, ErrOutOfRange, "y out of range"},
+		{3, -1, 0, ErrOutOfRange, "negative x"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := TileBounds(tt.z, tt.x, tt.y)
+			if !errors.Is(err, tt.expect) {
+				t.Errorf("TileBounds(%d, %d, %d) error = %v, expected errors.Is %v", tt.z, tt.x, tt.y, err, tt.expect)
+			}
+		})
+	}
+
+	if _, err := LonLatToTile(0, 0, -1); !errors.Is(err, ErrInvalidZoom) {
+		t.Errorf("LonLatToTile with negative zoom error = %v, expected ErrInvalidZoom", err)
+	}
+	for _, z := range []int{31, 63, 64} {
+		if _, err := LonLatToTile(0, 0, z); !errors.Is(err, ErrInvalidZoom) {
+			t.Errorf("LonLatToTile with zoom %d error = %v, expected ErrInvalidZoom", z, err)
+		}
+	}
+}
+
+func TestTileBoundsMeters(t *testing.T) {
+	tests := []struct {
+		z, x, y                int
+		minX, minY, maxX, maxY float64
+		name                   string
+	}{
+		{0, 0, 0, -OriginShift, -OriginShift, OriginShift, OriginShift, "zoom 0 world"},
+		{1, 0, 0, -OriginShift, 0, 0, OriginShift, "zoom 1 NW quadrant"},
+		{1, 1, 1, 0, -OriginShift, OriginShift, 0, "zoom 1 SE quadrant"},
+		{2, 3, 0, OriginShift / 2, OriginShift / 2, OriginShift, OriginShift, "zoom 2 top-right"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			minX, minY, maxX, maxY, err := TileBoundsMeters(tt.z, tt.x, tt.y)
+			if err != nil {
+				t.Fatalf("TileBoundsMeters(%d, %d, %d) failed: %v", tt.z, tt.x, tt.y, err)
+			}
+
+			assertFloat64Near(t, tt.minX, minX, 1e-6, "minX")
+			assertFloat64Near(t, tt.minY, minY, 1e-6, "minY")
+			assertFloat64Near(t, tt.maxX, maxX, 1e-6, "maxX")
+			assertFloat64Near(t, tt.maxY, maxY, 1e-6, "maxY")
+		})
+	}
+
+	if _, _, _, _, err := TileBoundsMeters(1, 2, 0); !errors.Is(err, ErrOutOfRange) {
+		t.Errorf("Expected ErrOutOfRange, got %v", err)
+	}
+}
+
+func TestTileCoord_BoundsMatchFreeFunctions(t *testing.T) {
+	coords := []TileCoord{
+		{0, 0, 0},
+		{1, 1, 0},
+		{5, 17, 11},
+		{10, 1023, 0},
+		{-1, 0, 0},
+		{2, 4, 0},
+	}
+
+	for _, tc := range coords {
+		t.Run(tc.String(), func(t *testing.T) {
+			wantBounds, wantErr := TileBounds(tc.Z, tc.X, tc.Y)
+			gotBounds, gotErr := tc.Bounds()
+			if gotBounds != wantBounds || (gotErr == nil) != (wantErr == nil) {
+				t.Errorf("Bounds() = %v, %v; TileBounds = %v, %v", gotBounds, gotErr, wantBounds, wantErr)
+			}
+
+			w0, w1, w2, w3, wantErr := TileBoundsMeters(tc.Z, tc.X, tc.Y)
+			g0, g1, g2, g3, gotErr := tc.BoundsMeters()
+			if g0 != w0 || g1 != w1 || g2 != w2 || g3 != w3 || (gotErr == nil) != (wantErr == nil) {
+				t.Errorf("BoundsMeters() = %v %v %v %v, %v; TileBoundsMeters = %v %v %v %v, %v",
+					g0, g1, g2, g3, gotErr, w0, w1, w2, w3, wantErr)
+			}
+		})
+	}
+}
+
 func TestLonLatToTile_Zoom0(t *testing.T) {
 	// Any point should map to tile (0, 0) at zoom 0
 	tests := []struct {
@@ -207,6 +301,59 @@ func TestLonLatToTile_Errors(t *testing.T) {
 	}
 }
 
+func TestLonLatToTileStrict(t *testing.T) {
+	// Pole region (between the Mercator limit and 90°) is clamped, not rejected
+	tile, err := LonLatToTileStrict(0, 87.0, 5)
+	if err != nil {
+		t.Fatalf("LonLatToTileStrict(0, 87, 5) should clamp, got error: %v", err)
+	}
+	if tile.Y != 0 {
+		t.Errorf("Expected 87° to clamp to top row, got y=%d", tile.Y)
+	}
+
+	tile, err = LonLatToTileStrict(0, -87.0, 5)
+	if err != nil {
+		t.Fatalf("LonLatToTileStrict(0, -87, 5) should clamp, got error: %v", err)
+	}
+	if tile.Y != 31 {
+		t.Errorf("Expected -87° to clamp to bottom row, got y=%d", tile.Y)
+	}
+
+	// Results should match the lenient variant for valid input
+	lenient, _ := LonLatToTile(2.35, 48.86, 10)
+	strict, err := LonLatToTileStrict(2.35, 48.86, 10)
+	if err != nil {
+		t.Fatalf("LonLatToTileStrict failed: %v", err)
+	}
+	if strict != lenient {
+		t.Errorf("Expected %v, got %v", lenient, strict)
+	}
+}
+
+func TestLonLatToTileStrict_Errors(t *testing.T) {
+	tests := []struct {
+		lon, lat float64
+		z        int
+		name     string
+	}{
+		{0, 200.0, 5, "latitude far beyond north"},
+		{0, -200.0, 5, "latitude far beyond south"},
+		{0, 90.0001, 5, "just past north pole"},
+		{0, math.NaN(), 5, "NaN latitude"},
+		{181, 0, 5, "longitude too large"},
+		{0, 0, -1, "negative zoom"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LonLatToTileStrict(tt.lon, tt.lat, tt.z)
+			if err == nil {
+				t.Errorf("LonLatToTileStrict(%f, %f, %d) should return error but got nil", tt.lon, tt.lat, tt.z)
+			}
+		})
+	}
+}
+
 func TestRoundTrip_LonLatToTileAndBack(t *testing.T) {
 	// Test that converting lon/lat -> tile -> bounds includes the original point
 	tests := []struct {
@@ -298,6 +445,182 @@ func TestBounds_String(t *testing.T) {
 	}
 }
 
+func TestParseBounds(t *testing.T) {
+	tests := []struct {
+		input       string
+		expect      Bounds
+		expectError bool
+		name        string
+	}{
+		{"-10,35,30,70", Bounds{West: -10, South: 35, East: 30, North: 70}, false, "europe"},
+		{" -180 , -90 , 180 , 90 ", Bounds{West: -180, South: -90, East: 180, North: 90}, false, "whole world with spaces"},
+		{"170,-50,-170,-30", Bounds{West: 170, South: -50, East: -170, North: -30}, false, "antimeridian crossing"},
+		{"-10,35,30", Bounds{}, true, "too few values"},
+		{"-10,35,30,70,1", Bounds{}, true, "too many values"},
+		{"west,35,30,70", Bounds{}, true, "not a number"},
+		{"-10,NaN,30,70", Bounds{}, true, "NaN"},
+		{"-190,35,30,70", Bounds{}, true, "longitude out of range"},
+		{"-10,-95,30,70", Bounds{}, true, "latitude out of range"},
+		{"-10,70,30,35", Bounds{}, true, "south above north"},
+		{"30,35,30,70", Bounds{}, true, "zero width"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := ParseBounds(tt.input)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Expected error for %q, got %s", tt.input, b)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseBounds(%q) failed: %v", tt.input, err)
+			}
+			if b != tt.expect {
+				t.Errorf("Expected %s, got %s", tt.expect, b)
+			}
+		})
+	}
+}
+
+func TestParseLonLat(t *testing.T) {
+	tests := []struct {
+		input       string
+		expect      LonLat
+		expectError bool
+		name        string
+	}{
+		{"2.35,48.86", LonLat{Lon: 2.35, Lat: 48.86}, false, "paris"},
+		{" -180 , -90 ", LonLat{Lon: -180, Lat: -90}, false, "corner with spaces"},
+		{"2.35", LonLat{}, true, "one value"},
+		{"2.35,48.86,1", LonLat{}, true, "too many values"},
+		{"east,48.86", LonLat{}, true, "not a number"},
+		{"NaN,48.86", LonLat{}, true, "NaN"},
+		{"181,0", LonLat{}, true, "longitude out of range"},
+		{"0,-91", LonLat{}, true, "latitude out of range"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := ParseLonLat(tt.input)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Expected error for %q, got %+v", tt.input, p)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseLonLat(%q) failed: %v", tt.input, err)
+			}
+			if p != tt.expect {
+				t.Errorf("Expected %+v, got %+v", tt.expect, p)
+			}
+		})
+	}
+}
+
+func TestBounds_Intersects(t *testing.T) {
+	europe := Bounds{West: -10, South: 35, East: 30, North: 70}
+	pacific := Bounds{West: 170, South: -50, East: -170, North: -30}
+
+	tests := []struct {
+		a, b   Bounds
+		expect bool
+		name   string
+	}{
+		{europe, Bounds{West: 2, South: 48, East: 3, North: 49}, true, "contained"},
+		{europe, Bounds{West: 25, South: 60, East: 40, North: 80}, true, "overlapping corner"},
+		{europe, Bounds{West: 113, South: -44, East: 154, North: -10}, false, "disjoint"},
+		{europe, Bounds{West: 30, South: 35, East: 40, North: 70}, false, "touching edge"},
+		{europe, Bounds{West: -10, South: 10, East: 30, North: 20}, false, "same longitudes, disjoint latitudes"},
+		{pacific, Bounds{West: 175, South: -45, East: 180, North: -40}, true, "east of antimeridian"},
+		{pacific, Bounds{West: -180, South: -45, East: -175, North: -40}, true, "west of antimeridian"},
+		{pacific, Bounds{West: 0, South: -45, East: 10, North: -40}, false, "outside wrapped span"},
+		{pacific, Bounds{West: 160, South: -45, East: -160, North: -40}, true, "both crossing"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.a.Intersects(tt.b); got != tt.expect {
+				t.Errorf("%s.Intersects(%s) = %v, expected %v", tt.a, tt.b, got, tt.expect)
+			}
+			if got := tt.b.Intersects(tt.a); got != tt.expect {
+				t.Errorf("%s.Intersects(%s) = %v, expected %v", tt.b, tt.a, got, tt.expect)
+			}
+		})
+	}
+}
+
+func TestBounds_Contains(t *testing.T) {
+	europe := Bounds{West: -10, South: 35, East: 30, North: 70}
+	pacific := Bounds{West: 170, South: -50, East: -170, North: -30}
+
+	tests := []struct {
+		b      Bounds
+		p      LonLat
+		expect bool
+		name   string
+	}{
+		{europe, LonLat{Lon: 2.35, Lat: 48.86}, true, "inside"},
+		{europe, LonLat{Lon: 30, Lat: 70}, true, "on corner"},
+		{europe, LonLat{Lon: 151.2, Lat: -33.9}, false, "outside"},
+		{europe, LonLat{Lon: 2.35, Lat: 71}, false, "north of box"},
+		{pacific, LonLat{Lon: 175, Lat: -40}, true, "east of antimeridian"},
+		{pacific, LonLat{Lon: -175, Lat: -40}, true, "west of antimeridian"},
+		{pacific, LonLat{Lon: 0, Lat: -40}, false, "outside wrapped span"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.b.Contains(tt.p); got != tt.expect {
+				t.Errorf("%s.Contains(%v) = %v, expected %v", tt.b, tt.p, got, tt.expect)
+			}
+		})
+	}
+}
+
+func TestBounds_Clip(t *testing.T) {
+	europe := Bounds{West: -10, South: 35, East: 30, North: 70}
+	pacific := Bounds{West: 170, South: -50, East: -170, North: -30}
+	world := Bounds{West: -180, South: -90, East: 180, North: 90}
+
+	tests := []struct {
+		b, to    Bounds
+		expect   Bounds
+		expectOK bool
+		name     string
+	}{
+		{Bounds{West: 2, South: 48, East: 3, North: 49}, europe, Bounds{West: 2, South: 48, East: 3, North: 49}, true, "fully inside"},
+		{europe, Bounds{West: 2, South: 48, East: 3, North: 49}, Bounds{West: 2, South: 48, East: 3, North: 49}, true, "fully containing"},
+		{europe, Bounds{West: 25, South: 60, East: 40, North: 80}, Bounds{West: 25, South: 60, East: 30, North: 70}, true, "partially overlapping"},
+		{europe, Bounds{West: 113, South: -44, East: 154, North: -10}, Bounds{}, false, "disjoint"},
+		{europe, Bounds{West: 30, South: 35, East: 40, North: 70}, Bounds{}, false, "touching edge"},
+		{europe, Bounds{West: -10, South: 10, East: 30, North: 20}, Bounds{}, false, "disjoint latitudes"},
+		{pacific, world, pacific, true, "crossing inside world"},
+		{pacific, Bounds{West: 175, South: -60, East: 180, North: -40}, Bounds{West: 175, South: -50, East: 180, North: -40}, true, "crossing clipped east of antimeridian"},
+		{pacific, Bounds{West: -180, South: -45, East: 0, North: 0}, Bounds{West: -180, South: -45, East: -170, North: -30}, true, "crossing clipped west of antimeridian"},
+		{pacific, Bounds{West: 160, South: -45, East: -175, North: -40}, Bounds{West: 170, South: -45, East: -175, North: -40}, true, "both crossing"},
+		{pacific, Bounds{West: 0, South: -45, East: 10, North: -40}, Bounds{}, false, "outside crossing span"},
+		{pacific, Bounds{West: -175, South: -50, East: 175, North: -30}, Bounds{West: 170, South: -50, East: -170, North: -30}, true, "split across antimeridian"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := tt.b.Clip(tt.to)
+			if ok != tt.expectOK || got != tt.expect {
+				t.Errorf("%s.Clip(%s) = %s, %v, expected %s, %v", tt.b, tt.to, got, ok, tt.expect, tt.expectOK)
+			}
+			if ok != tt.b.Intersects(tt.to) {
+				t.Errorf("Expected Clip to agree with Intersects, got %v", ok)
+			}
+			if back, backOK := tt.to.Clip(tt.b); backOK != ok || back != got {
+				t.Errorf("Expected Clip to be symmetric, got %s, %v", back, backOK)
+			}
+		})
+	}
+}
+
 func TestTileCoord_String(t *testing.T) {
 	tile := TileCoord{Z: 5, X: 10, Y: 15}
 	str := tile.String()
@@ -307,6 +630,84 @@ func TestTileCoord_String(t *testing.T) {
 	}
 }
 
+func TestTileCoord_Path(t *testing.T) {
+	tests := []struct {
+		tile   TileCoord
+		ext    string
+		expect string
+		name   string
+	}{
+		{TileCoord{Z: 0, X: 0, Y: 0}, "png", "/0/0/0.png", "zoom 0"},
+		{TileCoord{Z: 5, X: 10, Y: 15}, "webp", "/5/10/15.webp", "webp"},
+		{TileCoord{Z: 3, X: 4, Y: 2}, "", "/3/4/2", "no extension"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.tile.Path(tt.ext); got != tt.expect {
+				t.Errorf("Expected %q, got %q", tt.expect, got)
+			}
+		})
+	}
+}
+
+func TestResolution(t *testing.T) {
+	assertFloat64Near(t, 156543.03392804097, Resolution(0), 1e-6, "zoom 0")
+	assertFloat64Near(t, 38.21851414258813, Resolution(12), 1e-9, "zoom 12")
+}
+
+func TestViewportBounds(t *testing.T) {
+	tests := []struct {
+		lon, lat      float64
+		z             int
+		width, height int
+		expect        Bounds
+		name          string
+	}{
+		{0, 0, 0, 256, 256, Bounds{West: -180, South: -MaxLatitude, East: 180, North: MaxLatitude}, "centered zoom 0"},
+		{0, 0, 0, 1024, 256, Bounds{West: -180, South: -MaxLatitude, East: 180, North: MaxLatitude}, "wider than the world"},
+		{2.3522, 48.8566, 12, 1024, 768, Bounds{West: 2.17641875, South: 48.769783928854544, East: 2.52798125, North: 48.94326576821722}, "Paris at zoom 12"},
+		{179.9, 0, 10, 800, 600, Bounds{West: 179.35068359375, South: -0.4119837545, East: -179.55068359375, North: 0.4119837545}, "crossing the antimeridian"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ViewportBounds(tt.lon, tt.lat, tt.z, tt.width, tt.height)
+			if err != nil {
+				t.Fatalf("ViewportBounds() failed: %v", err)
+			}
+			assertFloat64Near(t, tt.expect.West, got.West, 1e-6, "west")
+			assertFloat64Near(t, tt.expect.South, got.South, 1e-6, "south")
+			assertFloat64Near(t, tt.expect.East, got.East, 1e-6, "east")
+			assertFloat64Near(t, tt.expect.North, got.North, 1e-6, "north")
+		})
+	}
+}
+
+func TestViewportBounds_Invalid(t *testing.T) {
+	tests := []struct {
+		lon, lat      float64
+		z             int
+		width, height int
+		name          string
+	}{
+		{0, 0, -1, 256, 256, "negative zoom"},
+		{0, 0, MaxZoom + 1, 256, 256, "zoom too high"},
+		{0, 0, 3, 0, 256, "zero width"},
+		{0, 0, 3, 256, -1, "negative height"},
+		{181, 0, 3, 256, 256, "longitude out of range"},
+		{0, 91, 3, 256, 256, "latitude out of range"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ViewportBounds(tt.lon, tt.lat, tt.z, tt.width, tt.height); err == nil {
+				t.Error("Expected an error")
+			}
+		})
+	}
+}
+
 // assertFloat64Near checks if two float64 values are within epsilon of each other
 func assertFloat64Near(t *testing.T, expected, actual, epsilon float64, name string) {
 	t.Helper()
@@ -315,3 +716,62 @@ func assertFloat64Near(t *testing.T, expected, actual, epsilon float64, name str
 			name, expected, actual, math.Abs(expected-actual))
 	}
 }
+
+func TestFlipY(t *testing.T) {
+	tests := []struct {
+		z, y     int
+		expected int
+		name     string
+	}{
+		{0, 0, 0, "world tile"},
+		{1, 0, 1, "zoom 1 north"},
+		{1, 1, 0, "zoom 1 south"},
+		{3, 2, 5, "zoom 3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FlipY(tt.z, tt.y); got != tt.expected {
+				t.Errorf("FlipY(%d, %d) = %d, expected %d", tt.z, tt.y, got, tt.expected)
+			}
+			if back := FlipY(tt.z, FlipY(tt.z, tt.y)); back != tt.y {
+				t.Errorf("Expected FlipY to be its own inverse, got %d for %d", back, tt.y)
+			}
+		})
+	}
+}
+
+func TestTileCount(t *testing.T) {
+	tests := []struct {
+		minZoom, maxZoom int
+		expected         int64
+		name             string
+	}{
+		{0, 0, 1, "world tile"},
+		{0, 2, 21, "zooms 0-2"},
+		{3, 3, 64, "single zoom"},
+		{2, 4, 16 + 64 + 256, "zooms 2-4"},
+		{0, MaxZoom, 1537228672809129301, "every zoom"},
+		{MaxZoom, MaxZoom, 1 << 60, "max zoom"},
+		{-2, 1, 5, "negative min zoom clamped"},
+		{29, 40, 1<<58 + 1<<60, "max zoom clamped"},
+		{3, 2, 0, "empty range"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := TileCount(tt.minZoom, tt.maxZoom); got != tt.expected {
+				t.Errorf("TileCount(%d, %d) = %d, expected %d", tt.minZoom, tt.maxZoom, got, tt.expected)
+			}
+		})
+	}
+
+	// The closed form matches summing zoom by zoom
+	var sum int64
+	for z := 0; z <= MaxZoom; z++ {
+		sum += int64(1) << uint(2*z)
+		if got := TileCount(0, z); got != sum {
+			t.Errorf("TileCount(0, %d) = %d, expected %d", z, got, sum)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+// Package tileprovider defines the interface the server renders tiles
+// through, so tile sources other than an in-memory base map can be served
+// as layers.
+package tileprovider
+
+import (
+	"context"
+	"image"
+
+	"org.xyzmaps.xyztiles/src/imagery"
+)
+
+// Provider renders XYZ tiles. Tile returns the tile z/x/y as an
+// opts.Size square (imagery.TileSize if zero) with opts.Buffer extra pixels
+// on every side, and should honor the other options where they apply.
+// Errors for coordinates outside the grid should wrap imagery.ErrInvalidZoom
+// or imagery.ErrOutOfRange, and Tile should give up with ctx.Err() once ctx
+// is done. The returned image belongs to the caller, which may draw on it,
+// and Tile may be called concurrently.
+type Provider interface {
+	Tile(ctx context.Context, z, x, y int, opts imagery.TileOptions) (image.Image, error)
+}
+
+// ZoomRanger is implemented by providers that know the zooms they have
+// tiles for. The server uses it when no max zoom is configured.
+type ZoomRanger interface {
+	ZoomRange() (minZoom, maxZoom int)
+}
+
+var _ ZoomRanger = (*Proxy)(nil)
+
+// BaseMap renders tiles from an equirectangular image held in memory
+var _ Provider = (*imagery.BaseMap)(nil)
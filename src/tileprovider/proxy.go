@@ -0,0 +1,202 @@
+package tileprovider
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/jpeg" // Upstream tiles may be JPEG
+	_ "image/png"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	xdraw "golang.org/x/image/draw"
+	"org.xyzmaps.xyztiles/src/imagery"
+	"org.xyzmaps.xyztiles/src/lrucache"
+	"org.xyzmaps.xyztiles/src/tilemath"
+)
+
+// DefaultProxyTimeout is how long a Proxy waits for an upstream tile when
+// ProxyOptions.Timeout is not set
+const DefaultProxyTimeout = 10 * time.Second
+
+// DefaultProxyMaxZoom is the highest zoom a Proxy serves when
+// ProxyOptions.MaxZoom is not set, that of most public XYZ servers
+const DefaultProxyMaxZoom = 19
+
+// DefaultProxyCacheBytes bounds the upstream tiles a Proxy keeps in memory
+// when ProxyOptions.CacheBytes is not set
+const DefaultProxyCacheBytes = 32 << 20
+
+// maxUpstreamTileBytes bounds the size of a single upstream tile
+const maxUpstreamTileBytes = 8 << 20
+
+// maxUpstreamTileSize bounds the width and height of an upstream tile, so
+// a hostile or misconfigured upstream cannot make decoding allocate a huge
+// image from a small, highly compressed file
+const maxUpstreamTileSize = imagery.TileSize
+
+// ErrTileNotFound is returned by a Proxy for a tile the upstream server does
+// not have or did not return in time
+var ErrTileNotFound = errors.New("tile not found upstream")
+
+// errUpstreamMissing marks an upstream 404 or timeout inside Proxy
+var errUpstreamMissing = errors.New("upstream tile missing")
+
+// ProxyOptions configures a Proxy. The zero value is usable.
+type ProxyOptions struct {
+	Timeout    time.Duration // Per upstream request (default DefaultProxyTimeout)
+	MaxZoom    int           // Highest zoom served (default DefaultProxyMaxZoom)
+	CacheBytes int64         // Upstream tiles kept in memory (default DefaultProxyCacheBytes)
+	UserAgent  string        // Sent upstream; many tile servers require one (default "xyztiles")
+
+	// Transparent serves a transparent tile, instead of ErrTileNotFound,
+	// for tiles the upstream server does not have or does not return within
+	// Timeout
+	Transparent bool
+
+	Client *http.Client // Optional: used for upstream requests instead of http.DefaultClient
+}
+
+// Proxy serves tiles fetched from an upstream XYZ tile server, resampled to
+// the requested size. Fetched tiles are cached in memory; missing ones and
+// failures are fetched again on the next request.
+type Proxy struct {
+	template string
+	opts     ProxyOptions
+	cache    *lrucache.Cache
+}
+
+// NewProxy returns a Proxy fetching tiles from the http or https URL
+// template, in which {z}, {x} and {y} are replaced by the tile coordinates,
+// e.g. https://tile.example.com/{z}/{x}/{y}.png
+func NewProxy(template string, opts ProxyOptions) (*Proxy, error) {
+	for _, p := range []string{"{z}", "{x}", "{y}"} {
+		if !strings.Contains(template, p) {
+			return nil, fmt.Errorf("URL template %q has no %s", template, p)
+		}
+	}
+	u, err := url.Parse(strings.NewReplacer("{z}", "0", "{x}", "0", "{y}", "0").Replace(template))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("URL template %q is not an http or https URL", template)
+	}
+	if opts.Timeout < 0 || opts.MaxZoom < 0 || opts.MaxZoom > tilemath.MaxZoom || opts.CacheBytes < 0 {
+		return nil, fmt.Errorf("invalid proxy options: timeout, max zoom (at most %d) and cache size must not be negative", tilemath.MaxZoom)
+	}
+
+	opts.Timeout = cmp.Or(opts.Timeout, DefaultProxyTimeout)
+	opts.MaxZoom = cmp.Or(opts.MaxZoom, DefaultProxyMaxZoom)
+	opts.CacheBytes = cmp.Or(opts.CacheBytes, DefaultProxyCacheBytes)
+	opts.UserAgent = cmp.Or(opts.UserAgent, "xyztiles")
+	if opts.Client == nil {
+		opts.Client = http.DefaultClient
+	}
+	return &Proxy{template: template, opts: opts, cache: lrucache.New(opts.CacheBytes)}, nil
+}
+
+// ZoomRange returns the zooms the proxy serves
+func (p *Proxy) ZoomRange() (minZoom, maxZoom int) {
+	return 0, p.opts.MaxZoom
+}
+
+// tileURL returns the upstream URL of tile z/x/y
+func (p *Proxy) tileURL(z, x, y int) string {
+	return strings.NewReplacer("{z}", strconv.Itoa(z), "{x}", strconv.Itoa(x), "{y}", strconv.Itoa(y)).Replace(p.template)
+}
+
+// Tile fetches tile z/x/y from upstream, or the cache, and scales it to
+// opts.Size over opts.Background. A buffer around the tile is left as
+// background, as the upstream tile has no pixels beyond its edges.
+func (p *Proxy) Tile(ctx context.Context, z, x, y int, opts imagery.TileOptions) (image.Image, error) {
+	if _, err := tilemath.TileBounds(z, x, y); err != nil {
+		return nil, fmt.Errorf("invalid tile coordinates: %w", err)
+	}
+	size := cmp.Or(opts.Size, imagery.TileSize)
+	tile := image.NewRGBA(image.Rect(0, 0, size+2*opts.Buffer, size+2*opts.Buffer))
+	if opts.Background != nil {
+		draw.Draw(tile, tile.Bounds(), &image.Uniform{opts.Background}, image.Point{}, draw.Src)
+	}
+
+	data, err := p.fetch(ctx, z, x, y)
+	switch {
+	case errors.Is(err, errUpstreamMissing) && p.opts.Transparent:
+		return tile, nil
+	case errors.Is(err, errUpstreamMissing):
+		return nil, fmt.Errorf("tile %d/%d/%d: %w", z, x, y, ErrTileNotFound)
+	case err != nil:
+		return nil, err
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode upstream tile %d/%d/%d: %w", z, x, y, err)
+	}
+	dst := image.Rect(opts.Buffer, opts.Buffer, opts.Buffer+size, opts.Buffer+size)
+	xdraw.CatmullRom.Scale(tile, dst, src, src.Bounds(), xdraw.Over, nil)
+	return tile, nil
+}
+
+// fetch returns the encoded upstream tile z/x/y, from the cache if it was
+// fetched before. An upstream 404 or timeout is errUpstreamMissing; the
+// caller's ctx ending returns ctx.Err().
+func (p *Proxy) fetch(ctx context.Context, z, x, y int) ([]byte, error) {
+	u := p.tileURL(z, x, y)
+	if data, ok := p.cache.Get(u); ok {
+		return data, nil
+	}
+
+	reqCtx, cancel := context.WithTimeout(ctx, p.opts.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", p.opts.UserAgent)
+
+	resp, err := p.opts.Client.Do(req)
+	if err == nil {
+		defer resp.Body.Close()
+	}
+	switch {
+	case ctx.Err() != nil:
+		return nil, ctx.Err()
+	case reqCtx.Err() != nil:
+		return nil, errUpstreamMissing
+	case err != nil:
+		return nil, fmt.Errorf("failed to fetch upstream tile: %w", err)
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusNoContent:
+		return nil, errUpstreamMissing
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("upstream returned %s for tile %d/%d/%d", resp.Status, z, x, y)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxUpstreamTileBytes+1))
+	switch {
+	case ctx.Err() != nil:
+		return nil, ctx.Err()
+	case reqCtx.Err() != nil:
+		return nil, errUpstreamMissing
+	case err != nil:
+		return nil, fmt.Errorf("failed to read upstream tile: %w", err)
+	case len(data) > maxUpstreamTileBytes:
+		return nil, fmt.Errorf("upstream tile %d/%d/%d is larger than %d bytes", z, x, y, maxUpstreamTileBytes)
+	}
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode upstream tile %d/%d/%d: %w", z, x, y, err)
+	}
+	if cfg.Width > maxUpstreamTileSize || cfg.Height > maxUpstreamTileSize {
+		return nil, fmt.Errorf("upstream tile %d/%d/%d is %dx%d, larger than %dx%d",
+			z, x, y, cfg.Width, cfg.Height, maxUpstreamTileSize, maxUpstreamTileSize)
+	}
+	p.cache.Add(u, data)
+	return data, nil
+}
@@ -0,0 +1,210 @@
+package tileprovider
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"org.xyzmaps.xyztiles/src/imagery"
+)
+
+// solidPNG returns a size x size PNG filled with c
+func solidPNG(t *testing.T, size int, c color.RGBA) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	for i := 0; i < len(img.Pix); i += 4 {
+		img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3] = c.R, c.G, c.B, c.A
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("Failed to encode PNG: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// upstream starts a tile server answering /{z}/{x}/{y}.png with a blue tile,
+// or 404 for zoom 5, counting requests in hits
+func upstream(t *testing.T, hits *atomic.Int64) *httptest.Server {
+	t.Helper()
+	tile := solidPNG(t, 256, color.RGBA{0, 0, 255, 255})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		if strings.HasPrefix(r.URL.Path, "/5/") {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(tile)
+	}))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func TestProxy_Tile(t *testing.T) {
+	var hits atomic.Int64
+	ts := upstream(t, &hits)
+	p, err := NewProxy(ts.URL+"/{z}/{x}/{y}.png", ProxyOptions{})
+	if err != nil {
+		t.Fatalf("NewProxy() failed: %v", err)
+	}
+
+	for range 3 {
+		tile, err := p.Tile(context.Background(), 3, 1, 2, imagery.TileOptions{Size: 512, Buffer: 2})
+		if err != nil {
+			t.Fatalf("Tile() failed: %v", err)
+		}
+		if got := tile.Bounds().Dx(); got != 516 {
+			t.Errorf("Expected a 516px tile, got %dpx", got)
+		}
+		if got := color.RGBAModel.Convert(tile.At(200, 200)); got != (color.RGBA{0, 0, 255, 255}) {
+			t.Errorf("Expected the upstream color, got %v", got)
+		}
+		if got := color.RGBAModel.Convert(tile.At(0, 0)); got != (color.RGBA{}) {
+			t.Errorf("Expected a transparent buffer, got %v", got)
+		}
+	}
+	if n := hits.Load(); n != 1 {
+		t.Errorf("Expected the tile fetched once and then cached, got %d upstream requests", n)
+	}
+	if n := p.cache.Len(); n != 1 {
+		t.Errorf("Expected 1 cached tile, got %d", n)
+	}
+}
+
+func TestProxy_Missing(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	t.Cleanup(slow.Close)
+	var hits atomic.Int64
+	ts := upstream(t, &hits)
+
+	tests := []struct {
+		url         string
+		transparent bool
+		name        string
+	}{
+		{ts.URL + "/{z}/{x}/{y}.png", false, "upstream 404"},
+		{ts.URL + "/{z}/{x}/{y}.png", true, "upstream 404 as transparent"},
+		{slow.URL + "/{z}/{x}/{y}.png", false, "upstream timeout"},
+		{slow.URL + "/{z}/{x}/{y}.png", true, "upstream timeout as transparent"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := NewProxy(tt.url, ProxyOptions{Timeout: 50 * time.Millisecond, Transparent: tt.transparent})
+			if err != nil {
+				t.Fatalf("NewProxy() failed: %v", err)
+			}
+			tile, err := p.Tile(context.Background(), 5, 1, 1, imagery.TileOptions{})
+			if !tt.transparent {
+				if !errors.Is(err, ErrTileNotFound) {
+					t.Errorf("Expected ErrTileNotFound, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Tile() failed: %v", err)
+			}
+			if got := color.RGBAModel.Convert(tile.At(128, 128)); got != (color.RGBA{}) {
+				t.Errorf("Expected a transparent tile, got %v", got)
+			}
+			if p.cache.Len() != 0 {
+				t.Error("Expected a missing tile not to be cached")
+			}
+		})
+	}
+}
+
+func TestProxy_Errors(t *testing.T) {
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "overloaded", http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(failing.Close)
+	p, err := NewProxy(failing.URL+"/{z}/{x}/{y}.png", ProxyOptions{Transparent: true})
+	if err != nil {
+		t.Fatalf("NewProxy() failed: %v", err)
+	}
+
+	if _, err := p.Tile(context.Background(), 1, 0, 0, imagery.TileOptions{}); err == nil || errors.Is(err, ErrTileNotFound) {
+		t.Errorf("Expected an upstream error other than not found, got %v", err)
+	}
+	if _, err := p.Tile(context.Background(), 1, 2, 0, imagery.TileOptions{}); !errors.Is(err, imagery.ErrOutOfRange) {
+		t.Errorf("Expected ErrOutOfRange, got %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := p.Tile(ctx, 1, 0, 0, imagery.TileOptions{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
+
+func TestProxy_Oversized(t *testing.T) {
+	big := solidPNG(t, 4*imagery.TileSize, color.RGBA{0, 0, 255, 255})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(big)
+	}))
+	t.Cleanup(ts.Close)
+	p, err := NewProxy(ts.URL+"/{z}/{x}/{y}.png", ProxyOptions{Transparent: true})
+	if err != nil {
+		t.Fatalf("NewProxy() failed: %v", err)
+	}
+
+	_, err = p.Tile(context.Background(), 1, 0, 0, imagery.TileOptions{})
+	if err == nil || !strings.Contains(err.Error(), "larger than") {
+		t.Errorf("Expected an oversized upstream tile rejected, got %v", err)
+	}
+	if p.cache.Len() != 0 {
+		t.Error("Expected an oversized tile not to be cached")
+	}
+}
+
+func TestNewProxy(t *testing.T) {
+	tests := []struct {
+		template  string
+		opts      ProxyOptions
+		expectErr bool
+		name      string
+	}{
+		{"https://tile.example.com/{z}/{x}/{y}.png", ProxyOptions{}, false, "valid"},
+		{"http://localhost:8080/tiles/{z}/{y}/{x}?key=abc", ProxyOptions{}, false, "reordered with query"},
+		{"https://tile.example.com/{z}/{x}.png", ProxyOptions{}, true, "no y"},
+		{"ftp://tile.example.com/{z}/{x}/{y}.png", ProxyOptions{}, true, "unsupported scheme"},
+		{"/tiles/{z}/{x}/{y}.png", ProxyOptions{}, true, "no host"},
+		{"https://tile.example.com/{z}/{x}/{y}.png", ProxyOptions{Timeout: -time.Second}, true, "negative timeout"},
+		{"https://tile.example.com/{z}/{x}/{y}.png", ProxyOptions{MaxZoom: 31}, true, "max zoom too high"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewProxy(tt.template, tt.opts)
+			if (err != nil) != tt.expectErr {
+				t.Errorf("Expected error: %v, got %v", tt.expectErr, err)
+			}
+		})
+	}
+
+	p, err := NewProxy("https://tile.example.com/{z}/{x}/{y}.png", ProxyOptions{})
+	if err != nil {
+		t.Fatalf("NewProxy() failed: %v", err)
+	}
+	if minZoom, maxZoom := p.ZoomRange(); minZoom != 0 || maxZoom != DefaultProxyMaxZoom {
+		t.Errorf("Expected zooms 0-%d, got %d-%d", DefaultProxyMaxZoom, minZoom, maxZoom)
+	}
+	if got := p.tileURL(4, 3, 2); got != "https://tile.example.com/4/3/2.png" {
+		t.Errorf("Expected https://tile.example.com/4/3/2.png, got %s", got)
+	}
+}